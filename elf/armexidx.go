@@ -0,0 +1,236 @@
+package elf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// exidxCantUnwind is the second word of an .ARM.exidx entry for
+// functions that cannot be unwound.
+const exidxCantUnwind = 1
+
+// An ARMExidxEntry is an entry of the .ARM.exidx exception index table
+// of a 32-bit ARM file. It describes how to unwind the functions from Func
+// up to the Func of the next entry.
+type ARMExidxEntry struct {
+	Func       uint64 // address of the first function covered
+	CantUnwind bool   // the functions cannot be unwound (EXIDX_CANTUNWIND)
+	Inline     uint32 // if non-zero, the compact unwind instructions of the entry
+	Extab      uint64 // otherwise, the address of the .ARM.extab entry
+}
+
+// prel31 decodes the place-relative 31-bit offset in w at address addr.
+func prel31(w uint32, addr uint64) uint64 {
+	return addr + uint64(int64(int32(w<<1)>>1))
+}
+
+// encodePrel31 returns the place-relative 31-bit offset from addr to
+// target, keeping bit 31 of w.
+func encodePrel31(w uint32, addr, target uint64) (uint32, error) {
+	d := int64(target - addr)
+	if d < -1<<30 || d >= 1<<30 {
+		return 0, fmt.Errorf("%#x is out of the 31-bit range of %#x", target, addr)
+	}
+	return w&0x80000000 | uint32(d)&0x7fffffff, nil
+}
+
+// armExidxSection returns the .ARM.exidx section of f, or nil.
+func (f *File) armExidxSection() *Section {
+	if f.Machine != EM_ARM {
+		return nil
+	}
+	for _, s := range f.Sections {
+		if s.Type == SHT_ARM_EXIDX && s.Flags&SHF_ALLOC != 0 {
+			return s
+		}
+	}
+	return nil
+}
+
+// ARMExidx returns the entries of the .ARM.exidx section of a 32-bit ARM
+// file.
+func (f *File) ARMExidx() ([]ARMExidxEntry, error) {
+	s := f.armExidxSection()
+	if s == nil {
+		return nil, errors.New("no .ARM.exidx section")
+	}
+	return f.readARMExidx(s, s.Addr)
+}
+
+// readARMExidx decodes the entries of s, the .ARM.exidx section, as if it
+// were at address addr.
+func (f *File) readARMExidx(s *Section, addr uint64) ([]ARMExidxEntry, error) {
+	data, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%8 != 0 {
+		return nil, fmt.Errorf("size of %s is not a multiple of 8", s.Name)
+	}
+	entries := make([]ARMExidxEntry, len(data)/8)
+	for i := range entries {
+		at := addr + uint64(8*i)
+		w0, w1 := f.ByteOrder.Uint32(data[8*i:]), f.ByteOrder.Uint32(data[8*i+4:])
+		e := &entries[i]
+		e.Func = prel31(w0, at)
+		switch {
+		case w1 == exidxCantUnwind:
+			e.CantUnwind = true
+		case w1&0x80000000 != 0:
+			e.Inline = w1
+		default:
+			e.Extab = prel31(w1, at+4)
+		}
+	}
+	return entries, nil
+}
+
+// recordARMLayout remembers the addresses of the sections of a 32-bit ARM
+// file with an .ARM.exidx section, so that syncARMExidx can tell which of
+// them moved.
+func (f *File) recordARMLayout() {
+	if f.armExidxSection() == nil {
+		return
+	}
+	f.armLayout = make(map[*Section]uint64)
+	for _, s := range f.Sections {
+		// TLS sections overlap the addresses of the ones after them.
+		if s.Flags&SHF_ALLOC != 0 && s.Flags&SHF_TLS == 0 {
+			f.armLayout[s] = s.Addr
+		}
+	}
+}
+
+// armMovedAddr returns where the byte at the parsed address addr is now,
+// given the sections that moved since f was parsed. An address just past
+// the end of a section, as used to close the table, moves with it.
+func (f *File) armMovedAddr(addr uint64) uint64 {
+	var end *Section
+	for s, old := range f.armLayout {
+		if old <= addr && addr < old+s.Size {
+			return addr + s.Addr - old
+		}
+		if addr == old+s.Size && s.Size != 0 {
+			end = s
+		}
+	}
+	if end != nil {
+		return addr + end.Addr - f.armLayout[end]
+	}
+	return addr
+}
+
+// syncARMExidx keeps the .ARM.exidx table of a 32-bit ARM file working
+// after sections were moved. The entries are re-encoded for the new
+// addresses of the code and .ARM.extab entries they refer to and sorted
+// again, the personality routine offsets of the .ARM.extab entries are
+// updated, and PT_ARM_EXIDX is pointed at the section.
+func (f *File) syncARMExidx() error {
+	exidx := f.armExidxSection()
+	if exidx == nil || f.armLayout == nil {
+		return nil
+	}
+	for _, p := range f.Progs {
+		if p.Type == PT_ARM_EXIDX {
+			p.Off, p.Vaddr, p.Paddr = exidx.Offset, exidx.Addr, exidx.Addr
+			p.Filesz, p.Memsz = exidx.Size, exidx.Size
+		}
+	}
+
+	moved := false
+	for s, old := range f.armLayout {
+		moved = moved || s.Addr != old
+	}
+	if !moved {
+		return nil
+	}
+
+	entries, err := f.readARMExidx(exidx, f.armLayout[exidx])
+	if err != nil {
+		return err
+	}
+	bo := f.ByteOrder
+	extabs := make(map[*Section][]byte)
+	fixed := make(map[uint64]bool)
+	for i := range entries {
+		e := &entries[i]
+		e.Func = f.armMovedAddr(e.Func)
+		if e.CantUnwind || e.Inline != 0 {
+			continue
+		}
+		old := e.Extab
+		e.Extab = f.armMovedAddr(old)
+		if fixed[old] {
+			continue
+		}
+		fixed[old] = true
+
+		// The generic model starts with the offset of the
+		// personality routine.
+		s := f.armSectionAt(old)
+		if s == nil {
+			continue
+		}
+		data, ok := extabs[s]
+		if !ok {
+			if data, err = s.Data(); err != nil {
+				return err
+			}
+			extabs[s] = data
+		}
+		off := old - f.armLayout[s]
+		if off+4 > uint64(len(data)) {
+			return fmt.Errorf("exception table entry at %#x is outside of %s", old, s.Name)
+		}
+		w := bo.Uint32(data[off:])
+		if w&0x80000000 != 0 {
+			continue // compact model
+		}
+		if w, err = encodePrel31(w, e.Extab, f.armMovedAddr(prel31(w, old))); err != nil {
+			return err
+		}
+		bo.PutUint32(data[off:], w)
+	}
+	for s, data := range extabs {
+		s.Replace(bytes.NewReader(data), int64(len(data)))
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Func < entries[j].Func })
+	data := make([]byte, 8*len(entries))
+	for i, e := range entries {
+		at := exidx.Addr + uint64(8*i)
+		w0, err := encodePrel31(0, at, e.Func)
+		if err != nil {
+			return err
+		}
+		w1 := uint32(exidxCantUnwind)
+		switch {
+		case e.Inline != 0:
+			w1 = e.Inline
+		case !e.CantUnwind:
+			if w1, err = encodePrel31(0, at+4, e.Extab); err != nil {
+				return err
+			}
+		}
+		bo.PutUint32(data[8*i:], w0)
+		bo.PutUint32(data[8*i+4:], w1)
+	}
+	exidx.Replace(bytes.NewReader(data), int64(len(data)))
+
+	for s := range f.armLayout {
+		f.armLayout[s] = s.Addr
+	}
+	return nil
+}
+
+// armSectionAt returns the section that held the parsed address addr.
+func (f *File) armSectionAt(addr uint64) *Section {
+	for s, old := range f.armLayout {
+		if s.Type != SHT_NOBITS && old <= addr && addr < old+s.Size {
+			return s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// buildARMExec returns a little-endian 32-bit ARM executable, loaded at
+// 0x10000, with two code sections, one .ARM.extab entry and an .ARM.exidx
+// table covering both code sections.
+func buildARMExec() []byte {
+	le := binary.LittleEndian
+	const base = 0x10000
+	word := func(b []byte, off int, addr, target uint32) {
+		le.PutUint32(b[off:], (target-addr)&0x7fffffff)
+	}
+
+	text := make([]byte, 0x20)
+	text2 := make([]byte, 0x10)
+	extab := make([]byte, 8)
+	word(extab, 0, base+0x200, base+0x118) // personality routine
+	le.PutUint32(extab[4:], 0xb0b0b000)
+	exidx := make([]byte, 32)
+	word(exidx, 0, base+0x300, base+0x100)
+	word(exidx, 4, base+0x304, base+0x200)
+	word(exidx, 8, base+0x308, base+0x110)
+	le.PutUint32(exidx[12:], 0x80b0b0b0)
+	word(exidx, 16, base+0x310, base+0x120)
+	le.PutUint32(exidx[20:], exidxCantUnwind)
+	word(exidx, 24, base+0x318, base+0x180)
+	le.PutUint32(exidx[28:], exidxCantUnwind)
+
+	sections := []struct {
+		name  string
+		typ   SectionType
+		flags SectionFlag
+		off   int
+		data  []byte
+	}{
+		{".text", SHT_PROGBITS, SHF_ALLOC | SHF_EXECINSTR, 0x100, text},
+		{".text.b", SHT_PROGBITS, SHF_ALLOC | SHF_EXECINSTR, 0x180, text2},
+		{".ARM.extab", SHT_PROGBITS, SHF_ALLOC, 0x200, extab},
+		{".ARM.exidx", SHT_ARM_EXIDX, SHF_ALLOC | SHF_LINK_ORDER, 0x300, exidx},
+		{".shstrtab", SHT_STRTAB, 0, 0x400, nil},
+	}
+	shstrtab := []byte{0}
+	for _, s := range sections {
+		shstrtab = append(append(shstrtab, s.name...), 0)
+	}
+	sections[len(sections)-1].data = shstrtab
+
+	out := make([]byte, 0x500)
+	shdrs := []Section32{{}}
+	nameOff := uint32(1)
+	for _, s := range sections {
+		sh := Section32{
+			Name: nameOff, Type: uint32(s.typ), Flags: uint32(s.flags), Off: uint32(s.off),
+			Size: uint32(len(s.data)), Addralign: 4,
+		}
+		if s.flags&SHF_ALLOC != 0 {
+			sh.Addr = base + uint32(s.off)
+		}
+		if s.typ == SHT_ARM_EXIDX {
+			sh.Link = 1
+		}
+		shdrs = append(shdrs, sh)
+		nameOff += uint32(len(s.name)) + 1
+		copy(out[s.off:], s.data)
+	}
+	var b bytes.Buffer
+	binary.Write(&b, le, shdrs)
+	out = append(out, b.Bytes()...)
+
+	b.Reset()
+	binary.Write(&b, le, []Prog32{
+		{Type: uint32(PT_LOAD), Vaddr: base, Paddr: base, Filesz: 0x400, Memsz: 0x400, Flags: uint32(PF_R | PF_X), Align: 0x1000},
+		{Type: uint32(PT_ARM_EXIDX), Off: 0x300, Vaddr: base + 0x300, Paddr: base + 0x300, Filesz: 32, Memsz: 32, Flags: uint32(PF_R), Align: 4},
+	})
+	copy(out[52:], b.Bytes())
+
+	hdr := Header32{
+		Type: uint16(ET_EXEC), Machine: uint16(EM_ARM), Version: uint32(EV_CURRENT), Entry: base + 0x100,
+		Phoff: 52, Shoff: 0x500, Ehsize: 52, Phentsize: 32, Phnum: 2,
+		Shentsize: 40, Shnum: uint16(len(shdrs)), Shstrndx: uint16(len(shdrs) - 1),
+	}
+	copy(hdr.Ident[:], ELFMAG)
+	hdr.Ident[EI_CLASS] = byte(ELFCLASS32)
+	hdr.Ident[EI_DATA] = byte(ELFDATA2LSB)
+	hdr.Ident[EI_VERSION] = byte(EV_CURRENT)
+	b.Reset()
+	binary.Write(&b, le, hdr)
+	copy(out, b.Bytes())
+	return out
+}
+
+func TestARMExidx(t *testing.T) {
+	f, err := NewFile(bytes.NewReader(buildARMExec()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := f.ARMExidx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ARMExidxEntry{
+		{Func: 0x10100, Extab: 0x10200},
+		{Func: 0x10110, Inline: 0x80b0b0b0},
+		{Func: 0x10120, CantUnwind: true},
+		{Func: 0x10180, CantUnwind: true},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Fatalf("ARMExidx() = %+v, want %+v", entries, want)
+	}
+
+	// Move .text past .text.b, and the table itself.
+	f.Section(".text").Addr += 0x1000
+	exidx := f.Section(".ARM.exidx")
+	exidx.Addr += 0x80
+	exidx.Offset += 0x80
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = g.ARMExidx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []ARMExidxEntry{
+		{Func: 0x10180, CantUnwind: true},
+		{Func: 0x11100, Extab: 0x10200},
+		{Func: 0x11110, Inline: 0x80b0b0b0},
+		{Func: 0x11120, CantUnwind: true},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("ARMExidx() = %+v after moving .text, want %+v", entries, want)
+	}
+
+	extab, err := g.Section(".ARM.extab").Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := prel31(binary.LittleEndian.Uint32(extab), 0x10200); got != 0x11118 {
+		t.Errorf("personality routine is at %#x, want %#x", got, 0x11118)
+	}
+
+	s := g.Section(".ARM.exidx")
+	for _, p := range g.Progs {
+		if p.Type == PT_ARM_EXIDX && (p.Off != s.Offset || p.Vaddr != s.Addr || p.Filesz != s.Size) {
+			t.Errorf("PT_ARM_EXIDX is at %#x (offset %#x, size %#x), want %#x (offset %#x, size %#x)",
+				p.Vaddr, p.Off, p.Filesz, s.Addr, s.Offset, s.Size)
+		}
+	}
+}
+
+func TestARMExidxNone(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.ARMExidx(); err == nil {
+		t.Error("ARMExidx succeeded for an x86-64 file")
+	}
+}
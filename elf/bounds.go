@@ -0,0 +1,67 @@
+package elf
+
+import (
+	"encoding/binary"
+	"os"
+)
+
+// knownSize returns the size of the bytes f is read from, if it can tell
+// without reading them.
+func (f *File) knownSize() (int64, bool) {
+	if f.rawSize >= 0 {
+		return f.rawSize, true
+	}
+	switch f.raw.(type) {
+	case interface{ Size() int64 }, interface{ Stat() (os.FileInfo, error) }:
+		n, err := f.rawLen()
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// checkHeaderTables checks the offsets, entry sizes and counts of the
+// program and section header tables read from the file header.
+func (f *File) checkHeaderTables(phoff int64, phentsize, phnum, shentsize, shnum int) error {
+	wantPh, wantSh := binary.Size(Prog32{}), binary.Size(Section32{})
+	if f.Class == ELFCLASS64 {
+		wantPh, wantSh = binary.Size(Prog64{}), binary.Size(Section64{})
+	}
+	switch {
+	case phnum > 0 && phoff <= 0:
+		return &FormatError{0, "invalid ELF phoff", phoff}
+	case phnum > 0 && phentsize < wantPh:
+		return &FormatError{0, "invalid ELF phentsize", phentsize}
+	case f.SHTOffset < 0:
+		return &FormatError{0, "invalid ELF shoff", f.SHTOffset}
+	case f.SHTOffset == 0 && shnum != 0:
+		return &FormatError{0, "invalid ELF shnum for shoff=0", shnum}
+	case f.SHTOffset > 0 && shentsize < wantSh:
+		return &FormatError{0, "invalid ELF shentsize", shentsize}
+	}
+	if err := f.checkTable(phoff, phentsize, phnum, "program header table"); err != nil {
+		return err
+	}
+	return f.checkTable(f.SHTOffset, shentsize, shnum, "section header table")
+}
+
+// checkTable checks that n entries of size entsize at off fit in the file.
+// If its size is not known, the last byte of the table is read instead.
+func (f *File) checkTable(off int64, entsize, n int, what string) error {
+	if n == 0 {
+		return nil
+	}
+	size, ok := f.knownSize()
+	if !ok {
+		size = 1<<63 - 1
+	}
+	if off < 0 || off > size || entsize <= 0 || n < 0 || uint64(n) > uint64(size-off)/uint64(entsize) {
+		return &FormatError{off, what + " runs past the end of the file", n}
+	}
+	if !ok {
+		var b [1]byte
+		if _, err := f.raw.ReadAt(b[:], off+int64(n)*int64(entsize)-1); err != nil {
+			return &FormatError{off, what + " runs past the end of the file", n}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+// unsized hides the size of the reader it wraps.
+type unsized struct{ r io.ReaderAt }
+
+func (u unsized) ReadAt(p []byte, off int64) (int, error) { return u.r.ReadAt(p, off) }
+
+func TestExtendedShnumBounds(t *testing.T) {
+	// An ELF64 header with e_shnum 0 and a section header table at 64
+	// whose initial entry claims 1<<40 sections.
+	b := make([]byte, 128)
+	copy(b, "\x7fELF\x02\x01\x01")
+	le := binary.LittleEndian
+	le.PutUint16(b[16:], uint16(ET_EXEC))
+	le.PutUint16(b[18:], uint16(EM_X86_64))
+	le.PutUint32(b[20:], uint32(EV_CURRENT))
+	le.PutUint64(b[40:], 64) // e_shoff
+	le.PutUint16(b[52:], 64) // e_ehsize
+	le.PutUint16(b[58:], 64) // e_shentsize
+	le.PutUint64(b[64+32:], 1<<40)
+	for _, r := range []io.ReaderAt{bytes.NewReader(b), unsized{bytes.NewReader(b)}} {
+		if _, err := NewFile(r); err == nil || !strings.Contains(err.Error(), "runs past the end of the file") {
+			t.Errorf("%T: NewFile() = %v", r, err)
+		}
+	}
+}
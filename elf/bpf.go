@@ -0,0 +1,483 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BPFProgType is a program type of the bpf system call (enum bpf_prog_type).
+type BPFProgType uint32
+
+const (
+	BPF_PROG_TYPE_UNSPEC                  BPFProgType = 0
+	BPF_PROG_TYPE_SOCKET_FILTER           BPFProgType = 1
+	BPF_PROG_TYPE_KPROBE                  BPFProgType = 2
+	BPF_PROG_TYPE_SCHED_CLS               BPFProgType = 3
+	BPF_PROG_TYPE_SCHED_ACT               BPFProgType = 4
+	BPF_PROG_TYPE_TRACEPOINT              BPFProgType = 5
+	BPF_PROG_TYPE_XDP                     BPFProgType = 6
+	BPF_PROG_TYPE_PERF_EVENT              BPFProgType = 7
+	BPF_PROG_TYPE_CGROUP_SKB              BPFProgType = 8
+	BPF_PROG_TYPE_CGROUP_SOCK             BPFProgType = 9
+	BPF_PROG_TYPE_LWT_IN                  BPFProgType = 10
+	BPF_PROG_TYPE_LWT_OUT                 BPFProgType = 11
+	BPF_PROG_TYPE_LWT_XMIT                BPFProgType = 12
+	BPF_PROG_TYPE_SOCK_OPS                BPFProgType = 13
+	BPF_PROG_TYPE_SK_SKB                  BPFProgType = 14
+	BPF_PROG_TYPE_CGROUP_DEVICE           BPFProgType = 15
+	BPF_PROG_TYPE_SK_MSG                  BPFProgType = 16
+	BPF_PROG_TYPE_RAW_TRACEPOINT          BPFProgType = 17
+	BPF_PROG_TYPE_CGROUP_SOCK_ADDR        BPFProgType = 18
+	BPF_PROG_TYPE_LWT_SEG6LOCAL           BPFProgType = 19
+	BPF_PROG_TYPE_LIRC_MODE2              BPFProgType = 20
+	BPF_PROG_TYPE_SK_REUSEPORT            BPFProgType = 21
+	BPF_PROG_TYPE_FLOW_DISSECTOR          BPFProgType = 22
+	BPF_PROG_TYPE_CGROUP_SYSCTL           BPFProgType = 23
+	BPF_PROG_TYPE_RAW_TRACEPOINT_WRITABLE BPFProgType = 24
+	BPF_PROG_TYPE_CGROUP_SOCKOPT          BPFProgType = 25
+	BPF_PROG_TYPE_TRACING                 BPFProgType = 26
+	BPF_PROG_TYPE_STRUCT_OPS              BPFProgType = 27
+	BPF_PROG_TYPE_EXT                     BPFProgType = 28
+	BPF_PROG_TYPE_LSM                     BPFProgType = 29
+	BPF_PROG_TYPE_SK_LOOKUP               BPFProgType = 30
+	BPF_PROG_TYPE_SYSCALL                 BPFProgType = 31
+)
+
+var bpfProgTypeStrings = []intName{
+	{0, "BPF_PROG_TYPE_UNSPEC"},
+	{1, "BPF_PROG_TYPE_SOCKET_FILTER"},
+	{2, "BPF_PROG_TYPE_KPROBE"},
+	{3, "BPF_PROG_TYPE_SCHED_CLS"},
+	{4, "BPF_PROG_TYPE_SCHED_ACT"},
+	{5, "BPF_PROG_TYPE_TRACEPOINT"},
+	{6, "BPF_PROG_TYPE_XDP"},
+	{7, "BPF_PROG_TYPE_PERF_EVENT"},
+	{8, "BPF_PROG_TYPE_CGROUP_SKB"},
+	{9, "BPF_PROG_TYPE_CGROUP_SOCK"},
+	{10, "BPF_PROG_TYPE_LWT_IN"},
+	{11, "BPF_PROG_TYPE_LWT_OUT"},
+	{12, "BPF_PROG_TYPE_LWT_XMIT"},
+	{13, "BPF_PROG_TYPE_SOCK_OPS"},
+	{14, "BPF_PROG_TYPE_SK_SKB"},
+	{15, "BPF_PROG_TYPE_CGROUP_DEVICE"},
+	{16, "BPF_PROG_TYPE_SK_MSG"},
+	{17, "BPF_PROG_TYPE_RAW_TRACEPOINT"},
+	{18, "BPF_PROG_TYPE_CGROUP_SOCK_ADDR"},
+	{19, "BPF_PROG_TYPE_LWT_SEG6LOCAL"},
+	{20, "BPF_PROG_TYPE_LIRC_MODE2"},
+	{21, "BPF_PROG_TYPE_SK_REUSEPORT"},
+	{22, "BPF_PROG_TYPE_FLOW_DISSECTOR"},
+	{23, "BPF_PROG_TYPE_CGROUP_SYSCTL"},
+	{24, "BPF_PROG_TYPE_RAW_TRACEPOINT_WRITABLE"},
+	{25, "BPF_PROG_TYPE_CGROUP_SOCKOPT"},
+	{26, "BPF_PROG_TYPE_TRACING"},
+	{27, "BPF_PROG_TYPE_STRUCT_OPS"},
+	{28, "BPF_PROG_TYPE_EXT"},
+	{29, "BPF_PROG_TYPE_LSM"},
+	{30, "BPF_PROG_TYPE_SK_LOOKUP"},
+	{31, "BPF_PROG_TYPE_SYSCALL"},
+}
+
+func (i BPFProgType) String() string   { return stringName(uint32(i), bpfProgTypeStrings, false) }
+func (i BPFProgType) GoString() string { return stringName(uint32(i), bpfProgTypeStrings, true) }
+
+// BPFAttachType is an attach type of the bpf system call (enum
+// bpf_attach_type).
+type BPFAttachType uint32
+
+const (
+	BPF_CGROUP_INET_INGRESS            BPFAttachType = 0
+	BPF_CGROUP_INET_EGRESS             BPFAttachType = 1
+	BPF_CGROUP_INET_SOCK_CREATE        BPFAttachType = 2
+	BPF_CGROUP_SOCK_OPS                BPFAttachType = 3
+	BPF_SK_SKB_STREAM_PARSER           BPFAttachType = 4
+	BPF_SK_SKB_STREAM_VERDICT          BPFAttachType = 5
+	BPF_CGROUP_DEVICE                  BPFAttachType = 6
+	BPF_SK_MSG_VERDICT                 BPFAttachType = 7
+	BPF_CGROUP_INET4_BIND              BPFAttachType = 8
+	BPF_CGROUP_INET6_BIND              BPFAttachType = 9
+	BPF_CGROUP_INET4_CONNECT           BPFAttachType = 10
+	BPF_CGROUP_INET6_CONNECT           BPFAttachType = 11
+	BPF_CGROUP_INET4_POST_BIND         BPFAttachType = 12
+	BPF_CGROUP_INET6_POST_BIND         BPFAttachType = 13
+	BPF_CGROUP_UDP4_SENDMSG            BPFAttachType = 14
+	BPF_CGROUP_UDP6_SENDMSG            BPFAttachType = 15
+	BPF_LIRC_MODE2                     BPFAttachType = 16
+	BPF_FLOW_DISSECTOR                 BPFAttachType = 17
+	BPF_CGROUP_SYSCTL                  BPFAttachType = 18
+	BPF_CGROUP_UDP4_RECVMSG            BPFAttachType = 19
+	BPF_CGROUP_UDP6_RECVMSG            BPFAttachType = 20
+	BPF_CGROUP_GETSOCKOPT              BPFAttachType = 21
+	BPF_CGROUP_SETSOCKOPT              BPFAttachType = 22
+	BPF_TRACE_RAW_TP                   BPFAttachType = 23
+	BPF_TRACE_FENTRY                   BPFAttachType = 24
+	BPF_TRACE_FEXIT                    BPFAttachType = 25
+	BPF_MODIFY_RETURN                  BPFAttachType = 26
+	BPF_LSM_MAC                        BPFAttachType = 27
+	BPF_TRACE_ITER                     BPFAttachType = 28
+	BPF_CGROUP_INET4_GETPEERNAME       BPFAttachType = 29
+	BPF_CGROUP_INET6_GETPEERNAME       BPFAttachType = 30
+	BPF_CGROUP_INET4_GETSOCKNAME       BPFAttachType = 31
+	BPF_CGROUP_INET6_GETSOCKNAME       BPFAttachType = 32
+	BPF_XDP_DEVMAP                     BPFAttachType = 33
+	BPF_CGROUP_INET_SOCK_RELEASE       BPFAttachType = 34
+	BPF_XDP_CPUMAP                     BPFAttachType = 35
+	BPF_SK_LOOKUP                      BPFAttachType = 36
+	BPF_XDP                            BPFAttachType = 37
+	BPF_SK_SKB_VERDICT                 BPFAttachType = 38
+	BPF_SK_REUSEPORT_SELECT            BPFAttachType = 39
+	BPF_SK_REUSEPORT_SELECT_OR_MIGRATE BPFAttachType = 40
+)
+
+var bpfAttachTypeStrings = []intName{
+	{0, "BPF_CGROUP_INET_INGRESS"},
+	{1, "BPF_CGROUP_INET_EGRESS"},
+	{2, "BPF_CGROUP_INET_SOCK_CREATE"},
+	{3, "BPF_CGROUP_SOCK_OPS"},
+	{4, "BPF_SK_SKB_STREAM_PARSER"},
+	{5, "BPF_SK_SKB_STREAM_VERDICT"},
+	{6, "BPF_CGROUP_DEVICE"},
+	{7, "BPF_SK_MSG_VERDICT"},
+	{8, "BPF_CGROUP_INET4_BIND"},
+	{9, "BPF_CGROUP_INET6_BIND"},
+	{10, "BPF_CGROUP_INET4_CONNECT"},
+	{11, "BPF_CGROUP_INET6_CONNECT"},
+	{12, "BPF_CGROUP_INET4_POST_BIND"},
+	{13, "BPF_CGROUP_INET6_POST_BIND"},
+	{14, "BPF_CGROUP_UDP4_SENDMSG"},
+	{15, "BPF_CGROUP_UDP6_SENDMSG"},
+	{16, "BPF_LIRC_MODE2"},
+	{17, "BPF_FLOW_DISSECTOR"},
+	{18, "BPF_CGROUP_SYSCTL"},
+	{19, "BPF_CGROUP_UDP4_RECVMSG"},
+	{20, "BPF_CGROUP_UDP6_RECVMSG"},
+	{21, "BPF_CGROUP_GETSOCKOPT"},
+	{22, "BPF_CGROUP_SETSOCKOPT"},
+	{23, "BPF_TRACE_RAW_TP"},
+	{24, "BPF_TRACE_FENTRY"},
+	{25, "BPF_TRACE_FEXIT"},
+	{26, "BPF_MODIFY_RETURN"},
+	{27, "BPF_LSM_MAC"},
+	{28, "BPF_TRACE_ITER"},
+	{29, "BPF_CGROUP_INET4_GETPEERNAME"},
+	{30, "BPF_CGROUP_INET6_GETPEERNAME"},
+	{31, "BPF_CGROUP_INET4_GETSOCKNAME"},
+	{32, "BPF_CGROUP_INET6_GETSOCKNAME"},
+	{33, "BPF_XDP_DEVMAP"},
+	{34, "BPF_CGROUP_INET_SOCK_RELEASE"},
+	{35, "BPF_XDP_CPUMAP"},
+	{36, "BPF_SK_LOOKUP"},
+	{37, "BPF_XDP"},
+	{38, "BPF_SK_SKB_VERDICT"},
+	{39, "BPF_SK_REUSEPORT_SELECT"},
+	{40, "BPF_SK_REUSEPORT_SELECT_OR_MIGRATE"},
+}
+
+func (i BPFAttachType) String() string   { return stringName(uint32(i), bpfAttachTypeStrings, false) }
+func (i BPFAttachType) GoString() string { return stringName(uint32(i), bpfAttachTypeStrings, true) }
+
+// bpfSectionDefs maps the section names of BPF programs, as understood by
+// libbpf, to their program and expected attach types. A section is named
+// after its prefix alone or after "prefix/" and the attach target. More
+// specific prefixes come first.
+var bpfSectionDefs = []struct {
+	prefix string
+	prog   BPFProgType
+	attach BPFAttachType
+}{
+	{"socket", BPF_PROG_TYPE_SOCKET_FILTER, 0},
+	{"sk_reuseport/migrate", BPF_PROG_TYPE_SK_REUSEPORT, BPF_SK_REUSEPORT_SELECT_OR_MIGRATE},
+	{"sk_reuseport", BPF_PROG_TYPE_SK_REUSEPORT, BPF_SK_REUSEPORT_SELECT},
+	{"kprobe", BPF_PROG_TYPE_KPROBE, 0},
+	{"kretprobe", BPF_PROG_TYPE_KPROBE, 0},
+	{"uprobe", BPF_PROG_TYPE_KPROBE, 0},
+	{"uretprobe", BPF_PROG_TYPE_KPROBE, 0},
+	{"tc", BPF_PROG_TYPE_SCHED_CLS, 0},
+	{"classifier", BPF_PROG_TYPE_SCHED_CLS, 0},
+	{"action", BPF_PROG_TYPE_SCHED_ACT, 0},
+	{"tracepoint", BPF_PROG_TYPE_TRACEPOINT, 0},
+	{"tp", BPF_PROG_TYPE_TRACEPOINT, 0},
+	{"raw_tracepoint.w", BPF_PROG_TYPE_RAW_TRACEPOINT_WRITABLE, 0},
+	{"raw_tp.w", BPF_PROG_TYPE_RAW_TRACEPOINT_WRITABLE, 0},
+	{"raw_tracepoint", BPF_PROG_TYPE_RAW_TRACEPOINT, 0},
+	{"raw_tp", BPF_PROG_TYPE_RAW_TRACEPOINT, 0},
+	{"tp_btf", BPF_PROG_TYPE_TRACING, BPF_TRACE_RAW_TP},
+	{"fentry", BPF_PROG_TYPE_TRACING, BPF_TRACE_FENTRY},
+	{"fmod_ret", BPF_PROG_TYPE_TRACING, BPF_MODIFY_RETURN},
+	{"fexit", BPF_PROG_TYPE_TRACING, BPF_TRACE_FEXIT},
+	{"freplace", BPF_PROG_TYPE_EXT, 0},
+	{"lsm", BPF_PROG_TYPE_LSM, BPF_LSM_MAC},
+	{"iter", BPF_PROG_TYPE_TRACING, BPF_TRACE_ITER},
+	{"syscall", BPF_PROG_TYPE_SYSCALL, 0},
+	{"xdp/devmap", BPF_PROG_TYPE_XDP, BPF_XDP_DEVMAP},
+	{"xdp/cpumap", BPF_PROG_TYPE_XDP, BPF_XDP_CPUMAP},
+	{"xdp", BPF_PROG_TYPE_XDP, BPF_XDP},
+	{"perf_event", BPF_PROG_TYPE_PERF_EVENT, 0},
+	{"lwt_in", BPF_PROG_TYPE_LWT_IN, 0},
+	{"lwt_out", BPF_PROG_TYPE_LWT_OUT, 0},
+	{"lwt_xmit", BPF_PROG_TYPE_LWT_XMIT, 0},
+	{"lwt_seg6local", BPF_PROG_TYPE_LWT_SEG6LOCAL, 0},
+	{"sockops", BPF_PROG_TYPE_SOCK_OPS, BPF_CGROUP_SOCK_OPS},
+	{"sk_skb/stream_parser", BPF_PROG_TYPE_SK_SKB, BPF_SK_SKB_STREAM_PARSER},
+	{"sk_skb/stream_verdict", BPF_PROG_TYPE_SK_SKB, BPF_SK_SKB_STREAM_VERDICT},
+	{"sk_skb", BPF_PROG_TYPE_SK_SKB, 0},
+	{"sk_msg", BPF_PROG_TYPE_SK_MSG, BPF_SK_MSG_VERDICT},
+	{"lirc_mode2", BPF_PROG_TYPE_LIRC_MODE2, BPF_LIRC_MODE2},
+	{"flow_dissector", BPF_PROG_TYPE_FLOW_DISSECTOR, BPF_FLOW_DISSECTOR},
+	{"cgroup_skb/ingress", BPF_PROG_TYPE_CGROUP_SKB, BPF_CGROUP_INET_INGRESS},
+	{"cgroup_skb/egress", BPF_PROG_TYPE_CGROUP_SKB, BPF_CGROUP_INET_EGRESS},
+	{"cgroup/skb", BPF_PROG_TYPE_CGROUP_SKB, 0},
+	{"cgroup/sock_create", BPF_PROG_TYPE_CGROUP_SOCK, BPF_CGROUP_INET_SOCK_CREATE},
+	{"cgroup/sock_release", BPF_PROG_TYPE_CGROUP_SOCK, BPF_CGROUP_INET_SOCK_RELEASE},
+	{"cgroup/sock", BPF_PROG_TYPE_CGROUP_SOCK, BPF_CGROUP_INET_SOCK_CREATE},
+	{"cgroup/post_bind4", BPF_PROG_TYPE_CGROUP_SOCK, BPF_CGROUP_INET4_POST_BIND},
+	{"cgroup/post_bind6", BPF_PROG_TYPE_CGROUP_SOCK, BPF_CGROUP_INET6_POST_BIND},
+	{"cgroup/dev", BPF_PROG_TYPE_CGROUP_DEVICE, BPF_CGROUP_DEVICE},
+	{"cgroup/bind4", BPF_PROG_TYPE_CGROUP_SOCK_ADDR, BPF_CGROUP_INET4_BIND},
+	{"cgroup/bind6", BPF_PROG_TYPE_CGROUP_SOCK_ADDR, BPF_CGROUP_INET6_BIND},
+	{"cgroup/connect4", BPF_PROG_TYPE_CGROUP_SOCK_ADDR, BPF_CGROUP_INET4_CONNECT},
+	{"cgroup/connect6", BPF_PROG_TYPE_CGROUP_SOCK_ADDR, BPF_CGROUP_INET6_CONNECT},
+	{"cgroup/sendmsg4", BPF_PROG_TYPE_CGROUP_SOCK_ADDR, BPF_CGROUP_UDP4_SENDMSG},
+	{"cgroup/sendmsg6", BPF_PROG_TYPE_CGROUP_SOCK_ADDR, BPF_CGROUP_UDP6_SENDMSG},
+	{"cgroup/recvmsg4", BPF_PROG_TYPE_CGROUP_SOCK_ADDR, BPF_CGROUP_UDP4_RECVMSG},
+	{"cgroup/recvmsg6", BPF_PROG_TYPE_CGROUP_SOCK_ADDR, BPF_CGROUP_UDP6_RECVMSG},
+	{"cgroup/getpeername4", BPF_PROG_TYPE_CGROUP_SOCK_ADDR, BPF_CGROUP_INET4_GETPEERNAME},
+	{"cgroup/getpeername6", BPF_PROG_TYPE_CGROUP_SOCK_ADDR, BPF_CGROUP_INET6_GETPEERNAME},
+	{"cgroup/getsockname4", BPF_PROG_TYPE_CGROUP_SOCK_ADDR, BPF_CGROUP_INET4_GETSOCKNAME},
+	{"cgroup/getsockname6", BPF_PROG_TYPE_CGROUP_SOCK_ADDR, BPF_CGROUP_INET6_GETSOCKNAME},
+	{"cgroup/sysctl", BPF_PROG_TYPE_CGROUP_SYSCTL, BPF_CGROUP_SYSCTL},
+	{"cgroup/getsockopt", BPF_PROG_TYPE_CGROUP_SOCKOPT, BPF_CGROUP_GETSOCKOPT},
+	{"cgroup/setsockopt", BPF_PROG_TYPE_CGROUP_SOCKOPT, BPF_CGROUP_SETSOCKOPT},
+	{"struct_ops", BPF_PROG_TYPE_STRUCT_OPS, 0},
+	{"sk_lookup", BPF_PROG_TYPE_SK_LOOKUP, BPF_SK_LOOKUP},
+}
+
+// A BPFProgram is a section of an eBPF object that holds a program.
+type BPFProgram struct {
+	Section *Section
+
+	// Type and AttachType are inferred from the section name. Type is
+	// BPF_PROG_TYPE_UNSPEC for names libbpf does not know, such as the
+	// .text of functions that programs call. AttachType is zero for
+	// program types that take no expected attach type.
+	Type       BPFProgType
+	AttachType BPFAttachType
+
+	// AttachTo is what follows the prefix and the slash in the section
+	// name, such as the function of a kprobe or the category and name of
+	// a tracepoint.
+	AttachTo string
+}
+
+// A BPFMap is a map definition of an eBPF object.
+type BPFMap struct {
+	Name       string
+	Section    *Section
+	Offset     uint64 // offset of the definition in Section
+	Type       uint32 // enum bpf_map_type
+	KeySize    uint32
+	ValueSize  uint32
+	MaxEntries uint32
+	Flags      uint32
+}
+
+// A BPFMapRelocation is an instruction of a program that loads the address
+// of a map, which a loader replaces with the map's file descriptor.
+type BPFMapRelocation struct {
+	Section *Section // program section that holds the instruction
+	Offset  uint64   // offset of the ld_imm64 instruction in Section
+	Map     string   // name of the map
+}
+
+const (
+	bpfLdImm64     = 0x18 // BPF_LD | BPF_IMM | BPF_DW
+	bpfPseudoMapFD = 1    // BPF_PSEUDO_MAP_FD
+	bpfInsnSize    = 8
+	bpfMapDefSize  = 20 // sizeof(struct bpf_map_def)
+)
+
+func (f *File) checkBPF() error {
+	if f.Machine != EM_BPF {
+		return fmt.Errorf("not a BPF object: machine is %v", f.Machine)
+	}
+	return nil
+}
+
+// isBPFMapSection reports whether s holds map definitions.
+func isBPFMapSection(s *Section) bool {
+	return s.Name == ".maps" || s.Name == "maps" || strings.HasPrefix(s.Name, "maps/")
+}
+
+// BPFPrograms returns the program sections of an eBPF object, the sections
+// that hold executable instructions.
+func (f *File) BPFPrograms() ([]BPFProgram, error) {
+	if err := f.checkBPF(); err != nil {
+		return nil, err
+	}
+	var progs []BPFProgram
+	for _, s := range f.Sections {
+		if s.Type != SHT_PROGBITS || s.Flags&SHF_EXECINSTR == 0 {
+			continue
+		}
+		p := BPFProgram{Section: s}
+		for _, def := range bpfSectionDefs {
+			if s.Name == def.prefix || strings.HasPrefix(s.Name, def.prefix+"/") {
+				p.Type, p.AttachType = def.prog, def.attach
+				p.AttachTo = strings.TrimPrefix(strings.TrimPrefix(s.Name, def.prefix), "/")
+				break
+			}
+		}
+		progs = append(progs, p)
+	}
+	return progs, nil
+}
+
+// BPFMaps returns the map definitions of an eBPF object: the struct
+// bpf_map_def of each map symbol in the legacy maps sections, and the maps
+// that the BTF of the object describes in .maps.
+func (f *File) BPFMaps() ([]BPFMap, error) {
+	if err := f.checkBPF(); err != nil {
+		return nil, err
+	}
+	syms, err := f.Symbols()
+	if err != nil && err != ErrNoSymbols {
+		return nil, err
+	}
+	var maps []BPFMap
+	for i, s := range f.Sections {
+		if !isBPFMapSection(s) {
+			continue
+		}
+		if s.Name == ".maps" {
+			btfMaps, err := f.btfMaps(s)
+			if err != nil {
+				return nil, err
+			}
+			maps = append(maps, btfMaps...)
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return nil, err
+		}
+		var sectMaps []BPFMap
+		for _, sym := range syms {
+			if int(sym.Section) != i || sym.Name == "" || ST_TYPE(sym.Info) == STT_SECTION {
+				continue
+			}
+			if sym.Value+bpfMapDefSize > uint64(len(data)) {
+				return nil, fmt.Errorf("definition of map %s is past the end of %s", sym.Name, s.Name)
+			}
+			d := data[sym.Value:]
+			sectMaps = append(sectMaps, BPFMap{
+				Name:       sym.Name,
+				Section:    s,
+				Offset:     sym.Value,
+				Type:       f.ByteOrder.Uint32(d),
+				KeySize:    f.ByteOrder.Uint32(d[4:]),
+				ValueSize:  f.ByteOrder.Uint32(d[8:]),
+				MaxEntries: f.ByteOrder.Uint32(d[12:]),
+				Flags:      f.ByteOrder.Uint32(d[16:]),
+			})
+		}
+		sort.SliceStable(sectMaps, func(a, b int) bool { return sectMaps[a].Offset < sectMaps[b].Offset })
+		maps = append(maps, sectMaps...)
+	}
+	return maps, nil
+}
+
+// BPFMapRelocations returns the instructions of the programs of an eBPF
+// object that load the address of a map.
+func (f *File) BPFMapRelocations() ([]BPFMapRelocation, error) {
+	if err := f.checkBPF(); err != nil {
+		return nil, err
+	}
+	syms, err := f.Symbols()
+	if err == ErrNoSymbols {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.Class != ELFCLASS64 {
+		return nil, errors.New("BPF object is not 64-bit")
+	}
+	var relocs []BPFMapRelocation
+	for _, rs := range f.Sections {
+		if (rs.Type != SHT_REL && rs.Type != SHT_RELA) || int(rs.Info) >= len(f.Sections) {
+			continue
+		}
+		s := f.Sections[rs.Info]
+		if s.Type != SHT_PROGBITS || s.Flags&SHF_EXECINSTR == 0 {
+			continue
+		}
+		data, err := rs.Data()
+		if err != nil {
+			return nil, err
+		}
+		entsize := 16
+		if rs.Type == SHT_RELA {
+			entsize = 24
+		}
+		for ; len(data) >= entsize; data = data[entsize:] {
+			off := f.ByteOrder.Uint64(data)
+			info := f.ByteOrder.Uint64(data[8:])
+			symNo := int(info >> 32)
+			if R_BPF(info&0xffffffff) != R_BPF_64_64 || symNo == 0 || symNo > len(syms) {
+				continue
+			}
+			sym := syms[symNo-1]
+			if int(sym.Section) >= len(f.Sections) || !isBPFMapSection(f.Sections[sym.Section]) {
+				continue
+			}
+			relocs = append(relocs, BPFMapRelocation{Section: s, Offset: off, Map: sym.Name})
+		}
+	}
+	return relocs, nil
+}
+
+// PatchBPFMapFDs rewrites each instruction of the programs of an eBPF
+// object that loads the address of a map into a load of the map's file
+// descriptor from fds, as a loader does before passing the programs to the
+// kernel. It is an error for a loaded map to have no descriptor in fds.
+func (f *File) PatchBPFMapFDs(fds map[string]int) error {
+	relocs, err := f.BPFMapRelocations()
+	if err != nil {
+		return err
+	}
+	patched := make(map[*Section][]byte)
+	for _, r := range relocs {
+		fd, ok := fds[r.Map]
+		if !ok {
+			return fmt.Errorf("no file descriptor for map %s", r.Map)
+		}
+		data, ok := patched[r.Section]
+		if !ok {
+			if data, err = r.Section.Data(); err != nil {
+				return err
+			}
+			patched[r.Section] = data
+		}
+		if r.Offset+2*bpfInsnSize > uint64(len(data)) || data[r.Offset] != bpfLdImm64 {
+			return fmt.Errorf("relocation of map %s at %s+%#x is not on a ld_imm64 instruction", r.Map, r.Section.Name, r.Offset)
+		}
+		insn := data[r.Offset:]
+		// The register byte holds dst_reg and src_reg, in the order of
+		// the byte order's bit fields.
+		if f.ByteOrder == binary.BigEndian {
+			insn[1] = insn[1]&0xf0 | bpfPseudoMapFD
+		} else {
+			insn[1] = insn[1]&0x0f | bpfPseudoMapFD<<4
+		}
+		f.ByteOrder.PutUint32(insn[4:], uint32(int32(fd)))
+		f.ByteOrder.PutUint32(insn[bpfInsnSize+4:], 0)
+	}
+	for s, data := range patched {
+		s.Replace(bytes.NewReader(data), int64(len(data)))
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// testBTF returns the BTF of a .maps section that defines
+//
+//	struct {
+//		__uint(type, BPF_MAP_TYPE_HASH);
+//		__uint(max_entries, 128);
+//		__type(key, int);
+//		__type(value, unsigned long long);
+//	} counts SEC(".maps");
+func testBTF() []byte {
+	le := binary.LittleEndian
+	strs := []byte("\x00int\x00long long unsigned\x00type\x00max_entries\x00key\x00value\x00counts\x00.maps\x00")
+	str := func(s string) uint32 { return uint32(bytes.Index(strs, []byte("\x00"+s+"\x00")) + 1) }
+	var types bytes.Buffer
+	typ := func(name uint32, kind, vlen int, sizeType uint32, extra ...uint32) {
+		binary.Write(&types, le, []uint32{name, uint32(kind<<24 | vlen), sizeType})
+		binary.Write(&types, le, extra)
+	}
+	typ(str("int"), btfKindInt, 0, 4, 32)                // 1
+	typ(0, btfKindArray, 0, 0, 1, 1, 1)                  // 2: [BPF_MAP_TYPE_HASH]int
+	typ(0, btfKindPtr, 0, 2)                             // 3
+	typ(0, btfKindArray, 0, 0, 1, 1, 128)                // 4: [128]int
+	typ(0, btfKindPtr, 0, 4)                             // 5
+	typ(str("long long unsigned"), btfKindInt, 0, 8, 64) // 6
+	typ(0, btfKindPtr, 0, 1)                             // 7
+	typ(0, btfKindPtr, 0, 6)                             // 8
+	typ(0, btfKindStruct, 4, 32,                         // 9
+		str("type"), 3, 0, str("max_entries"), 5, 64, str("key"), 7, 128, str("value"), 8, 192)
+	typ(str("counts"), btfKindVar, 0, 9, 1)             // 10
+	typ(str(".maps"), btfKindDatasec, 1, 32, 10, 0, 32) // 11
+
+	hdr := make([]byte, 24)
+	le.PutUint16(hdr, btfMagic)
+	hdr[2] = 1
+	le.PutUint32(hdr[4:], 24)
+	le.PutUint32(hdr[12:], uint32(types.Len()))
+	le.PutUint32(hdr[16:], uint32(types.Len()))
+	le.PutUint32(hdr[20:], uint32(len(strs)))
+	return append(append(hdr, types.Bytes()...), strs...)
+}
+
+// buildBPFObject returns an eBPF object with a kprobe program that loads a
+// legacy map and a BTF map, and an XDP program.
+func buildBPFObject() []byte {
+	le := binary.LittleEndian
+	ldImm64 := func(dst byte) []byte {
+		return []byte{bpfLdImm64, dst, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	}
+	exit := []byte{0x95, 0, 0, 0, 0, 0, 0, 0}
+	kprobe := append(append(ldImm64(1), ldImm64(2)...), exit...)
+	var rel bytes.Buffer
+	binary.Write(&rel, le, []Rel64{
+		{Off: 0, Info: R_INFO(1, uint32(R_BPF_64_64))},
+		{Off: 16, Info: R_INFO(2, uint32(R_BPF_64_64))},
+	})
+	legacyMaps := make([]byte, bpfMapDefSize)
+	binary.Write(bytes.NewBuffer(legacyMaps[:0]), le, []uint32{4, 4, 4, 64, 0})
+
+	strtab := []byte("\x00events\x00counts\x00kprobe_execve\x00")
+	var symtab bytes.Buffer
+	binary.Write(&symtab, le, []Sym64{
+		{},
+		{Name: 1, Info: ST_INFO(STB_GLOBAL, STT_OBJECT), Shndx: 4, Size: bpfMapDefSize},
+		{Name: 8, Info: ST_INFO(STB_GLOBAL, STT_OBJECT), Shndx: 5, Size: 32},
+		{Name: 15, Info: ST_INFO(STB_GLOBAL, STT_FUNC), Shndx: 1, Size: uint64(len(kprobe))},
+	})
+
+	sections := []struct {
+		name       string
+		typ        SectionType
+		flags      SectionFlag
+		link, info uint32
+		entsize    uint64
+		data       []byte
+	}{
+		{"kprobe/sys_execve", SHT_PROGBITS, SHF_ALLOC | SHF_EXECINSTR, 0, 0, 0, kprobe},
+		{".relkprobe/sys_execve", SHT_REL, 0, 7, 1, 16, rel.Bytes()},
+		{"xdp", SHT_PROGBITS, SHF_ALLOC | SHF_EXECINSTR, 0, 0, 0, exit},
+		{"maps", SHT_PROGBITS, SHF_ALLOC | SHF_WRITE, 0, 0, 0, legacyMaps},
+		{".maps", SHT_PROGBITS, SHF_ALLOC | SHF_WRITE, 0, 0, 0, make([]byte, 32)},
+		{".BTF", SHT_PROGBITS, 0, 0, 0, 0, testBTF()},
+		{".symtab", SHT_SYMTAB, 0, 8, 3, Sym64Size, symtab.Bytes()},
+		{".strtab", SHT_STRTAB, 0, 0, 0, 0, strtab},
+		{".shstrtab", SHT_STRTAB, 0, 0, 0, 0, nil},
+	}
+	shstrtab := []byte{0}
+	for _, s := range sections {
+		shstrtab = append(append(shstrtab, s.name...), 0)
+	}
+	sections[len(sections)-1].data = shstrtab
+
+	out := make([]byte, 64)
+	shdrs := []Section64{{}}
+	nameOff := uint32(1)
+	for _, s := range sections {
+		for len(out)%8 != 0 {
+			out = append(out, 0)
+		}
+		shdrs = append(shdrs, Section64{
+			Name: nameOff, Type: uint32(s.typ), Flags: uint64(s.flags), Off: uint64(len(out)),
+			Size: uint64(len(s.data)), Link: s.link, Info: s.info, Addralign: 8, Entsize: s.entsize,
+		})
+		nameOff += uint32(len(s.name)) + 1
+		out = append(out, s.data...)
+	}
+	for len(out)%8 != 0 {
+		out = append(out, 0)
+	}
+	shoff := len(out)
+	var b bytes.Buffer
+	binary.Write(&b, le, shdrs)
+	out = append(out, b.Bytes()...)
+
+	hdr := Header64{
+		Type: uint16(ET_REL), Machine: uint16(EM_BPF), Version: uint32(EV_CURRENT),
+		Shoff: uint64(shoff), Ehsize: 64, Shentsize: 64, Shnum: uint16(len(shdrs)), Shstrndx: uint16(len(shdrs) - 1),
+	}
+	copy(hdr.Ident[:], ELFMAG)
+	hdr.Ident[EI_CLASS] = byte(ELFCLASS64)
+	hdr.Ident[EI_DATA] = byte(ELFDATA2LSB)
+	hdr.Ident[EI_VERSION] = byte(EV_CURRENT)
+	b.Reset()
+	binary.Write(&b, le, hdr)
+	copy(out, b.Bytes())
+	return out
+}
+
+func TestBPF(t *testing.T) {
+	f, err := NewFile(bytes.NewReader(buildBPFObject()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progs, err := f.BPFPrograms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progs) != 2 {
+		t.Fatalf("got %d programs, want 2", len(progs))
+	}
+	for i, want := range []BPFProgram{
+		{f.Section("kprobe/sys_execve"), BPF_PROG_TYPE_KPROBE, 0, "sys_execve"},
+		{f.Section("xdp"), BPF_PROG_TYPE_XDP, BPF_XDP, ""},
+	} {
+		if progs[i] != want {
+			t.Errorf("program %d is %+v, want %+v", i, progs[i], want)
+		}
+	}
+
+	maps, err := f.BPFMaps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMaps := []BPFMap{
+		{Name: "events", Section: f.Section("maps"), Type: 4, KeySize: 4, ValueSize: 4, MaxEntries: 64},
+		{Name: "counts", Section: f.Section(".maps"), Type: 1, KeySize: 4, ValueSize: 8, MaxEntries: 128},
+	}
+	if !reflect.DeepEqual(maps, wantMaps) {
+		t.Errorf("got maps %+v, want %+v", maps, wantMaps)
+	}
+
+	relocs, err := f.BPFMapRelocations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kprobe := f.Section("kprobe/sys_execve")
+	wantRelocs := []BPFMapRelocation{{kprobe, 0, "events"}, {kprobe, 16, "counts"}}
+	if !reflect.DeepEqual(relocs, wantRelocs) {
+		t.Errorf("got relocations %+v, want %+v", relocs, wantRelocs)
+	}
+
+	if err := f.PatchBPFMapFDs(map[string]int{"events": 5}); err == nil {
+		t.Error("PatchBPFMapFDs accepted a map without a file descriptor")
+	}
+	if err := f.PatchBPFMapFDs(map[string]int{"events": 5, "counts": 7}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := g.Section("kprobe/sys_execve").Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		bpfLdImm64, 0x11, 0, 0, 5, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		bpfLdImm64, 0x12, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0x95, 0, 0, 0, 0, 0, 0, 0,
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("patched program is\n%x\nwant\n%x", got, want)
+	}
+
+	exe, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exe.Close()
+	if _, err := exe.BPFPrograms(); err == nil {
+		t.Error("BPFPrograms accepted an x86-64 executable")
+	}
+}
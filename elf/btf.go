@@ -0,0 +1,251 @@
+package elf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// BTF type kinds (BTF_KIND_*).
+const (
+	btfKindInt       = 1
+	btfKindPtr       = 2
+	btfKindArray     = 3
+	btfKindStruct    = 4
+	btfKindUnion     = 5
+	btfKindEnum      = 6
+	btfKindFwd       = 7
+	btfKindTypedef   = 8
+	btfKindVolatile  = 9
+	btfKindConst     = 10
+	btfKindRestrict  = 11
+	btfKindFunc      = 12
+	btfKindFuncProto = 13
+	btfKindVar       = 14
+	btfKindDatasec   = 15
+	btfKindFloat     = 16
+	btfKindDeclTag   = 17
+	btfKindTypeTag   = 18
+	btfKindEnum64    = 19
+)
+
+const btfMagic = 0xeb9f
+
+// A btfType is a type of the BTF in a .BTF section.
+type btfType struct {
+	name     uint32
+	kind     int
+	vlen     int
+	sizeType uint32 // size of the type, or the type it refers to
+	extra    []byte // the kind specific data that follows the type
+}
+
+// btfData is the decoded BTF of an object. types[0] is void.
+type btfData struct {
+	bo    binary.ByteOrder
+	types []btfType
+	strs  []byte
+}
+
+// parseBTF decodes the type and string sections of the BTF in data.
+func parseBTF(data []byte) (*btfData, error) {
+	if len(data) < 24 {
+		return nil, errors.New("BTF header is truncated")
+	}
+	b := &btfData{types: []btfType{{}}}
+	switch {
+	case binary.LittleEndian.Uint16(data) == btfMagic:
+		b.bo = binary.LittleEndian
+	case binary.BigEndian.Uint16(data) == btfMagic:
+		b.bo = binary.BigEndian
+	default:
+		return nil, errors.New("invalid BTF magic number")
+	}
+	bo := b.bo
+	hdrLen := uint64(bo.Uint32(data[4:]))
+	typeOff, typeLen := hdrLen+uint64(bo.Uint32(data[8:])), uint64(bo.Uint32(data[12:]))
+	strOff, strLen := hdrLen+uint64(bo.Uint32(data[16:])), uint64(bo.Uint32(data[20:]))
+	if typeOff+typeLen > uint64(len(data)) || strOff+strLen > uint64(len(data)) {
+		return nil, errors.New("BTF types or strings are out of range")
+	}
+	b.strs = data[strOff : strOff+strLen]
+
+	for types := data[typeOff : typeOff+typeLen]; len(types) > 0; {
+		if len(types) < 12 {
+			return nil, errors.New("BTF type is truncated")
+		}
+		info := bo.Uint32(types[4:])
+		t := btfType{
+			name:     bo.Uint32(types),
+			kind:     int(info >> 24 & 0x1f),
+			vlen:     int(info & 0xffff),
+			sizeType: bo.Uint32(types[8:]),
+		}
+		var n int
+		switch t.kind {
+		case btfKindInt, btfKindVar, btfKindDeclTag:
+			n = 4
+		case btfKindArray:
+			n = 12
+		case btfKindStruct, btfKindUnion, btfKindDatasec, btfKindEnum64:
+			n = 12 * t.vlen
+		case btfKindEnum, btfKindFuncProto:
+			n = 8 * t.vlen
+		case btfKindPtr, btfKindFwd, btfKindTypedef, btfKindVolatile, btfKindConst,
+			btfKindRestrict, btfKindFunc, btfKindFloat, btfKindTypeTag:
+		default:
+			return nil, fmt.Errorf("unknown BTF kind %d", t.kind)
+		}
+		if len(types) < 12+n {
+			return nil, errors.New("BTF type is truncated")
+		}
+		t.extra = types[12 : 12+n]
+		b.types = append(b.types, t)
+		types = types[12+n:]
+	}
+	return b, nil
+}
+
+func (b *btfData) name(off uint32) string {
+	s, _ := getString(b.strs, int(off))
+	return s
+}
+
+// resolve returns the type id refers to once typedefs and qualifiers are
+// skipped.
+func (b *btfData) resolve(id uint32) (*btfType, error) {
+	for depth := 0; depth < 32; depth++ {
+		if uint64(id) >= uint64(len(b.types)) {
+			return nil, fmt.Errorf("BTF type %d is out of range", id)
+		}
+		t := &b.types[id]
+		switch t.kind {
+		case btfKindTypedef, btfKindVolatile, btfKindConst, btfKindRestrict, btfKindTypeTag:
+			id = t.sizeType
+		default:
+			return t, nil
+		}
+	}
+	return nil, errors.New("BTF types are nested too deeply")
+}
+
+// size returns the size in bytes of the type id.
+func (b *btfData) size(id uint32, depth int) (uint32, error) {
+	if depth > 32 {
+		return 0, errors.New("BTF types are nested too deeply")
+	}
+	t, err := b.resolve(id)
+	if err != nil {
+		return 0, err
+	}
+	switch t.kind {
+	case btfKindInt, btfKindStruct, btfKindUnion, btfKindEnum, btfKindEnum64, btfKindDatasec, btfKindFloat:
+		return t.sizeType, nil
+	case btfKindPtr:
+		return 8, nil
+	case btfKindArray:
+		elem, err := b.size(b.bo.Uint32(t.extra), depth+1)
+		if err != nil {
+			return 0, err
+		}
+		return elem * b.bo.Uint32(t.extra[8:]), nil
+	}
+	return 0, fmt.Errorf("BTF type %d of kind %d has no size", id, t.kind)
+}
+
+// mapUint decodes a field of a BTF map definition declared with
+// __uint(name, val), which is a pointer to an array of val elements.
+func (b *btfData) mapUint(id uint32) (uint32, error) {
+	p, err := b.resolve(id)
+	if err != nil {
+		return 0, err
+	}
+	if p.kind != btfKindPtr {
+		return 0, errors.New("map definition field is not a pointer")
+	}
+	a, err := b.resolve(p.sizeType)
+	if err != nil {
+		return 0, err
+	}
+	if a.kind != btfKindArray {
+		return 0, errors.New("map definition field does not point to an array")
+	}
+	return b.bo.Uint32(a.extra[8:]), nil
+}
+
+// pointeeSize decodes a field of a BTF map definition declared with
+// __type(name, T), which is a pointer to T, into the size of T.
+func (b *btfData) pointeeSize(id uint32) (uint32, error) {
+	p, err := b.resolve(id)
+	if err != nil {
+		return 0, err
+	}
+	if p.kind != btfKindPtr {
+		return 0, errors.New("map definition field is not a pointer")
+	}
+	return b.size(p.sizeType, 0)
+}
+
+// btfMaps returns the maps defined in s, the .maps section, as described by
+// the variables of the .maps data section of the object's BTF.
+func (f *File) btfMaps(s *Section) ([]BPFMap, error) {
+	bs := f.Section(".BTF")
+	if bs == nil {
+		return nil, errors.New(".maps is not described by a .BTF section")
+	}
+	data, err := bs.Data()
+	if err != nil {
+		return nil, err
+	}
+	b, err := parseBTF(data)
+	if err != nil {
+		return nil, err
+	}
+	var maps []BPFMap
+	for _, t := range b.types {
+		if t.kind != btfKindDatasec || b.name(t.name) != s.Name {
+			continue
+		}
+		for i := 0; i < t.vlen; i++ {
+			e := t.extra[12*i:]
+			id := b.bo.Uint32(e)
+			if uint64(id) >= uint64(len(b.types)) || b.types[id].kind != btfKindVar {
+				return nil, fmt.Errorf("BTF type %d in %s is not a variable", id, s.Name)
+			}
+			v := b.types[id]
+			m := BPFMap{Name: b.name(v.name), Section: s, Offset: uint64(b.bo.Uint32(e[4:]))}
+			def, err := b.resolve(v.sizeType)
+			if err != nil {
+				return nil, err
+			}
+			if def.kind != btfKindStruct {
+				return nil, fmt.Errorf("definition of map %s is not a struct", m.Name)
+			}
+			for j := 0; j < def.vlen; j++ {
+				mem := def.extra[12*j:]
+				typ := b.bo.Uint32(mem[4:])
+				switch b.name(b.bo.Uint32(mem)) {
+				case "type":
+					m.Type, err = b.mapUint(typ)
+				case "key_size":
+					m.KeySize, err = b.mapUint(typ)
+				case "value_size":
+					m.ValueSize, err = b.mapUint(typ)
+				case "max_entries":
+					m.MaxEntries, err = b.mapUint(typ)
+				case "map_flags":
+					m.Flags, err = b.mapUint(typ)
+				case "key":
+					m.KeySize, err = b.pointeeSize(typ)
+				case "value":
+					m.ValueSize, err = b.pointeeSize(typ)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("map %s: %v", m.Name, err)
+				}
+			}
+			maps = append(maps, m)
+		}
+	}
+	return maps, nil
+}
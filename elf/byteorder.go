@@ -0,0 +1,201 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ConvertByteOrder re-encodes the file in the target byte order, which must
+// be binary.LittleEndian or binary.BigEndian. The file header, the program
+// and section header tables and the dynamic section are written in the new
+// order by Bytes; the contents of symbol, relocation, hash, version, note,
+// group and init/fini array sections, and the headers of compressed
+// sections, are converted here.
+//
+// The contents of other sections, such as code, data and DWARF, are left as
+// they are: their layout is not known to the File. With PreserveRaw set,
+// the bytes that no section or table claims are not converted either.
+func (f *File) ConvertByteOrder(target binary.ByteOrder) error {
+	var data Data
+	switch target {
+	case binary.LittleEndian:
+		data = ELFDATA2LSB
+	case binary.BigEndian:
+		data = ELFDATA2MSB
+	default:
+		return errors.New("byte order must be binary.LittleEndian or binary.BigEndian")
+	}
+	if data == f.Data {
+		return nil
+	}
+	for _, s := range f.Sections {
+		if err := f.convertSection(s); err != nil {
+			return err
+		}
+	}
+	f.Data = data
+	f.ByteOrder = target
+	f.gnuNeed, f.gnuVersym = nil, nil
+	return nil
+}
+
+// convertSection swaps the byte order of the contents of s, reading any
+// offsets it has to follow in the current byte order of the file.
+func (f *File) convertSection(s *Section) error {
+	if s.Type == SHT_NULL || s.Type == SHT_NOBITS || s.FileSize == 0 {
+		return nil
+	}
+	ptrsize := 4
+	if f.Class == ELFCLASS64 {
+		ptrsize = 8
+	}
+
+	if s.Flags&SHF_COMPRESSED != 0 {
+		// Only the compression header is in the byte order of the file.
+		raw := make([]byte, s.FileSize)
+		if _, err := s.sr.ReadAt(raw, 0); err != nil && err != io.EOF {
+			return err
+		}
+		if int64(len(raw)) < s.compressionOffset {
+			return &FormatError{int64(s.Offset), "compression header is truncated", s.Name}
+		}
+		if f.Class == ELFCLASS32 {
+			swapFields(raw[:s.compressionOffset], 4, 4, 4)
+		} else {
+			swapFields(raw[:s.compressionOffset], 4, 4, 8, 8)
+		}
+		s.sr = io.NewSectionReader(bytes.NewReader(raw), 0, int64(len(raw)))
+		return nil
+	}
+
+	var fields []int
+	switch s.Type {
+	case SHT_SYMTAB, SHT_DYNSYM:
+		if f.Class == ELFCLASS32 {
+			fields = []int{4, 4, 4, 1, 1, 2}
+		} else {
+			fields = []int{4, 1, 1, 2, 8, 8}
+		}
+	case SHT_REL, SHT_RELA:
+		switch {
+		case f.Class == ELFCLASS32:
+			fields = []int{4, 4}
+		case f.Machine == EM_MIPS:
+			// r_info of MIPS64 is a uint32 symbol index followed by
+			// four one-byte fields.
+			fields = []int{8, 4, 1, 1, 1, 1}
+		default:
+			fields = []int{8, 8}
+		}
+		if s.Type == SHT_RELA {
+			fields = append(fields, ptrsize)
+		}
+	case SHT_DYNAMIC:
+		fields = []int{ptrsize, ptrsize}
+	case SHT_HASH:
+		fields = []int{4}
+		if f.Class == ELFCLASS64 && (f.Machine == EM_S390 || f.Machine == EM_ALPHA) {
+			fields = []int{8}
+		}
+	case SHT_GNU_VERSYM:
+		fields = []int{2}
+	case SHT_INIT_ARRAY, SHT_FINI_ARRAY, SHT_PREINIT_ARRAY:
+		fields = []int{ptrsize}
+	case SHT_GROUP, SHT_SYMTAB_SHNDX:
+		fields = []int{4}
+	case SHT_GNU_HASH, SHT_GNU_VERNEED, SHT_GNU_VERDEF, SHT_NOTE:
+	default:
+		return nil
+	}
+
+	d, err := s.Data()
+	if err != nil {
+		return err
+	}
+	bo := f.ByteOrder
+	switch s.Type {
+	case SHT_GNU_HASH:
+		// nbuckets, symoffset, bloom size and bloom shift are followed by
+		// the bloom filter words and then the uint32 buckets and chains.
+		if len(d) < 16 {
+			return &FormatError{int64(s.Offset), "GNU hash table is truncated", s.Name}
+		}
+		bloom := 16 + uint64(bo.Uint32(d[8:]))*uint64(ptrsize)
+		if bloom > uint64(len(d)) {
+			return &FormatError{int64(s.Offset), "GNU hash bloom filter is out of range", s.Name}
+		}
+		swapFields(d[:16], 4)
+		swapFields(d[16:bloom], ptrsize)
+		swapFields(d[bloom:], 4)
+	case SHT_GNU_VERNEED:
+		for i := 0; i+16 <= len(d); {
+			cnt := int(bo.Uint16(d[i+2:]))
+			aux := int(bo.Uint32(d[i+8:]))
+			next := int(bo.Uint32(d[i+12:]))
+			swapFields(d[i:i+16], 2, 2, 4, 4, 4)
+			for j, c := i+aux, 0; aux != 0 && c < cnt && j+16 <= len(d); c++ {
+				anext := int(bo.Uint32(d[j+12:]))
+				swapFields(d[j:j+16], 4, 2, 2, 4, 4)
+				if anext == 0 {
+					break
+				}
+				j += anext
+			}
+			if next == 0 {
+				break
+			}
+			i += next
+		}
+	case SHT_GNU_VERDEF:
+		for i := 0; i+20 <= len(d); {
+			cnt := int(bo.Uint16(d[i+6:]))
+			aux := int(bo.Uint32(d[i+12:]))
+			next := int(bo.Uint32(d[i+16:]))
+			swapFields(d[i:i+20], 2, 2, 2, 2, 4, 4, 4)
+			for j, c := i+aux, 0; aux != 0 && c < cnt && j+8 <= len(d); c++ {
+				anext := int(bo.Uint32(d[j+4:]))
+				swapFields(d[j:j+8], 4, 4)
+				if anext == 0 {
+					break
+				}
+				j += anext
+			}
+			if next == 0 {
+				break
+			}
+			i += next
+		}
+	case SHT_NOTE:
+		// Only the namesz, descsz and type words of each note are
+		// converted; the name and descriptor are left as they are.
+		forEachNote(d, bo, s.Addralign, func(n *note) bool {
+			swapFields(d[n.off:n.off+12], 4)
+			return true
+		})
+	default:
+		swapFields(d, fields...)
+	}
+	s.Replace(bytes.NewReader(d), int64(len(d)))
+	return nil
+}
+
+// swapFields reverses the bytes of each field of the records in b, whose
+// fields have the given sizes, converting them between little and big
+// endian. A partial record at the end of b is left as it is.
+func swapFields(b []byte, sizes ...int) {
+	n := 0
+	for _, size := range sizes {
+		n += size
+	}
+	for ; n > 0 && len(b) >= n; b = b[n:] {
+		off := 0
+		for _, size := range sizes {
+			for i, j := off, off+size-1; i < j; i, j = i+1, j-1 {
+				b[i], b[j] = b[j], b[i]
+			}
+			off += size
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// parsedTables returns what f decodes from its headers and tables.
+func parsedTables(t *testing.T, f *File) []interface{} {
+	syms, err := f.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dynsyms, err := f.DynamicSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imports, err := f.ImportedSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	libs, err := f.ImportedLibraries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sects []SectionHeader
+	for _, s := range f.Sections {
+		sects = append(sects, s.SectionHeader)
+	}
+	var progs []ProgHeader
+	for _, p := range f.Progs {
+		progs = append(progs, p.ProgHeader)
+	}
+	return []interface{}{f.Entry, f.Type, f.Machine, syms, dynsyms, imports, libs, sects, progs, f.DynTags}
+}
+
+func TestConvertByteOrder(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, preserve := range []bool{false, true} {
+		f, err := NewFile(bytes.NewReader(orig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.PreserveRaw = preserve
+		want := parsedTables(t, f)
+		before, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := f.ConvertByteOrder(binary.BigEndian); err != nil {
+			t.Fatal(err)
+		}
+		b, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.Data != ELFDATA2MSB || g.ByteOrder != binary.BigEndian {
+			t.Fatalf("PreserveRaw=%v: converted file is %v", preserve, g.Data)
+		}
+		if got := parsedTables(t, g); !reflect.DeepEqual(got, want) {
+			t.Errorf("PreserveRaw=%v: converted file decodes differently:\n%v\nwant:\n%v", preserve, got, want)
+		}
+
+		g.PreserveRaw = preserve
+		if err := g.ConvertByteOrder(binary.LittleEndian); err != nil {
+			t.Fatal(err)
+		}
+		b, err = g.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, before) {
+			t.Errorf("PreserveRaw=%v: converting back did not restore the file", preserve)
+		}
+	}
+
+	f, err := NewFile(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.ConvertByteOrder(nil); err == nil {
+		t.Error("ConvertByteOrder accepted a nil byte order")
+	}
+}
+
+func TestConvertByteOrderCompressed(t *testing.T) {
+	for _, name := range compressedFiles {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		contents, compressed := sectionContents(t, f)
+		if err := f.ConvertByteOrder(binary.BigEndian); err != nil {
+			t.Fatal(err)
+		}
+		b, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := sectionContents(t, g)
+		for sect := range compressed {
+			if !bytes.Equal(got[sect], contents[sect]) {
+				t.Errorf("%s: contents of compressed %s changed", name, sect)
+			}
+		}
+	}
+}
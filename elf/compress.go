@@ -0,0 +1,85 @@
+package elf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CompressSection stores the section s compressed with t, which must be
+// COMPRESS_ZLIB, the only compression type the reader supports. Bytes
+// writes the compression header and compressed data, and Data still
+// returns the uncompressed contents. A section that is already
+// compressed is recompressed.
+//
+// Only sections that are not loaded into memory can be compressed. If
+// the compressed section is larger than the space it had in the file, it
+// is moved to the end of the file.
+func (f *File) CompressSection(s *Section, t CompressionType) error {
+	if t != COMPRESS_ZLIB {
+		return fmt.Errorf("unsupported compression type %v", t)
+	}
+	if s.Flags&SHF_ALLOC != 0 || s.Type == SHT_NOBITS || s.Type == SHT_NULL {
+		return fmt.Errorf("section %s cannot be compressed", s.Name)
+	}
+	data, err := s.Data()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	var fileAddralign uint64
+	switch f.Class {
+	case ELFCLASS32:
+		err = binary.Write(&buf, f.ByteOrder, &Chdr32{Type: uint32(t), Size: uint32(len(data)), Addralign: uint32(s.Addralign)})
+		fileAddralign = 4
+	case ELFCLASS64:
+		err = binary.Write(&buf, f.ByteOrder, &Chdr64{Type: uint32(t), Size: uint64(len(data)), Addralign: s.Addralign})
+		fileAddralign = 8
+	default:
+		return errors.New("not implemented")
+	}
+	if err != nil {
+		return err
+	}
+	hdrLen := buf.Len()
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	if uint64(buf.Len()) > s.FileSize {
+		off := f.contentEnd()
+		s.Offset = (off + fileAddralign - 1) &^ (fileAddralign - 1)
+	}
+	s.sr = io.NewSectionReader(bytes.NewReader(buf.Bytes()), 0, int64(buf.Len()))
+	s.ReaderAt = nil
+	s.Flags |= SHF_COMPRESSED
+	s.compressionType = t
+	s.compressionOffset = int64(hdrLen)
+	s.fileAddralign = fileAddralign
+	s.Size = uint64(len(data))
+	s.FileSize = uint64(buf.Len())
+	return nil
+}
+
+// DecompressSection stores the compressed section s uncompressed, moving
+// it to the end of the file as it grows. It does nothing if s is not
+// compressed.
+func (f *File) DecompressSection(s *Section) error {
+	if s.Flags&SHF_COMPRESSED == 0 {
+		return nil
+	}
+	data, err := s.Data()
+	if err != nil {
+		return err
+	}
+	f.replaceNonAlloc(s, data)
+	return nil
+}
@@ -0,0 +1,128 @@
+package elf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+var compressedFiles = []string{
+	"testdata/compressed-32.obj",
+	"testdata/compressed-64.obj",
+}
+
+// sectionContents returns the uncompressed contents of all sections by
+// name, and the names of the compressed ones.
+func sectionContents(t *testing.T, f *File) (map[string][]byte, map[string]bool) {
+	contents := make(map[string][]byte)
+	compressed := make(map[string]bool)
+	for _, s := range f.Sections {
+		if s.Type == SHT_NOBITS {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			t.Fatalf("%s: %v", s.Name, err)
+		}
+		contents[s.Name] = data
+		if s.Flags&SHF_COMPRESSED != 0 {
+			compressed[s.Name] = true
+		}
+	}
+	return contents, compressed
+}
+
+func checkContents(t *testing.T, name string, g *File, want map[string][]byte, wantCompressed map[string]bool) {
+	got, compressed := sectionContents(t, g)
+	for sect, data := range want {
+		if !bytes.Equal(got[sect], data) {
+			t.Errorf("%s: contents of %s changed", name, sect)
+		}
+		if compressed[sect] != wantCompressed[sect] {
+			t.Errorf("%s: %s compressed = %v, want %v", name, sect, compressed[sect], wantCompressed[sect])
+		}
+	}
+	if _, err := g.DWARF(); err != nil {
+		t.Errorf("%s: DWARF: %v", name, err)
+	}
+}
+
+func TestWriteCompressed(t *testing.T) {
+	for _, name := range compressedFiles {
+		orig, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFile(bytes.NewReader(orig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, compressed := sectionContents(t, f)
+		b, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkContents(t, name, g, contents, compressed)
+
+		// Compressed sections are written exactly as they were stored.
+		for i, s := range f.Sections {
+			if s.Flags&SHF_COMPRESSED == 0 {
+				continue
+			}
+			gs := g.Sections[i]
+			if gs.FileSize != s.FileSize || gs.Addralign != s.Addralign {
+				t.Errorf("%s: %s has file size %d and alignment %d, want %d and %d", name, s.Name, gs.FileSize, gs.Addralign, s.FileSize, s.Addralign)
+				continue
+			}
+			if !bytes.Equal(b[gs.Offset:gs.Offset+gs.FileSize], orig[s.Offset:s.Offset+s.FileSize]) {
+				t.Errorf("%s: stored contents of %s changed", name, s.Name)
+			}
+		}
+	}
+}
+
+func TestCompressSection(t *testing.T) {
+	for _, name := range compressedFiles {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, compressed := sectionContents(t, f)
+		if len(compressed) == 0 {
+			t.Fatalf("%s: no compressed sections", name)
+		}
+
+		// Swap which debug sections are compressed.
+		for _, s := range f.Sections {
+			switch {
+			case s.Flags&SHF_COMPRESSED != 0:
+				if err := f.DecompressSection(s); err != nil {
+					t.Fatal(err)
+				}
+			case s.Name == ".debug_abbrev" || s.Name == ".debug_line":
+				if err := f.CompressSection(s, COMPRESS_ZLIB); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		swapped := make(map[string]bool)
+		for sect := range contents {
+			if sect == ".debug_abbrev" || sect == ".debug_line" {
+				swapped[sect] = true
+			}
+		}
+		checkContents(t, name, reparse(t, f), contents, swapped)
+
+		if err := f.CompressSection(f.Section(".text"), COMPRESS_ZLIB); err == nil {
+			t.Errorf("%s: compressed .text, which is loaded into memory", name)
+		}
+		if err := f.CompressSection(f.Section(".comment"), COMPRESS_LOOS); err == nil {
+			t.Errorf("%s: compressed .comment with an unsupported compression type", name)
+		}
+		f.Close()
+	}
+}
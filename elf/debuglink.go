@@ -0,0 +1,257 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ntGNUBuildID is the type of the "GNU" note that holds the build ID of a
+// file, NT_GNU_BUILD_ID.
+const ntGNUBuildID = 3
+
+// DefaultDebugDir is the directory FindDebugFile searches for separate
+// debug files when given no other.
+const DefaultDebugDir = "/usr/lib/debug"
+
+// BuildID returns the descriptor of the NT_GNU_BUILD_ID note of f, which
+// identifies the build of f and of its separate debug file. It returns nil
+// if f has no such note.
+func (f *File) BuildID() ([]byte, error) {
+	notes, err := f.describeNotes(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range notes {
+		if n.Name == "GNU" && n.Type == ntGNUBuildID {
+			return n.Desc, nil
+		}
+	}
+	return nil, nil
+}
+
+// DebugLinkCRC returns the CRC-32 of the contents of r, as recorded in the
+// .gnu_debuglink section of a file for its separate debug file.
+func DebugLinkCRC(r io.Reader) (uint32, error) {
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, r); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+// DebugLink returns the name of the separate debug file and its CRC-32,
+// from the .gnu_debuglink section of f. The name is empty if f has no such
+// section.
+func (f *File) DebugLink() (string, uint32, error) {
+	s := f.Section(".gnu_debuglink")
+	if s == nil {
+		return "", 0, nil
+	}
+	data, err := s.Data()
+	if err != nil {
+		return "", 0, err
+	}
+	i := bytes.IndexByte(data, 0)
+	if i < 0 {
+		return "", 0, errors.New(".gnu_debuglink file name is not terminated")
+	}
+	off := alignUp(uint64(i)+1, 4)
+	if off+4 > uint64(len(data)) {
+		return "", 0, errors.New(".gnu_debuglink has no CRC")
+	}
+	return string(data[:i]), f.ByteOrder.Uint32(data[off:]), nil
+}
+
+// SetDebugLink makes f refer to its separate debug file, named name and
+// with the CRC-32 crc, as objcopy --add-gnu-debuglink does: the
+// .gnu_debuglink section is replaced, or added after everything else in
+// the file. The name is looked up in the directory of f and the debug
+// directories, so it is normally a base name.
+func (f *File) SetDebugLink(name string, crc uint32) error {
+	if name == "" || bytes.IndexByte([]byte(name), 0) >= 0 {
+		return fmt.Errorf("bad debug file name %q", name)
+	}
+	data := make([]byte, alignUp(uint64(len(name))+1, 4)+4)
+	copy(data, name)
+	f.ByteOrder.PutUint32(data[len(data)-4:], crc)
+	return f.setNonAlloc(".gnu_debuglink", data)
+}
+
+// DebugAltLink returns the name and build ID of the supplementary debug
+// file, holding the DWARF shared by several debug files as made by dwz,
+// from the .gnu_debugaltlink section of f. The name is empty if f has no
+// such section.
+func (f *File) DebugAltLink() (string, []byte, error) {
+	s := f.Section(".gnu_debugaltlink")
+	if s == nil {
+		return "", nil, nil
+	}
+	data, err := s.Data()
+	if err != nil {
+		return "", nil, err
+	}
+	i := bytes.IndexByte(data, 0)
+	if i < 0 {
+		return "", nil, errors.New(".gnu_debugaltlink file name is not terminated")
+	}
+	return string(data[:i]), data[i+1:], nil
+}
+
+// SetDebugAltLink makes f refer to its supplementary debug file, named
+// name and with the build ID buildID, replacing or adding the
+// .gnu_debugaltlink section as SetDebugLink does.
+func (f *File) SetDebugAltLink(name string, buildID []byte) error {
+	if name == "" || bytes.IndexByte([]byte(name), 0) >= 0 {
+		return fmt.Errorf("bad supplementary debug file name %q", name)
+	}
+	data := append(append([]byte(name), 0), buildID...)
+	return f.setNonAlloc(".gnu_debugaltlink", data)
+}
+
+// setNonAlloc replaces the contents of the section named name that is not
+// loaded into memory, or adds it as a SHT_PROGBITS section.
+func (f *File) setNonAlloc(name string, data []byte) error {
+	if s := f.Section(name); s != nil {
+		if s.Flags&SHF_ALLOC != 0 {
+			return fmt.Errorf("section %s is loaded into memory", name)
+		}
+		f.replaceNonAlloc(s, data)
+		return nil
+	}
+	_, err := f.addNonAlloc(name, SHT_PROGBITS, data, 4)
+	return err
+}
+
+// FindDebugFile returns the path of the separate debug file of f, which is
+// at path, looking for it as gdb does: first under .build-id in each of
+// the debug directories by the build ID of f, then by the name in the
+// .gnu_debuglink section of f in the directory of path, in its .debug
+// subdirectory, and in the directory of path under each debug directory.
+// A file found by its debug link name must have the CRC-32 the link
+// records. Without debug directories, DefaultDebugDir is searched.
+func (f *File) FindDebugFile(path string, debugDirs ...string) (string, error) {
+	if len(debugDirs) == 0 {
+		debugDirs = []string{DefaultDebugDir}
+	}
+	id, err := f.BuildID()
+	if err != nil {
+		return "", err
+	}
+	if len(id) >= 2 {
+		for _, d := range debugDirs {
+			p := filepath.Join(d, ".build-id", hex.EncodeToString(id[:1]), hex.EncodeToString(id[1:])+".debug")
+			if _, err := os.Stat(p); err == nil {
+				return p, nil
+			}
+		}
+	}
+
+	name, crc, err := f.DebugLink()
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		if len(id) >= 2 {
+			return "", fmt.Errorf("no debug file with build ID %x", id)
+		}
+		return "", errors.New("file has neither a build ID nor a debug link")
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	candidates := []string{filepath.Join(dir, name), filepath.Join(dir, ".debug", name)}
+	for _, d := range debugDirs {
+		candidates = append(candidates, filepath.Join(d, dir, name))
+	}
+	for _, p := range candidates {
+		if p == path {
+			continue
+		}
+		r, err := os.Open(p)
+		if err != nil {
+			continue
+		}
+		sum, err := DebugLinkCRC(r)
+		r.Close()
+		if err == nil && sum == crc {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no debug file %s with CRC %#08x", name, crc)
+}
+
+// MergeDebugFile adds to f the DWARF sections and the symbol table of d,
+// the separate debug file of f, that f does not have, so that DWARF and
+// Symbols of f read them. The symbols keep the section indices of d, which
+// are those of f when d was made with objcopy --only-keep-debug. Bytes
+// writes the added sections after everything else, putting the debugging
+// information back into f as eu-unstrip does. If both files have a build
+// ID, they must be the same.
+func (f *File) MergeDebugFile(d *File) error {
+	id, err := f.BuildID()
+	if err != nil {
+		return err
+	}
+	did, err := d.BuildID()
+	if err != nil {
+		return err
+	}
+	if id != nil && did != nil && !bytes.Equal(id, did) {
+		return fmt.Errorf("debug file has build ID %x, not %x", did, id)
+	}
+
+	for _, s := range d.Sections {
+		if dwarfSuffix(s) == "" || s.Type == SHT_NOBITS {
+			continue
+		}
+		if t := f.Section(s.Name); t != nil && t.Type != SHT_NOBITS {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.Name, err)
+		}
+		if t := f.Section(s.Name); t != nil {
+			t.Type = s.Type
+			f.replaceNonAlloc(t, data)
+			continue
+		}
+		if _, err := f.addNonAlloc(s.Name, s.Type, data, s.Addralign); err != nil {
+			return err
+		}
+	}
+
+	symtab := d.SectionByType(SHT_SYMTAB)
+	if symtab == nil || f.SectionByType(SHT_SYMTAB) != nil {
+		return nil
+	}
+	if symtab.Link == 0 || int(symtab.Link) >= len(d.Sections) {
+		return errors.New("debug file symbol table has no string table")
+	}
+	strtab := d.Sections[symtab.Link]
+	strdata, err := strtab.Data()
+	if err != nil {
+		return err
+	}
+	symdata, err := symtab.Data()
+	if err != nil {
+		return err
+	}
+	str, err := f.addNonAlloc(".strtab", SHT_STRTAB, strdata, 1)
+	if err != nil {
+		return err
+	}
+	sym, err := f.addNonAlloc(".symtab", SHT_SYMTAB, symdata, symtab.Addralign)
+	if err != nil {
+		return err
+	}
+	sym.Link, sym.Info, sym.Entsize = uint32(str.Shnum), symtab.Info, symtab.Entsize
+	return nil
+}
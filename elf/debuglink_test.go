@@ -0,0 +1,170 @@
+package elf
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestDebugLink(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if name, _, err := f.DebugLink(); name != "" || err != nil {
+		t.Errorf("DebugLink() = %q, %v for a file without a debug link", name, err)
+	}
+	if err := f.SetDebugLink("", 0); err == nil {
+		t.Error("SetDebugLink accepted an empty name")
+	}
+	if err := f.SetDebugLink("exec.debug", 0x12345678); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetDebugAltLink("/usr/lib/debug/.dwz/common.debug", []byte{0xde, 0xad, 0xbe, 0xef}); err != nil {
+		t.Fatal(err)
+	}
+	// Replacing the link keeps a single section.
+	if err := f.SetDebugLink("hello.debug", 0xcafef00d); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, crc, err := g.DebugLink(); name != "hello.debug" || crc != 0xcafef00d || err != nil {
+		t.Errorf("DebugLink() = %q, %#x, %v", name, crc, err)
+	}
+	if name, id, err := g.DebugAltLink(); name != "/usr/lib/debug/.dwz/common.debug" || !bytes.Equal(id, []byte{0xde, 0xad, 0xbe, 0xef}) || err != nil {
+		t.Errorf("DebugAltLink() = %q, %x, %v", name, id, err)
+	}
+	n := 0
+	for _, s := range g.Sections {
+		if s.Name == ".gnu_debuglink" {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("%d .gnu_debuglink sections", n)
+	}
+	// The original sections are still readable.
+	if syms, err := g.Symbols(); err != nil || len(syms) == 0 {
+		t.Errorf("Symbols() = %d symbols, %v", len(syms), err)
+	}
+
+	if crc, err := DebugLinkCRC(bytes.NewReader([]byte("123456789"))); crc != 0xcbf43926 || err != nil {
+		t.Errorf("DebugLinkCRC = %#x, %v", crc, err)
+	}
+}
+
+func TestSplitDebug(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("requires linux")
+	}
+	for _, tool := range []string{"gcc", "objcopy"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not found", tool)
+		}
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "hello.c")
+	if err := ioutil.WriteFile(src, []byte("int answer = 42;\nint main(void) { return answer; }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(dir, "hello")
+	debug := filepath.Join(dir, ".debug", "hello.debug")
+	for _, args := range [][]string{
+		{"gcc", "-gdwarf-4", "-Wl,--build-id=none", "-o", exe, src},
+		{"mkdir", filepath.Join(dir, ".debug")},
+		{"objcopy", "--only-keep-debug", exe, debug},
+		{"objcopy", "--strip-all", exe},
+	} {
+		if out, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			t.Skipf("%v: %v\n%s", args, err, out)
+		}
+	}
+
+	f, err := Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.FindDebugFile(exe, dir); err == nil {
+		t.Error("FindDebugFile found a debug file without a build ID or debug link")
+	}
+	dat, err := ioutil.ReadFile(debug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crc, _ := DebugLinkCRC(bytes.NewReader(dat))
+	if err := f.SetDebugLink("hello.debug", crc+1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.FindDebugFile(exe, dir); err == nil {
+		t.Error("FindDebugFile accepted a debug file with the wrong CRC")
+	}
+	if err := f.SetDebugLink("hello.debug", crc); err != nil {
+		t.Fatal(err)
+	}
+	path, err := f.FindDebugFile(exe, dir)
+	if err != nil || path != debug {
+		t.Fatalf("FindDebugFile() = %q, %v; want %q", path, err, debug)
+	}
+
+	d, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := f.MergeDebugFile(d); err != nil {
+		t.Fatal(err)
+	}
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	syms, err := g.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var main *Symbol
+	for i := range syms {
+		if syms[i].Name == "main" {
+			main = &syms[i]
+		}
+	}
+	if main == nil || g.Sections[main.Section].Name != ".text" {
+		t.Errorf("main is %+v in the merged file", main)
+	}
+	dw, err := g.DWARF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cu, err := dw.Reader().Next()
+	if err != nil || cu == nil {
+		t.Fatalf("first DWARF entry: %v, %v", cu, err)
+	}
+	if name, _ := cu.Val(dwarf.AttrName).(string); filepath.Base(name) != "hello.c" {
+		t.Errorf("compilation unit is %q, want hello.c", name)
+	}
+	out := filepath.Join(dir, "merged")
+	if err := ioutil.WriteFile(out, b, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := exec.Command(out).Run(); err == nil || err.(*exec.ExitError).ExitCode() != 42 {
+		t.Errorf("merged program: %v", err)
+	}
+}
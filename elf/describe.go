@@ -0,0 +1,269 @@
+package elf
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// A Description is a summary of the metadata of an ELF file, laid out for
+// encoding as JSON. Enumerated values are given by their names, as printed
+// by readelf-like tools, and addresses, offsets and sizes as numbers.
+type Description struct {
+	Header      HeaderDescription    `json:"header"`
+	Segments    []SegmentDescription `json:"segments"`
+	Sections    []SectionDescription `json:"sections"`
+	Symbols     []SymbolDescription  `json:"symbols"`
+	DynSymbols  []SymbolDescription  `json:"dynamic_symbols"`
+	DynTags     []DynTagDescription  `json:"dynamic"`
+	Notes       []NoteDescription    `json:"notes"`
+	Interpreter string               `json:"interpreter,omitempty"`
+}
+
+// A HeaderDescription describes the ELF file header.
+type HeaderDescription struct {
+	Class      string `json:"class"`
+	Data       string `json:"data"`
+	Version    string `json:"version"`
+	OSABI      string `json:"osabi"`
+	ABIVersion uint8  `json:"abi_version"`
+	Type       string `json:"type"`
+	Machine    string `json:"machine"`
+	Entry      uint64 `json:"entry"`
+	SHTOffset  int64  `json:"sht_offset"`
+	ShStrIndex int    `json:"shstrndx"`
+}
+
+// A SegmentDescription describes a program header.
+type SegmentDescription struct {
+	Type   string `json:"type"`
+	Flags  string `json:"flags"`
+	Off    uint64 `json:"offset"`
+	Vaddr  uint64 `json:"vaddr"`
+	Paddr  uint64 `json:"paddr"`
+	Filesz uint64 `json:"filesz"`
+	Memsz  uint64 `json:"memsz"`
+	Align  uint64 `json:"align"`
+}
+
+// A SectionDescription describes a section header.
+type SectionDescription struct {
+	Index     int    `json:"index"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Flags     string `json:"flags"`
+	Addr      uint64 `json:"addr"`
+	Offset    uint64 `json:"offset"`
+	Size      uint64 `json:"size"`
+	Link      uint32 `json:"link"`
+	Info      uint32 `json:"info"`
+	Addralign uint64 `json:"addralign"`
+	Entsize   uint64 `json:"entsize"`
+}
+
+// A SymbolDescription describes an entry of a symbol table. Section is
+// the section index as a number, or the name of a special index such as
+// SHN_UNDEF or SHN_ABS.
+type SymbolDescription struct {
+	Name    string `json:"name"`
+	Bind    string `json:"bind"`
+	Type    string `json:"type"`
+	Vis     string `json:"visibility"`
+	Section string `json:"section"`
+	Value   uint64 `json:"value"`
+	Size    uint64 `json:"size"`
+}
+
+// A DynTagDescription describes an entry of the dynamic section. String
+// is set for the tags whose value is an offset in the dynamic string
+// table.
+type DynTagDescription struct {
+	Tag    string `json:"tag"`
+	Value  uint64 `json:"value"`
+	String string `json:"string,omitempty"`
+}
+
+// A NoteDescription describes an entry of a note section or segment.
+type NoteDescription struct {
+	Section string `json:"section"`
+	Name    string `json:"name"`
+	Type    uint32 `json:"type"`
+	Desc    []byte `json:"desc"`
+}
+
+// Describe returns a Description of f. Notes are read from the SHT_NOTE
+// sections, or from the PT_NOTE segments of a file without section headers.
+func (f *File) Describe() (*Description, error) {
+	d := &Description{
+		Header: HeaderDescription{
+			Class:      f.Class.String(),
+			Data:       f.Data.String(),
+			Version:    f.Version.String(),
+			OSABI:      f.OSABI.String(),
+			ABIVersion: f.ABIVersion,
+			Type:       f.Type.String(),
+			Machine:    f.Machine.String(),
+			Entry:      f.Entry,
+			SHTOffset:  f.SHTOffset,
+			ShStrIndex: f.ShStrIndex,
+		},
+		Segments:   []SegmentDescription{},
+		Sections:   []SectionDescription{},
+		Symbols:    []SymbolDescription{},
+		DynSymbols: []SymbolDescription{},
+		DynTags:    []DynTagDescription{},
+		Notes:      []NoteDescription{},
+	}
+	for _, p := range f.Progs {
+		d.Segments = append(d.Segments, SegmentDescription{
+			Type:   p.Type.String(),
+			Flags:  p.Flags.String(),
+			Off:    p.Off,
+			Vaddr:  p.Vaddr,
+			Paddr:  p.Paddr,
+			Filesz: p.Filesz,
+			Memsz:  p.Memsz,
+			Align:  p.Align,
+		})
+	}
+	for i, s := range f.Sections {
+		d.Sections = append(d.Sections, SectionDescription{
+			Index:     i,
+			Name:      s.Name,
+			Type:      s.Type.String(),
+			Flags:     s.Flags.String(),
+			Addr:      s.Addr,
+			Offset:    s.Offset,
+			Size:      s.Size,
+			Link:      s.Link,
+			Info:      s.Info,
+			Addralign: s.Addralign,
+			Entsize:   s.Entsize,
+		})
+	}
+
+	syms, err := f.Symbols()
+	if err != nil && err != ErrNoSymbols {
+		return nil, err
+	}
+	d.Symbols = describeSymbols(d.Symbols, syms)
+	syms, err = f.DynamicSymbols()
+	if err != nil && err != ErrNoSymbols {
+		return nil, err
+	}
+	d.DynSymbols = describeSymbols(d.DynSymbols, syms)
+
+	var dynstr []byte
+	if ds := f.SectionByType(SHT_DYNAMIC); ds != nil {
+		if dynstr, err = f.stringTable(ds.Link); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range f.DynTags {
+		dt := DynTagDescription{Tag: t.Tag.String(), Value: t.Value}
+		switch t.Tag {
+		case DT_NEEDED, DT_SONAME, DT_RPATH, DT_RUNPATH:
+			dt.String, _ = getString(dynstr, int(t.Value))
+		}
+		d.DynTags = append(d.DynTags, dt)
+	}
+
+	if d.Notes, err = f.describeNotes(d.Notes); err != nil {
+		return nil, err
+	}
+	for _, p := range f.Progs {
+		if p.Type != PT_INTERP {
+			continue
+		}
+		b, err := ioutil.ReadAll(p.Open())
+		if err != nil {
+			return nil, err
+		}
+		if n := len(b); n > 0 && b[n-1] == 0 {
+			b = b[:n-1]
+		}
+		d.Interpreter = string(b)
+	}
+	return d, nil
+}
+
+// MarshalJSON encodes the Description of f.
+func (f *File) MarshalJSON() ([]byte, error) {
+	d, err := f.Describe()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(d)
+}
+
+func describeSymbols(d []SymbolDescription, syms []Symbol) []SymbolDescription {
+	for _, s := range syms {
+		section := s.Section.String()
+		if s.Section > SHN_UNDEF && s.Section < SHN_LORESERVE {
+			section = fmt.Sprint(uint32(s.Section))
+		}
+		d = append(d, SymbolDescription{
+			Name:    s.Name,
+			Bind:    ST_BIND(s.Info).String(),
+			Type:    ST_TYPE(s.Info).String(),
+			Vis:     ST_VISIBILITY(s.Other).String(),
+			Section: section,
+			Value:   s.Value,
+			Size:    s.Size,
+		})
+	}
+	return d
+}
+
+// describeNotes appends the notes of f to d.
+func (f *File) describeNotes(d []NoteDescription) ([]NoteDescription, error) {
+	found := false
+	for _, s := range f.Sections {
+		if s.Type != SHT_NOTE {
+			continue
+		}
+		found = true
+		data, err := s.Data()
+		if err != nil {
+			return nil, err
+		}
+		if d, err = appendNotes(d, s.Name, data, f.ByteOrder, s.Addralign); err != nil {
+			return nil, err
+		}
+	}
+	if found {
+		return d, nil
+	}
+	for i, p := range f.Progs {
+		if p.Type != PT_NOTE {
+			continue
+		}
+		data, err := ioutil.ReadAll(p.Open())
+		if err != nil {
+			return nil, err
+		}
+		if d, err = appendNotes(d, fmt.Sprintf("PT_NOTE %d", i), data, f.ByteOrder, p.Align); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// appendNotes appends the entries of the note contents data to d, which
+// are aligned to align as forEachNote describes.
+func appendNotes(d []NoteDescription, where string, data []byte, bo binary.ByteOrder, align uint64) ([]NoteDescription, error) {
+	err := forEachNote(data, bo, align, func(n *note) bool {
+		d = append(d, NoteDescription{
+			Section: where,
+			Name:    n.nameString(),
+			Type:    n.typ,
+			Desc:    append([]byte(nil), n.desc...),
+		})
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", where, err)
+	}
+	return d, nil
+}
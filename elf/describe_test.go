@@ -0,0 +1,60 @@
+package elf
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d, err := f.Describe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Header.Machine != "EM_X86_64" || d.Header.Type != "ET_EXEC" || d.Header.Entry != f.Entry {
+		t.Errorf("header is %+v", d.Header)
+	}
+	if len(d.Segments) != len(f.Progs) || len(d.Sections) != len(f.Sections) {
+		t.Errorf("%d segments and %d sections, want %d and %d", len(d.Segments), len(d.Sections), len(f.Progs), len(f.Sections))
+	}
+	if d.Interpreter != "/lib64/ld-linux-x86-64.so.2" {
+		t.Errorf("interpreter is %q", d.Interpreter)
+	}
+	var needed []string
+	for _, dt := range d.DynTags {
+		if dt.Tag == "DT_NEEDED" {
+			needed = append(needed, dt.String)
+		}
+	}
+	if len(needed) != 1 || needed[0] != "libc.so.6" {
+		t.Errorf("needed libraries are %q", needed)
+	}
+	if len(d.Notes) != 1 || d.Notes[0].Section != ".note.ABI-tag" || d.Notes[0].Name != "GNU" || d.Notes[0].Type != 1 || len(d.Notes[0].Desc) != 16 {
+		t.Errorf("notes are %+v", d.Notes)
+	}
+	var main *SymbolDescription
+	for i := range d.Symbols {
+		if d.Symbols[i].Name == "main" {
+			main = &d.Symbols[i]
+		}
+	}
+	if main == nil || main.Bind != "STB_GLOBAL" || main.Type != "STT_FUNC" || main.Section != "13" {
+		t.Errorf("main is %+v", main)
+	}
+
+	b, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Description
+	if err := json.Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+	if len(back.Sections) != len(d.Sections) || back.Sections[1].Name != d.Sections[1].Name || len(back.DynSymbols) != len(d.DynSymbols) {
+		t.Errorf("JSON does not round trip: %s", b)
+	}
+}
@@ -0,0 +1,161 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// WriteOptions controls how BytesWithOptions and WriteFileWithOptions
+// write a File.
+type WriteOptions struct {
+	// Deterministic makes the output depend only on the logical contents
+	// of the file, as reproducible builds need, and not on the order of
+	// the edits that produced them:
+	//
+	//   - The sections that are not loaded and follow everything that is,
+	//     where edits append and move sections, are laid out in section
+	//     table order, and the section header table after them.
+	//   - The R_*_IRELATIVE relocations that end a loaded RELA section,
+	//     where AddIRelative appends them, are sorted by offset.
+	//   - The times that notes record, such as those of NT_PRSTATUS, are
+	//     zeroed.
+	//
+	// The File itself is left as it was.
+	Deterministic bool
+}
+
+// writtenSectionBytes returns the contents of s as they are written.
+func (f *File) writtenSectionBytes(s *Section, opts WriteOptions) ([]byte, error) {
+	b, err := f.sectionFileBytes(s)
+	if err != nil || !opts.Deterministic || s.Flags&SHF_COMPRESSED != 0 {
+		return b, err
+	}
+	switch {
+	case s.Type == SHT_NOTE:
+		zeroNoteTimes(b, f.Class, f.ByteOrder, s.Addralign)
+	case s.Type == SHT_RELA && s.Flags&SHF_ALLOC != 0:
+		f.sortIRelatives(b)
+	}
+	return b, nil
+}
+
+// noteTimes returns the range of the descriptor of a note that holds
+// times, or 0, 0 if the note holds none. Those of NT_PRSTATUS are the
+// four timevals of user and system time and of their totals for the
+// children, which follow the signal and process IDs of elf_prstatus.
+func noteTimes(class Class, name string, typ NType) (start, end uint64) {
+	if name != "CORE" || typ != NT_PRSTATUS {
+		return 0, 0
+	}
+	if class == ELFCLASS64 {
+		return 48, 112
+	}
+	return 40, 72
+}
+
+// zeroNoteTimes zeroes the times held by the notes in data. Notes that
+// cannot be parsed are left alone.
+func zeroNoteTimes(data []byte, class Class, bo binary.ByteOrder, align uint64) {
+	forEachNote(data, bo, align, func(n *note) bool {
+		if start, end := noteTimes(class, n.nameString(), NType(n.typ)); end > start && end <= uint64(len(n.desc)) {
+			for i := range n.desc[start:end] {
+				n.desc[start+uint64(i)] = 0
+			}
+		}
+		return true
+	})
+}
+
+// sortIRelatives sorts by offset the run of R_*_IRELATIVE relocations
+// that ends the RELA entries in data.
+func (f *File) sortIRelatives(data []byte) {
+	typ, err := f.irelativeType()
+	if err != nil || len(data)%24 != 0 {
+		return
+	}
+	bo := f.ByteOrder
+	i := len(data)
+	for i > 0 && R_TYPE64(bo.Uint64(data[i-16:])) == typ {
+		i -= 24
+	}
+	rels := make([]Rela64, (len(data)-i)/24)
+	if len(rels) < 2 {
+		return
+	}
+	binary.Read(bytes.NewReader(data[i:]), bo, rels)
+	sort.SliceStable(rels, func(a, b int) bool { return rels[a].Off < rels[b].Off })
+	var b bytes.Buffer
+	binary.Write(&b, bo, rels)
+	copy(data[i:], b.Bytes())
+}
+
+// layoutTail lays out the sections that are not loaded and follow
+// everything that stays where it is, in section table order and each at
+// its alignment, followed by the section header table if it was among
+// them. It returns a function that restores the offsets f had.
+func (f *File) layoutTail() (restore func()) {
+	var start uint64
+	for _, p := range f.Progs {
+		if end := p.Off + p.Filesz; end > start {
+			start = end
+		}
+	}
+	if f.PreserveRaw {
+		if n, err := f.rawLen(); err == nil && uint64(n) > start {
+			start = uint64(n)
+		}
+	}
+	shtSize := f.sectionHeaderSize() * uint64(len(f.Sections))
+	moveSHT := false
+
+	// What stays may end past what was thought to be the start of the
+	// tail, moving the start past it, until nothing more does.
+	var moved []*Section
+	for changed := true; changed; {
+		changed = false
+		keep := func(off, size uint64) {
+			if off+size > start {
+				start = off + size
+				changed = true
+			}
+		}
+		moved = moved[:0]
+		for _, s := range f.Sections {
+			if s.Type == SHT_NULL || s.Type == SHT_NOBITS || s.FileSize == 0 {
+				continue
+			}
+			if s.Flags&SHF_ALLOC != 0 || s.Offset < start {
+				keep(s.Offset, s.FileSize)
+				continue
+			}
+			moved = append(moved, s)
+		}
+		moveSHT = f.SHTOffset > 0 && uint64(f.SHTOffset) >= start
+		if f.SHTOffset > 0 && !moveSHT {
+			keep(uint64(f.SHTOffset), shtSize)
+		}
+	}
+
+	offsets := make([]uint64, len(moved))
+	shtOffset := f.SHTOffset
+	off := start
+	for i, s := range moved {
+		offsets[i] = s.Offset
+		align := s.Addralign
+		if s.Flags&SHF_COMPRESSED != 0 {
+			align = s.fileAddralign
+		}
+		s.Offset = alignUp(off, align)
+		off = s.Offset + s.FileSize
+	}
+	if moveSHT {
+		f.SHTOffset = int64(alignUp(off, 8))
+	}
+	return func() {
+		for i, s := range moved {
+			s.Offset = offsets[i]
+		}
+		f.SHTOffset = shtOffset
+	}
+}
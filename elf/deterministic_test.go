@@ -0,0 +1,129 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestDeterministicLayout(t *testing.T) {
+	// Grow two DWARF sections in either order, moving them to the end of
+	// the file in that order.
+	edit := func(suffixes ...string) *File {
+		f, err := Open("testdata/gcc-amd64-linux-exec")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, suffix := range suffixes {
+			_, s := f.dwarfSection(suffix)
+			data, err := s.Data()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := f.ReplaceDWARFSection(suffix, append(data, make([]byte, 0x100)...)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return f
+	}
+	f1, f2 := edit("info", "abbrev"), edit("abbrev", "info")
+	defer f1.Close()
+	defer f2.Close()
+
+	b1, err := f1.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := f2.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(b1, b2) {
+		t.Fatal("the order of the edits did not change the output; the test checks nothing")
+	}
+
+	offsets := func(f *File) []uint64 {
+		o := []uint64{uint64(f.SHTOffset)}
+		for _, s := range f.Sections {
+			o = append(o, s.Offset)
+		}
+		return o
+	}
+	before := offsets(f1)
+	d1, err := f1.BytesWithOptions(WriteOptions{Deterministic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := f2.BytesWithOptions(WriteOptions{Deterministic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d1, d2) {
+		t.Error("deterministic output depends on the order of the edits")
+	}
+	for i, off := range offsets(f1) {
+		if off != before[i] {
+			t.Fatalf("BytesWithOptions changed the layout of the File")
+		}
+	}
+
+	g, err := NewFile(bytes.NewReader(d1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range f1.Sections {
+		if s.Type == SHT_NOBITS {
+			continue
+		}
+		want, err := s.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := g.Sections[i].Data()
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("section %s changed in the deterministic output: %v", s.Name, err)
+		}
+	}
+	for i := 1; i < len(g.Sections); i++ {
+		if s, prev := g.Sections[i], g.Sections[i-1]; s.Flags&SHF_ALLOC == 0 && s.Offset < prev.Offset {
+			t.Errorf("section %s is laid out before %s", s.Name, prev.Name)
+		}
+	}
+}
+
+func TestDeterministicContents(t *testing.T) {
+	bo := binary.LittleEndian
+	f := &File{FileHeader: FileHeader{Class: ELFCLASS64, Machine: EM_X86_64, ByteOrder: bo}}
+	rels := []Rela64{
+		{Off: 0x10, Info: R_INFO(0, uint32(R_X86_64_RELATIVE)), Addend: 1},
+		{Off: 0x30, Info: R_INFO(0, uint32(R_X86_64_IRELATIVE)), Addend: 2},
+		{Off: 0x20, Info: R_INFO(0, uint32(R_X86_64_IRELATIVE)), Addend: 3},
+	}
+	var b bytes.Buffer
+	binary.Write(&b, bo, rels)
+	data := b.Bytes()
+	f.sortIRelatives(data)
+	got := make([]Rela64, len(rels))
+	binary.Read(bytes.NewReader(data), bo, got)
+	if got[0] != rels[0] || got[1] != rels[2] || got[2] != rels[1] {
+		t.Errorf("sorted relocations are %+v", got)
+	}
+
+	// An NT_PRSTATUS note, with the times after the process IDs.
+	desc := make([]byte, 336)
+	for i := range desc {
+		desc[i] = 0xff
+	}
+	note := make([]byte, 12, 20+len(desc))
+	bo.PutUint32(note[0:], 5)
+	bo.PutUint32(note[4:], uint32(len(desc)))
+	bo.PutUint32(note[8:], uint32(NT_PRSTATUS))
+	note = append(append(note, "CORE\x00\x00\x00\x00"...), desc...)
+	zeroNoteTimes(note, ELFCLASS64, bo, 4)
+	desc = note[20:]
+	for i, c := range desc {
+		if zero := i >= 48 && i < 112; zero != (c == 0) {
+			t.Fatalf("byte %d of the NT_PRSTATUS descriptor is %#x", i, c)
+		}
+	}
+}
@@ -0,0 +1,448 @@
+package elf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Binject/debug/internal/diff"
+)
+
+// A FieldChange is a header field whose value differs between the two
+// files compared by Diff. Field is the name of the field in FileHeader,
+// SectionHeader or ProgHeader.
+type FieldChange = diff.FieldChange
+
+// A ByteRange is a run of bytes of a section that differs between the
+// two files. Off is the offset of the run in the old contents. Only the
+// last range of a section can change its length.
+type ByteRange = diff.ByteRange
+
+// A SectionChange describes a section of the new file that differs from
+// the section of the old file it was matched with, or that the old file
+// does not have.
+type SectionChange struct {
+	Name   string
+	Index  int // index of the section in the new file
+	Old    int // index of the section in the old file, or -1 for an added section
+	Header []FieldChange
+	Ranges []ByteRange
+}
+
+// A ProgChange describes a program header of the new file that differs
+// from the one at the same index in the old file, which has Old set to
+// -1 if it has fewer program headers.
+type ProgChange struct {
+	Index  int
+	Old    int
+	Header []FieldChange
+}
+
+// A Changeset is the difference between two ELF files computed by Diff,
+// which ApplyPatch turns the old file into the new one with.
+type Changeset struct {
+	Header       []FieldChange
+	Progs        []ProgChange
+	NumProgs     int   // number of program headers of the new file
+	RemovedProgs []int // indices of the program headers of the old file past NumProgs
+
+	// Sections lists, in section table order, the sections of the new
+	// file that are added, modified or at another index than in the old
+	// file. NumSections is the size of the new section table.
+	Sections        []SectionChange
+	NumSections     int
+	RemovedSections []string
+
+	// AddedSymbols and RemovedSymbols summarize the changes of the
+	// static symbol table for review. ApplyPatch takes them from the
+	// ranges of the symbol and string tables instead.
+	AddedSymbols   []Symbol
+	RemovedSymbols []Symbol
+}
+
+// String returns c as one line per change, for review.
+func (c *Changeset) String() string {
+	var b strings.Builder
+	for _, h := range c.Header {
+		fmt.Fprintf(&b, "header %v\n", h)
+	}
+	for _, p := range c.Progs {
+		if p.Old < 0 {
+			fmt.Fprintf(&b, "+ prog %d\n", p.Index)
+		}
+		for _, h := range p.Header {
+			fmt.Fprintf(&b, "prog %d %v\n", p.Index, h)
+		}
+	}
+	for _, i := range c.RemovedProgs {
+		fmt.Fprintf(&b, "- prog %d\n", i)
+	}
+	for _, name := range c.RemovedSections {
+		fmt.Fprintf(&b, "- section %s\n", name)
+	}
+	for _, s := range c.Sections {
+		switch {
+		case s.Old < 0:
+			fmt.Fprintf(&b, "+ section %s at %d\n", s.Name, s.Index)
+		case s.Old != s.Index:
+			fmt.Fprintf(&b, "section %s moved from %d to %d\n", s.Name, s.Old, s.Index)
+		}
+		for _, h := range s.Header {
+			fmt.Fprintf(&b, "section %s %v\n", s.Name, h)
+		}
+		for _, r := range s.Ranges {
+			fmt.Fprintf(&b, "section %s bytes %#x: %d -> %d\n", s.Name, r.Off, len(r.Old), len(r.New))
+		}
+	}
+	for _, sym := range c.RemovedSymbols {
+		fmt.Fprintf(&b, "- symbol %s\n", sym.Name)
+	}
+	for _, sym := range c.AddedSymbols {
+		fmt.Fprintf(&b, "+ symbol %s\n", sym.Name)
+	}
+	return b.String()
+}
+
+// Diff compares the ELF files a and b. Sections are matched by name, the
+// n-th section called a name in a with the n-th one in b. The contents
+// are compared as Bytes would write them, so the dynamic section is
+// compared as encoded from DynTags.
+//
+// Compressed sections whose contents differ are refused, as are files of
+// different classes, byte orders or machines.
+func Diff(a, b *File) (*Changeset, error) {
+	if a.Class != b.Class || a.Data != b.Data || a.Machine != b.Machine {
+		return nil, errors.New("files differ in class, byte order or machine")
+	}
+	c := &Changeset{NumProgs: len(b.Progs), NumSections: len(b.Sections)}
+	c.Header = diffFields(fileHeaderFieldNames, &a.FileHeader, &b.FileHeader)
+
+	for i, p := range b.Progs {
+		pc := ProgChange{Index: i, Old: i}
+		var old interface{}
+		if i < len(a.Progs) {
+			old = &a.Progs[i].ProgHeader
+		} else {
+			pc.Old = -1
+		}
+		pc.Header = diffFields(progFieldNames, old, &p.ProgHeader)
+		if pc.Old < 0 || len(pc.Header) > 0 {
+			c.Progs = append(c.Progs, pc)
+		}
+	}
+	for i := len(b.Progs); i < len(a.Progs); i++ {
+		c.RemovedProgs = append(c.RemovedProgs, i)
+	}
+
+	match := matchSections(a, b)
+	used := make(map[int]bool)
+	for i, s := range b.Sections {
+		sc := SectionChange{Name: s.Name, Index: i, Old: match[i]}
+		var old []byte
+		var oldHdr interface{}
+		if sc.Old >= 0 {
+			used[sc.Old] = true
+			t := a.Sections[sc.Old]
+			oldHdr = &t.SectionHeader
+			var err error
+			if old, err = a.diffData(t); err != nil {
+				return nil, err
+			}
+		}
+		sc.Header = diffFields(sectionFieldNames, oldHdr, &s.SectionHeader)
+		data, err := b.diffData(s)
+		if err != nil {
+			return nil, err
+		}
+		sc.Ranges = diff.Bytes(old, data)
+		if len(sc.Ranges) > 0 && (s.Flags&SHF_COMPRESSED != 0 || sc.Old >= 0 && a.Sections[sc.Old].Flags&SHF_COMPRESSED != 0) {
+			return nil, fmt.Errorf("compressed section %s differs", s.Name)
+		}
+		if sc.Old != i || len(sc.Header) > 0 || len(sc.Ranges) > 0 {
+			c.Sections = append(c.Sections, sc)
+		}
+	}
+	for i, s := range a.Sections {
+		if !used[i] {
+			c.RemovedSections = append(c.RemovedSections, s.Name)
+		}
+	}
+
+	c.AddedSymbols, c.RemovedSymbols = diffSymbols(a, b)
+	return c, nil
+}
+
+// ApplyPatch applies c, computed by Diff from a file with the contents
+// of f, to f. The old bytes of every range must match the contents of f.
+// Nothing is modified if an error is returned.
+//
+// Program headers that c adds have no contents of their own: like the
+// other program headers, they describe bytes that Bytes writes from the
+// sections.
+func (f *File) ApplyPatch(c *Changeset) error {
+	hdr := f.FileHeader
+	if err := applyFields(fileHeaderFieldNames, &hdr, c.Header); err != nil {
+		return fmt.Errorf("header: %v", err)
+	}
+
+	// Program headers.
+	progs := make([]*Prog, c.NumProgs)
+	for i := range progs {
+		if i < len(f.Progs) {
+			p := *f.Progs[i]
+			progs[i] = &p
+		}
+	}
+	for _, pc := range c.Progs {
+		if pc.Index >= len(progs) {
+			return fmt.Errorf("program header %d of %d", pc.Index, len(progs))
+		}
+		p := progs[pc.Index]
+		if pc.Old < 0 || p == nil {
+			p = &Prog{}
+			p.sr = io.NewSectionReader(bytes.NewReader(nil), 0, 0)
+			p.ReaderAt = p.sr
+			progs[pc.Index] = p
+		}
+		if err := applyFields(progFieldNames, &p.ProgHeader, pc.Header); err != nil {
+			return fmt.Errorf("program header %d: %v", pc.Index, err)
+		}
+	}
+	for i, p := range progs {
+		if p == nil {
+			return fmt.Errorf("program header %d is neither kept nor added", i)
+		}
+	}
+
+	// Sections. Those not listed keep their index; the listed ones are
+	// copied before they are modified.
+	sections := make([]*Section, c.NumSections)
+	listed := make(map[int]bool)
+	for _, sc := range c.Sections {
+		listed[sc.Index] = true
+	}
+	for i := range sections {
+		if !listed[i] {
+			if i >= len(f.Sections) {
+				return fmt.Errorf("section %d is neither kept nor added", i)
+			}
+			sections[i] = f.Sections[i]
+		}
+	}
+	var dynamic *Section
+	for _, sc := range c.Sections {
+		if sc.Index >= len(sections) {
+			return fmt.Errorf("section %s at %d of %d", sc.Name, sc.Index, len(sections))
+		}
+		var s *Section
+		var old []byte
+		if sc.Old >= 0 {
+			if sc.Old >= len(f.Sections) {
+				return fmt.Errorf("section %s was at %d of %d", sc.Name, sc.Old, len(f.Sections))
+			}
+			t := *f.Sections[sc.Old]
+			s = &t
+			if s.Name != sc.Name {
+				return fmt.Errorf("section %d is %s, not %s", sc.Old, s.Name, sc.Name)
+			}
+			if len(sc.Ranges) > 0 {
+				if s.Flags&SHF_COMPRESSED != 0 {
+					return fmt.Errorf("section %s is compressed", s.Name)
+				}
+				var err error
+				if old, err = f.diffData(f.Sections[sc.Old]); err != nil {
+					return err
+				}
+			}
+		} else {
+			s = &Section{SectionHeader: SectionHeader{Name: sc.Name}}
+			s.Replace(bytes.NewReader(nil), 0)
+		}
+		if err := applyFields(sectionFieldNames, &s.SectionHeader, sc.Header); err != nil {
+			return fmt.Errorf("section %s: %v", sc.Name, err)
+		}
+		if len(sc.Ranges) > 0 {
+			data, err := patchBytes(old, sc.Ranges)
+			if err != nil {
+				return fmt.Errorf("section %s: %v", sc.Name, err)
+			}
+			s.Replace(bytes.NewReader(data), int64(len(data)))
+		}
+		if s.Type == SHT_DYNAMIC && len(sc.Ranges) > 0 {
+			dynamic = s
+		}
+		sections[sc.Index] = s
+	}
+
+	f.FileHeader = hdr
+	f.Progs = progs
+	f.Sections = sections
+	if dynamic != nil {
+		data, err := dynamic.Data()
+		if err != nil {
+			return err
+		}
+		f.DynTags = f.decodeDynTags(data)
+	}
+	f.symIndex = nil
+	f.recordARMLayout()
+	return nil
+}
+
+// diffData returns the contents of s as Bytes writes them, or nil for a
+// section without contents in the file.
+func (f *File) diffData(s *Section) ([]byte, error) {
+	if s.Type == SHT_NULL || s.Type == SHT_NOBITS || s.FileSize == 0 {
+		return nil, nil
+	}
+	return f.sectionFileBytes(s)
+}
+
+// matchSections returns, for each section of b, the index of the section
+// of a with the same name and the same number of sections of that name
+// before it, or -1.
+func matchSections(a, b *File) []int {
+	byName := make(map[string][]int)
+	for i, s := range a.Sections {
+		byName[s.Name] = append(byName[s.Name], i)
+	}
+	seen := make(map[string]int)
+	match := make([]int, len(b.Sections))
+	for i, s := range b.Sections {
+		n := seen[s.Name]
+		seen[s.Name]++
+		match[i] = -1
+		if n < len(byName[s.Name]) {
+			match[i] = byName[s.Name][n]
+		}
+	}
+	return match
+}
+
+// patchBytes applies ranges, sorted by offset, to data.
+func patchBytes(data []byte, ranges []ByteRange) ([]byte, error) {
+	var out []byte
+	prev := uint64(0)
+	for i, r := range ranges {
+		end := r.Off + uint64(len(r.Old))
+		if r.Off < prev || end > uint64(len(data)) {
+			return nil, fmt.Errorf("range %d at %#x is out of order or past the end", i, r.Off)
+		}
+		if len(r.Old) != len(r.New) && i != len(ranges)-1 {
+			return nil, fmt.Errorf("range %d at %#x changes the size but is not the last", i, r.Off)
+		}
+		if !bytes.Equal(data[r.Off:end], r.Old) {
+			return nil, fmt.Errorf("bytes at %#x do not match the patch", r.Off)
+		}
+		out = append(out, data[prev:r.Off]...)
+		out = append(out, r.New...)
+		prev = end
+	}
+	return append(out, data[prev:]...), nil
+}
+
+// diffSymbols returns the static symbols of b that a does not have and
+// those of a that b does not have, comparing their names, types,
+// bindings, sections by name, values and sizes.
+func diffSymbols(a, b *File) (added, removed []Symbol) {
+	key := func(f *File, s Symbol) string {
+		sect := fmt.Sprint(s.Section)
+		if s.Section < SHN_LORESERVE && int(s.Section) < len(f.Sections) {
+			sect = f.Sections[s.Section].Name
+		}
+		return fmt.Sprintf("%s\x00%d\x00%d\x00%s\x00%d\x00%d", s.Name, s.Info, s.Other, sect, s.Value, s.Size)
+	}
+	asyms, _ := a.Symbols()
+	bsyms, _ := b.Symbols()
+	count := make(map[string]int)
+	for _, s := range asyms {
+		count[key(a, s)]++
+	}
+	for _, s := range bsyms {
+		k := key(b, s)
+		if count[k] > 0 {
+			count[k]--
+		} else {
+			added = append(added, s)
+		}
+	}
+	for _, s := range asyms {
+		k := key(a, s)
+		if count[k] > 0 {
+			count[k]--
+			removed = append(removed, s)
+		}
+	}
+	sort.SliceStable(added, func(i, j int) bool { return added[i].Name < added[j].Name })
+	sort.SliceStable(removed, func(i, j int) bool { return removed[i].Name < removed[j].Name })
+	return added, removed
+}
+
+// Header fields that Diff compares, named as in FileHeader, ProgHeader
+// and SectionHeader. FileSize follows from Size.
+var (
+	fileHeaderFieldNames = []string{"Version", "OSABI", "ABIVersion", "Type", "Entry", "SHTOffset", "ShStrIndex"}
+	progFieldNames       = []string{"Type", "Flags", "Off", "Vaddr", "Paddr", "Filesz", "Memsz", "Align"}
+	sectionFieldNames    = []string{"Shname", "Type", "Flags", "Addr", "Offset", "Size", "Link", "Info", "Addralign", "Entsize"}
+)
+
+// fieldValue returns the named integer field of the struct hdr points to.
+func fieldValue(hdr interface{}, name string) uint64 {
+	v := reflect.ValueOf(hdr).Elem().FieldByName(name)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(v.Int())
+	}
+	return v.Uint()
+}
+
+func setFieldValue(hdr interface{}, name string, x uint64) {
+	v := reflect.ValueOf(hdr).Elem().FieldByName(name)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(x))
+	default:
+		v.SetUint(x)
+	}
+}
+
+// diffFields returns the fields of old and new, which point to the same
+// type of header, that differ. A nil old stands for a header of zeros.
+func diffFields(names []string, old, new interface{}) []FieldChange {
+	var changes []FieldChange
+	for _, name := range names {
+		var o uint64
+		if old != nil {
+			o = fieldValue(old, name)
+		}
+		if n := fieldValue(new, name); o != n {
+			changes = append(changes, FieldChange{Field: name, Old: o, New: n})
+		}
+	}
+	return changes
+}
+
+// applyFields checks that the fields of hdr that changes modifies have
+// their old values, and then sets them to the new ones.
+func applyFields(names []string, hdr interface{}, changes []FieldChange) error {
+	for _, c := range changes {
+		known := false
+		for _, name := range names {
+			known = known || name == c.Field
+		}
+		if !known {
+			return fmt.Errorf("unknown field %s", c.Field)
+		}
+		if v := fieldValue(hdr, c.Field); v != c.Old {
+			return fmt.Errorf("%s is %#x, not %#x", c.Field, v, c.Old)
+		}
+	}
+	for _, c := range changes {
+		setFieldValue(hdr, c.Field, c.New)
+	}
+	return nil
+}
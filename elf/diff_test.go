@@ -0,0 +1,103 @@
+package elf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Binject/debug/internal/diff"
+)
+
+func TestDiffApplyPatch(t *testing.T) {
+	const name = "testdata/gcc-amd64-linux-exec"
+	f, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.SetEntry(f.Entry + 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.ResizeSection(".comment", bytes.Repeat([]byte("comment\x00"), 64)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.StripDWARF(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.AddSymbol(Symbol{Name: "patched", Info: ST_INFO(STB_GLOBAL, STT_FUNC), Section: 13, Value: f.Entry}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := g.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+	c, err := Diff(old, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Header) == 0 || c.Header[0].Field != "Entry" || c.Header[0].New != old.Entry+4 {
+		t.Errorf("header changes are %v, want Entry first", c.Header)
+	}
+	if len(c.RemovedSections) == 0 || !strings.HasPrefix(c.RemovedSections[0], ".debug_") {
+		t.Errorf("removed sections are %q, want the DWARF sections", c.RemovedSections)
+	}
+	if len(c.AddedSymbols) != 1 || c.AddedSymbols[0].Name != "patched" {
+		t.Errorf("symbols added are %v, want patched", c.AddedSymbols)
+	}
+	for _, sym := range c.RemovedSymbols {
+		if ST_TYPE(sym.Info) != STT_SECTION {
+			t.Errorf("removed symbol %+v is not the symbol of a removed section", sym)
+		}
+	}
+	if s := c.String(); !strings.Contains(s, "+ symbol patched\n") || !strings.Contains(s, "section .comment bytes") {
+		t.Errorf("changeset prints as\n%s", s)
+	}
+
+	if err := old.ApplyPatch(c); err != nil {
+		t.Fatal(err)
+	}
+	got, err := old.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("patched file differs from the modified one")
+	}
+	if err := old.ApplyPatch(c); err == nil {
+		t.Error("ApplyPatch applied the changeset twice")
+	}
+	if c, err := Diff(old, g); err != nil || len(c.Header)+len(c.Progs)+len(c.Sections)+len(c.RemovedSections) != 0 {
+		t.Errorf("patched file still differs: %v, %v", c, err)
+	}
+}
+
+func TestDiffBytes(t *testing.T) {
+	a := []byte("0123456789abcdefghij")
+	b := []byte("0X23456789abYdefghijKL")
+	ranges := diff.Bytes(a, b)
+	// The added tail is close enough to the change at 12 to be merged
+	// with it.
+	if len(ranges) != 2 || ranges[0].Off != 1 || ranges[1].Off != 12 || string(ranges[1].New) != "YdefghijKL" {
+		t.Fatalf("ranges are %+v", ranges)
+	}
+	if p, err := patchBytes(a, ranges); err != nil || !bytes.Equal(p, b) {
+		t.Errorf("patched bytes are %q, %v", p, err)
+	}
+	if _, err := patchBytes(b, ranges); err == nil {
+		t.Error("patchBytes applied ranges to different bytes")
+	}
+}
@@ -0,0 +1,292 @@
+package elf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Binject/debug/internal/readerat"
+)
+
+// dwarfSuffix returns the name of the DWARF section s without its
+// .debug_ or, for sections compressed the GNU way, .zdebug_ prefix, or ""
+// if s is not a DWARF section.
+func dwarfSuffix(s *Section) string {
+	switch {
+	case strings.HasPrefix(s.Name, ".debug_"):
+		return s.Name[7:]
+	case strings.HasPrefix(s.Name, ".zdebug_"):
+		return s.Name[8:]
+	}
+	return ""
+}
+
+// dwarfSection returns the index of the DWARF section with the given
+// suffix, such as "info", and the section, or -1 and nil.
+func (f *File) dwarfSection(suffix string) (int, *Section) {
+	for i, s := range f.Sections {
+		if dwarfSuffix(s) == suffix {
+			return i, s
+		}
+	}
+	return -1, nil
+}
+
+// zdebugData returns the uncompressed contents of b, the data of a
+// .zdebug_ section, if b starts with the "ZLIB" header, and b otherwise.
+func zdebugData(b []byte) ([]byte, error) {
+	if len(b) < 12 || string(b[:4]) != "ZLIB" {
+		return b, nil
+	}
+	dlen := binary.BigEndian.Uint64(b[4:12])
+	r, err := zlib.NewReader(bytes.NewBuffer(b[12:]))
+	if err != nil {
+		return nil, err
+	}
+	dbuf, err := readerat.ReadData(r, dlen)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Close(); err != nil {
+		return nil, err
+	}
+	return dbuf, nil
+}
+
+// dwarfData returns the uncompressed contents of the DWARF section s.
+func dwarfData(s *Section) ([]byte, error) {
+	b, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	return zdebugData(b)
+}
+
+// ReplaceDWARFSection replaces the contents of the DWARF section named
+// by suffix, such as "info" for .debug_info or .zdebug_info, with data.
+// Compressed sections stay compressed. A section that outgrows its space
+// in the file is moved to the end of the file.
+//
+// Relocations that apply to the section are kept, so in object files the
+// fields they patch must stay where they were.
+func (f *File) ReplaceDWARFSection(suffix string, data []byte) error {
+	_, s := f.dwarfSection(suffix)
+	if s == nil {
+		return fmt.Errorf("no DWARF section %s", suffix)
+	}
+	return f.replaceDWARF(s, data)
+}
+
+// replaceDWARF replaces the contents of the DWARF section s with data,
+// compressing them as s is.
+func (f *File) replaceDWARF(s *Section, data []byte) error {
+	switch {
+	case s.Flags&SHF_COMPRESSED != 0:
+		t := s.compressionType
+		f.replaceNonAlloc(s, data)
+		s.Flags &^= SHF_COMPRESSED
+		return f.CompressSection(s, t)
+	case strings.HasPrefix(s.Name, ".zdebug_"):
+		var buf bytes.Buffer
+		buf.WriteString("ZLIB")
+		binary.Write(&buf, binary.BigEndian, uint64(len(data)))
+		zw := zlib.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		f.replaceNonAlloc(s, buf.Bytes())
+	default:
+		f.replaceNonAlloc(s, data)
+	}
+	return nil
+}
+
+// StripDWARF removes the DWARF sections, the relocation sections that
+// apply to them and the symbols defined in them. The sections that follow
+// are renumbered, along with the section links and the section indices
+// of the remaining symbols. The names of the removed sections stay in
+// the section name string table.
+func (f *File) StripDWARF() error {
+	drop := make(map[int]bool)
+	for i, s := range f.Sections {
+		if dwarfSuffix(s) != "" {
+			drop[i] = true
+		}
+	}
+	for i, s := range f.Sections {
+		if (s.Type == SHT_REL || s.Type == SHT_RELA) && drop[int(s.Info)] {
+			drop[i] = true
+		}
+	}
+	if len(drop) == 0 {
+		return nil
+	}
+	return f.removeSections(drop)
+}
+
+// removeSections removes the sections whose indices are in drop, which
+// no remaining section may link to, along with the symbols defined in
+// them. Nothing is modified if an error is returned.
+func (f *File) removeSections(drop map[int]bool) error {
+	if drop[0] || drop[f.ShStrIndex] {
+		return errors.New("cannot remove the null section or the section name string table")
+	}
+	newIdx := make([]uint32, len(f.Sections))
+	var n uint32
+	for i := range f.Sections {
+		if !drop[i] {
+			newIdx[i] = n
+			n++
+		}
+	}
+	infoLink := func(s *Section) bool {
+		return s.Type == SHT_REL || s.Type == SHT_RELA || s.Flags&SHF_INFO_LINK != 0
+	}
+	for i, s := range f.Sections {
+		if drop[i] {
+			continue
+		}
+		switch {
+		case s.Type == SHT_SYMTAB_SHNDX:
+			return errors.New("extended section index tables are not supported")
+		case s.Link != 0 && drop[int(s.Link)]:
+			return fmt.Errorf("section %s links to section %s", s.Name, f.Sections[s.Link].Name)
+		case infoLink(s) && s.Info != 0 && drop[int(s.Info)]:
+			return fmt.Errorf("section %s applies to section %s", s.Name, f.Sections[s.Info].Name)
+		}
+	}
+	remapShndx := func(shndx uint16) (uint16, bool) {
+		if shndx == 0 || shndx >= uint16(SHN_LORESERVE) {
+			return shndx, true
+		}
+		if drop[int(shndx)] {
+			return 0, false
+		}
+		return uint16(newIdx[shndx]), true
+	}
+
+	// The section indices of the dynamic symbols are patched in place.
+	var dynsym *Section
+	var dyndata []byte
+	if s := f.SectionByType(SHT_DYNSYM); s != nil {
+		data, err := s.Data()
+		if err != nil {
+			return err
+		}
+		entsize := Sym32Size
+		if f.Class == ELFCLASS64 {
+			entsize = Sym64Size
+		}
+		for off := entsize; off+entsize <= len(data); off += entsize {
+			shndx, ok := remapShndx(f.ByteOrder.Uint16(data[off+14:]))
+			if !ok {
+				return fmt.Errorf("dynamic symbol %d is defined in a removed section", off/entsize)
+			}
+			f.ByteOrder.PutUint16(data[off+14:], shndx)
+		}
+		dynsym, dyndata = s, data
+	}
+
+	// Group sections list the indices of their members.
+	type update struct {
+		s    *Section
+		data []byte
+	}
+	var groups []update
+	for i, s := range f.Sections {
+		if drop[i] || s.Type != SHT_GROUP {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return err
+		}
+		if len(data)%4 != 0 || len(data) < 4 {
+			return fmt.Errorf("length of group section %d is not a multiple of 4", i)
+		}
+		out := append([]byte(nil), data[:4]...)
+		for off := 4; off < len(data); off += 4 {
+			member := f.ByteOrder.Uint32(data[off:])
+			if int(member) >= len(f.Sections) {
+				return fmt.Errorf("group section %d has member %d out of range", i, member)
+			}
+			if !drop[int(member)] {
+				var b [4]byte
+				f.ByteOrder.PutUint32(b[:], newIdx[member])
+				out = append(out, b[:]...)
+			}
+		}
+		groups = append(groups, update{s, out})
+	}
+
+	e, err := f.editSymtab()
+	switch {
+	case err == ErrNoSymbols:
+		e = nil
+	case err != nil:
+		return err
+	case drop[e.idx] || drop[int(e.symtab.Link)]:
+		return errors.New("cannot remove the symbol table")
+	}
+	if e != nil {
+		// newSym maps symbol table indices to their new index, or to 0
+		// for the symbols that are removed.
+		newSym := make([]uint32, len(e.syms)+1)
+		var syms []Symbol
+		for i, sym := range e.syms {
+			shndx, ok := remapShndx(sym.SectIndex)
+			if !ok {
+				continue
+			}
+			sym.SectIndex = shndx
+			if sym.Section < SHN_LORESERVE {
+				sym.Section = SectionIndex(shndx)
+			}
+			syms = append(syms, sym)
+			newSym[i+1] = uint32(len(syms))
+		}
+		e.dropped = drop
+		if err := e.renumber(func(old uint32) (uint32, bool) {
+			if int(old) >= len(newSym) {
+				return old, true
+			}
+			return newSym[old], old == 0 || newSym[old] != 0
+		}); err != nil {
+			return err
+		}
+		e.syms = syms
+		if err := e.commit(); err != nil {
+			return err
+		}
+	}
+
+	if dynsym != nil {
+		dynsym.Replace(bytes.NewReader(dyndata), int64(len(dyndata)))
+	}
+	for _, g := range groups {
+		f.replaceNonAlloc(g.s, g.data)
+	}
+	var sections []*Section
+	for i, s := range f.Sections {
+		if drop[i] {
+			continue
+		}
+		s.Shnum = int(newIdx[i])
+		if int(s.Link) < len(newIdx) {
+			s.Link = newIdx[s.Link]
+		}
+		if infoLink(s) && int(s.Info) < len(newIdx) {
+			s.Info = newIdx[s.Info]
+		}
+		sections = append(sections, s)
+	}
+	f.Sections = sections
+	f.ShStrIndex = int(newIdx[f.ShStrIndex])
+	return nil
+}
@@ -0,0 +1,174 @@
+package elf
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// lineEntries returns the file names and addresses of the line table
+// rows of every compilation unit in f.
+func lineEntries(t *testing.T, f *File) []string {
+	d, err := f.DWARF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []string
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e == nil {
+			return rows
+		}
+		if e.Tag != dwarf.TagCompileUnit {
+			r.SkipChildren()
+			continue
+		}
+		lr, err := d.LineReader(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var le dwarf.LineEntry
+		for lr != nil {
+			if err := lr.Next(&le); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			rows = append(rows, fmt.Sprintf("%s:%d@%#x", le.File.Name, le.Line, le.Address))
+		}
+	}
+}
+
+func TestStripDWARF(t *testing.T) {
+	f, err := Open("testdata/go-relocation-test-gcc441-x86-64.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.StripDWARF(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range g.Sections {
+		if strings.Contains(s.Name, "debug") {
+			t.Errorf("section %s is left", s.Name)
+		}
+	}
+	if s := g.Section(".rela.eh_frame"); s == nil || g.Sections[s.Info].Name != ".eh_frame" || g.Sections[s.Link].Type != SHT_SYMTAB {
+		t.Errorf(".rela.eh_frame does not link to .eh_frame and the symbol table")
+	}
+	syms, err := g.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(syms) != 8 {
+		t.Errorf("%d symbols left, want 8", len(syms))
+	}
+	for _, sym := range syms {
+		if sym.Name == "f" && g.Sections[sym.Section].Name != ".text" {
+			t.Errorf("f is defined in %s", g.Sections[sym.Section].Name)
+		}
+	}
+	rd, err := g.Section(".rela.eh_frame").Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sym := syms[R_SYM64(g.ByteOrder.Uint64(rd[8:]))-1]; g.Sections[sym.Section].Name != ".text" {
+		t.Errorf(".rela.eh_frame refers to a symbol in %s", g.Sections[sym.Section].Name)
+	}
+}
+
+func TestReplaceDWARFSection(t *testing.T) {
+	for _, file := range []string{"testdata/compressed-64.obj", "testdata/zdebug-test-gcc484-x86-64.obj"} {
+		f, err := Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		_, s := f.dwarfSection("str")
+		old, err := dwarfData(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		str := append(old, bytes.Repeat([]byte("padding\x00"), 64)...)
+		if err := f.ReplaceDWARFSection("str", str); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.ReplaceDWARFSection("nope", nil); err == nil {
+			t.Errorf("%s: ReplaceDWARFSection accepted a missing section", file)
+		}
+
+		b, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, s = g.dwarfSection("str")
+		if data, err := dwarfData(s); err != nil || !bytes.Equal(data, str) {
+			t.Errorf("%s: %s holds %d bytes, %v, want %d", file, s.Name, len(data), err, len(str))
+		}
+		if s.FileSize >= uint64(len(str)) {
+			t.Errorf("%s: %s is not compressed", file, s.Name)
+		}
+		if _, err := g.DWARF(); err != nil {
+			t.Errorf("%s: %v", file, err)
+		}
+	}
+}
+
+func TestRewriteDWARFLinePaths(t *testing.T) {
+	for _, c := range []struct {
+		file, prefix string
+	}{
+		{"testdata/gcc-amd64-linux-exec", "/build/buildd/glibc-2.7/build-tree/"},
+		{"testdata/compressed-64.obj", "/home/iant/go/src/"},
+	} {
+		f, err := Open(c.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		before := lineEntries(t, f)
+		rewrite := func(path string) string {
+			return strings.Replace(path, c.prefix, "/src/", 1)
+		}
+		if err := f.RewriteDWARFLinePaths(rewrite); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		after := lineEntries(t, g)
+		if len(after) != len(before) || len(before) == 0 {
+			t.Fatalf("%s: %d line table rows after rewriting, want %d", c.file, len(after), len(before))
+		}
+		for i := range before {
+			if want := rewrite(before[i]); after[i] != want {
+				t.Errorf("%s: row %d is %q, want %q", c.file, i, after[i], want)
+			}
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package elf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// DWARF attributes, forms and unit types needed to find the line table
+// of a compilation unit.
+const (
+	dwAtStmtList = 0x10
+
+	dwFormAddr          = 0x01
+	dwFormBlock2        = 0x03
+	dwFormBlock4        = 0x04
+	dwFormBlock1        = 0x0a
+	dwFormFlag          = 0x0c
+	dwFormRefAddr       = 0x10
+	dwFormRef1          = 0x11
+	dwFormRef2          = 0x12
+	dwFormRef4          = 0x13
+	dwFormRef8          = 0x14
+	dwFormRefUdata      = 0x15
+	dwFormIndirect      = 0x16
+	dwFormSecOffset     = 0x17
+	dwFormExprloc       = 0x18
+	dwFormFlagPresent   = 0x19
+	dwFormStrx          = 0x1a
+	dwFormAddrx         = 0x1b
+	dwFormRefSup4       = 0x1c
+	dwFormStrpSup       = 0x1d
+	dwFormRefSig8       = 0x20
+	dwFormImplicitConst = 0x21
+	dwFormLoclistx      = 0x22
+	dwFormRnglistx      = 0x23
+	dwFormRefSup8       = 0x24
+	dwFormStrx1         = 0x25
+	dwFormStrx4         = 0x28
+	dwFormAddrx1        = 0x29
+	dwFormAddrx4        = 0x2c
+	dwFormGNUAddrIndex  = 0x1f01
+	dwFormGNUStrIndex   = 0x1f02
+	dwFormGNURefAlt     = 0x1f20
+	dwFormGNUStrpAlt    = 0x1f21
+
+	dwUtType         = 0x02
+	dwUtSkeleton     = 0x04
+	dwUtSplitCompile = 0x05
+	dwUtSplitType    = 0x06
+)
+
+// dwarfFormSize returns the size of the value of the given form at off in
+// b, which is in byte order bo. For DW_FORM_indirect, off is moved past the actual form, which is
+// returned.
+func dwarfFormSize(b []byte, bo binary.ByteOrder, off *int, form uint64, version, addrSize, offSize int) (int, uint64, error) {
+	uleb := func() (int, error) {
+		_, next, err := readULEB(b, *off)
+		return next - *off, err
+	}
+	block := func() (int, error) {
+		n, next, err := readULEB(b, *off)
+		return next - *off + int(n), err
+	}
+	fixed := func(n int) (int, uint64, error) { return n, form, nil }
+	switch form {
+	case dwFormAddr:
+		return fixed(addrSize)
+	case dwFormData1, dwFormRef1, dwFormFlag, dwFormStrx1, dwFormAddrx1:
+		return fixed(1)
+	case dwFormData2, dwFormRef2, dwFormStrx1 + 1, dwFormAddrx1 + 1:
+		return fixed(2)
+	case dwFormStrx1 + 2, dwFormAddrx1 + 2:
+		return fixed(3)
+	case dwFormData4, dwFormRef4, dwFormRefSup4, dwFormStrx4, dwFormAddrx4:
+		return fixed(4)
+	case dwFormData8, dwFormRef8, dwFormRefSig8, dwFormRefSup8:
+		return fixed(8)
+	case dwFormData16:
+		return fixed(16)
+	case dwFormFlagPresent, dwFormImplicitConst:
+		return fixed(0)
+	case dwFormStrp, dwFormLineStrp, dwFormSecOffset, dwFormStrpSup, dwFormGNURefAlt, dwFormGNUStrpAlt:
+		return fixed(offSize)
+	case dwFormRefAddr:
+		if version == 2 {
+			return fixed(addrSize)
+		}
+		return fixed(offSize)
+	case dwFormBlock1, dwFormBlock2, dwFormBlock4:
+		var size, n int
+		switch {
+		case form == dwFormBlock1 && *off+1 <= len(b):
+			size, n = 1, int(b[*off])
+		case form == dwFormBlock2 && *off+2 <= len(b):
+			size, n = 2, int(bo.Uint16(b[*off:]))
+		case form == dwFormBlock4 && *off+4 <= len(b):
+			size, n = 4, int(bo.Uint32(b[*off:]))
+		default:
+			return 0, 0, errLineTruncated
+		}
+		return size + n, form, nil
+	case dwFormString:
+		for i := *off; i < len(b); i++ {
+			if b[i] == 0 {
+				return i + 1 - *off, form, nil
+			}
+		}
+		return 0, 0, errLineTruncated
+	case dwFormSdata, dwFormUdata, dwFormRefUdata, dwFormStrx, dwFormAddrx, dwFormLoclistx, dwFormRnglistx, dwFormGNUAddrIndex, dwFormGNUStrIndex:
+		n, err := uleb()
+		return n, form, err
+	case dwFormBlock, dwFormExprloc:
+		n, err := block()
+		return n, form, err
+	case dwFormIndirect:
+		actual, next, err := readULEB(b, *off)
+		if err != nil {
+			return 0, 0, err
+		}
+		*off = next
+		return dwarfFormSize(b, bo, off, actual, version, addrSize, offSize)
+	}
+	return 0, 0, fmt.Errorf("unknown form %#x", form)
+}
+
+// abbrevAttrs returns the attributes and forms of the abbreviation with
+// the given code in the table at off in abbrev.
+func abbrevAttrs(abbrev []byte, off int, code uint64) ([][2]uint64, error) {
+	for off < len(abbrev) {
+		c, p, err := readULEB(abbrev, off)
+		if err != nil {
+			return nil, err
+		}
+		if c == 0 {
+			break
+		}
+		if _, p, err = readULEB(abbrev, p); err != nil { // tag
+			return nil, err
+		}
+		p++ // children
+		var attrs [][2]uint64
+		for {
+			var attr, form uint64
+			if attr, p, err = readULEB(abbrev, p); err != nil {
+				return nil, err
+			}
+			if form, p, err = readULEB(abbrev, p); err != nil {
+				return nil, err
+			}
+			if attr == 0 && form == 0 {
+				break
+			}
+			if form == dwFormImplicitConst {
+				if _, p, err = readULEB(abbrev, p); err != nil {
+					return nil, err
+				}
+			}
+			attrs = append(attrs, [2]uint64{attr, form})
+		}
+		if c == code {
+			return attrs, nil
+		}
+		off = p
+	}
+	return nil, fmt.Errorf("no abbreviation %d", code)
+}
+
+// stmtLists moves the DW_AT_stmt_list attributes of the units in the
+// DWARF section s, whose index is i, along with the line tables they
+// refer to. It returns the new contents of s, or nil if they do not
+// change, and those of the relocation sections that apply to it whose
+// addends change.
+func (w *linePathRewriter) stmtLists(i int, s *Section) ([]byte, map[*Section][]byte, error) {
+	f := w.f
+	data, err := dwarfData(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, as := f.dwarfSection("abbrev")
+	if as == nil {
+		return nil, nil, errors.New("no DWARF abbreviations")
+	}
+	abbrev, err := dwarfData(as)
+	if err != nil {
+		return nil, nil, err
+	}
+	vals := data
+	var rels []*Section
+	for _, r := range f.Sections {
+		if (r.Type == SHT_REL || r.Type == SHT_RELA) && int(r.Info) == i {
+			rels = append(rels, r)
+		}
+	}
+	if len(rels) > 0 {
+		vals = append([]byte(nil), data...)
+		for _, r := range rels {
+			rd, err := r.Data()
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := f.applyRelocations(vals, rd); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	r := &linePathRewriter{f: f, vals: vals}
+
+	var out []byte
+	relOut := make(map[*Section][]byte)
+	for off := 0; off < len(vals); {
+		length, err := r.uint(off, 4)
+		if err != nil {
+			return nil, nil, err
+		}
+		lenSize, offSize := 4, 4
+		if length == 0xffffffff {
+			if length, err = r.uint(off+4, 8); err != nil {
+				return nil, nil, err
+			}
+			lenSize, offSize = 12, 8
+		}
+		end := off + lenSize + int(length)
+		if length > uint64(len(vals)) || end > len(vals) {
+			return nil, nil, errLineTruncated
+		}
+		next := off
+		off = end
+
+		p := next + lenSize
+		version, err := r.uint(p, 2)
+		if err != nil {
+			return nil, nil, err
+		}
+		p += 2
+		var abbrevOff, addrSize uint64
+		if version >= 5 {
+			unitType, err := r.uint(p, 1)
+			if err != nil {
+				return nil, nil, err
+			}
+			if addrSize, err = r.uint(p+1, 1); err != nil {
+				return nil, nil, err
+			}
+			if abbrevOff, err = r.uint(p+2, offSize); err != nil {
+				return nil, nil, err
+			}
+			p += 2 + offSize
+			switch unitType {
+			case dwUtSkeleton, dwUtSplitCompile:
+				p += 8
+			case dwUtType, dwUtSplitType:
+				p += 8 + offSize
+			}
+		} else {
+			if abbrevOff, err = r.uint(p, offSize); err != nil {
+				return nil, nil, err
+			}
+			if addrSize, err = r.uint(p+offSize, 1); err != nil {
+				return nil, nil, err
+			}
+			p += offSize + 1
+			if dwarfSuffix(s) == "types" {
+				p += 8 + offSize // type_signature, type_offset
+			}
+		}
+		if version < 2 || version > 5 || p >= end {
+			continue
+		}
+
+		code, p, err := readULEB(vals, p)
+		if err != nil || code == 0 {
+			continue
+		}
+		attrs, err := abbrevAttrs(abbrev, int(abbrevOff), code)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, a := range attrs {
+			size, form, err := dwarfFormSize(vals, f.ByteOrder, &p, a[1], int(version), int(addrSize), offSize)
+			if err != nil {
+				return nil, nil, err
+			}
+			if a[0] != dwAtStmtList || (form != dwFormSecOffset && form != dwFormData4 && form != dwFormData8) {
+				p += size
+				continue
+			}
+			v, err := r.uint(p, size)
+			if err != nil {
+				return nil, nil, err
+			}
+			if nv := w.moved(v); nv != v {
+				if out == nil {
+					out = append([]byte(nil), data...)
+				}
+				if err := w.moveStmtList(out, rels, relOut, p, size, nv-v); err != nil {
+					return nil, nil, err
+				}
+			}
+			break
+		}
+	}
+	return out, relOut, nil
+}
+
+// moveStmtList adds delta to the size byte field at off in data, or to
+// the addend of the RELA relocation that sets it.
+func (w *linePathRewriter) moveStmtList(data []byte, rels []*Section, relOut map[*Section][]byte, off, size int, delta uint64) error {
+	bo := w.f.ByteOrder
+	for _, r := range rels {
+		if r.Type != SHT_RELA {
+			continue
+		}
+		rd, ok := relOut[r]
+		if !ok {
+			var err error
+			if rd, err = r.Data(); err != nil {
+				return err
+			}
+		}
+		entsize, offSize := w.f.relocEntrySize(r)
+		for e := 0; e+entsize <= len(rd); e += entsize {
+			if offSize == 8 {
+				if bo.Uint64(rd[e:]) == uint64(off) {
+					bo.PutUint64(rd[e+16:], bo.Uint64(rd[e+16:])+delta)
+					relOut[r] = rd
+					return nil
+				}
+			} else if bo.Uint32(rd[e:]) == uint32(off) {
+				bo.PutUint32(rd[e+8:], bo.Uint32(rd[e+8:])+uint32(delta))
+				relOut[r] = rd
+				return nil
+			}
+		}
+	}
+	if size == 8 {
+		bo.PutUint64(data[off:], bo.Uint64(data[off:])+delta)
+	} else {
+		bo.PutUint32(data[off:], bo.Uint32(data[off:])+uint32(delta))
+	}
+	return nil
+}
@@ -0,0 +1,498 @@
+package elf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// DWARF forms and line table content types used by the line table
+// headers of DWARF 5.
+const (
+	dwFormBlock    = 0x09
+	dwFormData1    = 0x0b
+	dwFormData2    = 0x05
+	dwFormData4    = 0x06
+	dwFormData8    = 0x07
+	dwFormData16   = 0x1e
+	dwFormLineStrp = 0x1f
+	dwFormSdata    = 0x0d
+	dwFormString   = 0x08
+	dwFormStrp     = 0x0e
+	dwFormUdata    = 0x0f
+
+	dwLnctPath = 0x1
+)
+
+// A lineEdit records that the bytes of the line table before end changed
+// length by delta.
+type lineEdit struct {
+	end   int
+	delta int
+}
+
+// A linePathRewriter rewrites the paths in the headers of the line number
+// programs in a line table.
+type linePathRewriter struct {
+	f       *File
+	rewrite func(string) string
+	data    []byte // the line table
+	vals    []byte // the line table with its relocations applied
+	out     bytes.Buffer
+	edits   []lineEdit
+	pools   map[string][]byte // rewritten string sections, by DWARF suffix
+	done    map[string]map[uint64]bool
+}
+
+// RewriteDWARFLinePaths replaces every include directory and file name
+// in the headers of the line number programs of the DWARF line table with
+// the result of calling rewrite on it, for example to remove build
+// directories from the paths. Line tables of DWARF versions 2 to 5 are
+// supported; units of other versions are left as they are.
+//
+// Paths stored in the line table itself may change length, and the unit
+// and header lengths and the offsets of the relocations that apply to the
+// table are updated. Paths that DWARF 5 headers keep in .debug_line_str
+// or .debug_str are rewritten in place, padded with NUL bytes, and may not
+// grow. As the string sections are shared, other references to those
+// strings see the rewritten paths too.
+func (f *File) RewriteDWARFLinePaths(rewrite func(path string) string) error {
+	idx, line := f.dwarfSection("line")
+	if line == nil {
+		return errors.New("no DWARF line table")
+	}
+	data, err := dwarfData(line)
+	if err != nil {
+		return err
+	}
+	var rels []*Section
+	for _, r := range f.Sections {
+		if (r.Type == SHT_REL || r.Type == SHT_RELA) && int(r.Info) == idx {
+			rels = append(rels, r)
+		}
+	}
+	vals := data
+	if len(rels) > 0 {
+		vals = append([]byte(nil), data...)
+		for _, r := range rels {
+			rd, err := r.Data()
+			if err != nil {
+				return err
+			}
+			if err := f.applyRelocations(vals, rd); err != nil {
+				return err
+			}
+		}
+	}
+
+	w := &linePathRewriter{
+		f:       f,
+		rewrite: rewrite,
+		data:    data,
+		vals:    vals,
+		pools:   make(map[string][]byte),
+		done:    make(map[string]map[uint64]bool),
+	}
+	for off := 0; off < len(data); {
+		next, err := w.unit(off)
+		if err != nil {
+			return fmt.Errorf("line table unit at %#x: %v", off, err)
+		}
+		off = next
+	}
+
+	// The units that follow rewritten ones move, and so do the line
+	// tables the compilation units refer to.
+	type update struct {
+		s    *Section
+		data []byte
+	}
+	var updates, infos []update
+	for i, s := range f.Sections {
+		if suffix := dwarfSuffix(s); suffix != "info" && suffix != "types" {
+			continue
+		}
+		info, infoRels, err := w.stmtLists(i, s)
+		if err != nil {
+			return fmt.Errorf("section %s: %v", s.Name, err)
+		}
+		if info != nil {
+			infos = append(infos, update{s, info})
+		}
+		for r, rd := range infoRels {
+			updates = append(updates, update{r, rd})
+		}
+	}
+	for _, r := range rels {
+		rd, err := w.relocate(r)
+		if err != nil {
+			return err
+		}
+		updates = append(updates, update{r, rd})
+	}
+
+	// Nothing is modified until every unit has been rewritten.
+	for suffix, pool := range w.pools {
+		if err := f.ReplaceDWARFSection(suffix, pool); err != nil {
+			return err
+		}
+	}
+	for _, u := range infos {
+		if err := f.replaceDWARF(u.s, u.data); err != nil {
+			return err
+		}
+	}
+	for _, u := range updates {
+		f.replaceNonAlloc(u.s, u.data)
+	}
+	if !bytes.Equal(w.out.Bytes(), data) {
+		return f.ReplaceDWARFSection("line", w.out.Bytes())
+	}
+	return nil
+}
+
+var errLineTruncated = errors.New("unexpected end of line table")
+
+// uint returns the n byte value at off in the relocated line table.
+func (w *linePathRewriter) uint(off, n int) (uint64, error) {
+	if off < 0 || off+n > len(w.vals) {
+		return 0, errLineTruncated
+	}
+	switch n {
+	case 1:
+		return uint64(w.vals[off]), nil
+	case 2:
+		return uint64(w.f.ByteOrder.Uint16(w.vals[off:])), nil
+	case 4:
+		return uint64(w.f.ByteOrder.Uint32(w.vals[off:])), nil
+	}
+	return w.f.ByteOrder.Uint64(w.vals[off:]), nil
+}
+
+// readULEB returns the LEB128 value at off in b, signed or not, and the
+// offset that follows it.
+func readULEB(b []byte, off int) (uint64, int, error) {
+	var v uint64
+	for shift := uint(0); off < len(b); shift += 7 {
+		c := b[off]
+		off++
+		if shift < 64 {
+			v |= uint64(c&0x7f) << shift
+		}
+		if c&0x80 == 0 {
+			return v, off, nil
+		}
+	}
+	return 0, 0, errLineTruncated
+}
+
+// path writes the rewritten path stored as a NUL terminated string at off
+// and returns it and the offset that follows it. An empty string, which
+// ends the tables of DWARF 2 to 4, is written as it is.
+func (w *linePathRewriter) path(off int) (string, int, error) {
+	n := bytes.IndexByte(w.data[off:], 0)
+	if n < 0 {
+		return "", 0, errLineTruncated
+	}
+	s := string(w.data[off : off+n])
+	end := off + n + 1
+	if s != "" {
+		ns := w.rewrite(s)
+		if ns == "" {
+			return "", 0, fmt.Errorf("path %q is rewritten to an empty string", s)
+		}
+		w.edits = append(w.edits, lineEdit{end, len(ns) - n})
+		s = ns
+	}
+	w.out.WriteString(s)
+	w.out.WriteByte(0)
+	return s, end, nil
+}
+
+// poolPath rewrites in place the path at off in the string section with
+// the given DWARF suffix.
+func (w *linePathRewriter) poolPath(suffix string, off uint64) error {
+	if w.done[suffix][off] {
+		return nil
+	}
+	pool, ok := w.pools[suffix]
+	if !ok {
+		_, s := w.f.dwarfSection(suffix)
+		if s == nil {
+			return fmt.Errorf("no DWARF section %s", suffix)
+		}
+		var err error
+		if pool, err = dwarfData(s); err != nil {
+			return err
+		}
+		w.pools[suffix] = pool
+		w.done[suffix] = make(map[uint64]bool)
+	}
+	if off >= uint64(len(pool)) {
+		return fmt.Errorf("string offset %#x is outside of section %s", off, suffix)
+	}
+	n := bytes.IndexByte(pool[off:], 0)
+	if n < 0 {
+		return fmt.Errorf("string at %#x in section %s is not terminated", off, suffix)
+	}
+	ns := w.rewrite(string(pool[off : off+uint64(n)]))
+	if len(ns) > n {
+		return fmt.Errorf("path %q at %#x in section %s cannot grow to %q", pool[off:off+uint64(n)], off, suffix, ns)
+	}
+	copy(pool[off:], ns)
+	for i := off + uint64(len(ns)); i < off+uint64(n); i++ {
+		pool[i] = 0
+	}
+	w.done[suffix][off] = true
+	return nil
+}
+
+// unit rewrites the line number program at off and returns the offset of
+// the next one.
+func (w *linePathRewriter) unit(off int) (int, error) {
+	length, err := w.uint(off, 4)
+	if err != nil {
+		return 0, err
+	}
+	lenSize, offSize := 4, 4
+	if length == 0xffffffff {
+		if length, err = w.uint(off+4, 8); err != nil {
+			return 0, err
+		}
+		lenSize, offSize = 12, 8
+	}
+	end := off + lenSize + int(length)
+	if length > uint64(len(w.data)) || end > len(w.data) {
+		return 0, errLineTruncated
+	}
+	p := off + lenSize
+	version, err := w.uint(p, 2)
+	if err != nil {
+		return 0, err
+	}
+	if version < 2 || version > 5 {
+		w.out.Write(w.data[off:end])
+		return end, nil
+	}
+	p += 2
+	if version >= 5 {
+		p += 2 // address_size, segment_selector_size
+	}
+	hp := p
+	hlength, err := w.uint(hp, offSize)
+	if err != nil {
+		return 0, err
+	}
+	progStart := hp + offSize + int(hlength)
+	if hlength > uint64(len(w.data)) || progStart > end {
+		return 0, errLineTruncated
+	}
+	p += offSize + 4 // minimum_instruction_length, default_is_stmt, line_base, line_range
+	if version >= 4 {
+		p++ // maximum_operations_per_instruction
+	}
+	opcodeBase, err := w.uint(p, 1)
+	if err != nil {
+		return 0, err
+	}
+	tables := p + 1 + int(opcodeBase) - 1
+	if opcodeBase == 0 || tables > progStart {
+		return 0, errLineTruncated
+	}
+
+	start := w.out.Len()
+	nedits := len(w.edits)
+	w.out.Write(w.data[off:tables])
+	if version < 5 {
+		p, err = w.tables4(tables, progStart)
+	} else {
+		p, err = w.tables5(tables, progStart, offSize)
+	}
+	if err != nil {
+		return 0, err
+	}
+	w.out.Write(w.data[p:end])
+
+	delta := 0
+	for _, e := range w.edits[nedits:] {
+		delta += e.delta
+	}
+	unit := w.out.Bytes()[start:]
+	bo := w.f.ByteOrder
+	if offSize == 8 {
+		bo.PutUint64(unit[4:], length+uint64(delta))
+		bo.PutUint64(unit[hp-off:], hlength+uint64(delta))
+	} else {
+		if length+uint64(delta) > 0xffffffff {
+			return 0, errors.New("unit is too large for 32-bit DWARF")
+		}
+		bo.PutUint32(unit, uint32(length+uint64(delta)))
+		bo.PutUint32(unit[hp-off:], uint32(hlength+uint64(delta)))
+	}
+	return end, nil
+}
+
+// tables4 rewrites the include_directories and file_names of a DWARF 2
+// to 4 header, which start at p, and returns the offset that follows
+// them.
+func (w *linePathRewriter) tables4(p, limit int) (int, error) {
+	for p < limit {
+		s, next, err := w.path(p)
+		if err != nil {
+			return 0, err
+		}
+		p = next
+		if s == "" {
+			break
+		}
+	}
+	for p < limit {
+		s, next, err := w.path(p)
+		if err != nil {
+			return 0, err
+		}
+		p = next
+		if s == "" {
+			return p, nil
+		}
+		// directory index, modification time and length
+		start := p
+		for i := 0; i < 3; i++ {
+			if _, p, err = readULEB(w.data, p); err != nil {
+				return 0, err
+			}
+		}
+		w.out.Write(w.data[start:p])
+	}
+	return 0, errLineTruncated
+}
+
+// tables5 rewrites the directory and file name tables of a DWARF 5
+// header, which start at p, and returns the offset that follows them.
+func (w *linePathRewriter) tables5(p, limit, offSize int) (int, error) {
+	for table := 0; table < 2; table++ {
+		nformats, err := w.uint(p, 1)
+		if err != nil {
+			return 0, err
+		}
+		start := p
+		p++
+		type format struct{ content, form uint64 }
+		formats := make([]format, nformats)
+		for i := range formats {
+			if formats[i].content, p, err = readULEB(w.data, p); err != nil {
+				return 0, err
+			}
+			if formats[i].form, p, err = readULEB(w.data, p); err != nil {
+				return 0, err
+			}
+		}
+		count, p2, err := readULEB(w.data, p)
+		if err != nil {
+			return 0, err
+		}
+		p = p2
+		w.out.Write(w.data[start:p])
+
+		for i := uint64(0); i < count; i++ {
+			for _, fm := range formats {
+				if p >= limit {
+					return 0, errLineTruncated
+				}
+				isPath := fm.content == dwLnctPath
+				start := p
+				switch fm.form {
+				case dwFormString:
+					if isPath {
+						if _, p, err = w.path(p); err != nil {
+							return 0, err
+						}
+						continue
+					}
+					n := bytes.IndexByte(w.data[p:], 0)
+					if n < 0 {
+						return 0, errLineTruncated
+					}
+					p += n + 1
+				case dwFormLineStrp, dwFormStrp:
+					off, err := w.uint(p, offSize)
+					if err != nil {
+						return 0, err
+					}
+					p += offSize
+					if isPath {
+						suffix := "line_str"
+						if fm.form == dwFormStrp {
+							suffix = "str"
+						}
+						if err := w.poolPath(suffix, off); err != nil {
+							return 0, err
+						}
+					}
+				case dwFormUdata, dwFormSdata:
+					if _, p, err = readULEB(w.data, p); err != nil {
+						return 0, err
+					}
+				case dwFormData1:
+					p++
+				case dwFormData2:
+					p += 2
+				case dwFormData4:
+					p += 4
+				case dwFormData8:
+					p += 8
+				case dwFormData16:
+					p += 16
+				case dwFormBlock:
+					n, next, err := readULEB(w.data, p)
+					if err != nil {
+						return 0, err
+					}
+					p = next + int(n)
+				default:
+					return 0, fmt.Errorf("unsupported form %#x in line table header", fm.form)
+				}
+				if p > limit {
+					return 0, errLineTruncated
+				}
+				w.out.Write(w.data[start:p])
+			}
+		}
+	}
+	return p, nil
+}
+
+// relocate returns the contents of the relocation section r with the
+// offsets moved along with the rewritten line table.
+func (w *linePathRewriter) relocate(r *Section) ([]byte, error) {
+	relocs, err := w.f.Relocs(r)
+	if err != nil {
+		return nil, err
+	}
+	rd, err := r.Data()
+	if err != nil {
+		return nil, err
+	}
+	entsize, offSize := w.f.relocEntrySize(r)
+	bo := w.f.ByteOrder
+	for i, rel := range relocs {
+		if offSize == 8 {
+			bo.PutUint64(rd[i*entsize:], w.moved(rel.Off))
+		} else {
+			bo.PutUint32(rd[i*entsize:], uint32(w.moved(rel.Off)))
+		}
+	}
+	return rd, nil
+}
+
+// moved returns the offset in the rewritten line table of the byte at off
+// in the original one.
+func (w *linePathRewriter) moved(off uint64) uint64 {
+	moved := int64(off)
+	for _, e := range w.edits {
+		if uint64(e.end) <= off {
+			moved += int64(e.delta)
+		}
+	}
+	return uint64(moved)
+}
@@ -0,0 +1,133 @@
+package elf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// dynEntrySize returns the size of an entry of the dynamic section.
+func (f *File) dynEntrySize() int {
+	if f.Class == ELFCLASS32 {
+		return 8
+	}
+	return 16
+}
+
+// decodeDynTags returns the entries of the dynamic section contents d.
+func (f *File) decodeDynTags(d []byte) []DynTagValue {
+	n := f.dynEntrySize()
+	m := make([]DynTagValue, 0, len(d)/n)
+	for ; len(d) >= n; d = d[n:] {
+		var t DynTagValue
+		if n == 8 {
+			t = DynTagValue{Tag: DynTag(f.ByteOrder.Uint32(d)), Value: uint64(f.ByteOrder.Uint32(d[4:]))}
+		} else {
+			t = DynTagValue{Tag: DynTag(f.ByteOrder.Uint64(d)), Value: f.ByteOrder.Uint64(d[8:])}
+		}
+		m = append(m, t)
+	}
+	return m
+}
+
+// dynTagsBytes encodes DynTags as the contents of the dynamic section s,
+// padding with DT_NULL entries to the size of the section.
+func (f *File) dynTagsBytes(s *Section) ([]byte, error) {
+	n := f.dynEntrySize()
+	if len(f.DynTags)*n > int(s.FileSize) {
+		return nil, fmt.Errorf("%d dynamic entries do not fit in %s of %d bytes", len(f.DynTags), s.Name, s.FileSize)
+	}
+	b := make([]byte, s.FileSize)
+	for i, t := range f.DynTags {
+		if n == 8 {
+			f.ByteOrder.PutUint32(b[i*n:], uint32(t.Tag))
+			f.ByteOrder.PutUint32(b[i*n+4:], uint32(t.Value))
+		} else {
+			f.ByteOrder.PutUint64(b[i*n:], uint64(t.Tag))
+			f.ByteOrder.PutUint64(b[i*n+8:], t.Value)
+		}
+	}
+	return b, nil
+}
+
+// dynEnd returns the index in DynTags of the DT_NULL entry that ends the
+// dynamic table, or len(DynTags) if there is none.
+func (f *File) dynEnd() int {
+	for i, t := range f.DynTags {
+		if t.Tag == DT_NULL {
+			return i
+		}
+	}
+	return len(f.DynTags)
+}
+
+// DynValue returns the values listed for the given tag in the file's
+// dynamic section, in order. Entries after the terminating DT_NULL are
+// ignored.
+func (f *File) DynValue(tag DynTag) []uint64 {
+	var vals []uint64
+	for _, t := range f.DynTags[:f.dynEnd()] {
+		if t.Tag == tag {
+			vals = append(vals, t.Value)
+		}
+	}
+	return vals
+}
+
+// setDynTable replaces the entries of the dynamic table with live,
+// followed by DT_NULL entries up to the room in the dynamic section.
+func (f *File) setDynTable(live []DynTagValue) error {
+	s := f.SectionByType(SHT_DYNAMIC)
+	if s == nil {
+		return errors.New("no dynamic section")
+	}
+	room := int(s.FileSize) / f.dynEntrySize()
+	if len(live)+1 > room {
+		return fmt.Errorf("%d dynamic entries and DT_NULL do not fit in %s of %d bytes", len(live), s.Name, s.FileSize)
+	}
+	m := make([]DynTagValue, room)
+	copy(m, live)
+	f.DynTags = m
+	return nil
+}
+
+// AddDynTag appends an entry to the dynamic table, before its
+// terminating DT_NULL. The dynamic section is not grown, so it must have
+// room for another entry.
+func (f *File) AddDynTag(tag DynTag, value uint64) error {
+	if tag == DT_NULL {
+		return fmt.Errorf("cannot add %v", tag)
+	}
+	live := append(f.DynTags[:f.dynEnd():f.dynEnd()], DynTagValue{Tag: tag, Value: value})
+	return f.setDynTable(live)
+}
+
+// SetDynTag sets the value of the first entry of the dynamic table with
+// the given tag, adding one with AddDynTag if there is none.
+func (f *File) SetDynTag(tag DynTag, value uint64) error {
+	for i, t := range f.DynTags[:f.dynEnd()] {
+		if t.Tag == tag {
+			f.DynTags[i].Value = value
+			return nil
+		}
+	}
+	return f.AddDynTag(tag, value)
+}
+
+// RemoveDynTag removes all entries with the given tag from the dynamic
+// table, keeping the order of the rest, and returns how many it removed.
+func (f *File) RemoveDynTag(tag DynTag) (int, error) {
+	if tag == DT_NULL {
+		return 0, fmt.Errorf("cannot remove %v", tag)
+	}
+	var live []DynTagValue
+	for _, t := range f.DynTags[:f.dynEnd()] {
+		if t.Tag != tag {
+			live = append(live, t)
+		}
+	}
+	n := f.dynEnd() - len(live)
+	if n == 0 {
+		return 0, nil
+	}
+	return n, f.setDynTable(live)
+}
@@ -0,0 +1,88 @@
+package elf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestDynTags32(t *testing.T) {
+	raw, err := ioutil.ReadFile("testdata/gcc-386-freebsd-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.DynTags) != 19 || f.DynTags[0] != (DynTagValue{DT_NEEDED, 1}) || f.DynTags[13].Tag != DT_NULL {
+		t.Errorf("DynTags = %v", f.DynTags)
+	}
+	if libs, err := f.ImportedLibraries(); err != nil || !reflect.DeepEqual(libs, []string{"libc.so.6"}) {
+		t.Errorf("ImportedLibraries() = %q, %v", libs, err)
+	}
+	if v := f.DynValue(DT_STRSZ); !reflect.DeepEqual(v, []uint64{187}) {
+		t.Errorf("DynValue(DT_STRSZ) = %v", v)
+	}
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := f.SectionByType(SHT_DYNAMIC)
+	if !bytes.Equal(b[d.Offset:d.Offset+d.FileSize], raw[d.Offset:d.Offset+d.FileSize]) {
+		t.Error("Bytes() changed the dynamic section")
+	}
+}
+
+func TestEditDynTags(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	libc := f.DynValue(DT_NEEDED)
+	if len(libc) != 1 {
+		t.Fatalf("DynValue(DT_NEEDED) = %v", libc)
+	}
+	n := len(f.DynTags)
+
+	// A second DT_NEEDED naming the same library, and DT_DEBUG moved to
+	// the end of the table.
+	if err := f.AddDynTag(DT_NEEDED, libc[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := f.RemoveDynTag(DT_DEBUG); got != 1 || err != nil {
+		t.Errorf("RemoveDynTag(DT_DEBUG) = %d, %v", got, err)
+	}
+	if err := f.SetDynTag(DT_DEBUG, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := append([]DynTagValue(nil), f.DynTags...)
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.DynTags) != n || !reflect.DeepEqual(g.DynTags, want) {
+		t.Errorf("DynTags = %v after writing, want %v", g.DynTags, want)
+	}
+	if libs, err := g.ImportedLibraries(); err != nil || !reflect.DeepEqual(libs, []string{"libc.so.6", "libc.so.6"}) {
+		t.Errorf("ImportedLibraries() = %q, %v", libs, err)
+	}
+	if e := g.dynEnd(); e == n || g.DynTags[e-1].Tag != DT_DEBUG {
+		t.Errorf("dynamic table ends with %v", g.DynTags[:e])
+	}
+
+	for {
+		if err := f.AddDynTag(DT_NEEDED, libc[0]); err != nil {
+			break
+		}
+	}
+	if e := f.dynEnd(); e != n-1 {
+		t.Errorf("AddDynTag stopped with %d entries before DT_NULL, want %d", e, n-1)
+	}
+}
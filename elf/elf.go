@@ -644,6 +644,7 @@ const (
 	SHT_GNU_VERSYM     SectionType = 0x6fffffff /* GNU version symbol table */
 	SHT_HIOS           SectionType = 0x6fffffff /* Last of OS specific semantics */
 	SHT_LOPROC         SectionType = 0x70000000 /* reserved range for processor */
+	SHT_ARM_EXIDX      SectionType = 0x70000001 /* ARM exception index table */
 	SHT_HIPROC         SectionType = 0x7fffffff /* specific section header types */
 	SHT_LOUSER         SectionType = 0x80000000 /* reserved range for application */
 	SHT_HIUSER         SectionType = 0xffffffff /* specific indexes */
@@ -675,6 +676,7 @@ var shtStrings = []intName{
 	{0x6ffffffe, "SHT_GNU_VERNEED"},
 	{0x6fffffff, "SHT_GNU_VERSYM"},
 	{0x70000000, "SHT_LOPROC"},
+	{0x70000001, "SHT_ARM_EXIDX"},
 	{0x7fffffff, "SHT_HIPROC"},
 	{0x80000000, "SHT_LOUSER"},
 	{0xffffffff, "SHT_HIUSER"},
@@ -745,18 +747,29 @@ func (i CompressionType) GoString() string { return stringName(uint32(i), compre
 type ProgType int
 
 const (
-	PT_NULL    ProgType = 0          /* Unused entry. */
-	PT_LOAD    ProgType = 1          /* Loadable segment. */
-	PT_DYNAMIC ProgType = 2          /* Dynamic linking information segment. */
-	PT_INTERP  ProgType = 3          /* Pathname of interpreter. */
-	PT_NOTE    ProgType = 4          /* Auxiliary information. */
-	PT_SHLIB   ProgType = 5          /* Reserved (not used). */
-	PT_PHDR    ProgType = 6          /* Location of program header itself. */
-	PT_TLS     ProgType = 7          /* Thread local storage segment */
-	PT_LOOS    ProgType = 0x60000000 /* First OS-specific. */
-	PT_HIOS    ProgType = 0x6fffffff /* Last OS-specific. */
-	PT_LOPROC  ProgType = 0x70000000 /* First processor-specific type. */
-	PT_HIPROC  ProgType = 0x7fffffff /* Last processor-specific type. */
+	PT_NULL    ProgType = 0 /* Unused entry. */
+	PT_LOAD    ProgType = 1 /* Loadable segment. */
+	PT_DYNAMIC ProgType = 2 /* Dynamic linking information segment. */
+	PT_INTERP  ProgType = 3 /* Pathname of interpreter. */
+	PT_NOTE    ProgType = 4 /* Auxiliary information. */
+	PT_SHLIB   ProgType = 5 /* Reserved (not used). */
+	PT_PHDR    ProgType = 6 /* Location of program header itself. */
+	PT_TLS     ProgType = 7 /* Thread local storage segment */
+
+	PT_LOOS ProgType = 0x60000000 /* First OS-specific. */
+
+	PT_GNU_EH_FRAME ProgType = 0x6474e550 /* Frame unwind information. */
+	PT_GNU_STACK    ProgType = 0x6474e551 /* Stack flags. */
+	PT_GNU_RELRO    ProgType = 0x6474e552 /* Read only after relocations. */
+	PT_GNU_PROPERTY ProgType = 0x6474e553 /* GNU program properties note. */
+
+	PT_HIOS ProgType = 0x6fffffff /* Last OS-specific. */
+
+	PT_LOPROC ProgType = 0x70000000 /* First processor-specific type. */
+
+	PT_ARM_EXIDX ProgType = 0x70000001 /* ARM exception unwind tables. */
+
+	PT_HIPROC ProgType = 0x7fffffff /* Last processor-specific type. */
 )
 
 var ptStrings = []intName{
@@ -769,8 +782,13 @@ var ptStrings = []intName{
 	{6, "PT_PHDR"},
 	{7, "PT_TLS"},
 	{0x60000000, "PT_LOOS"},
+	{0x6474e550, "PT_GNU_EH_FRAME"},
+	{0x6474e551, "PT_GNU_STACK"},
+	{0x6474e552, "PT_GNU_RELRO"},
+	{0x6474e553, "PT_GNU_PROPERTY"},
 	{0x6fffffff, "PT_HIOS"},
 	{0x70000000, "PT_LOPROC"},
+	{0x70000001, "PT_ARM_EXIDX"},
 	{0x7fffffff, "PT_HIPROC"},
 }
 
@@ -839,9 +857,15 @@ const (
 	   or none */
 	DT_PREINIT_ARRAY   DynTag = 32         /* Address of the array of pointers to pre-initialization functions. */
 	DT_PREINIT_ARRAYSZ DynTag = 33         /* Size in bytes of the array of pre-initialization functions. */
+	DT_RELRSZ          DynTag = 35         /* Size in bytes of the DT_RELR relocation table. */
+	DT_RELR            DynTag = 36         /* Address of the DT_RELR relative relocations. */
+	DT_RELRENT         DynTag = 37         /* Size in bytes of a DT_RELR entry. */
 	DT_LOOS            DynTag = 0x6000000d /* First OS-specific */
 	DT_HIOS            DynTag = 0x6ffff000 /* Last OS-specific */
+	DT_GNU_HASH        DynTag = 0x6ffffef5 /* Address of the GNU symbol hash table. */
 	DT_VERSYM          DynTag = 0x6ffffff0
+	DT_VERDEF          DynTag = 0x6ffffffc /* Address of the version definitions. */
+	DT_VERDEFNUM       DynTag = 0x6ffffffd /* Number of version definitions. */
 	DT_VERNEED         DynTag = 0x6ffffffe
 	DT_VERNEEDNUM      DynTag = 0x6fffffff
 	DT_LOPROC          DynTag = 0x70000000 /* First processor-specific type. */
@@ -883,9 +907,15 @@ var dtStrings = []intName{
 	{32, "DT_ENCODING"},
 	{32, "DT_PREINIT_ARRAY"},
 	{33, "DT_PREINIT_ARRAYSZ"},
+	{35, "DT_RELRSZ"},
+	{36, "DT_RELR"},
+	{37, "DT_RELRENT"},
 	{0x6000000d, "DT_LOOS"},
 	{0x6ffff000, "DT_HIOS"},
+	{0x6ffffef5, "DT_GNU_HASH"},
 	{0x6ffffff0, "DT_VERSYM"},
+	{0x6ffffffc, "DT_VERDEF"},
+	{0x6ffffffd, "DT_VERDEFNUM"},
 	{0x6ffffffe, "DT_VERNEED"},
 	{0x6fffffff, "DT_VERNEEDNUM"},
 	{0x70000000, "DT_LOPROC"},
@@ -2430,6 +2460,7 @@ const (
 	R_RISCV_SET16         R_RISCV = 55 /* Local label subtraction */
 	R_RISCV_SET32         R_RISCV = 56 /* Local label subtraction */
 	R_RISCV_32_PCREL      R_RISCV = 57 /* 32-bit PC relative */
+	R_RISCV_IRELATIVE     R_RISCV = 58 /* Relocation against a non-preemptible ifunc symbol */
 )
 
 var rriscvStrings = []intName{
@@ -2487,6 +2518,7 @@ var rriscvStrings = []intName{
 	{55, "R_RISCV_SET16"},
 	{56, "R_RISCV_SET32"},
 	{57, "R_RISCV_32_PCREL"},
+	{58, "R_RISCV_IRELATIVE"},
 }
 
 func (i R_RISCV) String() string   { return stringName(uint32(i), rriscvStrings, false) }
@@ -2750,6 +2782,30 @@ var rsparcStrings = []intName{
 func (i R_SPARC) String() string   { return stringName(uint32(i), rsparcStrings, false) }
 func (i R_SPARC) GoString() string { return stringName(uint32(i), rsparcStrings, true) }
 
+// Relocation types for BPF.
+type R_BPF int
+
+const (
+	R_BPF_NONE        R_BPF = 0
+	R_BPF_64_64       R_BPF = 1
+	R_BPF_64_ABS64    R_BPF = 2
+	R_BPF_64_ABS32    R_BPF = 3
+	R_BPF_64_NODYLD32 R_BPF = 4
+	R_BPF_64_32       R_BPF = 10
+)
+
+var rbpfStrings = []intName{
+	{0, "R_BPF_NONE"},
+	{1, "R_BPF_64_64"},
+	{2, "R_BPF_64_ABS64"},
+	{3, "R_BPF_64_ABS32"},
+	{4, "R_BPF_64_NODYLD32"},
+	{10, "R_BPF_64_32"},
+}
+
+func (i R_BPF) String() string   { return stringName(uint32(i), rbpfStrings, false) }
+func (i R_BPF) GoString() string { return stringName(uint32(i), rbpfStrings, true) }
+
 // Magic number for the elf trampoline, chosen wisely to be an immediate value.
 const ARM_MAGIC_TRAMP_NUMBER = 0x5c000003
 
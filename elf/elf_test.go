@@ -22,6 +22,7 @@ var nameTests = []nameTest{
 	{SHT_PROGBITS, "SHT_PROGBITS"},
 	{SHF_MERGE + SHF_TLS, "SHF_MERGE+SHF_TLS"},
 	{PT_LOAD, "PT_LOAD"},
+	{PT_ARM_EXIDX, "PT_ARM_EXIDX"},
 	{PF_W + PF_R + 0x50, "PF_W+PF_R+0x50"},
 	{DT_SYMBOLIC, "DT_SYMBOLIC"},
 	{DF_BIND_NOW, "DF_BIND_NOW"},
@@ -35,6 +36,7 @@ var nameTests = []nameTest{
 	{R_386_GOT32, "R_386_GOT32"},
 	{R_PPC_GOT16_HI, "R_PPC_GOT16_HI"},
 	{R_SPARC_GOT22, "R_SPARC_GOT22"},
+	{R_BPF_64_64, "R_BPF_64_64"},
 	{ET_LOOS + 5, "ET_LOOS+5"},
 	{ProgFlag(0x50), "0x50"},
 }
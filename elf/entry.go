@@ -0,0 +1,49 @@
+package elf
+
+import (
+	"fmt"
+	"math"
+)
+
+// EntrySegment returns the executable PT_LOAD segment that contains the
+// entry point, or nil if there is none.
+func (f *File) EntrySegment() *Prog {
+	return f.execProgFor(f.Entry)
+}
+
+// SetEntry sets the entry point to addr, which must lie in the file-backed
+// part of an executable PT_LOAD segment, and returns the previous entry
+// point so that code at addr can jump back to it.
+func (f *File) SetEntry(addr uint64) (old uint64, err error) {
+	if f.Type != ET_EXEC && f.Type != ET_DYN {
+		return f.Entry, fmt.Errorf("cannot set the entry point of a %v file", f.Type)
+	}
+	if f.execProgFor(addr) == nil {
+		return f.Entry, fmt.Errorf("entry point %#x is not in an executable segment", addr)
+	}
+	old, f.Entry = f.Entry, addr
+	return old, nil
+}
+
+// execProgFor returns the executable PT_LOAD segment whose file contents
+// are mapped at addr.
+func (f *File) execProgFor(addr uint64) *Prog {
+	for _, p := range f.Progs {
+		if p.Type == PT_LOAD && p.Flags&PF_X != 0 && p.Vaddr <= addr && addr-p.Vaddr < p.Filesz {
+			return p
+		}
+	}
+	return nil
+}
+
+// JumpDisplacement returns the displacement of a PC-relative jump or call
+// instruction of insnLen bytes at address from that transfers control to
+// to, as encoded by the rel32 forms of x86 jmp and call. It fails if the
+// displacement does not fit in 32 bits.
+func JumpDisplacement(from, to, insnLen uint64) (int32, error) {
+	d := int64(to - (from + insnLen))
+	if d < math.MinInt32 || d > math.MaxInt32 {
+		return 0, fmt.Errorf("jump from %#x to %#x is out of the range of a 32-bit displacement", from, to)
+	}
+	return int32(d), nil
+}
@@ -0,0 +1,94 @@
+package elf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSetEntry(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	p := f.EntrySegment()
+	if p == nil || p.Flags&PF_X == 0 || f.Entry < p.Vaddr || f.Entry >= p.Vaddr+p.Filesz {
+		t.Fatalf("EntrySegment() = %+v for entry point %#x", p, f.Entry)
+	}
+
+	syms, err := f.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var main, data uint64
+	for _, s := range syms {
+		switch s.Name {
+		case "main":
+			main = s.Value
+		case "__data_start", "data_start":
+			data = s.Value
+		}
+	}
+	if main == 0 || data == 0 {
+		t.Fatal("main or data_start not found")
+	}
+
+	entry := f.Entry
+	if _, err := f.SetEntry(data); err == nil {
+		t.Errorf("SetEntry accepted %#x in a data segment", data)
+	}
+	if _, err := f.SetEntry(p.Vaddr + p.Memsz + 0x100000); err == nil {
+		t.Error("SetEntry accepted an unmapped address")
+	}
+	if f.Entry != entry {
+		t.Fatalf("failed SetEntry changed the entry point to %#x", f.Entry)
+	}
+
+	old, err := f.SetEntry(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old != entry {
+		t.Errorf("SetEntry returned old entry point %#x, want %#x", old, entry)
+	}
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Entry != main {
+		t.Errorf("entry point is %#x after writing, want %#x", g.Entry, main)
+	}
+
+	rel, err := Open("testdata/gcc-amd64-openbsd-debug-with-rela.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rel.Close()
+	if _, err := rel.SetEntry(0); err == nil {
+		t.Error("SetEntry accepted a relocatable object")
+	}
+}
+
+func TestJumpDisplacement(t *testing.T) {
+	for _, tt := range []struct {
+		from, to, n uint64
+		want        int32
+		ok          bool
+	}{
+		{0x401000, 0x401000, 5, -5, true},
+		{0x401000, 0x400000, 5, -0x1005, true},
+		{0x400000, 0x401005, 5, 0x1000, true},
+		{0x400000, 0x80400005, 5, 0, false},
+		{0x80400000, 0x400000, 5, 0, false},
+	} {
+		got, err := JumpDisplacement(tt.from, tt.to, tt.n)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("JumpDisplacement(%#x, %#x, %d) = %#x, %v", tt.from, tt.to, tt.n, got, err)
+		}
+	}
+}
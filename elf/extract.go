@@ -0,0 +1,133 @@
+package elf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// An ExtractedFunction is a function copied out of a file by
+// ExtractFunction, along with the relocations that apply to it.
+type ExtractedFunction struct {
+	Name string
+	Code []byte
+
+	// Relocs are the relocations that apply to Code, in the 64-bit form
+	// whatever the class of the file. Their offsets are relative to the
+	// start of Code, and their symbol indices select from Symbols,
+	// counting from 1 as in a symbol table with a null symbol; 0 stands
+	// for no symbol, as in R_X86_64_RELATIVE.
+	Relocs []Rela64
+
+	// Rela reports whether the relocations have explicit addends. If
+	// they were read from SHT_REL sections, their addends are in Code
+	// and those of Relocs are zero.
+	Rela bool
+
+	// Symbols are the symbols the relocations refer to, in the order of
+	// their first use, as they are in the file the function was
+	// extracted from. Their Section is that of the original file.
+	Symbols []Symbol
+}
+
+// ExtractFunction returns the code of the function symbol name with the
+// relocations that apply to it and the symbols they refer to, so that it
+// can be copied into another file. In object files these are the
+// relocations of the function's section; in linked images they are the
+// dynamic relocations, which only apply to code that was not linked
+// position independent.
+func (f *File) ExtractFunction(name string) (*ExtractedFunction, error) {
+	syms, err := f.Symbols()
+	if err != nil && err != ErrNoSymbols {
+		return nil, err
+	}
+	var fn *Symbol
+	for i := range syms {
+		sym := &syms[i]
+		if sym.Name == name && ST_TYPE(sym.Info) == STT_FUNC && sym.Section != SHN_UNDEF && sym.Section < SHN_LORESERVE {
+			fn = sym
+			break
+		}
+	}
+	if fn == nil {
+		return nil, fmt.Errorf("no function %s", name)
+	}
+	if int(fn.Section) >= len(f.Sections) {
+		return nil, fmt.Errorf("function %s is in section %d of %d", name, fn.Section, len(f.Sections))
+	}
+	s := f.Sections[fn.Section]
+	if s.Type == SHT_NOBITS {
+		return nil, fmt.Errorf("function %s is in section %s, which has no contents", name, s.Name)
+	}
+
+	// Relocations of object files hold offsets in the section, and those
+	// of linked images virtual addresses.
+	start := fn.Value
+	if f.Type != ET_REL {
+		start -= s.Addr
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	if start+fn.Size > uint64(len(data)) || start+fn.Size < start {
+		return nil, fmt.Errorf("function %s lies outside of section %s", name, s.Name)
+	}
+	lo := fn.Value
+	hi := lo + fn.Size
+	out := &ExtractedFunction{Name: name, Code: append([]byte(nil), data[start:start+fn.Size]...)}
+
+	symIdx := make(map[[2]int]uint32) // symbol table section and index to index in Symbols
+	sawRel, sawRela := false, false
+	for _, r := range f.Sections {
+		if r.Type != SHT_REL && r.Type != SHT_RELA {
+			continue
+		}
+		if f.Type == ET_REL && r.Info != uint32(fn.Section) || f.Type != ET_REL && r.Flags&SHF_ALLOC == 0 {
+			continue
+		}
+		if int(r.Link) >= len(f.Sections) {
+			return nil, fmt.Errorf("relocation section %s links to section %d of %d", r.Name, r.Link, len(f.Sections))
+		}
+		symtab, _, err := f.getSymbols(f.Sections[r.Link].Type)
+		if err != nil && err != ErrNoSymbols {
+			return nil, err
+		}
+		relocs, err := f.Relocs(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range relocs {
+			rel := Rela64{Off: e.Off, Addend: e.Addend}
+			sym, typ := e.Sym, e.Type
+			if rel.Off < lo || rel.Off >= hi {
+				continue
+			}
+			if r.Type == SHT_RELA {
+				sawRela = true
+			} else {
+				sawRel = true
+			}
+			rel.Off -= lo
+			if sym != 0 {
+				if int(sym) > len(symtab) {
+					return nil, fmt.Errorf("relocation at %#x refers to symbol %d of %d", lo+rel.Off, sym, len(symtab))
+				}
+				key := [2]int{int(r.Link), int(sym)}
+				idx, ok := symIdx[key]
+				if !ok {
+					out.Symbols = append(out.Symbols, symtab[sym-1])
+					idx = uint32(len(out.Symbols))
+					symIdx[key] = idx
+				}
+				sym = idx
+			}
+			rel.Info = R_INFO(sym, typ)
+			out.Relocs = append(out.Relocs, rel)
+		}
+	}
+	if sawRel && sawRela {
+		return nil, errors.New("function has relocations both with and without addends")
+	}
+	out.Rela = sawRela
+	return out, nil
+}
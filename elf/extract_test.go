@@ -0,0 +1,78 @@
+package elf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractFunction(t *testing.T) {
+	for _, c := range []struct {
+		file   string
+		rela   bool
+		relocs []Rela64
+		syms   []string
+	}{
+		{
+			"testdata/compressed-64.obj", true,
+			[]Rela64{
+				{Off: 0x10, Info: R_INFO(1, uint32(R_X86_64_32))},
+				{Off: 0x15, Info: R_INFO(2, uint32(R_X86_64_PC32)), Addend: -4},
+			},
+			[]string{"", "puts"},
+		},
+		{
+			"testdata/compressed-32.obj", false,
+			[]Rela64{
+				{Off: 0xc, Info: R_INFO(1, uint32(R_386_32))},
+				{Off: 0x11, Info: R_INFO(2, uint32(R_386_PC32))},
+			},
+			[]string{"", "puts"},
+		},
+	} {
+		f, err := Open(c.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		fn, err := f.ExtractFunction("main")
+		if err != nil {
+			t.Fatalf("%s: %v", c.file, err)
+		}
+		if fn.Rela != c.rela || !reflect.DeepEqual(fn.Relocs, c.relocs) {
+			t.Errorf("%s: relocations are %+v (rela %v), want %+v (rela %v)", c.file, fn.Relocs, fn.Rela, c.relocs, c.rela)
+		}
+		var names []string
+		for _, sym := range fn.Symbols {
+			names = append(names, sym.Name)
+		}
+		if !reflect.DeepEqual(names, c.syms) {
+			t.Errorf("%s: symbols are %q, want %q", c.file, names, c.syms)
+		}
+		if rodata := f.Section(".rodata"); len(fn.Symbols) == 0 || ST_TYPE(fn.Symbols[0].Info) != STT_SECTION || f.Sections[fn.Symbols[0].Section] != rodata {
+			t.Errorf("%s: first symbol is not that of .rodata", c.file)
+		}
+		text, err := f.Section(".text").Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(fn.Code, text[:len(fn.Code)]) {
+			t.Errorf("%s: code is %x, want the start of .text", c.file, fn.Code)
+		}
+	}
+
+	f, err := Open("testdata/go-relocation-test-gcc441-x86-64.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fn, err := f.ExtractFunction("f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x55, 0x48, 0x89, 0xe5, 0xc9, 0xc3}; !reflect.DeepEqual(fn.Code, want) || len(fn.Relocs) != 0 || len(fn.Symbols) != 0 {
+		t.Errorf("f is %+v, want %x without relocations", fn, want)
+	}
+	if _, err := f.ExtractFunction(".text"); err == nil {
+		t.Error("ExtractFunction accepted a section symbol")
+	}
+}
@@ -6,7 +6,6 @@
 package elf
 
 import (
-	"bytes"
 	"compress/zlib"
 	"debug/dwarf"
 	"encoding/binary"
@@ -14,7 +13,8 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strings"
+
+	"github.com/Binject/debug/internal/readerat"
 )
 
 // seekStart, seekCurrent, seekEnd are copies of
@@ -60,7 +60,30 @@ type File struct {
 	Insertion    []byte
 	InsertionEOF []byte
 
+	// DynTags holds the entries of the dynamic section in file order,
+	// including repeated tags such as DT_NEEDED and the DT_NULL entries
+	// that end the table. Bytes writes them back as the section contents.
 	DynTags []DynTagValue
+
+	// PreserveRaw makes Bytes start from the bytes the file was read
+	// from instead of rebuilding it from the parsed structures, so that
+	// data no section claims survives. Set it before editing the file.
+	PreserveRaw bool
+
+	// Workers limits the number of goroutines that decode large symbol
+	// tables and relocation sections. Zero means runtime.GOMAXPROCS(0),
+	// and 1 decodes them serially.
+	Workers int
+
+	raw     io.ReaderAt // the reader the file was parsed from
+	rawSize int64       // size of raw, or -1 if not known yet
+	phoff   int64       // e_phoff as read
+	phnum   int         // e_phnum as read
+
+	armLayout map[*Section]uint64      // section addresses .ARM.exidx refers to
+	symIndex  *SymbolIndex             // built by SymbolIndex
+	progsOnly bool                     // Sections were synthesized by NewFileProgsOnly
+	edits     map[*Section]sectionEdit // section contents patched by WriteVirtual
 }
 
 // A SectionHeader represents a single ELF section header.
@@ -105,15 +128,14 @@ type Section struct {
 
 	compressionType   CompressionType
 	compressionOffset int64
+	fileAddralign     uint64 // sh_addralign of the compressed section
 }
 
 // Data reads and returns the contents of the ELF section.
 // Even if the section is stored compressed in the ELF file,
 // Data returns uncompressed data.
 func (s *Section) Data() ([]byte, error) {
-	dat := make([]byte, s.Size)
-	n, err := io.ReadFull(s.Open(), dat)
-	return dat[0:n], err
+	return readerat.ReadData(s.Open(), s.Size)
 }
 
 // stringTable reads and returns the string table given by the
@@ -145,6 +167,19 @@ func (s *Section) Open() io.ReadSeeker {
 	return errorReader{err}
 }
 
+// Replace Section's Data with the contents of reader. The section's Size
+// and FileSize are set to length.
+func (s *Section) Replace(reader io.ReaderAt, length int64) {
+	s.sr = io.NewSectionReader(reader, 0, length)
+	s.ReaderAt = s.sr
+	s.Flags &^= SHF_COMPRESSED
+	s.compressionType = 0
+	s.compressionOffset = 0
+	s.fileAddralign = 0
+	s.Size = uint64(length)
+	s.FileSize = uint64(length)
+}
+
 // A ProgHeader represents a single ELF program header.
 type ProgHeader struct {
 	Type   ProgType
@@ -174,6 +209,14 @@ type Prog struct {
 // Open returns a new ReadSeeker reading the ELF program body.
 func (p *Prog) Open() io.ReadSeeker { return io.NewSectionReader(p.sr, 0, 1<<63-1) }
 
+// Replace the program body with the contents of reader. Filesz is set to
+// length; Memsz is left for the caller to adjust.
+func (p *Prog) Replace(reader io.ReaderAt, length int64) {
+	p.sr = io.NewSectionReader(reader, 0, length)
+	p.ReaderAt = p.sr
+	p.Filesz = uint64(length)
+}
+
 // A Symbol represents an entry in an ELF symbol table section.
 type Symbol struct {
 	Name        string
@@ -279,6 +322,10 @@ func (f *File) SectionByName(name string) *Section {
 // NewFile creates a new File for accessing an ELF binary in an underlying reader.
 // The ELF binary is expected to start at position 0 in the ReaderAt.
 func NewFile(r io.ReaderAt) (*File, error) {
+	return newFile(r, false)
+}
+
+func newFile(r io.ReaderAt, progsOnly bool) (*File, error) {
 	sr := io.NewSectionReader(r, 0, 1<<63-1)
 	// Read and decode ELF identifier
 	var ident [16]uint8
@@ -290,6 +337,8 @@ func NewFile(r io.ReaderAt) (*File, error) {
 	}
 
 	f := new(File)
+	f.raw = r
+	f.rawSize = -1
 	f.Class = Class(ident[EI_CLASS])
 	switch f.Class {
 	case ELFCLASS32:
@@ -363,11 +412,65 @@ func NewFile(r io.ReaderAt) (*File, error) {
 		f.ShStrIndex = int(hdr.Shstrndx)
 	}
 
-	if shnum > 0 && f.SHTOffset > 0 && (f.ShStrIndex < 0 || f.ShStrIndex >= shnum) {
+	if progsOnly {
+		f.SHTOffset, shnum, f.ShStrIndex = 0, 0, 0
+	}
+	if err := f.checkHeaderTables(phoff, phentsize, phnum, shentsize, shnum); err != nil {
+		return nil, err
+	}
+
+	// If the number of sections is greater than or equal to SHN_LORESERVE
+	// (0xff00), shnum has the value zero and the actual number of section
+	// header table entries is contained in the sh_size field of the section
+	// header at index 0.
+	if f.SHTOffset > 0 && shnum == 0 {
+		var typ, link uint32
+		sr.Seek(f.SHTOffset, seekStart)
+		switch f.Class {
+		case ELFCLASS32:
+			sh := new(Section32)
+			if err := binary.Read(sr, f.ByteOrder, sh); err != nil {
+				return nil, err
+			}
+			shnum = int(sh.Size)
+			typ = sh.Type
+			link = sh.Link
+		case ELFCLASS64:
+			sh := new(Section64)
+			if err := binary.Read(sr, f.ByteOrder, sh); err != nil {
+				return nil, err
+			}
+			shnum = int(sh.Size)
+			typ = sh.Type
+			link = sh.Link
+		}
+		if SectionType(typ) != SHT_NULL {
+			return nil, &FormatError{f.SHTOffset, "invalid type of the initial section", SectionType(typ)}
+		}
+		if shnum < int(SHN_LORESERVE) {
+			return nil, &FormatError{f.SHTOffset, "invalid ELF shnum contained in sh_size", shnum}
+		}
+		if err := f.checkTable(f.SHTOffset, shentsize, shnum, "section header table"); err != nil {
+			return nil, err
+		}
+
+		// Likewise, a section name string table index greater than or
+		// equal to SHN_LORESERVE is stored in the sh_link field of the
+		// section header at index 0, and shstrndx holds SHN_XINDEX.
+		if f.ShStrIndex == int(SHN_XINDEX) {
+			f.ShStrIndex = int(link)
+			if f.ShStrIndex < int(SHN_LORESERVE) {
+				return nil, &FormatError{f.SHTOffset, "invalid ELF shstrndx contained in sh_link", f.ShStrIndex}
+			}
+		}
+	}
+
+	if shnum > 0 && (f.ShStrIndex < 0 || f.ShStrIndex >= shnum) {
 		return nil, &FormatError{0, "invalid ELF shstrndx", f.ShStrIndex}
 	}
 
 	// Read program headers
+	f.phoff, f.phnum = phoff, phnum
 	f.Progs = make([]*Prog, phnum)
 	for i := 0; i < phnum; i++ {
 		off := phoff + int64(i)*int64(phentsize)
@@ -465,6 +568,7 @@ func NewFile(r io.ReaderAt) (*File, error) {
 			s.Size = s.FileSize
 		} else {
 			// Read the compression header.
+			s.fileAddralign = s.Addralign
 			switch f.Class {
 			case ELFCLASS32:
 				ch := new(Chdr32)
@@ -490,6 +594,16 @@ func NewFile(r io.ReaderAt) (*File, error) {
 		f.Sections[i] = s
 	}
 
+	if progsOnly {
+		if err := f.synthesizeSections(); err != nil {
+			return nil, err
+		}
+		if err := f.parseDynTags(); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+
 	if err := f.parseDynTags(); err != nil {
 		return nil, err
 	}
@@ -510,6 +624,7 @@ func NewFile(r io.ReaderAt) (*File, error) {
 			return nil, &FormatError{f.SHTOffset + int64(i*shentsize), "bad section name index", names[i]}
 		}
 	}
+	f.recordARMLayout()
 
 	return f, nil
 }
@@ -542,8 +657,7 @@ func (f *File) getSymbols32(typ SectionType) ([]Symbol, []byte, error) {
 	if err != nil {
 		return nil, nil, errors.New("cannot load symbol section")
 	}
-	symtab := bytes.NewReader(data)
-	if symtab.Len()%Sym32Size != 0 {
+	if len(data)%Sym32Size != 0 {
 		return nil, nil, errors.New("length of symbol section is not a multiple of SymSize")
 	}
 
@@ -553,25 +667,27 @@ func (f *File) getSymbols32(typ SectionType) ([]Symbol, []byte, error) {
 	}
 
 	// The first entry is all zeros.
-	var skip [Sym32Size]byte
-	symtab.Read(skip[:])
-
-	symbols := make([]Symbol, symtab.Len()/Sym32Size)
-
-	i := 0
-	var sym Sym32
-	for symtab.Len() > 0 {
-		binary.Read(symtab, f.ByteOrder, &sym)
-		str, _ := getString(strdata, int(sym.Name))
-		symbols[i].Name = str
-		symbols[i].Info = sym.Info
-		symbols[i].Other = sym.Other
-		symbols[i].Section = SectionIndex(sym.Shndx)
-		symbols[i].Value = uint64(sym.Value)
-		symbols[i].Size = uint64(sym.Size)
-		i++
+	if len(data) > 0 {
+		data = data[Sym32Size:]
 	}
 
+	symbols := make([]Symbol, len(data)/Sym32Size)
+	bo := f.ByteOrder
+	f.forEachChunk(len(symbols), func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			b := data[i*Sym32Size : (i+1)*Sym32Size]
+			sym := &symbols[i]
+			sym.NameIndex = bo.Uint32(b[0:])
+			sym.Name, _ = getString(strdata, int(sym.NameIndex))
+			sym.Value = uint64(bo.Uint32(b[4:]))
+			sym.Size = uint64(bo.Uint32(b[8:]))
+			sym.Info = b[12]
+			sym.Other = b[13]
+			sym.SectIndex = bo.Uint16(b[14:])
+			sym.Section = SectionIndex(sym.SectIndex)
+		}
+	})
+
 	return symbols, strdata, nil
 }
 
@@ -585,8 +701,7 @@ func (f *File) getSymbols64(typ SectionType) ([]Symbol, []byte, error) {
 	if err != nil {
 		return nil, nil, errors.New("cannot load symbol section")
 	}
-	symtab := bytes.NewReader(data)
-	if symtab.Len()%Sym64Size != 0 {
+	if len(data)%Sym64Size != 0 {
 		return nil, nil, errors.New("length of symbol section is not a multiple of Sym64Size")
 	}
 
@@ -596,27 +711,27 @@ func (f *File) getSymbols64(typ SectionType) ([]Symbol, []byte, error) {
 	}
 
 	// The first entry is all zeros.
-	var skip [Sym64Size]byte
-	symtab.Read(skip[:])
-
-	symbols := make([]Symbol, symtab.Len()/Sym64Size)
-
-	i := 0
-	var sym Sym64
-	for symtab.Len() > 0 {
-		binary.Read(symtab, f.ByteOrder, &sym)
-		str, _ := getString(strdata, int(sym.Name))
-		symbols[i].Name = str
-		symbols[i].NameIndex = sym.Name
-		symbols[i].Info = sym.Info
-		symbols[i].Other = sym.Other
-		symbols[i].Section = SectionIndex(sym.Shndx)
-		symbols[i].SectIndex = sym.Shndx
-		symbols[i].Value = sym.Value
-		symbols[i].Size = sym.Size
-		i++
+	if len(data) > 0 {
+		data = data[Sym64Size:]
 	}
 
+	symbols := make([]Symbol, len(data)/Sym64Size)
+	bo := f.ByteOrder
+	f.forEachChunk(len(symbols), func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			b := data[i*Sym64Size : (i+1)*Sym64Size]
+			sym := &symbols[i]
+			sym.NameIndex = bo.Uint32(b[0:])
+			sym.Name, _ = getString(strdata, int(sym.NameIndex))
+			sym.Info = b[4]
+			sym.Other = b[5]
+			sym.SectIndex = bo.Uint16(b[6:])
+			sym.Section = SectionIndex(sym.SectIndex)
+			sym.Value = bo.Uint64(b[8:])
+			sym.Size = bo.Uint64(b[16:])
+		}
+	})
+
 	return symbols, strdata, nil
 }
 
@@ -647,17 +762,6 @@ func (f *File) Section(name string) *Section {
 
 // DWARF - No idea what this does
 func (f *File) DWARF() (*dwarf.Data, error) {
-	dwarfSuffix := func(s *Section) string {
-		switch {
-		case strings.HasPrefix(s.Name, ".debug_"):
-			return s.Name[7:]
-		case strings.HasPrefix(s.Name, ".zdebug_"):
-			return s.Name[8:]
-		default:
-			return ""
-		}
-
-	}
 	// sectionData gets the data for s, checks its size, and
 	// applies any applicable relations.
 	sectionData := func(i int, s *Section) ([]byte, error) {
@@ -666,20 +770,9 @@ func (f *File) DWARF() (*dwarf.Data, error) {
 			return nil, err
 		}
 
-		if len(b) >= 12 && string(b[:4]) == "ZLIB" {
-			dlen := binary.BigEndian.Uint64(b[4:12])
-			dbuf := make([]byte, dlen)
-			r, err := zlib.NewReader(bytes.NewBuffer(b[12:]))
-			if err != nil {
-				return nil, err
-			}
-			if _, err := io.ReadFull(r, dbuf); err != nil {
-				return nil, err
-			}
-			if err := r.Close(); err != nil {
-				return nil, err
-			}
-			b = dbuf
+		b, err = zdebugData(b)
+		if err != nil {
+			return nil, err
 		}
 
 		for _, r := range f.Sections {
@@ -898,34 +991,11 @@ func (f *File) parseDynTags() error {
 		return nil // nothing to do
 	}
 
-	var m []DynTagValue
 	d, err := s.Data()
 	if err != nil {
 		return err
 	}
-	//fmt.Printf("%+v\nd: %x len(%d)\n", s, d, len(d))
-
-	r := bytes.NewBuffer(d)
-	for {
-		var t, v uint64
-		if err := binary.Read(r, f.ByteOrder, &t); err != nil {
-			if err == io.EOF {
-				break
-			} else if err != nil {
-				return err
-			}
-		}
-		if err := binary.Read(r, f.ByteOrder, &v); err != nil {
-			if err == io.EOF {
-				break
-			} else if err != nil {
-				return err
-			}
-		}
-		m = append(m, DynTagValue{Tag: DynTag(t), Value: v})
-		//fmt.Printf("%x -> %x\n", t, v)
-	}
-	f.DynTags = m
+	f.DynTags = f.decodeDynTags(d)
 	return nil
 }
 
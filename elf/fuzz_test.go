@@ -0,0 +1,50 @@
+//go:build go1.18
+// +build go1.18
+
+package elf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func FuzzNewFile(f *testing.F) {
+	names, _ := filepath.Glob("testdata/*")
+	for _, name := range names {
+		if filepath.Ext(name) == ".gz" || filepath.Ext(name) == ".c" {
+			continue
+		}
+		if data, err := ioutil.ReadFile(name); err == nil && len(data) < 1<<20 {
+			f.Add(data)
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ef, err := NewFile(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// None of these may panic, whatever the file holds.
+		for _, s := range ef.Sections {
+			s.Data()
+		}
+		ef.Symbols()
+		ef.DynamicSymbols()
+		ef.ImportedSymbols()
+		ef.ImportedLibraries()
+		ef.DWARF()
+
+		out, err := ef.Bytes()
+		if err != nil {
+			return
+		}
+		g, err := NewFile(bytes.NewReader(out))
+		if err != nil {
+			t.Fatalf("reading the bytes written: %v", err)
+		}
+		if len(g.Sections) != len(ef.Sections) || len(g.Progs) != len(ef.Progs) {
+			t.Fatalf("%d sections and %d segments written, %d and %d read back", len(ef.Sections), len(ef.Progs), len(g.Sections), len(g.Progs))
+		}
+	})
+}
@@ -0,0 +1,337 @@
+package elf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ntGNUPropertyType0 is the type of the "GNU" note that holds the program
+// properties, NT_GNU_PROPERTY_TYPE_0.
+const ntGNUPropertyType0 = 5
+
+// GNUProperty.Type
+type GNUPropertyType uint32
+
+const (
+	GNU_PROPERTY_STACK_SIZE            GNUPropertyType = 1          /* Stack size. */
+	GNU_PROPERTY_NO_COPY_ON_PROTECTED  GNUPropertyType = 2          /* No copy relocations on protected data. */
+	GNU_PROPERTY_1_NEEDED              GNUPropertyType = 0xb0008000 /* Features needed, ORed. */
+	GNU_PROPERTY_AARCH64_FEATURE_1_AND GNUPropertyType = 0xc0000000 /* AArch64 features, ANDed. */
+	GNU_PROPERTY_X86_FEATURE_1_AND     GNUPropertyType = 0xc0000002 /* x86 features, ANDed. */
+	GNU_PROPERTY_X86_FEATURE_2_NEEDED  GNUPropertyType = 0xc0008001 /* x86 features needed, ORed. */
+	GNU_PROPERTY_X86_ISA_1_NEEDED      GNUPropertyType = 0xc0008002 /* x86 ISA needed, ORed. */
+	GNU_PROPERTY_X86_FEATURE_2_USED    GNUPropertyType = 0xc0010001 /* x86 features used, ORed. */
+	GNU_PROPERTY_X86_ISA_1_USED        GNUPropertyType = 0xc0010002 /* x86 ISA used, ORed. */
+)
+
+var gnuPropertyStrings = []intName{
+	{1, "GNU_PROPERTY_STACK_SIZE"},
+	{2, "GNU_PROPERTY_NO_COPY_ON_PROTECTED"},
+	{0xb0008000, "GNU_PROPERTY_1_NEEDED"},
+	{0xc0000000, "GNU_PROPERTY_AARCH64_FEATURE_1_AND"},
+	{0xc0000002, "GNU_PROPERTY_X86_FEATURE_1_AND"},
+	{0xc0008001, "GNU_PROPERTY_X86_FEATURE_2_NEEDED"},
+	{0xc0008002, "GNU_PROPERTY_X86_ISA_1_NEEDED"},
+	{0xc0010001, "GNU_PROPERTY_X86_FEATURE_2_USED"},
+	{0xc0010002, "GNU_PROPERTY_X86_ISA_1_USED"},
+}
+
+func (i GNUPropertyType) String() string   { return stringName(uint32(i), gnuPropertyStrings, false) }
+func (i GNUPropertyType) GoString() string { return stringName(uint32(i), gnuPropertyStrings, true) }
+
+// GNU_PROPERTY_X86_FEATURE_1_AND values.
+type X86Feature1 uint32
+
+const (
+	GNU_PROPERTY_X86_FEATURE_1_IBT   X86Feature1 = 0x1 /* Indirect branch tracking. */
+	GNU_PROPERTY_X86_FEATURE_1_SHSTK X86Feature1 = 0x2 /* Shadow stack. */
+)
+
+var x86Feature1Strings = []intName{
+	{0x1, "GNU_PROPERTY_X86_FEATURE_1_IBT"},
+	{0x2, "GNU_PROPERTY_X86_FEATURE_1_SHSTK"},
+}
+
+func (i X86Feature1) String() string   { return flagName(uint32(i), x86Feature1Strings, false) }
+func (i X86Feature1) GoString() string { return flagName(uint32(i), x86Feature1Strings, true) }
+
+// GNU_PROPERTY_X86_ISA_1_NEEDED and GNU_PROPERTY_X86_ISA_1_USED values,
+// the x86-64 micro-architecture levels.
+type X86ISA1 uint32
+
+const (
+	GNU_PROPERTY_X86_ISA_1_BASELINE X86ISA1 = 0x1
+	GNU_PROPERTY_X86_ISA_1_V2       X86ISA1 = 0x2
+	GNU_PROPERTY_X86_ISA_1_V3       X86ISA1 = 0x4
+	GNU_PROPERTY_X86_ISA_1_V4       X86ISA1 = 0x8
+)
+
+var x86ISA1Strings = []intName{
+	{0x1, "GNU_PROPERTY_X86_ISA_1_BASELINE"},
+	{0x2, "GNU_PROPERTY_X86_ISA_1_V2"},
+	{0x4, "GNU_PROPERTY_X86_ISA_1_V3"},
+	{0x8, "GNU_PROPERTY_X86_ISA_1_V4"},
+}
+
+func (i X86ISA1) String() string   { return flagName(uint32(i), x86ISA1Strings, false) }
+func (i X86ISA1) GoString() string { return flagName(uint32(i), x86ISA1Strings, true) }
+
+// GNU_PROPERTY_AARCH64_FEATURE_1_AND values.
+type AArch64Feature1 uint32
+
+const (
+	GNU_PROPERTY_AARCH64_FEATURE_1_BTI AArch64Feature1 = 0x1 /* Branch target identification. */
+	GNU_PROPERTY_AARCH64_FEATURE_1_PAC AArch64Feature1 = 0x2 /* Pointer authentication. */
+)
+
+var aarch64Feature1Strings = []intName{
+	{0x1, "GNU_PROPERTY_AARCH64_FEATURE_1_BTI"},
+	{0x2, "GNU_PROPERTY_AARCH64_FEATURE_1_PAC"},
+}
+
+func (i AArch64Feature1) String() string   { return flagName(uint32(i), aarch64Feature1Strings, false) }
+func (i AArch64Feature1) GoString() string { return flagName(uint32(i), aarch64Feature1Strings, true) }
+
+// A GNUProperty is a program property of the .note.gnu.property note.
+// Data is in the byte order of the file, without padding.
+type GNUProperty struct {
+	Type GNUPropertyType
+	Data []byte
+}
+
+// GNUFeatures are the values of the GNU properties that flag the
+// hardware features and ISA levels a program is built for. A property
+// that is not present reads as zero.
+type GNUFeatures struct {
+	X86Feature1     X86Feature1
+	X86ISA1Needed   X86ISA1
+	X86ISA1Used     X86ISA1
+	AArch64Feature1 AArch64Feature1
+}
+
+// ErrNoGNUProperties is returned by File.SetGNUProperties for files
+// without a section holding a GNU property note.
+var ErrNoGNUProperties = errors.New("no GNU property note")
+
+// A gnuPropertyNote locates the GNU property note of a file: the section
+// holding it, or the PT_GNU_PROPERTY segment if there are no sections,
+// and the offsets of the note and of its descriptor there.
+type gnuPropertyNote struct {
+	sect       *Section
+	prog       *Prog
+	data       []byte
+	start, end int // the note in data
+	desc       int // the descriptor in data
+}
+
+// GNUProperties returns the program properties of f, read from the
+// NT_GNU_PROPERTY_TYPE_0 note of its .note.gnu.property section or its
+// PT_GNU_PROPERTY segment. It returns nil if f has no such note.
+func (f *File) GNUProperties() ([]GNUProperty, error) {
+	n, err := f.gnuPropertyNote()
+	if n == nil || err != nil {
+		return nil, err
+	}
+	bo := f.ByteOrder
+	align := f.gnuPropertyAlign()
+	var props []GNUProperty
+	for d := n.data[n.desc:n.end]; len(d) > 0; {
+		if len(d) < 8 {
+			return nil, fmt.Errorf("GNU property note: %v", errBadNote)
+		}
+		typ := GNUPropertyType(bo.Uint32(d))
+		size := uint64(bo.Uint32(d[4:]))
+		d = d[8:]
+		if size > uint64(len(d)) {
+			return nil, fmt.Errorf("GNU property %v of %d bytes is truncated", typ, size)
+		}
+		props = append(props, GNUProperty{Type: typ, Data: append([]byte(nil), d[:size]...)})
+		next := alignUp(size, align)
+		if next > uint64(len(d)) {
+			next = uint64(len(d))
+		}
+		d = d[next:]
+	}
+	return props, nil
+}
+
+// GNUFeatures returns the x86 and AArch64 feature properties of f.
+func (f *File) GNUFeatures() (*GNUFeatures, error) {
+	props, err := f.GNUProperties()
+	if err != nil {
+		return nil, err
+	}
+	var feat GNUFeatures
+	for _, p := range props {
+		if len(p.Data) != 4 {
+			continue
+		}
+		v := f.ByteOrder.Uint32(p.Data)
+		switch {
+		case p.Type == GNU_PROPERTY_X86_FEATURE_1_AND && f.isX86():
+			feat.X86Feature1 = X86Feature1(v)
+		case p.Type == GNU_PROPERTY_X86_ISA_1_NEEDED && f.isX86():
+			feat.X86ISA1Needed = X86ISA1(v)
+		case p.Type == GNU_PROPERTY_X86_ISA_1_USED && f.isX86():
+			feat.X86ISA1Used = X86ISA1(v)
+		case p.Type == GNU_PROPERTY_AARCH64_FEATURE_1_AND && f.Machine == EM_AARCH64:
+			feat.AArch64Feature1 = AArch64Feature1(v)
+		}
+	}
+	return &feat, nil
+}
+
+// SetGNUProperties replaces the properties of the GNU property note of f
+// with props, sorted by type as the linkers require. The section holding
+// the note is resized with ResizeSection, and the PT_GNU_PROPERTY segment
+// follows the note. Other notes of the section are kept.
+//
+// An injected payload that does not use BTI or IBT landing pads needs the
+// matching feature bits cleared from the file it is added to, for the
+// kernel not to enforce them; see SetGNUPropertyFlags.
+func (f *File) SetGNUProperties(props []GNUProperty) error {
+	n, err := f.gnuPropertyNote()
+	if err != nil {
+		return err
+	}
+	if n == nil || n.sect == nil {
+		return ErrNoGNUProperties
+	}
+	props = append([]GNUProperty(nil), props...)
+	sort.SliceStable(props, func(i, j int) bool { return props[i].Type < props[j].Type })
+
+	bo := f.ByteOrder
+	align := f.gnuPropertyAlign()
+	var desc []byte
+	for _, p := range props {
+		var hdr [8]byte
+		bo.PutUint32(hdr[0:], uint32(p.Type))
+		bo.PutUint32(hdr[4:], uint32(len(p.Data)))
+		desc = append(desc, hdr[:]...)
+		desc = append(desc, p.Data...)
+		desc = append(desc, make([]byte, alignUp(uint64(len(p.Data)), align)-uint64(len(p.Data)))...)
+	}
+	var note bytes.Buffer
+	var hdr [12]byte
+	bo.PutUint32(hdr[0:], 4)
+	bo.PutUint32(hdr[4:], uint32(len(desc)))
+	bo.PutUint32(hdr[8:], ntGNUPropertyType0)
+	note.Write(hdr[:])
+	note.WriteString("GNU\x00")
+	note.Write(desc)
+
+	data := make([]byte, 0, len(n.data)-(n.end-n.start)+note.Len())
+	data = append(data, n.data[:n.start]...)
+	data = append(data, note.Bytes()...)
+	data = append(data, n.data[n.end:]...)
+	if err := f.ResizeSection(n.sect.Name, data); err != nil {
+		return err
+	}
+	for _, p := range f.Progs {
+		if p.Type == PT_GNU_PROPERTY {
+			p.Off = n.sect.Offset + uint64(n.start)
+			p.Vaddr = n.sect.Addr + uint64(n.start)
+			p.Paddr = p.Vaddr
+			p.Filesz = uint64(note.Len())
+			p.Memsz = p.Filesz
+		}
+	}
+	return nil
+}
+
+// SetGNUPropertyFlags sets the 4-byte property typ, such as
+// GNU_PROPERTY_AARCH64_FEATURE_1_AND, to flags, adding it if f does not
+// have it, and keeps the other properties. Clearing the BTI bit of an
+// AArch64 file is
+//
+//	feat, _ := f.GNUFeatures()
+//	f.SetGNUPropertyFlags(elf.GNU_PROPERTY_AARCH64_FEATURE_1_AND,
+//		uint32(feat.AArch64Feature1&^elf.GNU_PROPERTY_AARCH64_FEATURE_1_BTI))
+func (f *File) SetGNUPropertyFlags(typ GNUPropertyType, flags uint32) error {
+	props, err := f.GNUProperties()
+	if err != nil {
+		return err
+	}
+	data := make([]byte, 4)
+	f.ByteOrder.PutUint32(data, flags)
+	found := false
+	for i := range props {
+		if props[i].Type == typ {
+			props[i].Data = data
+			found = true
+		}
+	}
+	if !found {
+		props = append(props, GNUProperty{Type: typ, Data: data})
+	}
+	return f.SetGNUProperties(props)
+}
+
+// gnuPropertyNote finds the GNU property note of f, or returns nil.
+func (f *File) gnuPropertyNote() (*gnuPropertyNote, error) {
+	for _, s := range f.Sections {
+		if s.Type != SHT_NOTE {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return nil, err
+		}
+		n, err := f.findGNUPropertyNote(data, s.Addralign)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", s.Name, err)
+		}
+		if n != nil {
+			n.sect = s
+			return n, nil
+		}
+	}
+	for _, p := range f.Progs {
+		if p.Type != PT_GNU_PROPERTY {
+			continue
+		}
+		data := make([]byte, p.Filesz)
+		if _, err := p.ReadAt(data, 0); err != nil {
+			return nil, err
+		}
+		n, err := f.findGNUPropertyNote(data, p.Align)
+		if err != nil {
+			return nil, fmt.Errorf("PT_GNU_PROPERTY: %v", err)
+		}
+		if n != nil {
+			n.prog = p
+			return n, nil
+		}
+	}
+	return nil, nil
+}
+
+// findGNUPropertyNote returns the NT_GNU_PROPERTY_TYPE_0 note of the
+// note contents data, or nil.
+func (f *File) findGNUPropertyNote(data []byte, align uint64) (*gnuPropertyNote, error) {
+	var found *gnuPropertyNote
+	err := forEachNote(data, f.ByteOrder, align, func(n *note) bool {
+		if n.typ == ntGNUPropertyType0 && string(n.name) == "GNU\x00" {
+			found = &gnuPropertyNote{data: data, start: int(n.off), end: int(n.doff) + len(n.desc), desc: int(n.doff)}
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// gnuPropertyAlign returns the alignment of the properties of a GNU
+// property note, which is that of an address.
+func (f *File) gnuPropertyAlign() uint64 {
+	if f.Class == ELFCLASS32 {
+		return 4
+	}
+	return 8
+}
+
+func (f *File) isX86() bool { return f.Machine == EM_X86_64 || f.Machine == EM_386 }
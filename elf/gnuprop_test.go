@@ -0,0 +1,159 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// gnuPropertyFile returns testdata/gcc-amd64-linux-exec with its
+// .note.ABI-tag turned into a GNU property note flagging IBT and SHSTK,
+// and the PT_NOTE segment covering it into PT_GNU_PROPERTY.
+func gnuPropertyFile(t *testing.T) *File {
+	f, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	le := binary.LittleEndian
+	note := make([]byte, 32)
+	le.PutUint32(note[0:], 4)
+	le.PutUint32(note[4:], 16)
+	le.PutUint32(note[8:], ntGNUPropertyType0)
+	copy(note[12:], "GNU\x00")
+	le.PutUint32(note[16:], uint32(GNU_PROPERTY_X86_FEATURE_1_AND))
+	le.PutUint32(note[20:], 4)
+	le.PutUint32(note[24:], uint32(GNU_PROPERTY_X86_FEATURE_1_IBT|GNU_PROPERTY_X86_FEATURE_1_SHSTK))
+	f.Section(".note.ABI-tag").Replace(bytes.NewReader(note), int64(len(note)))
+	for _, p := range f.Progs {
+		if p.Type == PT_NOTE {
+			p.Type = PT_GNU_PROPERTY
+		}
+	}
+	return f
+}
+
+func reparseGNUProperties(t *testing.T, f *File) *File {
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f2
+}
+
+func TestGNUProperties(t *testing.T) {
+	f := gnuPropertyFile(t)
+	props, err := f.GNUProperties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(props) != 1 || props[0].Type != GNU_PROPERTY_X86_FEATURE_1_AND || len(props[0].Data) != 4 {
+		t.Fatalf("properties are %+v", props)
+	}
+	feat, err := f.GNUFeatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := GNU_PROPERTY_X86_FEATURE_1_IBT | GNU_PROPERTY_X86_FEATURE_1_SHSTK; feat.X86Feature1 != want || feat.AArch64Feature1 != 0 {
+		t.Errorf("features are %+v", feat)
+	}
+	if s := feat.X86Feature1.String(); s != "GNU_PROPERTY_X86_FEATURE_1_IBT+GNU_PROPERTY_X86_FEATURE_1_SHSTK" {
+		t.Errorf("X86Feature1.String() = %q", s)
+	}
+
+	// Clearing IBT keeps the size of the note, which is rewritten in
+	// place.
+	if err := f.SetGNUPropertyFlags(GNU_PROPERTY_X86_FEATURE_1_AND, uint32(feat.X86Feature1&^GNU_PROPERTY_X86_FEATURE_1_IBT)); err != nil {
+		t.Fatal(err)
+	}
+	f2 := reparseGNUProperties(t, f)
+	if s := f2.Section(".note.ABI-tag"); s.Offset != 0x21c || s.Size != 32 {
+		t.Errorf("note moved to %#x+%d", s.Offset, s.Size)
+	}
+	if feat, err := f2.GNUFeatures(); err != nil || feat.X86Feature1 != GNU_PROPERTY_X86_FEATURE_1_SHSTK {
+		t.Errorf("features after clearing IBT are %+v, %v", feat, err)
+	}
+
+	// An unallocated note, as in a relocatable object, moves to the end
+	// of the file when it grows; the properties are sorted.
+	f.Section(".note.ABI-tag").Flags &^= SHF_ALLOC
+	if err := f.SetGNUPropertyFlags(GNU_PROPERTY_X86_ISA_1_NEEDED, uint32(GNU_PROPERTY_X86_ISA_1_BASELINE|GNU_PROPERTY_X86_ISA_1_V2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetGNUPropertyFlags(GNU_PROPERTY_STACK_SIZE, 0x1000); err != nil {
+		t.Fatal(err)
+	}
+	f2 = reparseGNUProperties(t, f)
+	props, err = f2.GNUProperties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []GNUPropertyType{GNU_PROPERTY_STACK_SIZE, GNU_PROPERTY_X86_FEATURE_1_AND, GNU_PROPERTY_X86_ISA_1_NEEDED}
+	if len(props) != len(want) {
+		t.Fatalf("properties are %+v", props)
+	}
+	for i, p := range props {
+		if p.Type != want[i] {
+			t.Errorf("property %d is %v, want %v", i, p.Type, want[i])
+		}
+	}
+	if feat, err := f2.GNUFeatures(); err != nil || feat.X86Feature1 != GNU_PROPERTY_X86_FEATURE_1_SHSTK ||
+		feat.X86ISA1Needed != GNU_PROPERTY_X86_ISA_1_BASELINE|GNU_PROPERTY_X86_ISA_1_V2 {
+		t.Errorf("features are %+v, %v", feat, err)
+	}
+	s := f2.Section(".note.ABI-tag")
+	for _, p := range f2.Progs {
+		if p.Type == PT_GNU_PROPERTY && (p.Off != s.Offset || p.Filesz != s.Size) {
+			t.Errorf("PT_GNU_PROPERTY at %#x+%d, note at %#x+%d", p.Off, p.Filesz, s.Offset, s.Size)
+		}
+	}
+}
+
+func TestGNUPropertiesNone(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if props, err := f.GNUProperties(); props != nil || err != nil {
+		t.Errorf("GNUProperties() = %+v, %v", props, err)
+	}
+	if err := f.SetGNUPropertyFlags(GNU_PROPERTY_AARCH64_FEATURE_1_AND, 0); err != ErrNoGNUProperties {
+		t.Errorf("SetGNUPropertyFlags without a note: %v", err)
+	}
+}
+
+// TestGNUProperties8 reads the 8-aligned .note.gnu.property that gcc
+// writes, whose descriptor follows the name without padding.
+func TestGNUProperties8(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-linux-pie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if s := f.Section(".note.gnu.property"); s == nil || s.Addralign != 8 {
+		t.Fatalf(".note.gnu.property is %+v", s)
+	}
+	feat, err := f.GNUFeatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feat.X86ISA1Needed != GNU_PROPERTY_X86_ISA_1_BASELINE {
+		t.Errorf("features are %+v", feat)
+	}
+
+	if err := f.SetGNUPropertyFlags(GNU_PROPERTY_X86_ISA_1_NEEDED, uint32(GNU_PROPERTY_X86_ISA_1_BASELINE|GNU_PROPERTY_X86_ISA_1_V2)); err != nil {
+		t.Fatal(err)
+	}
+	f2 := reparseGNUProperties(t, f)
+	if s := f2.Section(".note.gnu.property"); s.Offset != 0x338 || s.Size != 32 {
+		t.Errorf("note moved to %#x+%d", s.Offset, s.Size)
+	}
+	if feat, err := f2.GNUFeatures(); err != nil || feat.X86ISA1Needed != GNU_PROPERTY_X86_ISA_1_BASELINE|GNU_PROPERTY_X86_ISA_1_V2 {
+		t.Errorf("features after setting x86-64-v2 are %+v, %v", feat, err)
+	}
+}
@@ -0,0 +1,209 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+
+	"github.com/Binject/debug/gosym"
+)
+
+// ErrNoGoMetadata is returned by File.GoPclntab, File.GoBuildInfo and
+// File.GoBuildID when the requested Go metadata cannot be found.
+var ErrNoGoMetadata = gosym.ErrNoGoMetadata
+
+// GoPclntab returns the contents of the Go pclntab, starting at its header,
+// and its offset in the file. The data can be passed to gosym.NewLineTable.
+//
+// The .gopclntab section is used if present. Otherwise, as when section
+// names have been stripped or rewritten, the sections (or the loadable
+// segments of a file without a section table) are searched for a valid
+// pclntab header.
+func (f *File) GoPclntab() ([]byte, uint64, error) {
+	if s := f.Section(".gopclntab"); s != nil && s.Type != SHT_NOBITS {
+		data, err := s.Data()
+		if err != nil {
+			return nil, 0, err
+		}
+		return data, s.Offset, nil
+	}
+	var (
+		found []byte
+		off   uint64
+	)
+	err := f.goSearch(func(data []byte, base uint64) bool {
+		if i := gosym.FindPclntab(data, f.ByteOrder); i >= 0 {
+			found, off = data[i:], base+uint64(i)
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if found == nil {
+		return nil, 0, ErrNoGoMetadata
+	}
+	return found, off, nil
+}
+
+// ApplyGoRenameMap renames the functions in the Go pclntab as described
+// by gosym.LineTable.ApplyRenameMap and stores the patched table in the
+// section that holds it, ready for Bytes or WriteFile.
+func (f *File) ApplyGoRenameMap(renames map[string]string) error {
+	pcln, off, err := f.GoPclntab()
+	if err != nil {
+		return err
+	}
+	patched, err := gosym.NewLineTable(pcln, 0).ApplyRenameMap(renames)
+	if err != nil {
+		return err
+	}
+	for _, s := range f.Sections {
+		if s.Type == SHT_NOBITS || s.Flags&SHF_COMPRESSED != 0 || off < s.Offset || off >= s.Offset+s.FileSize {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return err
+		}
+		copy(data[off-s.Offset:], patched)
+		s.Replace(bytes.NewReader(data), int64(len(data)))
+		return nil
+	}
+	return errors.New("pclntab is not inside a section")
+}
+
+// GoBuildInfo returns the Go build information blob, starting at its
+// "\xff Go buildinf:" header, and its offset in the file. The blob runs to
+// the end of the section or segment that holds it.
+func (f *File) GoBuildInfo() ([]byte, uint64, error) {
+	if s := f.Section(".go.buildinfo"); s != nil && s.Type != SHT_NOBITS {
+		data, err := s.Data()
+		if err != nil {
+			return nil, 0, err
+		}
+		if gosym.FindBuildInfo(data) == 0 {
+			return data, s.Offset, nil
+		}
+	}
+	var (
+		found []byte
+		off   uint64
+	)
+	err := f.goSearch(func(data []byte, base uint64) bool {
+		if i := gosym.FindBuildInfo(data); i >= 0 {
+			found, off = data[i:], base+uint64(i)
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if found == nil {
+		return nil, 0, ErrNoGoMetadata
+	}
+	return found, off, nil
+}
+
+// GoBuildID returns the Go build ID recorded by the linker, either in the
+// Go build ID note or at the start of the text segment.
+func (f *File) GoBuildID() (string, error) {
+	type noteData struct {
+		data  []byte
+		align uint64
+	}
+	var notes []noteData
+	for _, s := range f.Sections {
+		if s.Type == SHT_NOTE {
+			data, err := s.Data()
+			if err != nil {
+				return "", err
+			}
+			notes = append(notes, noteData{data, s.Addralign})
+		}
+	}
+	if len(notes) == 0 {
+		for _, p := range f.Progs {
+			if p.Type == PT_NOTE {
+				data, err := ioutil.ReadAll(p.Open())
+				if err != nil {
+					return "", err
+				}
+				notes = append(notes, noteData{data, p.Align})
+			}
+		}
+	}
+	for _, n := range notes {
+		if id, ok := goBuildIDNote(n.data, f.ByteOrder, n.align); ok {
+			return id, nil
+		}
+	}
+
+	// Without a note, the ID is the first thing in the text segment.
+	var id string
+	err := f.goSearch(func(data []byte, base uint64) bool {
+		var ok bool
+		id, ok = gosym.FindBuildID(data)
+		return ok
+	})
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		return "", ErrNoGoMetadata
+	}
+	return id, nil
+}
+
+// goSearch calls fn with the contents and file offset of each section that
+// has data in the file, or of each loadable segment if there is no section
+// table, until fn returns true.
+func (f *File) goSearch(fn func(data []byte, off uint64) bool) error {
+	searched := false
+	for _, s := range f.Sections {
+		if s.Type == SHT_NULL || s.Type == SHT_NOBITS || s.Flags&SHF_COMPRESSED != 0 || s.FileSize == 0 {
+			continue
+		}
+		searched = true
+		data, err := s.Data()
+		if err != nil {
+			return err
+		}
+		if fn(data, s.Offset) {
+			return nil
+		}
+	}
+	if searched {
+		return nil
+	}
+	for _, p := range f.Progs {
+		if p.Type != PT_LOAD || p.Filesz == 0 {
+			continue
+		}
+		data, err := ioutil.ReadAll(p.Open())
+		if err != nil {
+			return err
+		}
+		if fn(data, p.Off) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// goBuildIDNote looks for the Go build ID note (name "Go", type 4) in the
+// contents of a note section or segment.
+func goBuildIDNote(data []byte, bo binary.ByteOrder, align uint64) (string, bool) {
+	var id string
+	found := false
+	forEachNote(data, bo, align, func(n *note) bool {
+		if n.typ == 4 && string(n.name) == "Go\x00\x00" {
+			id, found = string(n.desc), true
+		}
+		return !found
+	})
+	return id, found
+}
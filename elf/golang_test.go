@@ -0,0 +1,113 @@
+package elf
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Binject/debug/internal/gobuild"
+)
+
+func TestGoMetadata(t *testing.T) {
+	exe := gobuild.Binary(t, "linux", "amd64")
+	out, err := exec.Command("go", "tool", "buildid", exe).Output()
+	if err != nil {
+		t.Fatalf("go tool buildid: %v", err)
+	}
+	wantID := strings.TrimSpace(string(out))
+
+	f, err := Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	pcln, pclnOff, err := f.GoPclntab()
+	if err != nil {
+		t.Fatalf("GoPclntab: %v", err)
+	}
+	if s := f.Section(".gopclntab"); pclnOff != s.Offset || len(pcln) != int(s.Size) {
+		t.Errorf("GoPclntab returned offset %#x, want %#x", pclnOff, s.Offset)
+	}
+	info, infoOff, err := f.GoBuildInfo()
+	if err != nil {
+		t.Fatalf("GoBuildInfo: %v", err)
+	}
+	if !bytes.HasPrefix(info, []byte("\xff Go buildinf:")) {
+		t.Errorf("GoBuildInfo returned data without the build info header")
+	}
+	if id, err := f.GoBuildID(); err != nil || id != wantID {
+		t.Errorf("GoBuildID = %q, %v; want %q", id, err, wantID)
+	}
+
+	// Lose the section names and the build ID note, forcing a scan.
+	for _, s := range f.Sections {
+		s.Name = ""
+		if s.Type == SHT_NOTE {
+			s.Type = SHT_PROGBITS
+		}
+	}
+	if _, off, err := f.GoPclntab(); err != nil || off != pclnOff {
+		t.Errorf("GoPclntab without section names = %#x, %v; want %#x", off, err, pclnOff)
+	}
+	if _, off, err := f.GoBuildInfo(); err != nil || off != infoOff {
+		t.Errorf("GoBuildInfo without section names = %#x, %v; want %#x", off, err, infoOff)
+	}
+	if id, err := f.GoBuildID(); err != nil || id != wantID {
+		t.Errorf("GoBuildID without the note = %q, %v; want %q", id, err, wantID)
+	}
+}
+
+func TestGoMetadataNotGo(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, _, err := f.GoPclntab(); err != ErrNoGoMetadata {
+		t.Errorf("GoPclntab error = %v, want ErrNoGoMetadata", err)
+	}
+	if _, _, err := f.GoBuildInfo(); err != ErrNoGoMetadata {
+		t.Errorf("GoBuildInfo error = %v, want ErrNoGoMetadata", err)
+	}
+	if _, err := f.GoBuildID(); err != ErrNoGoMetadata {
+		t.Errorf("GoBuildID error = %v, want ErrNoGoMetadata", err)
+	}
+}
+
+func TestApplyGoRenameMap(t *testing.T) {
+	exe := gobuild.Binary(t, "linux", "amd64")
+	f, err := Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.ApplyGoRenameMap(map[string]string{"main.main": "main.xx"}); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(filepath.Dir(exe), "renamed")
+	if err := f.WriteFile(out); err != nil {
+		t.Fatal(err)
+	}
+	g, err := Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	pcln, _, err := g.GoPclntab()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(pcln, []byte("\x00main.xx\x00")) || bytes.Contains(pcln, []byte("\x00main.main\x00")) {
+		t.Error("main.main was not renamed")
+	}
+	if err := os.Chmod(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if output, err := exec.Command(out).CombinedOutput(); err != nil || string(output) != "hello\n" {
+		t.Errorf("renamed binary: %v\n%s", err, output)
+	}
+}
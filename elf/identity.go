@@ -0,0 +1,51 @@
+package elf
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// CloneIdentity copies the note sections, such as .note.gnu.build-id,
+// .note.ABI-tag and .note.go.buildid, and the .comment section holding
+// the compiler versions, from src onto the sections of f with the same
+// names. Sections that f does not have are not added.
+//
+// Sections that are loaded into memory keep their place, so their
+// contents can only be replaced by contents of the same size; other
+// sections are moved to the end of the file if they grow.
+func (f *File) CloneIdentity(src *File) error {
+	type update struct {
+		s    *Section
+		data []byte
+	}
+	var updates []update
+	for _, s := range f.Sections {
+		if s.Type != SHT_NOTE && !(s.Type == SHT_PROGBITS && s.Name == ".comment") {
+			continue
+		}
+		donor := src.Section(s.Name)
+		if donor == nil || donor.Type != s.Type {
+			continue
+		}
+		data, err := donor.Data()
+		if err != nil {
+			return err
+		}
+		if s.Flags&SHF_ALLOC != 0 && uint64(len(data)) != s.Size {
+			return fmt.Errorf("section %s is %d bytes, but the one of the donor is %d", s.Name, s.Size, len(data))
+		}
+		if s.Type == SHT_NOTE && f.ByteOrder != src.ByteOrder {
+			return fmt.Errorf("cannot copy section %s between files of different byte orders", s.Name)
+		}
+		updates = append(updates, update{s, data})
+	}
+
+	for _, u := range updates {
+		if u.s.Flags&SHF_ALLOC != 0 {
+			u.s.Replace(bytes.NewReader(u.data), int64(len(u.data)))
+		} else {
+			f.replaceNonAlloc(u.s, u.data)
+		}
+	}
+	return nil
+}
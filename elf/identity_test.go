@@ -0,0 +1,109 @@
+package elf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func sectionData(t *testing.T, f *File, name string) []byte {
+	s := f.Section(name)
+	if s == nil {
+		t.Fatalf("no %s section", name)
+	}
+	data, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestCloneIdentity(t *testing.T) {
+	dst, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	src, err := Open("testdata/gcc-386-freebsd-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	abiTag := sectionData(t, dst, ".note.ABI-tag")
+	if err := dst.CloneIdentity(src); err != nil {
+		t.Fatal(err)
+	}
+	g := reparse(t, dst)
+	if got, want := sectionData(t, g, ".comment"), sectionData(t, src, ".comment"); !bytes.Equal(got, want) {
+		t.Errorf(".comment = %q, want %q", got, want)
+	}
+	// The donor has no ABI tag note, so it is left alone.
+	if got := sectionData(t, g, ".note.ABI-tag"); !bytes.Equal(got, abiTag) {
+		t.Errorf(".note.ABI-tag = %x, want %x", got, abiTag)
+	}
+}
+
+func TestCloneIdentityBuildID(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("requires linux/amd64")
+	}
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc not found")
+	}
+	dir := t.TempDir()
+	build := func(name, msg string) string {
+		src := filepath.Join(dir, name+".c")
+		if err := ioutil.WriteFile(src, []byte("#include <stdio.h>\nint main(void) { puts(\""+msg+"\"); return 0; }\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		exe := filepath.Join(dir, name)
+		if out, err := exec.Command("gcc", "-Wl,--build-id=sha1", "-o", exe, src).CombinedOutput(); err != nil {
+			t.Skipf("gcc: %v\n%s", err, out)
+		}
+		return exe
+	}
+	dstPath, srcPath := build("dst", "hello"), build("src", "donor")
+
+	dst, err := Open(dstPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	src, err := Open(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	want := sectionData(t, src, ".note.gnu.build-id")
+	if bytes.Equal(sectionData(t, dst, ".note.gnu.build-id"), want) {
+		t.Fatal("both executables have the same build ID")
+	}
+	if err := dst.CloneIdentity(src); err != nil {
+		t.Fatal(err)
+	}
+	patched := filepath.Join(dir, "patched")
+	if err := dst.WriteFile(patched); err != nil {
+		t.Fatal(err)
+	}
+	g, err := Open(patched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	if got := sectionData(t, g, ".note.gnu.build-id"); !bytes.Equal(got, want) {
+		t.Errorf("build ID note = %x, want %x", got, want)
+	}
+	if err := os.Chmod(patched, 0755); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(patched).CombinedOutput()
+	if err != nil || string(out) != "hello\n" {
+		t.Errorf("running patched executable: %v, output %q", err, out)
+	}
+}
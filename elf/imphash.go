@@ -0,0 +1,77 @@
+package elf
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// importHashExcluded are imported functions that nearly every ELF
+// executable links with, and that telfhash leaves out for the same
+// reason.
+var importHashExcluded = map[string]bool{
+	"__libc_start_main": true,
+	"main":              true,
+	"abort":             true,
+	"cachectl":          true,
+	"cacheflush":        true,
+	"puts":              true,
+	"atol":              true,
+	"malloc_trim":       true,
+}
+
+// ImportHashSymbols returns the names that ImportHash hashes: the global
+// functions f imports through its dynamic symbol table, lower-cased,
+// sorted and deduplicated. Symbol versions are not part of the names.
+// As in telfhash, names starting with "_" or ".", ending in "64" or
+// starting with "str" or "mem", and a few functions of the C runtime
+// that nearly every executable imports, are left out.
+//
+// The names are those telfhash feeds to TLSH, for callers that want a
+// fuzzy hash instead of ImportHash.
+func (f *File) ImportHashSymbols() ([]string, error) {
+	syms, err := f.DynamicSymbols()
+	if err != nil {
+		if err == ErrNoSymbols {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return importHashNames(syms), nil
+}
+
+// importHashNames selects and sorts the ImportHashSymbols among the
+// dynamic symbols syms.
+func importHashNames(syms []Symbol) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, s := range syms {
+		if s.Section != SHN_UNDEF || ST_BIND(s.Info) != STB_GLOBAL || ST_TYPE(s.Info) != STT_FUNC {
+			continue
+		}
+		name := strings.ToLower(s.Name)
+		switch {
+		case name == "", strings.HasPrefix(name, "_"), strings.HasPrefix(name, "."),
+			strings.HasSuffix(name, "64"), strings.HasPrefix(name, "str"), strings.HasPrefix(name, "mem"),
+			importHashExcluded[name], seen[name]:
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ImportHash returns the MD5, in hex, of the comma-separated
+// ImportHashSymbols of f, an identifier of the functions f imports much
+// like the PE import hash. It returns "" if f imports no such function.
+func (f *File) ImportHash() (string, error) {
+	names, err := f.ImportHashSymbols()
+	if err != nil || len(names) == 0 {
+		return "", err
+	}
+	sum := md5.Sum([]byte(strings.Join(names, ",")))
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,36 @@
+package elf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImportHash(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// The file only imports puts and __libc_start_main, which are both
+	// left out.
+	if h, err := f.ImportHash(); err != nil || h != "" {
+		t.Errorf("ImportHash = %q, %v; want none", h, err)
+	}
+
+	fn := ST_INFO(STB_GLOBAL, STT_FUNC)
+	syms := []Symbol{
+		{Name: "socket", Info: fn},
+		{Name: "Connect", Info: fn},
+		{Name: "connect", Info: fn},
+		{Name: "strcpy", Info: fn},
+		{Name: "fopen64", Info: fn},
+		{Name: "__cxa_finalize", Info: fn},
+		{Name: "abort", Info: fn},
+		{Name: "defined", Info: fn, Section: 12},
+		{Name: "weak", Info: ST_INFO(STB_WEAK, STT_FUNC)},
+		{Name: "environ", Info: ST_INFO(STB_GLOBAL, STT_OBJECT)},
+	}
+	if got, want := importHashNames(syms), []string{"connect", "socket"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("import hash names are %q, want %q", got, want)
+	}
+}
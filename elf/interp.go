@@ -0,0 +1,139 @@
+package elf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// ErrNoInterpreter is returned by File.Interpreter and File.SetInterpreter
+// for files without a PT_INTERP segment, such as static executables.
+var ErrNoInterpreter = errors.New("no PT_INTERP segment")
+
+// Interpreter returns the path of the program interpreter named by the
+// PT_INTERP segment.
+func (f *File) Interpreter() (string, error) {
+	p := f.interpProg()
+	if p == nil {
+		return "", ErrNoInterpreter
+	}
+	data, err := ioutil.ReadAll(p.Open())
+	if err != nil {
+		return "", err
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return string(data), nil
+}
+
+// SetInterpreter sets the path of the program interpreter, updating both
+// the PT_INTERP segment and the .interp section.
+//
+// A path that does not fit in the current segment is moved to the end of
+// a read-only PT_LOAD segment, which is grown into the padding that
+// separates it from the next segment. An error is returned if there is no
+// such padding large enough for the path.
+func (f *File) SetInterpreter(path string) error {
+	p := f.interpProg()
+	if p == nil {
+		return ErrNoInterpreter
+	}
+	var sect *Section
+	for _, s := range f.Sections {
+		if s.Type != SHT_NOBITS && s.Offset == p.Off && s.Size == p.Filesz {
+			sect = s
+			break
+		}
+	}
+
+	data := append([]byte(path), 0)
+	size := uint64(len(data))
+	if size > p.Filesz {
+		load := f.interpLoad(size)
+		if load == nil {
+			return fmt.Errorf("no room for a %d byte interpreter path", size)
+		}
+		p.Off = load.Off + load.Filesz
+		p.Vaddr = load.Vaddr + load.Filesz
+		p.Paddr = load.Paddr + load.Filesz
+		load.Filesz += size
+		load.Memsz += size
+	}
+	p.Replace(bytes.NewReader(data), int64(size))
+	p.Memsz = size
+	if sect != nil {
+		sect.Replace(bytes.NewReader(data), int64(size))
+		sect.Offset = p.Off
+		sect.Addr = p.Vaddr
+	}
+	return nil
+}
+
+func (f *File) interpProg() *Prog {
+	for _, p := range f.Progs {
+		if p.Type == PT_INTERP {
+			return p
+		}
+	}
+	return nil
+}
+
+// interpLoad returns a PT_LOAD segment that can be grown by size bytes
+// without running into the contents of the file or into another
+// segment's memory, or nil. Read-only segments are preferred.
+func (f *File) interpLoad(size uint64) *Prog {
+	var found *Prog
+	for _, p := range f.Progs {
+		if !f.canGrowLoad(p, size) {
+			continue
+		}
+		if p.Flags&PF_W == 0 {
+			return p
+		}
+		if found == nil {
+			found = p
+		}
+	}
+	return found
+}
+
+// canGrowLoad reports whether the PT_LOAD segment p can be grown by size
+// bytes without running into the contents of the file or into another
+// segment's memory.
+func (f *File) canGrowLoad(p *Prog, size uint64) bool {
+	if p.Type != PT_LOAD || p.Filesz != p.Memsz || p.Filesz == 0 {
+		return false
+	}
+	if f.fileUsed(p.Off+p.Filesz, size) {
+		return false
+	}
+	vend := p.Vaddr + p.Memsz
+	for _, q := range f.Progs {
+		if q != p && q.Type == PT_LOAD && q.Vaddr < vend+size && vend < q.Vaddr+q.Memsz {
+			return false
+		}
+	}
+	return true
+}
+
+// fileUsed reports whether any section, segment or the section header
+// table holds data in the file range [off, off+size).
+func (f *File) fileUsed(off, size uint64) bool {
+	overlaps := func(o, n uint64) bool {
+		return n != 0 && o < off+size && off < o+n
+	}
+	for _, s := range f.Sections {
+		if s.Type != SHT_NOBITS && overlaps(s.Offset, s.FileSize) {
+			return true
+		}
+	}
+	for _, p := range f.Progs {
+		if overlaps(p.Off, p.Filesz) {
+			return true
+		}
+	}
+	shentsize := f.sectionHeaderSize()
+	return f.SHTOffset > 0 && overlaps(uint64(f.SHTOffset), shentsize*uint64(len(f.Sections)))
+}
@@ -0,0 +1,132 @@
+package elf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestInterpreter(t *testing.T) {
+	for _, tt := range []struct {
+		file, interp string
+	}{
+		{"testdata/gcc-386-freebsd-exec", "/libexec/ld-elf.so.1"},
+		{"testdata/gcc-amd64-linux-exec", "/lib64/ld-linux-x86-64.so.2"},
+	} {
+		f, err := Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if interp, err := f.Interpreter(); err != nil || interp != tt.interp {
+			t.Errorf("%s: Interpreter() = %q, %v; want %q", tt.file, interp, err, tt.interp)
+		}
+
+		// A shorter path is written in place.
+		const short = "/lib/ld.so"
+		if err := f.SetInterpreter(short); err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		b, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		f2, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if interp, err := f2.Interpreter(); err != nil || interp != short {
+			t.Errorf("%s: Interpreter() after SetInterpreter = %q, %v; want %q", tt.file, interp, err, short)
+		}
+		if data, err := f2.Section(".interp").Data(); err != nil || string(data) != short+"\x00" {
+			t.Errorf("%s: .interp = %q, %v", tt.file, data, err)
+		}
+
+		// These files have no padding after their text segment.
+		if err := f.SetInterpreter(strings.Repeat("x", 64)); err == nil {
+			t.Errorf("%s: SetInterpreter with a long path succeeded", tt.file)
+		}
+		f.Close()
+	}
+}
+
+func TestInterpreterNone(t *testing.T) {
+	f, err := Open("testdata/go-relocation-test-gcc441-x86-64.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Interpreter(); err != ErrNoInterpreter {
+		t.Errorf("Interpreter() error = %v, want ErrNoInterpreter", err)
+	}
+	if err := f.SetInterpreter("/lib/ld.so"); err != ErrNoInterpreter {
+		t.Errorf("SetInterpreter() error = %v, want ErrNoInterpreter", err)
+	}
+}
+
+func TestSetInterpreterRun(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("requires linux/amd64")
+	}
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc not found")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "hello.c")
+	if err := ioutil.WriteFile(src, []byte("#include <stdio.h>\nint main(void) { puts(\"hello\"); return 0; }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(dir, "hello")
+	if out, err := exec.Command("gcc", "-o", exe, src).CombinedOutput(); err != nil {
+		t.Skipf("gcc: %v\n%s", err, out)
+	}
+
+	f, err := Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	interp, err := f.Interpreter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Point the executable at the same interpreter through a longer path.
+	long := filepath.Join(dir, strings.Repeat("d", 100), "ld.so")
+	if err := os.MkdirAll(filepath.Dir(long), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(interp, long); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetInterpreter(long); err != nil {
+		t.Fatal(err)
+	}
+	patched := filepath.Join(dir, "hello-patched")
+	if err := f.WriteFile(patched); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(patched, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	f2, err := Open(patched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+	if got, err := f2.Interpreter(); err != nil || got != long {
+		t.Errorf("Interpreter() = %q, %v; want %q", got, err, long)
+	}
+	out, err := exec.Command(patched).CombinedOutput()
+	if err != nil {
+		t.Fatalf("running patched executable: %v\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "hello") {
+		t.Errorf("patched executable printed %q", out)
+	}
+}
@@ -0,0 +1,194 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// STT_GNU_IFUNC is the GNU symbol type of indirect functions, whose
+// address is the one their resolver returns at load time. It is in the
+// STT_LOOS range.
+const STT_GNU_IFUNC SymType = 10
+
+// An IRelative is an R_*_IRELATIVE dynamic relocation: at load time, the
+// word at Offset is set to the address returned by the resolver function
+// at Resolver. Both are link-time addresses.
+type IRelative struct {
+	Offset   uint64
+	Resolver uint64
+}
+
+// IFuncSymbols returns the STT_GNU_IFUNC symbols of the static and the
+// dynamic symbol table, in that order.
+func (f *File) IFuncSymbols() ([]Symbol, error) {
+	var ifuncs []Symbol
+	for _, read := range []func() ([]Symbol, error){f.Symbols, f.DynamicSymbols} {
+		syms, err := read()
+		if err != nil && err != ErrNoSymbols {
+			return nil, err
+		}
+		for _, s := range syms {
+			if ST_TYPE(s.Info) == STT_GNU_IFUNC {
+				ifuncs = append(ifuncs, s)
+			}
+		}
+	}
+	return ifuncs, nil
+}
+
+// irelativeType returns the R_*_IRELATIVE relocation type of the machine
+// of f, for the 64-bit machines with RELA dynamic relocations.
+func (f *File) irelativeType() (uint32, error) {
+	if f.Class == ELFCLASS64 {
+		switch f.Machine {
+		case EM_X86_64:
+			return uint32(R_X86_64_IRELATIVE), nil
+		case EM_AARCH64:
+			return uint32(R_AARCH64_IRELATIVE), nil
+		case EM_PPC64:
+			return uint32(R_PPC64_IRELATIVE), nil
+		}
+	}
+	return 0, fmt.Errorf("IRELATIVE relocations of %v %v are not supported", f.Class, f.Machine)
+}
+
+// IRelatives returns the R_*_IRELATIVE relocations of the loaded RELA
+// sections of f, such as .rela.dyn and .rela.plt, in order.
+func (f *File) IRelatives() ([]IRelative, error) {
+	typ, err := f.irelativeType()
+	if err != nil {
+		return nil, err
+	}
+	var irels []IRelative
+	for _, s := range f.Sections {
+		if s.Type != SHT_RELA || s.Flags&SHF_ALLOC == 0 {
+			continue
+		}
+		rels, err := f.relas(s)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rels {
+			if R_TYPE64(r.Info) == typ {
+				irels = append(irels, IRelative{Offset: r.Off, Resolver: uint64(r.Addend)})
+			}
+		}
+	}
+	return irels, nil
+}
+
+func (f *File) relas(s *Section) ([]Rela64, error) {
+	data, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%24 != 0 {
+		return nil, fmt.Errorf("length of %s is not a multiple of 24", s.Name)
+	}
+	rels := make([]Rela64, len(data)/24)
+	if err := binary.Read(bytes.NewReader(data), f.ByteOrder, rels); err != nil {
+		return nil, err
+	}
+	return rels, nil
+}
+
+func (f *File) setRelas(s *Section, rels []Rela64) {
+	var b bytes.Buffer
+	binary.Write(&b, f.ByteOrder, rels)
+	s.Replace(bytes.NewReader(b.Bytes()), int64(b.Len()))
+}
+
+// SetIRelativeResolver changes the resolver of the R_*_IRELATIVE
+// relocation of the word at offset.
+func (f *File) SetIRelativeResolver(offset, resolver uint64) error {
+	typ, err := f.irelativeType()
+	if err != nil {
+		return err
+	}
+	for _, s := range f.Sections {
+		if s.Type != SHT_RELA || s.Flags&SHF_ALLOC == 0 {
+			continue
+		}
+		rels, err := f.relas(s)
+		if err != nil {
+			return err
+		}
+		for i, r := range rels {
+			if R_TYPE64(r.Info) == typ && r.Off == offset {
+				rels[i].Addend = int64(resolver)
+				f.setRelas(s, rels)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("no IRELATIVE relocation at %#x", offset)
+}
+
+// AddIRelative appends an R_*_IRELATIVE relocation of the word at offset
+// to the relocations DT_RELA points to, and updates DT_RELASZ. The
+// relocations are moved to the end of a PT_LOAD segment, which is grown
+// into the padding that separates it from the next segment, unless they
+// already end one that can be grown. DT_RELACOUNT is left alone, as it
+// only counts the R_*_RELATIVE relocations that come first.
+func (f *File) AddIRelative(offset, resolver uint64) error {
+	typ, err := f.irelativeType()
+	if err != nil {
+		return err
+	}
+	addrs := f.DynValue(DT_RELA)
+	if len(addrs) == 0 {
+		return errors.New("no DT_RELA dynamic relocations")
+	}
+	var s *Section
+	for _, sec := range f.Sections {
+		if sec.Type == SHT_RELA && sec.Flags&SHF_ALLOC != 0 && sec.Addr == addrs[0] {
+			s = sec
+		}
+	}
+	if s == nil {
+		return fmt.Errorf("no RELA section at DT_RELA %#x", addrs[0])
+	}
+	rels, err := f.relas(s)
+	if err != nil {
+		return err
+	}
+	rels = append(rels, Rela64{Off: offset, Info: R_INFO(0, typ), Addend: int64(resolver)})
+	size := uint64(len(rels) * 24)
+
+	// Grow the segment the relocations end, or move them to the aligned
+	// end of another.
+	var load *Prog
+	for _, p := range f.Progs {
+		if p.Off+p.Filesz == s.Offset+s.FileSize && p.Vaddr+p.Memsz == s.Addr+s.Size && f.canGrowLoad(p, 24) {
+			load = p
+			break
+		}
+	}
+	if load != nil {
+		load.Filesz += 24
+		load.Memsz += 24
+	} else {
+		for _, p := range f.Progs {
+			pad := (8 - (p.Off+p.Filesz)%8) % 8
+			if p.Flags&PF_W == 0 && p.Vaddr%8 == p.Off%8 && f.canGrowLoad(p, pad+size) {
+				load = p
+				break
+			}
+		}
+		if load == nil {
+			return fmt.Errorf("no room for %d bytes of dynamic relocations", size)
+		}
+		pad := (8 - (load.Off+load.Filesz)%8) % 8
+		s.Offset = load.Off + load.Filesz + pad
+		s.Addr = load.Vaddr + load.Memsz + pad
+		load.Filesz += pad + size
+		load.Memsz += pad + size
+	}
+	f.setRelas(s, rels)
+	if err := f.SetDynTag(DT_RELA, s.Addr); err != nil {
+		return err
+	}
+	return f.SetDynTag(DT_RELASZ, size)
+}
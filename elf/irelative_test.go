@@ -0,0 +1,139 @@
+package elf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestIRelativeNoRoom(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if irels, err := f.IRelatives(); err != nil || len(irels) != 0 {
+		t.Errorf("IRelatives() = %v, %v", irels, err)
+	}
+	if err := f.SetIRelativeResolver(0x600850, 0x400400); err == nil {
+		t.Error("SetIRelativeResolver patched a missing relocation")
+	}
+	// The text segment is followed directly by the data segment.
+	if err := f.AddIRelative(0x600850, 0x400400); err == nil {
+		t.Error("AddIRelative succeeded without room for the relocations")
+	}
+
+	f386, err := Open("testdata/gcc-386-freebsd-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f386.Close()
+	if _, err := f386.IRelatives(); err == nil {
+		t.Error("IRelatives succeeded for a machine with REL relocations")
+	}
+}
+
+func TestIRelativeRun(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("requires linux/amd64")
+	}
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc not found")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "ifunc.c")
+	// slot is only set by the IRELATIVE relocation added below.
+	prog := `
+static int answer(void) { return 42; }
+static int other(void) { return 7; }
+__attribute__((used, noinline)) void *resolve_answer(void) { return answer; }
+__attribute__((used, noinline)) void *resolve_other(void) { return other; }
+int ifunc(void) __attribute__((ifunc("resolve_other")));
+int (*volatile slot)(void);
+int main(void) { return slot && slot() == 42 && ifunc() == 7 ? 0 : 1; }
+`
+	if err := ioutil.WriteFile(src, []byte(prog), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(dir, "ifunc")
+	if out, err := exec.Command("gcc", "-O0", "-o", exe, src).CombinedOutput(); err != nil {
+		t.Skipf("gcc: %v\n%s", err, out)
+	}
+
+	f, err := Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ifuncs, err := f.IFuncSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ifuncs) == 0 || ifuncs[0].Name != "ifunc" {
+		t.Errorf("IFuncSymbols() = %+v", ifuncs)
+	}
+	x, err := f.SymbolIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot, ok1 := x.Lookup("slot")
+	resolver, ok2 := x.Lookup("resolve_answer")
+	if !ok1 || !ok2 {
+		t.Fatal("symbols of the test program not found")
+	}
+	before, err := f.IRelatives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.AddIRelative(slot.Value, resolver.Value); err != nil {
+		t.Fatal(err)
+	}
+	// The second one grows the moved table in place.
+	if err := f.AddIRelative(slot.Value+8, resolver.Value); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetIRelativeResolver(slot.Value+8, 0); err != nil {
+		t.Fatal(err)
+	}
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := g.IRelatives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The new relocations follow those of .rela.dyn, before .rela.plt.
+	found := 0
+	for i, r := range after {
+		if r == (IRelative{slot.Value, resolver.Value}) && i+1 < len(after) && after[i+1] == (IRelative{slot.Value + 8, 0}) {
+			found++
+		}
+	}
+	if len(after) != len(before)+2 || found != 1 {
+		t.Errorf("IRelatives() = %+v after adding to %+v", after, before)
+	}
+
+	// Only the first relocation is needed by the program.
+	if err := g.SetIRelativeResolver(slot.Value+8, resolver.Value); err != nil {
+		t.Fatal(err)
+	}
+	patched := filepath.Join(dir, "ifunc-patched")
+	if err := g.WriteFile(patched); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(patched, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(patched).CombinedOutput(); err != nil {
+		t.Errorf("running the patched program: %v\n%s", err, out)
+	}
+}
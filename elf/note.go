@@ -0,0 +1,69 @@
+package elf
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errBadNote = errors.New("truncated note")
+
+// A note is an entry of the contents of a SHT_NOTE section or PT_NOTE
+// segment. Name and desc are slices of those contents.
+type note struct {
+	typ  uint32
+	name []byte // as stored, usually with a terminating NUL
+	desc []byte
+	off  uint64 // offset of the note header
+	doff uint64 // offset of the descriptor
+}
+
+// nameString returns the name of n without its terminating NUL.
+func (n *note) nameString() string {
+	name := n.name
+	if k := len(name); k > 0 && name[k-1] == 0 {
+		name = name[:k-1]
+	}
+	return string(name)
+}
+
+// forEachNote calls fn for each note of the note contents data until fn
+// returns false. The name and descriptor are padded to 8 bytes if align
+// is 8, and to 4 otherwise, counting from the start of the note header;
+// the padding of the last note may be missing. A note that runs past the
+// end of data stops the walk with errBadNote.
+//
+// fn may modify the contents of data, including the header of the note
+// it is given, which has been read by then.
+func forEachNote(data []byte, bo binary.ByteOrder, align uint64, fn func(n *note) bool) error {
+	if align != 8 {
+		align = 4
+	}
+	pad := func(n uint64) uint64 { return (n + align - 1) &^ (align - 1) }
+	size := uint64(len(data))
+	for off := uint64(0); off < size; {
+		if size-off < 12 {
+			return errBadNote
+		}
+		namesz := uint64(bo.Uint32(data[off:]))
+		descsz := uint64(bo.Uint32(data[off+4:]))
+		n := &note{typ: bo.Uint32(data[off+8:]), off: off}
+		if namesz > size-off-12 {
+			return errBadNote
+		}
+		n.doff = off + pad(12+namesz)
+		if n.doff > size || descsz > size-n.doff {
+			return errBadNote
+		}
+		n.name = data[off+12 : off+12+namesz]
+		n.desc = data[n.doff : n.doff+descsz]
+		next := off + pad(n.doff-off+descsz)
+		if next > size {
+			next = size
+		}
+		if !fn(n) {
+			return nil
+		}
+		off = next
+	}
+	return nil
+}
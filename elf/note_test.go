@@ -0,0 +1,53 @@
+package elf
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestForEachNote(t *testing.T) {
+	le := binary.LittleEndian
+	// Two notes with the name "GNU" and descriptors of 5 and 4 bytes.
+	// With 8-byte alignment the descriptor follows the 16 bytes of header
+	// and name, and the first note is padded to 24 bytes.
+	build := func(align int) []byte {
+		var data []byte
+		for _, descsz := range []int{5, 4} {
+			b := make([]byte, 16+(descsz+align-1)&^(align-1))
+			le.PutUint32(b, 4)
+			le.PutUint32(b[4:], uint32(descsz))
+			le.PutUint32(b[8:], uint32(descsz))
+			copy(b[12:], "GNU\x00")
+			for i := 0; i < descsz; i++ {
+				b[16+i] = byte(descsz)
+			}
+			data = append(data, b...)
+		}
+		return data
+	}
+	for _, align := range []int{4, 8} {
+		data := build(align)
+		var offs []uint64
+		err := forEachNote(data, le, uint64(align), func(n *note) bool {
+			if n.nameString() != "GNU" || n.typ != uint32(len(n.desc)) || n.doff != n.off+16 || n.desc[0] != byte(n.typ) {
+				t.Errorf("align %d: note %+v", align, n)
+			}
+			offs = append(offs, n.off)
+			return true
+		})
+		if err != nil || len(offs) != 2 || offs[1] != uint64((16+5+align-1)&^(align-1)) {
+			t.Errorf("align %d: notes at %v, %v", align, offs, err)
+		}
+		// The padding of the last note may be missing, but not its
+		// descriptor.
+		if err := forEachNote(data[:offs[1]+20], le, uint64(align), func(*note) bool { return true }); err != nil {
+			t.Errorf("align %d: unpadded last note: %v", align, err)
+		}
+		if err := forEachNote(data[:offs[1]+19], le, uint64(align), func(*note) bool { return true }); err != errBadNote {
+			t.Errorf("align %d: truncated descriptor: %v", align, err)
+		}
+	}
+	if err := forEachNote(make([]byte, 8), le, 4, func(*note) bool { return true }); err != errBadNote {
+		t.Errorf("truncated header: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package elf
+
+import (
+	"runtime"
+	"sync"
+)
+
+// minParallelEntries is the number of symbol or relocation entries each
+// goroutine decodes at least; smaller tables are decoded serially.
+var minParallelEntries = 1 << 14
+
+// workers returns the number of goroutines that decode a table of n
+// entries, at most f.Workers.
+func (f *File) workers(n int) int {
+	w := f.Workers
+	if w <= 0 {
+		w = runtime.GOMAXPROCS(0)
+	}
+	if most := n / minParallelEntries; w > most {
+		w = most
+	}
+	if w < 1 {
+		w = 1
+	}
+	return w
+}
+
+// forEachChunk calls fn for consecutive ranges [lo, hi) covering [0, n),
+// from up to f.workers(n) goroutines, and returns when all calls have.
+func (f *File) forEachChunk(n int, fn func(lo, hi int)) {
+	w := f.workers(n)
+	if w == 1 {
+		fn(0, n)
+		return
+	}
+	chunk := (n + w - 1) / w
+	var wg sync.WaitGroup
+	for lo := 0; lo < n; lo += chunk {
+		hi := lo + chunk
+		if hi > n {
+			hi = n
+		}
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			fn(lo, hi)
+		}(lo, hi)
+	}
+	wg.Wait()
+}
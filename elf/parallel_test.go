@@ -0,0 +1,117 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// readSymbols decodes the symbol table of type typ of f entry by entry,
+// with encoding/binary.
+func readSymbols(t *testing.T, f *File, typ SectionType) []Symbol {
+	t.Helper()
+	s := f.SectionByType(typ)
+	data, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	str, err := f.stringTable(s.Link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(data)
+	var syms []Symbol
+	for i := 0; r.Len() > 0; i++ {
+		var sym Symbol
+		if f.Class == ELFCLASS64 {
+			var s Sym64
+			binary.Read(r, f.ByteOrder, &s)
+			sym = Symbol{NameIndex: s.Name, Info: s.Info, Other: s.Other, SectIndex: s.Shndx, Value: s.Value, Size: s.Size}
+		} else {
+			var s Sym32
+			binary.Read(r, f.ByteOrder, &s)
+			sym = Symbol{NameIndex: s.Name, Info: s.Info, Other: s.Other, SectIndex: s.Shndx, Value: uint64(s.Value), Size: uint64(s.Size)}
+		}
+		if i == 0 {
+			continue
+		}
+		sym.Name, _ = getString(str, int(sym.NameIndex))
+		sym.Section = SectionIndex(sym.SectIndex)
+		syms = append(syms, sym)
+	}
+	return syms
+}
+
+func TestParallelDecode(t *testing.T) {
+	defer func(n int) { minParallelEntries = n }(minParallelEntries)
+	minParallelEntries = 1
+
+	for _, name := range []string{
+		"testdata/gcc-amd64-linux-exec",
+		"testdata/gcc-386-freebsd-exec",
+		"testdata/go-relocation-test-gcc441-x86.obj",
+		"testdata/go-relocation-test-gcc482-ppc64le.obj",
+	} {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		for _, workers := range []int{1, 3, 0} {
+			f.Workers = workers
+			for _, typ := range []SectionType{SHT_SYMTAB, SHT_DYNSYM} {
+				if f.SectionByType(typ) == nil {
+					continue
+				}
+				syms, _, err := f.getSymbols(typ)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := readSymbols(t, f, typ); !reflect.DeepEqual(syms, want) {
+					t.Errorf("%s: %d workers: %v symbols differ from those read serially", name, workers, typ)
+				}
+			}
+		}
+
+		for _, s := range f.Sections {
+			if s.Type != SHT_REL && s.Type != SHT_RELA {
+				continue
+			}
+			f.Workers = 1
+			want, err := f.Relocs(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Workers = 3
+			if got, err := f.Relocs(s); err != nil || !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %s: relocations decoded by 3 workers differ: %v", name, s.Name, err)
+			}
+		}
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	f := &File{Workers: 4}
+	for _, c := range []struct{ n, want int }{
+		{0, 1},
+		{minParallelEntries - 1, 1},
+		{2 * minParallelEntries, 2},
+		{100 * minParallelEntries, 4},
+	} {
+		if got := f.workers(c.n); got != c.want {
+			t.Errorf("workers(%d) = %d, want %d", c.n, got, c.want)
+		}
+	}
+	covered := make([]int, 3*minParallelEntries+5)
+	f.forEachChunk(len(covered), func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			covered[i]++
+		}
+	})
+	for i, n := range covered {
+		if n != 1 {
+			t.Fatalf("entry %d decoded %d times", i, n)
+		}
+	}
+}
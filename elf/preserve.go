@@ -0,0 +1,109 @@
+package elf
+
+import (
+	"errors"
+	"io"
+
+	"github.com/Binject/debug/internal/readerat"
+)
+
+// rawLen returns the size of the file f was read from.
+func (f *File) rawLen() (int64, error) {
+	return readerat.CachedSize(f.raw, &f.rawSize)
+}
+
+// preservedBytes returns the original bytes of the file with the file
+// header, program and section header tables and section contents written
+// over them. Anything past the original end is zero filled up to the
+// regions written there.
+func (f *File) preservedBytes(opts WriteOptions) ([]byte, error) {
+	n, err := f.rawLen()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, n)
+	if _, err := f.raw.ReadAt(out, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	put := func(off uint64, b []byte) {
+		if end := off + uint64(len(b)); end > uint64(len(out)) {
+			out = append(out, make([]byte, end-uint64(len(out)))...)
+		}
+		copy(out[off:], b)
+	}
+
+	ehsize := 52
+	if f.Class == ELFCLASS64 {
+		ehsize = 64
+	}
+	if len(out) < ehsize {
+		return nil, errors.New("original file is shorter than its header")
+	}
+	if len(f.Progs) > f.phnum {
+		return nil, errors.New("program header table has grown past its original size")
+	}
+
+	// Update the header fields that the File describes, and keep the
+	// others, such as e_flags, as they were.
+	bo := f.ByteOrder
+	hdr := out[:ehsize]
+	if Data(hdr[EI_DATA]) != f.Data {
+		// The byte order was converted: re-encode e_phoff, e_flags,
+		// e_ehsize and e_phentsize, which are kept.
+		hdr[EI_DATA] = byte(f.Data)
+		if f.Class == ELFCLASS32 {
+			swapFields(hdr[28:32], 4)
+			swapFields(hdr[36:44], 4, 2, 2)
+		} else {
+			swapFields(hdr[32:40], 8)
+			swapFields(hdr[48:56], 4, 2, 2)
+		}
+	}
+	hdr[EI_OSABI] = byte(f.OSABI)
+	hdr[EI_ABIVERSION] = f.ABIVersion
+	bo.PutUint16(hdr[16:], uint16(f.Type))
+	bo.PutUint16(hdr[18:], uint16(f.Machine))
+	bo.PutUint32(hdr[20:], uint32(f.Version))
+	shnum, shstrndx, _, _ := f.sectionHeaderCounts()
+	switch f.Class {
+	case ELFCLASS32:
+		bo.PutUint32(hdr[24:], uint32(f.Entry))
+		bo.PutUint32(hdr[32:], uint32(f.SHTOffset))
+		bo.PutUint16(hdr[44:], uint16(len(f.Progs)))
+		bo.PutUint16(hdr[46:], uint16(f.sectionHeaderSize()))
+		bo.PutUint16(hdr[48:], shnum)
+		bo.PutUint16(hdr[50:], shstrndx)
+	case ELFCLASS64:
+		bo.PutUint64(hdr[24:], f.Entry)
+		bo.PutUint64(hdr[40:], uint64(f.SHTOffset))
+		bo.PutUint16(hdr[56:], uint16(len(f.Progs)))
+		bo.PutUint16(hdr[58:], uint16(f.sectionHeaderSize()))
+		bo.PutUint16(hdr[60:], shnum)
+		bo.PutUint16(hdr[62:], shstrndx)
+	}
+	if len(f.Progs) > 0 {
+		put(uint64(f.phoff), f.progHeaderBytes())
+	}
+
+	for _, s := range f.Sections {
+		if s.Type == SHT_NULL || s.Type == SHT_NOBITS || s.FileSize == 0 {
+			continue
+		}
+		data, err := f.writtenSectionBytes(s, opts)
+		if err != nil {
+			return nil, err
+		}
+		put(s.Offset, data)
+		if s.Type == SHT_PROGBITS && s.Flags&SHF_COMPRESSED == 0 && len(f.Insertion) > 0 && s.Size-uint64(len(data)) >= uint64(len(f.Insertion)) {
+			put(s.Offset+uint64(len(data)), f.Insertion)
+		}
+	}
+	if f.SHTOffset > 0 && len(f.Sections) > 0 {
+		put(uint64(f.SHTOffset), f.sectionHeaderBytes())
+	}
+
+	if len(f.InsertionEOF) > 0 {
+		out = append(out, f.InsertionEOF...)
+	}
+	return out, nil
+}
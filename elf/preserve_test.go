@@ -0,0 +1,80 @@
+package elf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestPreserveRaw(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte("payload that no section or segment describes")
+	orig = append(orig, payload...)
+	// Some bytes past the ELF header that are not part of any field the
+	// writer knows, such as e_flags.
+	orig[48] = 0x5a
+
+	f, err := NewFile(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, payload) {
+		t.Fatal("Bytes kept the payload without PreserveRaw")
+	}
+
+	f.PreserveRaw = true
+	b, err = f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, orig) {
+		t.Fatal("unedited file changed")
+	}
+
+	// Adding a symbol grows .symtab and .strtab, which move past the end
+	// of the original bytes.
+	if err := f.AddSymbol(Symbol{Name: "added", Info: ST_INFO(STB_GLOBAL, STT_FUNC), Section: SHN_ABS, Value: 0x1234}); err != nil {
+		t.Fatal(err)
+	}
+	b, err = f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	syms, err := g.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := findSymbol(syms, "added"); s == nil || s.Value != 0x1234 {
+		t.Errorf("added symbol is %+v", s)
+	}
+	for _, name := range []string{".symtab", ".strtab"} {
+		if s := g.Section(name); s.Offset < uint64(len(orig)) {
+			t.Errorf("%s at %#x is inside the original bytes", name, s.Offset)
+		}
+	}
+	// Only the section headers of the moved sections change in place.
+	sht := int(g.SHTOffset)
+	shtEnd := sht + len(g.Sections)*0x40
+	if !bytes.Equal(b[:sht], orig[:sht]) || !bytes.Equal(b[shtEnd:len(orig)], orig[shtEnd:]) {
+		t.Error("original bytes outside of the section header table changed")
+	}
+	if b[48] != 0x5a {
+		t.Error("e_flags was not kept")
+	}
+
+	f.Progs = append(f.Progs, f.Progs[0])
+	if _, err := f.Bytes(); err == nil {
+		t.Error("Bytes accepted a program header table that does not fit")
+	}
+}
@@ -0,0 +1,281 @@
+package elf
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// OpenProgsOnly opens the named file as NewFileProgsOnly does.
+func OpenProgsOnly(name string) (*File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	ff, err := NewFileProgsOnly(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ff.closer = f
+	return ff, nil
+}
+
+// NewFileProgsOnly creates a File from the file header and program
+// headers of the ELF binary in r, ignoring its section header table,
+// which may be corrupt, truncated or deliberately mangled to defeat
+// analysis tools. The loader never reads that table, so the program
+// headers describe the image as it runs.
+//
+// The Sections of the File are synthesized: a null section, a section
+// for the file contents of each PT_LOAD segment, named .load<index>, with
+// a .load<index>.bss SHT_NOBITS section for the rest of its memory, and
+// .interp and .note<index> for the PT_INTERP and PT_NOTE segments. The
+// dynamic table of the PT_DYNAMIC segment gives .dynamic, .dynstr,
+// .dynsym, whose size is found from the DT_HASH or DT_GNU_HASH table,
+// .hash, the relocation tables and the initialization and termination
+// arrays, so that DynTags, DynamicSymbols, ImportedSymbols and
+// ImportedLibraries work.
+//
+// The synthesized sections overlap the PT_LOAD sections, so Bytes
+// refuses to write the File.
+func NewFileProgsOnly(r io.ReaderAt) (*File, error) {
+	return newFile(r, true)
+}
+
+// synthesizeSections builds the Sections of a file read without its
+// section header table.
+func (f *File) synthesizeSections() error {
+	var sects []*Section
+	add := func(name string, typ SectionType, flags SectionFlag, addr, off, size uint64) *Section {
+		s := &Section{SectionHeader: SectionHeader{
+			Name:      name,
+			Type:      typ,
+			Flags:     flags,
+			Addr:      addr,
+			Offset:    off,
+			Size:      size,
+			FileSize:  size,
+			Addralign: 1,
+		}}
+		s.sr = io.NewSectionReader(f.raw, int64(off), int64(size))
+		s.ReaderAt = s.sr
+		sects = append(sects, s)
+		return s
+	}
+
+	links := make(map[*Section]*Section) // sections to the sections they link to
+	var dynamic *Prog
+	for i, p := range f.Progs {
+		switch p.Type {
+		case PT_LOAD:
+			flags := SHF_ALLOC
+			if p.Flags&PF_W != 0 {
+				flags |= SHF_WRITE
+			}
+			if p.Flags&PF_X != 0 {
+				flags |= SHF_EXECINSTR
+			}
+			if p.Filesz > 0 {
+				add(fmt.Sprintf(".load%d", i), SHT_PROGBITS, flags, p.Vaddr, p.Off, p.Filesz)
+			}
+			if p.Memsz > p.Filesz {
+				add(fmt.Sprintf(".load%d.bss", i), SHT_NOBITS, flags&^SHF_EXECINSTR, p.Vaddr+p.Filesz, p.Off+p.Filesz, p.Memsz-p.Filesz)
+			}
+		case PT_INTERP:
+			add(".interp", SHT_PROGBITS, SHF_ALLOC, p.Vaddr, p.Off, p.Filesz)
+		case PT_NOTE:
+			add(fmt.Sprintf(".note%d", i), SHT_NOTE, SHF_ALLOC, p.Vaddr, p.Off, p.Filesz).Addralign = p.Align
+		case PT_DYNAMIC:
+			dynamic = p
+		}
+	}
+
+	if dynamic != nil {
+		if err := f.synthesizeDynamic(dynamic, add, links); err != nil {
+			return err
+		}
+	}
+
+	// Order the sections by address, as linkers do, with each PT_LOAD
+	// section before those it holds.
+	sort.SliceStable(sects, func(i, j int) bool {
+		if sects[i].Addr != sects[j].Addr {
+			return sects[i].Addr < sects[j].Addr
+		}
+		return sects[i].Size > sects[j].Size
+	})
+	f.Sections = append([]*Section{{SectionHeader: SectionHeader{Type: SHT_NULL}, sr: io.NewSectionReader(f.raw, 0, 0)}}, sects...)
+	for i, s := range f.Sections {
+		s.Shnum = i
+		if s.ReaderAt == nil {
+			s.ReaderAt = s.sr
+		}
+	}
+	for _, s := range f.Sections {
+		if l, ok := links[s]; ok {
+			s.Link = uint32(f.sectionIndex(l))
+		}
+	}
+	f.progsOnly = true
+	return nil
+}
+
+// synthesizeDynamic adds the sections described by the dynamic table of
+// the PT_DYNAMIC segment p with add, and records their links in links.
+func (f *File) synthesizeDynamic(p *Prog, add func(string, SectionType, SectionFlag, uint64, uint64, uint64) *Section, links map[*Section]*Section) error {
+	data := make([]byte, p.Filesz)
+	if _, err := p.ReadAt(data, 0); err != nil && err != io.EOF {
+		return fmt.Errorf("PT_DYNAMIC: %v", err)
+	}
+	tags := make(map[DynTag]uint64)
+	for _, t := range f.decodeDynTags(data) {
+		if t.Tag == DT_NULL {
+			break
+		}
+		if _, ok := tags[t.Tag]; !ok {
+			tags[t.Tag] = t.Value
+		}
+	}
+	// table adds the section at the address held by tag, if it is in the
+	// file contents of a PT_LOAD segment.
+	table := func(name string, typ SectionType, tag DynTag, size uint64) *Section {
+		addr, ok := tags[tag]
+		if !ok || addr == 0 {
+			return nil
+		}
+		off, _, err := f.virtualOffset(addr, size)
+		if err != nil {
+			return nil
+		}
+		return add(name, typ, SHF_ALLOC, addr, off, size)
+	}
+
+	dyn := add(".dynamic", SHT_DYNAMIC, SHF_ALLOC|SHF_WRITE, p.Vaddr, p.Off, p.Filesz)
+	dyn.Entsize = uint64(f.dynEntrySize())
+	dynstr := table(".dynstr", SHT_STRTAB, DT_STRTAB, tags[DT_STRSZ])
+	if dynstr != nil {
+		links[dyn] = dynstr
+	}
+
+	symsize := uint64(Sym64Size)
+	if f.Class == ELFCLASS32 {
+		symsize = Sym32Size
+	}
+	var nsyms uint64
+	hash := table(".hash", SHT_HASH, DT_HASH, 8)
+	if hash != nil {
+		b := make([]byte, 8)
+		if _, err := hash.ReadAt(b, 0); err == nil {
+			nbucket, nchain := uint64(f.ByteOrder.Uint32(b)), uint64(f.ByteOrder.Uint32(b[4:]))
+			hash.Size, hash.FileSize = 4*(2+nbucket+nchain), 4*(2+nbucket+nchain)
+			hash.sr = io.NewSectionReader(f.raw, int64(hash.Offset), int64(hash.Size))
+			hash.ReaderAt = hash.sr
+			nsyms = nchain
+		}
+	}
+	if nsyms == 0 {
+		nsyms, _ = f.gnuHashSymbols(tags[DT_GNU_HASH])
+	}
+	dynsym := table(".dynsym", SHT_DYNSYM, DT_SYMTAB, nsyms*symsize)
+	if dynsym != nil {
+		dynsym.Entsize = symsize
+		dynsym.Info = 1 // the local symbols are not known apart
+		if dynstr != nil {
+			links[dynsym] = dynstr
+		}
+		if hash != nil {
+			links[hash] = dynsym
+		}
+	}
+
+	relsize, relasize := uint64(8), uint64(12)
+	if f.Class == ELFCLASS64 {
+		relsize, relasize = 16, 24
+	}
+	plt, pltType, pltEntsize := ".rel.plt", SHT_REL, relsize
+	if tags[DT_PLTREL] == uint64(DT_RELA) {
+		plt, pltType, pltEntsize = ".rela.plt", SHT_RELA, relasize
+	}
+	for _, r := range []struct {
+		name      string
+		typ       SectionType
+		tag, size DynTag
+		entsize   uint64
+	}{
+		{".rela.dyn", SHT_RELA, DT_RELA, DT_RELASZ, relasize},
+		{".rel.dyn", SHT_REL, DT_REL, DT_RELSZ, relsize},
+		{plt, pltType, DT_JMPREL, DT_PLTRELSZ, pltEntsize},
+	} {
+		if s := table(r.name, r.typ, r.tag, tags[r.size]); s != nil {
+			s.Entsize = r.entsize
+			if dynsym != nil {
+				links[s] = dynsym
+			}
+		}
+	}
+
+	if s := table(".init_array", SHT_INIT_ARRAY, DT_INIT_ARRAY, tags[DT_INIT_ARRAYSZ]); s != nil {
+		s.Flags |= SHF_WRITE
+	}
+	if s := table(".fini_array", SHT_FINI_ARRAY, DT_FINI_ARRAY, tags[DT_FINI_ARRAYSZ]); s != nil {
+		s.Flags |= SHF_WRITE
+	}
+	return nil
+}
+
+// gnuHashSymbols returns the number of dynamic symbols, counted from the
+// GNU hash table at addr: one past the end of the chain of the highest
+// bucket.
+func (f *File) gnuHashSymbols(addr uint64) (uint64, bool) {
+	if addr == 0 {
+		return 0, false
+	}
+	bo := f.ByteOrder
+	read := func(addr, size uint64) []byte {
+		b, err := f.ReadVirtual(addr, size)
+		if err != nil {
+			return nil
+		}
+		return b
+	}
+	hdr := read(addr, 16)
+	if hdr == nil {
+		return 0, false
+	}
+	nbuckets, symoffset, bloomSize := uint64(bo.Uint32(hdr)), uint64(bo.Uint32(hdr[4:])), uint64(bo.Uint32(hdr[8:]))
+	word := uint64(8)
+	if f.Class == ELFCLASS32 {
+		word = 4
+	}
+	bucketsAddr := addr + 16 + bloomSize*word
+	if nbuckets > 1<<24 {
+		return 0, false
+	}
+	buckets := read(bucketsAddr, 4*nbuckets)
+	if buckets == nil {
+		return 0, false
+	}
+	var last uint64
+	for i := uint64(0); i < nbuckets; i++ {
+		if b := uint64(bo.Uint32(buckets[4*i:])); b > last {
+			last = b
+		}
+	}
+	if last < symoffset {
+		return symoffset, true
+	}
+	chains := bucketsAddr + 4*nbuckets
+	for n := 0; n < 1<<24; n++ {
+		b := read(chains+4*(last-symoffset), 4)
+		if b == nil {
+			return 0, false
+		}
+		if bo.Uint32(b)&1 != 0 {
+			return last + 1, true
+		}
+		last++
+	}
+	return 0, false
+}
@@ -0,0 +1,82 @@
+package elf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestNewFileProgsOnly(t *testing.T) {
+	for _, file := range []string{"testdata/gcc-amd64-linux-exec", "testdata/gcc-386-freebsd-exec"} {
+		want, err := Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer want.Close()
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Point e_shoff past the end of the file and garble e_shstrndx.
+		bo := want.ByteOrder
+		if want.Class == ELFCLASS64 {
+			bo.PutUint64(b[40:], uint64(len(b))+0x1000)
+			bo.PutUint16(b[62:], 0xfffe)
+		} else {
+			bo.PutUint32(b[32:], uint32(len(b))+0x1000)
+			bo.PutUint16(b[50:], 0xfffe)
+		}
+		if _, err := NewFile(bytes.NewReader(b)); err == nil {
+			t.Fatalf("%s: NewFile accepted a mangled section header table", file)
+		}
+		f, err := NewFileProgsOnly(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+
+		if f.Sections[0].Type != SHT_NULL || f.Section(".dynamic") == nil || f.Section(".load2") == nil {
+			t.Errorf("%s: sections are %v", file, sectionNames(f))
+		}
+		if text := f.execSectionAt(f.Entry); text == nil || text.Name != ".load2" {
+			t.Errorf("%s: entry point is in %v", file, text)
+		}
+		if !reflect.DeepEqual(f.DynTags, want.DynTags) {
+			t.Errorf("%s: DynTags are %v, want %v", file, f.DynTags, want.DynTags)
+		}
+		if interp, err := f.Interpreter(); err != nil || interp == "" {
+			t.Errorf("%s: Interpreter() = %q, %v", file, interp, err)
+		}
+		libs, err := f.ImportedLibraries()
+		wantLibs, _ := want.ImportedLibraries()
+		if err != nil || !reflect.DeepEqual(libs, wantLibs) {
+			t.Errorf("%s: ImportedLibraries() = %q, %v; want %q", file, libs, err, wantLibs)
+		}
+		syms, err := f.DynamicSymbols()
+		wantSyms, _ := want.DynamicSymbols()
+		if err != nil || len(syms) != len(wantSyms) {
+			t.Fatalf("%s: %d dynamic symbols, %v; want %d", file, len(syms), err, len(wantSyms))
+		}
+		for i := range syms {
+			if syms[i].Name != wantSyms[i].Name || syms[i].Value != wantSyms[i].Value {
+				t.Errorf("%s: dynamic symbol %d is %+v, want %+v", file, i, syms[i], wantSyms[i])
+			}
+		}
+		if rela := f.SectionByType(SHT_RELA); want.Class == ELFCLASS64 && (rela == nil || f.Sections[rela.Link].Type != SHT_DYNSYM) {
+			t.Errorf("%s: relocation section is %+v", file, rela)
+		}
+
+		if _, err := f.Bytes(); err == nil {
+			t.Errorf("%s: Bytes wrote synthesized sections", file)
+		}
+	}
+}
+
+func sectionNames(f *File) []string {
+	var names []string
+	for _, s := range f.Sections {
+		names = append(names, s.Name)
+	}
+	return names
+}
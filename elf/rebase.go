@@ -0,0 +1,283 @@
+package elf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// rebaseTags are the dynamic tags whose values are addresses.
+var rebaseTags = []DynTag{
+	DT_PLTGOT, DT_HASH, DT_STRTAB, DT_SYMTAB, DT_RELA, DT_INIT, DT_FINI, DT_REL, DT_JMPREL,
+	DT_INIT_ARRAY, DT_FINI_ARRAY, DT_PREINIT_ARRAY, DT_RELR, DT_GNU_HASH, DT_VERSYM, DT_VERDEF, DT_VERNEED,
+}
+
+// relativeRelocs returns the types of the dynamic relocations of the
+// machine of f that hold link-time addresses: R_*_RELATIVE and
+// R_*_IRELATIVE, whose addend or field is one, and the jump slots, whose
+// field is one until the symbol is bound lazily.
+func (f *File) relativeRelocs() (relative, irelative, jumpSlot uint32, err error) {
+	switch f.Machine {
+	case EM_X86_64:
+		return uint32(R_X86_64_RELATIVE), uint32(R_X86_64_IRELATIVE), uint32(R_X86_64_JMP_SLOT), nil
+	case EM_386:
+		return uint32(R_386_RELATIVE), uint32(R_386_IRELATIVE), uint32(R_386_JMP_SLOT), nil
+	case EM_AARCH64:
+		return uint32(R_AARCH64_RELATIVE), uint32(R_AARCH64_IRELATIVE), uint32(R_AARCH64_JUMP_SLOT), nil
+	case EM_ARM:
+		return uint32(R_ARM_RELATIVE), uint32(R_ARM_IRELATIVE), uint32(R_ARM_JUMP_SLOT), nil
+	case EM_RISCV:
+		return uint32(R_RISCV_RELATIVE), uint32(R_RISCV_IRELATIVE), uint32(R_RISCV_JUMP_SLOT), nil
+	}
+	return 0, 0, 0, fmt.Errorf("rebasing %v files is not supported", f.Machine)
+}
+
+// Rebase moves a position independent executable or shared object so
+// that its lowest PT_LOAD segment, rounded down to the segment
+// alignment, starts at newBase, as if it had been linked there: the
+// addresses of the segments, the allocated sections, the entry point, the
+// dynamic tags and the defined symbols are moved, the R_*_RELATIVE,
+// R_*_IRELATIVE and DT_RELR relocations are applied to their addends or
+// fields, the link-time addresses that the jump slots hold for lazy
+// binding are moved, and so are the offsets of all dynamic relocations.
+// The loader still maps the file where it likes, adjusting it from
+// newBase instead. Debug information is left alone.
+//
+// Only ET_DYN files of the machines with R_*_RELATIVE relocations can be
+// rebased, and newBase must be a multiple of the alignment of the PT_LOAD
+// segments.
+func (f *File) Rebase(newBase uint64) error {
+	if f.Type != ET_DYN {
+		return fmt.Errorf("cannot rebase a file of type %v", f.Type)
+	}
+	if f.progsOnly {
+		return errors.New("cannot rebase a file read without its section headers")
+	}
+	relative, irelative, jumpSlot, err := f.relativeRelocs()
+	if err != nil {
+		return err
+	}
+	base, align := ^uint64(0), uint64(1)
+	for _, p := range f.Progs {
+		if p.Type != PT_LOAD {
+			continue
+		}
+		if p.Vaddr < base {
+			base = p.Vaddr
+		}
+		if p.Align > align {
+			align = p.Align
+		}
+	}
+	if base == ^uint64(0) {
+		return errors.New("no PT_LOAD segments")
+	}
+	base &^= align - 1
+	if newBase%align != 0 {
+		return fmt.Errorf("base %#x is not a multiple of the segment alignment %#x", newBase, align)
+	}
+	if f.Class == ELFCLASS32 && newBase > 1<<32-1 {
+		return fmt.Errorf("base %#x does not fit a 32-bit file", newBase)
+	}
+	delta := newBase - base
+	if delta == 0 {
+		return nil
+	}
+
+	// The relocation and symbol tables are patched in their contents, and
+	// the relocated words through their link-time addresses.
+	wordSize := uint64(8)
+	if f.Class == ELFCLASS32 {
+		wordSize = 4
+	}
+	patched := make(map[*Section][]byte)
+	data := func(s *Section) ([]byte, error) {
+		d, ok := patched[s]
+		if !ok {
+			var err error
+			if d, err = s.Data(); err != nil {
+				return nil, err
+			}
+			patched[s] = d
+		}
+		return d, nil
+	}
+	getWord := func(b []byte) uint64 {
+		if wordSize == 4 {
+			return uint64(f.ByteOrder.Uint32(b))
+		}
+		return f.ByteOrder.Uint64(b)
+	}
+	putWord := func(b []byte, v uint64) {
+		if wordSize == 4 {
+			f.ByteOrder.PutUint32(b, uint32(v))
+		} else {
+			f.ByteOrder.PutUint64(b, v)
+		}
+	}
+	move := func(b []byte) { putWord(b, getWord(b)+delta) }
+	// moveAt moves the word at the link-time address addr.
+	moveAt := func(addr uint64) error {
+		b, err := f.ReadVirtual(addr, wordSize)
+		if err != nil {
+			return err
+		}
+		move(b)
+		return f.WriteVirtual(addr, b)
+	}
+
+	for _, s := range f.Sections {
+		if s.Flags&SHF_ALLOC == 0 || (s.Type != SHT_REL && s.Type != SHT_RELA) {
+			continue
+		}
+		d, err := data(s)
+		if err != nil {
+			return err
+		}
+		entsize, _ := f.relocEntrySize(s)
+		for e := d; len(e) >= entsize; e = e[entsize:] {
+			off := getWord(e)
+			var typ uint32
+			if f.Class == ELFCLASS64 {
+				typ = R_TYPE64(f.ByteOrder.Uint64(e[8:]))
+			} else {
+				typ = R_TYPE32(f.ByteOrder.Uint32(e[4:]))
+			}
+			switch {
+			case (typ == relative || typ == irelative) && s.Type == SHT_RELA:
+				move(e[2*wordSize:])
+			case typ == relative || typ == irelative:
+				if err := moveAt(off); err != nil {
+					return err
+				}
+			case typ == jumpSlot:
+				if w, err := f.ReadVirtual(off, wordSize); err == nil && getWord(w) != 0 {
+					if err := moveAt(off); err != nil {
+						return err
+					}
+				}
+			}
+			move(e)
+		}
+	}
+
+	if vals := f.DynValue(DT_RELR); len(vals) > 0 {
+		if err := f.rebaseRelr(vals[0], wordSize, moveAt); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range f.Sections {
+		if s.Type != SHT_SYMTAB && s.Type != SHT_DYNSYM {
+			continue
+		}
+		d, err := data(s)
+		if err != nil {
+			return err
+		}
+		f.rebaseSymbols(d, delta)
+	}
+
+	for s, d := range patched {
+		s.Replace(bytes.NewReader(d), int64(len(d)))
+	}
+	for i, t := range f.DynTags[:f.dynEnd()] {
+		for _, tag := range rebaseTags {
+			if t.Tag == tag && t.Value != 0 {
+				f.DynTags[i].Value += delta
+			}
+		}
+	}
+	for _, p := range f.Progs {
+		if p.Vaddr != 0 || p.Memsz != 0 {
+			p.Vaddr += delta
+			p.Paddr += delta
+		}
+	}
+	for _, s := range f.Sections {
+		if s.Flags&SHF_ALLOC != 0 {
+			s.Addr += delta
+		}
+	}
+	f.Entry += delta
+	return nil
+}
+
+// rebaseRelr applies the DT_RELR relocations at addr to the words they
+// relocate, and moves their addresses, with moveAt. Each even entry is
+// the address of a relocated word, and each odd one a bitmap of the words
+// that follow the last address.
+func (f *File) rebaseRelr(addr, wordSize uint64, moveAt func(uint64) error) error {
+	sizes := f.DynValue(DT_RELRSZ)
+	if len(sizes) == 0 {
+		return errors.New("DT_RELR without DT_RELRSZ")
+	}
+	var where uint64
+	for off := uint64(0); off < sizes[0]; off += wordSize {
+		e, err := f.ReadVirtual(addr+off, wordSize)
+		if err != nil {
+			return err
+		}
+		var v uint64
+		if wordSize == 4 {
+			v = uint64(f.ByteOrder.Uint32(e))
+		} else {
+			v = f.ByteOrder.Uint64(e)
+		}
+		if v&1 == 0 {
+			if err := moveAt(v); err != nil {
+				return err
+			}
+			if err := moveAt(addr + off); err != nil {
+				return err
+			}
+			where = v + wordSize
+			continue
+		}
+		for i := uint64(0); v>>1 != 0; i++ {
+			v >>= 1
+			if v&1 != 0 {
+				if err := moveAt(where + i*wordSize); err != nil {
+					return err
+				}
+			}
+		}
+		where += (8*wordSize - 1) * wordSize
+	}
+	return nil
+}
+
+// rebaseSymbols moves by delta the values of the symbols defined in a
+// section in the symbol table contents d, other than thread-local ones,
+// whose values are offsets.
+func (f *File) rebaseSymbols(d []byte, delta uint64) {
+	bo := f.ByteOrder
+	if f.Class == ELFCLASS32 {
+		for e := d; len(e) >= Sym32Size; e = e[Sym32Size:] {
+			if symMoves(e[12], bo.Uint16(e[14:])) {
+				bo.PutUint32(e[4:], bo.Uint32(e[4:])+uint32(delta))
+			}
+		}
+		return
+	}
+	for e := d; len(e) >= Sym64Size; e = e[Sym64Size:] {
+		if symMoves(e[4], bo.Uint16(e[6:])) {
+			bo.PutUint64(e[8:], bo.Uint64(e[8:])+delta)
+		}
+	}
+}
+
+// symMoves reports whether a symbol with the given info and section
+// index has an address as its value.
+func symMoves(info uint8, shndx uint16) bool {
+	if ST_TYPE(info) == STT_TLS {
+		return false
+	}
+	switch SectionIndex(shndx) {
+	case SHN_UNDEF, SHN_ABS, SHN_COMMON:
+		return false
+	case SHN_XINDEX:
+		return true
+	}
+	return SectionIndex(shndx) < SHN_LORESERVE
+}
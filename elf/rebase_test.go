@@ -0,0 +1,128 @@
+package elf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestRebaseExec(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Rebase(0x10000000); err == nil {
+		t.Error("Rebase moved an ET_EXEC file")
+	}
+}
+
+func TestRebaseRun(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("requires linux/amd64")
+	}
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc not found")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "pie.c")
+	// p is set by an R_X86_64_RELATIVE relocation, and puts is bound
+	// lazily through its jump slot.
+	prog := `
+#include <stdio.h>
+int x = 42;
+int *p = &x;
+int main(void) { puts("rebased"); return *p == 42 && p == &x ? 0 : 1; }
+`
+	if err := ioutil.WriteFile(src, []byte(prog), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, relr := range []bool{false, true} {
+		exe := filepath.Join(dir, "pie")
+		args := []string{"-O0", "-fPIE", "-pie", "-Wl,-z,lazy", "-o", exe, src}
+		if relr {
+			args = append(args, "-Wl,-z,pack-relative-relocs")
+		}
+		if out, err := exec.Command("gcc", args...).CombinedOutput(); err != nil {
+			if relr {
+				t.Logf("no DT_RELR support: %v\n%s", err, out)
+				continue
+			}
+			t.Skipf("gcc: %v\n%s", err, out)
+		}
+
+		f, err := Open(exe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, err := f.SymbolIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		main, ok := x.Lookup("main")
+		if !ok {
+			t.Fatal("main not found")
+		}
+		if err := f.Rebase(0x10000800); err == nil {
+			t.Error("Rebase accepted an unaligned base")
+		}
+		const base = 0x10000000
+		if err := f.Rebase(base); err != nil {
+			t.Fatal(err)
+		}
+		b, err := f.Bytes()
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		g, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		gx, err := g.SymbolIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m, _ := gx.Lookup("main"); m.Value != main.Value+base {
+			t.Errorf("main is at %#x, want %#x", m.Value, main.Value+base)
+		}
+		// p holds the address of x, in its RELATIVE relocation or, with
+		// DT_RELR, in place.
+		xs, _ := gx.Lookup("x")
+		ps, _ := gx.Lookup("p")
+		var addr uint64
+		if relr {
+			data := make([]byte, 8)
+			if _, err := g.Section(".data").ReadAt(data, int64(ps.Value-g.Section(".data").Addr)); err != nil {
+				t.Fatal(err)
+			}
+			addr = g.ByteOrder.Uint64(data)
+		} else {
+			relocs, err := g.Relocs(g.Section(".rela.dyn"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range relocs {
+				if r.Off == ps.Value && r.Type == uint32(R_X86_64_RELATIVE) {
+					addr = uint64(r.Addend)
+				}
+			}
+		}
+		if addr != xs.Value {
+			t.Errorf("relr=%v: p holds %#x, want the address of x %#x", relr, addr, xs.Value)
+		}
+
+		rebased := filepath.Join(dir, "rebased")
+		if err := ioutil.WriteFile(rebased, b, 0755); err != nil {
+			t.Fatal(err)
+		}
+		out, err := exec.Command(rebased).CombinedOutput()
+		if err != nil || string(out) != "rebased\n" {
+			t.Errorf("relr=%v: rebased program: %v\n%s", relr, err, out)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package elf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Pointer encodings of .eh_frame (DW_EH_PE_*).
+const (
+	ehPEAbsptr  = 0x00
+	ehPEUleb128 = 0x01
+	ehPEUdata2  = 0x02
+	ehPEUdata4  = 0x03
+	ehPEUdata8  = 0x04
+	ehPESleb128 = 0x09
+	ehPESdata2  = 0x0a
+	ehPESdata4  = 0x0b
+	ehPESdata8  = 0x0c
+	ehPEPcrel   = 0x10
+	ehPEOmit    = 0xff
+)
+
+// IsStripped reports whether f has no symbol table, or one that defines
+// no function.
+func (f *File) IsStripped() bool {
+	syms, err := f.Symbols()
+	if err != nil {
+		return true
+	}
+	for _, s := range syms {
+		if ST_TYPE(s.Info) == STT_FUNC && s.Section != SHN_UNDEF && s.Section < SHN_LORESERVE {
+			return false
+		}
+	}
+	return true
+}
+
+// RecoverFunctionBounds returns approximate function symbols for a linked
+// image without a symbol table, sorted by address. Functions are found
+// from the FDEs of .eh_frame, which give their exact bounds, from the
+// entry point, and on x86 from frame pointer prologues, such as
+// "push %rbp; mov %rsp,%rbp", found in executable sections at aligned
+// addresses or right after a return or padding. The size of a function
+// found without an FDE reaches up to the next function or the end of its
+// section.
+//
+// The symbols are local functions named sub_<address>, except for those
+// at the address of a function of the dynamic symbol table, which take
+// its name and, if it has one, its size.
+func (f *File) RecoverFunctionBounds() ([]Symbol, error) {
+	if f.Type == ET_REL {
+		return nil, errors.New("function bounds are only recovered for linked images")
+	}
+	sizes := make(map[uint64]uint64) // start to size, 0 if not known
+	if s := f.Section(".eh_frame"); s != nil && s.Type != SHT_NOBITS {
+		data, err := s.Data()
+		if err != nil {
+			return nil, err
+		}
+		fdes, err := f.ehFrameFDEs(data, s.Addr)
+		if err != nil {
+			return nil, err
+		}
+		for _, fde := range fdes {
+			if fde[1] > sizes[fde[0]] {
+				sizes[fde[0]] = fde[1]
+			}
+		}
+	}
+	// spans are the [start, end) ranges of the FDEs, sorted and with
+	// overlapping ones merged, so that covered can search them.
+	var spans [][2]uint64
+	for start, size := range sizes {
+		if size > 0 {
+			spans = append(spans, [2]uint64{start, start + size})
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	merged := spans[:0]
+	for _, sp := range spans {
+		if k := len(merged) - 1; k >= 0 && sp[0] < merged[k][1] {
+			if sp[1] > merged[k][1] {
+				merged[k][1] = sp[1]
+			}
+			continue
+		}
+		merged = append(merged, sp)
+	}
+	spans = merged
+	// covered reports whether addr is inside a function, past its start.
+	covered := func(addr uint64) bool {
+		i := sort.Search(len(spans), func(i int) bool { return spans[i][1] > addr })
+		return i < len(spans) && spans[i][0] < addr
+	}
+	if f.execSectionAt(f.Entry) != nil {
+		if _, ok := sizes[f.Entry]; !ok {
+			sizes[f.Entry] = 0
+		}
+	}
+	for _, addr := range f.prologues() {
+		if _, ok := sizes[addr]; !ok && !covered(addr) {
+			sizes[addr] = 0
+		}
+	}
+
+	names := make(map[uint64]Symbol)
+	if dyn, err := f.DynamicSymbols(); err == nil {
+		for _, s := range dyn {
+			if ST_TYPE(s.Info) == STT_FUNC && s.Section != SHN_UNDEF && s.Section < SHN_LORESERVE {
+				names[s.Value] = s
+			}
+		}
+	}
+
+	starts := make([]uint64, 0, len(sizes))
+	for addr := range sizes {
+		starts = append(starts, addr)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	var out []Symbol
+	for i, addr := range starts {
+		sect := f.execSectionAt(addr)
+		if sect == nil {
+			continue
+		}
+		size := sizes[addr]
+		if size == 0 {
+			end := sect.Addr + sect.Size
+			if i+1 < len(starts) && starts[i+1] < end {
+				end = starts[i+1]
+			}
+			size = end - addr
+		}
+		sym := Symbol{
+			Name:    fmt.Sprintf("sub_%x", addr),
+			Info:    ST_INFO(STB_LOCAL, STT_FUNC),
+			Section: SectionIndex(f.sectionIndex(sect)),
+			Value:   addr,
+			Size:    size,
+		}
+		if d, ok := names[addr]; ok {
+			sym.Name = d.Name
+			if d.Size != 0 {
+				sym.Size = d.Size
+			}
+		}
+		out = append(out, sym)
+	}
+	return out, nil
+}
+
+// execSectionAt returns the executable section of f holding addr, or nil.
+func (f *File) execSectionAt(addr uint64) *Section {
+	for _, s := range f.Sections {
+		if s.Flags&SHF_EXECINSTR != 0 && s.Flags&SHF_ALLOC != 0 && addr >= s.Addr && addr-s.Addr < s.Size {
+			return s
+		}
+	}
+	return nil
+}
+
+// sectionIndex returns the index of s in f.Sections.
+func (f *File) sectionIndex(s *Section) int {
+	for i, t := range f.Sections {
+		if t == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// prologues returns the addresses of the frame pointer prologues in the
+// executable sections of an x86 file.
+func (f *File) prologues() []uint64 {
+	var patterns [][]byte
+	switch f.Machine {
+	case EM_X86_64:
+		patterns = [][]byte{
+			{0x55, 0x48, 0x89, 0xe5},             // push %rbp; mov %rsp,%rbp
+			{0xf3, 0x0f, 0x1e, 0xfa, 0x55, 0x48}, // endbr64; push %rbp; mov ...
+		}
+	case EM_386:
+		patterns = [][]byte{
+			{0x55, 0x89, 0xe5},                   // push %ebp; mov %esp,%ebp
+			{0xf3, 0x0f, 0x1e, 0xfb, 0x55, 0x89}, // endbr32; push %ebp; mov ...
+		}
+	default:
+		return nil
+	}
+	var addrs []uint64
+	for _, s := range f.Sections {
+		if s.Flags&SHF_EXECINSTR == 0 || s.Flags&SHF_ALLOC == 0 || s.Type == SHT_NOBITS {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			continue
+		}
+		for _, p := range patterns {
+			for off := 0; ; {
+				i := bytes.Index(data[off:], p)
+				if i < 0 {
+					break
+				}
+				off += i
+				addr := s.Addr + uint64(off)
+				if addr%16 == 0 || off > 0 && isPadding(data[off-1]) {
+					addrs = append(addrs, addr)
+				}
+				off++
+			}
+		}
+	}
+	return addrs
+}
+
+// isPadding reports whether b is a byte that ends a function or pads the
+// space between functions: ret, int3, nop or hlt.
+func isPadding(b byte) bool {
+	switch b {
+	case 0xc3, 0xcc, 0x90, 0xf4:
+		return true
+	}
+	return false
+}
+
+// ehFrameFDEs returns the start address and size of the functions
+// described by the FDEs of the .eh_frame contents data, loaded at addr.
+// FDEs with pointer encodings other than absolute and PC-relative are
+// skipped.
+func (f *File) ehFrameFDEs(data []byte, addr uint64) ([][2]uint64, error) {
+	bo := f.ByteOrder
+	encodings := make(map[int]byte) // CIE offset to FDE pointer encoding
+	var fdes [][2]uint64
+	for off := 0; off+4 <= len(data); {
+		length := uint64(bo.Uint32(data[off:]))
+		hdr := 4
+		if length == 0xffffffff {
+			if off+12 > len(data) {
+				return nil, fmt.Errorf(".eh_frame entry at %#x is truncated", off)
+			}
+			length, hdr = bo.Uint64(data[off+4:]), 12
+		}
+		if length == 0 {
+			break // terminator
+		}
+		idOff := off + hdr
+		end := uint64(idOff) + length
+		if length < 4 || end > uint64(len(data)) {
+			return nil, fmt.Errorf(".eh_frame entry at %#x of %d bytes is truncated", off, length)
+		}
+		rec := data[:end]
+		id := bo.Uint32(rec[idOff:])
+		if id == 0 {
+			enc, err := f.cieFDEEncoding(rec, idOff+4)
+			if err != nil {
+				return nil, fmt.Errorf(".eh_frame CIE at %#x: %v", off, err)
+			}
+			encodings[off] = enc
+		} else if enc, ok := encodings[idOff-int(id)]; ok && enc != ehPEOmit {
+			p := idOff + 4
+			start, p, ok1 := f.readEHPointer(rec, p, enc, addr)
+			size, _, ok2 := f.readEHPointer(rec, p, enc&0x0f, addr)
+			if ok1 && ok2 && size > 0 {
+				fdes = append(fdes, [2]uint64{start, size})
+			}
+		}
+		off = int(end)
+	}
+	return fdes, nil
+}
+
+// cieFDEEncoding returns the pointer encoding of the FDEs of the CIE
+// whose fields start at off in rec.
+func (f *File) cieFDEEncoding(rec []byte, off int) (byte, error) {
+	if off >= len(rec) {
+		return 0, errors.New("truncated")
+	}
+	version := rec[off]
+	off++
+	n := bytes.IndexByte(rec[off:], 0)
+	if n < 0 {
+		return 0, errors.New("unterminated augmentation")
+	}
+	aug := string(rec[off : off+n])
+	off += n + 1
+	if len(aug) >= 2 && aug[:2] == "eh" {
+		return ehPEOmit, nil // GCC 2 layout, not in use
+	}
+	var err error
+	for i := 0; i < 2; i++ { // code and data alignment factors
+		if _, off, err = readULEB(rec, off); err != nil {
+			return 0, errors.New("truncated")
+		}
+	}
+	if version == 1 {
+		off++
+	} else if _, off, err = readULEB(rec, off); err != nil {
+		return 0, errors.New("truncated")
+	}
+	if aug == "" || aug[0] != 'z' {
+		return ehPEAbsptr, nil
+	}
+	if _, off, err = readULEB(rec, off); err != nil {
+		return 0, errors.New("truncated")
+	}
+	for _, c := range aug[1:] {
+		if off >= len(rec) {
+			return 0, errors.New("truncated augmentation data")
+		}
+		switch c {
+		case 'R':
+			return rec[off], nil
+		case 'L':
+			off++
+		case 'P':
+			enc := rec[off]
+			var ok bool
+			if _, off, ok = f.readEHPointer(rec, off+1, enc&0x0f, 0); !ok {
+				return ehPEOmit, nil
+			}
+		case 'S', 'B':
+		default:
+			return ehPEOmit, nil
+		}
+	}
+	return ehPEAbsptr, nil
+}
+
+// readEHPointer reads the pointer encoded with enc at off in rec, which
+// is loaded at addr, and returns it and the offset that follows it. ok is
+// false for encodings it does not decode; LEB128 pointers are only
+// skipped, and read as 0.
+func (f *File) readEHPointer(rec []byte, off int, enc byte, addr uint64) (v uint64, next int, ok bool) {
+	format := enc & 0x0f
+	if format == ehPEAbsptr {
+		format = ehPEUdata8
+		if f.Class == ELFCLASS32 {
+			format = ehPEUdata4
+		}
+	}
+	size := 0
+	switch format {
+	case ehPEUdata2, ehPESdata2:
+		size = 2
+	case ehPEUdata4, ehPESdata4:
+		size = 4
+	case ehPEUdata8, ehPESdata8:
+		size = 8
+	case ehPEUleb128, ehPESleb128:
+		_, next, err := readULEB(rec, off)
+		return 0, next, err == nil
+	default:
+		return 0, 0, false
+	}
+	if off+size > len(rec) {
+		return 0, 0, false
+	}
+	bo := f.ByteOrder
+	switch format {
+	case ehPEUdata2:
+		v = uint64(bo.Uint16(rec[off:]))
+	case ehPESdata2:
+		v = uint64(int16(bo.Uint16(rec[off:])))
+	case ehPEUdata4:
+		v = uint64(bo.Uint32(rec[off:]))
+	case ehPESdata4:
+		v = uint64(int32(bo.Uint32(rec[off:])))
+	default:
+		v = bo.Uint64(rec[off:])
+	}
+	switch enc & 0x70 {
+	case 0:
+	case ehPEPcrel:
+		v += addr + uint64(off)
+	default:
+		return 0, 0, false
+	}
+	if f.Class == ELFCLASS32 {
+		v = uint64(uint32(v))
+	}
+	return v, off + size, true
+}
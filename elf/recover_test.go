@@ -0,0 +1,55 @@
+package elf
+
+import (
+	"testing"
+)
+
+func TestRecoverFunctionBounds(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.IsStripped() {
+		t.Error("IsStripped reports a file with a symbol table as stripped")
+	}
+
+	syms, err := f.RecoverFunctionBounds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[uint64]Symbol)
+	for _, s := range syms {
+		got[s.Value] = s
+	}
+	// The FDEs give the bounds of main, __libc_csu_fini and
+	// __libc_csu_init, the entry point is _start, and
+	// __do_global_ctors_aux starts with a frame pointer prologue. The
+	// functions between _start and main are not found, so _start reaches
+	// up to main.
+	for _, want := range []struct {
+		name       string
+		addr, size uint64
+	}{
+		{"main", 0x400498, 27},
+		{"__libc_csu_fini", 0x4004c0, 2},
+		{"__libc_csu_init", 0x4004d0, 137},
+		{"_start", 0x4003e0, 0x400498 - 0x4003e0},
+		{"__do_global_ctors_aux", 0x400560, 0x34},
+	} {
+		s, ok := got[want.addr]
+		if !ok || s.Size != want.size || s.Name == "" || f.Sections[s.Section].Name != ".text" {
+			t.Errorf("%s: recovered %+v, want %#x+%d in .text", want.name, s, want.addr, want.size)
+		}
+	}
+	for i := 1; i < len(syms); i++ {
+		if syms[i-1].Value+syms[i-1].Size > syms[i].Value {
+			t.Errorf("%+v overlaps %+v", syms[i-1], syms[i])
+		}
+	}
+
+	f.Section(".symtab").Type = SHT_NULL
+	if !f.IsStripped() {
+		t.Error("IsStripped reports a file without a symbol table as not stripped")
+	}
+}
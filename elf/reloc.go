@@ -0,0 +1,170 @@
+package elf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// relocTypeNumber is the type of a relocation of a machine this package
+// has no names for.
+type relocTypeNumber uint32
+
+func (i relocTypeNumber) String() string { return strconv.FormatUint(uint64(i), 10) }
+
+// RelocType returns the relocation type typ of machine m as the type
+// this package defines for the relocations of m, such as R_X86_64 for
+// EM_X86_64, whose String method returns the name of the relocation.
+// Types of other machines print as decimal numbers.
+func RelocType(m Machine, typ uint32) fmt.Stringer {
+	switch m {
+	case EM_X86_64:
+		return R_X86_64(typ)
+	case EM_386, EM_486:
+		return R_386(typ)
+	case EM_AARCH64:
+		return R_AARCH64(typ)
+	case EM_ARM:
+		return R_ARM(typ)
+	case EM_RISCV:
+		return R_RISCV(typ)
+	case EM_MIPS, EM_MIPS_RS3_LE:
+		return R_MIPS(typ)
+	case EM_PPC:
+		return R_PPC(typ)
+	case EM_PPC64:
+		return R_PPC64(typ)
+	case EM_S390:
+		return R_390(typ)
+	case EM_SPARC, EM_SPARC32PLUS, EM_SPARCV9:
+		return R_SPARC(typ)
+	case EM_ALPHA, EM_ALPHA_STD:
+		return R_ALPHA(typ)
+	case EM_BPF:
+		return R_BPF(typ)
+	}
+	return relocTypeNumber(typ)
+}
+
+// A Reloc is an entry of a relocation section, decoded for the machine of
+// the file.
+type Reloc struct {
+	Off     uint64 // offset in the section relocated, or virtual address in linked files
+	Sym     uint32 // index of the symbol in the linked symbol table, counting the null symbol
+	Type    uint32 // machine specific type; see RelocType
+	Addend  int64
+	Rela    bool // whether Addend was read from the entry, rather than being stored in the relocated field
+	Machine Machine
+
+	// SymName is the name of symbol Sym, or of its section for a section
+	// symbol. It is empty if there is no symbol.
+	SymName string
+}
+
+// String returns r in the form "0x15 R_X86_64_PC32 puts-0x4", with the
+// addend only if the entry has one.
+func (r Reloc) String() string {
+	s := fmt.Sprintf("%#x %v", r.Off, RelocType(r.Machine, r.Type))
+	target := r.SymName
+	if target == "" && r.Sym != 0 {
+		target = "sym" + strconv.FormatUint(uint64(r.Sym), 10)
+	}
+	switch {
+	case !r.Rela:
+	case target == "":
+		target = fmt.Sprintf("%#x", r.Addend)
+	case r.Addend < 0:
+		target += fmt.Sprintf("-%#x", -uint64(r.Addend))
+	default:
+		target += fmt.Sprintf("+%#x", r.Addend)
+	}
+	if target != "" {
+		s += " " + target
+	}
+	return s
+}
+
+// Relocs decodes the entries of the SHT_REL or SHT_RELA section s. The
+// symbols are named after the symbol table that s links to.
+//
+// In 64-bit MIPS files, which pack up to three types into an entry, Type
+// is the first one.
+func (f *File) Relocs(s *Section) ([]Reloc, error) {
+	if s.Type != SHT_REL && s.Type != SHT_RELA {
+		return nil, fmt.Errorf("section %s is of type %v, not a relocation section", s.Name, s.Type)
+	}
+	var syms []Symbol
+	if int(s.Link) < len(f.Sections) {
+		if typ := f.Sections[s.Link].Type; typ == SHT_SYMTAB || typ == SHT_DYNSYM {
+			var err error
+			syms, _, err = f.getSymbols(typ)
+			if err != nil && err != ErrNoSymbols {
+				return nil, err
+			}
+		}
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	entsize, _ := f.relocEntrySize(s)
+	if len(data)%entsize != 0 {
+		return nil, fmt.Errorf("size of section %s is not a multiple of %d", s.Name, entsize)
+	}
+	mips64 := f.Class == ELFCLASS64 && (f.Machine == EM_MIPS || f.Machine == EM_MIPS_RS3_LE)
+	relocs := make([]Reloc, len(data)/entsize)
+	f.forEachChunk(len(relocs), func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			relocs[i] = f.decodeReloc(data[i*entsize:(i+1)*entsize], s.Type == SHT_RELA, mips64, syms)
+		}
+	})
+	return relocs, nil
+}
+
+// relocEntrySize returns the size of the entries of the relocation section
+// r and of their r_offset field.
+func (f *File) relocEntrySize(r *Section) (entsize, offSize int) {
+	switch {
+	case f.Class == ELFCLASS64 && r.Type == SHT_RELA:
+		return 24, 8
+	case f.Class == ELFCLASS64:
+		return 16, 8
+	case r.Type == SHT_RELA:
+		return 12, 4
+	}
+	return 8, 4
+}
+
+// decodeReloc decodes the relocation entry data, naming its symbol after
+// the symbol table syms.
+func (f *File) decodeReloc(data []byte, rela, mips64 bool, syms []Symbol) Reloc {
+	r := Reloc{Rela: rela, Machine: f.Machine}
+	if f.Class == ELFCLASS64 {
+		r.Off = f.ByteOrder.Uint64(data)
+		info := f.ByteOrder.Uint64(data[8:])
+		r.Sym, r.Type = R_SYM64(info), R_TYPE64(info)
+		if mips64 && f.ByteOrder == binary.LittleEndian {
+			r.Sym, r.Type = uint32(info), uint32(info>>56)
+		} else if mips64 {
+			r.Type &= 0xff
+		}
+		if r.Rela {
+			r.Addend = int64(f.ByteOrder.Uint64(data[16:]))
+		}
+	} else {
+		r.Off = uint64(f.ByteOrder.Uint32(data))
+		info := f.ByteOrder.Uint32(data[4:])
+		r.Sym, r.Type = R_SYM32(info), R_TYPE32(info)
+		if r.Rela {
+			r.Addend = int64(int32(f.ByteOrder.Uint32(data[8:])))
+		}
+	}
+	if r.Sym != 0 && int(r.Sym) <= len(syms) {
+		sym := &syms[r.Sym-1]
+		r.SymName = sym.Name
+		if r.SymName == "" && ST_TYPE(sym.Info) == STT_SECTION && int(sym.Section) < len(f.Sections) {
+			r.SymName = f.Sections[sym.Section].Name
+		}
+	}
+	return r
+}
@@ -0,0 +1,60 @@
+package elf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRelocs(t *testing.T) {
+	for _, c := range []struct {
+		file, section string
+		want          []string
+	}{
+		{"testdata/compressed-64.obj", ".rela.text", []string{"0x10 R_X86_64_32 .rodata+0x0", "0x15 R_X86_64_PC32 puts-0x4"}},
+		{"testdata/compressed-32.obj", ".rel.text", []string{"0xc R_386_32 .rodata", "0x11 R_386_PC32 puts"}},
+		{"testdata/go-relocation-test-gcc493-mips64le.obj", ".rela.text", []string{"0x14 R_MIPS_GPREL16 main+0x0"}},
+		{"testdata/go-relocation-test-gcc492-mips64.obj", ".rela.text", []string{"0x14 R_MIPS_GPREL16 main+0x0"}},
+	} {
+		f, err := Open(c.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		relocs, err := f.Relocs(f.Section(c.section))
+		if err != nil {
+			t.Fatalf("%s: %v", c.file, err)
+		}
+		var got []string
+		for _, r := range relocs[:len(c.want)] {
+			got = append(got, r.String())
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: relocations are %q, want %q", c.file, got, c.want)
+		}
+		if _, err := f.Relocs(f.Section(".text")); err == nil {
+			t.Errorf("%s: Relocs decoded .text", c.file)
+		}
+	}
+}
+
+func TestRelocType(t *testing.T) {
+	for _, c := range []struct {
+		m    Machine
+		typ  uint32
+		want string
+	}{
+		{EM_X86_64, 2, "R_X86_64_PC32"},
+		{EM_AARCH64, 257, "R_AARCH64_ABS64"},
+		{EM_ARM, 2, "R_ARM_ABS32"},
+		{EM_RISCV, 18, "R_RISCV_CALL"},
+		{EM_VAX, 3, "3"},
+	} {
+		if got := RelocType(c.m, c.typ).String(); got != c.want {
+			t.Errorf("RelocType(%v, %d) = %s, want %s", c.m, c.typ, got, c.want)
+		}
+	}
+	r := Reloc{Off: 8, Type: 3, Machine: EM_X86_64, Rela: true, Addend: 0x10}
+	if got, want := r.String(), "0x8 R_X86_64_GOT32 0x10"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
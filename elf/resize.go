@@ -0,0 +1,322 @@
+package elf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// dynSizeTags maps the dynamic tags that hold the address of a section
+// to the tag holding its size, or to DT_NULL if there is none.
+var dynSizeTags = map[DynTag]DynTag{
+	DT_STRTAB:        DT_STRSZ,
+	DT_SYMTAB:        DT_NULL,
+	DT_HASH:          DT_NULL,
+	DT_RELA:          DT_RELASZ,
+	DT_REL:           DT_RELSZ,
+	DT_JMPREL:        DT_PLTRELSZ,
+	DT_INIT_ARRAY:    DT_INIT_ARRAYSZ,
+	DT_FINI_ARRAY:    DT_FINI_ARRAYSZ,
+	DT_PREINIT_ARRAY: DT_PREINIT_ARRAYSZ,
+	DT_VERSYM:        DT_NULL,
+	DT_VERNEED:       DT_NULL,
+}
+
+// ResizeSection replaces the contents of the named section with data,
+// moving the section if data does not fit where it is. The first of
+// these that works is used:
+//
+//   - data that fits in the section, or in the unused file space (and,
+//     for a loaded section, address space) that follows it, is stored in
+//     place, growing the PT_LOAD segment the section ends if needed;
+//   - a loaded section is moved to the end of a PT_LOAD segment with the
+//     same permissions that can grow into the padding before the next
+//     segment;
+//   - the section is moved to the end of the file. A loaded section gets
+//     a new PT_LOAD segment there, which needs room for another program
+//     header before the first section and is not possible with
+//     PreserveRaw.
+//
+// Segments other than PT_LOAD that cover exactly the section, such as
+// PT_INTERP or PT_NOTE, and the dynamic table entries holding its address
+// and size follow it. A TLS section keeps the PT_TLS segment fitted to
+// the TLS sections, and the zero-filled ones after it, such as .tbss,
+// follow its end; it can only move if it is the only TLS section with
+// contents. Other references to a moved loaded section, such as code
+// addressing it, or to the thread-local variables after a resized TLS
+// section, are left for the caller to update.
+func (f *File) ResizeSection(name string, data []byte) error {
+	s := f.Section(name)
+	switch {
+	case s == nil:
+		return fmt.Errorf("no section %s", name)
+	case s.Type == SHT_NULL || s.Type == SHT_NOBITS:
+		return fmt.Errorf("section %s has no contents in the file", name)
+	case s.Type == SHT_DYNAMIC:
+		return errors.New("the dynamic section is written from DynTags")
+	case s.Flags&SHF_COMPRESSED != 0:
+		return fmt.Errorf("section %s is compressed", name)
+	}
+	size := uint64(len(data))
+	oldOff, oldAddr, oldSize := s.Offset, s.Addr, s.FileSize
+	var load *Prog
+	if s.Flags&SHF_ALLOC != 0 {
+		load = f.sectionLoad(s)
+	}
+	var tls *Prog
+	if s.Flags&SHF_TLS != 0 {
+		tls = f.tlsProg()
+	}
+
+	inPlace := size <= oldSize || f.roomAfter(s, load, size)
+	if !inPlace && tls != nil {
+		// The template moves with s, which it must start at its
+		// alignment.
+		if !f.onlyTLSData(s) {
+			return fmt.Errorf("no room for %d bytes of %s, which cannot move away from the other TLS sections", size, name)
+		}
+		if tls.Align > s.Addralign {
+			s.Addralign = tls.Align
+		}
+	}
+	switch {
+	case inPlace:
+		if load != nil && s.Offset+size > load.Off+load.Filesz {
+			grow := s.Offset + size - (load.Off + load.Filesz)
+			load.Filesz += grow
+			load.Memsz += grow
+		}
+	case load != nil && f.moveToLoad(s, size):
+	case load != nil:
+		if err := f.moveToNewLoad(s, data); err != nil {
+			return err
+		}
+	default:
+		align := s.Addralign
+		if align == 0 {
+			align = 1
+		}
+		s.Offset = alignUp(f.fileEnd(), align)
+	}
+	s.Replace(bytes.NewReader(data), int64(size))
+
+	if tls != nil {
+		f.moveTLS(tls, s, oldAddr, oldOff, oldSize)
+	}
+	for _, p := range f.Progs {
+		if p.Type == PT_LOAD || p.Type == PT_TLS || p.Off != oldOff || p.Filesz != oldSize || oldSize == 0 {
+			continue
+		}
+		if p.Memsz == p.Filesz {
+			p.Memsz = size
+		}
+		p.Filesz = size
+		p.Off = s.Offset
+		p.Vaddr += s.Addr - oldAddr
+		p.Paddr += s.Addr - oldAddr
+	}
+	if load != nil {
+		for i, t := range f.DynTags[:f.dynEnd()] {
+			sizeTag, ok := dynSizeTags[t.Tag]
+			if !ok || t.Value != oldAddr {
+				continue
+			}
+			f.DynTags[i].Value = s.Addr
+			for j, u := range f.DynTags[:f.dynEnd()] {
+				if sizeTag != DT_NULL && u.Tag == sizeTag && u.Value == oldSize {
+					f.DynTags[j].Value = size
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// alignUp rounds v up to a multiple of align, taking an align of 0 as 1.
+// It returns ^uint64(0), past the end of any file, if the result does not
+// fit in 64 bits.
+func alignUp(v, align uint64) uint64 {
+	if align <= 1 {
+		return v
+	}
+	if v > ^uint64(0)-(align-1) {
+		return ^uint64(0)
+	}
+	return (v + align - 1) / align * align
+}
+
+// sectionLoad returns the PT_LOAD segment holding the contents of s, or
+// nil.
+func (f *File) sectionLoad(s *Section) *Prog {
+	for _, p := range f.Progs {
+		if p.Type == PT_LOAD && p.Off <= s.Offset && s.Offset+s.FileSize <= p.Off+p.Filesz {
+			return p
+		}
+	}
+	return nil
+}
+
+// roomAfter reports whether section s, held by the PT_LOAD segment load
+// or by none, can grow to size bytes where it is: no other section,
+// segment or the section header table uses the file range it grows into,
+// no other loaded section uses its address range, and load can be grown
+// if the section grows past its end.
+func (f *File) roomAfter(s *Section, load *Prog, size uint64) bool {
+	off, end := s.Offset+s.FileSize, s.Offset+size
+	overlaps := func(o, n, start, end uint64) bool {
+		return n != 0 && o < end && start < o+n
+	}
+	if load != nil && end > load.Off+load.Filesz && !f.canGrowLoad(load, end-(load.Off+load.Filesz)) {
+		return false
+	}
+	for _, t := range f.Sections {
+		if t == s {
+			continue
+		}
+		if t.Type != SHT_NULL && t.Type != SHT_NOBITS && overlaps(t.Offset, t.FileSize, off, end) {
+			return false
+		}
+		// Zero-filled TLS sections, such as .tbss, only take memory in
+		// the TLS template, and follow the sections before them there.
+		tbss := t.Type == SHT_NOBITS && t.Flags&SHF_TLS != 0
+		if load != nil && t.Flags&SHF_ALLOC != 0 && !tbss && overlaps(t.Addr, t.Size, s.Addr+s.FileSize, s.Addr+size) {
+			return false
+		}
+	}
+	for _, p := range f.Progs {
+		// Segments that cover exactly the section follow it, and those
+		// that hold all it grows into, such as PT_GNU_RELRO, keep it.
+		covers := p.Off == s.Offset && p.Filesz == s.FileSize
+		holds := p.Off <= s.Offset && end <= p.Off+p.Filesz
+		if p != load && !covers && !holds && overlaps(p.Off, p.Filesz, off, end) {
+			return false
+		}
+	}
+	shtSize := f.sectionHeaderSize() * uint64(len(f.Sections))
+	return f.SHTOffset <= 0 || !overlaps(uint64(f.SHTOffset), shtSize, off, end)
+}
+
+// loadFlags returns the segment permissions a section with the given
+// flags needs.
+func loadFlags(flags SectionFlag) ProgFlag {
+	pf := PF_R
+	if flags&SHF_WRITE != 0 {
+		pf |= PF_W
+	}
+	if flags&SHF_EXECINSTR != 0 {
+		pf |= PF_X
+	}
+	return pf
+}
+
+// moveToLoad moves s, to be size bytes, to the aligned end of a PT_LOAD
+// segment with the permissions it needs that can be grown to hold it,
+// and reports whether there was one.
+func (f *File) moveToLoad(s *Section, size uint64) bool {
+	align := s.Addralign
+	if align == 0 {
+		align = 1
+	}
+	want := loadFlags(s.Flags)
+	for _, p := range f.Progs {
+		if p.Type != PT_LOAD || p.Flags&(PF_R|PF_W|PF_X) != want || p.Vaddr%align != p.Off%align {
+			continue
+		}
+		end := p.Off + p.Filesz
+		pad := alignUp(end, align) - end
+		if !f.canGrowLoad(p, pad+size) {
+			continue
+		}
+		s.Offset = end + pad
+		s.Addr = p.Vaddr + p.Memsz + pad
+		p.Filesz += pad + size
+		p.Memsz += pad + size
+		return true
+	}
+	return false
+}
+
+// moveToNewLoad moves s, to hold data, to the end of the file and of
+// the address space, in a new PT_LOAD segment. The program header table,
+// which the writer puts right after the file header, must have room for
+// another entry.
+func (f *File) moveToNewLoad(s *Section, data []byte) error {
+	size := uint64(len(data))
+	if f.PreserveRaw {
+		return fmt.Errorf("no room for %d bytes of %s, and the program header table cannot grow with PreserveRaw", size, s.Name)
+	}
+	phoff, phentsize := uint64(52), uint64(0x20)
+	if f.Class == ELFCLASS64 {
+		phoff, phentsize = 64, 0x38
+	}
+	phend := phoff + uint64(len(f.Progs))*phentsize
+	for _, t := range f.Sections {
+		if t.Type != SHT_NULL && t.Type != SHT_NOBITS && t.FileSize != 0 && t.Offset < phend+phentsize && phend < t.Offset+t.FileSize {
+			return fmt.Errorf("no room for %d bytes of %s, nor for another program header before %s", size, s.Name, t.Name)
+		}
+	}
+	pageAlign := uint64(0x1000)
+	var vend uint64
+	var phdrLoad *Prog
+	for _, p := range f.Progs {
+		if p.Type != PT_LOAD {
+			continue
+		}
+		if p.Align > pageAlign {
+			pageAlign = p.Align
+		}
+		if p.Vaddr+p.Memsz > vend {
+			vend = p.Vaddr + p.Memsz
+		}
+		if p.Off <= phoff && phend+phentsize <= p.Off+p.Filesz {
+			phdrLoad = p
+		}
+	}
+	var phdr *Prog
+	for _, p := range f.Progs {
+		if p.Type == PT_PHDR {
+			phdr = p
+		}
+	}
+	if phdr != nil && phdrLoad == nil {
+		return fmt.Errorf("no room for %d bytes of %s, and no PT_LOAD segment would map another program header", size, s.Name)
+	}
+	if phdr != nil {
+		phdr.Filesz += phentsize
+		phdr.Memsz += phentsize
+	}
+	s.Offset = alignUp(f.fileEnd(), pageAlign)
+	s.Addr = alignUp(vend, pageAlign)
+	p := &Prog{ProgHeader: ProgHeader{
+		Type:  PT_LOAD,
+		Flags: loadFlags(s.Flags),
+		Off:   s.Offset,
+		Vaddr: s.Addr,
+		Paddr: s.Addr,
+		Memsz: size,
+		Align: pageAlign,
+	}}
+	p.Replace(bytes.NewReader(data), int64(size))
+	f.Progs = append(f.Progs, p)
+	return nil
+}
+
+// fileEnd returns the end of the last section, segment or the section
+// header table in the file.
+func (f *File) fileEnd() uint64 {
+	var end uint64
+	for _, s := range f.Sections {
+		if s.Type != SHT_NOBITS && s.Offset+s.FileSize > end {
+			end = s.Offset + s.FileSize
+		}
+	}
+	for _, p := range f.Progs {
+		if p.Off+p.Filesz > end {
+			end = p.Off + p.Filesz
+		}
+	}
+	if sht := uint64(f.SHTOffset) + f.sectionHeaderSize()*uint64(len(f.Sections)); f.SHTOffset > 0 && sht > end {
+		end = sht
+	}
+	return end
+}
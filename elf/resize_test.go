@@ -0,0 +1,119 @@
+package elf
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Binject/debug/internal/gobuild"
+)
+
+func TestResizeSection(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	interp := f.Section(".interp")
+	off := interp.Offset
+
+	// A smaller .interp stays in place, and PT_INTERP follows it.
+	if err := f.ResizeSection(".interp", []byte("/lib/ld.so\x00")); err != nil {
+		t.Fatal(err)
+	}
+	if interp.Offset != off {
+		t.Errorf(".interp moved from %#x to %#x", off, interp.Offset)
+	}
+	if p := f.interpProg(); p.Filesz != 11 || p.Memsz != 11 {
+		t.Errorf("PT_INTERP is %+v after shrinking .interp", p.ProgHeader)
+	}
+
+	// A larger .comment is moved to the end of the file.
+	end := f.fileEnd()
+	comment := bytes.Repeat([]byte("comment\x00"), 64)
+	if err := f.ResizeSection(".comment", comment); err != nil {
+		t.Fatal(err)
+	}
+	if s := f.Section(".comment"); s.Offset < end {
+		t.Errorf(".comment at %#x is not past the end of the file at %#x", s.Offset, end)
+	}
+
+	// There is no room in the text segment, nor for another program
+	// header before .interp.
+	if err := f.ResizeSection(".interp", make([]byte, 0x100)); err == nil {
+		t.Error("ResizeSection grew .interp without room for it")
+	}
+	if err := f.ResizeSection(".bss", nil); err == nil {
+		t.Error("ResizeSection accepted a SHT_NOBITS section")
+	}
+
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := g.Section(".comment").Data(); err != nil || !bytes.Equal(data, comment) {
+		t.Errorf(".comment is %q, %v", data, err)
+	}
+	if s, err := g.Interpreter(); err != nil || s != "/lib/ld.so" {
+		t.Errorf("Interpreter() = %q, %v", s, err)
+	}
+}
+
+func TestResizeSectionRun(t *testing.T) {
+	exe := gobuild.Binary(t, "linux", "amd64")
+	out, err := exec.Command("go", "tool", "buildid", exe).Output()
+	if err != nil {
+		t.Fatalf("go tool buildid: %v", err)
+	}
+	f, err := Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// The build ID note grows past the text segment and gets a segment
+	// of its own, which PT_NOTE follows.
+	note := f.Section(".note.go.buildid")
+	if note == nil {
+		t.Skip("no .note.go.buildid section")
+	}
+	data, err := note.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nprogs := len(f.Progs)
+	if err := f.ResizeSection(".note.go.buildid", append(data, make([]byte, 0x2000)...)); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Progs) != nprogs+1 {
+		t.Errorf("%d program headers after moving the note, want %d", len(f.Progs), nprogs+1)
+	}
+	var covered bool
+	for _, p := range f.Progs {
+		covered = covered || p.Type == PT_NOTE && p.Off == note.Offset && p.Vaddr == note.Addr
+	}
+	if !covered {
+		t.Error("no PT_NOTE segment covers the moved note")
+	}
+
+	patched := filepath.Join(filepath.Dir(exe), "resized")
+	if err := f.WriteFile(patched); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(patched, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if output, err := exec.Command(patched).CombinedOutput(); err != nil || string(output) != "hello\n" {
+		t.Errorf("resized binary: %v\n%s", err, output)
+	}
+	if id, err := exec.Command("go", "tool", "buildid", patched).Output(); err != nil || !bytes.Equal(id, out) {
+		t.Errorf("build ID of the resized binary is %q, %v, want %q", strings.TrimSpace(string(id)), err, strings.TrimSpace(string(out)))
+	}
+}
@@ -0,0 +1,36 @@
+package elf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// RoundTripCheck parses the ELF file in r, writes it with Bytes, parses
+// what was written and compares the two files as Diff does: the file and
+// program headers, the headers and contents of the sections, and the
+// symbols. It returns nil if they are equal, or an error listing the
+// changes otherwise. It is meant for tests, such as those of a fork
+// checking that its changes still write back the files it reads.
+func RoundTripCheck(r io.ReaderAt) error {
+	f, err := NewFile(r)
+	if err != nil {
+		return err
+	}
+	b, err := f.Bytes()
+	if err != nil {
+		return fmt.Errorf("writing: %v", err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("parsing what was written: %v", err)
+	}
+	c, err := Diff(f, g)
+	if err != nil {
+		return err
+	}
+	if s := c.String(); s != "" {
+		return fmt.Errorf("round trip changed the file:\n%s", s)
+	}
+	return nil
+}
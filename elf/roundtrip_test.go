@@ -0,0 +1,59 @@
+package elf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The corpus is every file of testdata. The executables built here for it
+// are, from hello.c and hello-static.c:
+//
+//	gcc-amd64-linux-pie: gcc -Os -fpie -pie
+//	gcc-amd64-linux-pie-stripped: strip of gcc-amd64-linux-pie
+//	gcc-amd64-linux-static: gcc -Os -static -nostdlib -fno-asynchronous-unwind-tables
+//	gcc-amd64-linux-static-nosht: gcc-amd64-linux-static without its
+//	section header table, cut after its last segment, as packers and
+//	sstrip leave executables
+//
+// The ARM and MIPS files are the go-relocation-test objects.
+func TestRoundTripCheck(t *testing.T) {
+	names, err := filepath.Glob("testdata/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, name := range names {
+		if fi, err := os.Stat(name); err != nil || fi.IsDir() || filepath.Ext(name) == ".c" {
+			continue
+		}
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(name, ".gz") {
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, err = ioutil.ReadAll(zr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := RoundTripCheck(bytes.NewReader(data)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		n++
+	}
+	if n < 25 {
+		t.Errorf("checked %d files of testdata", n)
+	}
+
+	if err := RoundTripCheck(bytes.NewReader([]byte("not an ELF file"))); err == nil {
+		t.Error("RoundTripCheck accepted a file that is not ELF")
+	}
+}
@@ -0,0 +1,112 @@
+package elf
+
+import "io"
+
+// A SymbolIndex is a view of the symbol tables of a File that answers
+// lookups by name without scanning the tables.
+type SymbolIndex struct {
+	Symbols        []Symbol // as returned by Symbols
+	DynamicSymbols []Symbol // as returned by DynamicSymbols
+
+	byName    map[string]int // index in Symbols of the first symbol with a name
+	dynByName map[string]int
+
+	// Readers of the tables and their string tables when the index
+	// was built, to notice edits.
+	sources []*io.SectionReader
+}
+
+// SymbolIndex returns the symbol tables of f indexed by name. The index is
+// built on first use and rebuilt when the symbol tables have been
+// modified since. A missing symbol table results in no symbols rather than
+// an error.
+func (f *File) SymbolIndex() (*SymbolIndex, error) {
+	sources := f.symbolSources()
+	if x := f.symIndex; x != nil && len(x.sources) == len(sources) {
+		fresh := true
+		for i, sr := range sources {
+			fresh = fresh && sr == x.sources[i]
+		}
+		if fresh {
+			return x, nil
+		}
+	}
+
+	x := &SymbolIndex{sources: sources}
+	var err error
+	if x.Symbols, err = f.Symbols(); err != nil && err != ErrNoSymbols {
+		return nil, err
+	}
+	if x.DynamicSymbols, err = f.DynamicSymbols(); err != nil && err != ErrNoSymbols {
+		return nil, err
+	}
+	x.byName = indexByName(x.Symbols)
+	x.dynByName = indexByName(x.DynamicSymbols)
+	f.symIndex = x
+	return x, nil
+}
+
+// symbolSources returns the readers of the symbol tables of f and of the
+// string tables they link to.
+func (f *File) symbolSources() []*io.SectionReader {
+	var sources []*io.SectionReader
+	for _, typ := range []SectionType{SHT_SYMTAB, SHT_DYNSYM} {
+		s := f.SectionByType(typ)
+		if s == nil {
+			sources = append(sources, nil, nil)
+			continue
+		}
+		sources = append(sources, s.sr, nil)
+		if int(s.Link) < len(f.Sections) {
+			sources[len(sources)-1] = f.Sections[s.Link].sr
+		}
+	}
+	return sources
+}
+
+func indexByName(syms []Symbol) map[string]int {
+	m := make(map[string]int, len(syms))
+	for i, s := range syms {
+		if _, ok := m[s.Name]; !ok && s.Name != "" {
+			m[s.Name] = i
+		}
+	}
+	return m
+}
+
+// Lookup returns the first symbol of the static symbol table called name.
+func (x *SymbolIndex) Lookup(name string) (Symbol, bool) {
+	i, ok := x.byName[name]
+	if !ok {
+		return Symbol{}, false
+	}
+	return x.Symbols[i], true
+}
+
+// LookupDynamic returns the first symbol of the dynamic symbol table called
+// name.
+func (x *SymbolIndex) LookupDynamic(name string) (Symbol, bool) {
+	i, ok := x.dynByName[name]
+	if !ok {
+		return Symbol{}, false
+	}
+	return x.DynamicSymbols[i], true
+}
+
+// Index returns the index in the static symbol table, as used by
+// relocations, of the first symbol called name, or 0 if there is none.
+func (x *SymbolIndex) Index(name string) int {
+	if i, ok := x.byName[name]; ok {
+		return i + 1
+	}
+	return 0
+}
+
+// DynamicIndex returns the index in the dynamic symbol table of the first
+// symbol called name, or 0 if there is none.
+func (x *SymbolIndex) DynamicIndex(name string) int {
+	if i, ok := x.dynByName[name]; ok {
+		return i + 1
+	}
+	return 0
+}
@@ -0,0 +1,64 @@
+package elf
+
+import "testing"
+
+func TestSymbolIndex(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	x, err := f.SymbolIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	syms, err := f.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dyn, err := f.DynamicSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := len(syms) - 1; i >= 0; i-- {
+		s := syms[i]
+		if s.Name == "" {
+			continue
+		}
+		got, ok := x.Lookup(s.Name)
+		if !ok {
+			t.Fatalf("Lookup(%q) found nothing", s.Name)
+		}
+		if idx := x.Index(s.Name); idx < 1 || idx > i+1 || syms[idx-1] != got {
+			t.Errorf("Index(%q) = %d, Lookup found %+v", s.Name, idx, got)
+		}
+	}
+	for _, s := range dyn {
+		if s.Name == "" {
+			continue
+		}
+		if got, ok := x.LookupDynamic(s.Name); !ok || got.Name != s.Name || dyn[x.DynamicIndex(s.Name)-1] != got {
+			t.Errorf("LookupDynamic(%q) = %+v, %v", s.Name, got, ok)
+		}
+	}
+	if _, ok := x.Lookup("no such symbol"); ok || x.Index("no such symbol") != 0 {
+		t.Error("Lookup found a missing symbol")
+	}
+
+	if y, err := f.SymbolIndex(); err != nil || y != x {
+		t.Errorf("SymbolIndex() rebuilt the index of an unmodified file")
+	}
+	if err := f.RenameSymbol("main", "entry"); err != nil {
+		t.Fatal(err)
+	}
+	if x, err = f.SymbolIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := x.Lookup("main"); ok {
+		t.Error("Lookup found main after it was renamed")
+	}
+	if _, ok := x.Lookup("entry"); !ok {
+		t.Error("Lookup did not find the renamed symbol")
+	}
+}
@@ -0,0 +1,336 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// A symtabEditor holds the decoded .symtab and its string table while
+// they are being modified. Symbol indices below are indices into the
+// symbol table, where index 0 is the reserved null symbol.
+type symtabEditor struct {
+	f       *File
+	idx     int // section index of the symbol table
+	symtab  *Section
+	strtab  *Section
+	syms    []Symbol // without the null symbol
+	strdata []byte
+	dropped map[int]bool // sections being removed, which renumber skips
+}
+
+func (f *File) editSymtab() (*symtabEditor, error) {
+	for i, s := range f.Sections {
+		if s.Type != SHT_SYMTAB {
+			continue
+		}
+		syms, strdata, err := f.getSymbols(SHT_SYMTAB)
+		if err != nil {
+			return nil, err
+		}
+		return &symtabEditor{
+			f:       f,
+			idx:     i,
+			symtab:  s,
+			strtab:  f.Sections[s.Link],
+			syms:    syms,
+			strdata: strdata,
+		}, nil
+	}
+	return nil, ErrNoSymbols
+}
+
+// AddSymbol adds sym to the static symbol table, adding its name to the
+// string table. Local symbols are inserted after the existing local
+// symbols, as the ELF specification requires, and relocations that refer
+// to the symbols that follow are renumbered; other symbols are appended.
+func (f *File) AddSymbol(sym Symbol) error {
+	if sym.Section >= SHN_LORESERVE && sym.Section != SHN_ABS && sym.Section != SHN_COMMON {
+		return fmt.Errorf("unsupported section index %v for symbol %s", sym.Section, sym.Name)
+	}
+	if sym.Section != SHN_ABS && sym.Section != SHN_COMMON && int(sym.Section) >= len(f.Sections) {
+		return fmt.Errorf("section index %d of symbol %s is out of range", sym.Section, sym.Name)
+	}
+	e, err := f.editSymtab()
+	if err != nil {
+		return err
+	}
+	sym.NameIndex = e.addString(sym.Name)
+	sym.SectIndex = uint16(sym.Section)
+
+	// Index of the new symbol in e.syms.
+	i := len(e.syms)
+	if ST_BIND(sym.Info) == STB_LOCAL {
+		i = e.firstGlobal() - 1
+	}
+	e.syms = append(e.syms, Symbol{})
+	copy(e.syms[i+1:], e.syms[i:])
+	e.syms[i] = sym
+
+	idx := uint32(i + 1)
+	if err := e.renumber(func(old uint32) (uint32, bool) {
+		if old >= idx {
+			return old + 1, true
+		}
+		return old, true
+	}); err != nil {
+		return err
+	}
+	return e.commit()
+}
+
+// RenameSymbol renames the first symbol called oldName in the static
+// symbol table. The new name is appended to the string table, as the old
+// one may share its bytes with other names.
+func (f *File) RenameSymbol(oldName, newName string) error {
+	e, err := f.editSymtab()
+	if err != nil {
+		return err
+	}
+	i := e.lookup(oldName)
+	if i < 0 {
+		return fmt.Errorf("symbol %s not found", oldName)
+	}
+	e.syms[i].Name = newName
+	e.syms[i].NameIndex = e.addString(newName)
+	return e.commit()
+}
+
+// RemoveSymbol removes the first symbol called name from the static
+// symbol table, renumbering the relocations that refer to the symbols
+// that follow it. A symbol that is still the target of a relocation
+// cannot be removed.
+func (f *File) RemoveSymbol(name string) error {
+	e, err := f.editSymtab()
+	if err != nil {
+		return err
+	}
+	i := e.lookup(name)
+	if i < 0 {
+		return fmt.Errorf("symbol %s not found", name)
+	}
+	idx := uint32(i + 1)
+	if err := e.renumber(func(old uint32) (uint32, bool) {
+		switch {
+		case old == idx:
+			return 0, false
+		case old > idx:
+			return old - 1, true
+		}
+		return old, true
+	}); err != nil {
+		return err
+	}
+	e.syms = append(e.syms[:i], e.syms[i+1:]...)
+	return e.commit()
+}
+
+func (e *symtabEditor) lookup(name string) int {
+	for i, s := range e.syms {
+		if s.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// firstGlobal returns the symbol table index of the first non-local
+// symbol, the value of the symbol table's sh_info.
+func (e *symtabEditor) firstGlobal() int {
+	for i, s := range e.syms {
+		if ST_BIND(s.Info) != STB_LOCAL {
+			return i + 1
+		}
+	}
+	return len(e.syms) + 1
+}
+
+func (e *symtabEditor) addString(s string) uint32 {
+	if s == "" {
+		return 0
+	}
+	off := uint32(len(e.strdata))
+	e.strdata = append(e.strdata, s...)
+	e.strdata = append(e.strdata, 0)
+	return off
+}
+
+// renumber rewrites the symbol indices of the relocation and group
+// sections that refer to the symbol table. remap returns false for a
+// symbol that no longer exists, in which case nothing is modified and an
+// error is returned.
+func (e *symtabEditor) renumber(remap func(old uint32) (uint32, bool)) error {
+	f := e.f
+	type update struct {
+		s    *Section
+		data []byte
+	}
+	var updates []update
+	for i, s := range f.Sections {
+		if int(s.Link) != e.idx || e.dropped[i] {
+			continue
+		}
+		switch s.Type {
+		case SHT_GROUP:
+			if _, ok := remap(s.Info); !ok {
+				return fmt.Errorf("symbol %d is the signature of group section %d", s.Info, i)
+			}
+			continue
+		case SHT_REL, SHT_RELA:
+		default:
+			continue
+		}
+
+		data, err := s.Data()
+		if err != nil {
+			return err
+		}
+		entsize := 8
+		switch {
+		case f.Class == ELFCLASS64 && s.Type == SHT_RELA:
+			entsize = 24
+		case f.Class == ELFCLASS64:
+			entsize = 16
+		case s.Type == SHT_RELA:
+			entsize = 12
+		}
+		if len(data)%entsize != 0 {
+			return fmt.Errorf("length of relocation section %d is not a multiple of %d", i, entsize)
+		}
+		for off := 0; off < len(data); off += entsize {
+			if f.Class == ELFCLASS64 {
+				info := f.ByteOrder.Uint64(data[off+8:])
+				sym, ok := remap(R_SYM64(info))
+				if !ok {
+					return fmt.Errorf("symbol %d is used by a relocation in section %d", R_SYM64(info), i)
+				}
+				f.ByteOrder.PutUint64(data[off+8:], R_INFO(sym, R_TYPE64(info)))
+			} else {
+				info := f.ByteOrder.Uint32(data[off+4:])
+				sym, ok := remap(R_SYM32(info))
+				if !ok {
+					return fmt.Errorf("symbol %d is used by a relocation in section %d", R_SYM32(info), i)
+				}
+				f.ByteOrder.PutUint32(data[off+4:], R_INFO32(sym, R_TYPE32(info)))
+			}
+		}
+		updates = append(updates, update{s, data})
+	}
+
+	for _, u := range updates {
+		u.s.Replace(bytes.NewReader(u.data), int64(len(u.data)))
+	}
+	for i, s := range f.Sections {
+		if int(s.Link) == e.idx && s.Type == SHT_GROUP && !e.dropped[i] {
+			s.Info, _ = remap(s.Info)
+		}
+	}
+	return nil
+}
+
+// commit encodes the edited tables into their sections. Tables that grew
+// are moved to the end of the file.
+func (e *symtabEditor) commit() error {
+	f := e.f
+	var buf bytes.Buffer
+	switch f.Class {
+	case ELFCLASS32:
+		buf.Write(make([]byte, Sym32Size))
+		for _, s := range e.syms {
+			sym := s.ToSym32()
+			if err := binary.Write(&buf, f.ByteOrder, &sym); err != nil {
+				return err
+			}
+		}
+	case ELFCLASS64:
+		buf.Write(make([]byte, Sym64Size))
+		for _, s := range e.syms {
+			sym := s.ToSym64()
+			if err := binary.Write(&buf, f.ByteOrder, &sym); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New("not implemented")
+	}
+
+	f.replaceNonAlloc(e.strtab, e.strdata)
+	f.replaceNonAlloc(e.symtab, buf.Bytes())
+	e.symtab.Info = uint32(e.firstGlobal())
+	return nil
+}
+
+// replaceNonAlloc replaces the contents of s, a section that is not
+// loaded into memory. If the new contents do not fit where the section
+// is, it is moved after everything else in the file.
+func (f *File) replaceNonAlloc(s *Section, data []byte) {
+	if uint64(len(data)) > s.FileSize {
+		off := f.contentEnd()
+		if a := s.Addralign; a > 1 {
+			off = (off + a - 1) &^ (a - 1)
+		}
+		s.Offset = off
+	}
+	s.Replace(bytes.NewReader(data), int64(len(data)))
+}
+
+// addNonAlloc appends a section named name, of type typ, holding data,
+// that is not loaded into memory. Its name is added to the section name
+// table, and its contents and the grown section header table go after
+// everything else in the file.
+func (f *File) addNonAlloc(name string, typ SectionType, data []byte, align uint64) (*Section, error) {
+	if f.ShStrIndex <= 0 || f.ShStrIndex >= len(f.Sections) {
+		return nil, errors.New("file has no section name table")
+	}
+	shstrtab := f.Sections[f.ShStrIndex]
+	names, err := shstrtab.Data()
+	if err != nil {
+		return nil, err
+	}
+	nameOff := uint32(len(names))
+	f.replaceNonAlloc(shstrtab, append(append(names, name...), 0))
+
+	if align == 0 {
+		align = 1
+	}
+	s := &Section{SectionHeader: SectionHeader{
+		Name:      name,
+		Type:      typ,
+		Offset:    alignUp(f.contentEnd(), align),
+		Addralign: align,
+		Shname:    nameOff,
+		Shnum:     len(f.Sections),
+	}}
+	s.Replace(bytes.NewReader(data), int64(len(data)))
+	f.Sections = append(f.Sections, s)
+	f.SHTOffset = int64(alignUp(f.contentEnd(), 8))
+	return s, nil
+}
+
+// contentEnd returns the offset of the end of the last section, segment
+// or section header table in the file, or of the original bytes when they
+// are preserved.
+func (f *File) contentEnd() uint64 {
+	var end uint64
+	if f.PreserveRaw {
+		if n, err := f.rawLen(); err == nil {
+			end = uint64(n)
+		}
+	}
+	for _, s := range f.Sections {
+		if s.Type != SHT_NOBITS && s.Offset+s.FileSize > end {
+			end = s.Offset + s.FileSize
+		}
+	}
+	for _, p := range f.Progs {
+		if p.Off+p.Filesz > end {
+			end = p.Off + p.Filesz
+		}
+	}
+	shentsize := f.sectionHeaderSize()
+	if sht := uint64(f.SHTOffset) + shentsize*uint64(len(f.Sections)); f.SHTOffset > 0 && sht > end {
+		end = sht
+	}
+	return end
+}
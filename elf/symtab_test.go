@@ -0,0 +1,178 @@
+package elf
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// relocTargets returns the names of the symbols referenced by the
+// relocations of the sections linked to the symbol table. Unnamed section
+// symbols are listed by the index of their section.
+func relocTargets(t *testing.T, f *File) []string {
+	syms, err := f.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range f.Sections {
+		if s.Type != SHT_RELA || f.Sections[s.Link].Type != SHT_SYMTAB {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for off := 0; off+24 <= len(data); off += 24 {
+			idx := R_SYM64(f.ByteOrder.Uint64(data[off+8:]))
+			switch {
+			case idx == 0:
+				names = append(names, "")
+			case syms[idx-1].Name == "":
+				names = append(names, fmt.Sprintf("section %d", syms[idx-1].Section))
+			default:
+				names = append(names, syms[idx-1].Name)
+			}
+		}
+	}
+	return names
+}
+
+func reparse(t *testing.T, f *File) *File {
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f2
+}
+
+func findSymbol(syms []Symbol, name string) *Symbol {
+	for i := range syms {
+		if syms[i].Name == name {
+			return &syms[i]
+		}
+	}
+	return nil
+}
+
+func TestEditSymbolsRelocatable(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-openbsd-debug-with-rela.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	targets := relocTargets(t, f)
+	if len(targets) == 0 {
+		t.Fatal("no relocations")
+	}
+	info := f.SectionByType(SHT_SYMTAB).Info
+
+	text := SectionIndex(0)
+	for i, s := range f.Sections {
+		if s.Name == ".text" {
+			text = SectionIndex(i)
+		}
+	}
+	if err := f.AddSymbol(Symbol{Name: "added_local", Info: ST_INFO(STB_LOCAL, STT_FUNC), Section: text}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.AddSymbol(Symbol{Name: "added_global", Info: ST_INFO(STB_GLOBAL, STT_FUNC), Section: text, Value: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.RenameSymbol("__cgo__0", "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.AddSymbol(Symbol{Name: "bad", Section: SectionIndex(len(f.Sections))}); err == nil {
+		t.Error("AddSymbol accepted an out of range section index")
+	}
+
+	f2 := reparse(t, f)
+	if got := f2.SectionByType(SHT_SYMTAB).Info; got != info+1 {
+		t.Errorf("symbol table sh_info = %d, want %d", got, info+1)
+	}
+	syms, err := f2.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := findSymbol(syms, "added_local"); s == nil || ST_BIND(s.Info) != STB_LOCAL || s.Section != text {
+		t.Errorf("added_local = %+v", s)
+	}
+	if s := findSymbol(syms, "added_global"); s == nil || syms[len(syms)-1].Name != "added_global" || s.Value != 4 {
+		t.Errorf("added_global = %+v, want it last", s)
+	}
+	if findSymbol(syms, "__cgo__0") != nil || findSymbol(syms, "renamed") == nil {
+		t.Error("__cgo__0 was not renamed")
+	}
+
+	// Relocations still refer to the same symbols, apart from the renamed one.
+	got := relocTargets(t, f2)
+	for i := range targets {
+		if targets[i] == "__cgo__0" {
+			targets[i] = "renamed"
+		}
+	}
+	if len(got) != len(targets) {
+		t.Fatalf("got %d relocations, want %d", len(got), len(targets))
+	}
+	for i := range got {
+		if got[i] != targets[i] {
+			t.Errorf("relocation %d refers to %q, want %q", i, got[i], targets[i])
+		}
+	}
+
+	// A symbol used by a relocation cannot be removed.
+	if err := f2.RemoveSymbol("__cgodebug_data"); err == nil {
+		t.Error("removed __cgodebug_data, which is used by a relocation")
+	}
+	if err := f2.RemoveSymbol("added_local"); err != nil {
+		t.Fatal(err)
+	}
+	f3 := reparse(t, f2)
+	if got := f3.SectionByType(SHT_SYMTAB).Info; got != info {
+		t.Errorf("symbol table sh_info after removal = %d, want %d", got, info)
+	}
+	if syms, _ := f3.Symbols(); findSymbol(syms, "added_local") != nil {
+		t.Error("added_local was not removed")
+	}
+	if got := relocTargets(t, f3); fmt.Sprint(got) != fmt.Sprint(targets) {
+		t.Errorf("relocations changed after removal: got %q, want %q", got, targets)
+	}
+}
+
+func TestEditSymbolsExec(t *testing.T) {
+	for _, name := range []string{
+		"testdata/gcc-386-freebsd-exec",
+		"testdata/gcc-amd64-linux-exec",
+	} {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before, err := f.Symbols()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.AddSymbol(Symbol{Name: "injected", Info: ST_INFO(STB_GLOBAL, STT_FUNC), Section: SHN_ABS, Value: f.Entry}); err != nil {
+			t.Fatal(err)
+		}
+		f2 := reparse(t, f)
+		after, err := f2.Symbols()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(after) != len(before)+1 {
+			t.Errorf("%s: got %d symbols, want %d", name, len(after), len(before)+1)
+		}
+		if s := findSymbol(after, "injected"); s == nil || s.Value != f.Entry || s.Section != SHN_ABS {
+			t.Errorf("%s: injected = %+v", name, s)
+		}
+		if _, err := f2.DynamicSymbols(); err != nil {
+			t.Errorf("%s: DynamicSymbols: %v", name, err)
+		}
+		f.Close()
+	}
+}
@@ -0,0 +1,15 @@
+// A program without the C library, for a small static executable:
+//	gcc -Os -static -nostdlib -fno-asynchronous-unwind-tables -o gcc-amd64-linux-static hello-static.c
+
+static const char msg[] = "hello, world\n";
+
+void
+_start(void)
+{
+	long ret;
+
+	__asm__ volatile("syscall" : "=a"(ret) : "a"(1), "D"(1), "S"(msg), "d"(sizeof msg - 1) : "rcx", "r11", "memory");
+	__asm__ volatile("syscall" : : "a"(60), "D"(0));
+	for (;;)
+		;
+}
@@ -0,0 +1,204 @@
+package elf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// tlsProg returns the PT_TLS segment of f, or nil.
+func (f *File) tlsProg() *Prog {
+	for _, p := range f.Progs {
+		if p.Type == PT_TLS {
+			return p
+		}
+	}
+	return nil
+}
+
+// tlsSections returns the allocated sections of the TLS template.
+func (f *File) tlsSections() []*Section {
+	var secs []*Section
+	for _, s := range f.Sections {
+		if s.Flags&SHF_TLS != 0 && s.Flags&SHF_ALLOC != 0 {
+			secs = append(secs, s)
+		}
+	}
+	return secs
+}
+
+// onlyTLSData reports whether s is the only TLS section with contents in
+// the file, such as .tdata next to .tbss.
+func (f *File) onlyTLSData(s *Section) bool {
+	for _, t := range f.tlsSections() {
+		if t != s && t.Type != SHT_NOBITS {
+			return false
+		}
+	}
+	return true
+}
+
+// tlsVariantII reports whether the thread pointer of the machine of f
+// points at the end of the static TLS blocks, so that the offsets of
+// thread-local variables from it depend on the size of the TLS template.
+func (f *File) tlsVariantII() bool {
+	switch f.Machine {
+	case EM_386, EM_X86_64, EM_SPARC, EM_SPARCV9, EM_S390:
+		return true
+	}
+	return false
+}
+
+// isExecutable reports whether f is an executable, whose thread-local
+// variables the linker may have resolved to fixed offsets from the thread
+// pointer, rather than a shared object.
+func (f *File) isExecutable() bool {
+	if f.Type == ET_EXEC {
+		return true
+	}
+	for _, p := range f.Progs {
+		if p.Type == PT_INTERP {
+			return true
+		}
+	}
+	return false
+}
+
+// moveTLS fits the TLS template to its section s after ResizeSection
+// gave it size bytes: s was at oldAddr, and oldOff in the file, with
+// oldSize bytes. When s is the only TLS section with contents, the
+// zero-filled TLS sections after it, such as .tbss, follow its end, and
+// keep their gaps. The PT_TLS segment is fitted to the sections, keeping
+// the memory it had past the last, as added by GrowTLS.
+func (f *File) moveTLS(tls *Prog, s *Section, oldAddr, oldOff, oldSize uint64) {
+	secs := f.tlsSections()
+	oldEnd := oldAddr + oldSize
+	for _, t := range secs {
+		if t != s && t.Addr+t.Size > oldEnd {
+			oldEnd = t.Addr + t.Size
+		}
+	}
+	var tail uint64
+	if end := tls.Vaddr + tls.Memsz; end > oldEnd {
+		tail = end - oldEnd
+	}
+
+	if f.onlyTLSData(s) {
+		dataEnd, newEnd := oldAddr+oldSize, s.Addr+s.Size
+		for _, t := range secs {
+			if t == s || t.Addr < dataEnd {
+				continue
+			}
+			align := t.Addralign
+			if align == 0 {
+				align = 1
+			}
+			t.Addr = alignUp(newEnd+t.Addr-dataEnd, align)
+			if t.Offset >= oldOff+oldSize {
+				t.Offset = s.Offset + s.FileSize + t.Offset - (oldOff + oldSize)
+			}
+		}
+	}
+
+	start, first := ^uint64(0), s
+	var fileEnd, memEnd uint64
+	for _, t := range secs {
+		if t.Addr < start {
+			start, first = t.Addr, t
+		}
+		if t.Type != SHT_NOBITS && t.Addr+t.Size > fileEnd {
+			fileEnd = t.Addr + t.Size
+		}
+		if t.Addr+t.Size > memEnd {
+			memEnd = t.Addr + t.Size
+		}
+		if t.Addralign > tls.Align {
+			tls.Align = t.Addralign
+		}
+	}
+	tls.Vaddr, tls.Paddr, tls.Off = start, start, first.Offset
+	tls.Filesz = 0
+	if fileEnd > start {
+		tls.Filesz = fileEnd - start
+	}
+	tls.Memsz = memEnd + tail - start
+}
+
+// GrowTLS adds size bytes of zero-initialized thread-local storage,
+// aligned to align, to the end of the TLS template, and returns their
+// offset from the start of the template: the offset that a DTPOFF
+// relocation or the tls_index of __tls_get_addr holds for them. The
+// zero-filled TLS section at the end of the template, .tbss, grows to
+// hold them; without one, only the PT_TLS segment does. Nothing moves in
+// the file, and the loader allocates the memory for every thread.
+//
+// On machines whose thread pointer points at the end of the static TLS
+// blocks, such as x86 and x86-64, the offsets of the existing variables
+// of an executable, which the linker resolved against the template size,
+// would change, so only shared objects are grown there; and executables
+// elsewhere can only be grown within the alignment of their PT_TLS
+// segment. A shared object marked with StaticTLS needs room for its whole
+// TLS block in the static TLS surplus that the loader reserves for them
+// when it is loaded with dlopen, which is a few kilobytes.
+func (f *File) GrowTLS(size, align uint64) (uint64, error) {
+	tls := f.tlsProg()
+	switch {
+	case tls == nil:
+		return 0, errors.New("file has no PT_TLS segment")
+	case f.progsOnly:
+		return 0, errors.New("cannot grow the TLS of a file read without its section headers")
+	case align == 0 || align&(align-1) != 0:
+		return 0, fmt.Errorf("TLS alignment %d is not a power of two", align)
+	case f.isExecutable() && f.tlsVariantII():
+		return 0, fmt.Errorf("growing the TLS of an executable for %v would move its thread-local variables", f.Machine)
+	case f.isExecutable() && align > tls.Align:
+		return 0, fmt.Errorf("TLS alignment %d is larger than the alignment %d of the PT_TLS segment of an executable", align, tls.Align)
+	}
+	off := alignUp(tls.Memsz, align)
+	end := tls.Vaddr + off + size
+	var tbss *Section
+	for _, t := range f.tlsSections() {
+		if t.Type == SHT_NOBITS && t.Addr+t.Size == tls.Vaddr+tls.Memsz {
+			tbss = t
+		}
+	}
+	if tbss != nil {
+		tbss.Size = end - tbss.Addr
+		if align > tbss.Addralign {
+			tbss.Addralign = align
+		}
+	}
+	tls.Memsz = end - tls.Vaddr
+	if align > tls.Align {
+		tls.Align = align
+	}
+	return off, nil
+}
+
+// StaticTLS reports whether DT_FLAGS has DF_STATIC_TLS, which marks an
+// object whose code uses the initial-exec TLS model: its thread-local
+// variables are at offsets from the thread pointer that the loader fixes
+// when the object is loaded, so its TLS block must be in the static TLS
+// area.
+func (f *File) StaticTLS() bool {
+	vals := f.DynValue(DT_FLAGS)
+	return len(vals) > 0 && DynFlag(vals[0])&DF_STATIC_TLS != 0
+}
+
+// SetStaticTLS sets or clears DF_STATIC_TLS in DT_FLAGS, as the linker
+// does for an object with initial-exec TLS accesses, such as injected
+// code that reads its variables through the GOT. An entry for DT_FLAGS is
+// added if there is none, which needs room in the dynamic section.
+func (f *File) SetStaticTLS(on bool) error {
+	var flags uint64
+	if vals := f.DynValue(DT_FLAGS); len(vals) > 0 {
+		flags = vals[0]
+	} else if !on {
+		return nil
+	}
+	if on {
+		flags |= uint64(DF_STATIC_TLS)
+	} else {
+		flags &^= uint64(DF_STATIC_TLS)
+	}
+	return f.SetDynTag(DT_FLAGS, flags)
+}
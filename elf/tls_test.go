@@ -0,0 +1,166 @@
+package elf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// buildTLS builds a shared object with initialized and zero-filled
+// thread-local variables, and a program using it, in dir. The alignment
+// of a leaves room after .tdata for it to grow.
+func buildTLS(t *testing.T, dir string) (lib, prog string) {
+	t.Helper()
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("requires linux/amd64")
+	}
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc not found")
+	}
+	libSrc := filepath.Join(dir, "tls.c")
+	mainSrc := filepath.Join(dir, "main.c")
+	if err := ioutil.WriteFile(libSrc, []byte("__thread int a __attribute__((aligned(16))) = 42;\n__thread int b;\nint get(void) { b++; return a + b; }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(mainSrc, []byte("#include <stdio.h>\nint get(void);\nint main(void) { printf(\"%d\\n\", get()); return 0; }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lib = filepath.Join(dir, "libtls.so")
+	prog = filepath.Join(dir, "main")
+	for _, args := range [][]string{
+		{"-shared", "-fPIC", "-o", lib, libSrc},
+		{"-o", prog, mainSrc, "-L" + dir, "-ltls"},
+	} {
+		if out, err := exec.Command("gcc", args...).CombinedOutput(); err != nil {
+			t.Skipf("gcc: %v\n%s", err, out)
+		}
+	}
+	return lib, prog
+}
+
+func TestGrowTLS(t *testing.T) {
+	dir := t.TempDir()
+	lib, prog := buildTLS(t, dir)
+	f, err := Open(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tls := f.tlsProg()
+	if tls == nil {
+		t.Fatal("no PT_TLS segment")
+	}
+	if _, err := f.GrowTLS(8, 3); err == nil {
+		t.Error("GrowTLS accepted an alignment that is not a power of two")
+	}
+	oldMemsz := tls.Memsz
+	off, err := f.GrowTLS(100, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if off < oldMemsz || off%64 != 0 {
+		t.Errorf("GrowTLS returned offset %#x for a template of %#x bytes", off, oldMemsz)
+	}
+	b, err := f.Bytes()
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tls = g.tlsProg()
+	tbss := g.Section(".tbss")
+	if tls.Memsz != off+100 || tls.Align < 64 || tbss.Addr+tbss.Size != tls.Vaddr+tls.Memsz {
+		t.Errorf("PT_TLS is %+v and .tbss %+v after GrowTLS", tls.ProgHeader, tbss.SectionHeader)
+	}
+	if err := ioutil.WriteFile(lib, b, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(prog)
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+	if out, err := cmd.CombinedOutput(); err != nil || string(out) != "43\n" {
+		t.Errorf("program using the grown library: %v\n%s", err, out)
+	}
+
+	// The TLS of an x86-64 executable cannot grow.
+	exe := filepath.Join(dir, "exe")
+	if out, err := exec.Command("gcc", "-o", exe, filepath.Join(dir, "tls.c"), filepath.Join(dir, "main.c")).CombinedOutput(); err != nil {
+		t.Fatalf("gcc: %v\n%s", err, out)
+	}
+	e, err := Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	if _, err := e.GrowTLS(8, 8); err == nil {
+		t.Error("GrowTLS grew the TLS of an x86-64 executable")
+	}
+}
+
+func TestResizeTLSSection(t *testing.T) {
+	lib, _ := buildTLS(t, t.TempDir())
+	f, err := Open(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tdata := f.Section(".tdata")
+	data, err := tdata.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, make([]byte, 4)...)
+	if err := f.ResizeSection(".tdata", data); err != nil {
+		t.Fatal(err)
+	}
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tls := g.tlsProg()
+	tdata, tbss := g.Section(".tdata"), g.Section(".tbss")
+	switch {
+	case tls.Vaddr != tdata.Addr || tls.Off != tdata.Offset || tls.Filesz != uint64(len(data)):
+		t.Errorf("PT_TLS %+v does not start with .tdata %+v", tls.ProgHeader, tdata.SectionHeader)
+	case tbss.Addr < tdata.Addr+tdata.Size || tbss.Addr-(tdata.Addr+tdata.Size) >= tbss.Addralign:
+		t.Errorf(".tbss at %#x does not follow .tdata at %#x", tbss.Addr, tdata.Addr)
+	case tls.Vaddr+tls.Memsz != tbss.Addr+tbss.Size:
+		t.Errorf("PT_TLS %+v does not end with .tbss %+v", tls.ProgHeader, tbss.SectionHeader)
+	case tls.Vaddr%tls.Align != 0:
+		t.Errorf("PT_TLS at %#x is not aligned to %#x", tls.Vaddr, tls.Align)
+	}
+	got, err := g.Section(".tdata").Data()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("resized .tdata holds %d bytes, %v", len(got), err)
+	}
+}
+
+func TestStaticTLS(t *testing.T) {
+	lib, _ := buildTLS(t, t.TempDir())
+	f, err := Open(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.StaticTLS() {
+		t.Error("a library using the general dynamic TLS model has DF_STATIC_TLS")
+	}
+	if err := f.SetStaticTLS(true); err != nil {
+		t.Fatal(err)
+	}
+	if !f.StaticTLS() {
+		t.Error("SetStaticTLS(true) did not set DF_STATIC_TLS")
+	}
+	if err := f.SetStaticTLS(false); err != nil || f.StaticTLS() {
+		t.Errorf("SetStaticTLS(false): %v", err)
+	}
+}
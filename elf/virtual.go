@@ -0,0 +1,121 @@
+package elf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// ReadVirtual returns the size bytes that are mapped at the virtual
+// address addr, as the file contents of a PT_LOAD segment, with the edits
+// made to the sections they hold, such as those of WriteVirtual.
+func (f *File) ReadVirtual(addr, size uint64) ([]byte, error) {
+	off, p, err := f.virtualOffset(addr, size)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, size)
+	if _, err := p.ReadAt(b, int64(addr-p.Vaddr)); err != nil {
+		return nil, err
+	}
+	for _, s := range f.virtualSections(off, size) {
+		lo, hi := overlap(off, size, s)
+		if _, err := s.ReadAt(b[lo-off:hi-off], int64(lo-s.Offset)); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// WriteVirtual writes data at the virtual address addr, translated to
+// file offsets through the PT_LOAD segment that maps it, into the
+// contents of the sections there, which Bytes writes. data may straddle
+// sections, but each of its bytes must be in one whose contents are
+// stored uncompressed; bytes that only a segment holds, such as the
+// padding between sections, are an error. Nothing is written on error.
+func (f *File) WriteVirtual(addr uint64, data []byte) error {
+	size := uint64(len(data))
+	off, _, err := f.virtualOffset(addr, size)
+	if err != nil {
+		return err
+	}
+	secs := f.virtualSections(off, size)
+	covered := uint64(0)
+	for _, s := range secs {
+		lo, hi := overlap(off, size, s)
+		covered += hi - lo
+	}
+	if covered != size {
+		return fmt.Errorf("%d bytes at %#x are not in the contents of a section", size-covered, addr)
+	}
+	contents := make([][]byte, len(secs))
+	for i, s := range secs {
+		// The contents left by an earlier write are patched in place,
+		// unless the section has been replaced since.
+		if e, ok := f.edits[s]; ok && e.sr == s.sr {
+			contents[i] = e.data
+		} else if contents[i], err = s.Data(); err != nil {
+			return err
+		}
+	}
+	for i, s := range secs {
+		d := contents[i]
+		lo, hi := overlap(off, size, s)
+		copy(d[lo-s.Offset:], data[lo-off:hi-off])
+		if e, ok := f.edits[s]; ok && e.sr == s.sr {
+			continue
+		}
+		s.Replace(bytes.NewReader(d), int64(len(d)))
+		if f.edits == nil {
+			f.edits = make(map[*Section]sectionEdit)
+		}
+		f.edits[s] = sectionEdit{s.sr, d}
+	}
+	return nil
+}
+
+// A sectionEdit holds the contents WriteVirtual gave a section, and the
+// reader over them that it replaced the section's with.
+type sectionEdit struct {
+	sr   *io.SectionReader
+	data []byte
+}
+
+// virtualOffset returns the file offset of the size bytes at addr, and
+// the PT_LOAD segment whose file contents hold them.
+func (f *File) virtualOffset(addr, size uint64) (uint64, *Prog, error) {
+	for _, p := range f.Progs {
+		if p.Type == PT_LOAD && addr >= p.Vaddr && addr-p.Vaddr <= p.Filesz && size <= p.Filesz-(addr-p.Vaddr) {
+			return p.Off + addr - p.Vaddr, p, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("%d bytes at %#x are not in the file contents of a PT_LOAD segment", size, addr)
+}
+
+// virtualSections returns the sections whose uncompressed contents are
+// stored in the file at some of the size bytes at off.
+func (f *File) virtualSections(off, size uint64) []*Section {
+	var secs []*Section
+	for _, s := range f.Sections {
+		if s.Type == SHT_NULL || s.Type == SHT_NOBITS || s.Flags&SHF_COMPRESSED != 0 || s.FileSize == 0 || s.sr == nil {
+			continue
+		}
+		if lo, hi := overlap(off, size, s); lo < hi {
+			secs = append(secs, s)
+		}
+	}
+	return secs
+}
+
+// overlap returns the file offsets of the part of the size bytes at off
+// that s holds, with lo >= hi if there is none.
+func overlap(off, size uint64, s *Section) (lo, hi uint64) {
+	lo, hi = off, off+size
+	if s.Offset > lo {
+		lo = s.Offset
+	}
+	if end := s.Offset + s.FileSize; end < hi {
+		hi = end
+	}
+	return lo, hi
+}
@@ -0,0 +1,77 @@
+package elf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteVirtual(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Find two sections that follow each other in the file and in memory.
+	var s, next *Section
+	for i, a := range f.Sections[:len(f.Sections)-1] {
+		b := f.Sections[i+1]
+		if a.Flags&SHF_ALLOC != 0 && a.Type == SHT_PROGBITS && b.Type == SHT_PROGBITS && a.Size >= 4 && b.Size >= 4 &&
+			a.Offset+a.Size == b.Offset && a.Addr+a.Size == b.Addr {
+			s, next = a, b
+			break
+		}
+	}
+	if s == nil {
+		t.Fatal("no adjacent sections")
+	}
+	addr := s.Addr + s.Size - 4
+	patch := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	if err := f.WriteVirtual(addr, patch); err != nil {
+		t.Fatal(err)
+	}
+	// A second write goes to the same contents.
+	if err := f.WriteVirtual(addr+2, []byte{9}); err != nil {
+		t.Fatal(err)
+	}
+	patch[2] = 9
+	if b, err := f.ReadVirtual(addr-4, 16); err != nil || !bytes.Equal(b[4:12], patch) {
+		t.Errorf("ReadVirtual = % x, %v; want % x in the middle", b, err, patch)
+	}
+
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, _ := g.Section(s.Name).Data()
+	nd, _ := g.Section(next.Name).Data()
+	if !bytes.Equal(sd[len(sd)-4:], patch[:4]) || !bytes.Equal(nd[:4], patch[4:]) {
+		t.Errorf("%s ends with % x and %s starts with % x, want % x", s.Name, sd[len(sd)-4:], next.Name, nd[:4], patch)
+	}
+
+	// The file header is mapped by the first PT_LOAD segment, but is in no
+	// section.
+	var load *Prog
+	for _, p := range f.Progs {
+		if p.Type == PT_LOAD && p.Off == 0 {
+			load = p
+			break
+		}
+	}
+	if load == nil {
+		t.Fatal("no PT_LOAD segment maps the file header")
+	}
+	if err := f.WriteVirtual(load.Vaddr, []byte{0}); err == nil {
+		t.Error("WriteVirtual wrote to the file header")
+	}
+	if b, err := f.ReadVirtual(load.Vaddr, 4); err != nil || string(b) != ELFMAG {
+		t.Errorf("ReadVirtual of the file header = %q, %v", b, err)
+	}
+	if _, err := f.ReadVirtual(0, 4); err == nil {
+		t.Error("ReadVirtual read an unmapped address")
+	}
+}
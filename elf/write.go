@@ -4,13 +4,35 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"sort"
 )
 
-// Bytes - returns the bytes of an Elf file
+// Bytes - returns the bytes of an Elf file. With PreserveRaw set, the
+// edits are applied over the bytes the file was read from.
 func (elfFile *File) Bytes() ([]byte, error) {
+	return elfFile.BytesWithOptions(WriteOptions{})
+}
+
+// BytesWithOptions - returns the bytes of an Elf file as Bytes does,
+// written as opts asks.
+func (elfFile *File) BytesWithOptions(opts WriteOptions) ([]byte, error) {
+	if elfFile.progsOnly {
+		return nil, errors.New("cannot write a file whose sections were synthesized from its program headers")
+	}
+	if err := elfFile.syncARMExidx(); err != nil {
+		return nil, err
+	}
+	if opts.Deterministic {
+		defer elfFile.layoutTail()()
+	}
+	if elfFile.PreserveRaw {
+		return elfFile.preservedBytes(opts)
+	}
 
 	bytesWritten := uint64(0)
 	elfBuf := bytes.NewBuffer(nil)
@@ -55,7 +77,7 @@ func (elfFile *File) Bytes() ([]byte, error) {
 		// PH Offset 32
 		binary.Write(w, elfFile.ByteOrder, uint32(0x34))
 		// SH Offset 32 //   0x20	0x28	4	8	e_shoff	Points to the start of the section header table.
-		binary.Write(w, elfFile.ByteOrder, int32(elfFile.FileHeader.SHTOffset))
+		binary.Write(w, elfFile.ByteOrder, uint32(elfFile.FileHeader.SHTOffset))
 		// Flags
 		binary.Write(w, elfFile.ByteOrder, uint32(0)) // todo
 		// EH Size
@@ -75,7 +97,7 @@ func (elfFile *File) Bytes() ([]byte, error) {
 		// PH Offset 64
 		binary.Write(w, elfFile.ByteOrder, uint64(0x40))
 		// SH Offset 64 //   0x20	0x28	4	8	e_shoff	Points to the start of the section header table.
-		binary.Write(w, elfFile.ByteOrder, int64(elfFile.FileHeader.SHTOffset))
+		binary.Write(w, elfFile.ByteOrder, uint64(elfFile.FileHeader.SHTOffset))
 		// Flags
 		binary.Write(w, elfFile.ByteOrder, uint32(0)) // I think right?
 		// EH Size
@@ -90,16 +112,104 @@ func (elfFile *File) Bytes() ([]byte, error) {
 	}
 
 	// SH Num //	0x30	0x3C	2	e_shnum	Contains the number of entries in the section header table.
-	binary.Write(w, elfFile.ByteOrder, uint16(len(elfFile.Sections)))
 	// SH Str Ndx	// 0x32	0x3E	2	e_shstrndx	Contains index of the section header table entry that contains the section names.
-	binary.Write(w, elfFile.ByteOrder, uint16(elfFile.ShStrIndex))
+	// Values that do not fit are moved to sh_size and sh_link of section 0.
+	shnum, shstrndx, _, _ := elfFile.sectionHeaderCounts()
+	binary.Write(w, elfFile.ByteOrder, shnum)
+	binary.Write(w, elfFile.ByteOrder, shstrndx)
 	bytesWritten += 4
 
 	// Program Header
+	progHeaders := elfFile.progHeaderBytes()
+	w.Write(progHeaders)
+	bytesWritten += uint64(len(progHeaders))
+
+	// Section Header Table, written at SHTOffset. Sections may follow it
+	// in the file, so it is written from the section loop below once their
+	// offset is reached.
+	shentsize := elfFile.sectionHeaderSize()
+	shtWritten := false
+	writeSectionHeaders := func() {
+		if bytesWritten < uint64(elfFile.FileHeader.SHTOffset) {
+			pad := make([]byte, uint64(elfFile.FileHeader.SHTOffset)-bytesWritten)
+			w.Write(pad)
+			//log.Printf("Padding before SHT at %x: length:%x to:%x\n", bytesWritten, len(pad), elfFile.FileHeader.SHTOffset)
+			bytesWritten += uint64(len(pad))
+		}
+
+		w.Write(elfFile.sectionHeaderBytes())
+		bytesWritten += shentsize * uint64(len(elfFile.Sections))
+		shtWritten = true
+	}
+
+	// Section contents are written in file order, which need not be the
+	// order of the section table once a section has been moved.
+	sortedSections := append([]*Section(nil), elfFile.Sections...)
+	sort.SliceStable(sortedSections, func(a, b int) bool { return sortedSections[a].Offset < sortedSections[b].Offset })
+	for _, s := range sortedSections {
+
+		//log.Printf("Writing section: %s type: %+v\n", s.Name, s.Type)
+		//log.Printf("written: %x offset: %x\n", bytesWritten, s.Offset)
+
+		if s.Type == SHT_NULL || s.Type == SHT_NOBITS || s.FileSize == 0 {
+			//log.Println("continuing...")
+			continue
+		}
+
+		if !shtWritten && elfFile.SHTOffset > 0 && s.Offset >= uint64(elfFile.SHTOffset) {
+			writeSectionHeaders()
+		}
+
+		if bytesWritten > s.Offset {
+			log.Printf("Overlapping Sections in Generated Elf: %+v\n", s.Name)
+			continue
+		}
+		// Read the contents before padding up to them, so that a corrupt
+		// offset fails here instead of allocating the padding.
+		section, err := elfFile.writtenSectionBytes(s, opts)
+		if err != nil {
+			return nil, err
+		}
+		if s.Offset != 0 && bytesWritten < s.Offset {
+			pad := make([]byte, s.Offset-bytesWritten)
+			w.Write(pad)
+			//log.Printf("Padding before section %s at %x: length:%x to:%x\n", s.Name, bytesWritten, len(pad), s.Offset)
+			bytesWritten += uint64(len(pad))
+		}
+		w.Write(section)
+		slen := len(section)
+		//log.Printf("Wrote %s section at %x, length %x\n", s.Name, bytesWritten, slen)
+		bytesWritten += uint64(slen)
+
+		// todo:  elfFile.Insertion should be renamed InsertionLoadEnd or similar
+		if s.Type == SHT_PROGBITS && s.Flags&SHF_COMPRESSED == 0 && len(elfFile.Insertion) > 0 && s.Size-uint64(slen) >= uint64(len(elfFile.Insertion)) {
+			binary.Write(w, elfFile.ByteOrder, elfFile.Insertion)
+			bytesWritten += uint64(len(elfFile.Insertion))
+		}
+		w.Flush()
+	}
+
+	if !shtWritten {
+		writeSectionHeaders()
+	}
+
+	// Do I have a PT_NOTE segment to add at the end?
+
+	if len(elfFile.InsertionEOF) > 0 {
+		binary.Write(w, elfFile.ByteOrder, elfFile.InsertionEOF)
+		bytesWritten += uint64(len(elfFile.InsertionEOF))
+	}
+
+	w.Flush()
+	return elfBuf.Bytes(), nil
+}
+
+// progHeaderBytes - returns the program header table
+func (elfFile *File) progHeaderBytes() []byte {
+	w := bytes.NewBuffer(nil)
 	for _, p := range elfFile.Progs {
 		// Type (segment)
 		binary.Write(w, elfFile.ByteOrder, uint32(p.Type))
-		bytesWritten += 4
 
 		switch elfFile.Class {
 		case ELFCLASS32:
@@ -124,8 +234,6 @@ func (elfFile *File) Bytes() ([]byte, error) {
 			// Alignment
 			binary.Write(w, elfFile.ByteOrder, uint32(p.Align))
 
-			bytesWritten += 28
-
 		case ELFCLASS64:
 			// Flags (segment)
 			binary.Write(w, elfFile.ByteOrder, uint32(p.Flags))
@@ -147,81 +255,26 @@ func (elfFile *File) Bytes() ([]byte, error) {
 
 			// Alignment
 			binary.Write(w, elfFile.ByteOrder, uint64(p.Align))
-
-			bytesWritten += 52
 		}
 	}
+	return w.Bytes()
+}
 
-	sortedSections := elfFile.Sections[:]
-	//sort.Slice(sortedSections, func(a, b int) bool { return elfFile.Sections[a].Link < elfFile.Sections[b].Link })
-	for _, s := range sortedSections {
-
-		//log.Printf("Writing section: %s type: %+v\n", s.Name, s.Type)
-		//log.Printf("written: %x offset: %x\n", bytesWritten, s.Offset)
-
-		if s.Type == SHT_NULL || s.Type == SHT_NOBITS || s.FileSize == 0 {
-			//log.Println("continuing...")
-			continue
-		}
-
-		if bytesWritten > s.Offset {
-			log.Printf("Overlapping Sections in Generated Elf: %+v\n", s.Name)
-			continue
+// sectionHeaderBytes - returns the section header table
+func (elfFile *File) sectionHeaderBytes() []byte {
+	w := bytes.NewBuffer(nil)
+	_, _, sh0Size, sh0Link := elfFile.sectionHeaderCounts()
+	for i, s := range elfFile.Sections {
+		size, link, addralign := s.Size, s.Link, s.Addralign
+		if i == 0 {
+			size, link = sh0Size, sh0Link
 		}
-		if s.Offset != 0 && bytesWritten < s.Offset {
-			pad := make([]byte, s.Offset-bytesWritten)
-			w.Write(pad)
-			//log.Printf("Padding before section %s at %x: length:%x to:%x\n", s.Name, bytesWritten, len(pad), s.Offset)
-			bytesWritten += uint64(len(pad))
+		// Compressed sections are written as stored, so the header
+		// describes the compressed data rather than its contents.
+		if s.Flags&SHF_COMPRESSED != 0 {
+			size, addralign = s.FileSize, s.fileAddralign
 		}
 
-		slen := 0
-		switch s.Type {
-		case SHT_DYNAMIC:
-			for _, taggedValue := range elfFile.DynTags {
-				//log.Printf("writing %d (%x) -> %d (%x)\n", taggedValue.Tag, taggedValue.Tag, taggedValue.Value, taggedValue.Value)
-				switch elfFile.Class {
-				case ELFCLASS32:
-					binary.Write(w, elfFile.ByteOrder, uint32(taggedValue.Tag))
-					binary.Write(w, elfFile.ByteOrder, uint32(taggedValue.Value))
-					bytesWritten += 8
-				case ELFCLASS64:
-					binary.Write(w, elfFile.ByteOrder, uint64(taggedValue.Tag))
-					binary.Write(w, elfFile.ByteOrder, uint64(taggedValue.Value))
-					bytesWritten += 16
-				}
-			}
-		default:
-			section, err := ioutil.ReadAll(s.Open())
-			if err != nil {
-				return nil, err
-			}
-			binary.Write(w, elfFile.ByteOrder, section)
-			slen = len(section)
-			//log.Printf("Wrote %s section at %x, length %x\n", s.Name, bytesWritten, slen)
-			bytesWritten += uint64(slen)
-		}
-
-		// todo:  elfFile.Insertion should be renamed InsertionLoadEnd or similar
-		if s.Type == SHT_PROGBITS && len(elfFile.Insertion) > 0 && s.Size-uint64(slen) >= uint64(len(elfFile.Insertion)) {
-			binary.Write(w, elfFile.ByteOrder, elfFile.Insertion)
-			bytesWritten += uint64(len(elfFile.Insertion))
-		}
-		w.Flush()
-	}
-
-	// Pad to Section Header Table
-	if bytesWritten < uint64(elfFile.FileHeader.SHTOffset) {
-		pad := make([]byte, uint64(elfFile.FileHeader.SHTOffset)-bytesWritten)
-		w.Write(pad)
-		//log.Printf("Padding before SHT at %x: length:%x to:%x\n", bytesWritten, len(pad), elfFile.FileHeader.SHTOffset)
-		bytesWritten += uint64(len(pad))
-	}
-
-	// Write Section Header Table
-
-	for _, s := range elfFile.Sections[:] {
-
 		switch elfFile.Class {
 		case ELFCLASS32:
 			binary.Write(w, elfFile.ByteOrder, &Section32{
@@ -230,10 +283,10 @@ func (elfFile *File) Bytes() ([]byte, error) {
 				Flags:     uint32(s.Flags),
 				Addr:      uint32(s.Addr),
 				Off:       uint32(s.Offset),
-				Size:      uint32(s.Size),
-				Link:      s.Link,
+				Size:      uint32(size),
+				Link:      link,
 				Info:      s.Info,
-				Addralign: uint32(s.Addralign),
+				Addralign: uint32(addralign),
 				Entsize:   uint32(s.Entsize)})
 		case ELFCLASS64:
 			binary.Write(w, elfFile.ByteOrder, &Section64{
@@ -242,33 +295,74 @@ func (elfFile *File) Bytes() ([]byte, error) {
 				Flags:     uint64(s.Flags),
 				Addr:      s.Addr,
 				Off:       s.Offset,
-				Size:      s.Size,
-				Link:      s.Link,
+				Size:      size,
+				Link:      link,
 				Info:      s.Info,
-				Addralign: s.Addralign,
+				Addralign: addralign,
 				Entsize:   s.Entsize})
 		}
 	}
+	return w.Bytes()
+}
 
-	// Do I have a PT_NOTE segment to add at the end?
+// sectionFileBytes - returns the contents of section s as stored in the file
+func (elfFile *File) sectionFileBytes(s *Section) ([]byte, error) {
+	if s.Type == SHT_DYNAMIC {
+		return elfFile.dynTagsBytes(s)
+	}
+	r := s.Open()
+	if s.Flags&SHF_COMPRESSED != 0 {
+		// the compression header followed by the compressed data
+		r = io.NewSectionReader(s.sr, 0, int64(s.FileSize))
+	}
+	b, err := ioutil.ReadAll(r)
+	if err == nil && uint64(len(b)) < s.FileSize {
+		err = &FormatError{int64(s.Offset), "section runs past the end of the file", s.Name}
+	}
+	return b, err
+}
 
-	if len(elfFile.InsertionEOF) > 0 {
-		binary.Write(w, elfFile.ByteOrder, elfFile.InsertionEOF)
-		bytesWritten += uint64(len(elfFile.InsertionEOF))
+// sectionHeaderCounts - returns the e_shnum and e_shstrndx values for the
+// file header, along with the sh_size and sh_link values for section 0.
+// Counts of SHN_LORESERVE or more are stored in section 0 instead.
+func (elfFile *File) sectionHeaderCounts() (shnum, shstrndx uint16, sh0Size uint64, sh0Link uint32) {
+	n := len(elfFile.Sections)
+	if n < int(SHN_LORESERVE) {
+		shnum = uint16(n)
+	} else {
+		sh0Size = uint64(n)
+	}
+	if elfFile.ShStrIndex < int(SHN_LORESERVE) {
+		shstrndx = uint16(elfFile.ShStrIndex)
+	} else {
+		shstrndx = uint16(SHN_XINDEX)
+		sh0Link = uint32(elfFile.ShStrIndex)
 	}
+	return
+}
 
-	w.Flush()
-	return elfBuf.Bytes(), nil
+// sectionHeaderSize - returns the size of a section header table entry.
+func (elfFile *File) sectionHeaderSize() uint64 {
+	if elfFile.Class == ELFCLASS64 {
+		return 0x40
+	}
+	return 0x28
 }
 
 // WriteFile - Creates a new file and writes it using the Bytes func above
 func (elfFile *File) WriteFile(destFile string) error {
+	return elfFile.WriteFileWithOptions(destFile, WriteOptions{})
+}
+
+// WriteFileWithOptions - Creates a new file and writes it using the
+// BytesWithOptions func above
+func (elfFile *File) WriteFileWithOptions(destFile string, opts WriteOptions) error {
 	f, err := os.Create(destFile)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	elfData, err := elfFile.Bytes()
+	elfData, err := elfFile.BytesWithOptions(opts)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,63 @@
+package elf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteExtendedSectionCount(t *testing.T) {
+	for _, name := range []string{
+		"testdata/gcc-386-freebsd-exec",
+		"testdata/gcc-amd64-linux-exec",
+	} {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Pad the section table past SHN_LORESERVE with empty sections,
+		// then add a copy of the section name table at the end so that
+		// e_shstrndx overflows as well.
+		var end uint64
+		for _, s := range f.Sections {
+			if s.Type != SHT_NOBITS && s.Offset+s.FileSize > end {
+				end = s.Offset + s.FileSize
+			}
+		}
+		for len(f.Sections) < int(SHN_LORESERVE)+16 {
+			f.Sections = append(f.Sections, &Section{SectionHeader: SectionHeader{Type: SHT_PROGBITS}})
+		}
+		shstrtab := *f.Sections[f.ShStrIndex]
+		shstrtab.Offset = end
+		f.Sections = append(f.Sections, &shstrtab)
+		f.ShStrIndex = len(f.Sections) - 1
+		f.SHTOffset = int64(end + shstrtab.FileSize)
+		if f.Class == ELFCLASS64 {
+			f.SHTOffset = (f.SHTOffset + 7) &^ 7
+		} else {
+			f.SHTOffset = (f.SHTOffset + 3) &^ 3
+		}
+
+		b, err := f.Bytes()
+		if err != nil {
+			t.Fatalf("%s: Bytes: %v", name, err)
+		}
+		f.Close()
+
+		g, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("%s: reading written file: %v", name, err)
+		}
+		if len(g.Sections) != len(f.Sections) {
+			t.Errorf("%s: got %d sections, want %d", name, len(g.Sections), len(f.Sections))
+		}
+		if g.ShStrIndex != f.ShStrIndex {
+			t.Errorf("%s: got shstrndx %d, want %d", name, g.ShStrIndex, f.ShStrIndex)
+		}
+		for i, s := range f.Sections[:20] {
+			if g.Sections[i].Name != s.Name {
+				t.Errorf("%s: section %d is named %q, want %q", name, i, g.Sections[i].Name, s.Name)
+			}
+		}
+	}
+}
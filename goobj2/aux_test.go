@@ -0,0 +1,82 @@
+package goobj2
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Binject/debug/goobj2/internal/goobj2"
+)
+
+func TestAuxAndForeignMembers(t *testing.T) {
+	pkg := newTestPackage()
+	printlock := SymRef{"runtime.printlock", goobj2.SymRef{PkgIdx: goobj2.PkgIdxNone, SymIdx: 1}}
+	aux := []Aux{
+		{goobj2.AuxDwarfInfo, printlock}, // function data without a FuncInfo
+		{42, printlock},                  // unknown type
+	}
+	pkg.ArchiveMembers[0].NonPkgSymDefs[0].Aux = aux
+	foreign := []ArchiveMember{
+		{ArchiveHeader: ArchiveHeader{Name: "_cgo_main.o", Date: "0", UID: "0", GID: "0", Mode: "644", Size: 5, Data: []byte("\x7fELF\x02\x00")}, IsDataObj: true},
+		{ArchiveHeader: ArchiveHeader{Name: "x.syso", Date: "0", UID: "0", GID: "0", Mode: "644", Size: 2, Data: []byte("MZ")}, IsDataObj: true},
+	}
+	pkg.ArchiveMembers = append(pkg.ArchiveMembers, foreign...)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "aux.a")
+	if err := pkg.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	pkg2, err := Parse(path, "main", nil)
+	if err != nil {
+		t.Fatalf("failed to parse written object: %v", err)
+	}
+	if len(pkg2.ArchiveMembers) != 3 {
+		t.Fatalf("got %d archive members, want 3", len(pkg2.ArchiveMembers))
+	}
+	if got := pkg2.ArchiveMembers[0].NonPkgSymDefs[0].Aux; !reflect.DeepEqual(got, aux) {
+		t.Errorf("got aux records %+v, want %+v", got, aux)
+	}
+	for i, want := range foreign {
+		got := pkg2.ArchiveMembers[i+1]
+		if !got.IsDataObj || !reflect.DeepEqual(got.ArchiveHeader, want.ArchiveHeader) {
+			t.Errorf("archive member %d is %+v, want %+v", i+1, got.ArchiveHeader, want.ArchiveHeader)
+		}
+	}
+
+	path2 := filepath.Join(dir, "aux2.a")
+	if err := pkg2.Write(path2); err != nil {
+		t.Fatal(err)
+	}
+	b1, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := ioutil.ReadFile(path2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b1, b2) {
+		t.Error("archive changed when written again")
+	}
+}
+
+func TestFuncInfoFormatError(t *testing.T) {
+	pkg := newTestPackage()
+	printlock := SymRef{"runtime.printlock", goobj2.SymRef{PkgIdx: goobj2.PkgIdxNone, SymIdx: 1}}
+	sym := pkg.ArchiveMembers[0].NonPkgSymDefs[0]
+	sym.Aux = []Aux{{goobj2.AuxFuncInfo, printlock}}
+
+	path := filepath.Join(t.TempDir(), "bad.a")
+	if err := pkg.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Parse(path, "main", nil)
+	var ferr *FormatError
+	if !errors.As(err, &ferr) || ferr.Sym != sym.Name {
+		t.Errorf("Parse returned %v, want a FormatError for %s", err, sym.Name)
+	}
+}
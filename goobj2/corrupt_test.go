@@ -0,0 +1,57 @@
+package goobj2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/Binject/debug/goobj2/internal/goobj2"
+)
+
+func TestCorruptArchive(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "good.a")
+	if err := newTestPackage().Write(path); err != nil {
+		t.Fatal(err)
+	}
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The object file header follows its magic: an 8-byte fingerprint,
+	// 4 bytes of flags and then the block offsets.
+	obj := bytes.Index(orig, []byte(goobj2.Magic))
+	if obj < 0 {
+		t.Fatal("no object file in the archive")
+	}
+	offsets := obj + len(goobj2.Magic) + 8 + 4
+
+	for _, tt := range []struct {
+		name string
+		edit func(b []byte) []byte
+		want error
+	}{
+		{"truncated", func(b []byte) []byte { return b[:obj+len(goobj2.Magic)+4] }, errTruncatedArchive},
+		{"member size", func(b []byte) []byte { copy(b[8+48:], "9999999999"); return b }, errTruncatedArchive},
+		{"block offset", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[offsets+4*goobj2.BlkSymdef:], 0xffffffff)
+			return b
+		}, errCorruptObject},
+		{"symbol count", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[offsets+4*goobj2.BlkNonpkgdef:], 0)
+			return b
+		}, errCorruptObject},
+	} {
+		b := tt.edit(append([]byte(nil), orig...))
+		p := filepath.Join(dir, "bad.a")
+		if err := ioutil.WriteFile(p, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Parse(p, "main", nil); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Parse returned %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
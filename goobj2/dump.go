@@ -0,0 +1,106 @@
+package goobj2
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/Binject/debug/goobj2/internal/goobj2"
+	"github.com/Binject/debug/goobj2/internal/objabi"
+)
+
+// String returns the name of the symbol kind, such as "STEXT".
+func (k SymKind) String() string { return objabi.SymKind(k).String() }
+
+// Dump writes a listing of the package to w: for each archive member, its
+// imports and the symbols it defines, with their relocations and function
+// info, followed by the non-package symbols it references. Symbol
+// contents are left out; sizes are given instead.
+//
+// The listing is meant for reading, when a package does not survive a
+// round trip through Parse and Write, and its format may change.
+func (pkg *Package) Dump(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "package %s (%s/%s)\n", pkg.ImportPath, pkg.os, pkg.arch)
+	for i := range pkg.ArchiveMembers {
+		dumpMember(bw, &pkg.ArchiveMembers[i])
+	}
+	return bw.Flush()
+}
+
+func dumpMember(w *bufio.Writer, am *ArchiveMember) {
+	h := &am.ArchiveHeader
+	switch {
+	case am.IsCompilerObj():
+		fmt.Fprintf(w, "\nmember %s: compiler object, %d bytes\n", h.Name, h.Size)
+		return
+	case am.IsDataObj:
+		fmt.Fprintf(w, "\nmember %s: data, %d bytes\n", h.Name, h.Size)
+		return
+	}
+	fmt.Fprintf(w, "\nmember %s: Go object, flags %#x\n", h.Name, am.ObjHeader.Flags)
+	for _, imp := range am.Imports {
+		fmt.Fprintf(w, "import %s %x\n", imp.Pkg, imp.Fingerprint)
+	}
+	for _, p := range am.Packages {
+		fmt.Fprintf(w, "package ref %s\n", p)
+	}
+	for _, f := range am.DWARFFileList {
+		fmt.Fprintf(w, "dwarf file %s\n", f)
+	}
+	for _, s := range am.SymDefs {
+		dumpSym(w, "def", s)
+	}
+	for _, s := range am.NonPkgSymDefs {
+		dumpSym(w, "nonpkg def", s)
+	}
+	for _, s := range am.NonPkgSymRefs {
+		fmt.Fprintf(w, "nonpkg ref %s %v abi=%d\n", s.Name, s.Kind, s.ABI)
+	}
+	for _, r := range am.SymRefs {
+		fmt.Fprintf(w, "ref %s %s\n", r.Name, symRefString(r.SymRef))
+	}
+}
+
+func dumpSym(w *bufio.Writer, what string, s *Sym) {
+	fmt.Fprintf(w, "%s %s %v size=%d align=%d abi=%d flag=%#x", what, s.Name, s.Kind, s.Size, s.Align, s.ABI, s.Flag)
+	if s.Type != nil {
+		fmt.Fprintf(w, " type=%s", s.Type.Name)
+	}
+	fmt.Fprintln(w)
+	for _, r := range s.Reloc {
+		name := r.Name
+		if name == "" {
+			name = symRefString(r.Sym)
+		}
+		fmt.Fprintf(w, "\treloc %#x+%d %v %s%+d\n", r.Offset, r.Size, r.Type, name, r.Add)
+	}
+	for _, a := range s.Aux {
+		fmt.Fprintf(w, "\taux %d %s\n", a.Type, a.Sym.Name)
+	}
+	fn := s.Func
+	if fn == nil {
+		return
+	}
+	fmt.Fprintf(w, "\tfunc args=%#x frame=%#x pcsp=%d pcfile=%d pcline=%d pcinline=%d pcdata=%d funcdata=%d\n",
+		fn.Args, fn.Frame, len(fn.PCSP), len(fn.PCFile), len(fn.PCLine), len(fn.PCInline), len(fn.PCData), len(fn.FuncData))
+	for i, f := range fn.File {
+		fmt.Fprintf(w, "\tfile %d %s\n", i, f.Name)
+	}
+	for i, fd := range fn.FuncData {
+		name := "-"
+		if fd.Sym != nil {
+			name = fd.Sym.Name
+		}
+		fmt.Fprintf(w, "\tfuncdata %d %s+%d\n", i, name, fd.Offset)
+	}
+	for i, c := range fn.InlTree {
+		fmt.Fprintf(w, "\tinline %d parent=%d %s at %s:%d pc=%#x\n", i, c.Parent, c.Func.Name, c.File.Name, c.Line, c.ParentPC)
+	}
+}
+
+// symRefString formats a symbol reference that has no name as
+// package index:symbol index.
+func symRefString(r goobj2.SymRef) string {
+	return fmt.Sprintf("<%d:%d>", r.PkgIdx, r.SymIdx)
+}
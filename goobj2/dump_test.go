@@ -0,0 +1,34 @@
+package goobj2
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Binject/debug/goobj2/internal/objabi"
+)
+
+func TestDump(t *testing.T) {
+	pkg := newTestPackage()
+	body := []byte{0xe8, 0, 0, 0, 0, 0xc3} // CALL runtime.printlock; RET
+	relocs := []Reloc{{Name: "runtime.printlock", Offset: 1, Size: 4, Type: objabi.R_CALL}}
+	if _, err := pkg.AddTextSym(`"".injected`, body, relocs, 8, 16); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := pkg.Dump(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"member _go_.o: Go object",
+		"\ndef \"\".injected STEXT size=6 ",
+		"\n\treloc 0x1+4 R_CALL runtime.printlock+0\n",
+		"\n\tfunc args=0x8 frame=0x10 ",
+		"\nnonpkg def go.string.hi SRODATA size=2 ",
+		"\nnonpkg ref runtime.printlock Sxxx ",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("dump has no %q:\n%s", want, b.String())
+		}
+	}
+}
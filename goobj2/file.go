@@ -19,6 +19,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 
@@ -93,6 +94,18 @@ type Sym struct {
 	Data  []byte  // memory image of symbol
 	Reloc []Reloc // relocations to apply to Data
 	Func  *Func   // additional data for functions
+
+	// Aux holds the auxiliary records that are not interpreted, either
+	// because their type is unknown or because they belong to a function
+	// without a FuncInfo, such as some assembly functions. They are
+	// written back unchanged.
+	Aux []Aux
+}
+
+// An Aux is an uninterpreted auxiliary symbol record.
+type Aux struct {
+	Type uint8
+	Sym  SymRef
 }
 
 type SymRef struct {
@@ -275,6 +288,16 @@ var (
 	errNotObject        = errors.New("unrecognized object file format")
 )
 
+// A FormatError reports a symbol of an object file that cannot be parsed.
+type FormatError struct {
+	Sym string // name of the symbol
+	Msg string
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("symbol %q: %s", e.Sym, e.Msg)
+}
+
 // An objReader is an object file reader.
 type objReader struct {
 	p         *Package
@@ -448,7 +471,7 @@ func Parse(objPath, pkgPath string, importMap ImportMap) (*Package, error) {
 
 func parse(objPath string, p *Package, importMap ImportMap, returnReader bool) (rr *goobj2.Reader, err error) {
 	f, openErr := os.Open(objPath)
-	if err != nil {
+	if openErr != nil {
 		return nil, openErr
 	}
 	defer func() {
@@ -457,6 +480,16 @@ func parse(objPath string, p *Package, importMap ImportMap, returnReader bool) (
 			err = closeErr
 		}
 	}()
+	// The object file reader indexes blocks by the offsets and counts
+	// the file gives; those of a corrupt file are out of range.
+	defer func() {
+		if e := recover(); e != nil {
+			if _, ok := e.(runtime.Error); !ok {
+				panic(e)
+			}
+			rr, err = nil, fmt.Errorf("%w: %v", errCorruptObject, e)
+		}
+	}()
 
 	var rd objReader
 	rd.init(f, p)
@@ -540,6 +573,9 @@ func (r *objReader) parseArchive(importMap ImportMap, returnReader bool) (*goobj
 		if fsize < 0 || fsize < size {
 			return nil, errCorruptArchive
 		}
+		if size > r.limit-r.offset {
+			return nil, errTruncatedArchive
+		}
 		ar.Size = size
 
 		var am *ArchiveMember
@@ -560,15 +596,20 @@ func (r *objReader) parseArchive(importMap ImportMap, returnReader bool) (*goobj
 			oldLimit := r.limit
 			r.limit = r.offset + size
 
-			p, err := r.peek(8)
-			if err != nil {
-				return nil, err
+			// Members that are not Go objects, such as the host
+			// objects of cgo packages and .syso files, are kept
+			// verbatim.
+			var p []byte
+			if size >= int64(len(goobjHeader)) {
+				if p, err = r.peek(len(goobjHeader)); err != nil {
+					return nil, err
+				}
 			}
 			if bytes.Equal(p, goobjHeader) {
 				var rr *goobj2.Reader
 				rr, am, data, err = r.parseObject(nil, importMap, returnReader)
 				if err != nil {
-					return nil, fmt.Errorf("parsing archive member %q: %v", ar.Name, err)
+					return nil, fmt.Errorf("parsing archive member %q: %w", ar.Name, err)
 				}
 				if returnReader {
 					return rr, nil
@@ -642,7 +683,9 @@ func (r *objReader) parseObject(prefix []byte, importMap ImportMap, returnReader
 	r.objStart = r.offset
 	length := r.limit - r.offset
 	objbytes := make([]byte, length)
-	r.readFull(objbytes)
+	if err := r.readFull(objbytes); err != nil {
+		return nil, nil, nil, err
+	}
 	rr := goobj2.NewReaderFromBytes(objbytes, false)
 	if rr == nil {
 		return nil, nil, nil, errCorruptObject
@@ -664,6 +707,9 @@ func (r *objReader) parseObject(prefix []byte, importMap ImportMap, returnReader
 
 	// Referenced packages
 	am.Packages = rr.Pkglist()
+	if len(am.Packages) == 0 {
+		return nil, nil, nil, errCorruptObject
+	}
 	am.Packages = am.Packages[1:] // skip first package which is always an empty string
 
 	// Dwarf file table
@@ -683,12 +729,14 @@ func (r *objReader) parseObject(prefix []byte, importMap ImportMap, returnReader
 		am.SymRefs = append(am.SymRefs, SymRef{name, sym})
 	}
 
+	// badRef is the first invalid reference met by resolveSymRefName.
+	var badRef *goobj2.SymRef
 	resolveSymRefName := func(s goobj2.SymRef) string {
 		var i int
 		switch p := s.PkgIdx; p {
 		case goobj2.PkgIdxInvalid:
-			if s.SymIdx != 0 {
-				panic("bad sym ref")
+			if s.SymIdx != 0 && badRef == nil {
+				badRef = &s
 			}
 			return ""
 		case goobj2.PkgIdxNone:
@@ -710,7 +758,7 @@ func (r *objReader) parseObject(prefix []byte, importMap ImportMap, returnReader
 	ndef := rr.NSym() + rr.NNonpkgdef()
 	var inlFuncsToResolve []*InlinedCall
 
-	parseSym := func(i, j int, symDefs []*Sym) {
+	parseSym := func(i, j int, symDefs []*Sym) error {
 		osym := rr.Sym(i)
 
 		sym := &Sym{
@@ -725,7 +773,7 @@ func (r *objReader) parseObject(prefix []byte, importMap ImportMap, returnReader
 		am.symMap[i] = sym
 
 		if i >= ndef {
-			return // not a defined symbol from here
+			return nil // not a defined symbol from here
 		}
 
 		if sym.Kind == STEXT {
@@ -755,43 +803,49 @@ func (r *objReader) parseObject(prefix []byte, importMap ImportMap, returnReader
 		isym := -1
 		funcdata := make([]*SymRef, 0, 4)
 		var funcInfo, dinfo, dloc, dranges, dlines *SymRef
+		var funcAux []Aux
 		auxs := rr.Auxs(i)
 		for j := range auxs {
 			a := &auxs[j]
+			sr := a.Sym()
+			ref := &SymRef{resolveSymRefName(sr), sr}
 			switch a.Type() {
 			case goobj2.AuxGotype:
-				s := a.Sym()
-				sym.Type = &SymRef{resolveSymRefName(s), s}
+				sym.Type = ref
 			case goobj2.AuxFuncInfo:
-				sr := a.Sym()
-				if sr.PkgIdx != goobj2.PkgIdxSelf {
-					panic("funcinfo symbol not defined in current package")
+				if sr.PkgIdx != goobj2.PkgIdxSelf || int(sr.SymIdx) >= ndef {
+					return &FormatError{sym.Name, "FuncInfo symbol not defined in the current package"}
 				}
-				funcInfo = &SymRef{resolveSymRefName(sr), sr}
-				isym = int(a.Sym().SymIdx)
+				funcInfo = ref
+				isym = int(sr.SymIdx)
 			case goobj2.AuxFuncdata:
-				sr := a.Sym()
-				funcdata = append(funcdata, &SymRef{resolveSymRefName(sr), sr})
+				funcdata = append(funcdata, ref)
 			case goobj2.AuxDwarfInfo:
-				sr := a.Sym()
-				dinfo = &SymRef{resolveSymRefName(sr), sr}
+				dinfo = ref
 			case goobj2.AuxDwarfLoc:
-				sr := a.Sym()
-				dloc = &SymRef{resolveSymRefName(sr), sr}
+				dloc = ref
 			case goobj2.AuxDwarfRanges:
-				sr := a.Sym()
-				dranges = &SymRef{resolveSymRefName(sr), sr}
+				dranges = ref
 			case goobj2.AuxDwarfLines:
-				sr := a.Sym()
-				dlines = &SymRef{resolveSymRefName(sr), sr}
+				dlines = ref
 			default:
-				panic("unknown aux type")
+				sym.Aux = append(sym.Aux, Aux{a.Type(), *ref})
+				continue
 			}
+			if a.Type() != goobj2.AuxGotype {
+				funcAux = append(funcAux, Aux{a.Type(), *ref})
+			}
+		}
+		if badRef != nil {
+			return &FormatError{sym.Name, fmt.Sprintf("invalid symbol reference %v", *badRef)}
 		}
 
 		// Symbol Info
 		if isym == -1 {
-			return
+			// Without a FuncInfo the function data cannot be
+			// modelled, so keep it as is.
+			sym.Aux = append(funcAux, sym.Aux...)
+			return nil
 		}
 		b := rr.Data(isym)
 		info := goobj2.FuncInfo{}
@@ -848,13 +902,19 @@ func (r *objReader) parseObject(prefix []byte, importMap ImportMap, returnReader
 		if dlines != nil {
 			f.DwarfDebugLines = dlines
 		}
+		if badRef != nil {
+			return &FormatError{sym.Name, fmt.Sprintf("invalid symbol reference %v", *badRef)}
+		}
+		return nil
 	}
 
 	// Symbol definitions
 	nsymDefs := rr.NSym()
 	am.SymDefs = make([]*Sym, nsymDefs)
 	for i := 0; i < nsymDefs; i++ {
-		parseSym(i, i, am.SymDefs)
+		if err := parseSym(i, i, am.SymDefs); err != nil {
+			return nil, nil, nil, err
+		}
 	}
 
 	// Non-pkg symbol definitions
@@ -862,7 +922,9 @@ func (r *objReader) parseObject(prefix []byte, importMap ImportMap, returnReader
 	am.NonPkgSymDefs = make([]*Sym, nNonPkgDefs)
 	parsedSyms := nsymDefs
 	for i := 0; i < nNonPkgDefs; i++ {
-		parseSym(i+parsedSyms, i, am.NonPkgSymDefs)
+		if err := parseSym(i+parsedSyms, i, am.NonPkgSymDefs); err != nil {
+			return nil, nil, nil, err
+		}
 	}
 
 	// Non-pkg symbol references
@@ -870,7 +932,9 @@ func (r *objReader) parseObject(prefix []byte, importMap ImportMap, returnReader
 	am.NonPkgSymRefs = make([]*Sym, nNonPkgRefs)
 	parsedSyms += nNonPkgDefs
 	for i := 0; i < nNonPkgRefs; i++ {
-		parseSym(i+parsedSyms, i, am.NonPkgSymRefs)
+		if err := parseSym(i+parsedSyms, i, am.NonPkgSymRefs); err != nil {
+			return nil, nil, nil, err
+		}
 	}
 
 	// Symbol references were already parsed above
@@ -882,6 +946,9 @@ func (r *objReader) parseObject(prefix []byte, importMap ImportMap, returnReader
 
 	objReaders := make([]*goobj2.Reader, len(am.Packages))
 	for _, inl := range inlFuncsToResolve {
+		if inl.Func.PkgIdx == 0 || int(inl.Func.PkgIdx) > len(objReaders) {
+			return nil, nil, nil, fmt.Errorf("%w: inlined function of package %d, not one of the %d referenced", errCorruptObject, inl.Func.PkgIdx, len(objReaders))
+		}
 		if pkgIdx := inl.Func.PkgIdx; objReaders[pkgIdx-1] == nil {
 			pkgName := am.Packages[pkgIdx-1]
 			archivePath, err := getArchivePath(pkgName, importMap)
@@ -0,0 +1,47 @@
+//go:build go1.18
+// +build go1.18
+
+package goobj2
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/Binject/debug/goobj2/internal/objabi"
+)
+
+func FuzzParse(f *testing.F) {
+	dir := f.TempDir()
+	pkg := newTestPackage()
+	body := []byte{0xe8, 0, 0, 0, 0, 0xc3} // CALL runtime.printlock; RET
+	relocs := []Reloc{{Name: "runtime.printlock", Offset: 1, Size: 4, Type: objabi.R_CALL}}
+	if _, err := pkg.AddTextSym(`"".injected`, body, relocs, 8, 16); err != nil {
+		f.Fatal(err)
+	}
+	seed := filepath.Join(dir, "seed.a")
+	if err := pkg.Write(seed); err != nil {
+		f.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(seed)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(data)
+
+	// Dependencies are looked up in dir, where there are none, rather than
+	// with the go command.
+	noDeps := func(importPath string) string { return filepath.Join(dir, "missing.a") }
+	f.Fuzz(func(t *testing.T, data []byte) {
+		path := filepath.Join(t.TempDir(), "fuzz.a")
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Parse may fail, but not panic, whatever the file holds.
+		pkg, err := Parse(path, "main", noDeps)
+		if err != nil {
+			return
+		}
+		pkg.Write(filepath.Join(t.TempDir(), "out.a"))
+	})
+}
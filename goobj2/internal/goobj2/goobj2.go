@@ -646,6 +646,9 @@ func (h *Header) Write(w *Writer) {
 }
 
 func (h *Header) Read(r *Reader) error {
+	if len(r.b) < len(Magic)+len(h.Fingerprint)+4+4*len(h.Offsets) {
+		return errors.New("object file too short for its header")
+	}
 	b := r.BytesAt(0, len(Magic))
 	h.Magic = string(b)
 	if h.Magic != Magic {
@@ -660,6 +663,13 @@ func (h *Header) Read(r *Reader) error {
 		h.Offsets[i] = r.uint32At(off)
 		off += 4
 	}
+	// The blocks are laid out in order, and the accessors of Reader
+	// trust the offsets to be within the file.
+	for i := range h.Offsets {
+		if int64(h.Offsets[i]) > int64(len(r.b)) || i > 0 && h.Offsets[i] < h.Offsets[i-1] {
+			return errors.New("block offsets out of range")
+		}
+	}
 	return nil
 }
 
@@ -986,6 +996,8 @@ func NewReaderFromBytes(b []byte, readonly bool) *Reader {
 	return r
 }
 
+// BytesAt returns the len bytes at off. Like the other accessors of
+// Reader, it panics if they are not within the file.
 func (r *Reader) BytesAt(off uint32, len int) []byte {
 	if len == 0 {
 		return nil
@@ -1112,8 +1124,8 @@ func (r *Reader) SymOff(i int) uint32 {
 
 // Sym returns a pointer to the i-th symbol.
 func (r *Reader) Sym(i int) *Sym {
-	off := r.SymOff(i)
-	return (*Sym)(unsafe.Pointer(&r.b[off]))
+	b := r.BytesAt(r.SymOff(i), SymSize)
+	return (*Sym)(unsafe.Pointer(&b[0]))
 }
 
 // NReloc returns the number of relocations of the i-th symbol.
@@ -1131,15 +1143,18 @@ func (r *Reader) RelocOff(i int, j int) uint32 {
 
 // Reloc returns a pointer to the j-th relocation of the i-th symbol.
 func (r *Reader) Reloc(i int, j int) *Reloc {
-	off := r.RelocOff(i, j)
-	return (*Reloc)(unsafe.Pointer(&r.b[off]))
+	b := r.BytesAt(r.RelocOff(i, j), RelocSize)
+	return (*Reloc)(unsafe.Pointer(&b[0]))
 }
 
 // Relocs returns a pointer to the relocations of the i-th symbol.
 func (r *Reader) Relocs(i int) []Reloc {
-	off := r.RelocOff(i, 0)
 	n := r.NReloc(i)
-	return (*[1 << 20]Reloc)(unsafe.Pointer(&r.b[off]))[:n:n]
+	if n == 0 {
+		return nil
+	}
+	b := r.BytesAt(r.RelocOff(i, 0), n*RelocSize)
+	return (*[1 << 20]Reloc)(unsafe.Pointer(&b[0]))[:n:n]
 }
 
 // NAux returns the number of aux symbols of the i-th symbol.
@@ -1157,15 +1172,18 @@ func (r *Reader) AuxOff(i int, j int) uint32 {
 
 // Aux returns a pointer to the j-th aux symbol of the i-th symbol.
 func (r *Reader) Aux(i int, j int) *Aux {
-	off := r.AuxOff(i, j)
-	return (*Aux)(unsafe.Pointer(&r.b[off]))
+	b := r.BytesAt(r.AuxOff(i, j), AuxSize)
+	return (*Aux)(unsafe.Pointer(&b[0]))
 }
 
 // Auxs returns the aux symbols of the i-th symbol.
 func (r *Reader) Auxs(i int) []Aux {
-	off := r.AuxOff(i, 0)
 	n := r.NAux(i)
-	return (*[1 << 20]Aux)(unsafe.Pointer(&r.b[off]))[:n:n]
+	if n == 0 {
+		return nil
+	}
+	b := r.BytesAt(r.AuxOff(i, 0), n*AuxSize)
+	return (*[1 << 20]Aux)(unsafe.Pointer(&b[0]))[:n:n]
 }
 
 // DataOff returns the offset of the i-th symbol's data.
@@ -1202,8 +1220,8 @@ func (r *Reader) NRefName() int {
 // RefName returns a pointer to the i-th referenced symbol name.
 // Note: here i is not a local symbol index, just a counter.
 func (r *Reader) RefName(i int) *RefName {
-	off := r.h.Offsets[BlkRefName] + uint32(i*RefNameSize)
-	return (*RefName)(unsafe.Pointer(&r.b[off]))
+	b := r.BytesAt(r.h.Offsets[BlkRefName]+uint32(i*RefNameSize), RefNameSize)
+	return (*RefName)(unsafe.Pointer(&b[0]))
 }
 
 // ReadOnly returns whether r.BytesAt returns read-only bytes.
@@ -0,0 +1,98 @@
+package goobj2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// A PCValue is an entry of a PC-value table, such as Func.PCSP, PCFile or
+// PCLine: Value holds for the PCs in [Start, End), which are offsets from
+// the start of the function.
+type PCValue struct {
+	Start, End uint32
+	Value      int32
+}
+
+// PCQuantum returns the unit of the PC deltas in the PC-value tables of
+// the package, the minimum instruction size of its architecture.
+func (p Package) PCQuantum() uint32 {
+	switch p.arch {
+	case "arm", "arm64", "loong64", "mips", "mipsle", "mips64", "mips64le", "ppc64", "ppc64le", "riscv64":
+		return 4
+	case "s390x":
+		return 2
+	}
+	return 1
+}
+
+// DecodePCTable decodes a PC-value table whose PC deltas are in units of
+// quantum. The table is a sequence of pairs of a zig-zag varint value
+// delta, from an initial value of -1, and a uvarint PC delta, ended by a
+// zero value delta; an empty table has no entries.
+func DecodePCTable(b []byte, quantum uint32) ([]PCValue, error) {
+	var t []PCValue
+	val, pc := int32(-1), uint32(0)
+	for first := true; ; first = false {
+		if len(b) == 0 {
+			if first {
+				return nil, nil
+			}
+			return nil, errors.New("PC-value table is not terminated")
+		}
+		uvdelta, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, fmt.Errorf("bad value delta in PC-value table at PC %#x", pc)
+		}
+		b = b[n:]
+		if uvdelta == 0 && !first {
+			break
+		}
+		val += int32(uvdelta>>1) ^ -int32(uvdelta&1)
+		pcdelta, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, fmt.Errorf("bad PC delta in PC-value table at PC %#x", pc)
+		}
+		b = b[n:]
+		end := pc + uint32(pcdelta)*quantum
+		t = append(t, PCValue{pc, end, val})
+		pc = end
+	}
+	if len(b) != 0 {
+		return nil, fmt.Errorf("%d bytes after the end of the PC-value table", len(b))
+	}
+	return t, nil
+}
+
+// EncodePCTable encodes t as a PC-value table whose PC deltas are in
+// units of quantum, as the compiler does. The entries must cover the
+// function from PC 0 without gaps, in units of quantum; consecutive
+// entries with the same value are merged, as the encoding requires.
+func EncodePCTable(t []PCValue, quantum uint32) ([]byte, error) {
+	if len(t) == 0 {
+		return nil, nil
+	}
+	var out []byte
+	var buf [binary.MaxVarintLen64]byte
+	val, pc := int32(-1), uint32(0)
+	for i := 0; i < len(t); {
+		e := t[i]
+		if e.Start != pc {
+			return nil, fmt.Errorf("PC-value entry %d starts at %#x, not %#x", i, e.Start, pc)
+		}
+		// Extend e over the entries that follow with the same value.
+		for i++; i < len(t) && t[i].Value == e.Value && t[i].Start == e.End; i++ {
+			e.End = t[i].End
+		}
+		if e.End <= e.Start || (e.End-e.Start)%quantum != 0 {
+			return nil, fmt.Errorf("PC-value entry [%#x, %#x) is not a positive multiple of %d bytes", e.Start, e.End, quantum)
+		}
+		delta := e.Value - val
+		n := binary.PutUvarint(buf[:], uint64(uint32(delta<<1^delta>>31)))
+		out = append(out, buf[:n]...)
+		n = binary.PutUvarint(buf[:], uint64((e.End-e.Start)/quantum))
+		out = append(out, buf[:n]...)
+		val, pc = e.Value, e.End
+	}
+	return append(out, 0), nil
+}
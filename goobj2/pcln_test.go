@@ -0,0 +1,60 @@
+package goobj2
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestPCTable(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		enc     []byte
+		quantum uint32
+		t       []PCValue
+	}{
+		{"empty", nil, 1, nil},
+		// SP offset 0 until the frame is set up, then 24, then back to 0
+		// for the return.
+		{"pcsp", []byte{0x02, 0x04, 0x30, 0x0a, 0x2f, 0x01, 0x00}, 1, []PCValue{{0, 4, 0}, {4, 14, 24}, {14, 15, 0}}},
+		{"quantum", []byte{0x00, 0x02, 0x14, 0x03, 0x00}, 4, []PCValue{{0, 8, -1}, {8, 20, 9}}},
+	} {
+		got, err := DecodePCTable(tt.enc, tt.quantum)
+		if err != nil || !reflect.DeepEqual(got, tt.t) {
+			t.Errorf("%s: DecodePCTable = %v, %v; want %v", tt.name, got, err, tt.t)
+		}
+		enc, err := EncodePCTable(tt.t, tt.quantum)
+		if err != nil || !bytes.Equal(enc, tt.enc) {
+			t.Errorf("%s: EncodePCTable = % x, %v; want % x", tt.name, enc, err, tt.enc)
+		}
+	}
+
+	// Entries with the same value are merged.
+	enc, err := EncodePCTable([]PCValue{{0, 2, 5}, {2, 6, 5}, {6, 7, 3}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := DecodePCTable(enc, 1); err != nil || !reflect.DeepEqual(got, []PCValue{{0, 6, 5}, {6, 7, 3}}) {
+		t.Errorf("merged table decodes as %v, %v", got, err)
+	}
+
+	for _, bad := range [][]PCValue{
+		{{1, 2, 0}},            // does not start at 0
+		{{0, 2, 0}, {3, 4, 1}}, // gap
+		{{0, 0, 0}},            // empty
+		{{0, 6, 0}},            // not a multiple of the quantum
+	} {
+		if _, err := EncodePCTable(bad, 4); err == nil {
+			t.Errorf("EncodePCTable(%v) succeeded", bad)
+		}
+	}
+	for _, bad := range [][]byte{
+		{0x02, 0x04},             // not terminated
+		{0x02, 0x04, 0x00, 0x01}, // trailing bytes
+		{0x02, 0x80},             // truncated varint
+	} {
+		if _, err := DecodePCTable(bad, 1); err == nil {
+			t.Errorf("DecodePCTable(% x) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package goobj2
+
+import (
+	"fmt"
+
+	"github.com/Binject/debug/goobj2/internal/goobj2"
+)
+
+// RewriteRelocs calls apply on every relocation of the symbols the
+// package's Go objects define for which match returns true, and returns
+// the number of relocations rewritten.
+//
+// If apply changes the Name of a relocation and leaves its Sym unset,
+// the Sym is resolved by name against the symbols the object defines or
+// references, as AddTextSym does. If a name cannot be resolved, no
+// relocation is changed.
+func (pkg *Package) RewriteRelocs(match func(*Reloc) bool, apply func(*Reloc)) (int, error) {
+	type rewrite struct {
+		sym    *Sym
+		relocs []Reloc
+	}
+	var rewrites []rewrite
+	n := 0
+	for i := range pkg.ArchiveMembers {
+		am := &pkg.ArchiveMembers[i]
+		if am.IsDataObj {
+			continue
+		}
+		for _, list := range [][]*Sym{am.SymDefs, am.NonPkgSymDefs} {
+			for _, s := range list {
+				var relocs []Reloc
+				for j := range s.Reloc {
+					if !match(&s.Reloc[j]) {
+						continue
+					}
+					if relocs == nil {
+						relocs = append([]Reloc(nil), s.Reloc...)
+					}
+					r := &relocs[j]
+					apply(r)
+					n++
+					if r.Sym != (goobj2.SymRef{}) || r.Name == "" {
+						continue
+					}
+					ref := am.symByName(r.Name)
+					if ref == nil {
+						return 0, fmt.Errorf("relocation %d of %s refers to unknown symbol %s", j, s.Name, r.Name)
+					}
+					r.Sym = ref.SymRef
+				}
+				if relocs != nil {
+					rewrites = append(rewrites, rewrite{s, relocs})
+				}
+			}
+		}
+	}
+	for _, rw := range rewrites {
+		rw.sym.Reloc = rw.relocs
+	}
+	return n, nil
+}
+
+// RetargetRelocs makes all relocations against the symbol from refer to
+// the symbol to instead, keeping their offsets, types and addends, for
+// example to redirect calls to a function. An object that neither
+// defines nor references to gets a non-package reference to it. It
+// returns the number of relocations retargeted.
+func (pkg *Package) RetargetRelocs(from, to string) (int, error) {
+	if to == "" {
+		return 0, fmt.Errorf("cannot retarget relocations against %s to an unnamed symbol", from)
+	}
+	for i := range pkg.ArchiveMembers {
+		am := &pkg.ArchiveMembers[i]
+		if am.IsDataObj || am.symByName(to) != nil || !am.hasRelocsTo(from) {
+			continue
+		}
+		am.addNonPkgSymRef(&Sym{Name: to, Kind: Sxxx})
+	}
+	return pkg.RewriteRelocs(
+		func(r *Reloc) bool { return r.Name == from },
+		func(r *Reloc) { r.Name, r.Sym = to, goobj2.SymRef{} },
+	)
+}
+
+// hasRelocsTo reports whether a symbol the object defines has a
+// relocation against the symbol called name.
+func (a *ArchiveMember) hasRelocsTo(name string) bool {
+	for _, list := range [][]*Sym{a.SymDefs, a.NonPkgSymDefs} {
+		for _, s := range list {
+			for _, r := range s.Reloc {
+				if r.Name == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// addNonPkgSymRef appends s to the non-package symbol references. They
+// come last in the object's symbol index space, so no key of symMap
+// moves.
+func (a *ArchiveMember) addNonPkgSymRef(s *Sym) {
+	if a.symMap == nil {
+		a.symMap = make(map[int]*Sym)
+	}
+	a.symMap[len(a.SymDefs)+len(a.NonPkgSymDefs)+len(a.NonPkgSymRefs)] = s
+	a.NonPkgSymRefs = append(a.NonPkgSymRefs, s)
+}
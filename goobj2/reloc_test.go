@@ -0,0 +1,54 @@
+package goobj2
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Binject/debug/goobj2/internal/goobj2"
+	"github.com/Binject/debug/goobj2/internal/objabi"
+)
+
+func TestRetargetRelocs(t *testing.T) {
+	pkg := newTestPackage()
+	body := []byte{0xe8, 0, 0, 0, 0, 0xc3} // CALL runtime.printlock; RET
+	relocs := []Reloc{{Name: "runtime.printlock", Offset: 1, Size: 4, Type: objabi.R_CALL, Add: -4}}
+	sym, err := pkg.AddTextSym(`"".injected`, body, relocs, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pkg.RewriteRelocs(
+		func(r *Reloc) bool { return true },
+		func(r *Reloc) { r.Name, r.Sym = "nosuchsym", goobj2.SymRef{} },
+	); err == nil {
+		t.Error("RewriteRelocs resolved an unknown symbol")
+	}
+	if sym.Reloc[0].Name != "runtime.printlock" {
+		t.Errorf("failed RewriteRelocs changed the relocation to %+v", sym.Reloc[0])
+	}
+
+	n, err := pkg.RetargetRelocs("runtime.printlock", "runtime.printunlock")
+	if err != nil || n != 1 {
+		t.Fatalf("RetargetRelocs() = %d, %v", n, err)
+	}
+	// The new reference follows go.string.hi and runtime.printlock.
+	if want := (goobj2.SymRef{PkgIdx: goobj2.PkgIdxNone, SymIdx: 2}); sym.Reloc[0].Sym != want || sym.Reloc[0].Add != -4 {
+		t.Errorf("retargeted relocation is %+v, want Sym %v", sym.Reloc[0], want)
+	}
+
+	path := filepath.Join(t.TempDir(), "retargeted.a")
+	if err := pkg.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	pkg2, err := Parse(path, "main", nil)
+	if err != nil {
+		t.Fatalf("failed to parse written object: %v", err)
+	}
+	am := pkg2.ArchiveMembers[0]
+	if r := am.SymDefs[0].Reloc; len(r) != 1 || r[0].Name != "runtime.printunlock" || r[0].Type != objabi.R_CALL {
+		t.Errorf("got relocations %+v", r)
+	}
+	if n, err := pkg2.RetargetRelocs("runtime.printlock", "runtime.printunlock"); n != 0 || err != nil {
+		t.Errorf("RetargetRelocs() = %d, %v with nothing to retarget", n, err)
+	}
+}
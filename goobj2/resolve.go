@@ -0,0 +1,203 @@
+package goobj2
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Binject/debug/goobj2/internal/goobj2"
+)
+
+// A Resolver follows symbol references from the objects of one package to
+// the symbols that define them in the other packages it has loaded.
+//
+// References to indexed symbols name the defining package by its
+// position in the referring object's Packages, and the symbol by its
+// index in the SymDefs of that package's Go object. Non-package and
+// builtin references are resolved by name instead, against the symbols
+// defined by all the loaded packages.
+type Resolver struct {
+	pkgs   map[string]*Package
+	byName map[string]resolved // built on first use
+}
+
+type resolved struct {
+	sym *Sym
+	pkg *Package
+}
+
+// NewResolver returns a Resolver for the given packages, which must have
+// distinct import paths.
+func NewResolver(pkgs ...*Package) (*Resolver, error) {
+	r := &Resolver{pkgs: make(map[string]*Package)}
+	for _, pkg := range pkgs {
+		if err := r.Add(pkg); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Add adds pkg to the packages r resolves references against.
+func (r *Resolver) Add(pkg *Package) error {
+	if pkg.ImportPath == "" {
+		return errors.New("package has no import path")
+	}
+	if _, ok := r.pkgs[pkg.ImportPath]; ok {
+		return fmt.Errorf("package %s is already loaded", pkg.ImportPath)
+	}
+	r.pkgs[pkg.ImportPath] = pkg
+	r.byName = nil
+	return nil
+}
+
+// LoadImportCfg parses and adds the package files of cfg, as written by
+// the go command for the compiler and linker. Shared libraries are
+// skipped.
+func (r *Resolver) LoadImportCfg(cfg ImportCfg) error {
+	importMap := func(importPath string) string {
+		if mapped, ok := cfg.ImportMap[importPath]; ok {
+			importPath = mapped
+		}
+		return cfg.Packages[importPath].Path
+	}
+	for importPath, info := range cfg.Packages {
+		if info.IsSharedLib {
+			continue
+		}
+		pkg, err := Parse(info.Path, importPath, importMap)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %v", importPath, err)
+		}
+		if err := r.Add(pkg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadDir parses and adds the package archives under dir, laid out as in
+// a GOPATH pkg directory: the import path of an archive is its path
+// relative to dir without the .a suffix.
+func (r *Resolver) LoadDir(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".a" {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		importPath := filepath.ToSlash(strings.TrimSuffix(rel, ".a"))
+		pkg, err := Parse(path, importPath, nil)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %v", path, err)
+		}
+		return r.Add(pkg)
+	})
+}
+
+// Package returns the loaded package with the given import path, or nil.
+func (r *Resolver) Package(importPath string) *Package {
+	return r.pkgs[importPath]
+}
+
+// Resolve returns the symbol that ref, a reference made by the object am
+// of pkg, refers to, and the package defining it.
+func (r *Resolver) Resolve(pkg *Package, am *ArchiveMember, ref goobj2.SymRef) (*Sym, *Package, error) {
+	switch p := ref.PkgIdx; p {
+	case goobj2.PkgIdxInvalid:
+		return nil, nil, errors.New("nil symbol reference")
+	case goobj2.PkgIdxSelf:
+		if int(ref.SymIdx) >= len(am.SymDefs) {
+			return nil, nil, fmt.Errorf("symbol %d of %d defined by %s", ref.SymIdx, len(am.SymDefs), pkg.ImportPath)
+		}
+		return am.SymDefs[ref.SymIdx], pkg, nil
+	case goobj2.PkgIdxNone:
+		i := int(ref.SymIdx)
+		if i < len(am.NonPkgSymDefs) {
+			return am.NonPkgSymDefs[i], pkg, nil
+		}
+		i -= len(am.NonPkgSymDefs)
+		if i >= len(am.NonPkgSymRefs) {
+			return nil, nil, fmt.Errorf("non-package symbol %d of %d in %s", ref.SymIdx, len(am.NonPkgSymDefs)+len(am.NonPkgSymRefs), pkg.ImportPath)
+		}
+		return r.lookup(am.NonPkgSymRefs[i].Name)
+	case goobj2.PkgIdxBuiltin:
+		if int(ref.SymIdx) >= goobj2.NBuiltin() {
+			return nil, nil, fmt.Errorf("builtin symbol %d of %d", ref.SymIdx, goobj2.NBuiltin())
+		}
+		name, _ := goobj2.BuiltinName(int(ref.SymIdx))
+		return r.lookup(name)
+	}
+
+	if int(ref.PkgIdx) > len(am.Packages) {
+		return nil, nil, fmt.Errorf("package %d of %d referenced by %s", ref.PkgIdx, len(am.Packages), pkg.ImportPath)
+	}
+	path := am.Packages[ref.PkgIdx-1]
+	def := r.pkgs[path]
+	if def == nil && strings.ContainsRune(path, '%') {
+		// Package paths are escaped in the same way as in symbol
+		// names.
+		if unescaped, err := url.QueryUnescape(path); err == nil {
+			def = r.pkgs[unescaped]
+		}
+	}
+	if def == nil {
+		return nil, nil, fmt.Errorf("package %s is not loaded", path)
+	}
+	var defObj *ArchiveMember
+	for i := range def.ArchiveMembers {
+		if !def.ArchiveMembers[i].IsDataObj {
+			defObj = &def.ArchiveMembers[i]
+			break
+		}
+	}
+	if defObj == nil {
+		return nil, nil, fmt.Errorf("package %s has no Go object", path)
+	}
+	for _, imp := range am.Imports {
+		if imp.Pkg == path && !imp.Fingerprint.IsZero() && !defObj.ObjHeader.Fingerprint.IsZero() && imp.Fingerprint != defObj.ObjHeader.Fingerprint {
+			return nil, nil, fmt.Errorf("package %s does not match the one %s was compiled against", path, pkg.ImportPath)
+		}
+	}
+	if int(ref.SymIdx) >= len(defObj.SymDefs) {
+		return nil, nil, fmt.Errorf("symbol %d of %d defined by %s", ref.SymIdx, len(defObj.SymDefs), path)
+	}
+	return defObj.SymDefs[ref.SymIdx], def, nil
+}
+
+// lookup returns the symbol with the given name that a loaded package
+// defines. Symbols that several packages define, such as DUPOK type
+// descriptors, are taken from the first package in import path order.
+func (r *Resolver) lookup(name string) (*Sym, *Package, error) {
+	if r.byName == nil {
+		r.byName = make(map[string]resolved)
+		paths := make([]string, 0, len(r.pkgs))
+		for path := range r.pkgs {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			pkg := r.pkgs[path]
+			for i := range pkg.ArchiveMembers {
+				am := &pkg.ArchiveMembers[i]
+				for _, list := range [][]*Sym{am.SymDefs, am.NonPkgSymDefs} {
+					for _, s := range list {
+						if _, dup := r.byName[s.Name]; !dup {
+							r.byName[s.Name] = resolved{s, pkg}
+						}
+					}
+				}
+			}
+		}
+	}
+	if d, ok := r.byName[name]; ok {
+		return d.sym, d.pkg, nil
+	}
+	return nil, nil, fmt.Errorf("no loaded package defines %s", name)
+}
@@ -0,0 +1,71 @@
+package goobj2
+
+import (
+	"testing"
+
+	"github.com/Binject/debug/goobj2/internal/goobj2"
+)
+
+func TestResolver(t *testing.T) {
+	println := &Sym{Name: "fmt.Println", Kind: STEXT}
+	fmtPkg := &Package{ImportPath: "fmt", ArchiveMembers: []ArchiveMember{
+		{ArchiveHeader: ArchiveHeader{Name: CompilerObjName}, IsDataObj: true},
+		{
+			ObjHeader: goobj2.Header{Fingerprint: goobj2.FingerprintType{1}},
+			SymDefs:   []*Sym{{Name: "fmt.init", Kind: STEXT}, println},
+		},
+	}}
+	printlock := &Sym{Name: "runtime.printlock", Kind: STEXT}
+	newobject := &Sym{Name: "runtime.newobject", Kind: STEXT}
+	runtime := &Package{ImportPath: "runtime", ArchiveMembers: []ArchiveMember{
+		{SymDefs: []*Sym{newobject}, NonPkgSymDefs: []*Sym{printlock}},
+	}}
+	main := newTestPackage()
+	am := &main.ArchiveMembers[0]
+	am.Packages = []string{"fmt", "strings"}
+	am.Imports = []goobj2.ImportedPkg{{Pkg: "fmt", Fingerprint: goobj2.FingerprintType{1}}}
+
+	r, err := NewResolver(main, fmtPkg, runtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Add(&Package{ImportPath: "fmt"}); err == nil {
+		t.Error("Add accepted a second package fmt")
+	}
+	if r.Package("fmt") != fmtPkg {
+		t.Error("Package(fmt) did not return fmt")
+	}
+
+	for _, c := range []struct {
+		ref goobj2.SymRef
+		sym *Sym
+		pkg *Package
+	}{
+		{goobj2.SymRef{PkgIdx: 1, SymIdx: 1}, println, fmtPkg},
+		{goobj2.SymRef{PkgIdx: goobj2.PkgIdxNone, SymIdx: 0}, am.NonPkgSymDefs[0], main},
+		{goobj2.SymRef{PkgIdx: goobj2.PkgIdxNone, SymIdx: 1}, printlock, runtime},
+		{goobj2.SymRef{PkgIdx: goobj2.PkgIdxBuiltin, SymIdx: uint32(goobj2.BuiltinIdx("runtime.newobject", 1))}, newobject, runtime},
+	} {
+		sym, pkg, err := r.Resolve(main, am, c.ref)
+		if err != nil || sym != c.sym || pkg != c.pkg {
+			t.Errorf("Resolve(%v) = %v in %v, %v; want %s", c.ref, sym, pkg, err, c.sym.Name)
+		}
+	}
+	for _, ref := range []goobj2.SymRef{
+		{},
+		{PkgIdx: 1, SymIdx: 2},
+		{PkgIdx: 2, SymIdx: 0}, // strings is not loaded
+		{PkgIdx: 3, SymIdx: 0},
+		{PkgIdx: goobj2.PkgIdxNone, SymIdx: 2},
+		{PkgIdx: goobj2.PkgIdxSelf, SymIdx: 0},
+	} {
+		if sym, _, err := r.Resolve(main, am, ref); err == nil {
+			t.Errorf("Resolve(%v) = %s, want an error", ref, sym.Name)
+		}
+	}
+
+	am.Imports[0].Fingerprint = goobj2.FingerprintType{2}
+	if _, _, err := r.Resolve(main, am, goobj2.SymRef{PkgIdx: 1, SymIdx: 1}); err == nil {
+		t.Error("Resolve followed a reference into a package with another fingerprint")
+	}
+}
@@ -0,0 +1,125 @@
+package goobj2
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Binject/debug/goobj2/internal/goobj2"
+)
+
+// AddTextSym adds a new function symbol to the first Go object in the
+// package. The symbol's machine code is body, and relocs are applied to it.
+//
+// Symbols of the package being compiled are named with a `"".` prefix,
+// e.g. `"".foo`, as the compiler does. A Reloc whose Sym is unset is
+// resolved by its Name, if it has one, against the symbols the object
+// already defines or references.
+//
+// The function gets empty PC tables and no funcdata, like an assembly
+// function without a frame pointer, and a FuncInfo symbol is created for
+// it so the linker accepts the object. The returned Sym can be modified
+// further, for example to set its Flag, before calling Write.
+func (pkg *Package) AddTextSym(name string, body []byte, relocs []Reloc, args, frame int64) (*Sym, error) {
+	var am *ArchiveMember
+	for i := range pkg.ArchiveMembers {
+		if !pkg.ArchiveMembers[i].IsDataObj {
+			am = &pkg.ArchiveMembers[i]
+			break
+		}
+	}
+	if am == nil {
+		return nil, errors.New("package has no Go object to add a symbol to")
+	}
+	if name == "" {
+		return nil, errors.New("symbol name is empty")
+	}
+	if am.symByName(name) != nil {
+		return nil, fmt.Errorf("symbol %s already exists", name)
+	}
+
+	relocs = append([]Reloc(nil), relocs...)
+	for i := range relocs {
+		r := &relocs[i]
+		if r.Offset < 0 || r.Offset+r.Size > int64(len(body)) {
+			return nil, fmt.Errorf("relocation %d at [%d, %d) is outside of the symbol body", i, r.Offset, r.Offset+r.Size)
+		}
+		if r.Sym != (goobj2.SymRef{}) || r.Name == "" {
+			continue
+		}
+		ref := am.symByName(r.Name)
+		if ref == nil {
+			return nil, fmt.Errorf("relocation %d refers to unknown symbol %s", i, r.Name)
+		}
+		r.Sym = ref.SymRef
+	}
+
+	sym := &Sym{
+		Name:  name,
+		Kind:  STEXT,
+		Size:  uint32(len(body)),
+		Data:  append([]byte(nil), body...),
+		Reloc: relocs,
+	}
+	// The compiler emits FuncInfo symbols as unnamed SDATA symbols
+	// appended to the package's symbol definitions.
+	info := &Sym{Kind: SDATA}
+
+	am.addSymDef(sym)
+	infoIdx := am.addSymDef(info)
+	sym.Func = &Func{
+		Args:       args,
+		Frame:      frame,
+		FuncInfo:   &SymRef{"", goobj2.SymRef{PkgIdx: goobj2.PkgIdxSelf, SymIdx: uint32(infoIdx)}},
+		dataSymIdx: infoIdx,
+	}
+	am.textSyms = append(am.textSyms, sym)
+	return sym, nil
+}
+
+// addSymDef appends s to the package symbol definitions and returns its
+// index. symMap is keyed by the index of each symbol in the object, in
+// which the non-package symbols follow the package ones, so their keys
+// are shifted to make room.
+func (a *ArchiveMember) addSymDef(s *Sym) int {
+	idx := len(a.SymDefs)
+	if a.symMap == nil {
+		a.symMap = make(map[int]*Sym)
+	}
+	n := len(a.SymDefs) + len(a.NonPkgSymDefs) + len(a.NonPkgSymRefs)
+	for i := n - 1; i >= idx; i-- {
+		if sym, ok := a.symMap[i]; ok {
+			a.symMap[i+1] = sym
+			delete(a.symMap, i)
+		}
+	}
+	a.SymDefs = append(a.SymDefs, s)
+	a.symMap[idx] = s
+	return idx
+}
+
+// symByName returns a reference to the symbol called name that the object
+// defines or references, or nil.
+func (a *ArchiveMember) symByName(name string) *SymRef {
+	for i, s := range a.SymDefs {
+		if s.Name == name {
+			return &SymRef{name, goobj2.SymRef{PkgIdx: goobj2.PkgIdxSelf, SymIdx: uint32(i)}}
+		}
+	}
+	for i, s := range a.NonPkgSymDefs {
+		if s.Name == name {
+			return &SymRef{name, goobj2.SymRef{PkgIdx: goobj2.PkgIdxNone, SymIdx: uint32(i)}}
+		}
+	}
+	for i, s := range a.NonPkgSymRefs {
+		if s.Name == name {
+			return &SymRef{name, goobj2.SymRef{PkgIdx: goobj2.PkgIdxNone, SymIdx: uint32(len(a.NonPkgSymDefs) + i)}}
+		}
+	}
+	for _, r := range a.SymRefs {
+		if r.Name == name {
+			ref := r
+			return &ref
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package goobj2
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/Binject/debug/goobj2/internal/goobj2"
+	"github.com/Binject/debug/goobj2/internal/objabi"
+)
+
+// newTestPackage returns a package with a single, otherwise empty Go
+// object that defines one non-package data symbol and references one
+// non-package function.
+func newTestPackage() *Package {
+	am := ArchiveMember{
+		ArchiveHeader: ArchiveHeader{
+			Name: "_go_.o",
+			Date: "0",
+			UID:  "0",
+			GID:  "0",
+			Mode: "644",
+			Data: []byte("go object linux amd64 go1.15 X:none\n!\n"),
+		},
+		ObjHeader: goobj2.Header{Magic: goobj2.Magic},
+		NonPkgSymDefs: []*Sym{
+			{Name: "go.string.hi", Kind: SRODATA, Size: 2, Data: []byte("hi")},
+		},
+		NonPkgSymRefs: []*Sym{
+			{Name: "runtime.printlock", Kind: Sxxx},
+		},
+		symMap: make(map[int]*Sym),
+	}
+	am.symMap[0] = am.NonPkgSymDefs[0]
+	am.symMap[1] = am.NonPkgSymRefs[0]
+	return &Package{ArchiveMembers: []ArchiveMember{am}, ImportPath: "main"}
+}
+
+func TestAddTextSym(t *testing.T) {
+	pkg := newTestPackage()
+
+	body := []byte{0xe8, 0, 0, 0, 0, 0xc3} // CALL runtime.printlock; RET
+	relocs := []Reloc{{Name: "runtime.printlock", Offset: 1, Size: 4, Type: objabi.R_CALL}}
+	sym, err := pkg.AddTextSym(`"".injected`, body, relocs, 8, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (goobj2.SymRef{PkgIdx: goobj2.PkgIdxNone, SymIdx: 1}); sym.Reloc[0].Sym != want {
+		t.Errorf("relocation resolved to %v, want %v", sym.Reloc[0].Sym, want)
+	}
+	if _, err := pkg.AddTextSym(`"".injected`, body, nil, 0, 0); err == nil {
+		t.Error("adding a duplicate symbol succeeded")
+	}
+	if _, err := pkg.AddTextSym(`"".other`, body, []Reloc{{Name: "nosuchsym", Offset: 1, Size: 4}}, 0, 0); err == nil {
+		t.Error("relocation to an unknown symbol succeeded")
+	}
+	if _, err := pkg.AddTextSym(`"".other`, body, []Reloc{{Name: "runtime.printlock", Offset: 4, Size: 4}}, 0, 0); err == nil {
+		t.Error("relocation outside of the body succeeded")
+	}
+
+	path := filepath.Join(t.TempDir(), "injected.a")
+	if err := pkg.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	pkg2, err := Parse(path, "main", nil)
+	if err != nil {
+		t.Fatalf("failed to parse written object: %v", err)
+	}
+
+	am := pkg2.ArchiveMembers[0]
+	if len(am.SymDefs) != 2 {
+		t.Fatalf("got %d symbol definitions, want 2", len(am.SymDefs))
+	}
+	s := am.SymDefs[0]
+	if s.Name != `"".injected` || s.Kind != STEXT || !bytes.Equal(s.Data, body) {
+		t.Errorf("got symbol %s of kind %d with data %x", s.Name, s.Kind, s.Data)
+	}
+	if s.Func == nil {
+		t.Fatal("injected symbol has no Func")
+	}
+	if s.Func.Args != 8 || s.Func.Frame != 16 {
+		t.Errorf("got args %d, frame %d; want 8, 16", s.Func.Args, s.Func.Frame)
+	}
+	if len(s.Reloc) != 1 || s.Reloc[0].Name != "runtime.printlock" || s.Reloc[0].Type != objabi.R_CALL {
+		t.Errorf("got relocations %+v", s.Reloc)
+	}
+	if len(am.textSyms) != 1 || am.textSyms[0] != s {
+		t.Error("injected symbol is not registered as a text symbol")
+	}
+	if len(am.NonPkgSymDefs) != 1 || !bytes.Equal(am.NonPkgSymDefs[0].Data, []byte("hi")) {
+		t.Errorf("non-package definitions changed: %+v", am.NonPkgSymDefs)
+	}
+}
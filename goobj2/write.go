@@ -164,6 +164,9 @@ func (pkg *Package) Write(path string) (err error) {
 		// Pcdata
 		ctxt.ObjHeader.Offsets[goobj2.BlkPcdata] = w.Offset()
 		for _, ts := range ctxt.textSyms {
+			if ts.Func == nil {
+				continue
+			}
 			w.Bytes(ts.Func.PCSP)
 			w.Bytes(ts.Func.PCFile)
 			w.Bytes(ts.Func.PCLine)
@@ -333,6 +336,9 @@ func (w *writer) Aux(s *Sym) {
 			w.aux1(goobj2.AuxDwarfLines, s.Func.DwarfDebugLines.SymRef)
 		}
 	}
+	for _, a := range s.Aux {
+		w.aux1(a.Type, a.Sym.SymRef)
+	}
 }
 
 // return the number of aux symbols s have.
@@ -357,7 +363,7 @@ func nAuxSym(s *Sym) int {
 			n++
 		}
 	}
-	return n
+	return n + len(s.Aux)
 }
 
 // generate symbols for FuncInfo.
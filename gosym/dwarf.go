@@ -0,0 +1,176 @@
+package gosym
+
+import (
+	"debug/dwarf"
+	"errors"
+	"io"
+	"sort"
+)
+
+// A dwarfLine is a row of a DWARF line table. The row covers the program
+// counters from pc up to the pc of the next row, unless it ends a
+// sequence.
+type dwarfLine struct {
+	pc   uint64
+	file string
+	line int
+	end  bool
+}
+
+// NewDWARFTable returns a Table built from the DWARF debugging information
+// d, as returned by the DWARF methods of the elf, macho and pe packages,
+// for binaries whose pclntab is missing, damaged or obfuscated. Its Funcs
+// are the subprograms of d that have code, named after their abstract
+// origin when they are out-of-line copies of inlined functions, and
+// PCToLine and LineToPC use the line tables of d, which attribute the code
+// of inlined calls to the lines of the inlined function.
+//
+// The Funcs of such a table have no LineTable, Params or Locals, and Syms
+// holds a text symbol for each of them.
+func NewDWARFTable(d *dwarf.Data) (*Table, error) {
+	var t Table
+	type pending struct {
+		fn     int
+		origin dwarf.Offset
+	}
+	names := make(map[dwarf.Offset]string)
+	var origins []pending
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			break
+		}
+		switch e.Tag {
+		case dwarf.TagCompileUnit:
+			lines, err := dwarfLines(d, e)
+			if err != nil {
+				return nil, err
+			}
+			t.dwarfLines = append(t.dwarfLines, lines...)
+			continue
+		case dwarf.TagSubprogram:
+			name, _ := e.Val(dwarf.AttrName).(string)
+			if name != "" {
+				names[e.Offset] = name
+			}
+			ranges, err := d.Ranges(e)
+			if err != nil {
+				return nil, err
+			}
+			if len(ranges) == 0 {
+				break
+			}
+			fn := Func{Entry: ranges[0][0], End: ranges[0][1]}
+			for _, rg := range ranges[1:] {
+				if rg[0] < fn.Entry {
+					fn.Entry = rg[0]
+				}
+				if rg[1] > fn.End {
+					fn.End = rg[1]
+				}
+			}
+			fn.Sym = &Sym{Value: fn.Entry, Type: 'T', Name: name}
+			if origin, ok := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset); ok && name == "" {
+				origins = append(origins, pending{len(t.Funcs), origin})
+			}
+			t.Funcs = append(t.Funcs, fn)
+		}
+		if e.Children {
+			r.SkipChildren()
+		}
+	}
+	if len(t.Funcs) == 0 && len(t.dwarfLines) == 0 {
+		return nil, errors.New("no functions or line tables in DWARF")
+	}
+	for _, p := range origins {
+		t.Funcs[p.fn].Sym.Name = names[p.origin]
+	}
+
+	sort.SliceStable(t.Funcs, func(i, j int) bool { return t.Funcs[i].Entry < t.Funcs[j].Entry })
+	funcs := t.Funcs[:0]
+	for _, fn := range t.Funcs {
+		if n := len(funcs); n > 0 && funcs[n-1].Entry == fn.Entry {
+			continue
+		}
+		funcs = append(funcs, fn)
+	}
+	t.Funcs = funcs
+	// Rows that end a sequence go before rows starting another sequence
+	// at the same address.
+	sort.SliceStable(t.dwarfLines, func(i, j int) bool {
+		a, b := &t.dwarfLines[i], &t.dwarfLines[j]
+		if a.pc != b.pc {
+			return a.pc < b.pc
+		}
+		return a.end && !b.end
+	})
+
+	if t.dwarfLines == nil {
+		// Keep PCToLine from using the Go 1.1 tables.
+		t.dwarfLines = []dwarfLine{}
+	}
+
+	obj := &Obj{Funcs: t.Funcs}
+	t.Files = make(map[string]*Obj)
+	for _, l := range t.dwarfLines {
+		if !l.end {
+			t.Files[l.file] = obj
+		}
+	}
+	t.Syms = make([]Sym, len(t.Funcs))
+	for i := range t.Funcs {
+		fn := &t.Funcs[i]
+		t.Syms[i] = *fn.Sym
+		fn.Sym = &t.Syms[i]
+		fn.Obj = obj
+	}
+	return &t, nil
+}
+
+// dwarfLines returns the rows of the line table of the compilation unit
+// cu.
+func dwarfLines(d *dwarf.Data, cu *dwarf.Entry) ([]dwarfLine, error) {
+	lr, err := d.LineReader(cu)
+	if err != nil || lr == nil {
+		return nil, err
+	}
+	var lines []dwarfLine
+	var le dwarf.LineEntry
+	for {
+		if err := lr.Next(&le); err == io.EOF {
+			return lines, nil
+		} else if err != nil {
+			return nil, err
+		}
+		l := dwarfLine{pc: le.Address, line: le.Line, end: le.EndSequence}
+		if le.File != nil {
+			l.file = le.File.Name
+		}
+		lines = append(lines, l)
+	}
+}
+
+// dwarfPCToLine returns the file and line of the row covering pc, or ""
+// and 0.
+func (t *Table) dwarfPCToLine(pc uint64) (string, int) {
+	i := sort.Search(len(t.dwarfLines), func(i int) bool { return t.dwarfLines[i].pc > pc }) - 1
+	if i < 0 || t.dwarfLines[i].end {
+		return "", 0
+	}
+	return t.dwarfLines[i].file, t.dwarfLines[i].line
+}
+
+// dwarfLineToPC returns the lowest program counter of the rows for line
+// in file, or 0.
+func (t *Table) dwarfLineToPC(file string, line int) uint64 {
+	for _, l := range t.dwarfLines {
+		if !l.end && l.line == line && l.file == file {
+			return l.pc
+		}
+	}
+	return 0
+}
@@ -0,0 +1,133 @@
+package gosym
+
+import (
+	"debug/elf"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+const dwarfTestProgram = `package main
+
+import "os"
+
+//go:noinline
+func Map[T any](xs []T, f func(T) T) []T {
+	for i := range xs {
+		xs[i] = f(xs[i])
+	}
+	return xs
+}
+
+func add(a, b int) int { return a + b }
+
+var sink = add
+
+func main() {
+	xs := Map([]int{1, 2}, func(x int) int { return add(x, 1) })
+	Map([]string{"a"}, func(s string) string { return s + "!" })
+	os.Exit(sink(xs[0], xs[1]) - 5)
+}
+`
+
+// testTables builds dwarfTestProgram and returns the Tables built from its
+// pclntab and from its DWARF.
+func testTables(t *testing.T) (pcln, dw *Table) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skipping on non-ELF system %s", runtime.GOOS)
+	}
+	gotool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"go.mod":  "module dwarftest\n\ngo 1.18\n",
+		"main.go": dwarfTestProgram,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(gotool, "build", "-o", "prog")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("building test program: %v\n%s", err, out)
+	}
+
+	f, err := elf.Open(filepath.Join(dir, "prog"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s, text := f.Section(".gopclntab"), f.Section(".text")
+	if s == nil || text == nil {
+		t.Fatal("test program has no .gopclntab")
+	}
+	data, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcln, err = NewTable(nil, NewLineTable(data, text.Addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := f.DWARF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw, err = NewDWARFTable(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pcln, dw
+}
+
+func TestDWARFTable(t *testing.T) {
+	pcln, dw := testTables(t)
+
+	// main.add is inlined into main.main, so its out-of-line copy is
+	// named after its abstract origin.
+	for _, name := range []string{"main.main", "main.add", "main.Map[go.shape.int]", "main.Map[go.shape.string]"} {
+		fn, want := dw.LookupFunc(name), pcln.LookupFunc(name)
+		if fn == nil || want == nil {
+			t.Errorf("LookupFunc(%s) = %v from DWARF, %v from pclntab", name, fn, want)
+			continue
+		}
+		// The pclntab extends functions over the padding that follows them.
+		if fn.Entry != want.Entry || fn.End > want.End {
+			t.Errorf("%s is [%#x, %#x), want [%#x, %#x)", name, fn.Entry, fn.End, want.Entry, want.End)
+		}
+		for pc := fn.Entry; pc < fn.End; pc++ {
+			file, line, f := dw.PCToLine(pc)
+			wfile, wline, _ := pcln.PCToLine(pc)
+			if f != fn || file != wfile || line != wline {
+				t.Errorf("PCToLine(%#x) = %s:%d %v, want %s:%d", pc, file, line, f, wfile, wline)
+				break
+			}
+		}
+		// Both instances of main.Map start on the same line.
+		file, line, _ := dw.PCToLine(fn.Entry)
+		pc, f, err := dw.LineToPC(file, line)
+		if gfile, gline, _ := dw.PCToLine(pc); err != nil || f == nil || gfile != file || gline != line {
+			t.Errorf("LineToPC(%s, %d) = %#x, %v, %v", file, line, pc, f, err)
+		}
+	}
+
+	main := dw.LookupFunc("main.main")
+	if main == nil {
+		t.FailNow()
+	}
+	file, _, _ := dw.PCToLine(main.Entry)
+	if _, _, err := dw.LineToPC(file, 1<<20); err == nil {
+		t.Error("LineToPC found a line past the end of the file")
+	}
+	if _, _, err := dw.LineToPC("nosuchfile.go", 1); err == nil {
+		t.Error("LineToPC found a line in a file that is not in the table")
+	}
+	if _, _, fn := dw.PCToLine(0); fn != nil {
+		t.Errorf("PCToLine(0) = %v", fn)
+	}
+}
@@ -0,0 +1,110 @@
+package gosym
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrNoGoMetadata is returned by the GoPclntab, GoBuildInfo and GoBuildID
+// methods of the elf, macho and pe files when the requested Go metadata
+// cannot be found.
+var ErrNoGoMetadata = errors.New("no Go metadata found")
+
+var (
+	buildInfoMagic = []byte("\xff Go buildinf:")
+	buildIDPrefix  = []byte("\xff Go build ID: \"")
+	buildIDSuffix  = []byte("\"\n \xff")
+)
+
+// FindPclntab returns the index in data of the first plausible pclntab
+// header, or -1. It is how the file packages find the pclntab of a
+// binary whose section names have been stripped or rewritten.
+func FindPclntab(data []byte, bo binary.ByteOrder) int {
+	for i := 0; i+8 <= len(data); i += 4 {
+		switch bo.Uint32(data[i:]) {
+		case go12magic, go116magic, go118magic, go120magic:
+			if pclntabHeaderOK(data[i:], bo) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// pclntabHeaderOK reports whether b starts with a pclntab header whose
+// counts and offsets fit inside b.
+func pclntabHeaderOK(b []byte, bo binary.ByteOrder) bool {
+	if b[4] != 0 || b[5] != 0 {
+		return false
+	}
+	switch b[6] { // instruction size quantum
+	case 1, 2, 4:
+	default:
+		return false
+	}
+	ptrSize := int(b[7])
+	if ptrSize != 4 && ptrSize != 8 {
+		return false
+	}
+	word := func(i int) (uint64, bool) {
+		off := 8 + i*ptrSize
+		if off+ptrSize > len(b) {
+			return 0, false
+		}
+		if ptrSize == 4 {
+			return uint64(bo.Uint32(b[off:])), true
+		}
+		return bo.Uint64(b[off:]), true
+	}
+
+	var offsets []int
+	switch bo.Uint32(b) {
+	case go12magic:
+		// nfunctab, then nfunctab+1 (pc, offset) pairs.
+		n, ok := word(0)
+		return ok && n < uint64(len(b)) && 8+(2*n+1)*uint64(ptrSize) <= uint64(len(b))
+	case go116magic:
+		// nfunc, nfiles, then the offsets of the sub-tables.
+		offsets = []int{2, 3, 4, 5, 6}
+	default:
+		// nfunc, nfiles, textStart, then the offsets of the sub-tables.
+		offsets = []int{3, 4, 5, 6, 7}
+	}
+	for _, i := range offsets {
+		off, ok := word(i)
+		if !ok || off == 0 || off > uint64(len(b)) {
+			return false
+		}
+	}
+	return true
+}
+
+// FindBuildInfo returns the index in data of the "\xff Go buildinf:"
+// header of the Go build information blob, or -1. The blob is 16-byte
+// aligned, so data should start at an aligned address.
+func FindBuildInfo(data []byte) int {
+	for i := 0; i+len(buildInfoMagic) <= len(data); i += 16 {
+		if bytes.Equal(data[i:i+len(buildInfoMagic)], buildInfoMagic) {
+			return i
+		}
+	}
+	return -1
+}
+
+// FindBuildID returns the Go build ID that the linker writes at the start
+// of the text of a binary, looking in the first 4 KB of data.
+func FindBuildID(data []byte) (string, bool) {
+	if len(data) > 4096 {
+		data = data[:4096]
+	}
+	i := bytes.Index(data, buildIDPrefix)
+	if i < 0 {
+		return "", false
+	}
+	rest := data[i+len(buildIDPrefix):]
+	if j := bytes.Index(rest, buildIDSuffix); j >= 0 {
+		return string(rest[:j]), true
+	}
+	return "", false
+}
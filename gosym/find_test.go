@@ -0,0 +1,40 @@
+package gosym
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestFindPclntab(t *testing.T) {
+	// A magic number without a plausible header is skipped.
+	data := make([]byte, 16)
+	binary.LittleEndian.PutUint32(data[4:], go120magic)
+	data = append(data, fakePclntab(go12magic, 8, []string{"main.main", "main.f", "main.f"})...)
+	if i := FindPclntab(data, binary.LittleEndian); i != 16 {
+		t.Errorf("FindPclntab() = %d, want 16", i)
+	}
+	if i := FindPclntab(data[:16], binary.LittleEndian); i != -1 {
+		t.Errorf("FindPclntab() = %d without a pclntab", i)
+	}
+}
+
+func TestFindBuildInfo(t *testing.T) {
+	data := append(make([]byte, 32), "\xff Go buildinf:\x08\x02"...)
+	if i := FindBuildInfo(data); i != 32 {
+		t.Errorf("FindBuildInfo() = %d, want 32", i)
+	}
+	// The blob is 16-byte aligned.
+	if i := FindBuildInfo(data[1:]); i != -1 {
+		t.Errorf("FindBuildInfo() = %d for an unaligned blob", i)
+	}
+}
+
+func TestFindBuildID(t *testing.T) {
+	data := append(make([]byte, 16), "\xff Go build ID: \"abc/def\"\n \xff"...)
+	if id, ok := FindBuildID(data); !ok || id != "abc/def" {
+		t.Errorf("FindBuildID() = %q, %v", id, ok)
+	}
+	if id, ok := FindBuildID(append(make([]byte, 4096), data...)); ok {
+		t.Errorf("FindBuildID() = %q past the first 4 KB", id)
+	}
+}
@@ -0,0 +1,164 @@
+package gosym
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// funcNameLayout describes where the functions of a pclntab keep their
+// names.
+type funcNameLayout struct {
+	binary  binary.ByteOrder
+	ptrsize int
+	nfunc   int
+	functab int  // offset of the function table
+	entry32 bool // function table entries are two uint32s, not two uintptrs
+	funcs   int  // base of the offsets to the _func structures
+	nameoff int  // offset of the name offset in a _func structure
+	names   int  // base of the name offsets
+}
+
+// readFuncNameLayout decodes the pclntab header in data.
+func readFuncNameLayout(data []byte) (*funcNameLayout, error) {
+	if len(data) < 16 || data[4] != 0 || data[5] != 0 || (data[7] != 4 && data[7] != 8) {
+		return nil, errors.New("invalid pclntab header")
+	}
+	l := &funcNameLayout{ptrsize: int(data[7])}
+	var magic uint32
+	for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch m := bo.Uint32(data); m {
+		case go12magic, go116magic, go118magic, go120magic:
+			l.binary, magic = bo, m
+		}
+	}
+	if l.binary == nil {
+		return nil, errors.New("unknown pclntab magic")
+	}
+	word := func(i int) (int, error) {
+		off := 8 + i*l.ptrsize
+		if off+l.ptrsize > len(data) {
+			return 0, errors.New("truncated pclntab header")
+		}
+		var v uint64
+		if l.ptrsize == 4 {
+			v = uint64(l.binary.Uint32(data[off:]))
+		} else {
+			v = l.binary.Uint64(data[off:])
+		}
+		if v > uint64(len(data)) && i > 0 {
+			return 0, fmt.Errorf("pclntab header field %d is out of range", i)
+		}
+		return int(v), nil
+	}
+
+	var err error
+	if l.nfunc, err = word(0); err != nil {
+		return nil, err
+	}
+	switch magic {
+	case go12magic:
+		l.functab = 8 + l.ptrsize
+		l.nameoff = l.ptrsize
+	case go116magic:
+		if l.names, err = word(2); err != nil {
+			return nil, err
+		}
+		if l.functab, err = word(6); err != nil {
+			return nil, err
+		}
+		l.funcs = l.functab
+		l.nameoff = l.ptrsize
+	default:
+		if l.names, err = word(3); err != nil {
+			return nil, err
+		}
+		if l.functab, err = word(7); err != nil {
+			return nil, err
+		}
+		l.funcs = l.functab
+		l.entry32 = true
+		l.nameoff = 4
+	}
+	return l, nil
+}
+
+// funcNameOffsets returns the offsets in data of the names of all
+// functions, in function table order. Functions that share a name share
+// its offset.
+func (l *funcNameLayout) funcNameOffsets(data []byte) ([]int, error) {
+	entsize := 2 * l.ptrsize
+	if l.entry32 {
+		entsize = 8
+	}
+	if l.nfunc < 0 || l.functab+l.nfunc*entsize > len(data) {
+		return nil, errors.New("pclntab function table is out of range")
+	}
+	offs := make([]int, 0, l.nfunc)
+	for i := 0; i < l.nfunc; i++ {
+		e := l.functab + i*entsize
+		var funcoff uint64
+		switch {
+		case l.entry32:
+			funcoff = uint64(l.binary.Uint32(data[e+4:]))
+		case l.ptrsize == 4:
+			funcoff = uint64(l.binary.Uint32(data[e+4:]))
+		default:
+			funcoff = l.binary.Uint64(data[e+8:])
+		}
+		p := uint64(l.funcs) + funcoff + uint64(l.nameoff)
+		if p+4 > uint64(len(data)) {
+			return nil, fmt.Errorf("function %d is outside of the pclntab", i)
+		}
+		name := uint64(l.names) + uint64(l.binary.Uint32(data[p:]))
+		if name >= uint64(len(data)) {
+			return nil, fmt.Errorf("name of function %d is outside of the pclntab", i)
+		}
+		offs = append(offs, int(name))
+	}
+	return offs, nil
+}
+
+// ApplyRenameMap returns a copy of the pclntab in t.Data in which every
+// function whose name is a key of renames is renamed to the matching
+// value. The table keeps its size and layout, so the result can be
+// written back over the original: names are rewritten in place, padded
+// with NUL bytes when the new name is shorter and truncated to the length
+// of the old name when it is longer.
+//
+// The pclntab formats of Go 1.2, 1.16, 1.18 and 1.20 are supported.
+func (t *LineTable) ApplyRenameMap(renames map[string]string) ([]byte, error) {
+	data := append([]byte(nil), t.Data...)
+	l, err := readFuncNameLayout(data)
+	if err != nil {
+		return nil, err
+	}
+	offs, err := l.funcNameOffsets(data)
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[int]bool)
+	for _, off := range offs {
+		if done[off] {
+			continue
+		}
+		done[off] = true
+		n := bytes.IndexByte(data[off:], 0)
+		if n < 0 {
+			return nil, fmt.Errorf("function name at %#x is not terminated", off)
+		}
+		name, ok := renames[string(data[off:off+n])]
+		if !ok {
+			continue
+		}
+		if len(name) > n {
+			name = name[:n]
+		}
+		copy(data[off:], name)
+		for i := off + len(name); i < off+n; i++ {
+			data[i] = 0
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,173 @@
+package gosym
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// funcNames returns the names of the functions in the pclntab data.
+func funcNames(t *testing.T, data []byte) []string {
+	l, err := readFuncNameLayout(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offs, err := l.funcNameOffsets(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, off := range offs {
+		n := 0
+		for data[off+n] != 0 {
+			n++
+		}
+		names = append(names, string(data[off:off+n]))
+	}
+	return names
+}
+
+// fakePclntab builds a pclntab with the given magic and pointer size that
+// holds just enough for funcNameOffsets: functions named names, the last
+// two sharing a name.
+func fakePclntab(magic uint32, ptrsize int, names []string) []byte {
+	bo := binary.LittleEndian
+	put := func(b []byte, v uint64) {
+		if ptrsize == 4 {
+			bo.PutUint32(b, uint32(v))
+		} else {
+			bo.PutUint64(b, v)
+		}
+	}
+	var nametab []byte
+	var nameoffs []int
+	for i, name := range names {
+		if i == len(names)-1 {
+			nameoffs = append(nameoffs, nameoffs[i-1])
+			continue
+		}
+		nameoffs = append(nameoffs, len(nametab))
+		nametab = append(append(nametab, name...), 0)
+	}
+
+	hdr := make([]byte, 8+8*ptrsize)
+	bo.PutUint32(hdr, magic)
+	hdr[6], hdr[7] = 1, byte(ptrsize)
+	put(hdr[8:], uint64(len(names)))
+	functab := len(hdr)
+	if magic == go12magic {
+		functab = 8 + ptrsize
+		hdr = hdr[:functab]
+	}
+	entsize := 2 * ptrsize
+	if magic == go118magic || magic == go120magic {
+		entsize = 8
+	}
+	funcs := functab + len(names)*entsize
+	namesStart := funcs + len(names)*(ptrsize+4)
+	data := make([]byte, namesStart)
+	copy(data, hdr)
+	data = append(data, nametab...)
+	nameBase := 0
+	switch magic {
+	case go116magic:
+		put(data[8+2*ptrsize:], uint64(namesStart))
+		put(data[8+6*ptrsize:], uint64(functab))
+		nameBase = namesStart
+	case go118magic, go120magic:
+		put(data[8+3*ptrsize:], uint64(namesStart))
+		put(data[8+7*ptrsize:], uint64(functab))
+		nameBase = namesStart
+	}
+	for i := range names {
+		e := functab + i*entsize
+		f := funcs + i*(ptrsize+4)
+		funcoff := uint64(f)
+		if magic != go12magic {
+			funcoff -= uint64(functab)
+		}
+		nameoff := uint64(namesStart + nameoffs[i] - nameBase)
+		if entsize == 8 {
+			bo.PutUint32(data[e+4:], uint32(funcoff))
+			bo.PutUint32(data[f+4:], uint32(nameoff))
+		} else {
+			put(data[e+ptrsize:], funcoff)
+			bo.PutUint32(data[f+ptrsize:], uint32(nameoff))
+		}
+	}
+	return data
+}
+
+func TestApplyRenameMapFormats(t *testing.T) {
+	names := []string{"main.main", "main.helper", "main.shared", "main.shared"}
+	renames := map[string]string{
+		"main.main":   "a",
+		"main.helper": "main.a_much_longer_name",
+		"main.shared": "b",
+	}
+	want := []string{"a", "main.a_much", "b", "b"}
+	for _, magic := range []uint32{go12magic, go116magic, go118magic, go120magic} {
+		for _, ptrsize := range []int{4, 8} {
+			data := fakePclntab(magic, ptrsize, names)
+			if got := funcNames(t, data); strings.Join(got, ",") != strings.Join(names, ",") {
+				t.Fatalf("%#x/%d: fake table has names %q", magic, ptrsize, got)
+			}
+			out, err := NewLineTable(data, 0).ApplyRenameMap(renames)
+			if err != nil {
+				t.Fatalf("%#x/%d: %v", magic, ptrsize, err)
+			}
+			if len(out) != len(data) {
+				t.Errorf("%#x/%d: table size changed from %d to %d", magic, ptrsize, len(data), len(out))
+			}
+			if got := funcNames(t, out); strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("%#x/%d: got names %q, want %q", magic, ptrsize, got, want)
+			}
+		}
+	}
+
+	if _, err := NewLineTable([]byte("not a pclntab at all"), 0).ApplyRenameMap(renames); err == nil {
+		t.Error("ApplyRenameMap accepted data without a pclntab header")
+	}
+}
+
+func TestApplyRenameMap(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skipping on non-ELF system %s", runtime.GOOS)
+	}
+	f, err := elf.Open(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s := f.Section(".gopclntab")
+	if s == nil {
+		t.Skip("test binary has no .gopclntab")
+	}
+	data, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := funcNames(t, data)
+
+	const old = "github.com/Binject/debug/gosym.TestApplyRenameMap"
+	out, err := NewLineTable(data, 0).ApplyRenameMap(map[string]string{old: "obfuscated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := funcNames(t, out)
+	renamed := 0
+	for i := range before {
+		switch {
+		case before[i] == old && after[i] == "obfuscated":
+			renamed++
+		case before[i] != after[i]:
+			t.Errorf("%s was renamed to %s", before[i], after[i])
+		}
+	}
+	if renamed != 1 {
+		t.Errorf("renamed %d functions, want 1", renamed)
+	}
+}
@@ -116,7 +116,8 @@ type Table struct {
 	Files map[string]*Obj // nil for Go 1.2 and later binaries
 	Objs  []Obj           // nil for Go 1.2 and later binaries
 
-	go12line *LineTable // Go 1.2 line number table
+	go12line   *LineTable  // Go 1.2 line number table
+	dwarfLines []dwarfLine // DWARF line table rows, sorted by pc
 }
 
 type sym struct {
@@ -498,10 +499,13 @@ func (t *Table) PCToLine(pc uint64) (file string, line int, fn *Func) {
 	if fn = t.PCToFunc(pc); fn == nil {
 		return
 	}
-	if t.go12line != nil {
+	switch {
+	case t.go12line != nil:
 		file = t.go12line.go12PCToFile(pc)
 		line = t.go12line.go12PCToLine(pc)
-	} else {
+	case t.dwarfLines != nil:
+		file, line = t.dwarfPCToLine(pc)
+	default:
 		file, line = fn.Obj.lineFromAline(fn.LineTable.PCToLine(pc))
 	}
 	return
@@ -523,6 +527,13 @@ func (t *Table) LineToPC(file string, line int) (pc uint64, fn *Func, err error)
 		}
 		return pc, t.PCToFunc(pc), nil
 	}
+	if t.dwarfLines != nil {
+		pc := t.dwarfLineToPC(file, line)
+		if pc == 0 {
+			return 0, nil, &UnknownLineError{file, line}
+		}
+		return pc, t.PCToFunc(pc), nil
+	}
 
 	abs, err := obj.alineFromLine(file, line)
 	if err != nil {
@@ -5,7 +5,10 @@
 package gosym
 
 import (
+	"debug/elf"
 	"fmt"
+	"os"
+	"runtime"
 	"testing"
 )
 
@@ -41,3 +44,76 @@ func TestRemotePackage(t *testing.T) {
 	assertString(t, fmt.Sprintf("receiver of %q", s1.Name), s1.ReceiverName(), "(*FlagSet)")
 	assertString(t, fmt.Sprintf("receiver of %q", s2.Name), s2.ReceiverName(), "")
 }
+
+func TestPCLineVersions(t *testing.T) {
+	// The fake tables lack the file table of the Go 1.2 format.
+	names := []string{"main.main", "main.helper", "main.shared", "main.shared"}
+	for _, c := range []struct {
+		magic uint32
+		ver   version
+	}{
+		{go116magic, ver116},
+		{go118magic, ver118},
+		{go120magic, ver120},
+	} {
+		for _, ptrsize := range []int{4, 8} {
+			pcln := NewLineTable(fakePclntab(c.magic, ptrsize, names), 0)
+			if !pcln.isGo12() || pcln.version != c.ver {
+				t.Errorf("%#x/%d: parsed as version %d, want %d", c.magic, ptrsize, pcln.version, c.ver)
+				continue
+			}
+			if n := pcln.funcTab().Count(); n != len(names) {
+				t.Errorf("%#x/%d: %d functions, want %d", c.magic, ptrsize, n, len(names))
+			}
+		}
+	}
+	if pcln := NewLineTable([]byte("not a pclntab at all"), 0); pcln.isGo12() {
+		t.Error("data without a pclntab header parsed as a Go 1.2 table")
+	}
+}
+
+func TestPCLineSelf(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skipping on non-ELF system %s", runtime.GOOS)
+	}
+	f, err := elf.Open(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.Type != elf.ET_EXEC {
+		t.Skip("test binary is position independent")
+	}
+	s := f.Section(".gopclntab")
+	if s == nil {
+		t.Skip("test binary has no .gopclntab")
+	}
+	data, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab, err := NewTable(nil, NewLineTable(data, f.Section(".text").Addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, file, line, _ := runtime.Caller(0)
+	const name = "github.com/Binject/debug/gosym.TestPCLineSelf"
+	gotFile, gotLine, fn := tab.PCToLine(uint64(pc))
+	if fn == nil || fn.Name != name || gotFile != file || gotLine != line {
+		t.Fatalf("PCToLine(%#x) = %s:%d (%v), want %s:%d (%s)", pc, gotFile, gotLine, fn, file, line, name)
+	}
+	if _, ok := tab.Files[file]; !ok {
+		t.Errorf("%s is not in the file list", file)
+	}
+	if sym := tab.LookupFunc(name); sym == nil || sym.Entry != fn.Entry {
+		t.Errorf("LookupFunc(%q) = %v, want the function at %#x", name, sym, fn.Entry)
+	}
+	pc2, fn2, err := tab.LineToPC(file, line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fn2 != fn || pc2 > uint64(pc) {
+		t.Errorf("LineToPC(%s, %d) = %#x in %s, want a PC up to %#x in %s", file, line, pc2, fn2.Name, pc, name)
+	}
+}
@@ -0,0 +1,93 @@
+// Package identity copies the metadata that identifies a build, such as
+// timestamps, UUIDs, build IDs and version information, from a donor
+// binary onto another binary of the same format.
+//
+// It dispatches to the CloneIdentity methods of the elf, macho and pe
+// packages, which document what is copied for each format.
+package identity
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/Binject/debug/elf"
+	"github.com/Binject/debug/macho"
+	"github.com/Binject/debug/pe"
+)
+
+// Clone copies the identity of src onto dst. Both must be files of the
+// same format: *elf.File, *macho.File or *pe.File.
+func Clone(dst, src interface{}) error {
+	switch d := dst.(type) {
+	case *elf.File:
+		if s, ok := src.(*elf.File); ok {
+			return d.CloneIdentity(s)
+		}
+	case *macho.File:
+		if s, ok := src.(*macho.File); ok {
+			return d.CloneIdentity(s)
+		}
+	case *pe.File:
+		if s, ok := src.(*pe.File); ok {
+			return d.CloneIdentity(s)
+		}
+	default:
+		return fmt.Errorf("unsupported file type %T", dst)
+	}
+	return fmt.Errorf("cannot clone the identity of a %T onto a %T", src, dst)
+}
+
+// A writer is a parsed file that can be written back out.
+type writer interface {
+	WriteFile(destFile string) error
+}
+
+// CloneFile writes a copy of the binary at dstPath to outPath, with the
+// identity of the binary at srcPath. The format of the binaries is
+// detected from their contents.
+func CloneFile(dstPath, srcPath, outPath string) error {
+	dst, err := open(dstPath)
+	if err != nil {
+		return err
+	}
+	src, err := open(srcPath)
+	if err != nil {
+		return err
+	}
+	if err := Clone(dst, src); err != nil {
+		return err
+	}
+	return dst.(writer).WriteFile(outPath)
+}
+
+// open reads the named file into memory and parses it with the package
+// matching its magic number.
+func open(name string) (interface{}, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(data)
+	switch {
+	case bytes.HasPrefix(data, []byte(elf.ELFMAG)):
+		return elf.NewFile(r)
+	case bytes.HasPrefix(data, []byte("MZ")):
+		return pe.NewFile(r)
+	case len(data) >= 4 && isMachO(data[:4]):
+		return macho.NewFile(r)
+	}
+	return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("unrecognized binary format")}
+}
+
+func isMachO(magic []byte) bool {
+	for _, m := range []uint32{binary.LittleEndian.Uint32(magic), binary.BigEndian.Uint32(magic)} {
+		if m == macho.Magic32 || m == macho.Magic64 {
+			return true
+		}
+	}
+	return false
+}
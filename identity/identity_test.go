@@ -0,0 +1,79 @@
+package identity
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/Binject/debug/elf"
+	"github.com/Binject/debug/macho"
+	"github.com/Binject/debug/pe"
+)
+
+func TestCloneFile(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+
+	if err := CloneFile("../pe/testdata/gcc-386-mingw-exec", "../pe/testdata/gcc-amd64-mingw-exec", out); err != nil {
+		t.Fatal(err)
+	}
+	f, err := pe.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := pe.Open("../pe/testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.TimeDateStamp != src.TimeDateStamp {
+		t.Errorf("TimeDateStamp = %#x, want %#x", f.TimeDateStamp, src.TimeDateStamp)
+	}
+	f.Close()
+	src.Close()
+
+	if err := CloneFile("../macho/testdata/gcc-amd64-darwin-exec", "../macho/testdata/clang-amd64-darwin-exec-with-rpath", out); err != nil {
+		t.Fatal(err)
+	}
+	m, err := macho.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Close()
+
+	if err := CloneFile("../elf/testdata/gcc-amd64-linux-exec", "../elf/testdata/gcc-386-freebsd-exec", out); err != nil {
+		t.Fatal(err)
+	}
+	e, err := elf.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	comment, err := e.Section(".comment").Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(comment, []byte("FreeBSD")) {
+		t.Errorf(".comment = %q, want the one of the FreeBSD donor", comment)
+	}
+}
+
+func TestCloneMismatch(t *testing.T) {
+	e, err := elf.Open("../elf/testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	p, err := pe.Open("../pe/testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := Clone(e, p); err == nil {
+		t.Error("Clone accepted files of different formats")
+	}
+	if err := Clone(e, e); err != nil {
+		t.Error(err)
+	}
+	if err := CloneFile("identity.go", "identity.go", filepath.Join(t.TempDir(), "out")); err == nil {
+		t.Error("CloneFile accepted a file that is not a binary")
+	}
+}
@@ -0,0 +1,88 @@
+// Package diff holds the header field and byte range comparisons shared
+// by the Diff functions of the elf, pe and macho packages.
+package diff
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A FieldChange is a header field whose value differs between the two
+// files compared.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   uint64 `json:"old"`
+	New   uint64 `json:"new"`
+}
+
+func (c FieldChange) String() string {
+	return fmt.Sprintf("%s %#x -> %#x", c.Field, c.Old, c.New)
+}
+
+// A ByteRange is a run of bytes that differs. Off is the offset of the
+// run in both the old and the new bytes; a range that runs past the end
+// of one of them holds only the bytes it has.
+type ByteRange struct {
+	Off uint64 `json:"off"`
+	Old []byte `json:"old"`
+	New []byte `json:"new"`
+}
+
+// Bytes returns the ranges in which b differs from a. Runs of differences
+// closer than 8 bytes are merged, and bytes that only one of them has end
+// the last range, which is the only one whose Old and New lengths can
+// differ.
+func Bytes(a, b []byte) []ByteRange {
+	const gap = 8
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	var ranges []ByteRange
+	for i := 0; i < n; i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		j := i + 1
+		for same := 0; j < n && same < gap; j++ {
+			if a[j] == b[j] {
+				same++
+			} else {
+				same = 0
+			}
+		}
+		for j > i && a[j-1] == b[j-1] {
+			j--
+		}
+		ranges = append(ranges, ByteRange{Off: uint64(i), Old: a[i:j], New: b[i:j]})
+		i = j
+	}
+	if len(a) != len(b) {
+		start := n
+		if k := len(ranges) - 1; k >= 0 && n-int(ranges[k].Off)-len(ranges[k].Old) < gap {
+			start = int(ranges[k].Off)
+			ranges = ranges[:k]
+		}
+		ranges = append(ranges, ByteRange{Off: uint64(start), Old: a[start:], New: b[start:]})
+	}
+	return ranges
+}
+
+// Fields returns the unsigned integer fields of the structs old and new
+// point to, which are of the same type, whose values differ, with their
+// names prefixed by prefix.
+func Fields(prefix string, old, new interface{}) []FieldChange {
+	var changes []FieldChange
+	ov, nv := reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem()
+	for i := 0; i < ov.NumField(); i++ {
+		switch ov.Field(i).Kind() {
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			continue
+		}
+		if o, n := ov.Field(i).Uint(), nv.Field(i).Uint(); o != n {
+			changes = append(changes, FieldChange{prefix + ov.Type().Field(i).Name, o, n})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,42 @@
+// Package gobuild builds the small Go programs that the tests of the elf,
+// pe and macho packages read their Go metadata from.
+package gobuild
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	goMod  = "module hello\n\ngo 1.15\n"
+	mainGo = "package main\n\nfunc main() { println(\"hello\") }\n"
+)
+
+// Binary builds a hello world program for goos and goarch in a module of
+// its own under a temporary directory of t, and returns the path of the
+// executable. It skips the test if there is no go command.
+func Binary(t *testing.T, goos, goarch string) string {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	dir := t.TempDir()
+	for name, src := range map[string]string{"go.mod": goMod, "main.go": mainGo} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exe := filepath.Join(dir, "hello")
+	if goos == "windows" {
+		exe += ".exe"
+	}
+	cmd := exec.Command("go", "build", "-o", exe, ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch, "CGO_ENABLED=0", "GO111MODULE=on", "GOFLAGS=", "GOWORK=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	return exe
+}
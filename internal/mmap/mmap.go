@@ -0,0 +1,79 @@
+// Package mmap maps files into memory for OpenMapped of the pe package
+// and OpenLazy of the macho package.
+package mmap
+
+import (
+	"io"
+	"os"
+)
+
+// A Mapping is the contents of a file mapped into memory, or read into
+// memory where files cannot be mapped.
+type Mapping struct {
+	data   []byte
+	mapped bool // data must be unmapped, rather than being a heap copy
+}
+
+// Open maps the named file into memory. The mapping is private:
+// modifying its data changes what later reads see, but not the file on
+// disk. Where files cannot be mapped, the file is read into memory once
+// instead.
+func Open(name string) (*Mapping, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	fi, err := fd.Stat()
+	if err != nil {
+		return nil, err
+	}
+	m := new(Mapping)
+	if fi.Size() > 0 {
+		if m.data, err = mapFile(fd, fi.Size()); err == nil {
+			m.mapped = true
+		} else if m.data, err = readFile(fd, fi.Size()); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Data returns the contents of the file, which are only valid until
+// Close.
+func (m *Mapping) Data() []byte {
+	return m.data
+}
+
+// ReadAt reads from the contents of the file, or returns io.EOF once the
+// Mapping is closed.
+func (m *Mapping) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Close unmaps the file.
+func (m *Mapping) Close() error {
+	if !m.mapped || m.data == nil {
+		m.data = nil
+		return nil
+	}
+	err := unmapFile(m.data)
+	m.data = nil
+	return err
+}
+
+// readFile reads the size bytes of fd.
+func readFile(fd *os.File, size int64) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(fd, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,17 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package mmap
+
+import (
+	"errors"
+	"os"
+)
+
+func mapFile(fd *os.File, size int64) ([]byte, error) {
+	return nil, errors.New("memory mapped files are not supported")
+}
+
+func unmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package mmap
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps the size bytes of fd into memory, copy-on-write.
+func mapFile(fd *os.File, size int64) ([]byte, error) {
+	if int64(int(size)) != size {
+		return nil, syscall.EFBIG
+	}
+	return syscall.Mmap(int(fd.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE)
+}
+
+func unmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
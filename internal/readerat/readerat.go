@@ -0,0 +1,74 @@
+// Package readerat measures the io.ReaderAt values that the elf, pe and
+// macho packages read files from, and reads the sizes their headers give
+// without trusting them.
+package readerat
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Size returns the number of bytes r holds: its Size, that of the file it
+// is, or, for other readers, the number of bytes read from it before the
+// first error.
+func Size(r io.ReaderAt) (int64, error) {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size(), nil
+	case *os.File:
+		fi, err := r.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return fi.Size(), nil
+	}
+	return io.Copy(ioutil.Discard, io.NewSectionReader(r, 0, 1<<63-1))
+}
+
+// CachedSize returns Size(r), measuring r only if *size is negative and
+// storing the result in *size for the next calls.
+func CachedSize(r io.ReaderAt, size *int64) (int64, error) {
+	if *size >= 0 {
+		return *size, nil
+	}
+	if r == nil {
+		return 0, errors.New("file was not read from a reader")
+	}
+	n, err := Size(r)
+	if err != nil {
+		return 0, err
+	}
+	*size = n
+	return n, nil
+}
+
+// readChunk is the most ReadData allocates ahead of the data it has read.
+const readChunk = 10 << 20
+
+// ReadData reads n bytes from r. Large reads allocate as the data
+// arrives, so that a size from a corrupt header does not allocate more
+// than the file holds.
+func ReadData(r io.Reader, n uint64) ([]byte, error) {
+	if n < readChunk {
+		dat := make([]byte, n)
+		k, err := io.ReadFull(r, dat)
+		return dat[:k], err
+	}
+	var dat []byte
+	for n > 0 {
+		next := uint64(readChunk)
+		if next > n {
+			next = n
+		}
+		old := len(dat)
+		dat = append(dat, make([]byte, next)...)
+		k, err := io.ReadFull(r, dat[old:])
+		if err != nil {
+			return dat[:old+k], err
+		}
+		n -= next
+	}
+	return dat, nil
+}
@@ -0,0 +1,174 @@
+package macho
+
+import (
+	"bytes"
+	"fmt"
+)
+
+func (f *File) ptrSize() int {
+	if f.Magic == Magic64 {
+		return 8
+	}
+	return 4
+}
+
+// sectionForAddr returns the section with file contents that contains
+// the virtual address addr, or nil.
+func (f *File) sectionForAddr(addr uint64) *Section {
+	for _, s := range f.Sections {
+		if isZerofill(s.Flags) || s.sr == nil {
+			continue
+		}
+		if s.Addr <= addr && addr < s.Addr+s.Size {
+			return s
+		}
+	}
+	return nil
+}
+
+func (f *File) mapped(addr uint64) bool {
+	return f.sectionForAddr(addr) != nil
+}
+
+// readAtAddr fills p with the contents of the file at virtual address addr.
+func (f *File) readAtAddr(p []byte, addr uint64) error {
+	s := f.sectionForAddr(addr)
+	if s == nil || addr+uint64(len(p)) > s.Addr+s.Size {
+		return fmt.Errorf("address range [%#x, %#x) is not inside a section", addr, addr+uint64(len(p)))
+	}
+	_, err := s.ReadAt(p, int64(addr-s.Addr))
+	return err
+}
+
+// VMAddrToOffset returns the file offset of the byte mapped at the
+// virtual address addr, through the segment whose file contents hold it.
+// The zero filled memory past the Filesz of a segment has no offset.
+func (f *File) VMAddrToOffset(addr uint64) (uint64, error) {
+	for _, s := range f.segments() {
+		if s.Filesz != 0 && s.Addr <= addr && addr-s.Addr < s.Filesz {
+			return s.Offset + addr - s.Addr, nil
+		}
+	}
+	return 0, fmt.Errorf("address %#x is not in the file contents of a segment", addr)
+}
+
+// OffsetToVMAddr returns the virtual address at which the byte at file
+// offset off is mapped, through the segment whose file contents hold it.
+func (f *File) OffsetToVMAddr(off uint64) (uint64, error) {
+	for _, s := range f.segments() {
+		if s.Filesz != 0 && s.Offset <= off && off-s.Offset < s.Filesz && off-s.Offset < s.Memsz {
+			return s.Addr + off - s.Offset, nil
+		}
+	}
+	return 0, fmt.Errorf("file offset %#x is not in the file contents of a segment", off)
+}
+
+// WriteAtVMAddr writes data over the section contents mapped at the
+// virtual address addr, which Bytes writes. data may straddle sections
+// that follow each other in memory, but each byte must be in the file
+// contents of a section: the header and load commands, the padding
+// between sections and the data of __LINKEDIT, which Bytes writes from
+// other structures, are an error, and so are zero filled sections.
+// Nothing is written on error.
+func (f *File) WriteAtVMAddr(addr uint64, data []byte) error {
+	type part struct {
+		s       *Section
+		off, n  uint64
+		content []byte
+	}
+	var parts []part
+	for done := uint64(0); done < uint64(len(data)); {
+		at := addr + done
+		s := f.sectionForAddr(at)
+		if s == nil {
+			return fmt.Errorf("address %#x is not in the file contents of a section", at)
+		}
+		off := at - s.Addr
+		n := s.Size - off
+		if rest := uint64(len(data)) - done; n > rest {
+			n = rest
+		}
+		content, err := s.Data()
+		if err != nil {
+			return err
+		}
+		if off+n > uint64(len(content)) {
+			return fmt.Errorf("address %#x is past the end of the contents of section %s,%s", at, s.Seg, s.Name)
+		}
+		parts = append(parts, part{s, off, n, content})
+		done += n
+	}
+	written := uint64(0)
+	for _, p := range parts {
+		copy(p.content[p.off:], data[written:written+p.n])
+		p.s.Replace(bytes.NewReader(p.content), int64(len(p.content)))
+		written += p.n
+	}
+	return nil
+}
+
+// pointerAt reads the pointer stored at virtual address addr.
+//
+// Pointers in files that use chained fixups are stored in an encoded
+// form; rebase entries are decoded to their target address.
+func (f *File) pointerAt(addr uint64) (uint64, error) {
+	var b [8]byte
+	p := b[:f.ptrSize()]
+	if err := f.readAtAddr(p, addr); err != nil {
+		return 0, err
+	}
+	if f.ptrSize() == 4 {
+		return uint64(f.ByteOrder.Uint32(p)), nil
+	}
+	v := f.ByteOrder.Uint64(p)
+	if v == 0 || f.mapped(v) {
+		return v, nil
+	}
+	// An authenticated arm64e rebase, of a threaded chain or of
+	// DYLD_CHAINED_PTR_ARM64E, stores the target as a 32-bit offset from
+	// the start of the image.
+	if v>>62 == 2 {
+		if text := f.Segment("__TEXT"); text != nil && f.mapped(text.Addr+v&(1<<32-1)) {
+			return text.Addr + v&(1<<32-1), nil
+		}
+	}
+	// DYLD_CHAINED_PTR_64 rebase: the target is in the low 36 bits and
+	// the bind bit (63) is clear. DYLD_CHAINED_PTR_64_OFFSET stores the
+	// target as an offset from the start of the image.
+	if v>>63 == 0 {
+		target := v & (1<<36 - 1)
+		if f.mapped(target) {
+			return target, nil
+		}
+		if text := f.Segment("__TEXT"); text != nil && f.mapped(text.Addr+target) {
+			return text.Addr + target, nil
+		}
+	}
+	return v, nil
+}
+
+// cstringAt reads the NUL terminated string at virtual address addr.
+func (f *File) cstringAt(addr uint64) (string, error) {
+	s := f.sectionForAddr(addr)
+	if s == nil {
+		return "", fmt.Errorf("string at %#x is not inside a section", addr)
+	}
+	var str []byte
+	var buf [64]byte
+	off := int64(addr - s.Addr)
+	for off < int64(s.Size) {
+		n := int64(len(buf))
+		if rem := int64(s.Size) - off; rem < n {
+			n = rem
+		}
+		if _, err := s.ReadAt(buf[:n], off); err != nil {
+			return "", err
+		}
+		if i := bytes.IndexByte(buf[:n], 0); i >= 0 {
+			return string(append(str, buf[:i]...)), nil
+		}
+		str = append(str, buf[:n]...)
+		off += n
+	}
+	return string(str), nil
+}
@@ -0,0 +1,85 @@
+package macho
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVMAddrToOffset(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, s := range f.Sections {
+		if isZerofill(s.Flags) {
+			continue
+		}
+		off, err := f.VMAddrToOffset(s.Addr)
+		if err != nil || off != uint64(s.Offset) {
+			t.Errorf("VMAddrToOffset(%#x) = %#x, %v; want the offset of %s, %#x", s.Addr, off, err, s.Name, s.Offset)
+		}
+		if addr, err := f.OffsetToVMAddr(off); err != nil || addr != s.Addr {
+			t.Errorf("OffsetToVMAddr(%#x) = %#x, %v; want %#x", off, addr, err, s.Addr)
+		}
+	}
+	// __PAGEZERO maps no file contents.
+	if off, err := f.VMAddrToOffset(0x1000); err == nil {
+		t.Errorf("VMAddrToOffset(0x1000) = %#x in __PAGEZERO", off)
+	}
+	// The header is mapped at the start of __TEXT.
+	if addr, err := f.OffsetToVMAddr(0); err != nil || addr != f.Segment("__TEXT").Addr {
+		t.Errorf("OffsetToVMAddr(0) = %#x, %v", addr, err)
+	}
+}
+
+func TestWriteAtVMAddr(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// Find two sections that follow each other in memory and in the file.
+	var s, next *Section
+	for i, a := range f.Sections[:len(f.Sections)-1] {
+		b := f.Sections[i+1]
+		if !isZerofill(a.Flags) && !isZerofill(b.Flags) && a.Size >= 2 && b.Size >= 2 &&
+			a.Addr+a.Size == b.Addr && uint64(a.Offset)+a.Size == uint64(b.Offset) {
+			s, next = a, b
+			break
+		}
+	}
+	if s == nil {
+		t.Fatal("no adjacent sections")
+	}
+	patch := []byte{0xde, 0xad, 0xbe, 0xef}
+	if err := f.WriteAtVMAddr(s.Addr+s.Size-2, patch); err != nil {
+		t.Fatal(err)
+	}
+	text := f.Segment("__TEXT")
+	if err := f.WriteAtVMAddr(text.Addr, patch); err == nil {
+		t.Error("WriteAtVMAddr wrote over the header")
+	}
+
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(patch))
+	if err := g.readAtAddr(got[:2], s.Addr+s.Size-2); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.readAtAddr(got[2:], next.Addr); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, patch) {
+		t.Errorf("%s and %s hold % x, want % x", s.Name, next.Name, got, patch)
+	}
+	if hdr := b[:4]; !bytes.Equal(hdr, []byte{0xcf, 0xfa, 0xed, 0xfe}) {
+		t.Errorf("header starts with % x", hdr)
+	}
+}
@@ -0,0 +1,24 @@
+package macho
+
+// sectionDataSize returns how many bytes of s can be read, which a
+// header that claims more than the file holds makes fewer than its size.
+func sectionDataSize(s *Section) uint64 {
+	if s.sr == nil || isZerofill(s.Flags) {
+		return 0
+	}
+	// Bytes [0, n) can be read, and none past hi.
+	var b [1]byte
+	n, hi := int64(0), s.sr.Size()
+	if _, err := s.sr.ReadAt(b[:], hi-1); err == nil {
+		return uint64(hi)
+	}
+	for n < hi {
+		mid := n + (hi-n+1)/2
+		if _, err := s.sr.ReadAt(b[:], mid-1); err == nil {
+			n = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return uint64(n)
+}
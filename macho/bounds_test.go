@@ -0,0 +1,101 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// endlessBinds returns the file name with its binding info overwritten by
+// opcodes that bind a pointer 0xffffffff times.
+func endlessBinds(name string) ([]byte, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	if f.DylinkInfo == nil || f.DylinkInfo.BindingInfoLen < 14 {
+		return nil, fmt.Errorf("%s has too little binding info", name)
+	}
+	copy(b[f.DylinkInfo.BindingInfoOffset:], []byte{
+		bindOpcodeSetDylibOrdinalImm | 1,
+		bindOpcodeSetSymbolTrailingFlagsImm, 'x', 0,
+		bindOpcodeSetSegmentAndOffsetULEB | 2, 0,
+		bindOpcodeDoBindULEBTimesSkippingULEB, 0xff, 0xff, 0xff, 0xff, 0x0f, 0,
+		bindOpcodeDone,
+	})
+	return b, nil
+}
+
+func TestBounds(t *testing.T) {
+	const file = "testdata/gcc-amd64-darwin-exec"
+	want, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer want.Close()
+	orig, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	le := binary.LittleEndian
+	// loadCommand returns the bytes of the first load command of type cmd.
+	loadCommand := func(b []byte, cmd LoadCmd) []byte {
+		off := fileHeaderSize64
+		for i := 0; i < int(want.Ncmd); i++ {
+			if LoadCmd(le.Uint32(b[off:])) == cmd {
+				return b[off:]
+			}
+			off += int(le.Uint32(b[off+4:]))
+		}
+		t.Fatalf("no load command %v", cmd)
+		return nil
+	}
+
+	for _, tt := range []struct {
+		name string
+		edit func(b []byte)
+		want string
+	}{
+		{"ncmds", func(b []byte) { le.PutUint32(b[16:], 0xffffffff) }, "ncmds too large"},
+		{"sizeofcmds", func(b []byte) { le.PutUint32(b[20:], 0xfffffff0) }, "sizeofcmds larger than the file"},
+		{"nsects", func(b []byte) { le.PutUint32(loadCommand(b, LoadCmdSegment64)[64:], 0xffffffff) }, "too many sections"},
+		{"nsyms", func(b []byte) { le.PutUint32(loadCommand(b, LoadCmdSymtab)[12:], 0xffffffff) }, "block larger than the file"},
+		{"strsize", func(b []byte) { le.PutUint32(loadCommand(b, LoadCmdSymtab)[20:], 0xffffffff) }, "block larger than the file"},
+	} {
+		b := append([]byte(nil), orig...)
+		tt.edit(b)
+		_, err := NewFile(bytes.NewReader(b))
+		if _, ok := err.(*FormatError); !ok || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: NewFile returned %v, want a FormatError for %q", tt.name, err, tt.want)
+		}
+	}
+
+	// Repeat counts of the dyld info are bounded by the segment.
+	b, err := endlessBinds("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Binds(); err == nil || !strings.Contains(err.Error(), "repeat count") {
+		t.Errorf("Binds returned %v, want an error for the repeat count", err)
+	}
+	if _, err := f.Bytes(); err != nil {
+		t.Errorf("Bytes: %v", err)
+	}
+
+	// A fat header claiming many images reads only those there are.
+	fat := []byte{0xca, 0xfe, 0xba, 0xbe, 0xff, 0xff, 0xff, 0xff}
+	if _, err := NewFatFile(bytes.NewReader(fat)); err == nil {
+		t.Error("NewFatFile read a fat file without fat_arch headers")
+	}
+}
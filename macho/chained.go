@@ -0,0 +1,105 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Binject/debug/internal/readerat"
+)
+
+// Formats of the import table of chained fixups.
+const (
+	chainedImport         = 1 // dyld_chained_import
+	chainedImportAddend   = 2 // dyld_chained_import_addend
+	chainedImportAddend64 = 3 // dyld_chained_import_addend64
+)
+
+// chainedFixupsHeaderSize is the size of a dyld_chained_fixups_header.
+const chainedFixupsHeaderSize = 28
+
+// chainedFixups returns the LC_DYLD_CHAINED_FIXUPS load command of f, or
+// nil if f has none.
+func (f *File) chainedFixups() LoadBytes {
+	for _, l := range f.Loads {
+		if b, ok := l.(LoadBytes); ok && len(b) >= 4 && LoadCmd(f.ByteOrder.Uint32(b)) == LoadCmdDyldChainedFixups {
+			return b
+		}
+	}
+	return nil
+}
+
+// chainedImports returns the symbol names of the import table of the
+// chained fixups of f, in the order of the table, or nil if f has no
+// chained fixups.
+func (f *File) chainedImports() ([]string, error) {
+	cmd := f.chainedFixups()
+	if cmd == nil {
+		return nil, nil
+	}
+	if len(cmd) < 16 {
+		return nil, errors.New("LC_DYLD_CHAINED_FIXUPS command too short")
+	}
+	if f.raw == nil {
+		return nil, errors.New("chained fixups of a file that was not read from a reader")
+	}
+	off, size := f.ByteOrder.Uint32(cmd[8:]), f.ByteOrder.Uint32(cmd[12:])
+	dat, err := readerat.ReadData(io.NewSectionReader(f.raw, int64(off), int64(size)), uint64(size))
+	if err != nil {
+		return nil, fmt.Errorf("chained fixups at %#x: %v", off, err)
+	}
+	return decodeChainedImports(dat, f.ByteOrder)
+}
+
+// decodeChainedImports decodes the symbol names of the import table of
+// the chained fixups data dat, which starts with a
+// dyld_chained_fixups_header.
+func decodeChainedImports(dat []byte, bo binary.ByteOrder) ([]string, error) {
+	if len(dat) < chainedFixupsHeaderSize {
+		return nil, errors.New("chained fixups header too short")
+	}
+	importsOff := uint64(bo.Uint32(dat[8:]))
+	symbolsOff := uint64(bo.Uint32(dat[12:]))
+	count := uint64(bo.Uint32(dat[16:]))
+	format := bo.Uint32(dat[20:])
+	if symFormat := bo.Uint32(dat[24:]); symFormat != 0 {
+		return nil, fmt.Errorf("unsupported chained fixups symbol format %d", symFormat)
+	}
+	var entsize uint64
+	switch format {
+	case chainedImport:
+		entsize = 4
+	case chainedImportAddend:
+		entsize = 8
+	case chainedImportAddend64:
+		entsize = 16
+	default:
+		return nil, fmt.Errorf("unknown chained fixups import format %d", format)
+	}
+	size := uint64(len(dat))
+	if importsOff > size || count > (size-importsOff)/entsize {
+		return nil, fmt.Errorf("chained fixups import table of %d entries at %#x out of range", count, importsOff)
+	}
+	names := make([]string, count)
+	for i := range names {
+		e := dat[importsOff+uint64(i)*entsize:]
+		var nameOff uint64
+		if format == chainedImportAddend64 {
+			nameOff = bo.Uint64(e) >> 32
+		} else {
+			nameOff = uint64(bo.Uint32(e) >> 9)
+		}
+		start := symbolsOff + nameOff
+		if start >= size {
+			return nil, fmt.Errorf("chained fixups import %d has a name at %#x out of range", i, start)
+		}
+		n := bytes.IndexByte(dat[start:], 0)
+		if n < 0 {
+			return nil, fmt.Errorf("chained fixups import %d has an unterminated name", i)
+		}
+		names[i] = string(dat[start : start+uint64(n)])
+	}
+	return names, nil
+}
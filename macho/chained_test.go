@@ -0,0 +1,48 @@
+package macho
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestDecodeChainedImports(t *testing.T) {
+	le := binary.LittleEndian
+	// A header, two imports and the symbol names "\x00_f\x00_g\x00".
+	build := func(format uint32, entsize int) []byte {
+		dat := make([]byte, chainedFixupsHeaderSize+2*entsize)
+		le.PutUint32(dat[8:], chainedFixupsHeaderSize)
+		le.PutUint32(dat[12:], uint32(len(dat)))
+		le.PutUint32(dat[16:], 2)
+		le.PutUint32(dat[20:], format)
+		for i, nameOff := range []uint32{1, 4} {
+			e := dat[chainedFixupsHeaderSize+i*entsize:]
+			if format == chainedImportAddend64 {
+				le.PutUint64(e, uint64(nameOff)<<32|1)
+			} else {
+				le.PutUint32(e, nameOff<<9|1)
+			}
+		}
+		return append(dat, "\x00_f\x00_g\x00"...)
+	}
+	for _, tt := range []struct {
+		format  uint32
+		entsize int
+	}{
+		{chainedImport, 4},
+		{chainedImportAddend, 8},
+		{chainedImportAddend64, 16},
+	} {
+		dat := build(tt.format, tt.entsize)
+		names, err := decodeChainedImports(dat, le)
+		if err != nil || len(names) != 2 || names[0] != "_f" || names[1] != "_g" {
+			t.Errorf("format %d: imports %q, %v", tt.format, names, err)
+		}
+		if _, err := decodeChainedImports(dat[:len(dat)-1], le); err == nil {
+			t.Errorf("format %d: accepted an unterminated name", tt.format)
+		}
+		le.PutUint32(dat[16:], 0xffffffff)
+		if _, err := decodeChainedImports(dat, le); err == nil {
+			t.Errorf("format %d: accepted an import count past the end", tt.format)
+		}
+	}
+}
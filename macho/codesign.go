@@ -0,0 +1,273 @@
+package macho
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// Magic numbers of the blobs of a code signature, which are big-endian
+// whatever the byte order of the file.
+const (
+	csMagicEmbeddedSignature uint32 = 0xfade0cc0
+	csMagicCodeDirectory     uint32 = 0xfade0c02
+	csMagicRequirements      uint32 = 0xfade0c01
+	csMagicEntitlements      uint32 = 0xfade7171
+	csMagicDEREntitlements   uint32 = 0xfade7172
+	csMagicBlobWrapper       uint32 = 0xfade0b01 // CMS signature
+)
+
+// Slots of the index of the embedded signature superblob.
+const (
+	csSlotCodeDirectory            = 0
+	csSlotRequirements             = 2
+	csSlotEntitlements             = 5
+	csSlotDEREntitlements          = 7
+	csSlotAlternateCodeDirectories = 0x1000 // up to 5 of them
+	csSlotSignature                = 0x10000
+)
+
+// CodeDirectory hash types.
+const (
+	CSHashSHA1        = 1
+	CSHashSHA256      = 2
+	CSHashSHA256Trunc = 3
+	CSHashSHA384      = 4
+)
+
+// csFlagAdhoc is the CodeDirectory flag of an ad hoc signature.
+const csFlagAdhoc uint32 = 0x2
+
+// A CodeDirectory is a parsed CodeDirectory blob of a code signature,
+// which hashes the pages of the signed file and its special slots, such
+// as the entitlements and the requirements.
+type CodeDirectory struct {
+	Version    uint32
+	Flags      uint32 // signing flags, such as 0x2 for ad hoc
+	HashType   uint8
+	HashSize   uint8
+	Platform   uint8
+	PageSize   uint32 // bytes per hashed code page; 0 for unlimited
+	Identifier string // signing identifier, usually the bundle ID
+	TeamID     string // team identifier, empty if unset
+	CodeLimit  uint64 // length of the signed part of the file
+
+	// The executable segment fields of version 0x20400 and later.
+	ExecSegBase  uint64
+	ExecSegLimit uint64
+	ExecSegFlags uint64
+
+	// SpecialSlots are the hashes of the special slots, from slot -1
+	// up; CodeSlots are those of the code pages. They alias the data of
+	// the signature.
+	SpecialSlots [][]byte
+	CodeSlots    [][]byte
+
+	CDHash []byte // hash of the CodeDirectory, truncated to 20 bytes
+}
+
+// Adhoc reports whether the signature is ad hoc, that is, without a
+// certificate.
+func (cd *CodeDirectory) Adhoc() bool { return cd.Flags&csFlagAdhoc != 0 }
+
+// A CodeSignature is the parsed embedded code signature of a Mach-O file,
+// the data of its LC_CODE_SIGNATURE command. The fields of its primary
+// code directory are promoted.
+type CodeSignature struct {
+	CodeDirectory
+
+	// Alternates are the alternate code directories, which hash the
+	// file with other hash types.
+	Alternates []CodeDirectory
+
+	// Entitlements and DEREntitlements are the contents of the XML and
+	// DER entitlements blobs, without their headers, or nil.
+	Entitlements    []byte
+	DEREntitlements []byte
+
+	// Requirements is the requirements blob, with its header, or nil.
+	Requirements []byte
+
+	HasCMS bool // a non-empty CMS signature is present
+}
+
+// CodeSignature parses the code signature of f. It returns nil if f has
+// no LC_CODE_SIGNATURE command. The signature is not verified.
+func (f *File) CodeSignature() (*CodeSignature, error) {
+	if f.SigBlock == nil {
+		return nil, nil
+	}
+	d := f.SigBlock.RawDat
+	be := binary.BigEndian
+	if len(d) < 12 || be.Uint32(d) != csMagicEmbeddedSignature {
+		return nil, &FormatError{int64(f.SigBlock.Offset), "bad code signature magic", nil}
+	}
+	if n := be.Uint32(d[4:]); uint64(n) <= uint64(len(d)) {
+		d = d[:n]
+	}
+	count := be.Uint32(d[8:])
+	if uint64(count) > uint64(len(d)-12)/8 {
+		return nil, &FormatError{int64(f.SigBlock.Offset), "code signature index out of range", count}
+	}
+	blob := func(i uint32) ([]byte, error) {
+		off := be.Uint32(d[12+8*i+4:])
+		if uint64(off)+8 > uint64(len(d)) {
+			return nil, fmt.Errorf("code signature blob %d at %#x out of range", i, off)
+		}
+		n := be.Uint32(d[off+4:])
+		if n < 8 || uint64(off)+uint64(n) > uint64(len(d)) {
+			return nil, fmt.Errorf("code signature blob %d of %d bytes at %#x out of range", i, n, off)
+		}
+		return d[off : off+n], nil
+	}
+
+	s := new(CodeSignature)
+	found := false
+	for i := uint32(0); i < count; i++ {
+		b, err := blob(i)
+		if err != nil {
+			return nil, err
+		}
+		magic := be.Uint32(b)
+		switch typ := be.Uint32(d[12+8*i:]); {
+		case typ == csSlotCodeDirectory && magic == csMagicCodeDirectory:
+			if err := s.CodeDirectory.parse(b); err != nil {
+				return nil, err
+			}
+			found = true
+		case typ >= csSlotAlternateCodeDirectories && typ < csSlotAlternateCodeDirectories+5 && magic == csMagicCodeDirectory:
+			var cd CodeDirectory
+			if err := cd.parse(b); err != nil {
+				return nil, err
+			}
+			s.Alternates = append(s.Alternates, cd)
+		case typ == csSlotRequirements && magic == csMagicRequirements:
+			s.Requirements = b
+		case typ == csSlotEntitlements && magic == csMagicEntitlements:
+			s.Entitlements = b[8:]
+		case typ == csSlotDEREntitlements && magic == csMagicDEREntitlements:
+			s.DEREntitlements = b[8:]
+		case typ == csSlotSignature && magic == csMagicBlobWrapper:
+			s.HasCMS = len(b) > 8
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("code signature has no code directory")
+	}
+	return s, nil
+}
+
+// EntitlementKeys returns the keys of the top-level dictionary of the XML
+// entitlements, in order, or nil if there are none.
+func (s *CodeSignature) EntitlementKeys() ([]string, error) {
+	if s.Entitlements == nil {
+		return nil, nil
+	}
+	dec := xml.NewDecoder(bytes.NewReader(s.Entitlements))
+	var keys []string
+	var path []string // elements open around the current token
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("entitlements: %v", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			path = append(path, tok.Name.Local)
+		case xml.EndElement:
+			path = path[:len(path)-1]
+		case xml.CharData:
+			if len(path) == 3 && path[0] == "plist" && path[1] == "dict" && path[2] == "key" {
+				keys = append(keys, string(tok))
+			}
+		}
+	}
+}
+
+// parse fills cd from the CodeDirectory blob b.
+func (cd *CodeDirectory) parse(b []byte) error {
+	be := binary.BigEndian
+	if len(b) < 44 {
+		return fmt.Errorf("code directory of %d bytes is too short", len(b))
+	}
+	cd.Version = be.Uint32(b[8:])
+	cd.Flags = be.Uint32(b[12:])
+	hashOff := be.Uint32(b[16:])
+	identOff := be.Uint32(b[20:])
+	nSpecial := be.Uint32(b[24:])
+	nCode := be.Uint32(b[28:])
+	cd.CodeLimit = uint64(be.Uint32(b[32:]))
+	cd.HashSize, cd.HashType, cd.Platform = b[36], b[37], b[38]
+	if shift := b[39]; shift != 0 && shift < 32 {
+		cd.PageSize = 1 << shift
+	}
+	str := func(off uint32) (string, error) {
+		if uint64(off) >= uint64(len(b)) {
+			return "", fmt.Errorf("code directory string at %#x out of range", off)
+		}
+		s := b[off:]
+		if i := bytes.IndexByte(s, 0); i >= 0 {
+			return string(s[:i]), nil
+		}
+		return "", fmt.Errorf("code directory string at %#x is not terminated", off)
+	}
+	var err error
+	if cd.Identifier, err = str(identOff); err != nil {
+		return err
+	}
+	if cd.Version >= 0x20200 && len(b) >= 52 {
+		if teamOff := be.Uint32(b[48:]); teamOff != 0 {
+			if cd.TeamID, err = str(teamOff); err != nil {
+				return err
+			}
+		}
+	}
+	if cd.Version >= 0x20300 && len(b) >= 64 {
+		if limit := be.Uint64(b[56:]); limit != 0 {
+			cd.CodeLimit = limit
+		}
+	}
+	if cd.Version >= 0x20400 && len(b) >= 88 {
+		cd.ExecSegBase = be.Uint64(b[64:])
+		cd.ExecSegLimit = be.Uint64(b[72:])
+		cd.ExecSegFlags = be.Uint64(b[80:])
+	}
+
+	size := uint64(cd.HashSize)
+	if uint64(nSpecial)*size > uint64(hashOff) || uint64(hashOff)+uint64(nCode)*size > uint64(len(b)) {
+		return fmt.Errorf("code directory hash slots out of range")
+	}
+	for i := uint64(1); i <= uint64(nSpecial); i++ {
+		at := uint64(hashOff) - i*size
+		cd.SpecialSlots = append(cd.SpecialSlots, b[at:at+size])
+	}
+	for i := uint64(0); i < uint64(nCode); i++ {
+		at := uint64(hashOff) + i*size
+		cd.CodeSlots = append(cd.CodeSlots, b[at:at+size])
+	}
+
+	var sum []byte
+	switch cd.HashType {
+	case CSHashSHA1:
+		h := sha1.Sum(b)
+		sum = h[:]
+	case CSHashSHA256, CSHashSHA256Trunc:
+		h := sha256.Sum256(b)
+		sum = h[:]
+	case CSHashSHA384:
+		h := sha512.Sum384(b)
+		sum = h[:]
+	default:
+		return nil
+	}
+	cd.CDHash = sum[:20]
+	return nil
+}
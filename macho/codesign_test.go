@@ -0,0 +1,117 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// codeDirectory builds a version 0x20400 code directory for ident with
+// hash type typ, hashSize-byte hashes whose bytes are the slot numbers,
+// nSpecial special slots and nCode code slots.
+func codeDirectory(ident string, typ, hashSize uint8, nSpecial, nCode int) []byte {
+	be := binary.BigEndian
+	cd := make([]byte, 88)
+	be.PutUint32(cd[0:], csMagicCodeDirectory)
+	be.PutUint32(cd[8:], 0x20400)
+	be.PutUint32(cd[20:], uint32(len(cd)))
+	cd = append(cd, ident+"\x00"...)
+	for i := nSpecial; i > 0; i-- {
+		cd = append(cd, bytes.Repeat([]byte{byte(0x80 | i)}, int(hashSize))...)
+	}
+	be.PutUint32(cd[16:], uint32(len(cd)))
+	for i := 0; i < nCode; i++ {
+		cd = append(cd, bytes.Repeat([]byte{byte(i)}, int(hashSize))...)
+	}
+	be.PutUint32(cd[24:], uint32(nSpecial))
+	be.PutUint32(cd[28:], uint32(nCode))
+	cd[36], cd[37], cd[38], cd[39] = hashSize, typ, 1, 14
+	be.PutUint64(cd[56:], 0x123456789)
+	be.PutUint64(cd[64:], 0x4000)
+	be.PutUint64(cd[72:], 0x8000)
+	be.PutUint64(cd[80:], 1)
+	be.PutUint32(cd[4:], uint32(len(cd)))
+	return cd
+}
+
+func TestCodeSignature(t *testing.T) {
+	be := binary.BigEndian
+	const ents = `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0"><dict>
+<key>com.apple.security.app-sandbox</key><true/>
+<key>com.apple.security.application-groups</key><array><string>group</string></array>
+<key>nested</key><dict><key>inner</key><true/></dict>
+</dict></plist>`
+	ent := make([]byte, 8, 8+len(ents))
+	be.PutUint32(ent[0:], csMagicEntitlements)
+	be.PutUint32(ent[4:], uint32(8+len(ents)))
+	ent = append(ent, ents...)
+	req := make([]byte, 12)
+	be.PutUint32(req[0:], csMagicRequirements)
+	be.PutUint32(req[4:], 12)
+	cms := make([]byte, 8)
+	be.PutUint32(cms[0:], csMagicBlobWrapper)
+	be.PutUint32(cms[4:], 8)
+
+	blobs := [][]byte{codeDirectory("app", CSHashSHA1, 20, 5, 3), req, ent, codeDirectory("app", CSHashSHA256, 32, 7, 3), cms}
+	slots := []uint32{csSlotCodeDirectory, csSlotRequirements, csSlotEntitlements, csSlotAlternateCodeDirectories, csSlotSignature}
+	sig := make([]byte, 12+8*len(blobs))
+	be.PutUint32(sig[0:], csMagicEmbeddedSignature)
+	be.PutUint32(sig[8:], uint32(len(blobs)))
+	for i, b := range blobs {
+		be.PutUint32(sig[12+8*i:], slots[i])
+		be.PutUint32(sig[16+8*i:], uint32(len(sig)))
+		sig = append(sig, b...)
+	}
+	be.PutUint32(sig[4:], uint32(len(sig)))
+	f := &File{SigBlock: &SigBlock{Len: uint32(len(sig)), RawDat: sig}}
+
+	s, err := f.CodeSignature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cd := s.CodeDirectory
+	if cd.Version != 0x20400 || cd.Identifier != "app" || cd.HashType != CSHashSHA1 || cd.HashSize != 20 ||
+		cd.Platform != 1 || cd.PageSize != 1<<14 || cd.CodeLimit != 0x123456789 || cd.Adhoc() {
+		t.Errorf("code directory is %+v", cd)
+	}
+	if cd.ExecSegBase != 0x4000 || cd.ExecSegLimit != 0x8000 || cd.ExecSegFlags != 1 {
+		t.Errorf("executable segment is %#x+%#x flags %#x", cd.ExecSegBase, cd.ExecSegLimit, cd.ExecSegFlags)
+	}
+	if len(cd.SpecialSlots) != 5 || len(cd.CodeSlots) != 3 {
+		t.Fatalf("%d special and %d code slots", len(cd.SpecialSlots), len(cd.CodeSlots))
+	}
+	for i, h := range cd.SpecialSlots {
+		if !bytes.Equal(h, bytes.Repeat([]byte{byte(0x80 | (i + 1))}, 20)) {
+			t.Errorf("special slot -%d is %x", i+1, h)
+		}
+	}
+	for i, h := range cd.CodeSlots {
+		if !bytes.Equal(h, bytes.Repeat([]byte{byte(i)}, 20)) {
+			t.Errorf("code slot %d is %x", i, h)
+		}
+	}
+	if len(s.Alternates) != 1 || s.Alternates[0].HashType != CSHashSHA256 || len(s.Alternates[0].SpecialSlots) != 7 ||
+		len(s.Alternates[0].CodeSlots[2]) != 32 || len(s.Alternates[0].CDHash) != 20 {
+		t.Errorf("alternates are %+v", s.Alternates)
+	}
+	if !bytes.Equal(s.Requirements, req) || string(s.Entitlements) != ents || s.HasCMS {
+		t.Errorf("requirements %x, entitlements %q, CMS %v", s.Requirements, s.Entitlements, s.HasCMS)
+	}
+	keys, err := s.EntitlementKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"com.apple.security.app-sandbox", "com.apple.security.application-groups", "nested"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("entitlement keys are %q, want %q", keys, want)
+	}
+
+	// A code directory whose slots run past its end is rejected.
+	cdOff := be.Uint32(sig[16:])
+	be.PutUint32(sig[cdOff+28:], 1000)
+	if _, err := f.CodeSignature(); err == nil {
+		t.Error("CodeSignature accepted code slots out of range")
+	}
+}
@@ -0,0 +1,219 @@
+package macho
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// A Description is a summary of the metadata of a Mach-O file, laid out
+// for encoding as JSON. It is the Mach-O counterpart of the descriptions
+// of the elf and pe packages.
+type Description struct {
+	Header        HeaderDescription     `json:"header"`
+	Loads         []LoadDescription     `json:"loads"`
+	Segments      []SegmentDescription  `json:"segments"`
+	Dylibs        []DylibDescription    `json:"dylibs"`
+	RPaths        []string              `json:"rpaths"`
+	Dylinker      string                `json:"dylinker,omitempty"`
+	UUID          string                `json:"uuid,omitempty"`
+	Entry         uint64                `json:"entry,omitempty"`
+	NumSymbols    int                   `json:"num_symbols"`
+	CodeSignature *SignatureDescription `json:"code_signature,omitempty"`
+}
+
+// A HeaderDescription describes the Mach-O file header.
+type HeaderDescription struct {
+	Magic  uint32 `json:"magic"`
+	Cpu    string `json:"cpu"`
+	SubCpu uint32 `json:"subcpu"`
+	Type   string `json:"type"`
+	Ncmd   uint32 `json:"ncmd"`
+	Cmdsz  uint32 `json:"cmdsz"`
+	Flags  uint32 `json:"flags"`
+}
+
+// A LoadDescription describes a load command by its command and the file
+// offset and size of its bytes. Name is the name of Cmd as printed by
+// LoadCmd.String.
+type LoadDescription struct {
+	Cmd    LoadCmd `json:"cmd"`
+	Name   string  `json:"name"`
+	Offset uint64  `json:"offset"`
+	Size   int     `json:"size"`
+}
+
+// A SegmentDescription describes a segment and its sections.
+type SegmentDescription struct {
+	Name     string               `json:"name"`
+	Addr     uint64               `json:"addr"`
+	Memsz    uint64               `json:"memsz"`
+	Offset   uint64               `json:"offset"`
+	Filesz   uint64               `json:"filesz"`
+	Maxprot  uint32               `json:"maxprot"`
+	Prot     uint32               `json:"prot"`
+	Flag     uint32               `json:"flags"`
+	Sections []SectionDescription `json:"sections"`
+}
+
+// A SectionDescription describes a section header.
+type SectionDescription struct {
+	Name   string `json:"name"`
+	Addr   uint64 `json:"addr"`
+	Size   uint64 `json:"size"`
+	Offset uint32 `json:"offset"`
+	Align  uint32 `json:"align"`
+	Reloff uint32 `json:"reloff"`
+	Nreloc uint32 `json:"nreloc"`
+	Flags  uint32 `json:"flags"`
+}
+
+// A DylibDescription describes a dylib load command, with its versions
+// in the usual X.Y.Z form.
+type DylibDescription struct {
+	Name           string `json:"name"`
+	CurrentVersion string `json:"current_version"`
+	CompatVersion  string `json:"compat_version"`
+	Time           uint32 `json:"time"`
+}
+
+// A SignatureDescription summarizes a CodeSignature. Entitlements are
+// only reported present; their contents are in CodeSignature.
+type SignatureDescription struct {
+	Identifier         string `json:"identifier"`
+	TeamID             string `json:"team_id,omitempty"`
+	Flags              uint32 `json:"flags"`
+	Adhoc              bool   `json:"adhoc"`
+	HashType           uint8  `json:"hash_type"`
+	PageSize           uint32 `json:"page_size"`
+	CodeSlots          uint32 `json:"code_slots"`
+	CDHash             string `json:"cdhash,omitempty"`
+	HasEntitlements    bool   `json:"has_entitlements"`
+	HasDEREntitlements bool   `json:"has_der_entitlements"`
+	HasRequirements    bool   `json:"has_requirements"`
+	HasCMS             bool   `json:"has_cms"`
+}
+
+// Describe returns a Description of f. A file without an entry point,
+// such as a dylib or an object file, has an Entry of zero.
+func (f *File) Describe() (*Description, error) {
+	d := &Description{
+		Header: HeaderDescription{
+			Magic:  f.Magic,
+			Cpu:    f.Cpu.String(),
+			SubCpu: f.SubCpu,
+			Type:   f.Type.String(),
+			Ncmd:   f.Ncmd,
+			Cmdsz:  f.Cmdsz,
+			Flags:  f.Flags,
+		},
+		Loads:    []LoadDescription{},
+		Segments: []SegmentDescription{},
+		Dylibs:   []DylibDescription{},
+		RPaths:   []string{},
+	}
+	off := f.loadCommandsStart()
+	for _, l := range f.Loads {
+		raw := l.Raw()
+		var cmd LoadCmd
+		if len(raw) >= 4 {
+			cmd = LoadCmd(f.ByteOrder.Uint32(raw))
+		}
+		d.Loads = append(d.Loads, LoadDescription{Cmd: cmd, Name: cmd.String(), Offset: off, Size: len(raw)})
+		off += uint64(len(raw))
+
+		switch l := l.(type) {
+		case *Segment:
+			seg := SegmentDescription{
+				Name:     l.Name,
+				Addr:     l.Addr,
+				Memsz:    l.Memsz,
+				Offset:   l.Offset,
+				Filesz:   l.Filesz,
+				Maxprot:  l.Maxprot,
+				Prot:     l.Prot,
+				Flag:     l.Flag,
+				Sections: []SectionDescription{},
+			}
+			for _, s := range f.segmentSections(l) {
+				seg.Sections = append(seg.Sections, SectionDescription{
+					Name:   s.Name,
+					Addr:   s.Addr,
+					Size:   s.Size,
+					Offset: s.Offset,
+					Align:  s.Align,
+					Reloff: s.Reloff,
+					Nreloc: s.Nreloc,
+					Flags:  s.Flags,
+				})
+			}
+			d.Segments = append(d.Segments, seg)
+		case *Dylib:
+			d.Dylibs = append(d.Dylibs, DylibDescription{
+				Name:           l.Name,
+				CurrentVersion: dylibVersion(l.CurrentVersion),
+				CompatVersion:  dylibVersion(l.CompatVersion),
+				Time:           l.Time,
+			})
+		case *Rpath:
+			d.RPaths = append(d.RPaths, l.Path)
+		case *Dylinker:
+			d.Dylinker = l.Name
+		default:
+			switch {
+			case cmd == LoadCmdUUID && len(raw) >= 24:
+				d.UUID = hex.EncodeToString(raw[8:24])
+			case cmd == loadCmdLoadDylinker && len(raw) >= 12:
+				if off := f.ByteOrder.Uint32(raw[8:]); off < uint32(len(raw)) {
+					d.Dylinker = cstring(raw[off:])
+				}
+			}
+		}
+	}
+	if entry, err := f.Entry(); err == nil {
+		d.Entry = entry
+	}
+	if f.Symtab != nil {
+		d.NumSymbols = len(f.Symtab.Syms)
+	}
+
+	sig, err := f.CodeSignature()
+	if err != nil {
+		return nil, err
+	}
+	if sig != nil {
+		d.CodeSignature = &SignatureDescription{
+			Identifier:         sig.Identifier,
+			TeamID:             sig.TeamID,
+			Flags:              sig.Flags,
+			Adhoc:              sig.Adhoc(),
+			HashType:           sig.HashType,
+			PageSize:           sig.PageSize,
+			CodeSlots:          uint32(len(sig.CodeSlots)),
+			CDHash:             hex.EncodeToString(sig.CDHash),
+			HasEntitlements:    sig.Entitlements != nil,
+			HasDEREntitlements: sig.DEREntitlements != nil,
+			HasRequirements:    sig.Requirements != nil,
+			HasCMS:             sig.HasCMS,
+		}
+	}
+	return d, nil
+}
+
+// MarshalJSON encodes the Description of f.
+func (f *File) MarshalJSON() ([]byte, error) {
+	d, err := f.Describe()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(d)
+}
+
+// loadCmdLoadDylinker is LC_LOAD_DYLINKER, which names the dynamic linker
+// of an executable. It is kept as LoadBytes.
+const loadCmdLoadDylinker LoadCmd = 0xe
+
+// dylibVersion formats a dylib version, which is packed as xxxx.yy.zz.
+func dylibVersion(v uint32) string {
+	return fmt.Sprintf("%d.%d.%d", v>>16, v>>8&0xff, v&0xff)
+}
@@ -0,0 +1,103 @@
+package macho
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// codeSignature builds an embedded signature superblob with a SHA-256 code
+// directory for ident and team, and an entitlements blob if ents is not
+// nil.
+func codeSignature(ident, team string, ents []byte) []byte {
+	be := binary.BigEndian
+	cd := make([]byte, 52)
+	be.PutUint32(cd[0:], csMagicCodeDirectory)
+	be.PutUint32(cd[8:], 0x20200)
+	be.PutUint32(cd[12:], csFlagAdhoc)
+	be.PutUint32(cd[20:], uint32(len(cd)))
+	cd = append(cd, ident+"\x00"...)
+	be.PutUint32(cd[48:], uint32(len(cd)))
+	cd = append(cd, team+"\x00"...)
+	cd[37], cd[39] = CSHashSHA256, 12
+	be.PutUint32(cd[4:], uint32(len(cd)))
+
+	blobs := [][]byte{cd}
+	slots := []uint32{csSlotCodeDirectory}
+	if ents != nil {
+		b := make([]byte, 8, 8+len(ents))
+		be.PutUint32(b[0:], csMagicEntitlements)
+		be.PutUint32(b[4:], uint32(8+len(ents)))
+		blobs, slots = append(blobs, append(b, ents...)), append(slots, csSlotEntitlements)
+	}
+	sig := make([]byte, 12+8*len(blobs))
+	be.PutUint32(sig[0:], csMagicEmbeddedSignature)
+	be.PutUint32(sig[8:], uint32(len(blobs)))
+	for i, b := range blobs {
+		be.PutUint32(sig[12+8*i:], slots[i])
+		be.PutUint32(sig[16+8*i:], uint32(len(sig)))
+		sig = append(sig, b...)
+	}
+	be.PutUint32(sig[4:], uint32(len(sig)))
+	return sig
+}
+
+func TestDescribe(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	const ents = "<plist><dict/></plist>"
+	sig := codeSignature("com.example.hello", "TEAM123456", []byte(ents))
+	f.SigBlock = &SigBlock{Len: uint32(len(sig)), RawDat: sig}
+
+	d, err := f.Describe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Header.Cpu != "CpuAmd64" || d.Header.Type != "Exec" || len(d.Loads) != int(f.Ncmd) {
+		t.Errorf("header is %+v with %d loads", d.Header, len(d.Loads))
+	}
+	if last := d.Loads[len(d.Loads)-1]; last.Offset+uint64(last.Size) != 32+uint64(f.Cmdsz) {
+		t.Errorf("last load command %+v does not end the load commands", last)
+	}
+	if len(d.Segments) != 4 || d.Segments[1].Name != "__TEXT" || d.Segments[1].Sections[0].Name != "__text" {
+		t.Errorf("segments are %+v", d.Segments)
+	}
+	if len(d.Dylibs) != 1 || d.Dylibs[0].Name != "/usr/lib/libSystem.B.dylib" || !reflect.DeepEqual(d.RPaths, f.RPaths()) {
+		t.Errorf("dylibs are %+v and rpaths %q", d.Dylibs, d.RPaths)
+	}
+	if entry, _ := f.Entry(); d.Entry != entry || len(d.UUID) != 32 || d.Dylinker != "/usr/lib/dyld" {
+		t.Errorf("entry %#x, UUID %q, dylinker %q", d.Entry, d.UUID, d.Dylinker)
+	}
+	cs := d.CodeSignature
+	if cs == nil || cs.Identifier != "com.example.hello" || cs.TeamID != "TEAM123456" || !cs.Adhoc || cs.PageSize != 4096 ||
+		!cs.HasEntitlements || cs.HasDEREntitlements || cs.HasCMS {
+		t.Errorf("code signature is %+v", cs)
+	}
+	cd := sig[binary.BigEndian.Uint32(sig[16:]):]
+	sum := sha256.Sum256(cd[:binary.BigEndian.Uint32(cd[4:])])
+	if s, _ := f.CodeSignature(); string(s.Entitlements) != ents || string(s.CDHash) != string(sum[:20]) {
+		t.Errorf("entitlements are %q and CDHash %x", s.Entitlements, s.CDHash)
+	}
+
+	b, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Description
+	if err := json.Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&back, d) {
+		t.Errorf("JSON does not round trip: %s", b)
+	}
+
+	f.SigBlock.RawDat = sig[:8]
+	if _, err := f.Describe(); err == nil {
+		t.Error("Describe accepted a truncated code signature")
+	}
+}
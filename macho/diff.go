@@ -0,0 +1,403 @@
+package macho
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Binject/debug/internal/diff"
+)
+
+// A FieldChange is a header field whose value differs between the two
+// files compared by Diff. Field is the name of the field in FileHeader,
+// SegmentHeader or SectionHeader.
+type FieldChange = diff.FieldChange
+
+// A ByteRange is a run of bytes of a section that differs. Off is the
+// offset of the run in both sections; a range that runs past the end of
+// one of them holds only the bytes it has.
+type ByteRange = diff.ByteRange
+
+// A LoadChange is a load command that one file has and the other does
+// not, or whose bytes differ. Load commands are matched by command, the
+// n-th command of a kind in one file with the n-th one in the other.
+// Index and OldIndex are -1 for commands that the new or old file does
+// not have.
+type LoadChange struct {
+	Cmd      LoadCmd `json:"cmd"`
+	Index    int     `json:"index"`
+	OldIndex int     `json:"oldIndex"`
+}
+
+// A SegmentDiff describes a segment that both files have, matched by
+// name, with different headers.
+type SegmentDiff struct {
+	Name   string        `json:"name"`
+	Header []FieldChange `json:"header"`
+}
+
+// A SectionDiff describes a section that both files have, matched by
+// segment and section name, with different headers, contents or
+// relocations. The hashes are the SHA-256 of the contents, in hex; zero
+// filled sections have none.
+type SectionDiff struct {
+	Name          string        `json:"name"` // "segment,section"
+	OldHash       string        `json:"oldHash,omitempty"`
+	NewHash       string        `json:"newHash,omitempty"`
+	Header        []FieldChange `json:"header,omitempty"`
+	Ranges        []ByteRange   `json:"ranges,omitempty"`
+	RelocsChanged bool          `json:"relocsChanged,omitempty"`
+}
+
+// A Changeset is the difference between two Mach-O files computed by
+// Diff. Its fields carry JSON tags, so that it can be encoded with
+// encoding/json for other tools; String formats it for review.
+type Changeset struct {
+	Header []FieldChange `json:"header,omitempty"`
+	Loads  []LoadChange  `json:"loads,omitempty"`
+
+	Segments        []SegmentDiff `json:"segments,omitempty"`
+	AddedSegments   []string      `json:"addedSegments,omitempty"`
+	RemovedSegments []string      `json:"removedSegments,omitempty"`
+
+	Sections        []SectionDiff `json:"sections,omitempty"`
+	AddedSections   []string      `json:"addedSections,omitempty"`
+	RemovedSections []string      `json:"removedSections,omitempty"`
+
+	AddedSymbols   []Symbol `json:"addedSymbols,omitempty"`
+	RemovedSymbols []Symbol `json:"removedSymbols,omitempty"`
+
+	// The dyld info streams of linked images, decoded. Lazy binds are
+	// compared without their InfoOffset, which moves whenever an entry
+	// before them changes.
+	AddedRebases      []Rebase `json:"addedRebases,omitempty"`
+	RemovedRebases    []Rebase `json:"removedRebases,omitempty"`
+	AddedBinds        []Bind   `json:"addedBinds,omitempty"`
+	RemovedBinds      []Bind   `json:"removedBinds,omitempty"`
+	AddedLazyBinds    []Bind   `json:"addedLazyBinds,omitempty"`
+	RemovedLazyBinds  []Bind   `json:"removedLazyBinds,omitempty"`
+	AddedWeakBinds    []Bind   `json:"addedWeakBinds,omitempty"`
+	RemovedWeakBinds  []Bind   `json:"removedWeakBinds,omitempty"`
+	ExportInfoChanged bool     `json:"exportInfoChanged,omitempty"`
+}
+
+// String returns c as one line per change, for review.
+func (c *Changeset) String() string {
+	var b strings.Builder
+	for _, h := range c.Header {
+		fmt.Fprintf(&b, "header %v\n", h)
+	}
+	for _, l := range c.Loads {
+		switch {
+		case l.OldIndex < 0:
+			fmt.Fprintf(&b, "+ load %v at %d\n", l.Cmd, l.Index)
+		case l.Index < 0:
+			fmt.Fprintf(&b, "- load %v at %d\n", l.Cmd, l.OldIndex)
+		default:
+			fmt.Fprintf(&b, "load %v at %d changed\n", l.Cmd, l.Index)
+		}
+	}
+	lines := func(prefix string, names []string) {
+		for _, n := range names {
+			fmt.Fprintf(&b, "%s %s\n", prefix, n)
+		}
+	}
+	lines("- segment", c.RemovedSegments)
+	lines("+ segment", c.AddedSegments)
+	for _, s := range c.Segments {
+		for _, h := range s.Header {
+			fmt.Fprintf(&b, "segment %s %v\n", s.Name, h)
+		}
+	}
+	lines("- section", c.RemovedSections)
+	lines("+ section", c.AddedSections)
+	for _, s := range c.Sections {
+		if s.OldHash != s.NewHash {
+			fmt.Fprintf(&b, "section %s %s -> %s\n", s.Name, s.OldHash, s.NewHash)
+		}
+		for _, h := range s.Header {
+			fmt.Fprintf(&b, "section %s %v\n", s.Name, h)
+		}
+		for _, r := range s.Ranges {
+			fmt.Fprintf(&b, "section %s bytes %#x: %d -> %d\n", s.Name, r.Off, len(r.Old), len(r.New))
+		}
+		if s.RelocsChanged {
+			fmt.Fprintf(&b, "section %s relocations changed\n", s.Name)
+		}
+	}
+	for _, s := range c.RemovedSymbols {
+		fmt.Fprintf(&b, "- symbol %s\n", s.Name)
+	}
+	for _, s := range c.AddedSymbols {
+		fmt.Fprintf(&b, "+ symbol %s\n", s.Name)
+	}
+	for _, r := range c.RemovedRebases {
+		fmt.Fprintf(&b, "- rebase %d+%#x\n", r.Segment, r.Offset)
+	}
+	for _, r := range c.AddedRebases {
+		fmt.Fprintf(&b, "+ rebase %d+%#x\n", r.Segment, r.Offset)
+	}
+	binds := func(prefix string, list []Bind) {
+		for _, x := range list {
+			fmt.Fprintf(&b, "%s %d+%#x %s\n", prefix, x.Segment, x.Offset, x.Symbol)
+		}
+	}
+	binds("- bind", c.RemovedBinds)
+	binds("+ bind", c.AddedBinds)
+	binds("- lazy bind", c.RemovedLazyBinds)
+	binds("+ lazy bind", c.AddedLazyBinds)
+	binds("- weak bind", c.RemovedWeakBinds)
+	binds("+ weak bind", c.AddedWeakBinds)
+	if c.ExportInfoChanged {
+		b.WriteString("export info changed\n")
+	}
+	return b.String()
+}
+
+// Diff compares the Mach-O files a and b.
+func Diff(a, b *File) (*Changeset, error) {
+	c := &Changeset{}
+	c.Header = diff.Fields("", &a.FileHeader, &b.FileHeader)
+	c.diffLoads(a, b)
+	c.diffSegments(a, b)
+	if err := c.diffSections(a, b); err != nil {
+		return nil, err
+	}
+	c.AddedSymbols, c.RemovedSymbols = diffSymbols(a, b)
+	if err := c.diffDyldInfo(a, b); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Changeset) diffLoads(a, b *File) {
+	cmd := func(f *File, l Load) LoadCmd {
+		if raw := l.Raw(); len(raw) >= 4 {
+			return LoadCmd(f.ByteOrder.Uint32(raw))
+		}
+		return 0
+	}
+	byCmd := make(map[LoadCmd][]int)
+	for i, l := range a.Loads {
+		byCmd[cmd(a, l)] = append(byCmd[cmd(a, l)], i)
+	}
+	seen := make(map[LoadCmd]int)
+	for i, l := range b.Loads {
+		k := cmd(b, l)
+		n := seen[k]
+		seen[k]++
+		switch {
+		case n >= len(byCmd[k]):
+			c.Loads = append(c.Loads, LoadChange{k, i, -1})
+		case !bytes.Equal(a.Loads[byCmd[k][n]].Raw(), l.Raw()):
+			c.Loads = append(c.Loads, LoadChange{k, i, byCmd[k][n]})
+		}
+	}
+	for i, l := range a.Loads {
+		k := cmd(a, l)
+		for j, idx := range byCmd[k] {
+			if idx == i && j >= seen[k] {
+				c.Loads = append(c.Loads, LoadChange{k, -1, i})
+			}
+		}
+	}
+}
+
+func (c *Changeset) diffSegments(a, b *File) {
+	old := make(map[string]*Segment)
+	for _, s := range a.segments() {
+		old[s.Name] = s
+	}
+	for _, s := range b.segments() {
+		o, ok := old[s.Name]
+		if !ok {
+			c.AddedSegments = append(c.AddedSegments, s.Name)
+			continue
+		}
+		delete(old, s.Name)
+		if h := diff.Fields("", &o.SegmentHeader, &s.SegmentHeader); len(h) > 0 {
+			c.Segments = append(c.Segments, SegmentDiff{s.Name, h})
+		}
+	}
+	for name := range old {
+		c.RemovedSegments = append(c.RemovedSegments, name)
+	}
+	sort.Strings(c.AddedSegments)
+	sort.Strings(c.RemovedSegments)
+}
+
+func (c *Changeset) diffSections(a, b *File) error {
+	key := func(s *Section) string { return s.Seg + "," + s.Name }
+	old := make(map[string]*Section)
+	for _, s := range a.Sections {
+		old[key(s)] = s
+	}
+	contents := func(s *Section) ([]byte, string, error) {
+		if isZerofill(s.Flags) {
+			return nil, "", nil
+		}
+		data, err := s.Data()
+		if err != nil {
+			return nil, "", fmt.Errorf("section %s: %v", key(s), err)
+		}
+		h := sha256.Sum256(data)
+		return data, hex.EncodeToString(h[:]), nil
+	}
+	for _, s := range b.Sections {
+		o, ok := old[key(s)]
+		if !ok {
+			c.AddedSections = append(c.AddedSections, key(s))
+			continue
+		}
+		delete(old, key(s))
+		od, oh, err := contents(o)
+		if err != nil {
+			return err
+		}
+		nd, nh, err := contents(s)
+		if err != nil {
+			return err
+		}
+		d := SectionDiff{
+			Name:          key(s),
+			Header:        diff.Fields("", &o.SectionHeader, &s.SectionHeader),
+			Ranges:        diff.Bytes(od, nd),
+			RelocsChanged: !reflect.DeepEqual(o.Relocs, s.Relocs),
+		}
+		if len(d.Header) > 0 || len(d.Ranges) > 0 || d.RelocsChanged {
+			d.OldHash, d.NewHash = oh, nh
+			c.Sections = append(c.Sections, d)
+		}
+	}
+	for name := range old {
+		c.RemovedSections = append(c.RemovedSections, name)
+	}
+	sort.Strings(c.AddedSections)
+	sort.Strings(c.RemovedSections)
+	return nil
+}
+
+// diffSymbols returns the symbols of b that a does not have and those of
+// a that b does not have, counting repeated symbols.
+func diffSymbols(a, b *File) (added, removed []Symbol) {
+	var as, bs []Symbol
+	if a.Symtab != nil {
+		as = a.Symtab.Syms
+	}
+	if b.Symtab != nil {
+		bs = b.Symtab.Syms
+	}
+	count := make(map[Symbol]int)
+	for _, s := range as {
+		count[s]++
+	}
+	for _, s := range bs {
+		if count[s] > 0 {
+			count[s]--
+		} else {
+			added = append(added, s)
+		}
+	}
+	for _, s := range as {
+		if count[s] > 0 {
+			count[s]--
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+func (c *Changeset) diffDyldInfo(a, b *File) error {
+	ar, err := a.Rebases()
+	if err != nil {
+		return err
+	}
+	br, err := b.Rebases()
+	if err != nil {
+		return err
+	}
+	count := make(map[Rebase]int)
+	for _, r := range ar {
+		count[r]++
+	}
+	for _, r := range br {
+		if count[r] > 0 {
+			count[r]--
+		} else {
+			c.AddedRebases = append(c.AddedRebases, r)
+		}
+	}
+	for _, r := range ar {
+		if count[r] > 0 {
+			count[r]--
+			c.RemovedRebases = append(c.RemovedRebases, r)
+		}
+	}
+
+	for _, list := range []struct {
+		get            func(*File) ([]Bind, error)
+		added, removed *[]Bind
+		lazy           bool
+	}{
+		{(*File).Binds, &c.AddedBinds, &c.RemovedBinds, false},
+		{(*File).LazyBinds, &c.AddedLazyBinds, &c.RemovedLazyBinds, true},
+		{(*File).WeakBinds, &c.AddedWeakBinds, &c.RemovedWeakBinds, false},
+	} {
+		ab, err := list.get(a)
+		if err != nil {
+			return err
+		}
+		bb, err := list.get(b)
+		if err != nil {
+			return err
+		}
+		if list.lazy {
+			ab, bb = withoutInfoOffsets(ab), withoutInfoOffsets(bb)
+		}
+		*list.added, *list.removed = diffBinds(ab, bb)
+	}
+
+	var ae, be []byte
+	if a.DylinkInfo != nil {
+		ae = a.DylinkInfo.ExportInfoDat
+	}
+	if b.DylinkInfo != nil {
+		be = b.DylinkInfo.ExportInfoDat
+	}
+	c.ExportInfoChanged = !bytes.Equal(ae, be)
+	return nil
+}
+
+func withoutInfoOffsets(binds []Bind) []Bind {
+	out := make([]Bind, len(binds))
+	for i, b := range binds {
+		b.InfoOffset = 0
+		out[i] = b
+	}
+	return out
+}
+
+func diffBinds(a, b []Bind) (added, removed []Bind) {
+	count := make(map[Bind]int)
+	for _, x := range a {
+		count[x]++
+	}
+	for _, x := range b {
+		if count[x] > 0 {
+			count[x]--
+		} else {
+			added = append(added, x)
+		}
+	}
+	for _, x := range a {
+		if count[x] > 0 {
+			count[x]--
+			removed = append(removed, x)
+		}
+	}
+	return added, removed
+}
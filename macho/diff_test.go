@@ -0,0 +1,76 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	const name = "testdata/clang-amd64-darwin-exec-with-rpath"
+	a, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	f, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := f.AddRPath("@loader_path/lib"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetRebases(nil); err != nil {
+		t.Fatal(err)
+	}
+	text := f.Section("__text")
+	data, err := text.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[4] ^= 0xff
+	text.Replace(bytes.NewReader(data), int64(len(data)))
+	raw, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewFile(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Diff(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Header) != 2 || c.Header[0].Field != "Ncmd" || c.Header[1].Field != "Cmdsz" {
+		t.Errorf("header changes are %v, want Ncmd and Cmdsz", c.Header)
+	}
+	if len(c.Loads) != 1 || c.Loads[0].Cmd != LoadCmdRpath || c.Loads[0].OldIndex != -1 {
+		t.Errorf("load command changes are %+v, want an added LC_RPATH", c.Loads)
+	}
+	if len(c.Sections) != 1 || c.Sections[0].Name != "__TEXT,__text" || len(c.Sections[0].Ranges) != 1 || c.Sections[0].Ranges[0].Off != 4 {
+		t.Errorf("section changes are %+v, want byte 4 of __text", c.Sections)
+	}
+	if len(c.RemovedRebases) != 1 || len(c.AddedRebases) != 0 || len(c.AddedBinds)+len(c.RemovedBinds)+len(c.AddedLazyBinds)+len(c.RemovedLazyBinds) != 0 {
+		t.Errorf("rebases added %v and removed %v; binds added %v and removed %v", c.AddedRebases, c.RemovedRebases, c.AddedBinds, c.RemovedBinds)
+	}
+	if s := c.String(); !strings.Contains(s, "+ load LoadCmdRpath at") || !strings.Contains(s, "- rebase 2+0x10\n") {
+		t.Errorf("changeset prints as\n%s", s)
+	}
+	j, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Changeset
+	if err := json.Unmarshal(j, &back); err != nil || back.String() != c.String() {
+		t.Errorf("changeset does not survive JSON: %s, %v", j, err)
+	}
+
+	if c, err := Diff(a, a); err != nil || c.String() != "" {
+		t.Errorf("Diff of a file with itself = %v, %v", c, err)
+	}
+}
@@ -0,0 +1,281 @@
+// Package dsc implements access to dyld shared caches, the files in which
+// Apple operating systems ship their system libraries prelinked together,
+// and the extraction of single dylibs from them as Mach-O files.
+package dsc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Binject/debug/internal/readerat"
+)
+
+// A Header represents the fields of a dyld_cache_header that locate the
+// rest of the cache. Fields that the cache's header is too old to have are
+// zero.
+type Header struct {
+	Magic              string // such as "dyld_v1  x86_64h"
+	MappingOffset      uint32
+	MappingCount       uint32
+	ImagesOffset       uint32
+	ImagesCount        uint32
+	DyldBaseAddress    uint64
+	LocalSymbolsOffset uint64
+	LocalSymbolsSize   uint64
+	UUID               [16]byte
+}
+
+// A Mapping is a range of the cache file that is mapped into memory.
+type Mapping struct {
+	Address    uint64
+	Size       uint64
+	FileOffset uint64
+	MaxProt    uint32
+	InitProt   uint32
+}
+
+// An Image is a dylib in the cache. Address is the address of its Mach-O
+// header.
+type Image struct {
+	Path    string
+	Address uint64
+	ModTime uint64
+	Inode   uint64
+}
+
+// A File represents an open dyld shared cache.
+type File struct {
+	Header
+	Mappings []Mapping
+	Images   []*Image
+
+	r      io.ReaderAt
+	size   uint64 // of the cache file, which bounds every read
+	closer io.Closer
+}
+
+// FormatError is returned by some operations if the data does
+// not have the correct format for a dyld shared cache.
+type FormatError struct {
+	off int64
+	msg string
+	val interface{}
+}
+
+func (e *FormatError) Error() string {
+	msg := e.msg
+	if e.val != nil {
+		msg += fmt.Sprintf(" '%v'", e.val)
+	}
+	msg += fmt.Sprintf(" in record at byte %#x", e.off)
+	return msg
+}
+
+const (
+	mappingSize   = 32 // sizeof(dyld_cache_mapping_info)
+	imageInfoSize = 32 // sizeof(dyld_cache_image_info)
+
+	// Offset of imagesOffset and imagesCount in caches whose
+	// imagesOffsetOld is zero.
+	imagesOffsetNew = 0x1c0
+)
+
+// Open opens the named file using os.Open and prepares it for use as a
+// dyld shared cache.
+func Open(name string) (*File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	ff, err := NewFile(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ff.closer = f
+	return ff, nil
+}
+
+// Close closes the File.
+// If the File was created using NewFile directly instead of Open,
+// Close has no effect.
+func (f *File) Close() error {
+	var err error
+	if f.closer != nil {
+		err = f.closer.Close()
+		f.closer = nil
+	}
+	return err
+}
+
+// NewFile creates a new File for accessing a dyld shared cache in an
+// underlying reader.
+func NewFile(r io.ReaderAt) (*File, error) {
+	f := &File{r: r}
+	var ident [0x20]byte
+	if _, err := r.ReadAt(ident[:], 0); err != nil {
+		return nil, &FormatError{0, "error reading header", err}
+	}
+	if !bytes.HasPrefix(ident[:], []byte("dyld_v1 ")) {
+		return nil, &FormatError{0, "invalid magic number", string(bytes.TrimRight(ident[:16], "\x00"))}
+	}
+	bo := binary.LittleEndian
+	f.Magic = string(bytes.TrimRight(ident[:16], "\x00"))
+	f.MappingOffset = bo.Uint32(ident[0x10:])
+	f.MappingCount = bo.Uint32(ident[0x14:])
+	size, err := readerat.Size(r)
+	if err != nil {
+		return nil, &FormatError{0, "error reading header", err}
+	}
+	f.size = uint64(size)
+	if f.MappingOffset < 0x20 || uint64(f.MappingOffset) > f.size {
+		return nil, &FormatError{0x10, "invalid mapping offset", f.MappingOffset}
+	}
+
+	// The header ends where the mappings start.
+	hdr := make([]byte, f.MappingOffset)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return nil, &FormatError{0, "error reading header", err}
+	}
+	u32 := func(off int) uint32 {
+		if off+4 > len(hdr) {
+			return 0
+		}
+		return bo.Uint32(hdr[off:])
+	}
+	u64 := func(off int) uint64 {
+		if off+8 > len(hdr) {
+			return 0
+		}
+		return bo.Uint64(hdr[off:])
+	}
+	f.ImagesOffset, f.ImagesCount = u32(0x18), u32(0x1c)
+	if f.ImagesOffset == 0 {
+		f.ImagesOffset, f.ImagesCount = u32(imagesOffsetNew), u32(imagesOffsetNew+4)
+	}
+	f.DyldBaseAddress = u64(0x20)
+	f.LocalSymbolsOffset = u64(0x48)
+	f.LocalSymbolsSize = u64(0x50)
+	if len(hdr) >= 0x68 {
+		copy(f.UUID[:], hdr[0x58:])
+	}
+
+	// The tables are checked against the file before they are allocated,
+	// and the image list must follow the header.
+	if !f.fits(uint64(f.MappingOffset), uint64(f.MappingCount), mappingSize) {
+		return nil, &FormatError{0x14, "mapping count past the end of the file", f.MappingCount}
+	}
+	if f.ImagesCount > 0 && (f.ImagesOffset < f.MappingOffset || !f.fits(uint64(f.ImagesOffset), uint64(f.ImagesCount), imageInfoSize)) {
+		return nil, &FormatError{int64(f.ImagesOffset), "invalid image list", f.ImagesCount}
+	}
+
+	dat := make([]byte, uint64(f.MappingCount)*mappingSize)
+	if _, err := r.ReadAt(dat, int64(f.MappingOffset)); err != nil {
+		return nil, &FormatError{int64(f.MappingOffset), "error reading mappings", err}
+	}
+	for i := 0; i < len(dat); i += mappingSize {
+		f.Mappings = append(f.Mappings, Mapping{
+			Address:    bo.Uint64(dat[i:]),
+			Size:       bo.Uint64(dat[i+8:]),
+			FileOffset: bo.Uint64(dat[i+16:]),
+			MaxProt:    bo.Uint32(dat[i+24:]),
+			InitProt:   bo.Uint32(dat[i+28:]),
+		})
+	}
+
+	dat = make([]byte, uint64(f.ImagesCount)*imageInfoSize)
+	if _, err := r.ReadAt(dat, int64(f.ImagesOffset)); err != nil {
+		return nil, &FormatError{int64(f.ImagesOffset), "error reading images", err}
+	}
+	for i := 0; i < len(dat); i += imageInfoSize {
+		img := &Image{
+			Address: bo.Uint64(dat[i:]),
+			ModTime: bo.Uint64(dat[i+8:]),
+			Inode:   bo.Uint64(dat[i+16:]),
+		}
+		pathOff := int64(bo.Uint32(dat[i+24:]))
+		path, err := readCString(r, pathOff)
+		if err != nil {
+			return nil, &FormatError{pathOff, "error reading image path", err}
+		}
+		img.Path = path
+		f.Images = append(f.Images, img)
+	}
+	return f, nil
+}
+
+// Arch returns the architecture the cache was built for, such as "arm64e".
+func (f *File) Arch() string {
+	return strings.TrimSpace(strings.TrimPrefix(f.Magic, "dyld_v1"))
+}
+
+// Image returns the image with the given install path, or nil if the cache
+// has no such image.
+func (f *File) Image(path string) *Image {
+	for _, img := range f.Images {
+		if img.Path == path {
+			return img
+		}
+	}
+	return nil
+}
+
+// offset returns the file offset of the size bytes at addr. ok is false if
+// they are not all in one mapping.
+func (f *File) offset(addr, size uint64) (off uint64, ok bool) {
+	for _, m := range f.Mappings {
+		if addr >= m.Address && addr-m.Address <= m.Size && size <= m.Size-(addr-m.Address) {
+			return m.FileOffset + addr - m.Address, true
+		}
+	}
+	return 0, false
+}
+
+// fits reports whether count entries of entsize bytes at off are inside
+// the cache file.
+func (f *File) fits(off, count, entsize uint64) bool {
+	return off <= f.size && count <= (f.size-off)/entsize
+}
+
+// read returns size bytes of the cache file at off, which must be inside
+// the file, so that corrupt sizes are not allocated.
+func (f *File) read(off, size uint64) ([]byte, error) {
+	if size > 0 && !f.fits(off, size, 1) {
+		return nil, &FormatError{int64(off), "read past the end of the cache", size}
+	}
+	b := make([]byte, size)
+	if _, err := f.r.ReadAt(b, int64(off)); err != nil {
+		return nil, &FormatError{int64(off), "error reading cache", err}
+	}
+	return b, nil
+}
+
+// readAddr returns the size bytes mapped at addr.
+func (f *File) readAddr(addr, size uint64) ([]byte, error) {
+	off, ok := f.offset(addr, size)
+	if !ok {
+		return nil, &FormatError{0, "address is not mapped", fmt.Sprintf("%#x", addr)}
+	}
+	return f.read(off, size)
+}
+
+// readCString reads the NUL terminated string at off.
+func readCString(r io.ReaderAt, off int64) (string, error) {
+	var s []byte
+	buf := make([]byte, 256)
+	for {
+		n, err := r.ReadAt(buf, off)
+		if i := bytes.IndexByte(buf[:n], 0); i >= 0 {
+			return string(append(s, buf[:i]...)), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		s = append(s, buf[:n]...)
+		off += int64(n)
+	}
+}
@@ -0,0 +1,236 @@
+package dsc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/Binject/debug/macho"
+)
+
+const (
+	testPath     = "/usr/lib/libtest.dylib"
+	textAddr     = 0x7fff20000000
+	dataAddr     = 0x7fff80000000
+	linkeditAddr = 0x7fffc0000000
+)
+
+var (
+	testCode   = []byte{0x55, 0x48, 0x89, 0xe5, 0x31, 0xc0, 0x5d, 0xc3}
+	testData   = []byte("testdata")
+	testStarts = []byte{0x80, 0x20, 0x00, 0x00}
+	testTrie   = []byte{0x00, 0x01, 0x5f, 0x66, 0x6f, 0x6f, 0x00, 0x05, 0x00}
+)
+
+// buildCache returns a dyld shared cache holding one x86_64 dylib, which
+// has a local symbol in its own symbol table and two in the cache's local
+// symbols, and a symbol table that begins after the symbols of another
+// image in the shared one.
+func buildCache() []byte {
+	le := binary.LittleEndian
+	cache := make([]byte, 0x5000)
+	copy(cache, "dyld_v1   x86_64")
+
+	// Header, mappings and image list.
+	le.PutUint32(cache[0x10:], 0x1c8)
+	le.PutUint32(cache[0x14:], 3)
+	le.PutUint64(cache[0x48:], 0x5000)
+	copy(cache[0x58:], "0123456789abcdef")
+	le.PutUint32(cache[0x1c0:], 0x228)
+	le.PutUint32(cache[0x1c4:], 1)
+	for i, m := range []Mapping{
+		{textAddr, 0x3000, 0, 5, 5},
+		{dataAddr, 0x1000, 0x3000, 3, 3},
+		{linkeditAddr, 0x1000, 0x4000, 1, 1},
+	} {
+		b := cache[0x1c8+32*i:]
+		le.PutUint64(b, m.Address)
+		le.PutUint64(b[8:], m.Size)
+		le.PutUint64(b[16:], m.FileOffset)
+		le.PutUint32(b[24:], m.MaxProt)
+		le.PutUint32(b[28:], m.InitProt)
+	}
+	le.PutUint64(cache[0x228:], textAddr+0x1000)
+	le.PutUint32(cache[0x228+24:], 0x248)
+	copy(cache[0x248:], testPath+"\x00")
+
+	copy(cache[0x2000:], testCode)
+	copy(cache[0x3000:], testData)
+
+	// The shared __LINKEDIT: strings, two symbols of another image, the
+	// symbols of this one, its indirect symbols and its blobs.
+	strs := []byte(" \x00<redacted>\x00_foo\x00_bar\x00_printf\x00_other\x00")
+	copy(cache[0x4000:], strs)
+	syms := []macho.Nlist64{
+		{Name: uint32(bytes.Index(strs, []byte("_other"))), Type: 0xf, Sect: 1},
+		{Name: uint32(bytes.Index(strs, []byte("_other"))), Type: 0xf, Sect: 1},
+		{Name: uint32(bytes.Index(strs, []byte("<redacted>"))), Type: 0xe, Sect: 1, Value: textAddr + 0x2000},
+		{Name: uint32(bytes.Index(strs, []byte("_foo"))), Type: 0xf, Sect: 1, Value: textAddr + 0x2000},
+		{Name: uint32(bytes.Index(strs, []byte("_bar"))), Type: 0xf, Sect: 2, Value: dataAddr},
+		{Name: uint32(bytes.Index(strs, []byte("_printf"))), Type: 0x1},
+	}
+	var b bytes.Buffer
+	binary.Write(&b, le, syms)
+	copy(cache[0x4100:], b.Bytes())
+	symoff := uint32(0x4100 + 2*16)
+	le.PutUint32(cache[0x4200:], 3)
+	le.PutUint32(cache[0x4204:], 0x80000000)
+	copy(cache[0x4300:], testStarts)
+	copy(cache[0x4400:], testTrie)
+
+	// The image's header and load commands.
+	var cmds bytes.Buffer
+	seg := func(name string, addr, size, off uint64, sects ...macho.Section64) {
+		s := macho.Segment64{Cmd: macho.LoadCmdSegment64, Len: uint32(72 + 80*len(sects)), Addr: addr, Memsz: size, Offset: off, Filesz: size, Nsect: uint32(len(sects))}
+		copy(s.Name[:], name)
+		binary.Write(&cmds, le, s)
+		for _, sect := range sects {
+			copy(sect.Seg[:], name)
+			binary.Write(&cmds, le, sect)
+		}
+	}
+	text := macho.Section64{Addr: textAddr + 0x2000, Size: uint64(len(testCode)), Offset: 0x2000}
+	copy(text.Name[:], "__text")
+	data := macho.Section64{Addr: dataAddr, Size: uint64(len(testData)), Offset: 0x3000}
+	copy(data.Name[:], "__data")
+	seg("__TEXT", textAddr+0x1000, 0x2000, 0x1000, text)
+	seg("__DATA", dataAddr, 0x1000, 0x3000, data)
+	seg("__LINKEDIT", linkeditAddr, 0x1000, 0x4000)
+	name := testPath + "\x00\x00"
+	binary.Write(&cmds, le, macho.DylibCmd{Cmd: macho.LoadCmdDylib | 1, Len: uint32(24 + len(name)), Name: 24})
+	cmds.WriteString(name)
+	binary.Write(&cmds, le, macho.SymtabCmd{Cmd: macho.LoadCmdSymtab, Len: 24, Symoff: symoff, Nsyms: 4, Stroff: 0x4000, Strsize: uint32(len(strs))})
+	binary.Write(&cmds, le, macho.DysymtabCmd{Cmd: macho.LoadCmdDysymtab, Len: 80,
+		Ilocalsym: 0, Nlocalsym: 1, Iextdefsym: 1, Nextdefsym: 2, Iundefsym: 3, Nundefsym: 1,
+		Indirectsymoff: 0x4200, Nindirectsyms: 2})
+	binary.Write(&cmds, le, macho.DylinkInfoCmd{Cmd: macho.LoadCmdDylinkInfo, Len: 48, Exportinfooff: 0x4400, Exportinfosize: uint32(len(testTrie))})
+	binary.Write(&cmds, le, macho.FuncStartsCmd{Cmd: macho.LoadCmdFuncStarts, Len: 16, Dataoff: 0x4300, Datasize: uint32(len(testStarts))})
+	var hdr bytes.Buffer
+	binary.Write(&hdr, le, macho.FileHeader{Magic: macho.Magic64, Cpu: macho.CpuAmd64, SubCpu: 3, Type: macho.TypeDylib, Ncmd: 8, Cmdsz: uint32(cmds.Len()), Flags: 0x80000000 | 0x100000})
+	hdr.Write([]byte{0, 0, 0, 0})
+	copy(cache[0x1000:], append(hdr.Bytes(), cmds.Bytes()...))
+
+	// The local symbols, with one of another image first.
+	strs = []byte(" \x00_static0\x00_static1\x00_static2\x00")
+	info := make([]byte, 24)
+	le.PutUint32(info, 24)
+	le.PutUint32(info[4:], 3)
+	le.PutUint32(info[8:], 24+3*16)
+	le.PutUint32(info[12:], uint32(len(strs)))
+	le.PutUint32(info[16:], 24+3*16+uint32(len(strs)))
+	le.PutUint32(info[20:], 2)
+	b.Reset()
+	b.Write(info)
+	for i := 0; i < 3; i++ {
+		binary.Write(&b, le, macho.Nlist64{Name: uint32(bytes.Index(strs, []byte("_static"))) + 9*uint32(i), Type: 0xe, Sect: 1, Value: textAddr + 0x2000})
+	}
+	b.Write(strs)
+	binary.Write(&b, le, []struct {
+		DylibOffset     uint64
+		NlistStartIndex uint32
+		NlistCount      uint32
+	}{{0x10000, 0, 1}, {0x1000, 1, 2}})
+	le.PutUint64(cache[0x50:], uint64(b.Len()))
+	return append(cache, b.Bytes()...)
+}
+
+func TestNewFile(t *testing.T) {
+	f, err := NewFile(bytes.NewReader(buildCache()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Arch(); got != "x86_64" {
+		t.Errorf("Arch = %q, want x86_64", got)
+	}
+	if len(f.Mappings) != 3 || f.Mappings[1].Address != dataAddr || f.Mappings[1].FileOffset != 0x3000 {
+		t.Errorf("wrong mappings %+v", f.Mappings)
+	}
+	if string(f.UUID[:]) != "0123456789abcdef" {
+		t.Errorf("UUID = %x", f.UUID)
+	}
+	img := f.Image(testPath)
+	if img == nil || len(f.Images) != 1 || img.Address != textAddr+0x1000 {
+		t.Fatalf("wrong images %+v", f.Images)
+	}
+	if f.Image("/usr/lib/libmissing.dylib") != nil {
+		t.Error("found an image that is not in the cache")
+	}
+
+	if _, err := NewFile(bytes.NewReader(make([]byte, 0x1000))); err == nil {
+		t.Error("NewFile accepted a file without a cache header")
+	}
+
+	// Counts that the file is too small for are refused before the
+	// tables are allocated.
+	small := make([]byte, 64)
+	copy(small, "dyld_v1   x86_64")
+	binary.LittleEndian.PutUint32(small[0x10:], 0x20)
+	binary.LittleEndian.PutUint32(small[0x14:], 0xffffffff)
+	if _, err := NewFile(bytes.NewReader(small)); err == nil {
+		t.Error("NewFile accepted a mapping count past the end of the file")
+	}
+	big := buildCache()
+	binary.LittleEndian.PutUint32(big[0x1c4:], 0xffffffff)
+	if _, err := NewFile(bytes.NewReader(big)); err == nil {
+		t.Error("NewFile accepted an image count past the end of the file")
+	}
+	if _, err := f.read(f.LocalSymbolsOffset, 1<<40); err == nil {
+		t.Error("read allocated a size past the end of the file")
+	}
+}
+
+func TestExtract(t *testing.T) {
+	f, err := NewFile(bytes.NewReader(buildCache()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := f.Extract(f.Image(testPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Type != macho.TypeDylib || g.Flags&mhDylibInCache != 0 {
+		t.Errorf("header is %+v", g.FileHeader)
+	}
+	for _, tt := range []struct {
+		name string
+		want []byte
+	}{{"__text", testCode}, {"__data", testData}} {
+		if got, err := g.Section(tt.name).Data(); err != nil || !bytes.Equal(got, tt.want) {
+			t.Errorf("%s = %x, %v; want %x", tt.name, got, err, tt.want)
+		}
+	}
+	var prev *macho.Segment
+	for _, name := range []string{"__TEXT", "__DATA", "__LINKEDIT"} {
+		s := g.Segment(name)
+		if s.Offset%0x1000 != 0 || (prev != nil && s.Offset < prev.Offset+prev.Filesz) {
+			t.Errorf("%s is at %#x", name, s.Offset)
+		}
+		prev = s
+	}
+
+	var names []string
+	for _, s := range g.Symtab.Syms {
+		names = append(names, s.Name)
+	}
+	if want := []string{"_static1", "_static2", "_foo", "_bar", "_printf"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("symbols are %q, want %q", names, want)
+	}
+	d := g.Dysymtab
+	if d.Nlocalsym != 2 || d.Iextdefsym != 2 || d.Nextdefsym != 2 || d.Iundefsym != 4 || d.Nundefsym != 1 {
+		t.Errorf("wrong dysymtab %+v", d.DysymtabCmd)
+	}
+	if want := []uint32{4, indirectSymbolLocal}; !reflect.DeepEqual(d.IndirectSyms, want) {
+		t.Errorf("indirect symbols are %#x, want %#x", d.IndirectSyms, want)
+	}
+	if !bytes.Equal(g.FuncStarts.RawDat, testStarts) {
+		t.Errorf("function starts are %x, want %x", g.FuncStarts.RawDat, testStarts)
+	}
+	if !bytes.Equal(g.DylinkInfo.ExportInfoDat, testTrie) {
+		t.Errorf("export trie is %x, want %x", g.DylinkInfo.ExportInfoDat, testTrie)
+	}
+	le := g.Segment("__LINKEDIT")
+	if end := le.Offset + le.Filesz; g.Symtab.Stroff+g.Symtab.Strsize > uint32(end) {
+		t.Errorf("string table ends past __LINKEDIT at %#x", end)
+	}
+}
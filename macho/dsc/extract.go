@@ -0,0 +1,423 @@
+package dsc
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/Binject/debug/macho"
+)
+
+// Load commands that point into __LINKEDIT and are not named by the macho
+// package.
+const (
+	lcDyldInfo               macho.LoadCmd = 0x22
+	lcSegmentSplitInfo       macho.LoadCmd = 0x1e
+	lcDylibCodeSignDrs       macho.LoadCmd = 0x2b
+	lcLinkerOptimizationHint macho.LoadCmd = 0x2e
+	lcDyldExportsTrie        macho.LoadCmd = 0x80000033
+	lcDyldChainedFixups      macho.LoadCmd = 0x80000034
+)
+
+const (
+	mhDylibInCache = 0x80000000 // MH_DYLIB_IN_CACHE header flag
+
+	indirectSymbolLocal = 0x80000000 // INDIRECT_SYMBOL_LOCAL
+	indirectSymbolAbs   = 0x40000000 // INDIRECT_SYMBOL_ABS
+
+	// Caches whose header reaches symbolFileUUID use 64-bit local symbol
+	// entries that locate their dylib by its offset from the cache's
+	// base address instead of its file offset.
+	symbolFileUUIDOffset = 0x190
+)
+
+// A segment is a segment load command of an image being extracted.
+type segment struct {
+	cmd    []byte
+	name   string
+	addr   uint64
+	filesz uint64
+}
+
+// Extract returns img as a standalone Mach-O file. Its segments are copied
+// out of the cache's mappings and laid out one after the other, and its
+// __LINKEDIT is rebuilt from the cache's shared one with just the data of
+// img: its symbols, including the local symbols that the cache keeps
+// apart, its indirect symbol table, and the blobs of its dyld info and
+// other LINKEDIT load commands.
+//
+// The contents of the other segments are copied as they are: pointers keep
+// the cache's encoding, and references into other images and into the
+// cache's Objective-C optimizations are not undone.
+func (f *File) Extract(img *Image) (*macho.File, error) {
+	b, err := f.extract(img)
+	if err != nil {
+		return nil, err
+	}
+	return macho.NewFile(bytes.NewReader(b))
+}
+
+func (f *File) extract(img *Image) ([]byte, error) {
+	bo := binary.LittleEndian
+	hdr, err := f.readAddr(img.Address, 28)
+	if err != nil {
+		return nil, err
+	}
+	var hdrSize int
+	w := 4 // size of the address fields of segment commands
+	switch bo.Uint32(hdr) {
+	case macho.Magic32:
+		hdrSize = 28
+	case macho.Magic64:
+		hdrSize, w = 32, 8
+	default:
+		return nil, &FormatError{int64(img.Address), "image has an invalid Mach-O magic number", img.Path}
+	}
+	pageSize := uint64(0x1000)
+	if cpu := macho.Cpu(bo.Uint32(hdr[4:])); cpu == macho.CpuArm || cpu == macho.CpuArm64 {
+		pageSize = 0x4000
+	}
+	ncmd := bo.Uint32(hdr[16:])
+	all, err := f.readAddr(img.Address, uint64(hdrSize)+uint64(bo.Uint32(hdr[20:])))
+	if err != nil {
+		return nil, err
+	}
+	getw := func(b []byte) uint64 {
+		if w == 4 {
+			return uint64(bo.Uint32(b))
+		}
+		return bo.Uint64(b)
+	}
+	putw := func(b []byte, v uint64) {
+		if w == 4 {
+			bo.PutUint32(b, uint32(v))
+		} else {
+			bo.PutUint64(b, v)
+		}
+	}
+
+	// Find the load commands to rewrite. They are edited in place in all.
+	var segs []*segment
+	var linkedit *segment
+	var symtab, dysymtab, dyldInfo []byte
+	var linkeditData [][]byte
+	cmds := all[hdrSize:]
+	for i, off := uint32(0), 0; i < ncmd; i++ {
+		if off+8 > len(cmds) {
+			return nil, &FormatError{int64(img.Address), "load commands are truncated", img.Path}
+		}
+		cmd, n := macho.LoadCmd(bo.Uint32(cmds[off:])), int(bo.Uint32(cmds[off+4:]))
+		if n < 8 || n > len(cmds)-off {
+			return nil, &FormatError{int64(img.Address), "invalid load command size", n}
+		}
+		c := cmds[off : off+n]
+		off += n
+		min := 16
+		switch cmd {
+		case macho.LoadCmdSegment, macho.LoadCmdSegment64:
+			if (cmd == macho.LoadCmdSegment) != (w == 4) {
+				continue
+			}
+			if min = 24 + 4*w + 16; n < min {
+				break
+			}
+			s := &segment{cmd: c, name: string(bytes.TrimRight(c[8:24], "\x00")), addr: getw(c[24:]), filesz: getw(c[24+3*w:])}
+			if s.name == "__LINKEDIT" {
+				linkedit = s
+			} else {
+				segs = append(segs, s)
+			}
+		case macho.LoadCmdSymtab:
+			min, symtab = 24, c
+		case macho.LoadCmdDysymtab:
+			min, dysymtab = 80, c
+		case macho.LoadCmdDylinkInfo, lcDyldInfo:
+			min, dyldInfo = 48, c
+		case macho.LoadCmdSignature, lcSegmentSplitInfo, macho.LoadCmdFuncStarts, macho.LoadCmdDataInCode,
+			lcDylibCodeSignDrs, lcLinkerOptimizationHint, lcDyldExportsTrie, lcDyldChainedFixups:
+			linkeditData = append(linkeditData, c)
+		}
+		if n < min {
+			return nil, &FormatError{int64(img.Address), "load command is too short", cmd}
+		}
+	}
+
+	// Lay the segments out in load command order, starting with the one
+	// holding the Mach-O header.
+	var out []byte
+	for _, s := range segs {
+		fileoff := uint64(0)
+		if s.filesz > 0 {
+			if len(out) == 0 && (s.addr != img.Address || s.filesz < uint64(len(all))) {
+				return nil, &FormatError{int64(img.Address), "first segment does not hold the Mach-O header", s.name}
+			}
+			fileoff = alignUp(uint64(len(out)), pageSize)
+			data, err := f.readAddr(s.addr, s.filesz)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, make([]byte, fileoff-uint64(len(out)))...)
+			out = append(out, data...)
+		}
+		putw(s.cmd[24+2*w:], fileoff)
+		nsect := int(bo.Uint32(s.cmd[24+4*w+8:]))
+		sectSize := 68
+		if w == 8 {
+			sectSize = 80
+		}
+		for i, sect := 0, s.cmd[24+4*w+16:]; i < nsect && len(sect) >= sectSize; i, sect = i+1, sect[sectSize:] {
+			if bo.Uint32(sect[32+2*w:]) != 0 {
+				bo.PutUint32(sect[32+2*w:], uint32(fileoff+getw(sect[32:])-s.addr))
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil, &FormatError{int64(img.Address), "image has no segment with file contents", img.Path}
+	}
+
+	// Rebuild __LINKEDIT.
+	base := alignUp(uint64(len(out)), pageSize)
+	var link []byte
+	pad := func(align int) {
+		for len(link)%align != 0 {
+			link = append(link, 0)
+		}
+	}
+	copyBlob := func(off, size []byte) error {
+		if bo.Uint32(size) == 0 {
+			bo.PutUint32(off, 0)
+			return nil
+		}
+		data, err := f.read(uint64(bo.Uint32(off)), uint64(bo.Uint32(size)))
+		if err != nil {
+			return err
+		}
+		pad(8)
+		bo.PutUint32(off, uint32(base)+uint32(len(link)))
+		link = append(link, data...)
+		return nil
+	}
+	if dyldInfo != nil {
+		for i := 8; i < 48; i += 8 {
+			if err := copyBlob(dyldInfo[i:], dyldInfo[i+4:]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, c := range linkeditData {
+		if err := copyBlob(c[8:], c[12:]); err != nil {
+			return nil, err
+		}
+	}
+	if symtab != nil {
+		if link, err = f.extractSymtab(img, symtab, dysymtab, link, base, w); err != nil {
+			return nil, err
+		}
+	}
+	if linkedit == nil {
+		if len(link) > 0 {
+			return nil, &FormatError{int64(img.Address), "image has no __LINKEDIT segment", img.Path}
+		}
+	} else {
+		putw(linkedit.cmd[24+w:], alignUp(uint64(len(link)), pageSize))
+		putw(linkedit.cmd[24+2*w:], base)
+		putw(linkedit.cmd[24+3*w:], uint64(len(link)))
+		out = append(out, make([]byte, base-uint64(len(out)))...)
+		out = append(out, link...)
+	}
+
+	bo.PutUint32(all[24:], bo.Uint32(all[24:])&^mhDylibInCache)
+	copy(out, all)
+	return out, nil
+}
+
+// extractSymtab appends the symbol table, indirect symbol table and string
+// table of img to link, whose first byte is at file offset base, and points
+// its symtab and dysymtab load commands at them. Local symbols are taken
+// from the cache's local symbols when it has them for img.
+func (f *File) extractSymtab(img *Image, symtab, dysymtab, link []byte, base uint64, w int) ([]byte, error) {
+	bo := binary.LittleEndian
+	entSize := uint64(8 + w) // nlist or nlist_64
+	symoff, nsyms := uint64(bo.Uint32(symtab[8:])), uint64(bo.Uint32(symtab[12:]))
+	syms, err := f.read(symoff, nsyms*entSize)
+	if err != nil {
+		return nil, err
+	}
+	strs, err := f.read(uint64(bo.Uint32(symtab[16:])), uint64(bo.Uint32(symtab[20:])))
+	if err != nil {
+		return nil, err
+	}
+
+	var newSyms []byte
+	strtab := []byte{' ', 0}
+	strIndex := make(map[string]uint32)
+	appendSyms := func(ents, pool []byte) error {
+		for ; uint64(len(ents)) >= entSize; ents = ents[entSize:] {
+			strx := bo.Uint32(ents)
+			if uint64(strx) >= uint64(len(pool)) {
+				return &FormatError{int64(symoff), "symbol name is out of range", strx}
+			}
+			name := pool[strx:]
+			if i := bytes.IndexByte(name, 0); i >= 0 {
+				name = name[:i]
+			}
+			idx, ok := strIndex[string(name)]
+			if !ok {
+				idx = uint32(len(strtab))
+				strIndex[string(name)] = idx
+				strtab = append(append(strtab, name...), 0)
+			}
+			ent := append([]byte(nil), ents[:entSize]...)
+			bo.PutUint32(ent, idx)
+			newSyms = append(newSyms, ent...)
+		}
+		return nil
+	}
+	section := func(i, n uint32) []byte {
+		if uint64(i)+uint64(n) > nsyms {
+			return nil
+		}
+		return syms[uint64(i)*entSize : uint64(i+n)*entSize]
+	}
+
+	var ind []byte
+	if dysymtab == nil {
+		if err := appendSyms(syms, strs); err != nil {
+			return nil, err
+		}
+	} else {
+		ilocal, nlocal := bo.Uint32(dysymtab[8:]), bo.Uint32(dysymtab[12:])
+		iext, next := bo.Uint32(dysymtab[16:]), bo.Uint32(dysymtab[20:])
+		iundef, nundef := bo.Uint32(dysymtab[24:]), bo.Uint32(dysymtab[28:])
+		locals, localStrs, ok, err := f.localSymbols(img, entSize)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			locals, localStrs = section(ilocal, nlocal), strs
+		}
+		if err := appendSyms(locals, localStrs); err != nil {
+			return nil, err
+		}
+		newLocal := uint32(uint64(len(newSyms)) / entSize)
+		if err := appendSyms(section(iext, next), strs); err != nil {
+			return nil, err
+		}
+		if err := appendSyms(section(iundef, nundef), strs); err != nil {
+			return nil, err
+		}
+
+		// The indirect symbol table indexes the symbol table, whose
+		// local symbols may have changed.
+		if ind, err = f.read(uint64(bo.Uint32(dysymtab[56:])), 4*uint64(bo.Uint32(dysymtab[60:]))); err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(ind); i += 4 {
+			switch sym := bo.Uint32(ind[i:]); {
+			case sym&(indirectSymbolLocal|indirectSymbolAbs) != 0:
+			case sym >= iext && sym-iext < next:
+				bo.PutUint32(ind[i:], newLocal+sym-iext)
+			case sym >= iundef && sym-iundef < nundef:
+				bo.PutUint32(ind[i:], newLocal+next+sym-iundef)
+			case !ok && sym >= ilocal && sym-ilocal < nlocal:
+				bo.PutUint32(ind[i:], sym-ilocal)
+			default:
+				bo.PutUint32(ind[i:], indirectSymbolLocal)
+			}
+		}
+
+		// The cache's images have no table of contents, module table or
+		// external and local relocations.
+		for i := 8; i < 80; i += 4 {
+			bo.PutUint32(dysymtab[i:], 0)
+		}
+		bo.PutUint32(dysymtab[12:], newLocal)
+		bo.PutUint32(dysymtab[16:], newLocal)
+		bo.PutUint32(dysymtab[20:], next)
+		bo.PutUint32(dysymtab[24:], newLocal+next)
+		bo.PutUint32(dysymtab[28:], nundef)
+	}
+
+	pad := func() {
+		for len(link)%w != 0 {
+			link = append(link, 0)
+		}
+	}
+	pad()
+	bo.PutUint32(symtab[8:], uint32(base)+uint32(len(link)))
+	bo.PutUint32(symtab[12:], uint32(uint64(len(newSyms))/entSize))
+	link = append(link, newSyms...)
+	if len(ind) > 0 {
+		bo.PutUint32(dysymtab[56:], uint32(base)+uint32(len(link)))
+		bo.PutUint32(dysymtab[60:], uint32(len(ind)/4))
+		link = append(link, ind...)
+	}
+	bo.PutUint32(symtab[16:], uint32(base)+uint32(len(link)))
+	bo.PutUint32(symtab[20:], uint32(len(strtab)))
+	link = append(link, strtab...)
+	pad()
+	return link, nil
+}
+
+// localSymbols returns the local symbols of img and the strings they name
+// from the cache's local symbols, which are kept apart from the images'
+// symbol tables. ok is false if the cache has none for img.
+func (f *File) localSymbols(img *Image, entSize uint64) (syms, strs []byte, ok bool, err error) {
+	if f.LocalSymbolsOffset == 0 || f.LocalSymbolsSize < 24 {
+		return nil, nil, false, nil
+	}
+	bo := binary.LittleEndian
+	info, err := f.read(f.LocalSymbolsOffset, 24)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	nlistOff, nlistCount := uint64(bo.Uint32(info)), uint64(bo.Uint32(info[4:]))
+	stringsOff, stringsSize := uint64(bo.Uint32(info[8:])), uint64(bo.Uint32(info[12:]))
+	entriesOff, entriesCount := uint64(bo.Uint32(info[16:])), uint64(bo.Uint32(info[20:]))
+
+	entry64 := f.MappingOffset >= symbolFileUUIDOffset
+	var dylibOffset uint64
+	if entry64 {
+		if len(f.Mappings) == 0 {
+			return nil, nil, false, nil
+		}
+		dylibOffset = img.Address - f.Mappings[0].Address
+	} else if dylibOffset, ok = f.offset(img.Address, 0); !ok {
+		return nil, nil, false, nil
+	}
+	entrySize := uint64(12)
+	if entry64 {
+		entrySize = 16
+	}
+	entries, err := f.read(f.LocalSymbolsOffset+entriesOff, entriesCount*entrySize)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	for e := entries; uint64(len(e)) >= entrySize; e = e[entrySize:] {
+		var off uint64
+		var start, count uint32
+		if entry64 {
+			off, start, count = bo.Uint64(e), bo.Uint32(e[8:]), bo.Uint32(e[12:])
+		} else {
+			off, start, count = uint64(bo.Uint32(e)), bo.Uint32(e[4:]), bo.Uint32(e[8:])
+		}
+		if off != dylibOffset {
+			continue
+		}
+		if uint64(start)+uint64(count) > nlistCount {
+			return nil, nil, false, &FormatError{int64(f.LocalSymbolsOffset), "local symbols are out of range", img.Path}
+		}
+		if syms, err = f.read(f.LocalSymbolsOffset+nlistOff+uint64(start)*entSize, uint64(count)*entSize); err != nil {
+			return nil, nil, false, err
+		}
+		if strs, err = f.read(f.LocalSymbolsOffset+stringsOff, stringsSize); err != nil {
+			return nil, nil, false, err
+		}
+		return syms, strs, true, nil
+	}
+	return nil, nil, false, nil
+}
+
+// alignUp rounds v up to the next multiple of align, a power of two.
+func alignUp(v, align uint64) uint64 {
+	return (v + align - 1) &^ (align - 1)
+}
@@ -0,0 +1,624 @@
+package macho
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Rebase types.
+const (
+	RebaseTypePointer        uint8 = 1
+	RebaseTypeTextAbsolute32 uint8 = 2
+	RebaseTypeTextPCRel32    uint8 = 3
+)
+
+// Bind types.
+const (
+	BindTypePointer        uint8 = 1
+	BindTypeTextAbsolute32 uint8 = 2
+	BindTypeTextPCRel32    uint8 = 3
+)
+
+// Special dylib ordinals of a Bind.
+const (
+	BindSpecialDylibSelf           = 0
+	BindSpecialDylibMainExecutable = -1
+	BindSpecialDylibFlatLookup     = -2
+	BindSpecialDylibWeakLookup     = -3
+)
+
+// Bind symbol flags.
+const (
+	BindSymbolFlagsWeakImport        uint8 = 0x1
+	BindSymbolFlagsNonWeakDefinition uint8 = 0x8
+)
+
+const (
+	rebaseOpcodeMask                         = 0xf0
+	rebaseImmediateMask                      = 0x0f
+	rebaseOpcodeDone                         = 0x00
+	rebaseOpcodeSetTypeImm                   = 0x10
+	rebaseOpcodeSetSegmentAndOffsetULEB      = 0x20
+	rebaseOpcodeAddAddrULEB                  = 0x30
+	rebaseOpcodeAddAddrImmScaled             = 0x40
+	rebaseOpcodeDoRebaseImmTimes             = 0x50
+	rebaseOpcodeDoRebaseULEBTimes            = 0x60
+	rebaseOpcodeDoRebaseAddAddrULEB          = 0x70
+	rebaseOpcodeDoRebaseULEBTimesSkipingULEB = 0x80
+
+	bindOpcodeMask                        = 0xf0
+	bindImmediateMask                     = 0x0f
+	bindOpcodeDone                        = 0x00
+	bindOpcodeSetDylibOrdinalImm          = 0x10
+	bindOpcodeSetDylibOrdinalULEB         = 0x20
+	bindOpcodeSetDylibSpecialImm          = 0x30
+	bindOpcodeSetSymbolTrailingFlagsImm   = 0x40
+	bindOpcodeSetTypeImm                  = 0x50
+	bindOpcodeSetAddendSLEB               = 0x60
+	bindOpcodeSetSegmentAndOffsetULEB     = 0x70
+	bindOpcodeAddAddrULEB                 = 0x80
+	bindOpcodeDoBind                      = 0x90
+	bindOpcodeDoBindAddAddrULEB           = 0xa0
+	bindOpcodeDoBindAddAddrImmScaled      = 0xb0
+	bindOpcodeDoBindULEBTimesSkippingULEB = 0xc0
+	bindOpcodeThreaded                    = 0xd0
+
+	bindSubopcodeThreadedSetBindOrdinalTableSizeULEB = 0x00
+	bindSubopcodeThreadedApply                       = 0x01
+)
+
+// A Rebase is a pointer that dyld slides when the image is not loaded at
+// its preferred address.
+type Rebase struct {
+	Segment int    // index of the segment among the segment load commands
+	Offset  uint64 // offset of the pointer in the segment
+	Type    uint8
+}
+
+// A Bind is a pointer that dyld sets to the address of a symbol in this
+// or another image.
+type Bind struct {
+	Segment int    // index of the segment among the segment load commands
+	Offset  uint64 // offset of the pointer in the segment
+	Type    uint8
+	Symbol  string
+	Flags   uint8
+	Ordinal int // dylib ordinal, or one of the BindSpecialDylib values
+	Addend  int64
+
+	// InfoOffset is the offset of the entry in the lazy binding info,
+	// which the stub helper in __TEXT refers to. It is zero for other
+	// binds.
+	InfoOffset uint64
+}
+
+// segments returns the segment load commands in the order that dyld
+// numbers them.
+func (f *File) segments() []*Segment {
+	var segs []*Segment
+	for _, l := range f.Loads {
+		if s, ok := l.(*Segment); ok {
+			segs = append(segs, s)
+		}
+	}
+	return segs
+}
+
+// RebaseAddr returns the virtual address of the pointer r slides.
+func (f *File) RebaseAddr(r Rebase) (uint64, error) {
+	return f.segmentAddr(r.Segment, r.Offset)
+}
+
+// BindAddr returns the virtual address of the pointer b binds.
+func (f *File) BindAddr(b Bind) (uint64, error) {
+	return f.segmentAddr(b.Segment, b.Offset)
+}
+
+// segmentSizes returns the sizes in memory of the segments of f, in the
+// order that dyld numbers them, which bound the offsets of dyld info.
+func (f *File) segmentSizes() []uint64 {
+	var sizes []uint64
+	for _, s := range f.segments() {
+		sizes = append(sizes, s.Memsz)
+	}
+	return sizes
+}
+
+func (f *File) segmentAddr(seg int, off uint64) (uint64, error) {
+	segs := f.segments()
+	if seg < 0 || seg >= len(segs) {
+		return 0, fmt.Errorf("segment index %d out of range", seg)
+	}
+	if off >= segs[seg].Memsz {
+		return 0, fmt.Errorf("offset %#x is outside of segment %s", off, segs[seg].Name)
+	}
+	return segs[seg].Addr + off, nil
+}
+
+// Rebases decodes the rebase opcodes of the LC_DYLD_INFO load command.
+func (f *File) Rebases() ([]Rebase, error) {
+	if f.DylinkInfo == nil {
+		return nil, nil
+	}
+	return decodeRebases(f.DylinkInfo.RebaseDat, f.ptrSize(), f.segmentSizes())
+}
+
+// Binds decodes the binding opcodes of the LC_DYLD_INFO load command.
+func (f *File) Binds() ([]Bind, error) {
+	if f.DylinkInfo == nil {
+		return nil, nil
+	}
+	return decodeBinds(f.DylinkInfo.BindingInfoDat, f.ptrSize(), f.segmentSizes(), false)
+}
+
+// WeakBinds decodes the weak binding opcodes of the LC_DYLD_INFO load
+// command. Entries that only mark a strong definition of a weak symbol
+// and bind nothing are left out.
+func (f *File) WeakBinds() ([]Bind, error) {
+	if f.DylinkInfo == nil {
+		return nil, nil
+	}
+	return decodeBinds(f.DylinkInfo.WeakBindingDat, f.ptrSize(), f.segmentSizes(), false)
+}
+
+// LazyBinds decodes the lazy binding opcodes of the LC_DYLD_INFO load
+// command.
+func (f *File) LazyBinds() ([]Bind, error) {
+	if f.DylinkInfo == nil {
+		return nil, nil
+	}
+	return decodeBinds(f.DylinkInfo.LazyBindingDat, f.ptrSize(), f.segmentSizes(), true)
+}
+
+// SetRebases replaces the rebase opcodes with an encoding of rebases.
+// The encoding must fit in the space of the existing opcodes. Images
+// with threaded binding info, whose rebases are chained through the
+// data, are refused.
+func (f *File) SetRebases(rebases []Rebase) error {
+	if f.DylinkInfo == nil {
+		return errors.New("file has no dyld info")
+	}
+	if f.hasThreadedBinds() {
+		return fmt.Errorf("cannot set rebases: %v", errThreadedBinds)
+	}
+	dat, err := storeDyldInfo(EncodeRebases(rebases, f.ptrSize()), f.DylinkInfo.RebaseLen, "rebase")
+	if err != nil {
+		return err
+	}
+	f.DylinkInfo.RebaseDat = dat
+	return nil
+}
+
+// SetBinds replaces the binding opcodes with an encoding of binds. The
+// encoding must fit in the space of the existing opcodes. Threaded
+// binding info is not replaced, as that would orphan its pointer chains.
+func (f *File) SetBinds(binds []Bind) error {
+	if f.DylinkInfo == nil {
+		return errors.New("file has no dyld info")
+	}
+	if f.hasThreadedBinds() {
+		return fmt.Errorf("cannot set binds: %v", errThreadedBinds)
+	}
+	dat, err := storeDyldInfo(EncodeBinds(binds, f.ptrSize()), f.DylinkInfo.BindingInfoLen, "binding")
+	if err != nil {
+		return err
+	}
+	f.DylinkInfo.BindingInfoDat = dat
+	return nil
+}
+
+// SetWeakBinds replaces the weak binding opcodes with an encoding of
+// binds. The encoding must fit in the space of the existing opcodes.
+// Markers of strong definitions, which WeakBinds leaves out, are not
+// kept.
+func (f *File) SetWeakBinds(binds []Bind) error {
+	if f.DylinkInfo == nil {
+		return errors.New("file has no dyld info")
+	}
+	dat, err := storeDyldInfo(EncodeBinds(binds, f.ptrSize()), f.DylinkInfo.WeakBindingLen, "weak binding")
+	if err != nil {
+		return err
+	}
+	f.DylinkInfo.WeakBindingDat = dat
+	return nil
+}
+
+// storeDyldInfo pads dat with DONE opcodes to the size of the existing
+// info, which the writer keeps.
+func storeDyldInfo(dat []byte, size uint32, what string) ([]byte, error) {
+	if uint64(len(dat)) > uint64(size) {
+		return nil, fmt.Errorf("%s info needs %d bytes, only %d available", what, len(dat), size)
+	}
+	return append(dat, make([]byte, int(size)-len(dat))...), nil
+}
+
+// An opcodeReader reads the operands of dyld info opcodes.
+type opcodeReader struct {
+	dat []byte
+	off int
+	err error
+}
+
+func (r *opcodeReader) uleb() uint64 {
+	var v uint64
+	var shift uint
+	for {
+		if r.off >= len(r.dat) {
+			r.fail("truncated ULEB128")
+			return 0
+		}
+		b := r.dat[r.off]
+		r.off++
+		if shift < 64 {
+			v |= uint64(b&0x7f) << shift
+		}
+		shift += 7
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+}
+
+func (r *opcodeReader) sleb() int64 {
+	var v int64
+	var shift uint
+	for {
+		if r.off >= len(r.dat) {
+			r.fail("truncated SLEB128")
+			return 0
+		}
+		b := r.dat[r.off]
+		r.off++
+		if shift < 64 {
+			v |= int64(b&0x7f) << shift
+		}
+		shift += 7
+		if b&0x80 == 0 {
+			if shift < 64 && b&0x40 != 0 {
+				v |= -1 << shift
+			}
+			return v
+		}
+	}
+}
+
+func (r *opcodeReader) cstring() string {
+	i := bytes.IndexByte(r.dat[r.off:], 0)
+	if i < 0 {
+		r.fail("unterminated symbol name")
+		return ""
+	}
+	s := string(r.dat[r.off : r.off+i])
+	r.off += i + 1
+	return s
+}
+
+func (r *opcodeReader) fail(msg string) {
+	if r.err == nil {
+		r.err = fmt.Errorf("dyld info at offset %#x: %s", r.off, msg)
+	}
+	r.off = len(r.dat)
+}
+
+// inSegment reports whether off is an offset in segment seg, whose
+// sizes segSizes gives, failing r if it is not.
+func (r *opcodeReader) inSegment(segSizes []uint64, seg int, off uint64) bool {
+	if seg < 0 || seg >= len(segSizes) {
+		r.fail(fmt.Sprintf("segment index %d out of range", seg))
+		return false
+	}
+	if off >= segSizes[seg] {
+		r.fail(fmt.Sprintf("offset %#x is outside of segment %d", off, seg))
+		return false
+	}
+	return true
+}
+
+// count reads the ULEB128 repeat count of an opcode that steps through
+// segment seg, failing r if it is more than the pointers the segment
+// holds, so that no count makes a decoder loop past the file.
+func (r *opcodeReader) count(segSizes []uint64, seg int, ptrSize int) uint64 {
+	n := r.uleb()
+	if r.err != nil || !r.inSegment(segSizes, seg, 0) {
+		return 0
+	}
+	if n > segSizes[seg]/uint64(ptrSize) {
+		r.fail(fmt.Sprintf("repeat count %d exceeds the pointers of segment %d", n, seg))
+		return 0
+	}
+	return n
+}
+
+// decodeRebases decodes a rebase opcode stream for an image whose
+// segments have the sizes segSizes.
+func decodeRebases(dat []byte, ptrSize int, segSizes []uint64) ([]Rebase, error) {
+	var rebases []Rebase
+	r := &opcodeReader{dat: dat}
+	var typ uint8
+	seg := -1
+	var off uint64
+	rebase := func() {
+		if seg < 0 {
+			r.fail("rebase before segment is set")
+			return
+		}
+		if !r.inSegment(segSizes, seg, off) {
+			return
+		}
+		rebases = append(rebases, Rebase{Segment: seg, Offset: off, Type: typ})
+	}
+	for r.off < len(dat) {
+		b := dat[r.off]
+		r.off++
+		imm := b & rebaseImmediateMask
+		switch b & rebaseOpcodeMask {
+		case rebaseOpcodeDone:
+			return rebases, r.err
+		case rebaseOpcodeSetTypeImm:
+			typ = imm
+		case rebaseOpcodeSetSegmentAndOffsetULEB:
+			seg = int(imm)
+			off = r.uleb()
+		case rebaseOpcodeAddAddrULEB:
+			off += r.uleb()
+		case rebaseOpcodeAddAddrImmScaled:
+			off += uint64(imm) * uint64(ptrSize)
+		case rebaseOpcodeDoRebaseImmTimes:
+			for i := 0; i < int(imm) && r.err == nil; i++ {
+				rebase()
+				off += uint64(ptrSize)
+			}
+		case rebaseOpcodeDoRebaseULEBTimes:
+			for n := r.count(segSizes, seg, ptrSize); n > 0 && r.err == nil; n-- {
+				rebase()
+				off += uint64(ptrSize)
+			}
+		case rebaseOpcodeDoRebaseAddAddrULEB:
+			rebase()
+			off += r.uleb() + uint64(ptrSize)
+		case rebaseOpcodeDoRebaseULEBTimesSkipingULEB:
+			n := r.count(segSizes, seg, ptrSize)
+			skip := r.uleb()
+			for ; n > 0 && r.err == nil; n-- {
+				rebase()
+				off += skip + uint64(ptrSize)
+			}
+		default:
+			r.fail(fmt.Sprintf("unknown rebase opcode %#x", b))
+		}
+	}
+	return rebases, r.err
+}
+
+// decodeBinds decodes a binding opcode stream. In lazy binding info,
+// DONE ends a single entry instead of the whole stream. Threaded binding
+// info, whose binds are not listed by address, is refused.
+func decodeBinds(dat []byte, ptrSize int, segSizes []uint64, lazy bool) ([]Bind, error) {
+	binds, _, threaded, err := decodeBindInfo(dat, ptrSize, segSizes, lazy)
+	if err == nil && threaded {
+		err = errThreadedBinds
+	}
+	return binds, err
+}
+
+var errThreadedBinds = errors.New("binding info is threaded; use ThreadedFixups")
+
+// decodeBindInfo decodes a binding opcode stream like decodeBinds, and
+// also threaded binding info, which uses BIND_OPCODE_THREADED: there
+// DO_BIND adds the symbol to the ordinal table instead of binding a
+// pointer. The binds of the ordinal table are returned along with the
+// starts of the pointer chains that THREADED_APPLY records.
+func decodeBindInfo(dat []byte, ptrSize int, segSizes []uint64, lazy bool) (binds, starts []Bind, threaded bool, err error) {
+	r := &opcodeReader{dat: dat}
+	cur := Bind{Segment: -1, Type: BindTypePointer}
+	var start int
+	bind := func() {
+		if threaded {
+			b := cur
+			b.Segment, b.Offset = -1, 0
+			binds = append(binds, b)
+			return
+		}
+		if cur.Segment < 0 {
+			r.fail("bind before segment is set")
+			return
+		}
+		if !r.inSegment(segSizes, cur.Segment, cur.Offset) {
+			return
+		}
+		b := cur
+		if lazy {
+			b.InfoOffset = uint64(start)
+		}
+		binds = append(binds, b)
+	}
+	for r.off < len(dat) {
+		b := dat[r.off]
+		r.off++
+		imm := b & bindImmediateMask
+		switch b & bindOpcodeMask {
+		case bindOpcodeDone:
+			if !lazy {
+				return binds, starts, threaded, r.err
+			}
+			start = r.off
+		case bindOpcodeSetDylibOrdinalImm:
+			cur.Ordinal = int(imm)
+		case bindOpcodeSetDylibOrdinalULEB:
+			cur.Ordinal = int(r.uleb())
+		case bindOpcodeSetDylibSpecialImm:
+			if imm == 0 {
+				cur.Ordinal = 0
+			} else {
+				cur.Ordinal = int(int8(bindOpcodeMask | imm))
+			}
+		case bindOpcodeSetSymbolTrailingFlagsImm:
+			cur.Flags = imm
+			cur.Symbol = r.cstring()
+		case bindOpcodeSetTypeImm:
+			cur.Type = imm
+		case bindOpcodeSetAddendSLEB:
+			cur.Addend = r.sleb()
+		case bindOpcodeSetSegmentAndOffsetULEB:
+			cur.Segment = int(imm)
+			cur.Offset = r.uleb()
+		case bindOpcodeAddAddrULEB:
+			cur.Offset += r.uleb()
+		case bindOpcodeDoBind:
+			bind()
+			cur.Offset += uint64(ptrSize)
+		case bindOpcodeDoBindAddAddrULEB:
+			bind()
+			cur.Offset += r.uleb() + uint64(ptrSize)
+		case bindOpcodeDoBindAddAddrImmScaled:
+			bind()
+			cur.Offset += uint64(imm)*uint64(ptrSize) + uint64(ptrSize)
+		case bindOpcodeDoBindULEBTimesSkippingULEB:
+			var n uint64
+			if threaded {
+				// Each entry of the ordinal table is at least a byte
+				// of the opcodes.
+				if n = r.uleb(); n > uint64(len(dat)) {
+					r.fail(fmt.Sprintf("repeat count %d exceeds the binding info", n))
+				}
+			} else {
+				n = r.count(segSizes, cur.Segment, ptrSize)
+			}
+			skip := r.uleb()
+			for ; n > 0 && r.err == nil; n-- {
+				bind()
+				cur.Offset += skip + uint64(ptrSize)
+			}
+		case bindOpcodeThreaded:
+			switch imm {
+			case bindSubopcodeThreadedSetBindOrdinalTableSizeULEB:
+				threaded = true
+				r.uleb()
+			case bindSubopcodeThreadedApply:
+				if !threaded || cur.Segment < 0 {
+					r.fail("threaded apply before the ordinal table and segment are set")
+					break
+				}
+				if !r.inSegment(segSizes, cur.Segment, cur.Offset) {
+					break
+				}
+				starts = append(starts, Bind{Segment: cur.Segment, Offset: cur.Offset})
+			default:
+				r.fail(fmt.Sprintf("unknown threaded bind subopcode %#x", imm))
+			}
+		default:
+			r.fail(fmt.Sprintf("unknown bind opcode %#x", b))
+		}
+	}
+	return binds, starts, threaded, r.err
+}
+
+func appendULEB(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+func appendSLEB(b []byte, v int64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// EncodeRebases encodes rebases as rebase opcodes for an image with
+// pointers of ptrSize bytes.
+func EncodeRebases(rebases []Rebase, ptrSize int) []byte {
+	var b []byte
+	var typ uint8
+	seg := -1
+	var off uint64
+	for i := 0; i < len(rebases); {
+		rb := rebases[i]
+		if rb.Type != typ {
+			typ = rb.Type
+			b = append(b, rebaseOpcodeSetTypeImm|typ&rebaseImmediateMask)
+		}
+		switch {
+		case rb.Segment != seg || rb.Offset < off:
+			seg = rb.Segment
+			b = append(b, rebaseOpcodeSetSegmentAndOffsetULEB|byte(seg)&rebaseImmediateMask)
+			b = appendULEB(b, rb.Offset)
+		case rb.Offset > off:
+			b = append(b, rebaseOpcodeAddAddrULEB)
+			b = appendULEB(b, rb.Offset-off)
+		}
+		// Rebase the run of adjacent pointers of the same type.
+		n := 1
+		for i+n < len(rebases) && n < rebaseImmediateMask {
+			next := rebases[i+n]
+			if next.Segment != seg || next.Type != typ || next.Offset != rb.Offset+uint64(n*ptrSize) {
+				break
+			}
+			n++
+		}
+		b = append(b, rebaseOpcodeDoRebaseImmTimes|byte(n))
+		off = rb.Offset + uint64(n*ptrSize)
+		i += n
+	}
+	return append(b, rebaseOpcodeDone)
+}
+
+// EncodeBinds encodes binds as binding opcodes for an image with
+// pointers of ptrSize bytes. Lazy binds are not encoded this way, since
+// each needs its own opcode sequence at a known offset.
+func EncodeBinds(binds []Bind, ptrSize int) []byte {
+	var b []byte
+	cur := Bind{Segment: -1, Type: BindTypePointer}
+	first := true
+	for _, bd := range binds {
+		if first || bd.Ordinal != cur.Ordinal {
+			switch {
+			case bd.Ordinal <= 0:
+				b = append(b, bindOpcodeSetDylibSpecialImm|byte(bd.Ordinal)&bindImmediateMask)
+			case bd.Ordinal <= bindImmediateMask:
+				b = append(b, bindOpcodeSetDylibOrdinalImm|byte(bd.Ordinal))
+			default:
+				b = append(b, bindOpcodeSetDylibOrdinalULEB)
+				b = appendULEB(b, uint64(bd.Ordinal))
+			}
+		}
+		if first || bd.Symbol != cur.Symbol || bd.Flags != cur.Flags {
+			b = append(b, bindOpcodeSetSymbolTrailingFlagsImm|bd.Flags&bindImmediateMask)
+			b = append(append(b, bd.Symbol...), 0)
+		}
+		if bd.Type != cur.Type {
+			b = append(b, bindOpcodeSetTypeImm|bd.Type&bindImmediateMask)
+		}
+		if bd.Addend != cur.Addend {
+			b = append(b, bindOpcodeSetAddendSLEB)
+			b = appendSLEB(b, bd.Addend)
+		}
+		switch {
+		case bd.Segment != cur.Segment || bd.Offset < cur.Offset:
+			b = append(b, bindOpcodeSetSegmentAndOffsetULEB|byte(bd.Segment)&bindImmediateMask)
+			b = appendULEB(b, bd.Offset)
+		case bd.Offset > cur.Offset:
+			b = append(b, bindOpcodeAddAddrULEB)
+			b = appendULEB(b, bd.Offset-cur.Offset)
+		}
+		b = append(b, bindOpcodeDoBind)
+		cur = bd
+		cur.Offset += uint64(ptrSize)
+		first = false
+	}
+	return append(b, bindOpcodeDone)
+}
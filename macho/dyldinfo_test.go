@@ -0,0 +1,183 @@
+package macho
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDyldInfo(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rebases, err := f.Rebases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rebases) != 1 || rebases[0].Type != RebaseTypePointer {
+		t.Fatalf("got rebases %+v", rebases)
+	}
+	if addr, err := f.RebaseAddr(rebases[0]); err != nil || addr != 0x100001010 {
+		t.Errorf("rebase address is %#x, %v, want 0x100001010", addr, err)
+	}
+
+	binds, err := f.Binds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(binds) != 1 || binds[0].Symbol != "dyld_stub_binder" || binds[0].Ordinal != 1 {
+		t.Fatalf("got binds %+v", binds)
+	}
+	if addr, err := f.BindAddr(binds[0]); err != nil || addr != 0x100001000 {
+		t.Errorf("bind address is %#x, %v, want 0x100001000", addr, err)
+	}
+
+	lazy, err := f.LazyBinds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lazy) != 1 || lazy[0].Symbol != "_printf" || lazy[0].Ordinal != 1 || lazy[0].InfoOffset != 0 {
+		t.Fatalf("got lazy binds %+v", lazy)
+	}
+	if addr, err := f.BindAddr(lazy[0]); err != nil || addr != 0x100001010 {
+		t.Errorf("lazy bind address is %#x, %v, want 0x100001010", addr, err)
+	}
+
+	// Bind the pointer as a weak import and write the file back.
+	binds[0].Flags = BindSymbolFlagsWeakImport
+	if err := f.SetBinds(binds); err != nil {
+		t.Fatal(err)
+	}
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := g.Binds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, binds) {
+		t.Errorf("got binds %+v after writing, want %+v", got, binds)
+	}
+
+	binds = append(binds, binds[0], binds[0], binds[0])
+	if err := f.SetBinds(binds); err == nil {
+		t.Error("SetBinds accepted binds that do not fit")
+	}
+}
+
+// testSegSizes are the segment sizes the opcodes of TestDyldInfoEncoding
+// are decoded with.
+var testSegSizes = []uint64{0, 0x2000, 0x2000, 0x2000}
+
+func TestDyldInfoEncoding(t *testing.T) {
+	for _, ptrSize := range []int{4, 8} {
+		p := uint64(ptrSize)
+		rebases := []Rebase{
+			{Segment: 2, Offset: 0, Type: RebaseTypePointer},
+			{Segment: 2, Offset: p, Type: RebaseTypePointer},
+			{Segment: 2, Offset: 2 * p, Type: RebaseTypePointer},
+			{Segment: 2, Offset: 0x1000, Type: RebaseTypePointer},
+			{Segment: 2, Offset: 0x100, Type: RebaseTypeTextAbsolute32},
+			{Segment: 1, Offset: 0x20, Type: RebaseTypeTextAbsolute32},
+		}
+		got, err := decodeRebases(EncodeRebases(rebases, ptrSize), ptrSize, testSegSizes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, rebases) {
+			t.Errorf("got rebases %+v, want %+v", got, rebases)
+		}
+
+		binds := []Bind{
+			{Segment: 2, Offset: 0, Type: BindTypePointer, Symbol: "_a", Ordinal: 1},
+			{Segment: 2, Offset: p, Type: BindTypePointer, Symbol: "_b", Ordinal: 1, Addend: -8},
+			{Segment: 2, Offset: 0x40, Type: BindTypePointer, Symbol: "_b", Ordinal: 1, Addend: 0x1234},
+			{Segment: 3, Offset: 0x10, Type: BindTypePointer, Symbol: "_c", Ordinal: 300, Flags: BindSymbolFlagsWeakImport},
+			{Segment: 3, Offset: 0x8, Type: BindTypePointer, Symbol: "_d", Ordinal: BindSpecialDylibFlatLookup},
+			{Segment: 3, Offset: 0x18, Type: BindTypePointer, Symbol: "_e", Ordinal: BindSpecialDylibSelf},
+		}
+		gotBinds, err := decodeBinds(EncodeBinds(binds, ptrSize), ptrSize, testSegSizes, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(gotBinds, binds) {
+			t.Errorf("got binds %+v, want %+v", gotBinds, binds)
+		}
+	}
+
+	// Opcodes that EncodeRebases and EncodeBinds do not use.
+	rebases, err := decodeRebases([]byte{
+		rebaseOpcodeSetTypeImm | RebaseTypePointer,
+		rebaseOpcodeSetSegmentAndOffsetULEB | 1, 0x80, 0x01, // 0x80
+		rebaseOpcodeDoRebaseULEBTimesSkipingULEB, 2, 8, // 0x80, 0x90
+		rebaseOpcodeAddAddrImmScaled | 2,
+		rebaseOpcodeDoRebaseAddAddrULEB, 0x10, // 0xb0
+		rebaseOpcodeDoRebaseULEBTimes, 1, // 0xc8
+		rebaseOpcodeDone,
+	}, 8, testSegSizes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offs []uint64
+	for _, r := range rebases {
+		offs = append(offs, r.Offset)
+	}
+	if want := []uint64{0x80, 0x90, 0xb0, 0xc8}; !reflect.DeepEqual(offs, want) {
+		t.Errorf("got rebase offsets %#x, want %#x", offs, want)
+	}
+
+	lazy, err := decodeBinds([]byte{
+		bindOpcodeSetSegmentAndOffsetULEB | 2, 0x10,
+		bindOpcodeSetDylibOrdinalImm | 1,
+		bindOpcodeSetSymbolTrailingFlagsImm, '_', 'a', 0,
+		bindOpcodeDoBind,
+		bindOpcodeDone,
+		bindOpcodeSetSegmentAndOffsetULEB | 2, 0x18,
+		bindOpcodeSetDylibSpecialImm | 0xf,
+		bindOpcodeSetSymbolTrailingFlagsImm, '_', 'b', 0,
+		bindOpcodeDoBindAddAddrImmScaled | 1,
+		bindOpcodeDone,
+	}, 8, testSegSizes, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Bind{
+		{Segment: 2, Offset: 0x10, Type: BindTypePointer, Symbol: "_a", Ordinal: 1},
+		{Segment: 2, Offset: 0x18, Type: BindTypePointer, Symbol: "_b", Ordinal: BindSpecialDylibMainExecutable, InfoOffset: 9},
+	}
+	if !reflect.DeepEqual(lazy, want) {
+		t.Errorf("got lazy binds %+v, want %+v", lazy, want)
+	}
+
+	for _, dat := range [][]byte{
+		{rebaseOpcodeDoRebaseImmTimes | 1},
+		{rebaseOpcodeSetSegmentAndOffsetULEB | 1, 0x80},
+		{0xf0},
+		{rebaseOpcodeSetSegmentAndOffsetULEB | 1, 0x80, 0x40, rebaseOpcodeDoRebaseImmTimes | 1},
+		{rebaseOpcodeSetSegmentAndOffsetULEB | 4, 0, rebaseOpcodeDoRebaseImmTimes | 1},
+		{rebaseOpcodeSetSegmentAndOffsetULEB | 1, 0, rebaseOpcodeDoRebaseULEBTimes, 0xff, 0xff, 0xff, 0xff, 0x0f},
+	} {
+		if _, err := decodeRebases(dat, 8, testSegSizes); err == nil {
+			t.Errorf("decodeRebases(%x) succeeded", dat)
+		}
+	}
+	for _, dat := range [][]byte{
+		{bindOpcodeDoBind},
+		{bindOpcodeSetSymbolTrailingFlagsImm, '_', 'a'},
+		{bindOpcodeThreaded},
+		{bindOpcodeSetSegmentAndOffsetULEB | 2, 0x80, 0x40, bindOpcodeDoBind},
+		{bindOpcodeSetSegmentAndOffsetULEB | 2, 0, bindOpcodeDoBindULEBTimesSkippingULEB, 0xff, 0xff, 0xff, 0xff, 0x0f, 0},
+	} {
+		if _, err := decodeBinds(dat, 8, testSegSizes, false); err == nil {
+			t.Errorf("decodeBinds(%x) succeeded", dat)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package macho
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// EncryptionInfo returns the LC_ENCRYPTION_INFO or LC_ENCRYPTION_INFO_64
+// command of the file, or nil if it has none.
+func (f *File) EncryptionInfo() *EncryptionInfo {
+	for _, l := range f.Loads {
+		if e, ok := l.(*EncryptionInfo); ok {
+			return e
+		}
+	}
+	return nil
+}
+
+// SetCryptid sets the cryptid field of the encryption info command.
+// A cryptid of 0 tells the loader that the file is not encrypted.
+func (f *File) SetCryptid(id uint32) error {
+	e := f.EncryptionInfo()
+	if e == nil {
+		return errors.New("no encryption info load command")
+	}
+	if len(e.LoadBytes) < 20 {
+		return fmt.Errorf("encryption info load command is only %d bytes", len(e.LoadBytes))
+	}
+	// The command is shared with the parsed bytes, so copy before patching.
+	raw := append(LoadBytes(nil), e.LoadBytes...)
+	f.ByteOrder.PutUint32(raw[16:], id)
+	e.LoadBytes = raw
+	e.Cryptid = id
+	return nil
+}
+
+// SetDecryptedData replaces the encrypted range of the file with data,
+// which must be exactly Cryptsize bytes, and marks the file as not
+// encrypted. The data is usually dumped from the memory of a running
+// process, where the loader has already decrypted it.
+//
+// The sections overlapping the encrypted range get the decrypted
+// contents; the file written by Bytes can then be loaded without the
+// decryption key.
+func (f *File) SetDecryptedData(data []byte) error {
+	e := f.EncryptionInfo()
+	if e == nil {
+		return errors.New("no encryption info load command")
+	}
+	if len(data) != int(e.Cryptsize) {
+		return fmt.Errorf("decrypted data is %d bytes, want %d", len(data), e.Cryptsize)
+	}
+	start, end := uint64(e.Cryptoff), uint64(e.Cryptoff)+uint64(e.Cryptsize)
+	for _, s := range f.Sections {
+		if isZerofill(s.Flags) || s.Size == 0 {
+			continue
+		}
+		off, send := uint64(s.Offset), uint64(s.Offset)+s.Size
+		if send <= start || end <= off {
+			continue
+		}
+		dat, err := s.Data()
+		if err != nil {
+			return err
+		}
+		// The section may extend past either end of the encrypted range.
+		lo, hi := off, send
+		if lo < start {
+			lo = start
+		}
+		if hi > end {
+			hi = end
+		}
+		copy(dat[lo-off:hi-off], data[lo-start:hi-start])
+		s.Replace(bytes.NewReader(dat), int64(len(dat)))
+	}
+	return f.SetCryptid(0)
+}
@@ -0,0 +1,77 @@
+package macho
+
+import (
+	"bytes"
+	"testing"
+)
+
+// addEncryptionInfo appends an LC_ENCRYPTION_INFO_64 command covering the
+// given file range to f, and returns f reparsed from its written bytes.
+func addEncryptionInfo(t *testing.T, f *File, off, size uint32) *File {
+	cmd := make([]byte, 24)
+	bo := f.ByteOrder
+	bo.PutUint32(cmd[0:], uint32(LoadCmdEncryptionInfo64))
+	bo.PutUint32(cmd[4:], uint32(len(cmd)))
+	bo.PutUint32(cmd[8:], off)
+	bo.PutUint32(cmd[12:], size)
+	bo.PutUint32(cmd[16:], 1)
+	f.Loads = append(f.Loads, LoadBytes(cmd))
+	f.Ncmd++
+	f.Cmdsz += uint32(len(cmd))
+
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f2
+}
+
+func TestEncryptionInfo(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.EncryptionInfo() != nil {
+		t.Fatal("unexpected encryption info")
+	}
+	if err := f.SetDecryptedData(nil); err == nil {
+		t.Error("SetDecryptedData succeeded without an encryption info command")
+	}
+
+	text := f.Section("__text")
+	f2 := addEncryptionInfo(t, f, text.Offset, uint32(text.Size))
+	e := f2.EncryptionInfo()
+	if e == nil {
+		t.Fatal("encryption info not parsed")
+	}
+	if e.Cryptoff != text.Offset || e.Cryptsize != uint32(text.Size) || e.Cryptid != 1 {
+		t.Errorf("got encryption info %+v", e)
+	}
+
+	if err := f2.SetDecryptedData(make([]byte, e.Cryptsize+1)); err == nil {
+		t.Error("SetDecryptedData accepted data of the wrong size")
+	}
+	plain := bytes.Repeat([]byte{0x90}, int(e.Cryptsize))
+	if err := f2.SetDecryptedData(plain); err != nil {
+		t.Fatal(err)
+	}
+	b, err := f2.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f3, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := f3.EncryptionInfo(); e == nil || e.Cryptid != 0 {
+		t.Errorf("cryptid not cleared: %+v", e)
+	}
+	if data, err := f3.Section("__text").Data(); err != nil || !bytes.Equal(data, plain) {
+		t.Errorf("__text does not hold the decrypted data: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package macho
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Thread state flavors, from <mach/*/thread_status.h>.
+const (
+	x86ThreadState32 = 1
+	x86ThreadState64 = 4
+	x86ThreadState   = 7
+	armThreadState   = 1
+	armThreadState64 = 6
+	ppcThreadState   = 1
+	ppcThreadState64 = 5
+)
+
+// A threadPC locates the program counter in the register state of one
+// thread state flavor.
+type threadPC struct {
+	flavor uint32
+	off    int // byte offset of the program counter in the state
+	size   int // 4 or 8
+}
+
+// threadPCs lists the thread state flavors whose program counter the entry
+// point functions understand, for each CPU type.
+var threadPCs = map[Cpu][]threadPC{
+	Cpu386:   {{x86ThreadState32, 10 * 4, 4}}, // eip
+	CpuAmd64: {{x86ThreadState64, 16 * 8, 8}}, // rip
+	CpuArm:   {{armThreadState, 15 * 4, 4}},   // pc
+	CpuArm64: {{armThreadState64, 32 * 8, 8}}, // pc
+	CpuPpc:   {{ppcThreadState, 0, 4}},        // srr0
+	CpuPpc64: {{ppcThreadState64, 0, 8}},      // srr0
+}
+
+// entryLoad returns the index in f.Loads of the LC_MAIN or LC_UNIXTHREAD
+// command that sets the entry point, and the command's bytes.
+func (f *File) entryLoad() (int, LoadBytes, error) {
+	for i, l := range f.Loads {
+		raw, ok := l.(LoadBytes)
+		if !ok || len(raw) < 8 {
+			continue
+		}
+		switch LoadCmd(f.ByteOrder.Uint32(raw)) {
+		case LoadCmdMain, LoadCmdUnixThread:
+			return i, raw, nil
+		}
+	}
+	return -1, nil, errors.New("no LC_MAIN or LC_UNIXTHREAD load command")
+}
+
+// mainBase returns the address LC_MAIN entry offsets are relative to: the
+// address at which the start of the file, and so the Mach-O header, is
+// mapped by __TEXT.
+func (f *File) mainBase() (uint64, *Segment, error) {
+	text := f.Segment("__TEXT")
+	if text == nil {
+		return 0, nil, errors.New("LC_MAIN entry point without a __TEXT segment")
+	}
+	return text.Addr - text.Offset, text, nil
+}
+
+// threadPCOffset returns the offset in the LC_UNIXTHREAD command raw of
+// the program counter of the thread state, and its size.
+func (f *File) threadPCOffset(raw LoadBytes) (int, int, error) {
+	bo := f.ByteOrder
+	for off := 8; off+8 <= len(raw); {
+		flavor, count := bo.Uint32(raw[off:]), int(bo.Uint32(raw[off+4:]))
+		state := off + 8
+		if off+8+4*count > len(raw) {
+			break
+		}
+		if f.Cpu&^cpuArch64 == Cpu386 && flavor == x86ThreadState && count >= 2 {
+			// A thread state header wraps the 32 or 64-bit state.
+			flavor = bo.Uint32(raw[state:])
+			state += 8
+		}
+		for _, pc := range threadPCs[f.Cpu] {
+			if pc.flavor == flavor && state+pc.off+pc.size <= off+8+4*count {
+				return state + pc.off, pc.size, nil
+			}
+		}
+		off += 8 + 4*count
+	}
+	return 0, 0, fmt.Errorf("LC_UNIXTHREAD has no thread state for %v with a known program counter", f.Cpu)
+}
+
+// Entry returns the virtual address at which execution starts, as set
+// by the LC_MAIN command, or the program counter of the LC_UNIXTHREAD
+// command of older executables.
+func (f *File) Entry() (uint64, error) {
+	v, main, err := f.entryValue()
+	if err != nil || !main {
+		return v, err
+	}
+	base, _, err := f.mainBase()
+	if err != nil {
+		return 0, err
+	}
+	return base + v, nil
+}
+
+// entryValue returns the entry offset of the LC_MAIN command of f, with
+// main set, or the program counter of its LC_UNIXTHREAD command.
+func (f *File) entryValue() (v uint64, main bool, err error) {
+	_, raw, err := f.entryLoad()
+	if err != nil {
+		return 0, false, err
+	}
+	if LoadCmd(f.ByteOrder.Uint32(raw)) == LoadCmdMain {
+		if len(raw) < 16 {
+			return 0, false, errors.New("LC_MAIN command is truncated")
+		}
+		return f.ByteOrder.Uint64(raw[8:]), true, nil
+	}
+	off, size, err := f.threadPCOffset(raw)
+	if err != nil {
+		return 0, false, err
+	}
+	if size == 4 {
+		return uint64(f.ByteOrder.Uint32(raw[off:])), false, nil
+	}
+	return f.ByteOrder.Uint64(raw[off:]), false, nil
+}
+
+// SetEntryPoint makes execution start at the virtual address addr, by
+// updating the entry offset of the LC_MAIN command or the program counter
+// of the LC_UNIXTHREAD command, whichever f has. With LC_MAIN, addr must
+// lie in the __TEXT segment.
+func (f *File) SetEntryPoint(addr uint64) error {
+	i, raw, err := f.entryLoad()
+	if err != nil {
+		return err
+	}
+	raw = append(LoadBytes(nil), raw...)
+	if LoadCmd(f.ByteOrder.Uint32(raw)) == LoadCmdMain {
+		if len(raw) < 16 {
+			return errors.New("LC_MAIN command is truncated")
+		}
+		base, text, err := f.mainBase()
+		if err != nil {
+			return err
+		}
+		if addr < text.Addr || addr >= text.Addr+text.Memsz {
+			return fmt.Errorf("entry point %#x is outside __TEXT", addr)
+		}
+		f.ByteOrder.PutUint64(raw[8:], addr-base)
+	} else {
+		off, size, err := f.threadPCOffset(raw)
+		if err != nil {
+			return err
+		}
+		if size == 4 {
+			if addr > 1<<32-1 {
+				return fmt.Errorf("entry point %#x does not fit in a 32-bit program counter", addr)
+			}
+			f.ByteOrder.PutUint32(raw[off:], uint32(addr))
+		} else {
+			f.ByteOrder.PutUint64(raw[off:], addr)
+		}
+	}
+	f.Loads[i] = raw
+	f.EntryPoint, _, _ = f.entryValue()
+	return nil
+}
@@ -0,0 +1,91 @@
+package macho
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEntryPoint(t *testing.T) {
+	for _, tt := range []struct {
+		file  string
+		start string // symbol at the entry point
+	}{
+		{"testdata/gcc-386-darwin-exec", "start"},
+		{"testdata/gcc-amd64-darwin-exec", "start"},
+		{"testdata/clang-386-darwin-exec-with-rpath", "_main"},
+		{"testdata/clang-amd64-darwin-exec-with-rpath", "_main"},
+	} {
+		f, err := Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Bytes only writes 32-bit files correctly when preserving them.
+		f.PreserveRaw = true
+		var start, other uint64
+		for _, s := range f.Symtab.Syms {
+			switch {
+			case s.Name == tt.start:
+				start = s.Value
+			case s.Type&0x0e == 0x0e && s.Sect == 1 && s.Value != start:
+				other = s.Value
+			}
+		}
+		if start == 0 || other == 0 {
+			t.Fatalf("%s: no %s symbol and other function", tt.file, tt.start)
+		}
+		if got, err := f.Entry(); err != nil || got != start {
+			t.Errorf("%s: Entry() = %#x, %v; want %#x", tt.file, got, err, start)
+		}
+		// The deprecated field holds LC_MAIN entries as offsets.
+		var base uint64
+		if tt.start == "_main" {
+			text := f.Segment("__TEXT")
+			base = text.Addr - text.Offset
+		}
+		if f.EntryPoint != start-base {
+			t.Errorf("%s: EntryPoint = %#x, want %#x", tt.file, f.EntryPoint, start-base)
+		}
+
+		if err := f.SetEntryPoint(other); err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		if f.EntryPoint != other-base {
+			t.Errorf("%s: EntryPoint = %#x after SetEntryPoint(%#x)", tt.file, f.EntryPoint, other)
+		}
+		b, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := g.Entry(); err != nil || got != other {
+			t.Errorf("%s: Entry() = %#x, %v after SetEntryPoint(%#x)", tt.file, got, err, other)
+		}
+		f.Close()
+	}
+}
+
+func TestSetEntryPointOutsideText(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	text := f.Segment("__TEXT")
+	if err := f.SetEntryPoint(text.Addr + text.Memsz); err == nil {
+		t.Error("SetEntryPoint accepted an address past __TEXT")
+	}
+}
+
+func TestEntryPointNone(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Entry(); err == nil {
+		t.Error("Entry succeeded for an object file")
+	}
+}
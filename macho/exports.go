@@ -1,5 +1,9 @@
 package macho
 
+const N_STAB = 0xE0
+const N_TYPE = 0x0E
+const N_UNDF = 0x00
+const N_PBUD = 0x0C
 const N_SECT = 0x0E
 const N_PEXT = 0x10
 const N_EXT = 0x01
@@ -0,0 +1,209 @@
+package macho
+
+import (
+	"errors"
+	"fmt"
+)
+
+// FunctionStarts decodes the LC_FUNCTION_STARTS data, returning the
+// addresses of the functions of the image in increasing order, or nil if
+// it has none.
+func (f *File) FunctionStarts() ([]uint64, error) {
+	if f.FuncStarts == nil {
+		return nil, nil
+	}
+	text := f.Segment("__TEXT")
+	if text == nil {
+		return nil, errors.New("function starts without a __TEXT segment")
+	}
+	r := &opcodeReader{dat: f.FuncStarts.RawDat}
+	var starts []uint64
+	addr := text.Addr
+	for r.off < len(r.dat) {
+		delta := r.uleb()
+		if delta == 0 {
+			break
+		}
+		addr += delta
+		starts = append(starts, addr)
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("function starts: %v", r.err)
+	}
+	return starts, nil
+}
+
+// An ExtractedFunction is a function copied out of a file by
+// ExtractFunction or ExtractFunctionAt, along with what is needed to
+// relocate it.
+type ExtractedFunction struct {
+	Name string // name of the symbol at Addr, if any
+	Addr uint64 // address of the function in the file it was extracted from
+	Code []byte
+
+	// Relocs are the section relocations of an object file that apply to
+	// Code. Their Addr is an offset in Code; the Value of external ones
+	// selects from Symbols, while that of others is unchanged.
+	Relocs  []Reloc
+	Symbols []Symbol
+
+	// Fixups are the offsets in Code of the pointers that dyld rebases in
+	// a linked image. Each pointer has been made relative to the start
+	// of Code.
+	Fixups []uint32
+
+	// Binds are the pointers in Code that dyld binds in a linked image.
+	// Their Offset is an offset in Code and their Segment is -1.
+	Binds []Bind
+}
+
+// ExtractFunction returns the function of the defined symbol name with
+// what is needed to relocate it, so that it can be copied into another
+// file. See ExtractFunctionAt.
+func (f *File) ExtractFunction(name string) (*ExtractedFunction, error) {
+	if f.Symtab != nil {
+		for _, sym := range f.Symtab.Syms {
+			if sym.Name == name && sym.Type&N_STAB == 0 && sym.Type&N_TYPE == N_SECT {
+				return f.ExtractFunctionAt(sym.Value)
+			}
+		}
+	}
+	return nil, fmt.Errorf("no function %s", name)
+}
+
+// ExtractFunctionAt returns the function at addr with what is needed to
+// relocate it. A function extends to the next of the function starts
+// recorded by the linker or, in files without them, to the next symbol
+// of its section.
+func (f *File) ExtractFunctionAt(addr uint64) (*ExtractedFunction, error) {
+	s := f.sectionForAddr(addr)
+	if s == nil {
+		return nil, fmt.Errorf("address %#x is not in a section with contents", addr)
+	}
+	idx := 0
+	for i, t := range f.Sections {
+		if t == s {
+			idx = i
+		}
+	}
+	var syms []Symbol
+	if f.Symtab != nil {
+		syms = f.Symtab.Syms
+	}
+
+	end := s.Addr + s.Size
+	starts, err := f.FunctionStarts()
+	if err != nil {
+		return nil, err
+	}
+	if len(starts) > 0 {
+		found := false
+		for _, a := range starts {
+			if a == addr {
+				found = true
+			} else if a > addr && a < end {
+				end = a
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no function starts at %#x", addr)
+		}
+	} else {
+		for _, sym := range syms {
+			if sym.Type&N_STAB == 0 && int(sym.Sect) == idx+1 && sym.Value > addr && sym.Value < end {
+				end = sym.Value
+			}
+		}
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	if end-s.Addr > uint64(len(data)) {
+		return nil, fmt.Errorf("function at %#x lies outside of section %s", addr, s.Name)
+	}
+	out := &ExtractedFunction{Addr: addr, Code: append([]byte(nil), data[addr-s.Addr:end-s.Addr]...)}
+	for _, sym := range syms {
+		if sym.Type&N_STAB == 0 && sym.Type&N_TYPE == N_SECT && sym.Value == addr {
+			out.Name = sym.Name
+			break
+		}
+	}
+
+	// Relocation entries hold offsets in the section. A PAIR entry has no
+	// address of its own and goes with the entry before it.
+	lo, hi := addr-s.Addr, end-s.Addr
+	symIdx := make(map[uint32]uint32) // symbol table index to Symbols index
+	kept := false
+	for _, r := range s.Relocs {
+		pair := f.Cpu == Cpu386 && r.Type == uint8(GENERIC_RELOC_PAIR) || f.Cpu == CpuArm && r.Type == uint8(ARM_RELOC_PAIR)
+		if pair {
+			if kept {
+				out.Relocs = append(out.Relocs, r)
+			}
+			continue
+		}
+		kept = lo <= uint64(r.Addr) && uint64(r.Addr) < hi
+		if !kept {
+			continue
+		}
+		r.Addr -= uint32(lo)
+		if r.Extern && !r.Scattered {
+			if int(r.Value) >= len(syms) {
+				return nil, fmt.Errorf("relocation at %#x refers to symbol %d of %d", s.Addr+lo+uint64(r.Addr), r.Value, len(syms))
+			}
+			i, ok := symIdx[r.Value]
+			if !ok {
+				i = uint32(len(out.Symbols))
+				symIdx[r.Value] = i
+				out.Symbols = append(out.Symbols, syms[r.Value])
+			}
+			r.Value = i
+		}
+		out.Relocs = append(out.Relocs, r)
+	}
+
+	// Linked images are fixed up by dyld instead.
+	rebases, err := f.Rebases()
+	if err != nil {
+		return nil, err
+	}
+	ptrSize := uint64(f.ptrSize())
+	for _, r := range rebases {
+		a, err := f.RebaseAddr(r)
+		if err != nil {
+			return nil, err
+		}
+		if a < addr || a >= end {
+			continue
+		}
+		off := a - addr
+		if r.Type == RebaseTypeTextPCRel32 || off+ptrSize > uint64(len(out.Code)) {
+			return nil, fmt.Errorf("unsupported rebase at %#x", a)
+		}
+		if ptrSize == 8 {
+			f.ByteOrder.PutUint64(out.Code[off:], f.ByteOrder.Uint64(out.Code[off:])-addr)
+		} else {
+			f.ByteOrder.PutUint32(out.Code[off:], f.ByteOrder.Uint32(out.Code[off:])-uint32(addr))
+		}
+		out.Fixups = append(out.Fixups, uint32(off))
+	}
+	for _, list := range []func() ([]Bind, error){f.Binds, f.LazyBinds, f.WeakBinds} {
+		binds, err := list()
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range binds {
+			a, err := f.BindAddr(b)
+			if err != nil {
+				return nil, err
+			}
+			if addr <= a && a < end {
+				b.Segment, b.Offset = -1, a-addr
+				out.Binds = append(out.Binds, b)
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,82 @@
+package macho
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestFunctionStarts(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	starts, err := f.FunctionStarts()
+	if err != nil || !reflect.DeepEqual(starts, []uint64{0x100000f60}) {
+		t.Fatalf("FunctionStarts() = %#x, %v; want [0x100000f60]", starts, err)
+	}
+	fn, err := f.ExtractFunction("_main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := f.Section("__text").Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fn.Name != "_main" || fn.Addr != 0x100000f60 || !bytes.Equal(fn.Code, text) {
+		t.Errorf("got %s at %#x with %d bytes, want all of __text", fn.Name, fn.Addr, len(fn.Code))
+	}
+	if _, err := f.ExtractFunctionAt(0x100000f61); err == nil {
+		t.Error("ExtractFunctionAt accepted an address inside a function")
+	}
+}
+
+func TestExtractFunction(t *testing.T) {
+	// Without function starts, _main extends to the end of __text.
+	f, err := Open("testdata/gcc-amd64-darwin-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fn, err := f.ExtractFunction("_main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fn.Code) != 0x17 || len(fn.Relocs) != 0 || len(fn.Fixups) != 0 || len(fn.Binds) != 0 {
+		t.Errorf("_main is %+v, want 23 bytes without relocations", fn)
+	}
+
+	obj, err := Open("testdata/clang-amd64-darwin.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	fn, err = obj.ExtractFunction("_main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := obj.Section("__text")
+	if uint64(len(fn.Code)) != text.Size || len(fn.Relocs) != len(text.Relocs) {
+		t.Fatalf("got %d bytes with %d relocations, want all of __text", len(fn.Code), len(fn.Relocs))
+	}
+	var names []string
+	for _, sym := range fn.Symbols {
+		names = append(names, sym.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"_printf"}) {
+		t.Errorf("symbols are %q, want [_printf]", names)
+	}
+	for i, r := range fn.Relocs {
+		want := text.Relocs[i]
+		if want.Extern {
+			want.Value = 0
+		}
+		if r != want {
+			t.Errorf("relocation %d is %+v, want %+v", i, r, want)
+		}
+	}
+	if _, err := obj.ExtractFunction("_nope"); err == nil {
+		t.Error("ExtractFunction accepted a missing symbol")
+	}
+}
@@ -16,6 +16,9 @@ import (
 	"io"
 	"os"
 	"strings"
+
+	"github.com/Binject/debug/internal/mmap"
+	"github.com/Binject/debug/internal/readerat"
 )
 
 // A File represents an open Mach-O file.
@@ -32,8 +35,41 @@ type File struct {
 	DataInCode *DataInCode
 	DylinkInfo *DylinkInfo
 
+	LinkerOptHint *LinkerOptHint
+	TwolevelHints *TwolevelHints
+
+	// EntryPoint is the entry offset of the LC_MAIN command, relative to
+	// the start of the file as mapped by __TEXT, or the program counter
+	// of the LC_UNIXTHREAD command, as read. Bytes does not write it.
+	//
+	// Deprecated: use Entry, which returns the entry point as an address
+	// in both cases, and SetEntryPoint.
 	EntryPoint uint64
-	Insertion  []byte
+
+	Insertion []byte
+
+	// FinalSegEnd is the file offset of the end of the last segment.
+	// Bytes pads its output with zeros up to it.
+	FinalSegEnd uint64
+
+	// PreserveRaw makes Bytes write the header, load commands, section
+	// contents and the linkedit data the File holds over the bytes the
+	// file was read from, so that data it does not model, such as chained
+	// fixups, survives untouched. Set it before editing the file.
+	PreserveRaw bool
+
+	// Anomalies lists the malformations that NewFileTolerant worked
+	// around while reading the file.
+	Anomalies []Issue
+
+	raw      io.ReaderAt // the reader the file was parsed from
+	rawSize  int64       // size of raw, or -1 if not known yet
+	tolerant bool        // read by NewFileTolerant
+
+	bindInfo []byte // binding info as read, whose threaded fixups Bytes keeps
+
+	pending []pendingLoad // load commands OpenLazy has not decoded yet, in order
+	lazyErr error         // error decoding a pending load command
 
 	closer io.Closer
 }
@@ -81,6 +117,14 @@ type DataInCode struct {
 	RawDat []byte
 }
 
+// LinkerOptHint holds the data of the LC_LINKER_OPTIMIZATION_HINT command
+// of an object file.
+type LinkerOptHint struct {
+	Len    uint32
+	Offset uint64
+	RawDat []byte
+}
+
 type DylinkInfo struct {
 	RebaseLen         uint32
 	RebaseOffset      uint64
@@ -116,12 +160,7 @@ type Segment struct {
 
 // Data reads and returns the contents of the segment.
 func (s *Segment) Data() ([]byte, error) {
-	dat := make([]byte, s.sr.Size())
-	n, err := s.sr.ReadAt(dat, 0)
-	if n == len(dat) {
-		err = nil
-	}
-	return dat[0:n], err
+	return readerat.ReadData(io.NewSectionReader(s.sr, 0, s.sr.Size()), uint64(s.sr.Size()))
 }
 
 // Open returns a new ReadSeeker reading the segment.
@@ -165,21 +204,41 @@ type Section struct {
 	// with other clients.
 	io.ReaderAt
 	sr *io.SectionReader
+
+	// view is the contents of the section in the mapping made by
+	// OpenLazy, while sr is still viewSR.
+	view   []byte
+	viewSR *io.SectionReader
 }
 
-// Data reads and returns the contents of the Mach-O section.
+// Data reads and returns the contents of the Mach-O section. For a File
+// opened by OpenLazy, it is a slice of the mapping of the file instead.
 func (s *Section) Data() ([]byte, error) {
-	dat := make([]byte, s.sr.Size())
-	n, err := s.sr.ReadAt(dat, 0)
-	if n == len(dat) {
-		err = nil
+	if s.viewSR != nil && s.sr == s.viewSR {
+		return s.view, nil
 	}
-	return dat[0:n], err
+	return readerat.ReadData(io.NewSectionReader(s.sr, 0, s.sr.Size()), uint64(s.sr.Size()))
 }
 
 // Open returns a new ReadSeeker reading the Mach-O section.
 func (s *Section) Open() io.ReadSeeker { return io.NewSectionReader(s.sr, 0, 1<<63-1) }
 
+// Replace Section's Data with the contents of reader.
+func (s *Section) Replace(reader io.ReaderAt, length int64) {
+	s.sr = io.NewSectionReader(reader, 0, length)
+	s.ReaderAt = s.sr
+}
+
+// An EncryptionInfo represents a Mach-O LC_ENCRYPTION_INFO or
+// LC_ENCRYPTION_INFO_64 command. The file range [Cryptoff,
+// Cryptoff+Cryptsize) is encrypted unless Cryptid is 0.
+type EncryptionInfo struct {
+	LoadBytes
+	Cryptoff  uint32
+	Cryptsize uint32
+	Cryptid   uint32
+}
+
 // A Dylinker represents a Mach-O load dynamic library command.
 type Dylinker struct {
 	LoadBytes
@@ -212,6 +271,30 @@ type Dysymtab struct {
 	RawDysymtab  []byte
 }
 
+// A TwolevelHints represents a Mach-O two-level namespace hints command,
+// whose table holds a hint for each undefined symbol, in the order of the
+// undefined symbols of the dynamic symbol table.
+type TwolevelHints struct {
+	LoadBytes
+	TwolevelHintsCmd
+	Hints  []TwolevelHint
+	RawDat []byte
+}
+
+// A TwolevelHint tells dyld where the library an undefined symbol is
+// bound to defines it.
+type TwolevelHint struct {
+	SubImage uint8  // index of the sub-image of the library, or 0 for the library itself
+	TOC      uint32 // index of the symbol in the table of contents of the image
+}
+
+// A LinkerOption represents a Mach-O LC_LINKER_OPTION command, which
+// passes options such as "-lz" or "-framework", "Foundation" to the linker.
+type LinkerOption struct {
+	LoadBytes
+	Options []string
+}
+
 // A Rpath represents a Mach-O rpath command.
 type Rpath struct {
 	LoadBytes
@@ -268,6 +351,11 @@ func Open(name string) (*File, error) {
 // Close has no effect.
 func (f *File) Close() error {
 	var err error
+	// Sections stop being views of a mapping before it is unmapped, so
+	// that Data reads from the closed file and fails instead.
+	for _, s := range f.Sections {
+		s.view, s.viewSR = nil, nil
+	}
 	if f.closer != nil {
 		err = f.closer.Close()
 		f.closer = nil
@@ -276,19 +364,24 @@ func (f *File) Close() error {
 }
 
 // NewFile creates a new macho.File for accessing a Mach-o binary file in an underlying reader.
+// Counts and sizes in the header and load commands that do not fit in the
+// file are a *FormatError.
 func NewFile(r io.ReaderAt) (*File, error) {
-	return newFileInternal(r, false)
+	return newFileInternal(r, false, false, false)
 }
 
 // NewFileFromMemory creates a new macho.File for accessing a Mach-O binary in-memory image in an underlying reader.
 func NewFileFromMemory(r io.ReaderAt) (*File, error) {
-	return newFileInternal(r, true)
+	return newFileInternal(r, true, false, false)
 }
 
 // NewFile creates a new File for accessing a PE binary in an underlying reader.
-func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
+func newFileInternal(r io.ReaderAt, memoryMode, tolerant, lazy bool) (*File, error) {
 
 	f := new(File)
+	f.raw = r
+	f.rawSize = -1
+	f.tolerant = tolerant
 	sr := io.NewSectionReader(r, 0, 1<<63-1)
 
 	// Read and decode Mach magic to determine byte order, size.
@@ -320,400 +413,500 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 	if f.Magic == Magic64 {
 		offset = fileHeaderSize64
 	}
-	dat := make([]byte, f.Cmdsz)
-	if _, err := r.ReadAt(dat, offset); err != nil {
+	dat, err := f.loadCommandBytes(r, offset)
+	if err != nil {
+		return nil, err
+	}
+	nload, err := f.loadCount(len(dat))
+	if err != nil {
 		return nil, err
 	}
-	f.Loads = make([]Load, f.Ncmd)
+	f.Loads = make([]Load, nload)
 	bo := f.ByteOrder
 	for i := range f.Loads {
 		// Each load command begins with uint32 command and length.
 		if len(dat) < 8 {
-			return nil, &FormatError{offset, "command block too small", nil}
+			if err := f.tolerate(&FormatError{offset, "command block too small", nil}); err != nil {
+				return nil, err
+			}
+			f.Loads = f.Loads[:i]
+			break
 		}
 		cmd, siz := LoadCmd(bo.Uint32(dat[0:4])), bo.Uint32(dat[4:8])
-		if siz < 8 || siz > uint32(len(dat)) {
-			return nil, &FormatError{offset, "invalid command block size", nil}
-		}
 		var cmddat []byte
-		cmddat, dat = dat[0:siz], dat[siz:]
+		if siz >= 8 && siz <= uint32(len(dat)) {
+			cmddat, dat = dat[0:siz], dat[siz:]
+		} else {
+			cmddat, dat = f.overrunLoad(r, i, siz, offset), nil
+			if cmddat == nil {
+				if err := f.tolerate(&FormatError{offset, "invalid command block size", nil}); err != nil {
+					return nil, err
+				}
+				f.Loads = f.Loads[:i]
+				break
+			}
+		}
 		offset += int64(siz)
-		var s *Segment
-		//fmt.Printf("LoadCmdVal: %+v\n", cmd)
-		switch cmd {
-		default:
+		if lazy {
 			f.Loads[i] = LoadBytes(cmddat)
-
-		case LoadCmdRpath:
-			var hdr RpathCmd
-			b := bytes.NewReader(cmddat)
-			if err := binary.Read(b, bo, &hdr); err != nil {
-				return nil, err
-			}
-			l := new(Rpath)
-			if hdr.Path >= uint32(len(cmddat)) {
-				return nil, &FormatError{offset, "invalid path in rpath command", hdr.Path}
-			}
-			l.Path = cstring(cmddat[hdr.Path:])
-			l.LoadBytes = LoadBytes(cmddat)
-			f.Loads[i] = l
-
-		case LoadCmdDylinker:
-			var hdr DylinkerCmd
-			b := bytes.NewReader(cmddat)
-			if err := binary.Read(b, bo, &hdr); err != nil {
-				return nil, err
-			}
-			l := new(Dylinker)
-			if hdr.Name >= uint32(len(cmddat)) {
-				return nil, &FormatError{offset, "invalid name in dynamic library command", hdr.Name}
-			}
-			l.Name = cstring(cmddat[hdr.Name:])
-			l.LoadBytes = LoadBytes(cmddat)
-			f.Loads[i] = l
-
-		case LoadCmdDylib:
-			var hdr DylibCmd
-			b := bytes.NewReader(cmddat)
-			if err := binary.Read(b, bo, &hdr); err != nil {
-				return nil, err
-			}
-			l := new(Dylib)
-			if hdr.Name >= uint32(len(cmddat)) {
-				return nil, &FormatError{offset, "invalid name in dynamic library command", hdr.Name}
-			}
-			l.Name = cstring(cmddat[hdr.Name:])
-			l.Time = hdr.Time
-			l.CurrentVersion = hdr.CurrentVersion
-			l.CompatVersion = hdr.CompatVersion
-			l.LoadBytes = LoadBytes(cmddat)
-			f.Loads[i] = l
-
-		case LoadCmdSymtab:
-			var hdr SymtabCmd
-			b := bytes.NewReader(cmddat)
-			if err := binary.Read(b, bo, &hdr); err != nil {
+			f.pending = append(f.pending, pendingLoad{i, cmd, cmddat, offset})
+			continue
+		}
+		if err := f.parseLoad(r, i, cmd, cmddat, offset, memoryMode); err != nil {
+			if err := f.tolerate(err); err != nil {
 				return nil, err
 			}
-			strtab := make([]byte, hdr.Strsize)
+			f.Loads[i] = LoadBytes(cmddat)
+		}
+	}
+	f.EntryPoint, _, _ = f.entryValue()
+	if f.tolerant {
+		f.checkLoads(dat)
+	}
+	return f, nil
+}
+
+// parseLoad decodes cmddat, the bytes of load command i of type cmd,
+// which ends at offset, into f.
+func (f *File) parseLoad(r io.ReaderAt, i int, cmd LoadCmd, cmddat []byte, offset int64, memoryMode bool) error {
+	bo := f.ByteOrder
+	siz := uint32(len(cmddat))
+	var s *Segment
+	//fmt.Printf("LoadCmdVal: %+v\n", cmd)
+	switch cmd {
+	default:
+		f.Loads[i] = LoadBytes(cmddat)
 
+	case LoadCmdRpath:
+		var hdr RpathCmd
+		b := bytes.NewReader(cmddat)
+		if err := binary.Read(b, bo, &hdr); err != nil {
+			return err
+		}
+		l := new(Rpath)
+		if hdr.Path >= uint32(len(cmddat)) {
+			return &FormatError{offset, "invalid path in rpath command", hdr.Path}
+		}
+		l.Path = cstring(cmddat[hdr.Path:])
+		l.LoadBytes = LoadBytes(cmddat)
+		f.Loads[i] = l
+
+	case LoadCmdEncryptionInfo, LoadCmdEncryptionInfo64:
+		var hdr EncryptionInfoCmd
+		b := bytes.NewReader(cmddat)
+		if err := binary.Read(b, bo, &hdr); err != nil {
+			return err
+		}
+		l := new(EncryptionInfo)
+		l.Cryptoff = hdr.Cryptoff
+		l.Cryptsize = hdr.Cryptsize
+		l.Cryptid = hdr.Cryptid
+		l.LoadBytes = LoadBytes(cmddat)
+		f.Loads[i] = l
+
+	case LoadCmdDylinker:
+		var hdr DylinkerCmd
+		b := bytes.NewReader(cmddat)
+		if err := binary.Read(b, bo, &hdr); err != nil {
+			return err
+		}
+		l := new(Dylinker)
+		if hdr.Name >= uint32(len(cmddat)) {
+			return &FormatError{offset, "invalid name in dynamic library command", hdr.Name}
+		}
+		l.Name = cstring(cmddat[hdr.Name:])
+		l.LoadBytes = LoadBytes(cmddat)
+		f.Loads[i] = l
+
+	case LoadCmdDylib:
+		var hdr DylibCmd
+		b := bytes.NewReader(cmddat)
+		if err := binary.Read(b, bo, &hdr); err != nil {
+			return err
+		}
+		l := new(Dylib)
+		if hdr.Name >= uint32(len(cmddat)) {
+			return &FormatError{offset, "invalid name in dynamic library command", hdr.Name}
+		}
+		l.Name = cstring(cmddat[hdr.Name:])
+		l.Time = hdr.Time
+		l.CurrentVersion = hdr.CurrentVersion
+		l.CompatVersion = hdr.CompatVersion
+		l.LoadBytes = LoadBytes(cmddat)
+		f.Loads[i] = l
+
+	case LoadCmdSymtab:
+		var hdr SymtabCmd
+		b := bytes.NewReader(cmddat)
+		if err := binary.Read(b, bo, &hdr); err != nil {
+			return err
+		}
+		stroff, symoff := int64(hdr.Stroff), int64(hdr.Symoff)
+		if memoryMode {
 			var linkeditAddr, textAddr, linkeditOffset int64
-			if !memoryMode {
-				if _, err := r.ReadAt(strtab, int64(hdr.Stroff)); err != nil {
-					return nil, err
-				}
-			} else {
-				// in memory, we have to translate the file offsets for strtab/symtab into offsets into LINKEDIT segment
-				for _, load := range f.Loads {
-					switch segment := load.(type) {
-					case *Segment:
-						if segment == nil {
-							continue
-						}
-						if segment.Name == "__LINKEDIT" {
-							linkeditAddr = int64(segment.Addr)
-							linkeditOffset = int64(segment.Offset)
-						} else if segment.Name == "__TEXT" {
-							textAddr = int64(segment.Addr)
-						}
+			// in memory, we have to translate the file offsets for strtab/symtab into offsets into LINKEDIT segment
+			for _, load := range f.Loads {
+				switch segment := load.(type) {
+				case *Segment:
+					if segment == nil {
+						continue
+					}
+					if segment.Name == "__LINKEDIT" {
+						linkeditAddr = int64(segment.Addr)
+						linkeditOffset = int64(segment.Offset)
+					} else if segment.Name == "__TEXT" {
+						textAddr = int64(segment.Addr)
 					}
 				}
-				strtabAddr := (linkeditAddr - textAddr) + (int64(hdr.Stroff) - linkeditOffset)
-				if _, err := r.ReadAt(strtab, strtabAddr); err != nil {
-					return nil, err
-				}
-			}
-
-			var symsz int
-			if f.Magic == Magic64 {
-				symsz = 16
-			} else {
-				symsz = 12
 			}
-			symdat := make([]byte, int(hdr.Nsyms)*symsz)
+			stroff = (linkeditAddr - textAddr) + (int64(hdr.Stroff) - linkeditOffset)
+			symoff = (linkeditAddr - textAddr) + (int64(hdr.Symoff) - linkeditOffset)
+		}
+		strtab, err := f.readBlock(r, uint64(hdr.Strsize), stroff)
+		if err != nil {
+			return err
+		}
 
-			if !memoryMode {
-				if _, err := r.ReadAt(symdat, int64(hdr.Symoff)); err != nil {
-					return nil, err
-				}
-			} else {
-				if _, err := r.ReadAt(symdat, (linkeditAddr-textAddr)+(int64(hdr.Symoff)-linkeditOffset)); err != nil {
-					return nil, err
-				}
-			}
+		var symsz int
+		if f.Magic == Magic64 {
+			symsz = 16
+		} else {
+			symsz = 12
+		}
+		symdat, err := f.readBlock(r, uint64(hdr.Nsyms)*uint64(symsz), symoff)
+		if err != nil {
+			return err
+		}
 
-			st, err := f.parseSymtab(symdat, strtab, cmddat, &hdr, offset)
-			if err != nil {
-				return nil, err
-			}
-			f.Loads[i] = st
-			f.Symtab = st
-			f.Symtab.Symoff = hdr.Symoff
-			f.Symtab.Stroff = hdr.Stroff
-
-		case LoadCmdSignature:
-			var sigCmd SigBlockCmd
-			s := bytes.NewReader(cmddat)
-			if err := binary.Read(s, bo, &sigCmd); err != nil {
-				return nil, err
-			}
-			//fmt.Printf("SigData: %+v\n", sigCmd)
-			sig := make([]byte, sigCmd.Sigsize)
-			if _, err := r.ReadAt(sig, int64(sigCmd.Sigoff)); err != nil {
-				return nil, err
+		st, err := f.parseSymtab(symdat, strtab, cmddat, &hdr, offset)
+		if err != nil {
+			return err
+		}
+		f.Loads[i] = st
+		f.Symtab = st
+		f.Symtab.Symoff = hdr.Symoff
+		f.Symtab.Stroff = hdr.Stroff
+
+	case LoadCmdSignature:
+		var sigCmd SigBlockCmd
+		s := bytes.NewReader(cmddat)
+		if err := binary.Read(s, bo, &sigCmd); err != nil {
+			return err
+		}
+		//fmt.Printf("SigData: %+v\n", sigCmd)
+		sig, err := f.readBlock(r, uint64(sigCmd.Sigsize), int64(sigCmd.Sigoff))
+		if err != nil {
+			return err
+		}
+		var block SigBlock
+		block.Offset = uint64(sigCmd.Sigoff)
+		block.Len = sigCmd.Sigsize
+		block.RawDat = sig
+		f.SigBlock = &block
+		f.Loads[i] = LoadBytes(cmddat)
+
+	case LoadCmdFuncStarts:
+		var funcCmd FuncStartsCmd
+		fsc := bytes.NewReader(cmddat)
+		if err := binary.Read(fsc, bo, &funcCmd); err != nil {
+			return err
+		}
+		//fmt.Printf("FuncStartsData: %+v\n", funcCmd)
+		fs, err := f.readBlock(r, uint64(funcCmd.Datasize), int64(funcCmd.Dataoff))
+		if err != nil {
+			return err
+		}
+		var funcs FuncStarts
+		funcs.Offset = uint64(funcCmd.Dataoff)
+		funcs.Len = funcCmd.Datasize
+		funcs.RawDat = fs
+		f.FuncStarts = &funcs
+		f.Loads[i] = LoadBytes(cmddat)
+
+	case LoadCmdDataInCode:
+		var dataCmd DataInCodeCmd
+		dcc := bytes.NewReader(cmddat)
+		if err := binary.Read(dcc, bo, &dataCmd); err != nil {
+			return err
+		}
+		//fmt.Printf("DataInCode: %+v\n", dataCmd)
+		dc, err := f.readBlock(r, uint64(dataCmd.Datasize), int64(dataCmd.Dataoff))
+		if err != nil {
+			return err
+		}
+		var datacode DataInCode
+		datacode.Offset = uint64(dataCmd.Dataoff)
+		datacode.Len = dataCmd.Datasize
+		datacode.RawDat = dc
+		f.DataInCode = &datacode
+		f.Loads[i] = LoadBytes(cmddat)
+
+	case LoadCmdLinkerOption:
+		var hdr LinkerOptionCmd
+		b := bytes.NewReader(cmddat)
+		if err := binary.Read(b, bo, &hdr); err != nil {
+			return err
+		}
+		l := new(LinkerOption)
+		strs := cmddat[binary.Size(hdr):]
+		for j := uint32(0); j < hdr.Count; j++ {
+			n := bytes.IndexByte(strs, 0)
+			if n < 0 {
+				return &FormatError{offset, "unterminated string in linker option command", j}
 			}
-			var block SigBlock
-			block.Offset = uint64(sigCmd.Sigoff)
-			block.Len = sigCmd.Sigsize
-			block.RawDat = sig
-			f.SigBlock = &block
-			f.Loads[i] = LoadBytes(cmddat)
+			l.Options = append(l.Options, string(strs[:n]))
+			strs = strs[n+1:]
+		}
+		l.LoadBytes = LoadBytes(cmddat)
+		f.Loads[i] = l
 
-		case LoadCmdFuncStarts:
-			var funcCmd FuncStartsCmd
-			fsc := bytes.NewReader(cmddat)
-			if err := binary.Read(fsc, bo, &funcCmd); err != nil {
-				return nil, err
-			}
-			//fmt.Printf("FuncStartsData: %+v\n", funcCmd)
-			fs := make([]byte, funcCmd.Datasize)
-			if _, err := r.ReadAt(fs, int64(funcCmd.Dataoff)); err != nil {
-				return nil, err
-			}
-			var funcs FuncStarts
-			funcs.Offset = uint64(funcCmd.Dataoff)
-			funcs.Len = funcCmd.Datasize
-			funcs.RawDat = fs
-			f.FuncStarts = &funcs
-			f.Loads[i] = LoadBytes(cmddat)
+	case LoadCmdLinkerOptimizationHint:
+		var hintCmd LinkerOptHintCmd
+		hc := bytes.NewReader(cmddat)
+		if err := binary.Read(hc, bo, &hintCmd); err != nil {
+			return err
+		}
+		hint, err := f.readBlock(r, uint64(hintCmd.Datasize), int64(hintCmd.Dataoff))
+		if err != nil {
+			return err
+		}
+		f.LinkerOptHint = &LinkerOptHint{
+			Len:    hintCmd.Datasize,
+			Offset: uint64(hintCmd.Dataoff),
+			RawDat: hint,
+		}
+		f.Loads[i] = LoadBytes(cmddat)
 
-		case LoadCmdDataInCode:
-			var dataCmd DataInCodeCmd
-			dcc := bytes.NewReader(cmddat)
-			if err := binary.Read(dcc, bo, &dataCmd); err != nil {
-				return nil, err
-			}
-			//fmt.Printf("DataInCode: %+v\n", dataCmd)
-			dc := make([]byte, dataCmd.Datasize)
-			if _, err := r.ReadAt(dc, int64(dataCmd.Dataoff)); err != nil {
-				return nil, err
-			}
-			var datacode DataInCode
-			datacode.Offset = uint64(dataCmd.Dataoff)
-			datacode.Len = dataCmd.Datasize
-			datacode.RawDat = dc
-			f.DataInCode = &datacode
-			f.Loads[i] = LoadBytes(cmddat)
+	case LoadCmdTwolevelHints:
+		var hdr TwolevelHintsCmd
+		if err := binary.Read(bytes.NewReader(cmddat), bo, &hdr); err != nil {
+			return err
+		}
+		dat, err := f.readBlock(r, uint64(hdr.Nhints)*4, int64(hdr.Offset))
+		if err != nil {
+			return err
+		}
+		h := &TwolevelHints{LoadBytes: LoadBytes(cmddat), TwolevelHintsCmd: hdr, RawDat: dat}
+		for off := 0; off+4 <= len(dat); off += 4 {
+			h.Hints = append(h.Hints, decodeTwolevelHint(bo, bo.Uint32(dat[off:])))
+		}
+		f.Loads[i] = h
+		f.TwolevelHints = h
 
-		case LoadCmdDylinkInfo:
-			var dylinkInfoCmd DylinkInfoCmd
-			dic := bytes.NewReader(cmddat)
-			if err := binary.Read(dic, bo, &dylinkInfoCmd); err != nil {
-				return nil, err
-			}
-			//fmt.Printf("LoadCmdDylinkInfo: %+v\n", dylinkInfoCmd)
-			// Copy each section next
-			var dylinkInfo DylinkInfo
-			// Rebase deets
-			if dylinkInfoCmd.Rebasesize > 0 {
-				if !memoryMode { // this data is in LINKEDIT already
-					rebase := make([]byte, dylinkInfoCmd.Rebasesize)
-					if _, err := r.ReadAt(rebase, int64(dylinkInfoCmd.Rebaseoff)); err != nil {
-						return nil, err
-					}
-					dylinkInfo.RebaseDat = rebase
+	case LoadCmdDylinkInfo:
+		var dylinkInfoCmd DylinkInfoCmd
+		dic := bytes.NewReader(cmddat)
+		if err := binary.Read(dic, bo, &dylinkInfoCmd); err != nil {
+			return err
+		}
+		//fmt.Printf("LoadCmdDylinkInfo: %+v\n", dylinkInfoCmd)
+		// Copy each section next
+		var dylinkInfo DylinkInfo
+		// Rebase deets
+		if dylinkInfoCmd.Rebasesize > 0 {
+			if !memoryMode { // this data is in LINKEDIT already
+				rebase, err := f.readBlock(r, uint64(dylinkInfoCmd.Rebasesize), int64(dylinkInfoCmd.Rebaseoff))
+				if err != nil {
+					return err
 				}
-				dylinkInfo.RebaseLen = dylinkInfoCmd.Rebasesize
-				dylinkInfo.RebaseOffset = uint64(dylinkInfoCmd.Rebaseoff)
+				dylinkInfo.RebaseDat = rebase
 			}
-			// BindingInfo deets
-			if dylinkInfoCmd.Bindinginfosize > 0 {
-				if !memoryMode { // this data is in LINKEDIT already
-					binding := make([]byte, dylinkInfoCmd.Bindinginfosize)
-					if _, err := r.ReadAt(binding, int64(dylinkInfoCmd.Bindinginfooff)); err != nil {
-						return nil, err
-					}
-					dylinkInfo.BindingInfoDat = binding
+			dylinkInfo.RebaseLen = dylinkInfoCmd.Rebasesize
+			dylinkInfo.RebaseOffset = uint64(dylinkInfoCmd.Rebaseoff)
+		}
+		// BindingInfo deets
+		if dylinkInfoCmd.Bindinginfosize > 0 {
+			if !memoryMode { // this data is in LINKEDIT already
+				binding, err := f.readBlock(r, uint64(dylinkInfoCmd.Bindinginfosize), int64(dylinkInfoCmd.Bindinginfooff))
+				if err != nil {
+					return err
 				}
-				dylinkInfo.BindingInfoLen = dylinkInfoCmd.Bindinginfosize
-				dylinkInfo.BindingInfoOffset = uint64(dylinkInfoCmd.Bindinginfooff)
+				dylinkInfo.BindingInfoDat = binding
+				f.bindInfo = binding
 			}
-			// Weak deets
-			if dylinkInfoCmd.Weakbindingsize > 0 {
-				if !memoryMode { // this data is in LINKEDIT already
-					weak := make([]byte, dylinkInfoCmd.Weakbindingsize)
-					if _, err := r.ReadAt(weak, int64(dylinkInfoCmd.Weakbindingoff)); err != nil {
-						return nil, err
-					}
-					dylinkInfo.WeakBindingDat = weak
+			dylinkInfo.BindingInfoLen = dylinkInfoCmd.Bindinginfosize
+			dylinkInfo.BindingInfoOffset = uint64(dylinkInfoCmd.Bindinginfooff)
+		}
+		// Weak deets
+		if dylinkInfoCmd.Weakbindingsize > 0 {
+			if !memoryMode { // this data is in LINKEDIT already
+				weak, err := f.readBlock(r, uint64(dylinkInfoCmd.Weakbindingsize), int64(dylinkInfoCmd.Weakbindingoff))
+				if err != nil {
+					return err
 				}
-				dylinkInfo.WeakBindingLen = dylinkInfoCmd.Weakbindingsize
-				dylinkInfo.WeakBindingOffset = uint64(dylinkInfoCmd.Weakbindingoff)
+				dylinkInfo.WeakBindingDat = weak
 			}
-			// Lazy deets
-			if dylinkInfoCmd.Lazybindingsize > 0 {
-				if !memoryMode { // this data is in LINKEDIT already
-					lazy := make([]byte, dylinkInfoCmd.Lazybindingsize)
-					if _, err := r.ReadAt(lazy, int64(dylinkInfoCmd.Lazybindingoff)); err != nil {
-						return nil, err
-					}
-					dylinkInfo.LazyBindingDat = lazy
+			dylinkInfo.WeakBindingLen = dylinkInfoCmd.Weakbindingsize
+			dylinkInfo.WeakBindingOffset = uint64(dylinkInfoCmd.Weakbindingoff)
+		}
+		// Lazy deets
+		if dylinkInfoCmd.Lazybindingsize > 0 {
+			if !memoryMode { // this data is in LINKEDIT already
+				lazy, err := f.readBlock(r, uint64(dylinkInfoCmd.Lazybindingsize), int64(dylinkInfoCmd.Lazybindingoff))
+				if err != nil {
+					return err
 				}
-				dylinkInfo.LazyBindingLen = dylinkInfoCmd.Lazybindingsize
-				dylinkInfo.LazyBindingOffset = uint64(dylinkInfoCmd.Lazybindingoff)
+				dylinkInfo.LazyBindingDat = lazy
 			}
-			// ExportInfo deets
-			if dylinkInfoCmd.Exportinfosize > 0 {
-				if !memoryMode { // this data is in LINKEDIT already
-					export := make([]byte, dylinkInfoCmd.Exportinfosize)
-					if _, err := r.ReadAt(export, int64(dylinkInfoCmd.Exportinfooff)); err != nil {
-						return nil, err
-					}
-					dylinkInfo.ExportInfoDat = export
+			dylinkInfo.LazyBindingLen = dylinkInfoCmd.Lazybindingsize
+			dylinkInfo.LazyBindingOffset = uint64(dylinkInfoCmd.Lazybindingoff)
+		}
+		// ExportInfo deets
+		if dylinkInfoCmd.Exportinfosize > 0 {
+			if !memoryMode { // this data is in LINKEDIT already
+				export, err := f.readBlock(r, uint64(dylinkInfoCmd.Exportinfosize), int64(dylinkInfoCmd.Exportinfooff))
+				if err != nil {
+					return err
 				}
-				dylinkInfo.ExportInfoLen = dylinkInfoCmd.Exportinfosize
-				dylinkInfo.ExportInfoOffset = uint64(dylinkInfoCmd.Exportinfooff)
+				dylinkInfo.ExportInfoDat = export
 			}
-			// Finalize the object
-			f.DylinkInfo = &dylinkInfo
-			f.Loads[i] = LoadBytes(cmddat)
-
-		case LoadCmdDysymtab:
-			var hdr DysymtabCmd
-			b := bytes.NewReader(cmddat)
-			if err := binary.Read(b, bo, &hdr); err != nil {
-				return nil, err
-			}
-			dat := make([]byte, hdr.Nindirectsyms*4)
-			if _, err := r.ReadAt(dat, int64(hdr.Indirectsymoff)); err != nil {
-				return nil, err
-			}
-			x := make([]uint32, hdr.Nindirectsyms)
-			if err := binary.Read(bytes.NewReader(dat), bo, x); err != nil {
-				return nil, err
-			}
-			st := new(Dysymtab)
-			st.LoadBytes = LoadBytes(cmddat)
-			st.DysymtabCmd = hdr
-			st.IndirectSyms = x
-			f.Loads[i] = st
-			f.Dysymtab = st
-			f.Dysymtab.Indirectsymoff = hdr.Indirectsymoff
-			f.Dysymtab.RawDysymtab = dat
-
-		case LoadCmdSegment:
-			var seg32 Segment32
-			b := bytes.NewReader(cmddat)
-			if err := binary.Read(b, bo, &seg32); err != nil {
-				return nil, err
-			}
-			s = new(Segment)
-			s.LoadBytes = cmddat
-			s.Cmd = cmd
-			s.Len = siz
-			s.Name = cstring(seg32.Name[0:])
-			s.Addr = uint64(seg32.Addr)
-			s.Memsz = uint64(seg32.Memsz)
-			s.Offset = uint64(seg32.Offset)
-			s.Filesz = uint64(seg32.Filesz)
-			s.Maxprot = seg32.Maxprot
-			s.Prot = seg32.Prot
-			s.Nsect = seg32.Nsect
-			s.Flag = seg32.Flag
-			if uint64((seg32.Offset + seg32.Filesz)) > FinalSegEnd {
-				FinalSegEnd = uint64((seg32.Offset + seg32.Filesz))
-			}
-			f.Loads[i] = s
-			for i := 0; i < int(s.Nsect); i++ {
-				var sh32 Section32
-				if err := binary.Read(b, bo, &sh32); err != nil {
-					return nil, err
-				}
-				sh := new(Section)
-				sh.Name = cstring(sh32.Name[0:])
-				sh.Seg = cstring(sh32.Seg[0:])
-				sh.Addr = uint64(sh32.Addr)
-				sh.Size = uint64(sh32.Size)
-				sh.Offset = sh32.Offset
-				sh.Align = sh32.Align
-				sh.Reloff = sh32.Reloff
-				sh.Nreloc = sh32.Nreloc
-				sh.Flags = sh32.Flags
-				if err := f.pushSection(sh, r); err != nil {
-					return nil, err
+			dylinkInfo.ExportInfoLen = dylinkInfoCmd.Exportinfosize
+			dylinkInfo.ExportInfoOffset = uint64(dylinkInfoCmd.Exportinfooff)
+		}
+		// Finalize the object
+		f.DylinkInfo = &dylinkInfo
+		f.Loads[i] = LoadBytes(cmddat)
+
+	case LoadCmdDysymtab:
+		var hdr DysymtabCmd
+		b := bytes.NewReader(cmddat)
+		if err := binary.Read(b, bo, &hdr); err != nil {
+			return err
+		}
+		dat, err := f.readBlock(r, uint64(hdr.Nindirectsyms)*4, int64(hdr.Indirectsymoff))
+		if err != nil {
+			return err
+		}
+		x := make([]uint32, hdr.Nindirectsyms)
+		if err := binary.Read(bytes.NewReader(dat), bo, x); err != nil {
+			return err
+		}
+		st := new(Dysymtab)
+		st.LoadBytes = LoadBytes(cmddat)
+		st.DysymtabCmd = hdr
+		st.IndirectSyms = x
+		f.Loads[i] = st
+		f.Dysymtab = st
+		f.Dysymtab.Indirectsymoff = hdr.Indirectsymoff
+		f.Dysymtab.RawDysymtab = dat
+
+	case LoadCmdSegment:
+		var seg32 Segment32
+		b := bytes.NewReader(cmddat)
+		if err := binary.Read(b, bo, &seg32); err != nil {
+			return err
+		}
+		s = new(Segment)
+		s.LoadBytes = cmddat
+		s.Cmd = cmd
+		s.Len = siz
+		s.Name = cstring(seg32.Name[0:])
+		s.Addr = uint64(seg32.Addr)
+		s.Memsz = uint64(seg32.Memsz)
+		s.Offset = uint64(seg32.Offset)
+		s.Filesz = uint64(seg32.Filesz)
+		s.Maxprot = seg32.Maxprot
+		s.Prot = seg32.Prot
+		s.Nsect = seg32.Nsect
+		s.Flag = seg32.Flag
+		if uint64((seg32.Offset + seg32.Filesz)) > f.FinalSegEnd {
+			f.FinalSegEnd = uint64((seg32.Offset + seg32.Filesz))
+		}
+		f.Loads[i] = s
+		if !f.tolerant && uint64(s.Nsect)*uint64(binary.Size(Section32{})) > uint64(len(cmddat)-binary.Size(seg32)) {
+			return &FormatError{offset - int64(siz), "too many sections in segment", s.Nsect}
+		}
+		for i := 0; i < int(s.Nsect); i++ {
+			var sh32 Section32
+			if err := binary.Read(b, bo, &sh32); err != nil {
+				if !f.tolerant {
+					return err
 				}
+				f.anomaly(SeverityError, "segment %s at %#x holds %d of its %d sections", s.Name, offset-int64(siz), i, s.Nsect)
+				break
 			}
-
-		case LoadCmdSegment64:
-			var seg64 Segment64
-			b := bytes.NewReader(cmddat)
-			if err := binary.Read(b, bo, &seg64); err != nil {
-				return nil, err
-			}
-			s = new(Segment)
-			s.LoadBytes = cmddat
-			s.Cmd = cmd
-			s.Len = siz
-			s.Name = cstring(seg64.Name[0:])
-			s.Addr = seg64.Addr
-			s.Memsz = seg64.Memsz
-			s.Offset = seg64.Offset
-			s.Filesz = seg64.Filesz
-			s.Maxprot = seg64.Maxprot
-			s.Prot = seg64.Prot
-			s.Nsect = seg64.Nsect
-			s.Flag = seg64.Flag
-			if uint64((seg64.Offset + seg64.Filesz)) > FinalSegEnd {
-				FinalSegEnd = uint64((seg64.Offset + seg64.Filesz))
+			sh := new(Section)
+			sh.Name = cstring(sh32.Name[0:])
+			sh.Seg = cstring(sh32.Seg[0:])
+			sh.Addr = uint64(sh32.Addr)
+			sh.Size = uint64(sh32.Size)
+			sh.Offset = sh32.Offset
+			sh.Align = sh32.Align
+			sh.Reloff = sh32.Reloff
+			sh.Nreloc = sh32.Nreloc
+			sh.Flags = sh32.Flags
+			if err := f.pushSection(sh, r); err != nil {
+				return err
 			}
-			f.Loads[i] = s
-			for i := 0; i < int(s.Nsect); i++ {
-				var sh64 Section64
-				if err := binary.Read(b, bo, &sh64); err != nil {
-					return nil, err
-				}
-				sh := new(Section)
-				sh.Name = cstring(sh64.Name[0:])
-				sh.Seg = cstring(sh64.Seg[0:])
-				sh.Addr = sh64.Addr
-				sh.Size = sh64.Size
-				sh.Offset = sh64.Offset
-				sh.Align = sh64.Align
-				sh.Reloff = sh64.Reloff
-				sh.Nreloc = sh64.Nreloc
-				sh.Flags = sh64.Flags
-				if err := f.pushSection(sh, r); err != nil {
-					return nil, err
+		}
+
+	case LoadCmdSegment64:
+		var seg64 Segment64
+		b := bytes.NewReader(cmddat)
+		if err := binary.Read(b, bo, &seg64); err != nil {
+			return err
+		}
+		s = new(Segment)
+		s.LoadBytes = cmddat
+		s.Cmd = cmd
+		s.Len = siz
+		s.Name = cstring(seg64.Name[0:])
+		s.Addr = seg64.Addr
+		s.Memsz = seg64.Memsz
+		s.Offset = seg64.Offset
+		s.Filesz = seg64.Filesz
+		s.Maxprot = seg64.Maxprot
+		s.Prot = seg64.Prot
+		s.Nsect = seg64.Nsect
+		s.Flag = seg64.Flag
+		if uint64((seg64.Offset + seg64.Filesz)) > f.FinalSegEnd {
+			f.FinalSegEnd = uint64((seg64.Offset + seg64.Filesz))
+		}
+		f.Loads[i] = s
+		if !f.tolerant && uint64(s.Nsect)*uint64(binary.Size(Section64{})) > uint64(len(cmddat)-binary.Size(seg64)) {
+			return &FormatError{offset - int64(siz), "too many sections in segment", s.Nsect}
+		}
+		for i := 0; i < int(s.Nsect); i++ {
+			var sh64 Section64
+			if err := binary.Read(b, bo, &sh64); err != nil {
+				if !f.tolerant {
+					return err
 				}
+				f.anomaly(SeverityError, "segment %s at %#x holds %d of its %d sections", s.Name, offset-int64(siz), i, s.Nsect)
+				break
 			}
-
-		//case LoadCmdUnixThread:
-		// todo: do we have to support thread_command here for older binaries? or is the LC_MAIN handling backwards compatible?
-
-		case LoadCmdMain:
-			var entryPoint EntryPointCmd
-			b := bytes.NewReader(cmddat)
-			if err := binary.Read(b, bo, &entryPoint); err != nil {
-				return nil, err
+			sh := new(Section)
+			sh.Name = cstring(sh64.Name[0:])
+			sh.Seg = cstring(sh64.Seg[0:])
+			sh.Addr = sh64.Addr
+			sh.Size = sh64.Size
+			sh.Offset = sh64.Offset
+			sh.Align = sh64.Align
+			sh.Reloff = sh64.Reloff
+			sh.Nreloc = sh64.Nreloc
+			sh.Flags = sh64.Flags
+			if err := f.pushSection(sh, r); err != nil {
+				return err
 			}
-			f.EntryPoint = entryPoint.EntryOff
 		}
-		if s != nil {
-			if !memoryMode {
-				s.sr = io.NewSectionReader(r, int64(s.Offset), int64(s.Filesz))
-			} else {
-				s.sr = io.NewSectionReader(r, int64(s.Addr), int64(s.Filesz))
-			}
-			s.ReaderAt = s.sr
+
+	}
+	if s != nil {
+		if !memoryMode {
+			s.sr = io.NewSectionReader(r, int64(s.Offset), int64(s.Filesz))
+		} else {
+			s.sr = io.NewSectionReader(r, int64(s.Addr), int64(s.Filesz))
 		}
+		s.ReaderAt = s.sr
 	}
-	return f, nil
+	return nil
 }
 
 func (f *File) parseSymtab(symdat, strtab, cmddat []byte, hdr *SymtabCmd, offset int64) (*Symtab, error) {
 	bo := f.ByteOrder
 	symtab := make([]Symbol, hdr.Nsyms)
 	b := bytes.NewReader(symdat)
+	var badNames int
 	for i := range symtab {
 		var n Nlist64
 		if f.Magic == Magic64 {
@@ -733,7 +926,11 @@ func (f *File) parseSymtab(symdat, strtab, cmddat []byte, hdr *SymtabCmd, offset
 		}
 		sym := &symtab[i]
 		if n.Name >= uint32(len(strtab)) {
-			return nil, &FormatError{offset, "invalid name in symbol table", n.Name}
+			if !f.tolerant {
+				return nil, &FormatError{offset, "invalid name in symbol table", n.Name}
+			}
+			badNames++
+			n.Name = uint32(len(strtab))
 		}
 		sym.Name = cstring(strtab[n.Name:])
 		sym.Type = n.Type
@@ -741,8 +938,12 @@ func (f *File) parseSymtab(symdat, strtab, cmddat []byte, hdr *SymtabCmd, offset
 		sym.Desc = n.Desc
 		sym.Value = n.Value
 	}
+	if badNames > 0 {
+		f.anomaly(SeverityError, "%d symbols have names outside the string table", badNames)
+	}
 	st := new(Symtab)
 	st.LoadBytes = LoadBytes(cmddat)
+	st.SymtabCmd = *hdr
 	st.Syms = symtab
 	st.RawSymtab = symdat
 	st.RawStringtab = strtab
@@ -758,11 +959,15 @@ func (f *File) pushSection(sh *Section, r io.ReaderAt) error {
 	f.Sections = append(f.Sections, sh)
 	sh.sr = io.NewSectionReader(r, int64(sh.Offset), int64(sh.Size))
 	sh.ReaderAt = sh.sr
+	if m, ok := r.(*mmap.Mapping); ok && sh.Offset != 0 && uint64(sh.Offset)+sh.Size <= uint64(len(m.Data())) {
+		end := uint64(sh.Offset) + sh.Size
+		sh.view, sh.viewSR = m.Data()[sh.Offset:end:end], sh.sr
+	}
 
 	if sh.Nreloc > 0 {
-		reldat := make([]byte, int(sh.Nreloc)*8)
-		if _, err := r.ReadAt(reldat, int64(sh.Reloff)); err != nil {
-			return err
+		reldat, err := f.readBlock(r, uint64(sh.Nreloc)*8, int64(sh.Reloff))
+		if err != nil {
+			return f.tolerate(err)
 		}
 		b := bytes.NewReader(reldat)
 
@@ -820,23 +1025,31 @@ func cstring(b []byte) string {
 
 // Segment returns the first Segment with the given name, or nil if no such segment exists.
 func (f *File) Segment(name string) *Segment {
-	for _, l := range f.Loads {
-		if s, ok := l.(*Segment); ok && s.Name == name {
-			return s
+	for i := 0; ; {
+		for n := f.decodedLoads(); i < n; i++ {
+			if s, ok := f.Loads[i].(*Segment); ok && s.Name == name {
+				return s
+			}
+		}
+		if !f.decodeNext() {
+			return nil
 		}
 	}
-	return nil
 }
 
 // Section returns the first section with the given name, or nil if no such
 // section exists.
 func (f *File) Section(name string) *Section {
-	for _, s := range f.Sections {
-		if s.Name == name {
-			return s
+	for i := 0; ; {
+		for ; i < len(f.Sections); i++ {
+			if f.Sections[i].Name == name {
+				return f.Sections[i]
+			}
+		}
+		if !f.decodeNext() {
+			return nil
 		}
 	}
-	return nil
 }
 
 // DWARF returns the DWARF debug information for the Mach-O file.
@@ -860,12 +1073,12 @@ func (f *File) DWARF() (*dwarf.Data, error) {
 
 		if len(b) >= 12 && string(b[:4]) == "ZLIB" {
 			dlen := binary.BigEndian.Uint64(b[4:12])
-			dbuf := make([]byte, dlen)
 			r, err := zlib.NewReader(bytes.NewBuffer(b[12:]))
 			if err != nil {
 				return nil, err
 			}
-			if _, err := io.ReadFull(r, dbuf); err != nil {
+			dbuf, err := readerat.ReadData(r, dlen)
+			if err != nil {
 				return nil, err
 			}
 			if err := r.Close(); err != nil {
@@ -5,7 +5,10 @@
 package macho
 
 import (
+	"bytes"
+	"io/ioutil"
 	"reflect"
+	"sync"
 	"testing"
 )
 
@@ -377,3 +380,45 @@ func TestTypeString(t *testing.T) {
 		t.Errorf("got %v, want %v", TypeExec.GoString(), "macho.Exec")
 	}
 }
+
+func TestFinalSegEndPerFile(t *testing.T) {
+	exec, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exec.Close()
+	raw, err := ioutil.ReadFile("testdata/clang-amd64-darwin.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := NewFile(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.FinalSegEnd >= exec.FinalSegEnd {
+		t.Fatalf("FinalSegEnd of the object is %#x, want less than %#x", obj.FinalSegEnd, exec.FinalSegEnd)
+	}
+	want, err := exec.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Writing one file must not pad the other to its last segment.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if b, err := obj.Bytes(); err != nil || !bytes.Equal(b, raw) {
+				t.Errorf("object written concurrently is %d bytes, want %d, %v", len(b), len(raw), err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if b, err := exec.Bytes(); err != nil || !bytes.Equal(b, want) {
+				t.Errorf("executable written concurrently is %d bytes, want %d, %v", len(b), len(want), err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,79 @@
+//go:build go1.18
+// +build go1.18
+
+package macho
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func fuzzSeeds(f *testing.F) {
+	names, _ := filepath.Glob("testdata/*")
+	for _, name := range names {
+		if filepath.Ext(name) == ".c" {
+			continue
+		}
+		if data, err := ioutil.ReadFile(name); err == nil && len(data) < 1<<20 {
+			f.Add(data)
+		}
+	}
+	if data, err := endlessBinds("testdata/clang-amd64-darwin-exec-with-rpath"); err == nil {
+		f.Add(data)
+	}
+}
+
+func FuzzNewFile(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		mf, err := NewFile(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// None of these may panic, whatever the file holds.
+		for _, s := range mf.Sections {
+			s.Data()
+		}
+		mf.ImportedSymbols()
+		mf.ImportedLibraries()
+		mf.Binds()
+		mf.LazyBinds()
+		mf.Rebases()
+		mf.ThreadedFixups()
+		mf.ObjCClasses()
+		mf.DWARF()
+		mf.Validate()
+	})
+}
+
+func FuzzNewFileTolerant(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		mf, err := NewFileTolerant(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		for _, s := range mf.Sections {
+			s.Data()
+		}
+		mf.Describe()
+		mf.Validate()
+	})
+}
+
+func FuzzNewFatFile(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ff, err := NewFatFile(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		for _, a := range ff.Arches {
+			for _, s := range a.Sections {
+				s.Data()
+			}
+		}
+	})
+}
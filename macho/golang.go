@@ -0,0 +1,140 @@
+package macho
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/Binject/debug/gosym"
+)
+
+// ErrNoGoMetadata is returned by File.GoPclntab, File.GoBuildInfo and
+// File.GoBuildID when the requested Go metadata cannot be found.
+var ErrNoGoMetadata = gosym.ErrNoGoMetadata
+
+// GoPclntab returns the contents of the Go pclntab and its virtual
+// address. The data can be passed to gosym.NewLineTable.
+//
+// The __gopclntab section is used if present. Otherwise the sections are
+// searched for a valid pclntab header, and the data runs to the end of the
+// section that holds it.
+func (f *File) GoPclntab() ([]byte, uint64, error) {
+	if s := f.Section("__gopclntab"); s != nil && !isZerofill(s.Flags) {
+		data, err := s.Data()
+		if err != nil {
+			return nil, 0, err
+		}
+		return data, s.Addr, nil
+	}
+	var (
+		found []byte
+		addr  uint64
+	)
+	err := f.goSearch(func(data []byte, s *Section) bool {
+		if i := gosym.FindPclntab(data, f.ByteOrder); i >= 0 {
+			found, addr = data[i:], s.Addr+uint64(i)
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if found == nil {
+		return nil, 0, ErrNoGoMetadata
+	}
+	return found, addr, nil
+}
+
+// ApplyGoRenameMap renames the functions in the Go pclntab as described
+// by gosym.LineTable.ApplyRenameMap and stores the patched table in the
+// section that holds it, ready for Bytes or WriteFile.
+func (f *File) ApplyGoRenameMap(renames map[string]string) error {
+	pcln, addr, err := f.GoPclntab()
+	if err != nil {
+		return err
+	}
+	patched, err := gosym.NewLineTable(pcln, 0).ApplyRenameMap(renames)
+	if err != nil {
+		return err
+	}
+	s := f.sectionForAddr(addr)
+	if s == nil {
+		return errors.New("pclntab is not inside a section")
+	}
+	data, err := s.Data()
+	if err != nil {
+		return err
+	}
+	copy(data[addr-s.Addr:], patched)
+	s.Replace(bytes.NewReader(data), int64(len(data)))
+	return nil
+}
+
+// GoBuildInfo returns the Go build information blob, starting at its
+// "\xff Go buildinf:" header, and its virtual address. The __go_buildinfo
+// section is used if present; otherwise the sections are searched.
+func (f *File) GoBuildInfo() ([]byte, uint64, error) {
+	if s := f.Section("__go_buildinfo"); s != nil && !isZerofill(s.Flags) {
+		data, err := s.Data()
+		if err != nil {
+			return nil, 0, err
+		}
+		if gosym.FindBuildInfo(data) == 0 {
+			return data, s.Addr, nil
+		}
+	}
+	var (
+		found []byte
+		addr  uint64
+	)
+	err := f.goSearch(func(data []byte, s *Section) bool {
+		if i := gosym.FindBuildInfo(data); i >= 0 {
+			found, addr = data[i:], s.Addr+uint64(i)
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if found == nil {
+		return nil, 0, ErrNoGoMetadata
+	}
+	return found, addr, nil
+}
+
+// GoBuildID returns the Go build ID that the linker writes at the start
+// of the text section.
+func (f *File) GoBuildID() (string, error) {
+	for _, s := range f.Sections {
+		if s.Seg != "__TEXT" || isZerofill(s.Flags) || s.Size == 0 {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return "", err
+		}
+		if id, ok := gosym.FindBuildID(data); ok {
+			return id, nil
+		}
+	}
+	return "", ErrNoGoMetadata
+}
+
+// goSearch calls fn with the contents of each section that has data in
+// the file, until fn returns true.
+func (f *File) goSearch(fn func(data []byte, s *Section) bool) error {
+	for _, s := range f.Sections {
+		if isZerofill(s.Flags) || s.Size == 0 || s.Offset == 0 {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return err
+		}
+		if fn(data, s) {
+			return nil
+		}
+	}
+	return nil
+}
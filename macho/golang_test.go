@@ -0,0 +1,100 @@
+package macho
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/Binject/debug/internal/gobuild"
+)
+
+func TestGoMetadata(t *testing.T) {
+	for _, goarch := range []string{"amd64", "arm64"} {
+		exe := gobuild.Binary(t, "darwin", goarch)
+		out, err := exec.Command("go", "tool", "buildid", exe).Output()
+		if err != nil {
+			t.Fatalf("go tool buildid: %v", err)
+		}
+		wantID := strings.TrimSpace(string(out))
+
+		f, err := Open(exe)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, pclnAddr, err := f.GoPclntab()
+		if err != nil {
+			t.Fatalf("%s: GoPclntab: %v", goarch, err)
+		}
+		if s := f.Section("__gopclntab"); pclnAddr != s.Addr {
+			t.Errorf("%s: GoPclntab address %#x, want %#x", goarch, pclnAddr, s.Addr)
+		}
+		info, infoAddr, err := f.GoBuildInfo()
+		if err != nil {
+			t.Fatalf("%s: GoBuildInfo: %v", goarch, err)
+		}
+		if !bytes.HasPrefix(info, []byte("\xff Go buildinf:")) {
+			t.Errorf("%s: GoBuildInfo returned data without the build info header", goarch)
+		}
+		if id, err := f.GoBuildID(); err != nil || id != wantID {
+			t.Errorf("%s: GoBuildID = %q, %v; want %q", goarch, id, err, wantID)
+		}
+
+		// Renamed sections are found by scanning.
+		for _, s := range f.Sections {
+			s.Name = "__renamed"
+		}
+		if _, addr, err := f.GoPclntab(); err != nil || addr != pclnAddr {
+			t.Errorf("%s: GoPclntab after renaming = %#x, %v; want %#x", goarch, addr, err, pclnAddr)
+		}
+		if _, addr, err := f.GoBuildInfo(); err != nil || addr != infoAddr {
+			t.Errorf("%s: GoBuildInfo after renaming = %#x, %v; want %#x", goarch, addr, err, infoAddr)
+		}
+		f.Close()
+	}
+}
+
+func TestGoMetadataNotGo(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, _, err := f.GoPclntab(); err != ErrNoGoMetadata {
+		t.Errorf("GoPclntab error = %v, want ErrNoGoMetadata", err)
+	}
+	if _, _, err := f.GoBuildInfo(); err != ErrNoGoMetadata {
+		t.Errorf("GoBuildInfo error = %v, want ErrNoGoMetadata", err)
+	}
+	if _, err := f.GoBuildID(); err != ErrNoGoMetadata {
+		t.Errorf("GoBuildID error = %v, want ErrNoGoMetadata", err)
+	}
+}
+
+func TestApplyGoRenameMap(t *testing.T) {
+	f, err := Open(gobuild.Binary(t, "darwin", "arm64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.PreserveRaw = true
+	if err := f.ApplyGoRenameMap(map[string]string{"main.main": "main.xx"}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcln, _, err := g.GoPclntab()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(pcln, []byte("\x00main.xx\x00")) || bytes.Contains(pcln, []byte("\x00main.main\x00")) {
+		t.Error("main.main was not renamed")
+	}
+}
@@ -0,0 +1,136 @@
+package macho
+
+import (
+	"errors"
+	"fmt"
+)
+
+// execOnlyFlags are the header flags that only the kernel reads, when it
+// loads an executable.
+const execOnlyFlags = FlagPIE | FlagNoHeapExecution | FlagAllowStackExecution
+
+// checkFlags reports an error if flags is not a valid set of header
+// flags for a file of type typ.
+func checkFlags(typ Type, flags uint32) error {
+	switch {
+	case typ != TypeExec && flags&execOnlyFlags != 0:
+		return fmt.Errorf("header flags %#x are only valid for executables", flags&execOnlyFlags)
+	case typ != TypeDylib && flags&FlagDeadStrippableDylib != 0:
+		return errors.New("MH_DEAD_STRIPPABLE_DYLIB is only valid for dylibs")
+	case flags&FlagTwoLevel != 0 && flags&FlagForceFlat != 0:
+		return errors.New("MH_TWOLEVEL and MH_FORCE_FLAT are exclusive")
+	}
+	return nil
+}
+
+// SetFlags sets the flags of the file header, after checking that they
+// are valid for the type of the file. Patching the header invalidates the
+// code signature, which has to be made again.
+func (f *File) SetFlags(flags uint32) error {
+	if err := checkFlags(f.Type, flags); err != nil {
+		return err
+	}
+	f.Flags = flags
+	return nil
+}
+
+func (f *File) setFlag(flag uint32, on bool) error {
+	flags := f.Flags &^ flag
+	if on {
+		flags |= flag
+	}
+	return f.SetFlags(flags)
+}
+
+// PIE reports whether MH_PIE is set, which makes the kernel load the
+// executable at a random address.
+func (f *File) PIE() bool { return f.Flags&FlagPIE != 0 }
+
+// NoHeapExecution reports whether MH_NO_HEAP_EXECUTION is set, which
+// makes the heap of a 32-bit process non-executable.
+func (f *File) NoHeapExecution() bool { return f.Flags&FlagNoHeapExecution != 0 }
+
+// AllowStackExecution reports whether MH_ALLOW_STACK_EXECUTION is set,
+// which makes the stacks of the process executable.
+func (f *File) AllowStackExecution() bool { return f.Flags&FlagAllowStackExecution != 0 }
+
+// SetNoHeapExecution sets or clears MH_NO_HEAP_EXECUTION as SetFlags
+// does.
+func (f *File) SetNoHeapExecution(on bool) error { return f.setFlag(FlagNoHeapExecution, on) }
+
+// SetAllowStackExecution sets or clears MH_ALLOW_STACK_EXECUTION as
+// SetFlags does.
+func (f *File) SetAllowStackExecution(on bool) error {
+	return f.setFlag(FlagAllowStackExecution, on)
+}
+
+// SetPIE sets or clears MH_PIE as SetFlags does. Setting it also grows
+// __PAGEZERO to reach the lowest other segment, as ld lays out a PIE, so
+// that the memory below the slid image stays unmapped. Clearing it
+// leaves the segments alone: a __PAGEZERO shrunk to link the image below
+// 4 GB is what lets it load at its link addresses. __PAGEZERO is never
+// shrunk; see SetPageZeroSize for that.
+func (f *File) SetPIE(on bool) error {
+	if err := f.setFlag(FlagPIE, on); err != nil {
+		return err
+	}
+	if !on {
+		return nil
+	}
+	pz := f.Segment("__PAGEZERO")
+	if pz == nil || pz.Addr != 0 {
+		return nil
+	}
+	if low := f.lowestSegment(pz); low != ^uint64(0) && low > pz.Memsz {
+		return f.SetPageZeroSize(low)
+	}
+	return nil
+}
+
+// PageZeroSize returns the size of the __PAGEZERO segment, which reserves
+// the memory from address 0, or 0 if there is none.
+func (f *File) PageZeroSize() uint64 {
+	if pz := f.Segment("__PAGEZERO"); pz != nil && pz.Addr == 0 {
+		return pz.Memsz
+	}
+	return 0
+}
+
+// SetPageZeroSize sets the size of the __PAGEZERO segment, as ld's
+// -pagezero_size does: 4 GB by default on 64-bit executables, so that
+// truncated pointers fault, or less, down to a page, to let a non-PIE
+// image be linked and loaded below 4 GB. The size is a multiple of the
+// page size and must not reach the other segments.
+func (f *File) SetPageZeroSize(size uint64) error {
+	pz := f.Segment("__PAGEZERO")
+	if pz == nil || pz.Addr != 0 {
+		return errors.New("no __PAGEZERO segment at address 0")
+	}
+	page := uint64(0x1000)
+	if f.Cpu == CpuArm64 {
+		page = 0x4000
+	}
+	if size == 0 || size%page != 0 {
+		return fmt.Errorf("__PAGEZERO size %#x is not a positive multiple of the page size %#x", size, page)
+	}
+	if f.Magic == Magic32 && size > 1<<32-page {
+		return fmt.Errorf("__PAGEZERO size %#x does not fit a 32-bit address space", size)
+	}
+	if low := f.lowestSegment(pz); size > low {
+		return fmt.Errorf("__PAGEZERO of %#x bytes would overlap the segment at %#x", size, low)
+	}
+	pz.Memsz = size
+	return f.updateSegmentLoad(pz)
+}
+
+// lowestSegment returns the lowest address of the segments other than
+// skip that occupy memory.
+func (f *File) lowestSegment(skip *Segment) uint64 {
+	low := ^uint64(0)
+	for _, s := range f.segments() {
+		if s != skip && s.Memsz != 0 && s.Addr < low {
+			low = s.Addr
+		}
+	}
+	return low
+}
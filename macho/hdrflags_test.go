@@ -0,0 +1,80 @@
+package macho
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHeaderFlags(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if !f.PIE() || f.NoHeapExecution() || f.AllowStackExecution() {
+		t.Fatalf("flags are %#x", f.Flags)
+	}
+	if err := f.SetAllowStackExecution(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetNoHeapExecution(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetFlags(f.Flags | FlagForceFlat); err == nil {
+		t.Error("SetFlags accepted MH_TWOLEVEL with MH_FORCE_FLAT")
+	}
+	if err := f.SetFlags(f.Flags | FlagDeadStrippableDylib); err == nil {
+		t.Error("SetFlags accepted MH_DEAD_STRIPPABLE_DYLIB on an executable")
+	}
+
+	// SetPageZeroSize shrinks __PAGEZERO, which clearing PIE keeps and
+	// setting it grows back up to __TEXT.
+	if size := f.PageZeroSize(); size != 1<<32 {
+		t.Fatalf("__PAGEZERO is %#x bytes", size)
+	}
+	if err := f.SetPageZeroSize(1<<32 + 0x1000); err == nil {
+		t.Error("SetPageZeroSize let __PAGEZERO overlap __TEXT")
+	}
+	if err := f.SetPageZeroSize(0x1800); err == nil {
+		t.Error("SetPageZeroSize accepted a size that is not a multiple of the page size")
+	}
+	if err := f.SetPageZeroSize(0x1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetPIE(false); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f2.PIE() || !f2.NoHeapExecution() || !f2.AllowStackExecution() {
+		t.Errorf("flags are %#x after writing", f2.Flags)
+	}
+	if size := f2.PageZeroSize(); size != 0x1000 {
+		t.Errorf("__PAGEZERO is %#x bytes after clearing PIE, want it kept", size)
+	}
+	if err := f2.SetPIE(true); err != nil {
+		t.Fatal(err)
+	}
+	if size := f2.PageZeroSize(); size != 1<<32 {
+		t.Errorf("__PAGEZERO is %#x bytes after setting PIE, want it grown up to __TEXT", size)
+	}
+
+	obj, err := Open("testdata/clang-amd64-darwin.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	if err := obj.SetPIE(true); err == nil {
+		t.Error("SetPIE accepted an object file")
+	}
+	if err := obj.SetPageZeroSize(0x1000); err == nil {
+		t.Error("SetPageZeroSize accepted a file without __PAGEZERO")
+	}
+}
@@ -0,0 +1,89 @@
+package macho
+
+import (
+	"errors"
+	"fmt"
+)
+
+// isIdentityCmd reports whether cmd is one of the load commands copied by
+// CloneIdentity.
+func isIdentityCmd(cmd LoadCmd) bool {
+	switch cmd {
+	case LoadCmdUUID, LoadCmdSourceVersion, LoadCmdBuildVersion,
+		LoadCmdVersionMinMacosx, LoadCmdVersionMinIphoneos, LoadCmdVersionMinTvos, LoadCmdVersionMinWatchos:
+		return true
+	}
+	return false
+}
+
+// CloneIdentity replaces the LC_UUID, LC_BUILD_VERSION, LC_VERSION_MIN_*
+// and LC_SOURCE_VERSION load commands of f with those of src. The donor
+// commands take the place of the first command they replace, or are
+// appended to the load commands if f has none of them.
+//
+// The new load commands must fit in the space before the first section.
+// A code signature of f is invalidated.
+func (f *File) CloneIdentity(src *File) error {
+	if f.ByteOrder != src.ByteOrder {
+		return errors.New("cannot clone the identity of a file with a different byte order")
+	}
+	var donor []Load
+	for _, l := range src.Loads {
+		raw := l.Raw()
+		if len(raw) >= 8 && isIdentityCmd(LoadCmd(src.ByteOrder.Uint32(raw))) {
+			donor = append(donor, LoadBytes(append([]byte(nil), raw...)))
+		}
+	}
+
+	var loads []Load
+	insert := -1
+	for _, l := range f.Loads {
+		raw := l.Raw()
+		if len(raw) >= 8 && isIdentityCmd(LoadCmd(f.ByteOrder.Uint32(raw))) {
+			if insert < 0 {
+				insert = len(loads)
+			}
+			continue
+		}
+		loads = append(loads, l)
+	}
+	if insert < 0 {
+		insert = len(loads)
+	}
+	loads = append(loads[:insert], append(donor, loads[insert:]...)...)
+
+	var cmdsz uint64
+	for _, l := range loads {
+		cmdsz += uint64(len(l.Raw()))
+	}
+	if end, room := f.loadCommandsStart()+cmdsz+uint64(len(f.Insertion)), f.loadCommandsRoom(); end > room {
+		return fmt.Errorf("load commands would end at %#x, past the first section at %#x", end, room)
+	}
+	f.Loads = loads
+	f.Ncmd = uint32(len(loads))
+	f.Cmdsz = uint32(cmdsz)
+	return nil
+}
+
+// loadCommandsStart returns the file offset of the first load command.
+func (f *File) loadCommandsStart() uint64 {
+	if f.Magic == Magic64 {
+		return fileHeaderSize64
+	}
+	return fileHeaderSize32
+}
+
+// loadCommandsRoom returns the file offset the load commands may extend
+// to: the start of the first section with contents in the file.
+func (f *File) loadCommandsRoom() uint64 {
+	room := ^uint64(0)
+	for _, s := range f.Sections {
+		if isZerofill(s.Flags) || s.Size == 0 || s.Offset == 0 {
+			continue
+		}
+		if uint64(s.Offset) < room {
+			room = uint64(s.Offset)
+		}
+	}
+	return room
+}
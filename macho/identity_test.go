@@ -0,0 +1,75 @@
+package macho
+
+import (
+	"bytes"
+	"testing"
+)
+
+// identityCmds returns the raw identity load commands of f.
+func identityCmds(f *File) [][]byte {
+	var cmds [][]byte
+	for _, l := range f.Loads {
+		if raw := l.Raw(); isIdentityCmd(LoadCmd(f.ByteOrder.Uint32(raw))) {
+			cmds = append(cmds, raw)
+		}
+	}
+	return cmds
+}
+
+func TestCloneIdentity(t *testing.T) {
+	dst, err := Open("testdata/gcc-amd64-darwin-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	src, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	want := identityCmds(src)
+	if len(want) != 3 {
+		t.Fatalf("donor has %d identity load commands, want 3", len(want))
+	}
+	ncmd := dst.Ncmd
+	if err := dst.CloneIdentity(src); err != nil {
+		t.Fatal(err)
+	}
+	b, err := dst.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The UUID of dst was replaced, the other two were added.
+	if g.Ncmd != ncmd+2 {
+		t.Errorf("got %d load commands, want %d", g.Ncmd, ncmd+2)
+	}
+	got := identityCmds(g)
+	if len(got) != len(want) {
+		t.Fatalf("got %d identity load commands, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Errorf("identity load command %d = %x, want %x", i, got[i], want[i])
+		}
+	}
+	for _, issue := range g.Validate() {
+		if issue.Severity >= SeverityError {
+			t.Errorf("unexpected issue: %v", issue)
+		}
+	}
+
+	// The load commands of an object file run right into its first section.
+	obj, err := Open("testdata/clang-amd64-darwin.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	if err := obj.CloneIdentity(src); err == nil {
+		t.Error("CloneIdentity added load commands that do not fit")
+	}
+}
@@ -0,0 +1,86 @@
+package macho
+
+import "github.com/Binject/debug/internal/mmap"
+
+// A pendingLoad is a load command that OpenLazy has not decoded yet:
+// load command i of type cmd, held in dat, which ends at offset.
+type pendingLoad struct {
+	i      int
+	cmd    LoadCmd
+	dat    []byte
+	offset int64
+}
+
+// OpenLazy opens the named file for tools that need little of it. The
+// file is mapped into memory and only its header is decoded: the load
+// commands are held as LoadBytes in Loads and decoded, in order, when
+// Load, Segment, Section, DecodeLoads or Bytes needs them. Until then the
+// Sections, Symtab and other fields the commands set are missing, so call
+// DecodeLoads before using the rest of the File.
+//
+// Data of a section returns a slice of the mapping, until the section is
+// replaced. The mapping is private: modifying such a slice changes what
+// later reads of the File see, but not the file on disk. The slices are
+// only valid until Close. Where files cannot be mapped, the file is read
+// into memory once instead.
+func OpenLazy(name string) (*File, error) {
+	m, err := mmap.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := newFileInternal(m, false, false, true)
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+	f.closer = m
+	return f, nil
+}
+
+// Load returns load command i, decoding it and the commands before it if
+// the File was opened by OpenLazy and they are not decoded yet.
+func (f *File) Load(i int) (Load, error) {
+	if i < 0 || i >= len(f.Loads) {
+		return nil, &FormatError{0, "load command index out of range", i}
+	}
+	for i >= f.decodedLoads() && f.decodeNext() {
+	}
+	if i >= f.decodedLoads() {
+		return nil, f.lazyErr
+	}
+	return f.Loads[i], nil
+}
+
+// DecodeLoads decodes the load commands that OpenLazy left undecoded, so
+// that the File is as Open would have returned it.
+func (f *File) DecodeLoads() error {
+	for f.decodeNext() {
+	}
+	return f.lazyErr
+}
+
+// decodedLoads returns the number of leading load commands that are
+// decoded.
+func (f *File) decodedLoads() int {
+	if len(f.pending) > 0 {
+		return f.pending[0].i
+	}
+	return len(f.Loads)
+}
+
+// decodeNext decodes the first pending load command. It returns false if
+// there is none, or if decoding it or an earlier one failed.
+func (f *File) decodeNext() bool {
+	if len(f.pending) == 0 || f.lazyErr != nil {
+		return false
+	}
+	p := f.pending[0]
+	if f.lazyErr = f.parseLoad(f.raw, p.i, p.cmd, p.dat, p.offset, false); f.lazyErr != nil {
+		return false
+	}
+	f.pending = f.pending[1:]
+	if len(f.pending) == 0 {
+		f.pending = nil
+	}
+	return true
+}
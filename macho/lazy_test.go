@@ -0,0 +1,89 @@
+package macho
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestOpenLazy(t *testing.T) {
+	const name = "testdata/gcc-amd64-darwin-exec"
+	want, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer want.Close()
+	f, err := OpenLazy(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.FileHeader != want.FileHeader || len(f.Loads) != len(want.Loads) {
+		t.Fatalf("header %+v with %d loads, want %+v with %d", f.FileHeader, len(f.Loads), want.FileHeader, len(want.Loads))
+	}
+	if len(f.Sections) != 0 || f.Symtab != nil {
+		t.Fatal("OpenLazy decoded load commands")
+	}
+
+	text := f.Section("__text")
+	if text == nil {
+		t.Fatal("no __text section")
+	}
+	if f.Symtab != nil || f.decodedLoads() == len(f.Loads) {
+		t.Errorf("Section decoded %d of %d load commands", f.decodedLoads(), len(f.Loads))
+	}
+	d, err := text.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := want.Section("__text").Data()
+	if !bytes.Equal(d, wd) {
+		t.Error("__text differs")
+	}
+	if d2, _ := text.Data(); &d2[0] != &d[0] {
+		t.Error("__text was copied")
+	}
+	if f.Section("__nosuchsection") != nil || f.decodedLoads() != len(f.Loads) {
+		t.Error("looking up a missing section did not decode every load command")
+	}
+
+	g, err := OpenLazy(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	last := len(g.Loads) - 1
+	if l, err := g.Load(last); err != nil || reflect.TypeOf(l) != reflect.TypeOf(want.Loads[last]) {
+		t.Errorf("Load(%d) = %T, %v, want %T", last, l, err, want.Loads[last])
+	}
+	if _, err := g.Load(len(g.Loads)); err == nil {
+		t.Error("Load accepted an index past the last load command")
+	}
+	if err := g.DecodeLoads(); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Sections) != len(want.Sections) || !reflect.DeepEqual(g.Symtab.Syms, want.Symtab.Syms) {
+		t.Error("decoded File differs from the one Open returned")
+	}
+	b, err := g.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wb, err := want.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, wb) {
+		t.Error("Bytes differs from that of the File Open returned")
+	}
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Sections[0].Data(); err == nil {
+		t.Error("Data of a section after Close returned no error")
+	}
+
+	if _, err := OpenLazy("testdata/no-such-file"); err == nil {
+		t.Error("OpenLazy opened a missing file")
+	}
+}
@@ -0,0 +1,104 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// LinkerOptions returns the options of all LC_LINKER_OPTION commands of
+// f, one slice per command.
+func (f *File) LinkerOptions() [][]string {
+	var opts [][]string
+	for _, l := range f.Loads {
+		if lo, ok := l.(*LinkerOption); ok {
+			opts = append(opts, lo.Options)
+		}
+	}
+	return opts
+}
+
+// AddLinkerOption adds an LC_LINKER_OPTION command with the given
+// options, such as "-framework", "Foundation", to the load commands of an
+// object file, as insertLoad orders it. The new command must fit in the
+// space before the first section.
+func (f *File) AddLinkerOption(opts ...string) (*LinkerOption, error) {
+	if f.Type != TypeObj {
+		return nil, fmt.Errorf("cannot add linker options to a %v file", f.Type)
+	}
+	if len(opts) == 0 {
+		return nil, errors.New("no linker options")
+	}
+	var b bytes.Buffer
+	binary.Write(&b, f.ByteOrder, LinkerOptionCmd{Cmd: LoadCmdLinkerOption, Count: uint32(len(opts))})
+	for _, o := range opts {
+		if bytes.IndexByte([]byte(o), 0) >= 0 {
+			return nil, fmt.Errorf("linker option %q contains a NUL byte", o)
+		}
+		b.WriteString(o)
+		b.WriteByte(0)
+	}
+	align := 4
+	if f.Magic == Magic64 {
+		align = 8
+	}
+	for b.Len()%align != 0 {
+		b.WriteByte(0)
+	}
+	raw := b.Bytes()
+	f.ByteOrder.PutUint32(raw[4:], uint32(len(raw)))
+
+	if err := f.checkLoadCommandsSize(int64(len(raw))); err != nil {
+		return nil, err
+	}
+	l := &LinkerOption{LoadBytes: LoadBytes(raw), Options: append([]string(nil), opts...)}
+	f.insertLoad(l)
+	return l, nil
+}
+
+// Bitcode returns the embedded LLVM bitcode of f: the xar archive in the
+// __LLVM,__bundle section of a linked image, or the bitcode in the
+// __LLVM,__bitcode section of an object file. It returns nil if f has
+// no bitcode.
+func (f *File) Bitcode() ([]byte, error) {
+	for _, s := range f.Sections {
+		if s.Seg == "__LLVM" && (s.Name == "__bundle" || s.Name == "__bitcode") {
+			return s.Data()
+		}
+	}
+	return nil, nil
+}
+
+// relocBytes encodes the relocations of s in the format pushSection
+// reads them in.
+func (f *File) relocBytes(s *Section) []byte {
+	bo := f.ByteOrder
+	var b bytes.Buffer
+	for _, rel := range s.Relocs {
+		var ri relocInfo
+		if rel.Scattered {
+			ri.Addr = 1<<31 | rel.Addr&(1<<24-1) | uint32(rel.Type&0xf)<<24 | uint32(rel.Len&3)<<28
+			if rel.Pcrel {
+				ri.Addr |= 1 << 30
+			}
+			ri.Symnum = rel.Value
+		} else {
+			ri.Addr = rel.Addr
+			var pcrel, extern uint32
+			if rel.Pcrel {
+				pcrel = 1
+			}
+			if rel.Extern {
+				extern = 1
+			}
+			if bo == binary.LittleEndian {
+				ri.Symnum = rel.Value&(1<<24-1) | pcrel<<24 | uint32(rel.Len&3)<<25 | extern<<27 | uint32(rel.Type&0xf)<<28
+			} else {
+				ri.Symnum = rel.Value<<8 | pcrel<<7 | uint32(rel.Len&3)<<5 | extern<<4 | uint32(rel.Type&0xf)
+			}
+		}
+		binary.Write(&b, bo, ri)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,200 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Layout of testdata/clang-amd64-darwin.obj.
+const (
+	objVersionMinOff = 0x1a8 // the 16-byte LC_VERSION_MIN_MACOSX command
+	objSymtabOff     = 0x1b8 // the LC_SYMTAB command
+	objRelocsEnd     = 0x2d0 // end of the relocations, start of the symbols
+	objSection2Off   = 0x108 // header of __LD,__compact_unwind
+)
+
+// rewriteObj returns testdata/clang-amd64-darwin.obj with its
+// LC_VERSION_MIN_MACOSX command replaced by the 16-byte command load and
+// with linkedit data inserted after the relocations.
+func rewriteObj(t *testing.T, load, linkedit []byte) []byte {
+	t.Helper()
+	b, err := ioutil.ReadFile("testdata/clang-amd64-darwin.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(load) != 16 {
+		t.Fatalf("replacement load command is %d bytes", len(load))
+	}
+	copy(b[objVersionMinOff:], load)
+	le := binary.LittleEndian
+	le.PutUint32(b[objSymtabOff+8:], le.Uint32(b[objSymtabOff+8:])+uint32(len(linkedit)))
+	le.PutUint32(b[objSymtabOff+16:], le.Uint32(b[objSymtabOff+16:])+uint32(len(linkedit)))
+	return append(b[:objRelocsEnd:objRelocsEnd], append(linkedit, b[objRelocsEnd:]...)...)
+}
+
+func TestObjectRoundTrip(t *testing.T) {
+	raw, err := ioutil.ReadFile("testdata/clang-amd64-darwin.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, preserve := range []bool{false, true} {
+		f, err := NewFile(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.PreserveRaw = preserve
+		b, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, raw) {
+			t.Errorf("PreserveRaw=%v: Bytes() differs from the object file", preserve)
+		}
+
+		text := f.Section("__text")
+		text.Relocs[0].Addr += 4
+		if b, err = f.Bytes(); err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(g.Section("__text").Relocs, text.Relocs) {
+			t.Errorf("PreserveRaw=%v: relocations are %+v after writing, want %+v", preserve, g.Section("__text").Relocs, text.Relocs)
+		}
+	}
+
+	// Relocations moved over the sections are not silently dropped.
+	f, err := NewFile(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Section("__text").Reloff = f.Section("__text").Offset
+	if _, err := f.Bytes(); err == nil || !strings.Contains(err.Error(), "overlap") {
+		t.Errorf("Bytes() with overlapping relocations: %v", err)
+	}
+}
+
+func TestLinkerOption(t *testing.T) {
+	load := make([]byte, 16)
+	binary.LittleEndian.PutUint32(load, uint32(LoadCmdLinkerOption))
+	binary.LittleEndian.PutUint32(load[4:], 16)
+	binary.LittleEndian.PutUint32(load[8:], 1)
+	copy(load[12:], "-lz\x00")
+	raw := rewriteObj(t, load, nil)
+
+	f, err := NewFile(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.LinkerOptions(), [][]string{{"-lz"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LinkerOptions() = %q, want %q", got, want)
+	}
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, raw) {
+		t.Error("Bytes() differs from the object file")
+	}
+
+	// Swap the command for a new one.
+	f.Loads = append(f.Loads[:1], f.Loads[2:]...)
+	f.Ncmd--
+	f.Cmdsz -= 16
+	if _, err := f.AddLinkerOption("-lc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.AddLinkerOption("-lm"); err == nil {
+		t.Error("AddLinkerOption added a command past the first section")
+	}
+	if b, err = f.Bytes(); err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := g.LinkerOptions(), [][]string{{"-lc"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LinkerOptions() = %q after AddLinkerOption, want %q", got, want)
+	}
+
+	exec, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exec.Close()
+	if _, err := exec.AddLinkerOption("-lz"); err == nil {
+		t.Error("AddLinkerOption succeeded for an executable")
+	}
+}
+
+func TestLinkerOptHint(t *testing.T) {
+	hint := []byte{1, 2, 0x80, 0x01, 0x90, 0x01, 0, 0}
+	load := make([]byte, 16)
+	binary.LittleEndian.PutUint32(load, uint32(LoadCmdLinkerOptimizationHint))
+	binary.LittleEndian.PutUint32(load[4:], 16)
+	binary.LittleEndian.PutUint32(load[8:], objRelocsEnd)
+	binary.LittleEndian.PutUint32(load[12:], uint32(len(hint)))
+	raw := rewriteObj(t, load, hint)
+
+	for _, preserve := range []bool{false, true} {
+		f, err := NewFile(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.PreserveRaw = preserve
+		if f.LinkerOptHint == nil || !bytes.Equal(f.LinkerOptHint.RawDat, hint) || f.LinkerOptHint.Offset != objRelocsEnd {
+			t.Fatalf("LinkerOptHint = %+v", f.LinkerOptHint)
+		}
+		b, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, raw) {
+			t.Errorf("PreserveRaw=%v: Bytes() differs from the object file", preserve)
+		}
+		if !preserve {
+			// Hints that start before the end of the relocations are
+			// refused.
+			f.LinkerOptHint.Offset--
+			if _, err := f.Bytes(); err == nil {
+				t.Error("Bytes() wrote hints over the relocations")
+			}
+		}
+	}
+}
+
+func TestBitcode(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if b, err := f.Bitcode(); b != nil || err != nil {
+		t.Errorf("Bitcode() = %q, %v for an object without bitcode", b, err)
+	}
+
+	// Pretend __LD,__compact_unwind is __LLVM,__bitcode.
+	raw, err := ioutil.ReadFile("testdata/clang-amd64-darwin.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(raw[objSection2Off:], "__bitcode\x00\x00\x00\x00\x00\x00\x00__LLVM\x00\x00")
+	g, err := NewFile(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := f.Section("__compact_unwind").Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := g.Bitcode(); err != nil || !bytes.Equal(b, want) {
+		t.Errorf("Bitcode() = %x, %v, want %x", b, err, want)
+	}
+}
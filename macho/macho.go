@@ -74,8 +74,6 @@ var cpuStrings = []intName{
 	{uint32(CpuPpc64), "CpuPpc64"},
 }
 
-var FinalSegEnd uint64
-
 func (i Cpu) String() string   { return stringName(uint32(i), cpuStrings, false) }
 func (i Cpu) GoString() string { return stringName(uint32(i), cpuStrings, true) }
 
@@ -95,10 +93,28 @@ const (
 	LoadCmdFuncStarts LoadCmd = 0x26 // Function Starts
 	LoadCmdDataInCode LoadCmd = 0x29 // Data In Code
 
+	LoadCmdEncryptionInfo   LoadCmd = 0x21 // encrypted segment information
+	LoadCmdEncryptionInfo64 LoadCmd = 0x2c // 64-bit encrypted segment information
+
+	LoadCmdUUID               LoadCmd = 0x1b // unique identifier of the image
+	LoadCmdVersionMinMacosx   LoadCmd = 0x24 // minimum macOS version
+	LoadCmdVersionMinIphoneos LoadCmd = 0x25 // minimum iOS version
+	LoadCmdSourceVersion      LoadCmd = 0x2a // version of the sources used to build the image
+	LoadCmdVersionMinTvos     LoadCmd = 0x2f // minimum tvOS version
+	LoadCmdVersionMinWatchos  LoadCmd = 0x30 // minimum watchOS version
+	LoadCmdBuildVersion       LoadCmd = 0x32 // platform, minimum OS, SDK and build tool versions
+
+	LoadCmdTwolevelHints LoadCmd = 0x16 // two-level namespace lookup hints
+
+	LoadCmdLinkerOption           LoadCmd = 0x2d // linker options of an object file
+	LoadCmdLinkerOptimizationHint LoadCmd = 0x2e // optimization hints of an object file
+
 	LoadReqDyld       LoadCmd = 0x80000000
 	LoadCmdMain       LoadCmd = (0x28 | LoadReqDyld) // replacement for LC_UNIXTHREAD
 	LoadCmdRpath      LoadCmd = 0x8000001c
 	LoadCmdDylinkInfo LoadCmd = 0x80000022 // Dynamic Linker Info Only
+
+	LoadCmdDyldChainedFixups LoadCmd = 0x80000034 // fixups chained through the data
 )
 
 var cmdStrings = []intName{
@@ -107,11 +123,24 @@ var cmdStrings = []intName{
 	{uint32(LoadCmdUnixThread), "LoadCmdUnixThread"},
 	{uint32(LoadCmdDylib), "LoadCmdDylib"},
 	{uint32(LoadCmdSegment64), "LoadCmdSegment64"},
+	{uint32(LoadCmdTwolevelHints), "LoadCmdTwolevelHints"},
 	{uint32(LoadCmdRpath), "LoadCmdRpath"},
 	{uint32(LoadCmdSignature), "LoadCmdSignature"},
 	{uint32(LoadCmdFuncStarts), "LoadCmdFuncStarts"},
 	{uint32(LoadCmdDataInCode), "LoadCmdDataInCode"},
 	{uint32(LoadCmdDylinkInfo), "LoadCmdDylinkInfo"},
+	{uint32(LoadCmdDyldChainedFixups), "LoadCmdDyldChainedFixups"},
+	{uint32(LoadCmdEncryptionInfo), "LoadCmdEncryptionInfo"},
+	{uint32(LoadCmdEncryptionInfo64), "LoadCmdEncryptionInfo64"},
+	{uint32(LoadCmdUUID), "LoadCmdUUID"},
+	{uint32(LoadCmdVersionMinMacosx), "LoadCmdVersionMinMacosx"},
+	{uint32(LoadCmdVersionMinIphoneos), "LoadCmdVersionMinIphoneos"},
+	{uint32(LoadCmdSourceVersion), "LoadCmdSourceVersion"},
+	{uint32(LoadCmdVersionMinTvos), "LoadCmdVersionMinTvos"},
+	{uint32(LoadCmdVersionMinWatchos), "LoadCmdVersionMinWatchos"},
+	{uint32(LoadCmdBuildVersion), "LoadCmdBuildVersion"},
+	{uint32(LoadCmdLinkerOption), "LoadCmdLinkerOption"},
+	{uint32(LoadCmdLinkerOptimizationHint), "LoadCmdLinkerOptimizationHint"},
 }
 
 func (i LoadCmd) String() string   { return stringName(uint32(i), cmdStrings, false) }
@@ -217,6 +246,14 @@ type (
 		CompatVersion  uint32
 	}
 
+	// A TwolevelHintsCmd is a Mach-O two-level namespace hints command.
+	TwolevelHintsCmd struct {
+		Cmd    LoadCmd
+		Len    uint32
+		Offset uint32
+		Nhints uint32
+	}
+
 	// A FuncStartsCmd is a Mach-O load Function Starts command
 	FuncStartsCmd struct {
 		Cmd      LoadCmd
@@ -233,6 +270,22 @@ type (
 		Datasize uint32
 	}
 
+	// A LinkerOptionCmd is a Mach-O linker option command. Count
+	// NUL-terminated strings follow it.
+	LinkerOptionCmd struct {
+		Cmd   LoadCmd
+		Len   uint32
+		Count uint32
+	}
+
+	// A LinkerOptHintCmd is a Mach-O linker optimization hint command.
+	LinkerOptHintCmd struct {
+		Cmd      LoadCmd
+		Len      uint32
+		Dataoff  uint32
+		Datasize uint32
+	}
+
 	// A DylinkInfoCmd is a Mach-O load for Dynamic Linker Info Only Command
 	DylinkInfoCmd struct {
 		Cmd             LoadCmd
@@ -249,6 +302,17 @@ type (
 		Exportinfosize  uint32
 	}
 
+	// An EncryptionInfoCmd is a Mach-O encryption info command.
+	// LC_ENCRYPTION_INFO_64 has the same layout followed by 4 bytes of
+	// padding.
+	EncryptionInfoCmd struct {
+		Cmd       LoadCmd
+		Len       uint32
+		Cryptoff  uint32
+		Cryptsize uint32
+		Cryptid   uint32
+	}
+
 	// A RpathCmd is a Mach-O rpath command.
 	RpathCmd struct {
 		Cmd  LoadCmd
@@ -0,0 +1,299 @@
+package macho
+
+import (
+	"bytes"
+	"fmt"
+)
+
+/*
+ * Objective-C 2.0 runtime metadata
+ */
+
+// An ObjCMethod is one entry of an Objective-C method list.
+type ObjCMethod struct {
+	Name  string // selector
+	Types string // type encoding
+	IMP   uint64 // address of the implementation
+
+	// ImpSlot is the address of the IMP field inside the method list.
+	// For a Relative method list the field holds a signed 32-bit offset
+	// from ImpSlot to IMP, otherwise it holds IMP itself.
+	ImpSlot  uint64
+	Relative bool
+}
+
+// An ObjCClass is an Objective-C class described by __objc_classlist.
+type ObjCClass struct {
+	Addr uint64 // address of the class_t
+	Name string
+
+	// SuperClass is the name of the superclass if it is defined in this
+	// file. Classes whose superclass is bound by dyld at load time have
+	// a SuperAddr of 0 and an empty SuperClass.
+	SuperClass string
+	SuperAddr  uint64
+
+	InstanceMethods []ObjCMethod
+	ClassMethods    []ObjCMethod
+}
+
+// An ObjCSelRef is an entry of __objc_selrefs.
+type ObjCSelRef struct {
+	Addr uint64 // address of the reference
+	Name string // selector it refers to
+}
+
+const (
+	objcMethodListFlagMask = 0xffff0003
+	objcMethodListRelative = 0x80000000
+)
+
+// ObjCClasses returns the classes listed in the __objc_classlist section,
+// with their instance methods and the class methods of their metaclass.
+// It returns nil, nil if the file has no class list.
+func (f *File) ObjCClasses() ([]ObjCClass, error) {
+	list := f.Section("__objc_classlist")
+	if list == nil {
+		return nil, nil
+	}
+	ptrs, err := f.objcPointers(list)
+	if err != nil {
+		return nil, err
+	}
+	classes := make([]ObjCClass, 0, len(ptrs))
+	for _, p := range ptrs {
+		c, err := f.objcClass(p)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, c)
+	}
+	return classes, nil
+}
+
+// ObjCSelectorRefs returns the selector references in __objc_selrefs.
+// It returns nil, nil if the file has no selector references.
+func (f *File) ObjCSelectorRefs() ([]ObjCSelRef, error) {
+	refs := f.Section("__objc_selrefs")
+	if refs == nil {
+		return nil, nil
+	}
+	ptrs, err := f.objcPointers(refs)
+	if err != nil {
+		return nil, err
+	}
+	sels := make([]ObjCSelRef, len(ptrs))
+	for i, p := range ptrs {
+		name, err := f.cstringAt(p)
+		if err != nil {
+			return nil, err
+		}
+		sels[i] = ObjCSelRef{Addr: refs.Addr + uint64(i*f.ptrSize()), Name: name}
+	}
+	return sels, nil
+}
+
+// ObjCClassNames returns the strings in the __objc_classname section.
+func (f *File) ObjCClassNames() ([]string, error) {
+	s := f.Section("__objc_classname")
+	if s == nil {
+		return nil, nil
+	}
+	dat, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for len(dat) > 0 {
+		i := bytes.IndexByte(dat, 0)
+		if i < 0 {
+			i = len(dat)
+		}
+		if i > 0 {
+			names = append(names, string(dat[:i]))
+		}
+		if i == len(dat) {
+			break
+		}
+		dat = dat[i+1:]
+	}
+	return names, nil
+}
+
+func (f *File) objcClass(addr uint64) (ObjCClass, error) {
+	c := ObjCClass{Addr: addr}
+
+	// class_t: isa, superclass, cache, vtable, data
+	var isa, data uint64
+	var err error
+	if isa, err = f.pointerAt(addr); err != nil {
+		return c, err
+	}
+	if c.SuperAddr, err = f.pointerAt(addr + uint64(f.ptrSize())); err != nil {
+		return c, err
+	}
+	if data, err = f.pointerAt(addr + 4*uint64(f.ptrSize())); err != nil {
+		return c, err
+	}
+
+	var methods uint64
+	if c.Name, methods, err = f.objcClassRO(data); err != nil {
+		return c, err
+	}
+	if c.InstanceMethods, err = f.objcMethodList(methods); err != nil {
+		return c, err
+	}
+
+	if isa != 0 && f.mapped(isa) {
+		if data, err = f.pointerAt(isa + 4*uint64(f.ptrSize())); err != nil {
+			return c, err
+		}
+		if _, methods, err = f.objcClassRO(data); err != nil {
+			return c, err
+		}
+		if c.ClassMethods, err = f.objcMethodList(methods); err != nil {
+			return c, err
+		}
+	}
+
+	if c.SuperAddr != 0 && f.mapped(c.SuperAddr) {
+		if data, err = f.pointerAt(c.SuperAddr + 4*uint64(f.ptrSize())); err != nil {
+			return c, err
+		}
+		if c.SuperClass, _, err = f.objcClassRO(data); err != nil {
+			return c, err
+		}
+	} else {
+		c.SuperAddr = 0
+	}
+	return c, nil
+}
+
+// objcClassRO returns the name and base method list address of the
+// class_ro_t referenced by the data field of a class_t.
+func (f *File) objcClassRO(data uint64) (name string, methods uint64, err error) {
+	// The low bits of the data pointer hold runtime flags.
+	if f.Magic == Magic64 {
+		data &= 0x00007ffffffffff8
+	} else {
+		data &^= 3
+	}
+
+	// class_ro_t: flags, instanceStart, instanceSize, [reserved,]
+	// ivarLayout, name, baseMethods, ...
+	off := data + 12
+	if f.Magic == Magic64 {
+		off += 4
+	}
+	nameAddr, err := f.pointerAt(off + uint64(f.ptrSize()))
+	if err != nil {
+		return "", 0, err
+	}
+	if name, err = f.cstringAt(nameAddr); err != nil {
+		return "", 0, err
+	}
+	methods, err = f.pointerAt(off + 2*uint64(f.ptrSize()))
+	return name, methods, err
+}
+
+func (f *File) objcMethodList(addr uint64) ([]ObjCMethod, error) {
+	if addr == 0 {
+		return nil, nil
+	}
+	var hdr [8]byte
+	if err := f.readAtAddr(hdr[:], addr); err != nil {
+		return nil, err
+	}
+	entsizeAndFlags := f.ByteOrder.Uint32(hdr[0:])
+	count := f.ByteOrder.Uint32(hdr[4:])
+	entsize := uint64(entsizeAndFlags &^ objcMethodListFlagMask)
+	relative := entsizeAndFlags&objcMethodListRelative != 0
+
+	minEntsize := uint64(3 * f.ptrSize())
+	if relative {
+		minEntsize = 12
+	}
+	if entsize < minEntsize {
+		return nil, fmt.Errorf("method list at %#x has entry size %d", addr, entsize)
+	}
+
+	// The entries must lie in the data of the section, so that a count
+	// from the file allocates no more than the file holds.
+	if list := addr + 8; count > 0 {
+		s := f.sectionForAddr(list)
+		if s == nil {
+			return nil, fmt.Errorf("method list at %#x is not in a section", addr)
+		}
+		if end := s.Addr + sectionDataSize(s); uint64(count) > (end-list)/entsize {
+			return nil, fmt.Errorf("method list at %#x has %d entries of %d bytes past the end of %s", addr, count, entsize, s.Name)
+		}
+	}
+	methods := make([]ObjCMethod, count)
+	for i := range methods {
+		ent := addr + 8 + uint64(i)*entsize
+		m := &methods[i]
+		m.Relative = relative
+		if relative {
+			// name points at a selector reference, types at a string
+			// and imp at the code, each relative to its own field.
+			var rel [12]byte
+			if err := f.readAtAddr(rel[:], ent); err != nil {
+				return nil, err
+			}
+			selref := ent + uint64(int64(int32(f.ByteOrder.Uint32(rel[0:]))))
+			sel, err := f.pointerAt(selref)
+			if err != nil {
+				return nil, err
+			}
+			if m.Name, err = f.cstringAt(sel); err != nil {
+				return nil, err
+			}
+			types := ent + 4 + uint64(int64(int32(f.ByteOrder.Uint32(rel[4:]))))
+			if m.Types, err = f.cstringAt(types); err != nil {
+				return nil, err
+			}
+			m.ImpSlot = ent + 8
+			m.IMP = m.ImpSlot + uint64(int64(int32(f.ByteOrder.Uint32(rel[8:]))))
+			continue
+		}
+		ps := uint64(f.ptrSize())
+		name, err := f.pointerAt(ent)
+		if err != nil {
+			return nil, err
+		}
+		if m.Name, err = f.cstringAt(name); err != nil {
+			return nil, err
+		}
+		types, err := f.pointerAt(ent + ps)
+		if err != nil {
+			return nil, err
+		}
+		if m.Types, err = f.cstringAt(types); err != nil {
+			return nil, err
+		}
+		m.ImpSlot = ent + 2*ps
+		if m.IMP, err = f.pointerAt(m.ImpSlot); err != nil {
+			return nil, err
+		}
+	}
+	return methods, nil
+}
+
+// objcPointers returns the pointers stored in a pointer list section
+// such as __objc_classlist or __objc_selrefs.
+func (f *File) objcPointers(s *Section) ([]uint64, error) {
+	ps := uint64(f.ptrSize())
+	size := s.Size
+	if n := sectionDataSize(s); n < size {
+		return nil, fmt.Errorf("section %s holds %d bytes of its %d", s.Name, n, size)
+	}
+	ptrs := make([]uint64, size/ps)
+	for i := range ptrs {
+		p, err := f.pointerAt(s.Addr + uint64(i)*ps)
+		if err != nil {
+			return nil, err
+		}
+		ptrs[i] = p
+	}
+	return ptrs, nil
+}
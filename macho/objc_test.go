@@ -0,0 +1,175 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// objcImage builds a 64-bit File whose sections are windows onto a
+// single buffer mapped at base.
+type objcImage struct {
+	base uint64
+	mem  []byte
+	f    *File
+}
+
+func newObjcImage() *objcImage {
+	m := &objcImage{base: 0x100000000, mem: make([]byte, 0x3000)}
+	m.f = &File{FileHeader: FileHeader{Magic: Magic64}, ByteOrder: binary.LittleEndian}
+	return m
+}
+
+func (m *objcImage) section(name string, addr, size uint64) {
+	s := &Section{SectionHeader: SectionHeader{Name: name, Seg: "__DATA", Addr: addr, Size: size}}
+	s.sr = io.NewSectionReader(bytes.NewReader(m.mem), int64(addr-m.base), int64(size))
+	s.ReaderAt = s.sr
+	m.f.Sections = append(m.f.Sections, s)
+}
+
+func (m *objcImage) u32(addr uint64, v uint32) {
+	binary.LittleEndian.PutUint32(m.mem[addr-m.base:], v)
+}
+
+func (m *objcImage) ptr(addr, v uint64) {
+	binary.LittleEndian.PutUint64(m.mem[addr-m.base:], v)
+}
+
+func (m *objcImage) str(addr uint64, s string) {
+	copy(m.mem[addr-m.base:], s+"\x00")
+}
+
+// class writes a class_t at addr whose class_ro_t is at ro.
+func (m *objcImage) class(addr, isa, super, ro, name, methods uint64) {
+	m.ptr(addr, isa)
+	m.ptr(addr+8, super)
+	m.ptr(addr+32, ro|1) // low bits are runtime flags
+	m.ptr(ro+24, name)
+	m.ptr(ro+32, methods)
+}
+
+func TestObjC(t *testing.T) {
+	m := newObjcImage()
+	b := m.base
+	var (
+		classlist = b + 0x1000
+		selrefs   = b + 0x1010
+		data      = b + 0x1100
+		cnst      = b + 0x1200
+		methname  = b + 0x1400
+		classname = b + 0x1500
+		methtype  = b + 0x1600
+		text      = b + 0x2000
+
+		foo, fooMeta, base = data, data + 0x30, data + 0x60
+		fooRO, metaRO      = cnst, cnst + 0x40
+		baseRO             = cnst + 0x80
+		fooMethods         = cnst + 0xc0
+		metaMethods        = cnst + 0x100
+	)
+	m.section("__objc_classlist", classlist, 8)
+	m.section("__objc_selrefs", selrefs, 16)
+	m.section("__objc_data", data, 0x100)
+	m.section("__objc_const", cnst, 0x200)
+	m.section("__objc_methname", methname, 0x100)
+	m.section("__objc_classname", classname, 0x100)
+	m.section("__objc_methtype", methtype, 0x100)
+	m.section("__text", text, 0x100)
+
+	m.ptr(classlist, foo)
+	m.str(classname, "Foo")
+	m.str(classname+4, "Base")
+	m.str(methname, "init")
+	m.str(methname+5, "sharedFoo")
+	m.str(methtype, "@16@0:8")
+	m.ptr(selrefs, methname)
+	m.ptr(selrefs+8, methname+5)
+
+	m.class(foo, fooMeta, base, fooRO, classname, fooMethods)
+	m.class(fooMeta, 0, 0, metaRO, classname, metaMethods)
+	m.class(base, 0, 0, baseRO, classname+4, 0)
+
+	// Instance methods use pointers.
+	m.u32(fooMethods, 24)
+	m.u32(fooMethods+4, 1)
+	m.ptr(fooMethods+8, methname)
+	m.ptr(fooMethods+16, methtype)
+	m.ptr(fooMethods+24, text+0x10)
+
+	// Class methods use a relative method list.
+	rel := func(from, to uint64) uint32 { return uint32(int32(int64(to - from))) }
+	ent := metaMethods + 8
+	m.u32(metaMethods, objcMethodListRelative|12)
+	m.u32(metaMethods+4, 1)
+	m.u32(ent, rel(ent, selrefs+8))
+	m.u32(ent+4, rel(ent+4, methtype))
+	m.u32(ent+8, rel(ent+8, text+0x40))
+
+	classes, err := m.f.ObjCClasses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ObjCClass{{
+		Addr:       foo,
+		Name:       "Foo",
+		SuperClass: "Base",
+		SuperAddr:  base,
+		InstanceMethods: []ObjCMethod{
+			{Name: "init", Types: "@16@0:8", IMP: text + 0x10, ImpSlot: fooMethods + 24},
+		},
+		ClassMethods: []ObjCMethod{
+			{Name: "sharedFoo", Types: "@16@0:8", IMP: text + 0x40, ImpSlot: ent + 8, Relative: true},
+		},
+	}}
+	if !reflect.DeepEqual(classes, want) {
+		t.Errorf("ObjCClasses:\n\thave %+v\n\twant %+v", classes, want)
+	}
+
+	sels, err := m.f.ObjCSelectorRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSels := []ObjCSelRef{{selrefs, "init"}, {selrefs + 8, "sharedFoo"}}
+	if !reflect.DeepEqual(sels, wantSels) {
+		t.Errorf("ObjCSelectorRefs:\n\thave %+v\n\twant %+v", sels, wantSels)
+	}
+
+	names, err := m.f.ObjCClassNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"Foo", "Base"}) {
+		t.Errorf("ObjCClassNames = %q", names)
+	}
+}
+
+func TestObjCNone(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	classes, err := f.ObjCClasses()
+	if err != nil || classes != nil {
+		t.Errorf("ObjCClasses = %v, %v; want nil, nil", classes, err)
+	}
+}
+
+func TestObjCCorruptCounts(t *testing.T) {
+	m := newObjcImage()
+	b := m.base
+	m.section("__objc_const", b+0x1000, 0x100)
+	m.u32(b+0x1000, 24)
+	m.u32(b+0x1004, 0xffffffff)
+	if _, err := m.f.objcMethodList(b + 0x1000); err == nil {
+		t.Error("objcMethodList accepted more methods than the section holds")
+	}
+
+	// A section whose header claims more than the file holds.
+	m.section("__objc_classlist", b+0x2000, 1<<40)
+	if _, err := m.f.objcPointers(m.f.Sections[1]); err == nil {
+		t.Error("objcPointers accepted a section larger than its data")
+	}
+}
@@ -0,0 +1,107 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/Binject/debug/internal/readerat"
+)
+
+// rawLen returns the size of the file f was read from.
+func (f *File) rawLen() (int64, error) {
+	return readerat.CachedSize(f.raw, &f.rawSize)
+}
+
+// preservedBytes returns the bytes the file was read from with the
+// structures the File holds written over them at their offsets.
+func (f *File) preservedBytes() ([]byte, error) {
+	n, err := f.rawLen()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, n)
+	if _, err := f.raw.ReadAt(out, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	start := f.loadCommandsStart()
+	if uint64(len(out)) < start {
+		return nil, errors.New("original file is shorter than its header")
+	}
+	put := func(off uint64, b []byte) {
+		if len(b) == 0 {
+			return
+		}
+		if end := off + uint64(len(b)); end > uint64(len(out)) {
+			out = append(out, make([]byte, end-uint64(len(out)))...)
+		}
+		copy(out[off:], b)
+	}
+
+	for _, s := range f.Sections {
+		if isZerofill(s.Flags) || s.Offset == 0 || s.Size == 0 {
+			continue
+		}
+		data, err := ioutil.ReadAll(s.Open())
+		if err != nil {
+			return nil, err
+		}
+		put(uint64(s.Offset), data)
+	}
+	for _, s := range f.Sections {
+		if len(s.Relocs) > 0 {
+			put(uint64(s.Reloff), f.relocBytes(s))
+		}
+	}
+	if d := f.DylinkInfo; d != nil {
+		put(d.RebaseOffset, d.RebaseDat)
+		put(d.BindingInfoOffset, d.BindingInfoDat)
+		put(d.WeakBindingOffset, d.WeakBindingDat)
+		put(d.LazyBindingOffset, d.LazyBindingDat)
+		put(d.ExportInfoOffset, d.ExportInfoDat)
+	}
+	if f.FuncStarts != nil {
+		put(f.FuncStarts.Offset, f.FuncStarts.RawDat)
+	}
+	if f.DataInCode != nil {
+		put(f.DataInCode.Offset, f.DataInCode.RawDat)
+	}
+	if f.LinkerOptHint != nil {
+		put(f.LinkerOptHint.Offset, f.LinkerOptHint.RawDat)
+	}
+	if f.Symtab != nil {
+		put(uint64(f.Symtab.Symoff), f.Symtab.RawSymtab)
+		put(uint64(f.Symtab.Stroff), f.Symtab.RawStringtab)
+	}
+	if f.Dysymtab != nil {
+		put(uint64(f.Dysymtab.Indirectsymoff), f.Dysymtab.RawDysymtab)
+	}
+	if f.TwolevelHints != nil {
+		put(uint64(f.TwolevelHints.Offset), f.TwolevelHints.RawDat)
+	}
+	if f.SigBlock != nil {
+		put(f.SigBlock.Offset, f.SigBlock.RawDat)
+	}
+
+	// The header is written without the reserved field of 64-bit
+	// headers, which keeps its original value.
+	oldCmdsz := uint64(f.ByteOrder.Uint32(out[20:]))
+	var hdr bytes.Buffer
+	binary.Write(&hdr, f.ByteOrder, f.FileHeader)
+	put(0, hdr.Bytes())
+	var cmds bytes.Buffer
+	for _, l := range f.Loads {
+		cmds.Write(l.Raw())
+	}
+	cmds.Write(f.Insertion)
+	// Clear what is left of the old load commands.
+	if end := start + oldCmdsz; uint64(cmds.Len()) < oldCmdsz && end <= uint64(len(out)) {
+		for i := start + uint64(cmds.Len()); i < end; i++ {
+			out[i] = 0
+		}
+	}
+	put(start, cmds.Bytes())
+	return out, nil
+}
@@ -0,0 +1,114 @@
+package macho
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	names, err := filepath.Glob("testdata/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if filepath.Ext(name) == ".c" || strings.HasPrefix(filepath.Base(name), "fat-") {
+			continue
+		}
+		orig, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, preserve := range []bool{false, true} {
+			f, err := NewFile(bytes.NewReader(orig))
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.PreserveRaw = preserve
+			b, err := f.Bytes()
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+				continue
+			}
+			if !bytes.Equal(b, orig) {
+				i := 0
+				for i < len(b) && i < len(orig) && b[i] == orig[i] {
+					i++
+				}
+				t.Errorf("%s with PreserveRaw %v: unedited file changed at %#x", name, preserve, i)
+			}
+		}
+	}
+}
+
+func TestPreserveRaw(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/gcc-amd64-darwin-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte("data after __LINKEDIT that no load command describes")
+	orig = append(orig, payload...)
+	f, err := NewFile(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.PreserveRaw = true
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, orig) {
+		t.Fatal("unedited file changed")
+	}
+
+	// Edit the load commands and a section.
+	src, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if err := f.CloneIdentity(src); err != nil {
+		t.Fatal(err)
+	}
+	text := f.Section("__text")
+	data, err := text.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[0] ^= 0xff
+	text.Replace(bytes.NewReader(data), int64(len(data)))
+
+	b, err = f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(b, payload) || len(b) != len(orig) {
+		t.Error("data after __LINKEDIT was not kept")
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(identityCmds(g), identityCmds(src)) {
+		t.Error("identity load commands were not written")
+	}
+	if got, err := g.Section("__text").Data(); err != nil || !bytes.Equal(got, data) {
+		t.Error("edited __text was not written")
+	}
+	for _, issue := range g.Validate() {
+		if issue.Severity >= SeverityWarning {
+			t.Errorf("unexpected issue: %v", issue)
+		}
+	}
+
+	// Everything past the load commands and outside of __text is as it
+	// was.
+	room := f.loadCommandsRoom()
+	start, end := uint64(text.Offset), uint64(text.Offset)+text.Size
+	if !bytes.Equal(b[room:start], orig[room:start]) || !bytes.Equal(b[end:], orig[end:]) {
+		t.Error("bytes that were not edited changed")
+	}
+}
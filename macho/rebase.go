@@ -0,0 +1,176 @@
+package macho
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Rebase moves the image so that its __TEXT segment starts at newBase, as
+// if it had been linked there: the addresses of the segments and their
+// sections, the values of the symbols defined in a section and the entry
+// point of an LC_UNIXTHREAD command are moved, and the pointers and
+// absolute text fields listed in the dyld rebase info are slid by the
+// same amount. __PAGEZERO stays at address 0. dyld still slides the image
+// where it likes, from newBase instead.
+//
+// Only images with LC_DYLD_INFO rebase opcodes can be rebased; those with
+// threaded binding info or chained fixups, whose pointers are encoded in
+// the data, are refused. newBase must be a multiple of the page size. A
+// code signature no longer matches the rebased image and has to be made
+// again.
+func (f *File) Rebase(newBase uint64) error {
+	text := f.Segment("__TEXT")
+	if text == nil {
+		return errors.New("no __TEXT segment")
+	}
+	page := uint64(0x1000)
+	if f.Cpu == CpuArm64 {
+		page = 0x4000
+	}
+	if newBase%page != 0 {
+		return fmt.Errorf("base %#x is not a multiple of the page size %#x", newBase, page)
+	}
+	if f.chainedFixups() != nil {
+		return errors.New("cannot rebase an image with chained fixups")
+	}
+	if f.DylinkInfo == nil {
+		return errors.New("file has no dyld rebase info")
+	}
+	if f.hasThreadedBinds() {
+		return fmt.Errorf("cannot rebase: %v", errThreadedBinds)
+	}
+	delta := newBase - text.Addr
+	if delta == 0 {
+		return nil
+	}
+
+	// The segments move together, and must stay above __PAGEZERO and, in
+	// a 32-bit image, below 4 GB.
+	pz := f.Segment("__PAGEZERO")
+	if pz != nil && pz.Addr != 0 {
+		pz = nil
+	}
+	var moved []*Segment
+	for _, s := range f.segments() {
+		if s == pz {
+			continue
+		}
+		addr := s.Addr + delta
+		if pz != nil && addr < pz.Memsz {
+			return fmt.Errorf("segment %s would move to %#x, inside __PAGEZERO", s.Name, addr)
+		}
+		if f.Magic == Magic32 && (addr > 1<<32-1 || s.Memsz > 1<<32-addr) {
+			return fmt.Errorf("segment %s would move to %#x, outside a 32-bit address space", s.Name, addr)
+		}
+		moved = append(moved, s)
+	}
+	rebases, err := f.Rebases()
+	if err != nil {
+		return err
+	}
+
+	patched := make(map[*Section][]byte)
+	// field returns the size bytes at addr in the contents of its section.
+	field := func(addr uint64, size int) ([]byte, error) {
+		s := f.sectionForAddr(addr)
+		if s == nil {
+			return nil, fmt.Errorf("rebased address %#x is not in the file contents of a section", addr)
+		}
+		data, ok := patched[s]
+		if !ok {
+			var err error
+			if data, err = s.Data(); err != nil {
+				return nil, err
+			}
+			patched[s] = data
+		}
+		off := addr - s.Addr
+		if off+uint64(size) > uint64(len(data)) {
+			return nil, fmt.Errorf("rebased address %#x runs past the end of section %s,%s", addr, s.Seg, s.Name)
+		}
+		return data[off : off+uint64(size)], nil
+	}
+	for _, r := range rebases {
+		addr, err := f.RebaseAddr(r)
+		if err != nil {
+			return err
+		}
+		switch r.Type {
+		case RebaseTypePointer:
+			b, err := field(addr, f.ptrSize())
+			if err != nil {
+				return err
+			}
+			if f.ptrSize() == 4 {
+				f.ByteOrder.PutUint32(b, f.ByteOrder.Uint32(b)+uint32(delta))
+			} else {
+				f.ByteOrder.PutUint64(b, f.ByteOrder.Uint64(b)+delta)
+			}
+		case RebaseTypeTextAbsolute32:
+			b, err := field(addr, 4)
+			if err != nil {
+				return err
+			}
+			f.ByteOrder.PutUint32(b, f.ByteOrder.Uint32(b)+uint32(delta))
+		default:
+			return fmt.Errorf("rebase of type %d at %#x is not supported", r.Type, addr)
+		}
+	}
+
+	// The entry point of LC_MAIN is an offset from __TEXT, but that of
+	// LC_UNIXTHREAD is an address.
+	var entry uint64
+	_, raw, err := f.entryLoad()
+	thread := err == nil && LoadCmd(f.ByteOrder.Uint32(raw)) != LoadCmdMain
+	if thread {
+		if entry, err = f.Entry(); err != nil {
+			return err
+		}
+	}
+
+	for s, data := range patched {
+		s.Replace(bytes.NewReader(data), int64(len(data)))
+	}
+	if f.Symtab != nil {
+		f.rebaseSymbols(delta)
+	}
+	for _, seg := range moved {
+		seg.Addr += delta
+		for _, s := range f.segmentSections(seg) {
+			s.Addr += delta
+		}
+		if err := f.updateSegmentLoad(seg); err != nil {
+			return err
+		}
+	}
+	if thread {
+		return f.SetEntryPoint(entry + delta)
+	}
+	return nil
+}
+
+// rebaseSymbols moves by delta the values of the symbols defined in a
+// section, in Symtab.Syms and in the raw symbol table.
+func (f *File) rebaseSymbols(delta uint64) {
+	st := f.Symtab
+	symsz, valsz := 12, 4
+	if f.Magic == Magic64 {
+		symsz, valsz = 16, 8
+	}
+	for i := range st.Syms {
+		if st.Syms[i].Sect == 0 {
+			continue
+		}
+		st.Syms[i].Value += delta
+		if len(st.RawSymtab) < (i+1)*symsz {
+			continue
+		}
+		v := st.RawSymtab[i*symsz+8:]
+		if valsz == 4 {
+			f.ByteOrder.PutUint32(v, f.ByteOrder.Uint32(v)+uint32(delta))
+		} else {
+			f.ByteOrder.PutUint64(v, f.ByteOrder.Uint64(v)+delta)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package macho
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRebase(t *testing.T) {
+	for _, tt := range []struct {
+		file string
+		base uint64
+	}{
+		{"testdata/clang-386-darwin-exec-with-rpath", 0x100000},
+		{"testdata/clang-amd64-darwin-exec-with-rpath", 0x200000000},
+	} {
+		f, err := Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Bytes only writes 32-bit files correctly when preserving them.
+		f.PreserveRaw = true
+		if err := f.Rebase(tt.base + 0x800); err == nil {
+			t.Errorf("%s: Rebase accepted an unaligned base", tt.file)
+		}
+		if err := f.Rebase(0); err == nil {
+			t.Errorf("%s: Rebase moved __TEXT into __PAGEZERO", tt.file)
+		}
+
+		delta := tt.base - f.Segment("__TEXT").Addr
+		rebases, err := f.Rebases()
+		if err != nil || len(rebases) == 0 {
+			t.Fatalf("%s: Rebases() = %v, %v", tt.file, rebases, err)
+		}
+		// value reads the field a rebase slides.
+		value := func(f *File, r Rebase) uint64 {
+			t.Helper()
+			addr, err := f.RebaseAddr(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Type == RebaseTypeTextAbsolute32 {
+				var b [4]byte
+				if err := f.readAtAddr(b[:], addr); err != nil {
+					t.Fatal(err)
+				}
+				return uint64(f.ByteOrder.Uint32(b[:]))
+			}
+			v, err := f.pointerAt(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return v
+		}
+		var values []uint64
+		for _, r := range rebases {
+			values = append(values, value(f, r))
+		}
+		var main uint64
+		for _, s := range f.Symtab.Syms {
+			if s.Name == "_main" {
+				main = s.Value
+			}
+		}
+		entry, err := f.Entry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		segs := make(map[string]uint64)
+		for _, s := range f.segments() {
+			segs[s.Name] = s.Addr
+		}
+
+		if err := f.Rebase(tt.base); err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		b, err := f.Bytes()
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range g.segments() {
+			want := segs[s.Name] + delta
+			if s.Name == "__PAGEZERO" {
+				want = 0
+			}
+			if s.Addr != want {
+				t.Errorf("%s: segment %s is at %#x, want %#x", tt.file, s.Name, s.Addr, want)
+			}
+		}
+		for _, s := range g.Sections {
+			if seg := g.Segment(s.Seg); s.Addr < seg.Addr || s.Addr+s.Size > seg.Addr+seg.Memsz {
+				t.Errorf("%s: section %s at %#x is outside its segment", tt.file, s.Name, s.Addr)
+			}
+		}
+		for i, r := range rebases {
+			if v, want := value(g, r), values[i]+delta; uint32(v) != uint32(want) || (r.Type == RebaseTypePointer && v != want) {
+				t.Errorf("%s: rebase %d holds %#x, want %#x", tt.file, i, v, want)
+			}
+		}
+		for _, s := range g.Symtab.Syms {
+			if s.Name == "_main" && s.Value != main+delta {
+				t.Errorf("%s: _main is at %#x, want %#x", tt.file, s.Value, main+delta)
+			}
+		}
+		if got, err := g.Entry(); err != nil || got != entry+delta {
+			t.Errorf("%s: Entry() = %#x, %v; want %#x", tt.file, got, err, entry+delta)
+		}
+	}
+}
+
+func TestRebaseNoDyldInfo(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-darwin-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Rebase(0x200000000); err == nil {
+		t.Error("Rebase moved an image without dyld rebase info")
+	}
+}
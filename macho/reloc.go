@@ -0,0 +1,284 @@
+package macho
+
+import (
+	"errors"
+	"fmt"
+)
+
+// AddRelocation appends relocs to the relocation entries of the section
+// s of an object file. The entries are checked against the relocation
+// types of the CPU of f, so that a type used with the wrong length,
+// pc-relativity or target kind, or a SUBTRACTOR or ADDEND entry without
+// the entry it must pair with, is refused here rather than making a file
+// that the linker rejects or links wrongly.
+//
+// The relocation tables of the following sections and the symbol,
+// string and data in code tables after them move down to make room, and
+// the load commands are updated.
+func (f *File) AddRelocation(s *Section, relocs ...Reloc) error {
+	if f.Type != TypeObj {
+		return fmt.Errorf("cannot add relocations to a %v file", f.Type)
+	}
+	if len(relocs) == 0 {
+		return errors.New("no relocations")
+	}
+	var seg *Segment
+	for _, l := range f.segments() {
+		for _, t := range f.segmentSections(l) {
+			if t == s {
+				seg = l
+			}
+		}
+	}
+	if seg == nil {
+		return fmt.Errorf("section %s is not a section of the file", s.Name)
+	}
+	if err := f.checkRelocs(s, relocs); err != nil {
+		return err
+	}
+
+	// The new entries go at the end of the table of s or, for a section
+	// without one, after all the tables. Everything from there on moves.
+	var at uint64
+	if len(s.Relocs) > 0 {
+		at = uint64(s.Reloff) + 8*uint64(len(s.Relocs))
+	} else {
+		at = alignUp(seg.Offset+seg.Filesz, 8)
+		if blobs := f.linkeditBlobs(); len(blobs) > 0 && blobs[0].off >= at {
+			at = blobs[0].off
+		}
+		for _, t := range f.Sections {
+			if end := uint64(t.Reloff) + 8*uint64(len(t.Relocs)); len(t.Relocs) > 0 && end > at {
+				at = end
+			}
+		}
+	}
+	grow := 8 * uint64(len(relocs))
+	for _, b := range f.linkeditBlobs() {
+		if b.off < at {
+			continue
+		}
+		switch b.name {
+		case "symbol table", "string table", "indirect symbol table", "data in code", "linker optimization hints":
+		default:
+			return fmt.Errorf("cannot move the %s of an object file", b.name)
+		}
+	}
+	if dt := f.Dysymtab; dt != nil && (dt.Ntoc != 0 || dt.Nmodtab != 0 || dt.Nextrefsyms != 0 || dt.Nextrel != 0 || dt.Nlocrel != 0) {
+		return errors.New("cannot add relocations to a file with a table of contents, module table, referenced symbols or dynamic relocations")
+	}
+	move := func(off uint64) uint64 {
+		if off >= at {
+			off += grow
+		}
+		return off
+	}
+	move32 := func(off uint32) uint32 { return uint32(move(uint64(off))) }
+
+	if len(s.Relocs) == 0 {
+		s.Reloff = uint32(at)
+	}
+	for _, t := range f.Sections {
+		if t != s && len(t.Relocs) > 0 {
+			t.Reloff = move32(t.Reloff)
+		}
+	}
+	s.Relocs = append(s.Relocs, relocs...)
+	s.Nreloc = uint32(len(s.Relocs))
+	if err := f.updateSegmentLoad(seg); err != nil {
+		return err
+	}
+
+	if st := f.Symtab; st != nil {
+		st.Symoff, st.Stroff = move32(st.Symoff), move32(st.Stroff)
+		if err := f.updateLinkeditLoad(&st.LoadBytes, &st.SymtabCmd); err != nil {
+			return err
+		}
+	}
+	if dt := f.Dysymtab; dt != nil && dt.Nindirectsyms != 0 {
+		dt.Indirectsymoff = move32(dt.Indirectsymoff)
+		if err := f.updateLinkeditLoad(&dt.LoadBytes, &dt.DysymtabCmd); err != nil {
+			return err
+		}
+	}
+	if d := f.DataInCode; d != nil && d.Len != 0 {
+		d.Offset = move(d.Offset)
+		f.setDataOff(LoadCmdDataInCode, uint32(d.Offset))
+	}
+	if h := f.LinkerOptHint; h != nil && h.Len != 0 {
+		h.Offset = move(h.Offset)
+		f.setDataOff(LoadCmdLinkerOptimizationHint, uint32(h.Offset))
+	}
+	if f.FinalSegEnd > at {
+		f.FinalSegEnd += grow
+	}
+	return nil
+}
+
+// setDataOff sets the data offset of the linkedit_data_command cmd.
+func (f *File) setDataOff(cmd LoadCmd, off uint32) {
+	for i, l := range f.Loads {
+		raw, ok := l.(LoadBytes)
+		if !ok || len(raw) < 16 || LoadCmd(f.ByteOrder.Uint32(raw)) != cmd {
+			continue
+		}
+		raw = append(LoadBytes(nil), raw...)
+		f.ByteOrder.PutUint32(raw[8:], off)
+		f.Loads[i] = raw
+	}
+}
+
+// checkRelocs reports the first of relocs that cannot be a relocation
+// entry of the section s.
+func (f *File) checkRelocs(s *Section, relocs []Reloc) error {
+	nsyms := 0
+	if f.Symtab != nil {
+		nsyms = len(f.Symtab.Syms)
+	}
+	for i, r := range relocs {
+		var next *Reloc
+		if i+1 < len(relocs) {
+			next = &relocs[i+1]
+		}
+		var err error
+		switch f.Cpu {
+		case CpuAmd64:
+			err = checkRelocX86_64(r, next)
+		case CpuArm64:
+			err = checkRelocARM64(r, next)
+		case Cpu386:
+			if r.Type > uint8(GENERIC_RELOC_TLV) {
+				err = fmt.Errorf("unknown type %d", r.Type)
+			}
+		case CpuArm:
+			if r.Type > uint8(ARM_RELOC_HALF_SECTDIFF) {
+				err = fmt.Errorf("unknown type %d", r.Type)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("relocation %d: %v", i, err)
+		}
+		if r.Scattered {
+			if r.Addr >= 1<<24 {
+				return fmt.Errorf("relocation %d: scattered address %#x does not fit in 24 bits", i, r.Addr)
+			}
+			continue
+		}
+		if f.Cpu == CpuArm64 && r.Type == uint8(ARM64_RELOC_ADDEND) {
+			// The addend is held in place of the symbol number.
+			if r.Value >= 1<<24 {
+				return fmt.Errorf("relocation %d: addend %#x does not fit in 24 bits", i, r.Value)
+			}
+		} else if r.Extern && int(r.Value) >= nsyms {
+			return fmt.Errorf("relocation %d: symbol %d of %d", i, r.Value, nsyms)
+		} else if !r.Extern && (r.Value == 0 || int(r.Value) > len(f.Sections)) {
+			return fmt.Errorf("relocation %d: section %d of %d", i, r.Value, len(f.Sections))
+		}
+		if uint64(r.Addr)+1<<r.Len > s.Size {
+			return fmt.Errorf("relocation %d: %d bytes at %#x lie outside of section %s", i, 1<<r.Len, r.Addr, s.Name)
+		}
+	}
+	return nil
+}
+
+// checkReloc reports whether r has the pc-relativity, length and target
+// kind that its type requires. Lengths are given as log2 of the size.
+func checkReloc(r Reloc, name fmt.Stringer, pcrel bool, lens ...uint8) error {
+	if r.Pcrel != pcrel {
+		if pcrel {
+			return fmt.Errorf("%v must be pc-relative", name)
+		}
+		return fmt.Errorf("%v cannot be pc-relative", name)
+	}
+	for _, l := range lens {
+		if r.Len == l {
+			return nil
+		}
+	}
+	return fmt.Errorf("%v cannot be %d bytes long", name, 1<<r.Len)
+}
+
+// checkPair reports whether next is an UNSIGNED entry of type unsigned
+// for the same field as the SUBTRACTOR entry r.
+func checkPair(r Reloc, next *Reloc, name fmt.Stringer, unsigned uint8) error {
+	if next == nil || next.Type != unsigned || next.Addr != r.Addr || next.Len != r.Len {
+		return fmt.Errorf("%v must be followed by an unsigned relocation of the same field", name)
+	}
+	return nil
+}
+
+func checkRelocX86_64(r Reloc, next *Reloc) error {
+	t := RelocTypeX86_64(r.Type)
+	if r.Scattered {
+		return errors.New("x86_64 has no scattered relocations")
+	}
+	switch t {
+	case X86_64_RELOC_UNSIGNED:
+		return checkReloc(r, t, false, 2, 3)
+	case X86_64_RELOC_SIGNED, X86_64_RELOC_SIGNED_1, X86_64_RELOC_SIGNED_2, X86_64_RELOC_SIGNED_4, X86_64_RELOC_BRANCH:
+		return checkReloc(r, t, true, 2)
+	case X86_64_RELOC_GOT_LOAD, X86_64_RELOC_GOT, X86_64_RELOC_TLV:
+		if !r.Extern {
+			return fmt.Errorf("%v must refer to a symbol", t)
+		}
+		return checkReloc(r, t, true, 2)
+	case X86_64_RELOC_SUBTRACTOR:
+		if !r.Extern {
+			return fmt.Errorf("%v must refer to a symbol", t)
+		}
+		if err := checkReloc(r, t, false, 2, 3); err != nil {
+			return err
+		}
+		return checkPair(r, next, t, uint8(X86_64_RELOC_UNSIGNED))
+	}
+	return fmt.Errorf("unknown x86_64 type %d", r.Type)
+}
+
+func checkRelocARM64(r Reloc, next *Reloc) error {
+	t := RelocTypeARM64(r.Type)
+	if r.Scattered {
+		return errors.New("arm64 has no scattered relocations")
+	}
+	switch t {
+	case ARM64_RELOC_UNSIGNED:
+		return checkReloc(r, t, false, 2, 3)
+	case ARM64_RELOC_BRANCH26, ARM64_RELOC_PAGE21:
+		return checkReloc(r, t, true, 2)
+	case ARM64_RELOC_PAGEOFF12:
+		return checkReloc(r, t, false, 2)
+	case ARM64_RELOC_GOT_LOAD_PAGE21, ARM64_RELOC_TLVP_LOAD_PAGE21,
+		ARM64_RELOC_GOT_LOAD_PAGEOFF12, ARM64_RELOC_TLVP_LOAD_PAGEOFF12:
+		if !r.Extern {
+			return fmt.Errorf("%v must refer to a symbol", t)
+		}
+		return checkReloc(r, t, t == ARM64_RELOC_GOT_LOAD_PAGE21 || t == ARM64_RELOC_TLVP_LOAD_PAGE21, 2)
+	case ARM64_RELOC_POINTER_TO_GOT:
+		if !r.Extern {
+			return fmt.Errorf("%v must refer to a symbol", t)
+		}
+		if r.Pcrel {
+			return checkReloc(r, t, true, 2)
+		}
+		return checkReloc(r, t, false, 3)
+	case ARM64_RELOC_SUBTRACTOR:
+		if !r.Extern {
+			return fmt.Errorf("%v must refer to a symbol", t)
+		}
+		if err := checkReloc(r, t, false, 2, 3); err != nil {
+			return err
+		}
+		return checkPair(r, next, t, uint8(ARM64_RELOC_UNSIGNED))
+	case ARM64_RELOC_ADDEND:
+		if r.Extern {
+			return fmt.Errorf("%v cannot refer to a symbol", t)
+		}
+		if err := checkReloc(r, t, false, 2); err != nil {
+			return err
+		}
+		if next == nil || next.Addr != r.Addr || (next.Type != uint8(ARM64_RELOC_BRANCH26) && next.Type != uint8(ARM64_RELOC_PAGE21) && next.Type != uint8(ARM64_RELOC_PAGEOFF12)) {
+			return fmt.Errorf("%v must be followed by a BRANCH26, PAGE21 or PAGEOFF12 relocation of the same instruction", t)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown arm64 type %d", r.Type)
+}
@@ -0,0 +1,108 @@
+package macho
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestAddRelocation(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	text, unwind := f.Section("__text"), f.Section("__compact_unwind")
+
+	bad := []struct {
+		name string
+		r    []Reloc
+	}{
+		{"signed not pc-relative", []Reloc{{Addr: 0x4, Value: 2, Type: uint8(X86_64_RELOC_SIGNED), Len: 2}}},
+		{"8 byte branch", []Reloc{{Addr: 0x4, Value: 1, Type: uint8(X86_64_RELOC_BRANCH), Len: 3, Pcrel: true, Extern: true}}},
+		{"got load of a section", []Reloc{{Addr: 0x4, Value: 1, Type: uint8(X86_64_RELOC_GOT_LOAD), Len: 2, Pcrel: true}}},
+		{"lone subtractor", []Reloc{{Addr: 0x4, Value: 0, Type: uint8(X86_64_RELOC_SUBTRACTOR), Len: 3, Extern: true}}},
+		{"scattered", []Reloc{{Addr: 0x4, Value: 0x10, Len: 2, Scattered: true}}},
+		{"unknown type", []Reloc{{Addr: 0x4, Value: 1, Type: 12, Len: 2, Extern: true}}},
+		{"missing symbol", []Reloc{{Addr: 0x4, Value: 2, Type: uint8(X86_64_RELOC_BRANCH), Len: 2, Pcrel: true, Extern: true}}},
+		{"missing section", []Reloc{{Addr: 0x4, Value: 5, Type: uint8(X86_64_RELOC_SIGNED), Len: 2, Pcrel: true}}},
+		{"past the end", []Reloc{{Addr: 0x28, Value: 1, Type: uint8(X86_64_RELOC_BRANCH), Len: 2, Pcrel: true, Extern: true}}},
+	}
+	for _, tt := range bad {
+		if err := f.AddRelocation(text, tt.r...); err == nil {
+			t.Errorf("AddRelocation accepted a %s relocation", tt.name)
+		}
+	}
+	if len(text.Relocs) != 2 {
+		t.Fatalf("refused relocations were added: %+v", text.Relocs)
+	}
+
+	call := Reloc{Addr: 0x4, Value: 1, Type: uint8(X86_64_RELOC_BRANCH), Len: 2, Pcrel: true, Extern: true}
+	if err := f.AddRelocation(text, call); err != nil {
+		t.Fatal(err)
+	}
+	diff := []Reloc{
+		{Addr: 0x8, Value: 0, Type: uint8(X86_64_RELOC_SUBTRACTOR), Len: 3, Extern: true},
+		{Addr: 0x8, Value: 1, Type: uint8(X86_64_RELOC_UNSIGNED), Len: 3, Extern: true},
+	}
+	if err := f.AddRelocation(unwind, diff...); err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range f.Validate() {
+		t.Errorf("Validate: %v", issue)
+	}
+
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Section("__text").Relocs; len(got) != 3 || got[2] != call {
+		t.Errorf("__text relocations are %+v, want %+v last", got, call)
+	}
+	if got := g.Section("__compact_unwind").Relocs; len(got) != 3 || !reflect.DeepEqual(got[1:], diff) {
+		t.Errorf("__compact_unwind relocations are %+v, want %+v last", got, diff)
+	}
+	var names []string
+	for _, s := range g.Symtab.Syms {
+		names = append(names, s.Name)
+	}
+	if want := []string{"_main", "_printf"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("symbols are %q, want %q", names, want)
+	}
+
+	exe, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exe.Close()
+	if err := exe.AddRelocation(exe.Sections[0], call); err == nil {
+		t.Error("AddRelocation succeeded for an executable")
+	}
+}
+
+func TestCheckRelocARM64(t *testing.T) {
+	page := Reloc{Addr: 0, Value: 1, Type: uint8(ARM64_RELOC_PAGE21), Len: 2, Pcrel: true, Extern: true}
+	addend := Reloc{Addr: 0, Value: 0x10, Type: uint8(ARM64_RELOC_ADDEND), Len: 2}
+	if err := checkRelocARM64(addend, &page); err != nil {
+		t.Errorf("ADDEND before PAGE21: %v", err)
+	}
+	if err := checkRelocARM64(addend, nil); err == nil {
+		t.Error("lone ADDEND was accepted")
+	}
+	got := Reloc{Value: 1, Type: uint8(ARM64_RELOC_GOT_LOAD_PAGEOFF12), Len: 2, Extern: true}
+	if err := checkRelocARM64(got, nil); err != nil {
+		t.Errorf("GOT_LOAD_PAGEOFF12: %v", err)
+	}
+	got.Pcrel = true
+	if err := checkRelocARM64(got, nil); err == nil {
+		t.Error("pc-relative GOT_LOAD_PAGEOFF12 was accepted")
+	}
+	ptr := Reloc{Value: 1, Type: uint8(ARM64_RELOC_POINTER_TO_GOT), Len: 3, Pcrel: true, Extern: true}
+	if err := checkRelocARM64(ptr, nil); err == nil {
+		t.Error("pc-relative 8 byte POINTER_TO_GOT was accepted")
+	}
+}
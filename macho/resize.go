@@ -0,0 +1,203 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// segmentSections returns the sections of the segment seg, which
+// follow those of the segments before it in f.Sections.
+func (f *File) segmentSections(seg *Segment) []*Section {
+	next := 0
+	for _, l := range f.Loads {
+		s, ok := l.(*Segment)
+		if !ok {
+			continue
+		}
+		if s == seg {
+			if next+int(s.Nsect) > len(f.Sections) {
+				return nil
+			}
+			return f.Sections[next : next+int(s.Nsect)]
+		}
+		next += int(s.Nsect)
+	}
+	return nil
+}
+
+// ResizeSection replaces the contents of the section sectname of the
+// segment segname with data. The sections after it in the segment move
+// down in the file and in memory as far as the growth and their
+// alignment require, and the file and memory sizes of the segment grow
+// to hold them, rounded to pages outside of object files. The ranges the
+// segment grows into must not hold another segment or any __LINKEDIT
+// data. The segment and section headers in the load commands are
+// rewritten.
+//
+// Contents that shrink leave the other sections in place. Symbols,
+// relocations and code referring to the moved sections are not updated.
+func (f *File) ResizeSection(segname, sectname string, data []byte) error {
+	var seg *Segment
+	var sects []*Section
+	idx := -1
+	for _, l := range f.Loads {
+		s, ok := l.(*Segment)
+		if !ok {
+			continue
+		}
+		for i, sect := range f.segmentSections(s) {
+			if sect.Seg == segname && sect.Name == sectname {
+				seg, sects, idx = s, f.segmentSections(s), i
+			}
+		}
+	}
+	if seg == nil {
+		return fmt.Errorf("no section %s,%s", segname, sectname)
+	}
+	sect := sects[idx]
+	if isZerofill(sect.Flags) {
+		return fmt.Errorf("section %s,%s is zero filled", segname, sectname)
+	}
+	size := uint64(len(data))
+
+	// Lay the following sections out after the new contents, keeping
+	// the distance between their address and file offset.
+	type move struct {
+		sect      *Section
+		addr, off uint64
+	}
+	var moves []move
+	vend, fend := sect.Addr+size, uint64(sect.Offset)+size
+	for _, t := range sects[idx+1:] {
+		if t.Addr < sect.Addr {
+			continue
+		}
+		addr := t.Addr
+		if a := alignUp(vend, uint64(1)<<t.Align); a > addr {
+			addr = a
+		}
+		m := move{t, addr, uint64(t.Offset) + addr - t.Addr}
+		moves = append(moves, m)
+		vend = addr + t.Size
+		if !isZerofill(t.Flags) && t.Offset != 0 && m.off+t.Size > fend {
+			fend = m.off + t.Size
+		}
+	}
+	memsz, filesz := seg.Memsz, seg.Filesz
+	page := uint64(1)
+	if f.Type != TypeObj {
+		page = 0x1000
+		if f.Cpu == CpuArm64 {
+			page = 0x4000
+		}
+	}
+	if vend > seg.Addr+memsz {
+		memsz = alignUp(vend-seg.Addr, page)
+	}
+	if fend > seg.Offset+filesz {
+		filesz = alignUp(fend-seg.Offset, page)
+	}
+	if err := f.checkSegmentGrowth(seg, memsz, filesz); err != nil {
+		return err
+	}
+
+	sect.Replace(bytes.NewReader(data), int64(size))
+	sect.Size = size
+	for _, m := range moves {
+		if m.off != uint64(m.sect.Offset) && !isZerofill(m.sect.Flags) && m.sect.Offset != 0 {
+			m.sect.Offset = uint32(m.off)
+		}
+		m.sect.Addr = m.addr
+	}
+	seg.Memsz, seg.Filesz = memsz, filesz
+	if end := seg.Offset + seg.Filesz; end > f.FinalSegEnd {
+		f.FinalSegEnd = end
+	}
+	return f.updateSegmentLoad(seg)
+}
+
+func alignUp(v, align uint64) uint64 {
+	return (v + align - 1) / align * align
+}
+
+// checkSegmentGrowth reports an error if growing seg to memsz and filesz
+// bytes would make it overlap another segment in memory or in the file,
+// __LINKEDIT data or a relocation table.
+func (f *File) checkSegmentGrowth(seg *Segment, memsz, filesz uint64) error {
+	for _, s := range f.segments() {
+		if s == seg {
+			continue
+		}
+		if s.Memsz != 0 && memsz > seg.Memsz && s.Addr < seg.Addr+memsz && seg.Addr+seg.Memsz < s.Addr+s.Memsz {
+			return fmt.Errorf("segment %s would grow over segment %s at %#x", seg.Name, s.Name, s.Addr)
+		}
+		if s.Filesz != 0 && filesz > seg.Filesz && s.Offset < seg.Offset+filesz && seg.Offset+seg.Filesz < s.Offset+s.Filesz {
+			return fmt.Errorf("segment %s would grow over the file data of segment %s at %#x", seg.Name, s.Name, s.Offset)
+		}
+	}
+	if filesz <= seg.Filesz {
+		return nil
+	}
+	start, end := seg.Offset+seg.Filesz, seg.Offset+filesz
+	blobs := f.linkeditBlobs()
+	for _, s := range f.Sections {
+		if s.Nreloc != 0 {
+			blobs = append(blobs, linkeditBlob{"relocations of " + s.Name, uint64(s.Reloff), 8 * uint64(s.Nreloc)})
+		}
+	}
+	for _, b := range blobs {
+		if b.off < end && start < b.off+b.size {
+			return fmt.Errorf("segment %s would grow over the %s at %#x", seg.Name, b.name, b.off)
+		}
+	}
+	return nil
+}
+
+// updateSegmentLoad rewrites the segment load command of seg and the
+// headers of its sections from the File's structures, keeping the
+// fields they do not hold, such as the reserved fields of sections.
+func (f *File) updateSegmentLoad(seg *Segment) error {
+	raw := append([]byte(nil), seg.LoadBytes...)
+	r := bytes.NewReader(raw)
+	var b bytes.Buffer
+	switch seg.Cmd {
+	case LoadCmdSegment64:
+		var hdr Segment64
+		if err := binary.Read(r, f.ByteOrder, &hdr); err != nil {
+			return err
+		}
+		hdr.Addr, hdr.Memsz, hdr.Offset, hdr.Filesz = seg.Addr, seg.Memsz, seg.Offset, seg.Filesz
+		binary.Write(&b, f.ByteOrder, hdr)
+		for _, s := range f.segmentSections(seg) {
+			var sh Section64
+			if err := binary.Read(r, f.ByteOrder, &sh); err != nil {
+				return err
+			}
+			sh.Addr, sh.Size, sh.Offset = s.Addr, s.Size, s.Offset
+			sh.Reloff, sh.Nreloc = s.Reloff, s.Nreloc
+			binary.Write(&b, f.ByteOrder, sh)
+		}
+	case LoadCmdSegment:
+		var hdr Segment32
+		if err := binary.Read(r, f.ByteOrder, &hdr); err != nil {
+			return err
+		}
+		hdr.Addr, hdr.Memsz, hdr.Offset, hdr.Filesz = uint32(seg.Addr), uint32(seg.Memsz), uint32(seg.Offset), uint32(seg.Filesz)
+		binary.Write(&b, f.ByteOrder, hdr)
+		for _, s := range f.segmentSections(seg) {
+			var sh Section32
+			if err := binary.Read(r, f.ByteOrder, &sh); err != nil {
+				return err
+			}
+			sh.Addr, sh.Size, sh.Offset = uint32(s.Addr), uint32(s.Size), s.Offset
+			sh.Reloff, sh.Nreloc = s.Reloff, s.Nreloc
+			binary.Write(&b, f.ByteOrder, sh)
+		}
+	default:
+		return fmt.Errorf("segment %s has load command %v", seg.Name, seg.Cmd)
+	}
+	copy(raw, b.Bytes())
+	seg.LoadBytes = raw
+	return nil
+}
@@ -0,0 +1,84 @@
+package macho
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestResizeSection(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// __nl_symbol_ptr grows into __la_symbol_ptr, which moves down
+	// within the slack of __DATA.
+	ptrs := bytes.Repeat([]byte{0xaa}, 0x20)
+	if err := f.ResizeSection("__DATA", "__nl_symbol_ptr", ptrs); err != nil {
+		t.Fatal(err)
+	}
+	la := f.Section("__la_symbol_ptr")
+	if la.Addr != 0x100001020 || la.Offset != 0x1020 {
+		t.Errorf("__la_symbol_ptr moved to %#x at offset %#x, want 0x100001020 at 0x1020", la.Addr, la.Offset)
+	}
+	if seg := f.Segment("__DATA"); seg.Memsz != 0x1000 || seg.Filesz != 0x1000 {
+		t.Errorf("__DATA grew to %#x bytes of memory and %#x of file", seg.Memsz, seg.Filesz)
+	}
+	if err := f.ResizeSection("__DATA", "__la_symbol_ptr", make([]byte, 0x1800)); err == nil {
+		t.Error("ResizeSection grew __DATA over __LINKEDIT")
+	}
+	if err := f.ResizeSection("__DATA", "__nope", nil); err == nil {
+		t.Error("ResizeSection accepted a missing section")
+	}
+	for _, issue := range f.Validate() {
+		t.Errorf("Validate: %v", issue)
+	}
+
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nl := g.Section("__nl_symbol_ptr")
+	if data, err := nl.Data(); err != nil || !bytes.Equal(data, ptrs) {
+		t.Errorf("__nl_symbol_ptr is %x, %v", data, err)
+	}
+	if la := g.Section("__la_symbol_ptr"); la.Addr != 0x100001020 || la.Offset != 0x1020 || la.Size != 8 {
+		t.Errorf("__la_symbol_ptr after writing: %+v", la.SectionHeader)
+	}
+}
+
+func TestResizeSectionObj(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// The relocations follow the section data, so the segment cannot
+	// grow, but shrinking __cstring leaves everything in place.
+	if err := f.ResizeSection("__TEXT", "__cstring", make([]byte, 0x20)); err == nil {
+		t.Error("ResizeSection grew the segment over the relocations")
+	}
+	if err := f.ResizeSection("__TEXT", "__cstring", []byte("hi\x00")); err != nil {
+		t.Fatal(err)
+	}
+	if s := f.Section("__compact_unwind"); s.Addr != 0x38 || s.Offset != 0x258 {
+		t.Errorf("__compact_unwind moved to %#x at offset %#x", s.Addr, s.Offset)
+	}
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := g.Section("__cstring"); s.Size != 3 {
+		t.Errorf("__cstring has size %d after writing, want 3", s.Size)
+	}
+}
@@ -0,0 +1,158 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// RPaths returns the paths of the LC_RPATH commands of f, in order.
+func (f *File) RPaths() []string {
+	var paths []string
+	for _, l := range f.Loads {
+		if r, ok := l.(*Rpath); ok {
+			paths = append(paths, r.Path)
+		}
+	}
+	return paths
+}
+
+// AddRPath adds an LC_RPATH command for path to the load commands, like
+// install_name_tool -add_rpath, as insertLoad orders it. The path must
+// not be one f already has, and the new command must fit in the space
+// before the first section. A code signature of f is invalidated.
+func (f *File) AddRPath(path string) error {
+	for _, p := range f.RPaths() {
+		if p == path {
+			return fmt.Errorf("rpath %q is already present", path)
+		}
+	}
+	raw, err := f.pathLoadCmd(RpathCmd{Cmd: LoadCmdRpath, Path: uint32(binary.Size(RpathCmd{}))}, path)
+	if err != nil {
+		return err
+	}
+	if err := f.checkLoadCommandsSize(int64(len(raw))); err != nil {
+		return err
+	}
+	f.insertLoad(&Rpath{LoadBytes: LoadBytes(raw), Path: path})
+	return nil
+}
+
+// RemoveRPath removes the LC_RPATH command for path, like
+// install_name_tool -delete_rpath.
+func (f *File) RemoveRPath(path string) error {
+	for i, l := range f.Loads {
+		if r, ok := l.(*Rpath); ok && r.Path == path {
+			f.Loads = append(f.Loads[:i], f.Loads[i+1:]...)
+			f.Ncmd--
+			f.Cmdsz -= uint32(len(r.LoadBytes))
+			return nil
+		}
+	}
+	return fmt.Errorf("no rpath %q", path)
+}
+
+// ChangeDylibPath replaces the path of the LC_LOAD_DYLIB commands
+// naming oldPath with newPath, like install_name_tool -change. The
+// timestamp and versions of the commands are kept. If the commands grow,
+// they must still fit in the space before the first section. A code
+// signature of f is invalidated.
+func (f *File) ChangeDylibPath(oldPath, newPath string) error {
+	var libs []*Dylib
+	var grow int64
+	var raws [][]byte
+	for _, l := range f.Loads {
+		lib, ok := l.(*Dylib)
+		if !ok || lib.Name != oldPath {
+			continue
+		}
+		hdr := DylibCmd{
+			Cmd:            LoadCmd(f.ByteOrder.Uint32(lib.LoadBytes)),
+			Name:           uint32(binary.Size(DylibCmd{})),
+			Time:           lib.Time,
+			CurrentVersion: lib.CurrentVersion,
+			CompatVersion:  lib.CompatVersion,
+		}
+		raw, err := f.pathLoadCmd(hdr, newPath)
+		if err != nil {
+			return err
+		}
+		libs = append(libs, lib)
+		raws = append(raws, raw)
+		grow += int64(len(raw)) - int64(len(lib.LoadBytes))
+	}
+	if len(libs) == 0 {
+		return fmt.Errorf("no dylib %q", oldPath)
+	}
+	if err := f.checkLoadCommandsSize(grow); err != nil {
+		return err
+	}
+	for i, lib := range libs {
+		lib.LoadBytes = LoadBytes(raws[i])
+		lib.Name = newPath
+	}
+	f.Cmdsz = uint32(int64(f.Cmdsz) + grow)
+	return nil
+}
+
+// pathLoadCmd encodes a load command made of the fixed part hdr, whose
+// second field is the command size, followed by the string s, padded to
+// the alignment of load commands.
+func (f *File) pathLoadCmd(hdr interface{}, s string) ([]byte, error) {
+	if bytes.IndexByte([]byte(s), 0) >= 0 {
+		return nil, fmt.Errorf("path %q contains a NUL byte", s)
+	}
+	var b bytes.Buffer
+	binary.Write(&b, f.ByteOrder, hdr)
+	b.WriteString(s)
+	b.WriteByte(0)
+	align := 4
+	if f.Magic == Magic64 {
+		align = 8
+	}
+	for b.Len()%align != 0 {
+		b.WriteByte(0)
+	}
+	raw := b.Bytes()
+	f.ByteOrder.PutUint32(raw[4:], uint32(len(raw)))
+	return raw, nil
+}
+
+// checkLoadCommandsSize reports an error if growing the load commands by
+// grow bytes would make them overlap the first section.
+func (f *File) checkLoadCommandsSize(grow int64) error {
+	end := int64(f.loadCommandsStart()) + int64(f.Cmdsz) + grow + int64(len(f.Insertion))
+	if room := f.loadCommandsRoom(); uint64(end) > room {
+		return fmt.Errorf("load commands would end at %#x, past the first section at %#x", end, room)
+	}
+	return nil
+}
+
+// insertLoad adds the load command l to f. So that the
+// commands written depend only on what was added, not on the edits made
+// in between, l goes after the last command of the same type, or else at
+// the end, but always before an LC_CODE_SIGNATURE, which stays last.
+func (f *File) insertLoad(l Load) {
+	typeOf := func(l Load) LoadCmd {
+		if raw := l.Raw(); len(raw) >= 4 {
+			return LoadCmd(f.ByteOrder.Uint32(raw))
+		}
+		return 0
+	}
+	cmd := typeOf(l)
+	i := len(f.Loads)
+	if i > 0 && typeOf(f.Loads[i-1]) == LoadCmdSignature {
+		i--
+	}
+	for j := len(f.Loads) - 1; j >= 0; j-- {
+		if typeOf(f.Loads[j]) == cmd {
+			i = j + 1
+			break
+		}
+	}
+	f.Loads = append(f.Loads, nil)
+	copy(f.Loads[i+1:], f.Loads[i:])
+	f.Loads[i] = l
+	f.Ncmd++
+	f.Cmdsz += uint32(len(l.Raw()))
+}
@@ -0,0 +1,129 @@
+package macho
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRPathEdits(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	reparse := func() *File {
+		t.Helper()
+		b, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return g
+	}
+
+	if err := f.AddRPath("/my/rpath"); err == nil {
+		t.Error("AddRPath added a duplicate rpath")
+	}
+	if err := f.AddRPath("@loader_path/../Frameworks"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reparse().RPaths(), []string{"/my/rpath", "@loader_path/../Frameworks"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RPaths() = %q, want %q", got, want)
+	}
+	if err := f.RemoveRPath("/my/rpath"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.RemoveRPath("/my/rpath"); err == nil {
+		t.Error("RemoveRPath removed a missing rpath")
+	}
+	g := reparse()
+	if got, want := g.RPaths(), []string{"@loader_path/../Frameworks"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RPaths() = %q after RemoveRPath, want %q", got, want)
+	}
+	if g.Ncmd != uint32(len(g.Loads)) {
+		t.Errorf("Ncmd = %d for %d load commands", g.Ncmd, len(g.Loads))
+	}
+
+	old := f.Cmdsz
+	lib := "@executable_path/../Frameworks/libSystem.B.dylib"
+	if err := f.ChangeDylibPath("/usr/lib/libSystem.B.dylib", lib); err != nil {
+		t.Fatal(err)
+	}
+	if f.Cmdsz <= old {
+		t.Errorf("Cmdsz = %#x after lengthening a dylib path, was %#x", f.Cmdsz, old)
+	}
+	g = reparse()
+	if libs, _ := g.ImportedLibraries(); !reflect.DeepEqual(libs, []string{lib}) {
+		t.Errorf("ImportedLibraries() = %q, want %q", libs, []string{lib})
+	}
+	for _, l := range g.Loads {
+		if d, ok := l.(*Dylib); ok && (d.CurrentVersion == 0 || d.CompatVersion == 0) {
+			t.Errorf("ChangeDylibPath lost the versions of %q: %+v", d.Name, d)
+		}
+	}
+
+	if err := f.ChangeDylibPath(lib, strings.Repeat("x", 0x10000)); err == nil {
+		t.Error("ChangeDylibPath grew the load commands past the first section")
+	}
+	if err := f.ChangeDylibPath("/no/such.dylib", lib); err == nil {
+		t.Error("ChangeDylibPath changed a missing dylib")
+	}
+}
+
+func TestInsertLoadOrder(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cmds := func() []LoadCmd {
+		var c []LoadCmd
+		for _, l := range f.Loads {
+			c = append(c, LoadCmd(f.ByteOrder.Uint32(l.Raw())))
+		}
+		return c
+	}
+
+	// A signature stays last, and a new LC_RPATH follows the last one
+	// rather than what was added after it.
+	sig := make([]byte, 16)
+	f.ByteOrder.PutUint32(sig, uint32(LoadCmdSignature))
+	f.ByteOrder.PutUint32(sig[4:], uint32(len(sig)))
+	f.insertLoad(LoadBytes(sig))
+	for _, cmd := range cmds() {
+		if cmd == LoadCmdTwolevelHints {
+			t.Fatal("the file already has an LC_TWOLEVEL_HINTS command")
+		}
+	}
+	hints := make([]byte, 16)
+	f.ByteOrder.PutUint32(hints, uint32(LoadCmdTwolevelHints))
+	f.ByteOrder.PutUint32(hints[4:], uint32(len(hints)))
+	f.insertLoad(LoadBytes(hints))
+	if err := f.AddRPath("@loader_path"); err != nil {
+		t.Fatal(err)
+	}
+	c := cmds()
+	if n := len(c); c[n-1] != LoadCmdSignature || c[n-2] != LoadCmdTwolevelHints {
+		t.Errorf("load commands end with %v", c[n-3:])
+	}
+	last := -1
+	for i, cmd := range c {
+		if cmd == LoadCmdRpath {
+			if last >= 0 && last != i-1 {
+				t.Errorf("LC_RPATH commands at %d and %d are apart", last, i)
+			}
+			last = i
+		}
+	}
+	if got, want := f.RPaths(), []string{"/my/rpath", "@loader_path"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RPaths() = %q, want %q", got, want)
+	}
+	if f.Ncmd != uint32(len(f.Loads)) {
+		t.Errorf("Ncmd = %d for %d load commands", f.Ncmd, len(f.Loads))
+	}
+}
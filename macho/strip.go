@@ -0,0 +1,77 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// StripSymbols rebuilds the symbol and string tables with only the
+// symbols dyld needs: the undefined symbols and the defined external
+// symbols the indirect symbol table refers to. With keepExported, the
+// other defined external symbols are kept too, as with strip -x; without
+// it, a file that imports nothing is left with no symbols at all. Local
+// and debugging symbols are always removed, and indirect symbol table
+// entries that referred to them are marked local.
+//
+// The index ranges of the dynamic symbol table and the two-level hints
+// are updated, and the indirect symbol table, the hints, the string table
+// and the code signature move up behind the smaller symbol table,
+// shrinking __LINKEDIT. The code signature is not regenerated, so a
+// signed file must be signed again. Object files, whose relocations refer
+// to symbols by index, are refused, as are files with PreserveRaw set.
+func (f *File) StripSymbols(keepExported bool) error {
+	if f.Type == TypeObj {
+		return errors.New("cannot strip the symbols of an object file")
+	}
+	if f.PreserveRaw {
+		return errors.New("cannot strip the symbols of a file whose original bytes are preserved")
+	}
+	st, dt := f.Symtab, f.Dysymtab
+	if st == nil {
+		return nil
+	}
+	if err := f.checkSymtabEdit(); err != nil {
+		return err
+	}
+
+	// Choose the symbols to keep, which keep their order, so the local,
+	// defined external and undefined symbols stay in their ranges.
+	referenced := make(map[uint32]bool)
+	if dt != nil {
+		for _, x := range dt.IndirectSyms {
+			referenced[x] = true
+		}
+	}
+	var syms []Symbol
+	var from []int
+	for i, sym := range st.Syms {
+		var keep bool
+		switch symbolRange(&sym) {
+		case 1:
+			keep = referenced[uint32(i)] || keepExported && sym.Type&N_PEXT == 0
+		case 2:
+			keep = true
+		}
+		if keep {
+			syms, from = append(syms, sym), append(from, i)
+		}
+	}
+	return f.rewriteSymtab(syms, from)
+}
+
+// updateLinkeditLoad rewrites the start of the load command raw with
+// hdr, a SymtabCmd or DysymtabCmd.
+func (f *File) updateLinkeditLoad(raw *LoadBytes, hdr interface{}) error {
+	var b bytes.Buffer
+	if err := binary.Write(&b, f.ByteOrder, hdr); err != nil {
+		return err
+	}
+	if b.Len() > len(*raw) {
+		return errors.New("load command is shorter than its header")
+	}
+	out := append(LoadBytes(nil), (*raw)...)
+	copy(out, b.Bytes())
+	*raw = out
+	return nil
+}
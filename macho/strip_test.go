@@ -0,0 +1,71 @@
+package macho
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestStripSymbols(t *testing.T) {
+	for _, c := range []struct {
+		keepExported bool
+		syms         []string
+		ext, undef   [2]uint32
+		indirect     []uint32
+	}{
+		{false, []string{"_exit", "_puts"}, [2]uint32{0, 0}, [2]uint32{0, 2}, []uint32{0, 1, 0, 1}},
+		{true, []string{"_NXArgc", "_NXArgv", "___progname", "__mh_execute_header", "_environ", "_main", "start", "_exit", "_puts"},
+			[2]uint32{0, 7}, [2]uint32{7, 2}, []uint32{7, 8, 7, 8}},
+	} {
+		f, err := Open("testdata/gcc-amd64-darwin-exec")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		filesz := f.Segment("__LINKEDIT").Filesz
+		if err := f.StripSymbols(c.keepExported); err != nil {
+			t.Fatal(err)
+		}
+		for _, issue := range f.Validate() {
+			t.Errorf("keepExported=%v: Validate: %v", c.keepExported, issue)
+		}
+
+		b, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, sym := range g.Symtab.Syms {
+			names = append(names, sym.Name)
+		}
+		if !reflect.DeepEqual(names, c.syms) {
+			t.Errorf("keepExported=%v: symbols are %q, want %q", c.keepExported, names, c.syms)
+		}
+		d := g.Dysymtab
+		if d.Nlocalsym != 0 || [2]uint32{d.Iextdefsym, d.Nextdefsym} != c.ext || [2]uint32{d.Iundefsym, d.Nundefsym} != c.undef {
+			t.Errorf("keepExported=%v: dynamic symbol table ranges are %+v", c.keepExported, d.DysymtabCmd)
+		}
+		if !reflect.DeepEqual(d.IndirectSyms, c.indirect) {
+			t.Errorf("keepExported=%v: indirect symbols are %v, want %v", c.keepExported, d.IndirectSyms, c.indirect)
+		}
+		if imports, err := g.ImportedSymbols(); err != nil || !reflect.DeepEqual(imports, []string{"_exit", "_puts"}) {
+			t.Errorf("keepExported=%v: imported symbols are %q, %v", c.keepExported, imports, err)
+		}
+		if seg := g.Segment("__LINKEDIT"); seg.Filesz >= filesz || uint64(len(b)) != seg.Offset+seg.Filesz {
+			t.Errorf("keepExported=%v: __LINKEDIT holds %#x bytes, was %#x, file is %#x bytes", c.keepExported, seg.Filesz, filesz, len(b))
+		}
+	}
+
+	f, err := Open("testdata/clang-amd64-darwin.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.StripSymbols(true); err == nil {
+		t.Error("StripSymbols accepted an object file")
+	}
+}
@@ -0,0 +1,103 @@
+package macho
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// SymHash returns the symhash of f, the Mach-O counterpart of the PE
+// import hash: the MD5, in hex, of the sorted, comma-separated names of
+// the undefined external symbols of the symbol table.
+func (f *File) SymHash() (string, error) {
+	if f.Symtab == nil {
+		return "", errors.New("no symbol table")
+	}
+	var names []string
+	for _, sym := range f.Symtab.Syms {
+		if sym.Type&N_STAB == 0 && sym.Type&N_EXT != 0 && sym.Type&N_TYPE == N_UNDF {
+			names = append(names, sym.Name)
+		}
+	}
+	sort.Strings(names)
+	return md5Hex(strings.Join(names, ",")), nil
+}
+
+// DylibHash returns the MD5, in hex, of the comma-separated paths of the
+// dylibs f loads, in load command order, followed by the sorted and
+// deduplicated names of the symbols it imports: those bound by its dyld
+// info, whether eagerly, lazily, weakly or through threaded fixups, and
+// those of the import table of its chained fixups. Unlike SymHash, it
+// tells apart files that import the same symbols from different
+// libraries.
+func (f *File) DylibHash() (string, error) {
+	var parts []string
+	for _, l := range f.Loads {
+		if lib, ok := l.(*Dylib); ok {
+			parts = append(parts, lib.Name)
+		}
+	}
+	seen := make(map[string]bool)
+	var syms []string
+	add := func(sym string) {
+		if !seen[sym] {
+			seen[sym] = true
+			syms = append(syms, sym)
+		}
+	}
+	eager := f.Binds
+	if f.hasThreadedBinds() {
+		eager = f.threadedBinds
+	}
+	for _, get := range []func() ([]Bind, error){eager, f.LazyBinds, f.WeakBinds} {
+		binds, err := get()
+		if err != nil {
+			return "", err
+		}
+		for _, b := range binds {
+			add(b.Symbol)
+		}
+	}
+	imports, err := f.chainedImports()
+	if err != nil {
+		return "", err
+	}
+	for _, sym := range imports {
+		add(sym)
+	}
+	sort.Strings(syms)
+	return md5Hex(strings.Join(append(parts, syms...), ",")), nil
+}
+
+// threadedBinds returns the binds of the threaded fixups of f.
+func (f *File) threadedBinds() ([]Bind, error) {
+	fixups, err := f.ThreadedFixups()
+	if err != nil {
+		return nil, err
+	}
+	var binds []Bind
+	for _, fx := range fixups {
+		if fx.Bind {
+			binds = append(binds, Bind{Symbol: fx.Symbol, Segment: fx.Segment, Offset: fx.Offset})
+		}
+	}
+	return binds, nil
+}
+
+// EntitlementsHash returns the MD5, in hex, of the XML entitlements of the
+// code signature of f, as embedded. It returns "" if f is not signed or
+// has no entitlements.
+func (f *File) EntitlementsHash() (string, error) {
+	sig, err := f.CodeSignature()
+	if err != nil || sig == nil || sig.Entitlements == nil {
+		return "", err
+	}
+	return md5Hex(string(sig.Entitlements)), nil
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
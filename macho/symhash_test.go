@@ -0,0 +1,42 @@
+package macho
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"testing"
+)
+
+func TestSymHash(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	imports, err := f.ImportedSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	if len(imports) != 2 || imports[0] != "_printf" || imports[1] != "dyld_stub_binder" {
+		t.Fatalf("imported symbols are %q", imports)
+	}
+	if h, err := f.SymHash(); err != nil || h != hash("_printf,dyld_stub_binder") {
+		t.Errorf("SymHash = %q, %v", h, err)
+	}
+	if h, err := f.DylibHash(); err != nil || h != hash("/usr/lib/libSystem.B.dylib,_printf,dyld_stub_binder") {
+		t.Errorf("DylibHash = %q, %v", h, err)
+	}
+
+	if h, err := f.EntitlementsHash(); err != nil || h != "" {
+		t.Errorf("EntitlementsHash of an unsigned file = %q, %v", h, err)
+	}
+	const ents = "<plist><dict><key>com.apple.security.get-task-allow</key><true/></dict></plist>"
+	sig := codeSignature("hello", "", []byte(ents))
+	f.SigBlock = &SigBlock{Len: uint32(len(sig)), RawDat: sig}
+	if h, err := f.EntitlementsHash(); err != nil || h != hash(ents) {
+		t.Errorf("EntitlementsHash = %q, %v", h, err)
+	}
+}
@@ -0,0 +1,429 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Section types, stored in the low byte of SectionHeader.Flags, whose
+// slots the indirect symbol table describes, from the index in the
+// reserved1 field of the section header.
+const (
+	sectionNonLazySymbolPointers       = 0x6
+	sectionLazySymbolPointers          = 0x7
+	sectionSymbolStubs                 = 0x8 // reserved2 holds the size of a stub
+	sectionLazyDylibSymbolPointers     = 0x10
+	sectionThreadLocalVariablePointers = 0x14
+)
+
+// An IndirectSymbol is an entry of the indirect symbol table: the symbol
+// that a pointer of a symbol pointer section, such as __got or
+// __la_symbol_ptr, or a stub of a __stubs section stands for.
+type IndirectSymbol struct {
+	Addr  uint64  // address of the pointer or stub
+	Index uint32  // index into Symtab.Syms, or INDIRECT_SYMBOL_LOCAL and INDIRECT_SYMBOL_ABS flags
+	Sym   *Symbol // nil for local and absolute entries
+}
+
+// Local reports whether the slot is for a symbol the static linker
+// resolved, whose pointer holds its address and is rebased.
+func (e IndirectSymbol) Local() bool { return e.Index&indirectSymbolLocal != 0 }
+
+// Abs reports whether the slot is for an absolute symbol, whose pointer
+// holds its value.
+func (e IndirectSymbol) Abs() bool { return e.Index&indirectSymbolAbs != 0 }
+
+// IndirectSymbols returns the indirect symbol table entries for the slots
+// of s, a symbol pointer or stub section, in order. It returns nil for
+// other sections.
+func (f *File) IndirectSymbols(s *Section) ([]IndirectSymbol, error) {
+	var size uint64
+	switch s.Flags & sectionTypeMask {
+	case sectionNonLazySymbolPointers, sectionLazySymbolPointers, sectionLazyDylibSymbolPointers, sectionThreadLocalVariablePointers:
+		size = uint64(f.ptrSize())
+	case sectionSymbolStubs:
+	default:
+		return nil, nil
+	}
+	first, stubSize, err := f.sectionReserved(s)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		size = uint64(stubSize)
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("section %s has stubs of size 0", s.Name)
+	}
+	if f.Dysymtab == nil {
+		return nil, errors.New("no dynamic symbol table")
+	}
+	n := s.Size / size
+	if uint64(first)+n > uint64(len(f.Dysymtab.IndirectSyms)) {
+		return nil, fmt.Errorf("section %s has %d slots from indirect symbol %d, but there are %d indirect symbols", s.Name, n, first, len(f.Dysymtab.IndirectSyms))
+	}
+	entries := make([]IndirectSymbol, n)
+	for i := range entries {
+		x := f.Dysymtab.IndirectSyms[first+uint32(i)]
+		entries[i] = IndirectSymbol{Addr: s.Addr + uint64(i)*size, Index: x}
+		if x&(indirectSymbolLocal|indirectSymbolAbs) == 0 && f.Symtab != nil && int(x) < len(f.Symtab.Syms) {
+			entries[i].Sym = &f.Symtab.Syms[x]
+		}
+	}
+	return entries, nil
+}
+
+// sectionReserved returns the reserved1 and reserved2 fields of the
+// section header of s, which the Section does not keep.
+func (f *File) sectionReserved(s *Section) (uint32, uint32, error) {
+	for _, seg := range f.segments() {
+		for i, t := range f.segmentSections(seg) {
+			if t != s {
+				continue
+			}
+			r := bytes.NewReader(seg.LoadBytes)
+			if seg.Cmd == LoadCmdSegment64 {
+				var sh Section64
+				r.Seek(int64(binary.Size(Segment64{})+i*binary.Size(sh)), 0)
+				if err := binary.Read(r, f.ByteOrder, &sh); err != nil {
+					return 0, 0, err
+				}
+				return sh.Reserve1, sh.Reserve2, nil
+			}
+			var sh Section32
+			r.Seek(int64(binary.Size(Segment32{})+i*binary.Size(sh)), 0)
+			if err := binary.Read(r, f.ByteOrder, &sh); err != nil {
+				return 0, 0, err
+			}
+			return sh.Reserve1, sh.Reserve2, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("section %s is not in a segment", s.Name)
+}
+
+// decodeTwolevelHint decodes a two-level hint, a bit field of an 8 bit
+// sub-image index and a 24 bit table of contents index, which compilers
+// for big-endian machines allocate from the top bit.
+func decodeTwolevelHint(bo binary.ByteOrder, v uint32) TwolevelHint {
+	if bo == binary.BigEndian {
+		return TwolevelHint{uint8(v >> 24), v & 0xffffff}
+	}
+	return TwolevelHint{uint8(v), v >> 8}
+}
+
+func encodeTwolevelHint(bo binary.ByteOrder, h TwolevelHint) uint32 {
+	if bo == binary.BigEndian {
+		return uint32(h.SubImage)<<24 | h.TOC&0xffffff
+	}
+	return uint32(h.SubImage) | h.TOC<<8
+}
+
+// symbolRange returns 0 for a local symbol, 1 for a defined external and
+// 2 for an undefined symbol: the order of their ranges in the symbol
+// table.
+func symbolRange(sym *Symbol) int {
+	switch {
+	case sym.Type&N_STAB != 0 || sym.Type&N_EXT == 0:
+		return 0
+	case sym.Type&N_TYPE == N_UNDF || sym.Type&N_TYPE == N_PBUD:
+		return 2
+	}
+	return 1
+}
+
+// checkSymtabEdit reports an error if the symbol table of f cannot be
+// rewritten: relocations of object files refer to symbols by index, the
+// preserved bytes of the file would keep the old layout, and the legacy
+// tables of the dynamic symbol table are not rebuilt.
+func (f *File) checkSymtabEdit() error {
+	if f.Type == TypeObj {
+		return errors.New("cannot rewrite the symbol table of an object file")
+	}
+	if f.PreserveRaw {
+		return errors.New("cannot rewrite the symbol table of a file whose original bytes are preserved")
+	}
+	if f.Symtab == nil {
+		return errors.New("no symbol table")
+	}
+	if dt := f.Dysymtab; dt != nil && (dt.Ntoc != 0 || dt.Nmodtab != 0 || dt.Nextrefsyms != 0 || dt.Nextrel != 0) {
+		return errors.New("cannot rewrite the symbol table of a file with a table of contents, module table, referenced symbols or external relocations")
+	}
+	return nil
+}
+
+// AddSymbol adds sym to the symbol table and returns its index. A local
+// symbol goes at the end of the local symbols; an external one goes in
+// name order into the defined external or undefined symbols, which dyld
+// searches by name, and must not share its name with another external
+// symbol. The library ordinal of an undefined symbol is in the high byte
+// of Desc, as with two-level namespace binding, and only the binding info
+// makes dyld bind it.
+//
+// The indices after the new symbol move up, and the indirect symbol table
+// and the two-level hints are rebuilt to match; see StripSymbols for how
+// the tables behind the symbol table are laid out again.
+func (f *File) AddSymbol(sym Symbol) (uint32, error) {
+	if err := f.checkSymtabEdit(); err != nil {
+		return 0, err
+	}
+	old := f.Symtab.Syms
+	r := symbolRange(&sym)
+	at := len(old)
+	for i := range old {
+		o := symbolRange(&old[i])
+		if r != 0 && o != 0 && old[i].Name == sym.Name {
+			return 0, fmt.Errorf("there already is an external symbol %s", sym.Name)
+		}
+		if at == len(old) && (o > r || o == r && r != 0 && old[i].Name > sym.Name) {
+			at = i
+		}
+	}
+	syms := make([]Symbol, 0, len(old)+1)
+	from := make([]int, 0, len(old)+1)
+	for i := range old {
+		if i == at {
+			syms, from = append(syms, sym), append(from, -1)
+		}
+		syms, from = append(syms, old[i]), append(from, i)
+	}
+	if at == len(old) {
+		syms, from = append(syms, sym), append(from, -1)
+	}
+	if err := f.rewriteSymtab(syms, from); err != nil {
+		return 0, err
+	}
+	return uint32(at), nil
+}
+
+// RemoveSymbol removes the symbols named name, other than debugging
+// symbols, from the symbol table. The indices after them move down, and
+// the indirect symbol table and the two-level hints are rebuilt to match;
+// indirect symbol table entries for the removed symbols are marked local.
+func (f *File) RemoveSymbol(name string) error {
+	if err := f.checkSymtabEdit(); err != nil {
+		return err
+	}
+	var syms []Symbol
+	var from []int
+	for i, sym := range f.Symtab.Syms {
+		if sym.Name == name && sym.Type&N_STAB == 0 {
+			continue
+		}
+		syms, from = append(syms, sym), append(from, i)
+	}
+	if len(syms) == len(f.Symtab.Syms) {
+		return fmt.Errorf("no symbol %s", name)
+	}
+	return f.rewriteSymtab(syms, from)
+}
+
+// rewriteSymtab replaces the symbol table of f with syms, which must be
+// ordered as the local, the defined external and the undefined symbols,
+// and rebuilds what refers to symbols by index. from[i] is the index in
+// the old table of syms[i], whose entry is kept, or -1 for a new symbol,
+// whose entry is made from it. Indirect symbol table entries follow their
+// symbols, or are marked local if they were removed; the index ranges of
+// the dynamic symbol table are set from syms; and the two-level hints
+// follow the undefined symbols they are for, a new one getting an empty
+// hint, which dyld checks before trusting.
+func (f *File) rewriteSymtab(syms []Symbol, from []int) error {
+	st, dt := f.Symtab, f.Dysymtab
+	var linkedit *Segment
+	for _, s := range f.segments() {
+		if s.Name == "__LINKEDIT" {
+			linkedit = s
+		}
+	}
+	if linkedit == nil {
+		return errors.New("no __LINKEDIT segment")
+	}
+	for _, b := range f.linkeditBlobs() {
+		switch b.name {
+		case "symbol table", "indirect symbol table", "two-level hints", "string table", "code signature":
+			continue
+		}
+		if b.off+b.size > uint64(st.Symoff) {
+			return fmt.Errorf("cannot lay out __LINKEDIT: %s follows the symbol table", b.name)
+		}
+	}
+	oldEnd := uint64(st.Stroff) + uint64(len(st.RawStringtab))
+	if dt != nil && len(dt.RawDysymtab) != 0 && (uint64(dt.Indirectsymoff) < uint64(st.Symoff) || uint64(st.Stroff) < uint64(dt.Indirectsymoff)) {
+		return errors.New("cannot lay out __LINKEDIT: the indirect symbol table does not lie between the symbol and string tables")
+	}
+	hints := f.TwolevelHints
+	if hints != nil && len(hints.RawDat) != 0 && (uint64(hints.Offset) < uint64(st.Symoff) || uint64(st.Stroff) < uint64(hints.Offset)) {
+		return errors.New("cannot lay out __LINKEDIT: the two-level hints do not lie between the symbol and string tables")
+	}
+	if sig := f.SigBlock; sig != nil {
+		if sig.Offset < oldEnd {
+			return errors.New("cannot lay out __LINKEDIT: the code signature precedes the string table")
+		}
+		oldEnd = sig.Offset + uint64(sig.Len)
+	}
+
+	// Rebuild the symbol and string tables.
+	symsz := 12
+	if f.Magic == Magic64 {
+		symsz = 16
+	}
+	if len(st.RawSymtab) < len(st.Syms)*symsz {
+		return errors.New("symbol table is truncated")
+	}
+	strtab := []byte{0}
+	if n := bytes.IndexByte(st.RawStringtab, 0); n >= 0 {
+		// ld64 starts the string table with " \x00".
+		strtab = append([]byte(nil), st.RawStringtab[:n+1]...)
+	}
+	newIdx := make([]int, len(st.Syms))
+	for i := range newIdx {
+		newIdx[i] = -1
+	}
+	var counts [3]uint32
+	var symtab []byte
+	for i, sym := range syms {
+		r := symbolRange(&sym)
+		for _, later := range counts[r+1:] {
+			if later != 0 {
+				return fmt.Errorf("symbol %d, %s, is out of order", i, sym.Name)
+			}
+		}
+		counts[r]++
+		ent := make([]byte, symsz)
+		if from[i] >= 0 {
+			copy(ent, st.RawSymtab[from[i]*symsz:])
+			newIdx[from[i]] = i
+		} else {
+			ent[4], ent[5] = sym.Type, sym.Sect
+			f.ByteOrder.PutUint16(ent[6:], sym.Desc)
+			if symsz == 16 {
+				f.ByteOrder.PutUint64(ent[8:], sym.Value)
+			} else {
+				f.ByteOrder.PutUint32(ent[8:], uint32(sym.Value))
+			}
+		}
+		strx := uint32(len(strtab) - 1)
+		if sym.Name != "" {
+			strx = uint32(len(strtab))
+			strtab = append(append(strtab, sym.Name...), 0)
+		}
+		f.ByteOrder.PutUint32(ent, strx)
+		symtab = append(symtab, ent...)
+	}
+	for len(strtab)%f.ptrSize() != 0 {
+		strtab = append(strtab, 0)
+	}
+
+	// Rebuild the tables that refer to symbols by index.
+	var indirectSyms []uint32
+	var indirect bytes.Buffer
+	if dt != nil {
+		for _, x := range dt.IndirectSyms {
+			switch {
+			case x&(indirectSymbolLocal|indirectSymbolAbs) != 0:
+			case int(x) < len(newIdx) && newIdx[x] >= 0:
+				x = uint32(newIdx[x])
+			default:
+				x = indirectSymbolLocal
+			}
+			indirectSyms = append(indirectSyms, x)
+			binary.Write(&indirect, f.ByteOrder, x)
+		}
+	}
+	var newHints []TwolevelHint
+	var hintDat []byte
+	if hints != nil {
+		for i := uint32(0); i < counts[2]; i++ {
+			var h TwolevelHint
+			if o := from[counts[0]+counts[1]+i]; o >= 0 && dt != nil && uint32(o) >= dt.Iundefsym && uint32(o)-dt.Iundefsym < uint32(len(hints.Hints)) {
+				h = hints.Hints[uint32(o)-dt.Iundefsym]
+			}
+			newHints = append(newHints, h)
+			var b [4]byte
+			f.ByteOrder.PutUint32(b[:], encodeTwolevelHint(f.ByteOrder, h))
+			hintDat = append(hintDat, b[:]...)
+		}
+	}
+
+	// Lay out the tables behind the symbol table, and fit __LINKEDIT to
+	// them.
+	off := uint64(st.Symoff) + uint64(len(symtab))
+	indirectOff := off
+	off += uint64(indirect.Len())
+	hintsOff := off
+	off += uint64(len(hintDat))
+	strOff := off
+	newEnd := off + uint64(len(strtab))
+	var sigOff uint64
+	if sig := f.SigBlock; sig != nil {
+		sigOff = alignUp(newEnd, 16)
+		newEnd = sigOff + uint64(sig.Len)
+	}
+	filesz, memsz := linkedit.Filesz, linkedit.Memsz
+	end := linkedit.Offset + linkedit.Filesz
+	if end >= oldEnd {
+		filesz = filesz - oldEnd + newEnd
+		if filesz > memsz {
+			page := uint64(0x1000)
+			if f.Cpu == CpuArm64 {
+				page = 0x4000
+			}
+			memsz = alignUp(filesz, page)
+		}
+	}
+	if err := f.checkSegmentGrowth(linkedit, memsz, filesz); err != nil {
+		return err
+	}
+
+	if dt != nil {
+		dt.IndirectSyms, dt.RawDysymtab = indirectSyms, indirect.Bytes()
+		dt.Nindirectsyms = uint32(len(indirectSyms))
+		dt.Indirectsymoff = 0
+		if len(dt.RawDysymtab) != 0 {
+			dt.Indirectsymoff = uint32(indirectOff)
+		}
+		dt.Ilocalsym, dt.Nlocalsym = 0, counts[0]
+		dt.Iextdefsym, dt.Nextdefsym = counts[0], counts[1]
+		dt.Iundefsym, dt.Nundefsym = counts[0]+counts[1], counts[2]
+		if err := f.updateLinkeditLoad(&dt.LoadBytes, &dt.DysymtabCmd); err != nil {
+			return err
+		}
+	}
+	if hints != nil {
+		hints.Hints, hints.RawDat = newHints, hintDat
+		hints.Nhints = uint32(len(newHints))
+		hints.Offset = 0
+		if len(hintDat) != 0 {
+			hints.Offset = uint32(hintsOff)
+		}
+		if err := f.updateLinkeditLoad(&hints.LoadBytes, &hints.TwolevelHintsCmd); err != nil {
+			return err
+		}
+	}
+	st.Syms, st.RawSymtab, st.RawStringtab = syms, symtab, strtab
+	st.Nsyms = uint32(len(syms))
+	st.Stroff = uint32(strOff)
+	st.Strsize = uint32(len(strtab))
+	if err := f.updateLinkeditLoad(&st.LoadBytes, &st.SymtabCmd); err != nil {
+		return err
+	}
+	if sig := f.SigBlock; sig != nil {
+		sig.Offset = sigOff
+		for i, l := range f.Loads {
+			raw, ok := l.(LoadBytes)
+			if !ok || len(raw) < 16 || LoadCmd(f.ByteOrder.Uint32(raw)) != LoadCmdSignature {
+				continue
+			}
+			raw = append(LoadBytes(nil), raw...)
+			f.ByteOrder.PutUint32(raw[8:], uint32(sig.Offset))
+			f.Loads[i] = raw
+		}
+	}
+
+	linkedit.Filesz, linkedit.Memsz = filesz, memsz
+	if f.FinalSegEnd == end || linkedit.Offset+filesz > f.FinalSegEnd {
+		f.FinalSegEnd = linkedit.Offset + filesz
+	}
+	return f.updateSegmentLoad(linkedit)
+}
@@ -0,0 +1,158 @@
+package macho
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// indirectNames returns the names of the symbols of the indirect symbol
+// table entries of the sections of f, with "" for local and absolute
+// entries.
+func indirectNames(t *testing.T, f *File) map[string][]string {
+	t.Helper()
+	names := make(map[string][]string)
+	for _, s := range f.Sections {
+		entries, err := f.IndirectSymbols(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			name := ""
+			if e.Sym != nil {
+				name = e.Sym.Name
+			}
+			names[s.Name] = append(names[s.Name], name)
+		}
+	}
+	return names
+}
+
+func TestIndirectSymbols(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want := map[string][]string{
+		"__stubs":         {"_printf"},
+		"__nl_symbol_ptr": {"dyld_stub_binder", ""},
+		"__la_symbol_ptr": {"_printf"},
+	}
+	if got := indirectNames(t, f); !reflect.DeepEqual(got, want) {
+		t.Errorf("indirect symbols are %q, want %q", got, want)
+	}
+	nl, err := f.IndirectSymbols(f.Section("__nl_symbol_ptr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nl[1].Abs() || nl[1].Local() || nl[1].Addr != nl[0].Addr+8 {
+		t.Errorf("second __nl_symbol_ptr entry is %+v", nl[1])
+	}
+	if e, err := f.IndirectSymbols(f.Section("__text")); e != nil || err != nil {
+		t.Errorf("IndirectSymbols(__text) = %v, %v", e, err)
+	}
+}
+
+func TestAddRemoveSymbol(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-darwin-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	indirect := indirectNames(t, f)
+	undef := f.Dysymtab.Nundefsym
+
+	// Give f two-level hints, one per undefined symbol, told apart by
+	// their table of contents index.
+	var hints []TwolevelHint
+	var dat []byte
+	for i := uint32(0); i < undef; i++ {
+		h := TwolevelHint{1, 100 + i}
+		hints = append(hints, h)
+		var b [4]byte
+		f.ByteOrder.PutUint32(b[:], encodeTwolevelHint(f.ByteOrder, h))
+		dat = append(dat, b[:]...)
+	}
+	cmd := TwolevelHintsCmd{LoadCmdTwolevelHints, 16, f.Symtab.Stroff, undef}
+	raw := make([]byte, 16)
+	for i, v := range []uint32{uint32(cmd.Cmd), cmd.Len, cmd.Offset, cmd.Nhints} {
+		f.ByteOrder.PutUint32(raw[4*i:], v)
+	}
+	if err := f.checkLoadCommandsSize(16); err != nil {
+		t.Fatal(err)
+	}
+	f.TwolevelHints = &TwolevelHints{LoadBytes(raw), cmd, hints, dat}
+	f.Loads = append(f.Loads, f.TwolevelHints)
+	f.Ncmd++
+	f.Cmdsz += 16
+
+	if _, err := f.AddSymbol(Symbol{Name: "_puts", Type: N_EXT | N_UNDF}); err == nil {
+		t.Error("AddSymbol added a second _puts")
+	}
+	i, err := f.AddSymbol(Symbol{Name: "_fputs", Type: N_EXT | N_UNDF, Desc: 1 << 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := f.Dysymtab; i != d.Iundefsym+1 || d.Nundefsym != undef+1 {
+		t.Errorf("_fputs is symbol %d, undefined symbols are [%d, +%d)", i, d.Iundefsym, d.Nundefsym)
+	}
+	if _, err := f.AddSymbol(Symbol{Name: "_local", Type: N_SECT, Sect: 1, Value: 0x1000}); err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range f.Validate() {
+		t.Errorf("Validate: %v", issue)
+	}
+
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := indirectNames(t, g); !reflect.DeepEqual(got, indirect) {
+		t.Errorf("indirect symbols are %q after AddSymbol, want %q", got, indirect)
+	}
+	d := g.Dysymtab
+	if imports, _ := g.ImportedSymbols(); !reflect.DeepEqual(imports, []string{"_exit", "_fputs", "_puts"}) {
+		t.Errorf("imported symbols are %q", imports)
+	}
+	if s := g.Symtab.Syms[d.Iundefsym+1]; s.Name != "_fputs" || s.Desc != 1<<8 {
+		t.Errorf("undefined symbol 1 is %+v", s)
+	}
+	if s := g.Symtab.Syms[d.Nlocalsym-1]; s.Name != "_local" || s.Value != 0x1000 {
+		t.Errorf("last local symbol is %+v", s)
+	}
+	want := []TwolevelHint{hints[0], {}, hints[1]}
+	if g.TwolevelHints == nil || !reflect.DeepEqual(g.TwolevelHints.Hints, want) {
+		t.Errorf("two-level hints are %+v, want %+v", g.TwolevelHints, want)
+	}
+
+	if err := g.RemoveSymbol("_exit"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.RemoveSymbol("_exit"); err == nil {
+		t.Error("RemoveSymbol removed _exit twice")
+	}
+	for _, issue := range g.Validate() {
+		t.Errorf("Validate: %v", issue)
+	}
+	names := indirectNames(t, g)
+	if stubs := names["__symbol_stub1"]; !reflect.DeepEqual(stubs, []string{"", "_puts"}) {
+		t.Errorf("stubs are for %q after removing _exit", stubs)
+	}
+	if want := []TwolevelHint{{}, hints[1]}; !reflect.DeepEqual(g.TwolevelHints.Hints, want) {
+		t.Errorf("two-level hints are %+v after removing _exit, want %+v", g.TwolevelHints.Hints, want)
+	}
+
+	o, err := Open("testdata/clang-amd64-darwin.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	if _, err := o.AddSymbol(Symbol{Name: "_x", Type: N_EXT | N_UNDF}); err == nil {
+		t.Error("AddSymbol accepted an object file")
+	}
+}
@@ -0,0 +1,180 @@
+package macho
+
+import "fmt"
+
+// Pointer authentication keys of arm64e signed pointers.
+const (
+	PtrAuthKeyIA uint8 = 0
+	PtrAuthKeyIB uint8 = 1
+	PtrAuthKeyDA uint8 = 2
+	PtrAuthKeyDB uint8 = 3
+)
+
+var ptrAuthKeyNames = [...]string{"IA", "IB", "DA", "DB"}
+
+// A ThreadedFixup is a pointer of an image whose binding info is
+// threaded, as arm64e images are. Such pointers are not listed in the
+// rebase and binding info: they form chains through the data segments
+// from starts the binding info gives, and each one describes its own
+// rebase or bind in the bits of the pointer.
+//
+// dyld signs authenticated pointers when it applies them, with Key, the
+// Diversity and, if AddrDiv is set, the address of the pointer, so they
+// must keep their offset and their bits across a rewrite.
+type ThreadedFixup struct {
+	Segment int    // index of the segment among the segment load commands
+	Offset  uint64 // offset of the pointer in the segment
+	Raw     uint64 // the pointer as stored in the file
+
+	Bind bool
+	Auth bool
+
+	// Target is the address a rebase points to. For an authenticated
+	// rebase, it is an offset from the start of the image.
+	Target uint64
+	High8  uint8 // top byte of the target of a plain rebase
+
+	// BindIndex is the index of the ordinal table entry a bind refers
+	// to; Symbol is the symbol of that entry.
+	BindIndex int
+	Symbol    string
+	Addend    int64 // addend of a plain bind
+
+	Key       uint8 // one of the PtrAuthKey values
+	AddrDiv   bool
+	Diversity uint16
+}
+
+func (fx ThreadedFixup) String() string {
+	kind := "rebase"
+	if fx.Bind {
+		kind = "bind of " + fx.Symbol
+	}
+	if !fx.Auth {
+		return kind
+	}
+	s := fmt.Sprintf("authenticated %s, key %s, diversity %#x", kind, ptrAuthKeyNames[fx.Key&3], fx.Diversity)
+	if fx.AddrDiv {
+		s += ", address diversified"
+	}
+	return s
+}
+
+// decodeThreadedPointer decodes the fixup that the pointer v of a
+// threaded chain describes.
+func decodeThreadedPointer(v uint64) ThreadedFixup {
+	fx := ThreadedFixup{Raw: v, Auth: v>>63 != 0, Bind: v>>62&1 != 0}
+	switch {
+	case fx.Auth:
+		fx.Diversity = uint16(v >> 32)
+		fx.AddrDiv = v>>48&1 != 0
+		fx.Key = uint8(v >> 49 & 3)
+		if fx.Bind {
+			fx.BindIndex = int(v & 0xffff)
+		} else {
+			fx.Target = v & (1<<32 - 1)
+		}
+	case fx.Bind:
+		fx.BindIndex = int(v & 0xffff)
+		fx.Addend = int64(v<<13) >> 45
+	default:
+		fx.Target = uint64(int64(v<<21) >> 21)
+		fx.High8 = uint8(v >> 43)
+	}
+	return fx
+}
+
+// hasThreadedBinds reports whether the binding info of f is threaded.
+func (f *File) hasThreadedBinds() bool {
+	if f.DylinkInfo == nil {
+		return false
+	}
+	_, _, threaded, _ := decodeBindInfo(f.DylinkInfo.BindingInfoDat, f.ptrSize(), f.segmentSizes(), false)
+	return threaded
+}
+
+// ThreadedFixups decodes the pointer chains of threaded binding info,
+// in the order of their starts, or returns nil if the binding info of f
+// is not threaded.
+func (f *File) ThreadedFixups() ([]ThreadedFixup, error) {
+	if f.DylinkInfo == nil {
+		return nil, nil
+	}
+	table, starts, threaded, err := decodeBindInfo(f.DylinkInfo.BindingInfoDat, f.ptrSize(), f.segmentSizes(), false)
+	if err != nil || !threaded {
+		return nil, err
+	}
+	if f.ptrSize() != 8 {
+		return nil, fmt.Errorf("threaded binding info in a %d-bit image", 8*f.ptrSize())
+	}
+	var fixups []ThreadedFixup
+	for _, st := range starts {
+		off := st.Offset
+		for {
+			addr, err := f.segmentAddr(st.Segment, off)
+			if err != nil {
+				return nil, fmt.Errorf("threaded fixup chain: %v", err)
+			}
+			var b [8]byte
+			if err := f.readAtAddr(b[:], addr); err != nil {
+				return nil, fmt.Errorf("threaded fixup chain: %v", err)
+			}
+			v := f.ByteOrder.Uint64(b[:])
+			fx := decodeThreadedPointer(v)
+			fx.Segment, fx.Offset = st.Segment, off
+			if fx.Bind {
+				if fx.BindIndex >= len(table) {
+					return nil, fmt.Errorf("threaded bind at %#x refers to entry %d of an ordinal table of %d", addr, fx.BindIndex, len(table))
+				}
+				fx.Symbol = table[fx.BindIndex].Symbol
+			}
+			fixups = append(fixups, fx)
+			next := v >> 51 & 0x7ff
+			if next == 0 {
+				break
+			}
+			off += 8 * next
+		}
+	}
+	return fixups, nil
+}
+
+// checkThreadedFixups reports an error if the threaded fixups of f no
+// longer decode to the ones it was read with, because an edit moved or
+// overwrote pointers of a chain or replaced the binding info. dyld would
+// otherwise sign and slide the wrong bits. The fixups as read are only
+// decoded, from the file f was read from, if its binding info was
+// threaded.
+func (f *File) checkThreadedFixups() error {
+	if len(f.bindInfo) == 0 || f.raw == nil {
+		return nil
+	}
+	if _, _, threaded, _ := decodeBindInfo(f.bindInfo, f.ptrSize(), f.segmentSizes(), false); !threaded {
+		return nil
+	}
+	orig, err := newFileInternal(f.raw, false, f.tolerant, false)
+	if err != nil {
+		return nil
+	}
+	// Chains that do not decode are left for Validate to report.
+	read, _ := orig.ThreadedFixups()
+	if len(read) == 0 {
+		return nil
+	}
+	fixups, err := f.ThreadedFixups()
+	if err != nil {
+		return fmt.Errorf("edits invalidate the threaded fixups: %v", err)
+	}
+	for i, fx := range read {
+		if i < len(fixups) && fixups[i] == fx {
+			continue
+		}
+		addr, _ := f.segmentAddr(fx.Segment, fx.Offset)
+		return fmt.Errorf("edits invalidate the threaded fixup at %#x (%v)", addr, fx)
+	}
+	if len(fixups) > len(read) {
+		addr, _ := f.segmentAddr(fixups[len(read)].Segment, fixups[len(read)].Offset)
+		return fmt.Errorf("edits add a threaded fixup at %#x", addr)
+	}
+	return nil
+}
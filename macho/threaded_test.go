@@ -0,0 +1,127 @@
+package macho
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// putPointer stores v at virtual address addr of f.
+func putPointer(t *testing.T, f *File, addr, v uint64) {
+	s := f.sectionForAddr(addr)
+	if s == nil {
+		t.Fatalf("no section at %#x", addr)
+	}
+	data, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.ByteOrder.PutUint64(data[addr-s.Addr:], v)
+	s.Replace(bytes.NewReader(data), int64(len(data)))
+}
+
+func TestThreadedFixups(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Turn the two pointers at 0x100001000 and 0x100001010 into a chain
+	// of an authenticated bind of _f and an authenticated rebase to the
+	// start of __text.
+	var seg int
+	for i, s := range f.segments() {
+		if s.Name == "__DATA" {
+			seg = i
+		}
+	}
+	text := f.Segment("__TEXT")
+	target := f.Section("__text").Addr - text.Addr
+	dat := []byte{
+		bindOpcodeThreaded | bindSubopcodeThreadedSetBindOrdinalTableSizeULEB, 1,
+		bindOpcodeSetDylibOrdinalImm | 1,
+		bindOpcodeSetSymbolTrailingFlagsImm, '_', 'f', 0,
+		bindOpcodeDoBind,
+		bindOpcodeSetSegmentAndOffsetULEB | byte(seg), byte(0x100001000 - f.segments()[seg].Addr),
+		bindOpcodeThreaded | bindSubopcodeThreadedApply,
+		bindOpcodeDone,
+	}
+	if dat, err = storeDyldInfo(dat, f.DylinkInfo.BindingInfoLen, "binding"); err != nil {
+		t.Fatal(err)
+	}
+	f.DylinkInfo.BindingInfoDat = dat
+	authBind := uint64(1)<<63 | 1<<62 | 2<<51 | uint64(PtrAuthKeyDA)<<49 | 1<<48 | 0x1234<<32
+	authRebase := uint64(1)<<63 | uint64(PtrAuthKeyIA)<<49 | 0xbeef<<32 | target
+	putPointer(t, f, 0x100001000, authBind)
+	putPointer(t, f, 0x100001010, authRebase)
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixups, err := g.ThreadedFixups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	off := 0x100001000 - g.segments()[seg].Addr
+	want := []ThreadedFixup{
+		{Segment: seg, Offset: off, Raw: authBind, Bind: true, Auth: true, Symbol: "_f", Key: PtrAuthKeyDA, AddrDiv: true, Diversity: 0x1234},
+		{Segment: seg, Offset: off + 0x10, Raw: authRebase, Auth: true, Target: target, Key: PtrAuthKeyIA, Diversity: 0xbeef},
+	}
+	if len(fixups) != len(want) || fixups[0] != want[0] || fixups[1] != want[1] {
+		t.Fatalf("ThreadedFixups() = %+v, want %+v", fixups, want)
+	}
+	if p, err := g.pointerAt(0x100001010); err != nil || p != text.Addr+target {
+		t.Errorf("pointer at 0x100001010 is %#x, %v, want %#x", p, err, text.Addr+target)
+	}
+	for _, issue := range g.Validate() {
+		if issue.Severity == SeverityError {
+			t.Errorf("Validate: %v", issue)
+		}
+	}
+	if _, err := g.Binds(); err == nil {
+		t.Error("Binds accepted threaded binding info")
+	}
+	// DylibHash takes the eager binds from the threaded fixups.
+	libs, err := g.ImportedLibraries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	syms := []string{"_f"}
+	lazy, err := g.LazyBinds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range lazy {
+		syms = append(syms, b.Symbol)
+	}
+	sort.Strings(syms)
+	if h, err := g.DylibHash(); err != nil || h != md5Hex(strings.Join(append(libs, syms...), ",")) {
+		t.Errorf("DylibHash = %q, %v, want the hash of %v", h, err, append(libs, syms...))
+	}
+	if err := g.SetBinds(nil); err == nil {
+		t.Error("SetBinds replaced threaded binding info")
+	}
+	if err := g.SetRebases(nil); err == nil {
+		t.Error("SetRebases accepted an image with threaded binding info")
+	}
+
+	// Changing the diversity of the signed rebase is refused.
+	putPointer(t, g, 0x100001010, authRebase&^(0xffff<<32))
+	if _, err := g.Bytes(); err == nil || !strings.Contains(err.Error(), "0x100001010") {
+		t.Errorf("Bytes() after overwriting a signed pointer: %v", err)
+	}
+	if !hasIssue(g.Validate(), SeverityError, "threaded fixup at 0x100001010") {
+		t.Error("Validate did not report the overwritten signed pointer")
+	}
+	putPointer(t, g, 0x100001010, authRebase)
+	if _, err := g.Bytes(); err != nil {
+		t.Errorf("Bytes() after restoring the pointer: %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package macho
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// OpenTolerant opens the named file as NewFileTolerant does.
+func OpenTolerant(name string) (*File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	ff, err := NewFileTolerant(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ff.closer = f
+	return ff, nil
+}
+
+// NewFileTolerant creates a File for the Mach-O binary in r as NewFile
+// does, but reads as much of a malformed file as it can instead of
+// failing. Load commands are read as far as ncmds, sizeofcmds and the end
+// of the file allow, a command that overruns sizeofcmds is read from the
+// file, and a command that does not decode is kept as LoadBytes. Sections
+// and segments whose contents run past the end of the file read as what
+// is there, and relocations, symbol names and linkedit data that cannot
+// be read are dropped. Sizes larger than the file are refused before
+// anything is allocated for them.
+//
+// Each problem is recorded in the Anomalies of the File; only a file
+// without a Mach-O header is an error.
+func NewFileTolerant(r io.ReaderAt) (*File, error) {
+	return newFileInternal(r, false, true, false)
+}
+
+// tolerate records err in the Anomalies of f and returns nil if f is read
+// by NewFileTolerant, and returns err otherwise.
+func (f *File) tolerate(err error) error {
+	if err == nil || !f.tolerant {
+		return err
+	}
+	f.Anomalies = append(f.Anomalies, Issue{SeverityError, err.Error()})
+	return nil
+}
+
+// anomaly records a problem in the Anomalies of f, if f is read by
+// NewFileTolerant.
+func (f *File) anomaly(sev Severity, format string, args ...interface{}) {
+	if f.tolerant {
+		f.Anomalies = append(f.Anomalies, Issue{sev, fmt.Sprintf(format, args...)})
+	}
+}
+
+// fitsFile reports whether size bytes can be in the file, which is
+// assumed when its size is not known.
+func (f *File) fitsFile(size int64) bool {
+	n, err := f.rawLen()
+	return err != nil || (size >= 0 && size <= n)
+}
+
+// readBlock reads the size bytes at off that a load command refers to. A
+// block that does not fit in the file is an error before anything is
+// allocated for it.
+func (f *File) readBlock(r io.ReaderAt, size uint64, off int64) ([]byte, error) {
+	if size > 1<<62 || !f.fitsFile(off+int64(size)) {
+		return nil, &FormatError{off, "block larger than the file", size}
+	}
+	b := make([]byte, size)
+	if _, err := r.ReadAt(b, off); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// loadCommandBytes reads the sizeofcmds bytes of load commands at off,
+// which must be in the file. For a file read by NewFileTolerant, it
+// returns those that are in the file.
+func (f *File) loadCommandBytes(r io.ReaderAt, off int64) ([]byte, error) {
+	if !f.tolerant {
+		if !f.fitsFile(off + int64(f.Cmdsz)) {
+			return nil, &FormatError{off, "sizeofcmds larger than the file", f.Cmdsz}
+		}
+		dat := make([]byte, f.Cmdsz)
+		if _, err := r.ReadAt(dat, off); err != nil {
+			return nil, err
+		}
+		return dat, nil
+	}
+	size := int64(f.Cmdsz)
+	if n, err := f.rawLen(); err == nil && off+size > n {
+		size = n - off
+		if size < 0 {
+			size = 0
+		}
+	}
+	dat := make([]byte, size)
+	n, _ := r.ReadAt(dat, off)
+	if n < int(f.Cmdsz) {
+		f.anomaly(SeverityError, "sizeofcmds is %d, but the file holds %d bytes of load commands", f.Cmdsz, n)
+	}
+	return dat[:n], nil
+}
+
+// loadCount returns the number of load commands to read from n bytes of
+// them, which can hold no more than one per 8 bytes. More is an error,
+// except for a file read by NewFileTolerant, which reads as many as the
+// bytes hold.
+func (f *File) loadCount(n int) (int, error) {
+	if int64(f.Ncmd) > int64(n/8) {
+		if !f.tolerant {
+			return 0, &FormatError{0, "ncmds too large for sizeofcmds", f.Ncmd}
+		}
+		f.anomaly(SeverityError, "ncmds is %d, but %d bytes hold at most %d load commands", f.Ncmd, n, n/8)
+		return n / 8, nil
+	}
+	return int(f.Ncmd), nil
+}
+
+// overrunLoad returns the siz bytes of load command i at off, which
+// overrun sizeofcmds, for a file read by NewFileTolerant. dyld refuses
+// such a command, but what it holds is still worth reading. It returns
+// nil if the command is not read.
+func (f *File) overrunLoad(r io.ReaderAt, i int, siz uint32, off int64) []byte {
+	if !f.tolerant || siz < 8 || !f.fitsFile(off+int64(siz)) {
+		return nil
+	}
+	b := make([]byte, siz)
+	if _, err := r.ReadAt(b, off); err != nil {
+		return nil
+	}
+	f.anomaly(SeverityError, "load command %d of %d bytes at %#x overruns sizeofcmds", i, siz, off)
+	return b
+}
+
+// checkLoads records the problems of the file ranges that the load
+// commands of f describe, and limits the readers of segments and
+// sections to the part of them that is in the file. rest is what is left
+// of sizeofcmds after the last load command.
+func (f *File) checkLoads(rest []byte) {
+	if len(rest) > 0 {
+		f.anomaly(SeverityWarning, "sizeofcmds has %d bytes after the last of the ncmds load commands", len(rest))
+	}
+	headerEnd := uint64(fileHeaderSize32) + uint64(f.Cmdsz)
+	if f.Magic == Magic64 {
+		headerEnd = uint64(fileHeaderSize64) + uint64(f.Cmdsz)
+	}
+	size, err := f.rawLen()
+	if err != nil {
+		size = 1<<63 - 1
+	}
+	// clamp returns a reader of what is in the file of the size bytes at off.
+	clamp := func(what string, off, n uint64) *io.SectionReader {
+		if n <= uint64(size) && off <= uint64(size)-n {
+			return nil
+		}
+		f.anomaly(SeverityError, "%s at %#x of %#x bytes runs past the end of the file at %#x", what, off, n, size)
+		avail := int64(0)
+		if off < uint64(size) {
+			avail = size - int64(off)
+		}
+		return io.NewSectionReader(f.raw, int64(off), avail)
+	}
+
+	for _, s := range f.segments() {
+		if s.Filesz == 0 {
+			continue
+		}
+		if sr := clamp("segment "+s.Name, s.Offset, s.Filesz); sr != nil {
+			s.sr, s.ReaderAt = sr, sr
+		}
+	}
+	for _, sh := range f.Sections {
+		if sh.Size == 0 || isZerofill(sh.Flags) {
+			continue
+		}
+		name := sh.Seg + "," + sh.Name
+		off := uint64(sh.Offset)
+		if off < headerEnd {
+			f.anomaly(SeverityError, "load commands overrun section %s at %#x", name, off)
+		}
+		if seg := f.Segment(sh.Seg); seg != nil && seg.Filesz != 0 && (off < seg.Offset || sh.Size > seg.Filesz || off-seg.Offset > seg.Filesz-sh.Size) {
+			f.anomaly(SeverityWarning, "section %s at %#x lies outside segment %s", name, off, seg.Name)
+		}
+		if sr := clamp("section "+name, off, sh.Size); sr != nil {
+			sh.sr, sh.ReaderAt = sr, sr
+		}
+	}
+}
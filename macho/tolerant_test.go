@@ -0,0 +1,111 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func hasAnomaly(f *File, substr string) bool {
+	for _, a := range f.Anomalies {
+		if strings.Contains(a.Msg, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNewFileTolerant(t *testing.T) {
+	const file = "testdata/gcc-amd64-darwin-exec"
+	want, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer want.Close()
+	orig, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	le := binary.LittleEndian
+	mangle := func(edit func(b []byte)) *File {
+		t.Helper()
+		b := append([]byte(nil), orig...)
+		edit(b)
+		f, err := NewFileTolerant(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	// loadCommand returns the bytes of the first load command of type cmd.
+	loadCommand := func(b []byte, cmd LoadCmd) []byte {
+		off := fileHeaderSize64
+		for i := 0; i < int(want.Ncmd); i++ {
+			if LoadCmd(le.Uint32(b[off:])) == cmd {
+				return b[off:]
+			}
+			off += int(le.Uint32(b[off+4:]))
+		}
+		t.Fatalf("no load command %v", cmd)
+		return nil
+	}
+
+	if f := mangle(func([]byte) {}); len(f.Anomalies) != 0 {
+		t.Errorf("anomalies in a well-formed file: %v", f.Anomalies)
+	}
+
+	// An ncmds beyond what sizeofcmds holds keeps the load commands there are.
+	f := mangle(func(b []byte) { le.PutUint32(b[16:], 0xffffffff) })
+	if len(f.Loads) != len(want.Loads) || f.Symtab == nil || !hasAnomaly(f, "ncmds is 4294967295") {
+		t.Errorf("read %d load commands, anomalies %v", len(f.Loads), f.Anomalies)
+	}
+
+	// A huge sizeofcmds is cut at the end of the file.
+	f = mangle(func(b []byte) { le.PutUint32(b[20:], 0xfffffff0) })
+	if len(f.Loads) != len(want.Loads) || !hasAnomaly(f, "sizeofcmds is 4294967280") || !hasAnomaly(f, "load commands overrun section __TEXT,__text") {
+		t.Errorf("read %d load commands, anomalies %v", len(f.Loads), f.Anomalies)
+	}
+
+	// A load command that overruns sizeofcmds is still read.
+	b := append([]byte(nil), orig...)
+	le.PutUint32(b[20:], want.Cmdsz-8)
+	if _, err := NewFile(bytes.NewReader(b)); err == nil {
+		t.Error("NewFile accepted a load command overrunning sizeofcmds")
+	}
+	f = mangle(func(b []byte) { le.PutUint32(b[20:], want.Cmdsz-8) })
+	if len(f.Loads) != len(want.Loads) || !hasAnomaly(f, "overruns sizeofcmds") {
+		t.Errorf("read %d load commands, anomalies %v", len(f.Loads), f.Anomalies)
+	}
+
+	// A string table larger than the file is dropped with its command.
+	f = mangle(func(b []byte) { le.PutUint32(loadCommand(b, LoadCmdSymtab)[20:], 0xffffffff) })
+	if f.Symtab != nil || len(f.Loads) != len(want.Loads) || !hasAnomaly(f, "block larger than the file") {
+		t.Errorf("Symtab is %v, anomalies %v", f.Symtab, f.Anomalies)
+	}
+	for i, l := range want.Loads {
+		if _, ok := f.Loads[i].(LoadBytes); l == want.Symtab && !ok {
+			t.Errorf("LC_SYMTAB read as %T", f.Loads[i])
+		}
+	}
+
+	// A section past the end of the file reads as what is there.
+	f = mangle(func(b []byte) {
+		text := bytes.Index(b, []byte("__text\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00__TEXT"))
+		le.PutUint32(b[text+48:], uint32(len(b)-8))
+	})
+	data, err := f.Section("__text").Data()
+	if err != nil || len(data) != 8 {
+		t.Errorf("read %d bytes of __text: %v", len(data), err)
+	}
+	for _, substr := range []string{"section __TEXT,__text at", "runs past the end of the file", "lies outside segment __TEXT"} {
+		if !hasAnomaly(f, substr) {
+			t.Errorf("no anomaly %q in %v", substr, f.Anomalies)
+		}
+	}
+
+	if _, err := NewFileTolerant(bytes.NewReader([]byte("not a Mach-O file"))); err == nil {
+		t.Error("NewFileTolerant accepted a file without a Mach-O header")
+	}
+}
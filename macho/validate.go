@@ -0,0 +1,297 @@
+package macho
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Severity describes how serious a problem reported by Validate is.
+type Severity int
+
+const (
+	// SeverityInfo marks an unusual but harmless construct.
+	SeverityInfo Severity = iota
+	// SeverityWarning marks a construct that dyld accepts but that
+	// codesign or other tools may refuse.
+	SeverityWarning
+	// SeverityError marks a construct that dyld rejects or that makes
+	// the file unparseable.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// An Issue is a single structural problem found in a File.
+type Issue struct {
+	Severity Severity
+	Msg      string
+}
+
+func (i Issue) String() string {
+	return i.Severity.String() + ": " + i.Msg
+}
+
+// Section types, stored in the low byte of SectionHeader.Flags, that
+// occupy no space in the file.
+const (
+	sectionTypeMask         = 0xff
+	sectionZerofill         = 0x1
+	sectionGBZerofill       = 0xc
+	sectionThreadLocalZfill = 0x12
+)
+
+func isZerofill(flags uint32) bool {
+	switch flags & sectionTypeMask {
+	case sectionZerofill, sectionGBZerofill, sectionThreadLocalZfill:
+		return true
+	}
+	return false
+}
+
+// Indirect symbol table entries that do not refer to a symbol.
+const (
+	indirectSymbolLocal = 0x80000000
+	indirectSymbolAbs   = 0x40000000
+)
+
+// linkeditBlob is a range of the file referenced from a load command.
+type linkeditBlob struct {
+	name string
+	off  uint64
+	size uint64
+}
+
+// linkeditBlobs returns the __LINKEDIT blobs that f references, listed
+// in the order ld64 lays them out.
+func (f *File) linkeditBlobs() []linkeditBlob {
+	var blobs []linkeditBlob
+	add := func(name string, off, size uint64) {
+		if size != 0 {
+			blobs = append(blobs, linkeditBlob{name, off, size})
+		}
+	}
+	if d := f.DylinkInfo; d != nil {
+		add("rebase info", d.RebaseOffset, uint64(d.RebaseLen))
+		add("binding info", d.BindingInfoOffset, uint64(d.BindingInfoLen))
+		add("weak binding info", d.WeakBindingOffset, uint64(d.WeakBindingLen))
+		add("lazy binding info", d.LazyBindingOffset, uint64(d.LazyBindingLen))
+		add("export info", d.ExportInfoOffset, uint64(d.ExportInfoLen))
+	}
+	if f.FuncStarts != nil {
+		add("function starts", f.FuncStarts.Offset, uint64(f.FuncStarts.Len))
+	}
+	if f.DataInCode != nil {
+		add("data in code", f.DataInCode.Offset, uint64(f.DataInCode.Len))
+	}
+	if f.LinkerOptHint != nil {
+		add("linker optimization hints", f.LinkerOptHint.Offset, uint64(f.LinkerOptHint.Len))
+	}
+	if f.Symtab != nil {
+		add("symbol table", uint64(f.Symtab.Symoff), uint64(len(f.Symtab.RawSymtab)))
+	}
+	if f.Dysymtab != nil {
+		add("indirect symbol table", uint64(f.Dysymtab.Indirectsymoff), uint64(len(f.Dysymtab.RawDysymtab)))
+	}
+	if f.TwolevelHints != nil {
+		add("two-level hints", uint64(f.TwolevelHints.Offset), uint64(len(f.TwolevelHints.RawDat)))
+	}
+	if f.Symtab != nil {
+		add("string table", uint64(f.Symtab.Stroff), uint64(len(f.Symtab.RawStringtab)))
+	}
+	if f.SigBlock != nil {
+		add("code signature", f.SigBlock.Offset, uint64(f.SigBlock.Len))
+	}
+	return blobs
+}
+
+// Validate checks the load commands and __LINKEDIT contents of f for
+// structural problems: a Cmdsz that disagrees with the load commands,
+// load commands running into section data, sections outside of their
+// segment, overlapping or out of order __LINKEDIT blobs, threaded fixup
+// chains that do not decode or that edits changed, and symbol table
+// indices that are out of range.
+//
+// Like the writer, Validate works from the parsed structures, so it
+// can be run on a File that has been modified before calling Bytes.
+func (f *File) Validate() []Issue {
+	var issues []Issue
+	report := func(sev Severity, format string, args ...interface{}) {
+		issues = append(issues, Issue{sev, fmt.Sprintf(format, args...)})
+	}
+
+	headerSize := uint64(fileHeaderSize32)
+	if f.Magic == Magic64 {
+		headerSize = fileHeaderSize64
+	}
+
+	// Load commands.
+	if int(f.Ncmd) != len(f.Loads) {
+		report(SeverityError, "Ncmd is %d, but there are %d load commands", f.Ncmd, len(f.Loads))
+	}
+	var cmdsz uint64
+	for i, l := range f.Loads {
+		if l == nil {
+			report(SeverityError, "load command %d has no contents", i)
+			continue
+		}
+		raw := l.Raw()
+		cmdsz += uint64(len(raw))
+		if len(raw) < 8 {
+			report(SeverityError, "load command %d is only %d bytes", i, len(raw))
+			continue
+		}
+		if n := f.ByteOrder.Uint32(raw[4:8]); int(n) != len(raw) {
+			report(SeverityError, "load command %d has size %d, but is %d bytes long", i, n, len(raw))
+		}
+		if f.Magic == Magic64 && len(raw)%8 != 0 || len(raw)%4 != 0 {
+			report(SeverityWarning, "load command %d size %d is not pointer aligned", i, len(raw))
+		}
+	}
+	if cmdsz != uint64(f.Cmdsz) {
+		report(SeverityError, "Cmdsz is %d, but the load commands take %d bytes", f.Cmdsz, cmdsz)
+	}
+	cmdEnd := headerSize + uint64(f.Cmdsz)
+
+	// Segments and the sections inside them. Sections are stored in
+	// f.Sections in the order their segments appear in f.Loads.
+	var segs []*Segment
+	var linkedit *Segment
+	next := 0
+	for _, l := range f.Loads {
+		s, ok := l.(*Segment)
+		if !ok {
+			continue
+		}
+		segs = append(segs, s)
+		if s.Name == "__LINKEDIT" {
+			linkedit = s
+		}
+		// A segment with no memory size, such as the __DWARF segment
+		// written by the Go linker, is never mapped and only its file
+		// range matters.
+		mapped := s.Memsz != 0
+		if mapped && s.Filesz > s.Memsz {
+			report(SeverityError, "segment %q file size %#x exceeds its memory size %#x", s.Name, s.Filesz, s.Memsz)
+		}
+		if next+int(s.Nsect) > len(f.Sections) {
+			report(SeverityError, "segment %q has %d sections, but only %d remain", s.Name, s.Nsect, len(f.Sections)-next)
+			next = len(f.Sections)
+			continue
+		}
+		for _, sect := range f.Sections[next : next+int(s.Nsect)] {
+			if mapped && (sect.Addr < s.Addr || sect.Addr+sect.Size > s.Addr+s.Memsz) {
+				report(SeverityError, "section %s,%s [%#x, %#x) lies outside of its segment [%#x, %#x)",
+					sect.Seg, sect.Name, sect.Addr, sect.Addr+sect.Size, s.Addr, s.Addr+s.Memsz)
+			}
+			if isZerofill(sect.Flags) || sect.Offset == 0 {
+				continue
+			}
+			off := uint64(sect.Offset)
+			if off < s.Offset || off+sect.Size > s.Offset+s.Filesz {
+				report(SeverityError, "section %s,%s file range [%#x, %#x) lies outside of its segment [%#x, %#x)",
+					sect.Seg, sect.Name, off, off+sect.Size, s.Offset, s.Offset+s.Filesz)
+			}
+			if off < cmdEnd {
+				report(SeverityError, "section %s,%s at %#x overlaps the load commands ending at %#x", sect.Seg, sect.Name, off, cmdEnd)
+			}
+		}
+		next += int(s.Nsect)
+	}
+	if next != len(f.Sections) {
+		report(SeverityError, "%d sections do not belong to any segment", len(f.Sections)-next)
+	}
+	for i, s := range segs {
+		if s.Filesz == 0 {
+			continue
+		}
+		for _, t := range segs[i+1:] {
+			if t.Filesz == 0 {
+				continue
+			}
+			if s.Offset < t.Offset+t.Filesz && t.Offset < s.Offset+s.Filesz {
+				report(SeverityError, "file ranges of segments %q and %q overlap", s.Name, t.Name)
+			}
+		}
+	}
+
+	// __LINKEDIT blobs.
+	blobs := f.linkeditBlobs()
+	for i, b := range blobs {
+		if b.off < cmdEnd {
+			report(SeverityError, "%s at %#x overlaps the load commands ending at %#x", b.name, b.off, cmdEnd)
+		}
+		if linkedit != nil && (b.off < linkedit.Offset || b.off+b.size > linkedit.Offset+linkedit.Filesz) {
+			report(SeverityError, "%s [%#x, %#x) lies outside of __LINKEDIT [%#x, %#x)",
+				b.name, b.off, b.off+b.size, linkedit.Offset, linkedit.Offset+linkedit.Filesz)
+		}
+		if i > 0 && b.off < blobs[i-1].off {
+			report(SeverityWarning, "%s at %#x precedes %s at %#x", b.name, b.off, blobs[i-1].name, blobs[i-1].off)
+		}
+	}
+	sorted := append([]linkeditBlob(nil), blobs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].off < sorted[j].off })
+	for i := 1; i < len(sorted); i++ {
+		prev, b := sorted[i-1], sorted[i]
+		if b.off < prev.off+prev.size {
+			report(SeverityError, "%s [%#x, %#x) overlaps %s [%#x, %#x)",
+				b.name, b.off, b.off+b.size, prev.name, prev.off, prev.off+prev.size)
+		}
+	}
+	if f.SigBlock != nil && linkedit != nil && f.SigBlock.Offset+uint64(f.SigBlock.Len) != linkedit.Offset+linkedit.Filesz {
+		report(SeverityWarning, "code signature does not end __LINKEDIT")
+	}
+
+	// Threaded fixup chains, which edits must leave as they were read.
+	if _, err := f.ThreadedFixups(); err != nil {
+		report(SeverityError, "%v", err)
+	} else if err := f.checkThreadedFixups(); err != nil {
+		report(SeverityError, "%v", err)
+	}
+
+	// Symbol table indices.
+	if f.Dysymtab != nil {
+		nsyms := uint64(0)
+		if f.Symtab != nil {
+			nsyms = uint64(len(f.Symtab.Syms))
+		}
+		d := f.Dysymtab
+		for _, r := range []struct {
+			name     string
+			first, n uint32
+		}{
+			{"local", d.Ilocalsym, d.Nlocalsym},
+			{"external", d.Iextdefsym, d.Nextdefsym},
+			{"undefined", d.Iundefsym, d.Nundefsym},
+		} {
+			if uint64(r.first)+uint64(r.n) > nsyms {
+				report(SeverityError, "%s symbols [%d, %d) exceed the %d symbols in the symbol table", r.name, r.first, uint64(r.first)+uint64(r.n), nsyms)
+			}
+		}
+		if int(d.Nindirectsyms) != len(d.IndirectSyms) {
+			report(SeverityError, "Nindirectsyms is %d, but there are %d indirect symbols", d.Nindirectsyms, len(d.IndirectSyms))
+		}
+		if h := f.TwolevelHints; h != nil && len(h.Hints) != int(d.Nundefsym) {
+			report(SeverityError, "there are %d two-level hints for %d undefined symbols", len(h.Hints), d.Nundefsym)
+		}
+		for i, x := range d.IndirectSyms {
+			if x&(indirectSymbolLocal|indirectSymbolAbs) != 0 {
+				continue
+			}
+			if uint64(x) >= nsyms {
+				report(SeverityError, "indirect symbol %d refers to symbol %d of %d", i, x, nsyms)
+			}
+		}
+	}
+
+	return issues
+}
@@ -0,0 +1,108 @@
+package macho
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for _, name := range []string{
+		"testdata/clang-386-darwin-exec-with-rpath",
+		"testdata/clang-amd64-darwin-exec-with-rpath",
+		"testdata/gcc-386-darwin-exec",
+		"testdata/gcc-amd64-darwin-exec",
+		"testdata/gcc-amd64-darwin-exec-debug",
+		"testdata/clang-386-darwin.obj",
+		"testdata/clang-amd64-darwin.obj",
+	} {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, issue := range f.Validate() {
+			if issue.Severity >= SeverityWarning {
+				t.Errorf("%s: unexpected issue: %v", name, issue)
+			}
+		}
+		f.Close()
+	}
+}
+
+func hasIssue(issues []Issue, sev Severity, substr string) bool {
+	for _, issue := range issues {
+		if issue.Severity == sev && strings.Contains(issue.Msg, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidateCmdsz(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Cmdsz += 8
+	if issues := f.Validate(); !hasIssue(issues, SeverityError, "Cmdsz") {
+		t.Errorf("Cmdsz mismatch not reported, got %v", issues)
+	}
+}
+
+func TestValidateLinkedit(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	seg := f.Segment("__LINKEDIT")
+	if seg == nil {
+		t.Fatal("no __LINKEDIT segment")
+	}
+	f.Symtab.Stroff = uint32(seg.Offset + seg.Filesz)
+	issues := f.Validate()
+	if !hasIssue(issues, SeverityError, "string table") {
+		t.Errorf("string table outside of __LINKEDIT not reported, got %v", issues)
+	}
+
+	f.Symtab.Stroff = f.Symtab.Symoff
+	issues = f.Validate()
+	if !hasIssue(issues, SeverityError, "overlaps symbol table") {
+		t.Errorf("overlapping string table not reported, got %v", issues)
+	}
+}
+
+func TestValidateIndirectSyms(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if f.Dysymtab == nil || len(f.Dysymtab.IndirectSyms) == 0 {
+		t.Skip("no indirect symbols")
+	}
+	f.Dysymtab.IndirectSyms[0] = uint32(len(f.Symtab.Syms))
+	if issues := f.Validate(); !hasIssue(issues, SeverityError, "indirect symbol 0") {
+		t.Errorf("out of range indirect symbol not reported, got %v", issues)
+	}
+}
+
+func TestValidateUnmappedSegment(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-darwin-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Like the __DWARF segment of Go binaries: file contents, no memory.
+	seg := f.Segment("__TEXT")
+	seg.Memsz = 0
+	for _, issue := range f.Validate() {
+		if issue.Severity >= SeverityWarning {
+			t.Errorf("unexpected issue: %v", issue)
+		}
+	}
+}
@@ -4,14 +4,26 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"sort"
 )
 
-// Bytes - Returns the bytes of an assembled *macho.File
+// Bytes - Returns the bytes of an assembled *macho.File. With PreserveRaw
+// set, the edits are applied over the bytes the file was read from. An
+// unedited file is written as it was read, either way.
 func (machoFile *File) Bytes() ([]byte, error) {
+	if err := machoFile.DecodeLoads(); err != nil {
+		return nil, err
+	}
+	if err := machoFile.checkThreadedFixups(); err != nil {
+		return nil, err
+	}
+	if machoFile.PreserveRaw {
+		return machoFile.preservedBytes()
+	}
 	var bytesWritten uint64
 	w := bytes.NewBuffer(nil)
 
@@ -26,9 +38,11 @@ func (machoFile *File) Bytes() ([]byte, error) {
 	bytesWritten += uint64(headerLength)
 	//log.Printf("%x: Wrote file header of size: %v", bytesWritten, bytesWritten)
 
-	// Reserved 4 bytes at end of header
-	w.Write([]byte{0, 0, 0, 0})
-	bytesWritten += 4
+	// Reserved 4 bytes at end of the 64-bit header
+	if machoFile.Magic == Magic64 {
+		w.Write([]byte{0, 0, 0, 0})
+		bytesWritten += 4
+	}
 
 	// Write Load Commands Loop
 	for _, singleLoad := range machoFile.Loads {
@@ -49,9 +63,10 @@ func (machoFile *File) Bytes() ([]byte, error) {
 		bytesWritten += uint64(len(machoFile.Insertion))
 	}
 
-	// Sort Sections
-	sortedSections := machoFile.Sections[:]
-	sort.Slice(sortedSections, func(a, b int) bool { return machoFile.Sections[a].Offset < machoFile.Sections[b].Offset })
+	// Sort Sections, in a copy so that the order of the File's stays as
+	// it was. Sections at the same offset stay in load command order.
+	sortedSections := append([]*Section(nil), machoFile.Sections...)
+	sort.SliceStable(sortedSections, func(a, b int) bool { return sortedSections[a].Offset < sortedSections[b].Offset })
 
 	/*
 		var caveOffset, caveSize uint64
@@ -68,13 +83,20 @@ func (machoFile *File) Bytes() ([]byte, error) {
 
 	// Write Sections
 	for _, s := range sortedSections {
-
+		// Sections without file contents, such as zerofill ones and
+		// those of the empty segments of a dSYM file, are not written.
+		if isZerofill(s.Flags) || s.Offset == 0 || s.Size == 0 {
+			continue
+		}
+		if seg := machoFile.Segment(s.Seg); seg != nil && seg.Filesz == 0 {
+			continue
+		}
 		if bytesWritten > uint64(s.Offset) {
 			log.Printf("Overlapping Sections in Generated macho: %+v\n", s.Name)
 			continue
 		}
 		if bytesWritten < uint64(s.Offset) {
-			pad := make([]byte, uint64(s.Offset)-bytesWritten)
+			pad := machoFile.segmentFill(bytesWritten, uint64(s.Offset))
 			w.Write(pad)
 			bytesWritten += uint64(len(pad))
 			//log.Printf("%x: wrote %d padding bytes\n", bytesWritten, len(pad))
@@ -87,6 +109,29 @@ func (machoFile *File) Bytes() ([]byte, error) {
 		bytesWritten += uint64(len(section))
 		//log.Printf("%x: wrote %d bytes section/segment named: %s %s\n", bytesWritten, uint64(len(section)), s.Name, s.Seg)
 	}
+
+	// Write the relocation entries of object files, which follow the
+	// sections
+	relocSections := make([]*Section, 0, len(machoFile.Sections))
+	for _, s := range machoFile.Sections {
+		if len(s.Relocs) > 0 {
+			relocSections = append(relocSections, s)
+		}
+	}
+	sort.SliceStable(relocSections, func(a, b int) bool { return relocSections[a].Reloff < relocSections[b].Reloff })
+	for _, s := range relocSections {
+		if bytesWritten > uint64(s.Reloff) {
+			return nil, fmt.Errorf("macho: relocations of %s at %#x overlap what precedes them", s.Name, s.Reloff)
+		}
+		if bytesWritten < uint64(s.Reloff) {
+			pad := make([]byte, uint64(s.Reloff)-bytesWritten)
+			w.Write(pad)
+			bytesWritten += uint64(len(pad))
+		}
+		relocs := machoFile.relocBytes(s)
+		w.Write(relocs)
+		bytesWritten += uint64(len(relocs))
+	}
 	// Write Dynamic Loader Info if it exists
 	if machoFile.DylinkInfo != nil {
 		// Write Rebase if it exists
@@ -190,8 +235,25 @@ func (machoFile *File) Bytes() ([]byte, error) {
 		//log.Printf("%x: Wrote raw dataincode, length of: %d", bytesWritten, machoFile.DataInCode.Len)
 	}
 
+	// Write the Linker Optimization Hints if they exist
+	if machoFile.LinkerOptHint != nil {
+		if bytesWritten > machoFile.LinkerOptHint.Offset {
+			return nil, fmt.Errorf("macho: linker optimization hints at %#x overlap what precedes them", machoFile.LinkerOptHint.Offset)
+		}
+		if bytesWritten < machoFile.LinkerOptHint.Offset {
+			padH := make([]byte, machoFile.LinkerOptHint.Offset-bytesWritten)
+			w.Write(padH)
+			bytesWritten += uint64(len(padH))
+		}
+		w.Write(machoFile.LinkerOptHint.RawDat)
+		bytesWritten += uint64(machoFile.LinkerOptHint.Len)
+	}
+
 	// Write Symbols is next I think
 	symtab := machoFile.Symtab
+	if symtab == nil {
+		symtab = &Symtab{}
+	}
 	//log.Printf("Bytes written: %d", bytesWritten)
 	//log.Printf("Indirect symbol offset: %d", machoFile.Dysymtab.DysymtabCmd.Indirectsymoff)
 	//log.Printf("Locrel offset: %d", machoFile.Dysymtab.Locreloff)
@@ -209,6 +271,9 @@ func (machoFile *File) Bytes() ([]byte, error) {
 
 	// Write DySymTab next!
 	dysymtab := machoFile.Dysymtab
+	if dysymtab == nil {
+		dysymtab = &Dysymtab{}
+	}
 	if int64(dysymtab.Indirectsymoff)-int64(bytesWritten) > 0 {
 		pad2 := make([]byte, uint64(dysymtab.Indirectsymoff)-bytesWritten)
 		w.Write(pad2)
@@ -219,6 +284,17 @@ func (machoFile *File) Bytes() ([]byte, error) {
 	bytesWritten += uint64(len(dysymtab.RawDysymtab))
 	//log.Printf("%x: Wrote raw indirect symbols, length of: %d", bytesWritten, len(dysymtab.RawDysymtab))
 
+	// Write the two-level hints, if they exist
+	if hints := machoFile.TwolevelHints; hints != nil && len(hints.RawDat) > 0 {
+		if int64(hints.Offset)-int64(bytesWritten) > 0 {
+			padT := make([]byte, uint64(hints.Offset)-bytesWritten)
+			w.Write(padT)
+			bytesWritten += uint64(len(padT))
+		}
+		w.Write(hints.RawDat)
+		bytesWritten += uint64(len(hints.RawDat))
+	}
+
 	// Write StringTab!
 	if int64(symtab.Stroff)-int64(bytesWritten) > 0 {
 		pad3 := make([]byte, uint64(symtab.Stroff)-bytesWritten)
@@ -245,8 +321,8 @@ func (machoFile *File) Bytes() ([]byte, error) {
 	}
 
 	// Write 0s to the end of the final segment
-	if int64(FinalSegEnd)-int64(bytesWritten) > 0 {
-		pad4 := make([]byte, uint64(FinalSegEnd)-bytesWritten)
+	if int64(machoFile.FinalSegEnd)-int64(bytesWritten) > 0 {
+		pad4 := make([]byte, uint64(machoFile.FinalSegEnd)-bytesWritten)
 		w.Write(pad4)
 		bytesWritten += uint64(len(pad4))
 		//log.Printf("%x: wrote pad of: %d", bytesWritten, len(pad4))
@@ -257,6 +333,23 @@ func (machoFile *File) Bytes() ([]byte, error) {
 	return machoBytes, nil
 }
 
+// segmentFill - Returns the bytes between the file offsets from and to,
+// as the file was read if they lie within a segment, such as the nop
+// padding between the sections of __TEXT, or zeros otherwise.
+func (machoFile *File) segmentFill(from, to uint64) []byte {
+	pad := make([]byte, to-from)
+	for _, seg := range machoFile.segments() {
+		if seg.sr == nil || from < seg.Offset || to > seg.Offset+seg.Filesz {
+			continue
+		}
+		if _, err := seg.ReadAt(pad, int64(from-seg.Offset)); err != nil {
+			return make([]byte, to-from)
+		}
+		break
+	}
+	return pad
+}
+
 // WriteFile - Creates a new file and writes it using the Bytes func above
 func (machoFile *File) WriteFile(destFile string) error {
 	f, err := os.Create(destFile)
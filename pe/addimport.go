@@ -0,0 +1,157 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AddImport adds a descriptor for the symbols names of dll to the import
+// directory, and returns the RVA of its import address table: the loader
+// stores the address of names[i] at that RVA plus i times the pointer
+// size.
+//
+// The directory is rebuilt from the existing descriptors, whose tables
+// stay where they are, followed by the new one. It is found through the
+// import data directory rather than by section name, since linkers often
+// merge it into .rdata or, in mixed managed and native images, .text. The
+// rebuilt directory and the new tables go into the raw data past the
+// virtual size of the section holding the directory if there is room, and
+// into a new .idata2 section otherwise. The loader writes the import
+// address table, so a read-only section is only used if it also holds
+// the IAT data directory, which is grown to cover the new table.
+func (f *File) AddImport(dll string, names []string) (uint32, error) {
+	ptrSize := uint32(4)
+	switch f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+	case *OptionalHeader64:
+		ptrSize = 8
+	default:
+		return 0, errors.New("cannot add an import to a file without an optional header")
+	}
+	dd := f.dataDirectories()
+	if len(dd) <= IMAGE_DIRECTORY_ENTRY_IMPORT {
+		return 0, errors.New("image has no import directory entry")
+	}
+	if dll == "" || strings.IndexByte(dll, 0) >= 0 {
+		return 0, fmt.Errorf("bad DLL name %q", dll)
+	}
+	if len(names) == 0 {
+		return 0, fmt.Errorf("no symbols to import from %s", dll)
+	}
+	for _, name := range names {
+		if name == "" || strings.IndexByte(name, 0) >= 0 {
+			return 0, fmt.Errorf("bad symbol name %q", name)
+		}
+	}
+
+	// The existing descriptors, up to the null one that ends the directory.
+	idd := dd[IMAGE_DIRECTORY_ENTRY_IMPORT]
+	var old []byte
+	if idd.VirtualAddress != 0 {
+		d, err := newRVAReader(f).at(idd.VirtualAddress)
+		if err != nil {
+			return 0, fmt.Errorf("import directory: %v", err)
+		}
+		var null [20]byte
+		for ; ; d = d[20:] {
+			if len(d) < 20 {
+				return 0, errors.New("import directory is not terminated")
+			}
+			if bytes.Equal(d[:20], null[:]) {
+				break
+			}
+			old = append(old, d[:20]...)
+		}
+	}
+
+	// The rebuilt directory, the import lookup and address tables, the
+	// DLL name and the hint/name entries, in that order.
+	dirSize := uint32(len(old)) + 2*20
+	thunksSize := uint32(len(names)+1) * ptrSize
+	intOff := alignUp(dirSize, ptrSize)
+	iatOff := intOff + thunksSize
+	nameOff := iatOff + thunksSize
+	hintOff := alignUp(nameOff+uint32(len(dll))+1, 2)
+	size := hintOff
+	for _, name := range names {
+		size = alignUp(size+2+uint32(len(name))+1, 2)
+	}
+
+	s, start, err := f.importRoom(idd.VirtualAddress, size, iatOff, thunksSize)
+	if err != nil {
+		return 0, err
+	}
+	rva := s.VirtualAddress + start
+
+	b := make([]byte, size)
+	copy(b, old)
+	desc := b[len(old):]
+	binary.LittleEndian.PutUint32(desc[0:], rva+intOff)
+	binary.LittleEndian.PutUint32(desc[12:], rva+nameOff)
+	binary.LittleEndian.PutUint32(desc[16:], rva+iatOff)
+	copy(b[nameOff:], dll)
+	off := hintOff
+	for i, name := range names {
+		// Both tables hold the RVA of the hint/name entry until the
+		// loader binds the address table.
+		entry := uint64(rva + off)
+		if ptrSize == 8 {
+			binary.LittleEndian.PutUint64(b[intOff+uint32(i)*8:], entry)
+			binary.LittleEndian.PutUint64(b[iatOff+uint32(i)*8:], entry)
+		} else {
+			binary.LittleEndian.PutUint32(b[intOff+uint32(i)*4:], uint32(entry))
+			binary.LittleEndian.PutUint32(b[iatOff+uint32(i)*4:], uint32(entry))
+		}
+		copy(b[off+2:], name)
+		off = alignUp(off+2+uint32(len(name))+1, 2)
+	}
+
+	data, err := s.Data()
+	if err != nil {
+		return 0, err
+	}
+	copy(data[start:], b)
+	s.Replace(bytes.NewReader(data), int64(len(data)))
+	dd[IMAGE_DIRECTORY_ENTRY_IMPORT] = DataDirectory{VirtualAddress: rva, Size: dirSize}
+	return rva + iatOff, nil
+}
+
+// importRoom finds room for size bytes of import tables, of which the
+// import address table takes iatSize bytes at offset iatOff: the raw data
+// past the VirtualSize of the section holding the import directory at
+// dirRVA, or a new section. It returns the section and the offset of the
+// room in it, after growing VirtualSize to cover it, and the IAT data
+// directory to cover the new table if the section is read-only.
+func (f *File) importRoom(dirRVA, size, iatOff, iatSize uint32) (*Section, uint32, error) {
+	sectionAlignment, _, _, _, _ := f.imageLayout()
+	dd := f.dataDirectories()
+	if s := f.sectionForRVA(dirRVA); dirRVA != 0 && s != nil && s.VirtualSize != 0 && s.Offset != 0 {
+		start := alignUp(s.VirtualSize, 8)
+		end := start + size
+		var iat *DataDirectory
+		if len(dd) > IMAGE_DIRECTORY_ENTRY_IAT && f.sectionForRVA(dd[IMAGE_DIRECTORY_ENTRY_IAT].VirtualAddress) == s {
+			iat = &dd[IMAGE_DIRECTORY_ENTRY_IAT]
+		}
+		writable := s.Characteristics&IMAGE_SCN_MEM_WRITE != 0
+		if end <= s.Size && end <= alignUp(s.VirtualSize, sectionAlignment) && (writable || iat != nil) {
+			s.VirtualSize = end
+			if !writable {
+				// The IAT directory must stay one range, from the
+				// existing tables to the new one.
+				newEnd := s.VirtualAddress + start + iatOff + iatSize
+				if newEnd > iat.VirtualAddress+iat.Size {
+					iat.Size = newEnd - iat.VirtualAddress
+				}
+			}
+			return s, start, nil
+		}
+	}
+	s, err := f.AddSection(".idata2", make([]byte, size), IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ|IMAGE_SCN_MEM_WRITE)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s, 0, nil
+}
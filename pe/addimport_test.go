@@ -0,0 +1,137 @@
+package pe
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// hasImport reports whether sym of dll is among the imported symbols of f.
+func hasImport(t *testing.T, f *File, sym, dll string) bool {
+	t.Helper()
+	syms, err := f.ImportedSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range syms {
+		if s == sym+":"+dll {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAddImport(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		file string
+		// setup moves the imports of the mingw image, which are in a
+		// writable .idata section, into a merged section.
+		setup       func(f *File, s *Section)
+		newSection  bool
+		iatCoversIt bool
+	}{
+		{"idata", "testdata/gcc-386-mingw-no-symbols-exec", func(f *File, s *Section) {}, false, false},
+		{"rdata without IAT directory", "testdata/gcc-386-mingw-no-symbols-exec", func(f *File, s *Section) {
+			s.Name = ".rdata"
+			s.Characteristics &^= IMAGE_SCN_MEM_WRITE
+			f.dataDirectories()[IMAGE_DIRECTORY_ENTRY_IAT] = DataDirectory{}
+		}, true, false},
+		{"rdata with IAT directory", "testdata/gcc-386-mingw-no-symbols-exec", func(f *File, s *Section) {
+			s.Name = ".rdata"
+			s.Characteristics &^= IMAGE_SCN_MEM_WRITE
+		}, false, true},
+		{"no room", "testdata/gcc-386-mingw-exec", func(f *File, s *Section) {}, true, false},
+	} {
+		f, err := Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before, err := f.ImportedSymbols()
+		if err != nil || len(before) == 0 {
+			t.Fatalf("ImportedSymbols() = %v, %v", before, err)
+		}
+		ds, _ := f.sectionFromDirectoryEntry(IMAGE_DIRECTORY_ENTRY_IMPORT)
+		tt.setup(f, ds)
+		sections := len(f.Sections)
+
+		iat, err := f.AddImport("e.dll", []string{"F", "G"})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if added := len(f.Sections) > sections; added != tt.newSection {
+			t.Errorf("%s: AddImport added a section: %v, want %v", tt.name, added, tt.newSection)
+		}
+		g := reparse(t, f)
+		f.Close()
+		after, err := g.ImportedSymbols()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(after) != len(before)+2 {
+			t.Errorf("%s: %d imported symbols after adding 2 to %d", tt.name, len(after), len(before))
+		}
+		for i, sym := range before {
+			if after[i] != sym {
+				t.Errorf("%s: import %d is %s, want %s", tt.name, i, after[i], sym)
+			}
+		}
+		for i, sym := range []string{"F", "G"} {
+			if !hasImport(t, g, sym, "e.dll") {
+				t.Errorf("%s: %s:e.dll is not imported", tt.name, sym)
+			}
+			// The address table points at the hint/name entry until bound.
+			d, err := g.rvaData(iat+uint32(i)*4, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name, _ := newRVAReader(g).str(binary.LittleEndian.Uint32(d) + 2); name != sym {
+				t.Errorf("%s: IAT entry %d names %q, want %q", tt.name, i, name, sym)
+			}
+		}
+		if dd := g.dataDirectories()[IMAGE_DIRECTORY_ENTRY_IAT]; tt.iatCoversIt && (iat < dd.VirtualAddress || iat+3*4 > dd.VirtualAddress+dd.Size) {
+			t.Errorf("%s: IAT directory %+v does not cover the new table at %#x", tt.name, dd, iat)
+		}
+		if libs, _ := g.ImportedLibraries(); libs[len(libs)-1] != "e.dll" {
+			t.Errorf("%s: ImportedLibraries() = %v", tt.name, libs)
+		}
+
+		// The rebuilt directory may be rebuilt again, wherever it is.
+		if _, err := g.AddImport("other.dll", []string{"Baz"}); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		h := reparse(t, g)
+		if !hasImport(t, h, "F", "e.dll") || !hasImport(t, h, "Baz", "other.dll") {
+			libs, _ := h.ImportedLibraries()
+			t.Errorf("%s: imports after a second AddImport: %v", tt.name, libs)
+		}
+	}
+}
+
+func TestAddImportErrors(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.AddImport("", []string{"Foo"}); err == nil {
+		t.Error("AddImport accepted an empty DLL name")
+	}
+	if _, err := f.AddImport("evil.dll", nil); err == nil {
+		t.Error("AddImport accepted no symbols")
+	}
+	if _, err := f.AddImport("evil.dll", []string{"Fo\x00o"}); err == nil {
+		t.Error("AddImport accepted a symbol name with a NUL")
+	}
+
+	iat, err := f.AddImport("evil.dll", []string{"Foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := reparse(t, f)
+	if !hasImport(t, g, "Foo", "evil.dll") {
+		t.Error("Foo:evil.dll is not imported by the PE32+ image")
+	}
+	if d, err := g.rvaData(iat, 16); err != nil || binary.LittleEndian.Uint64(d[8:]) != 0 {
+		t.Errorf("64-bit IAT at %#x is not terminated: %x, %v", iat, d, err)
+	}
+}
@@ -0,0 +1,218 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AddSection appends a new section holding data to the end of the image.
+//
+// The section is given the next free RVA and raw offset, aligned to
+// SectionAlignment and FileAlignment, and its raw data is zero padded to
+// FileAlignment. If there is no room for another section header between
+// the end of the section table and the first section's raw data,
+// SizeOfHeaders is grown by whole FileAlignment units and all raw data is
+// moved down to make space. NumberOfSections, SizeOfImage and the
+// SizeOf*Code/Data totals are updated to match. A name longer than 8
+// bytes is kept in the COFF string table, as MinGW does for its debug
+// sections.
+func (f *File) AddSection(name string, data []byte, characteristics uint32) (*Section, error) {
+	if strings.IndexByte(name, 0) >= 0 {
+		return nil, fmt.Errorf("section name %q contains a NUL byte", name)
+	}
+	sectionAlignment, fileAlignment, _, sizeOfHeaders, ok := f.imageLayout()
+	if !ok {
+		return nil, errors.New("cannot add a section to a file without an optional header")
+	}
+
+	headerSize := uint32(binary.Size(SectionHeader32{}))
+	headersEnd := uint32(f.OptionalHeaderOffset) + uint32(f.FileHeader.SizeOfOptionalHeader) +
+		uint32(len(f.Sections))*headerSize
+
+	// The header must fit below SizeOfHeaders and below the first raw data.
+	firstRaw := ^uint32(0)
+	for _, s := range f.Sections {
+		if s.Size != 0 && s.Offset != 0 && s.Offset < firstRaw {
+			firstRaw = s.Offset
+		}
+	}
+	if headersEnd+headerSize > sizeOfHeaders || headersEnd+headerSize > firstRaw {
+		newSizeOfHeaders := alignUp(headersEnd+headerSize, fileAlignment)
+		if newSizeOfHeaders < sizeOfHeaders {
+			newSizeOfHeaders = sizeOfHeaders
+		}
+		if err := f.growHeaders(newSizeOfHeaders, firstRaw); err != nil {
+			return nil, err
+		}
+		sizeOfHeaders = newSizeOfHeaders
+	}
+
+	// Bound imports normally sit in the header slack right after the
+	// section table, where the new header goes. They are only a load
+	// time optimisation, so drop them rather than relocate them.
+	if dd := f.dataDirectories(); len(dd) > IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT {
+		if b := dd[IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT]; b.VirtualAddress != 0 && b.VirtualAddress < sizeOfHeaders {
+			dd[IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT] = DataDirectory{}
+		}
+	}
+
+	// Place the new section after everything else, in memory and on disk.
+	virtualAddress := alignUp(sizeOfHeaders, sectionAlignment)
+	offset := alignUp(sizeOfHeaders, fileAlignment)
+	for _, s := range f.Sections {
+		if end := alignUp(s.VirtualAddress+s.virtualExtent(), sectionAlignment); end > virtualAddress {
+			virtualAddress = end
+		}
+		if s.Offset != 0 {
+			if end := alignUp(s.Offset+s.Size, fileAlignment); end > offset {
+				offset = end
+			}
+		}
+	}
+	if f.PreserveRaw {
+		// Keep whatever follows the sections in the original file.
+		if n, err := f.rawLen(); err == nil && alignUp(uint32(n), fileAlignment) > offset {
+			offset = alignUp(uint32(n), fileAlignment)
+		}
+	}
+
+	rawSize := alignUp(uint32(len(data)), fileAlignment)
+	raw := make([]byte, rawSize)
+	copy(raw, data)
+
+	s := new(Section)
+	s.Name = name
+	s.OriginalName = nameField(name, &f.StringTable)
+	s.VirtualSize = uint32(len(data))
+	s.VirtualAddress = virtualAddress
+	s.Size = rawSize
+	s.Offset = offset
+	s.Characteristics = characteristics
+	s.Replace(bytes.NewReader(raw), int64(len(raw)))
+	f.Sections = append(f.Sections, s)
+	f.FileHeader.NumberOfSections = uint16(len(f.Sections))
+
+	// Bytes writes the COFF symbol table directly after the last section.
+	if f.FileHeader.PointerToSymbolTable != 0 {
+		f.FileHeader.PointerToSymbolTable = offset + rawSize
+	}
+
+	sizeOfImage := alignUp(virtualAddress+s.VirtualSize, sectionAlignment)
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		oh.SizeOfImage = sizeOfImage
+		addSectionSizes(characteristics, rawSize, &oh.SizeOfCode, &oh.SizeOfInitializedData, &oh.SizeOfUninitializedData)
+	case *OptionalHeader64:
+		oh.SizeOfImage = sizeOfImage
+		addSectionSizes(characteristics, rawSize, &oh.SizeOfCode, &oh.SizeOfInitializedData, &oh.SizeOfUninitializedData)
+	}
+	return s, nil
+}
+
+// addSectionSizes adds size to the optional header total that matches
+// the contents flags in characteristics.
+func addSectionSizes(characteristics, size uint32, code, initialized, uninitialized *uint32) {
+	switch {
+	case characteristics&IMAGE_SCN_CNT_CODE != 0:
+		*code += size
+	case characteristics&IMAGE_SCN_CNT_INITIALIZED_DATA != 0:
+		*initialized += size
+	case characteristics&IMAGE_SCN_CNT_UNINITIALIZED_DATA != 0:
+		*uninitialized += size
+	}
+}
+
+// growHeaders raises SizeOfHeaders to newSize and moves all raw data that
+// starts at or after firstRaw down by the same amount. The headers are
+// mapped at RVA 0, so they must still end before the first section in
+// memory.
+func (f *File) growHeaders(newSize, firstRaw uint32) error {
+	sectionAlignment, fileAlignment, _, sizeOfHeaders, _ := f.imageLayout()
+	if newSize <= sizeOfHeaders && newSize <= firstRaw {
+		return nil
+	}
+	firstVirtual := ^uint32(0)
+	for _, s := range f.Sections {
+		if s.VirtualAddress < firstVirtual {
+			firstVirtual = s.VirtualAddress
+		}
+	}
+	if alignUp(newSize, sectionAlignment) > firstVirtual {
+		return fmt.Errorf("headers of %#x bytes would overlap the first section at RVA %#x", newSize, firstVirtual)
+	}
+	if sectionAlignment == fileAlignment && sectionAlignment < 0x1000 {
+		// Raw offsets must equal RVAs in this layout, so raw data
+		// cannot be moved independently of the virtual layout.
+		return errors.New("cannot grow headers of an image whose file and section alignment are equal")
+	}
+
+	var delta uint32
+	if newSize > firstRaw {
+		delta = newSize - firstRaw
+	}
+	if delta != 0 && f.PreserveRaw {
+		return errors.New("cannot move raw data of a file whose original bytes are preserved")
+	}
+	if err := f.shiftRawData(firstRaw, delta); err != nil {
+		return err
+	}
+
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		oh.SizeOfHeaders = newSize
+	case *OptionalHeader64:
+		oh.SizeOfHeaders = newSize
+	}
+	return nil
+}
+
+// shiftRawData moves every file offset at or after from by delta bytes:
+// section raw data, COFF relocations and line numbers, the COFF symbol
+// table and the data pointers of debug directory entries. The
+// certificate table is placed by Bytes and needs no adjustment.
+func (f *File) shiftRawData(from, delta uint32) error {
+	if delta == 0 {
+		return nil
+	}
+
+	if ds, dd := f.sectionFromDirectoryEntry(IMAGE_DIRECTORY_ENTRY_DEBUG); ds != nil && dd.Size != 0 {
+		data, err := ds.Data()
+		if err != nil {
+			return err
+		}
+		// IMAGE_DEBUG_DIRECTORY entries are 28 bytes, ending with
+		// PointerToRawData.
+		const entrySize = 28
+		changed := false
+		start := dd.VirtualAddress - ds.VirtualAddress
+		for off := start; off+entrySize <= start+dd.Size && int(off+entrySize) <= len(data); off += entrySize {
+			p := binary.LittleEndian.Uint32(data[off+24:])
+			if p != 0 && p >= from {
+				binary.LittleEndian.PutUint32(data[off+24:], p+delta)
+				changed = true
+			}
+		}
+		if changed {
+			ds.Replace(bytes.NewReader(data), int64(len(data)))
+		}
+	}
+
+	for _, s := range f.Sections {
+		if s.Offset != 0 && s.Offset >= from {
+			s.Offset += delta
+		}
+		if s.PointerToRelocations != 0 && s.PointerToRelocations >= from {
+			s.PointerToRelocations += delta
+		}
+		if s.PointerToLineNumbers != 0 && s.PointerToLineNumbers >= from {
+			s.PointerToLineNumbers += delta
+		}
+	}
+	if f.FileHeader.PointerToSymbolTable != 0 && f.FileHeader.PointerToSymbolTable >= from {
+		f.FileHeader.PointerToSymbolTable += delta
+	}
+	return nil
+}
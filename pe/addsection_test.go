@@ -0,0 +1,152 @@
+package pe
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestAddSection(t *testing.T) {
+	for _, name := range []string{
+		"testdata/gcc-386-mingw-exec",
+		"testdata/gcc-amd64-mingw-exec",
+	} {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, _, oldSizeOfHeaders, _ := f.imageLayout()
+
+		// Enough sections to run out of header slack at least once.
+		var want [][]byte
+		for i := 0; i < 16; i++ {
+			data := bytes.Repeat([]byte{byte(i + 1)}, 0x123*(i+1))
+			if _, err := f.AddSection(fmt.Sprintf(".new%d", i), data, IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ); err != nil {
+				t.Fatalf("%s: AddSection %d: %v", name, i, err)
+			}
+			want = append(want, data)
+		}
+		_, _, _, sizeOfHeaders, _ := f.imageLayout()
+		if sizeOfHeaders <= oldSizeOfHeaders {
+			t.Errorf("%s: SizeOfHeaders did not grow from %#x", name, oldSizeOfHeaders)
+		}
+		for _, issue := range f.Validate() {
+			if issue.Severity >= SeverityWarning {
+				t.Errorf("%s: unexpected issue: %v", name, issue)
+			}
+		}
+
+		b, err := f.Bytes()
+		if err != nil {
+			t.Fatalf("%s: Bytes: %v", name, err)
+		}
+
+		g, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("%s: reading written file: %v", name, err)
+		}
+		for _, issue := range g.Validate() {
+			if issue.Severity >= SeverityWarning {
+				t.Errorf("%s: unexpected issue after writing: %v", name, issue)
+			}
+		}
+		if len(g.COFFSymbols) != len(f.COFFSymbols) {
+			t.Errorf("%s: got %d COFF symbols, want %d", name, len(g.COFFSymbols), len(f.COFFSymbols))
+		}
+		for i, data := range want {
+			s := g.Section(fmt.Sprintf(".new%d", i))
+			if s == nil {
+				t.Errorf("%s: section .new%d is missing", name, i)
+				continue
+			}
+			got, err := s.Data()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got[:len(data)], data) {
+				t.Errorf("%s: section .new%d has the wrong contents", name, i)
+			}
+		}
+		// Sections that were moved to make room must keep their contents.
+		for _, s := range f.Sections {
+			if s.Size == 0 {
+				continue
+			}
+			orig, err := s.Data()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := g.Section(s.Name).Data()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(orig, got) {
+				t.Errorf("%s: contents of section %s changed", name, s.Name)
+			}
+		}
+		f.Close()
+	}
+}
+
+func TestAddSectionLongName(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.AddSection(".verylongname", []byte{0}, IMAGE_SCN_MEM_READ); err != nil {
+		t.Fatal(err)
+	}
+	// A renamed section is given a string table entry when written.
+	f.Section(".data").Name = ".data.renamed"
+	if _, err := f.AddSection(".bad\x00name", []byte{0}, IMAGE_SCN_MEM_READ); err == nil {
+		t.Error("AddSection accepted a name with a NUL byte")
+	}
+
+	for _, preserve := range []bool{false, true} {
+		f.PreserveRaw = preserve
+		b, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{".verylongname", ".data.renamed", ".debug_aranges"} {
+			if g.Section(name) == nil {
+				t.Errorf("PreserveRaw %v: no section %s in the output", preserve, name)
+			}
+		}
+		if len(g.Symbols) != len(f.Symbols) {
+			t.Errorf("PreserveRaw %v: %d symbols in the output, want %d", preserve, len(g.Symbols), len(f.Symbols))
+		}
+	}
+}
+
+func TestSectionNameField(t *testing.T) {
+	st := StringTable{0, 0, 0, 0}
+	off := st.add(".debug_info")
+	if field := nameField(".debug_info", &st); cstring(field[:]) != fmt.Sprintf("/%d", off) || len(st) != 16 {
+		t.Errorf("nameField = %q, with a string table of %d bytes", field, len(st))
+	}
+	if field := nameField(".text", &st); cstring(field[:]) != ".text" {
+		t.Errorf("nameField = %q, want .text", field)
+	}
+
+	// Offsets past seven decimal digits are written in base64.
+	big := make(StringTable, 10000000)
+	field := nameField(".debug_aranges", &big)
+	if string(field[:2]) != "//" {
+		t.Fatalf("nameField = %q, want a base64 offset", field)
+	}
+	hdr := SectionHeader32{Name: field}
+	if name, err := hdr.fullName(big); err != nil || name != ".debug_aranges" {
+		t.Errorf("fullName = %q, %v", name, err)
+	}
+	hdr.Name = [8]uint8{'/', '/', 'A', 'A', 'A', 'A', 'A', 'E'}
+	if name, err := hdr.fullName(st); err != nil || name != ".debug_info" {
+		t.Errorf("fullName of //AAAAAE = %q, %v", name, err)
+	}
+}
@@ -0,0 +1,50 @@
+package pe
+
+import (
+	"hash/crc32"
+	"hash/fnv"
+)
+
+// HashROR13 returns the ROR13 hash of name that shellcode commonly uses to
+// find an API without naming it: each byte is added to the hash after
+// rotating it right by 13 bits. No NUL terminator is hashed.
+func HashROR13(name string) uint32 {
+	var h uint32
+	for i := 0; i < len(name); i++ {
+		h = (h>>13 | h<<19) + uint32(name[i])
+	}
+	return h
+}
+
+// HashCRC32 returns the IEEE CRC-32 checksum of name.
+func HashCRC32(name string) uint32 {
+	return crc32.ChecksumIEEE([]byte(name))
+}
+
+// HashFNV1a returns the 32-bit FNV-1a hash of name.
+func HashFNV1a(name string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return h.Sum32()
+}
+
+// ExportHashes hashes the name of each named export of f with hash, such
+// as HashROR13, HashCRC32 or HashFNV1a, and returns the names by hash. When
+// names collide, the first export in the export address table wins.
+func (f *File) ExportHashes(hash func(name string) uint32) (map[uint32]string, error) {
+	exports, err := f.Exports()
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[uint32]string)
+	for _, e := range exports {
+		if e.Name == "" {
+			continue
+		}
+		h := hash(e.Name)
+		if _, ok := hashes[h]; !ok {
+			hashes[h] = e.Name
+		}
+	}
+	return hashes, nil
+}
@@ -0,0 +1,97 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// addExports gives f an export directory in a new section that exports
+// names by ordinal 1 onwards, followed by one export without a name.
+// names must be sorted.
+func addExports(t *testing.T, f *File, names []string) {
+	n := uint32(len(names))
+	eat := uint32(40)
+	npt := eat + 4*(n+1)
+	ot := npt + 4*n
+	dllName := ot + 2*n
+	size := dllName + uint32(len("test.dll\x00"))
+	for _, name := range names {
+		size += uint32(len(name)) + 1
+	}
+	s, err := f.AddSection(".edata", make([]byte, size), IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	va := s.VirtualAddress
+	d := make([]byte, 40, size)
+	le := binary.LittleEndian
+	le.PutUint32(d[12:], va+dllName)
+	le.PutUint32(d[16:], 1)
+	le.PutUint32(d[20:], n+1)
+	le.PutUint32(d[24:], n)
+	le.PutUint32(d[28:], va+eat)
+	le.PutUint32(d[32:], va+npt)
+	le.PutUint32(d[36:], va+ot)
+	for i := uint32(0); i <= n; i++ {
+		d = append(d, 0, 0, 0, 0)
+		le.PutUint32(d[eat+4*i:], 0x1000+i)
+	}
+	d = append(d, make([]byte, 6*n)...)
+	d = append(d, "test.dll\x00"...)
+	for i, name := range names {
+		le.PutUint32(d[npt+4*uint32(i):], va+uint32(len(d)))
+		le.PutUint16(d[ot+2*uint32(i):], uint16(i))
+		d = append(d, name...)
+		d = append(d, 0)
+	}
+	s.Replace(bytes.NewReader(d), int64(len(d)))
+	f.dataDirectories()[IMAGE_DIRECTORY_ENTRY_EXPORT] = DataDirectory{VirtualAddress: va, Size: uint32(len(d))}
+}
+
+func TestAPIHashes(t *testing.T) {
+	for _, tt := range []struct {
+		hash func(string) uint32
+		name string
+		want uint32
+	}{
+		{HashROR13, "LoadLibraryA", 0xec0e4e8e},
+		{HashROR13, "GetProcAddress", 0x7c0dfcaa},
+		{HashCRC32, "LoadLibraryA", 0x3fc1bd8d},
+		{HashFNV1a, "", 0x811c9dc5},
+		{HashFNV1a, "a", 0xe40c292c},
+	} {
+		if got := tt.hash(tt.name); got != tt.want {
+			t.Errorf("hash of %q = %#x, want %#x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExportHashes(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if hashes, err := f.ExportHashes(HashROR13); err != nil || len(hashes) != 0 {
+		t.Fatalf("file without exports: got %v, %v", hashes, err)
+	}
+
+	names := []string{"GetProcAddress", "LoadLibraryA"}
+	addExports(t, f, names)
+	g := reparse(t, f)
+	for _, hash := range []func(string) uint32{HashROR13, HashCRC32, HashFNV1a} {
+		hashes, err := g.ExportHashes(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hashes) != len(names) {
+			t.Errorf("got %d hashes, want %d: %v", len(hashes), len(names), hashes)
+		}
+		for _, name := range names {
+			if got := hashes[hash(name)]; got != name {
+				t.Errorf("hash of %s resolves to %q", name, got)
+			}
+		}
+	}
+}
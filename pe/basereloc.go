@@ -0,0 +1,138 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// AddBaseReloc adds a base relocation of type typ, such as
+// IMAGE_REL_BASED_HIGHLOW or IMAGE_REL_BASED_DIR64, for the address
+// stored at rva, and writes the updated base relocation table back to
+// the image.
+//
+// The table is rewritten in place when it still fits in its section, and
+// moved to a new section otherwise. The relocations of a page are kept
+// in offset order. Adding relocations does not clear
+// IMAGE_FILE_RELOCS_STRIPPED.
+func (f *File) AddBaseReloc(rva uint32, typ byte) error {
+	if err := f.addBaseReloc(rva, typ); err != nil {
+		return err
+	}
+	return f.writeBaseRelocs()
+}
+
+// addBaseReloc adds a relocation to BaseRelocationTable, creating the
+// block for the page of rva if needed.
+func (f *File) addBaseReloc(rva uint32, typ byte) error {
+	if typ > 0xf {
+		return fmt.Errorf("invalid base relocation type %d", typ)
+	}
+	if len(f.dataDirectories()) <= IMAGE_DIRECTORY_ENTRY_BASERELOC {
+		return errors.New("image has no base relocation directory entry")
+	}
+	if f.BaseRelocationTable == nil {
+		f.BaseRelocationTable = new([]RelocationTableEntry)
+	}
+	blocks := *f.BaseRelocationTable
+
+	page := rva &^ 0xfff
+	item := BlockItem{Type: typ, Offset: uint16(rva & 0xfff)}
+	i := sort.Search(len(blocks), func(i int) bool { return blocks[i].VirtualAddress >= page })
+	if i == len(blocks) || blocks[i].VirtualAddress != page {
+		blocks = append(blocks, RelocationTableEntry{})
+		copy(blocks[i+1:], blocks[i:])
+		blocks[i] = RelocationTableEntry{RelocationBlock: RelocationBlock{VirtualAddress: page}}
+	}
+	b := &blocks[i]
+	for _, it := range b.BlockItems {
+		if it == item {
+			*f.BaseRelocationTable = blocks
+			return nil
+		}
+	}
+	// Drop the padding that kept the block 32-bit aligned; baseRelocBytes
+	// adds it again if needed.
+	if n := len(b.BlockItems); n > 0 && b.BlockItems[n-1] == (BlockItem{Type: IMAGE_REL_BASED_ABSOLUTE}) {
+		b.BlockItems = b.BlockItems[:n-1]
+	}
+	// Keep the entries in offset order, so that the table does not
+	// depend on the order relocations are added in.
+	j := sort.Search(len(b.BlockItems), func(j int) bool { return b.BlockItems[j].Offset > item.Offset })
+	b.BlockItems = append(b.BlockItems, BlockItem{})
+	copy(b.BlockItems[j+1:], b.BlockItems[j:])
+	b.BlockItems[j] = item
+	*f.BaseRelocationTable = blocks
+	return nil
+}
+
+// baseRelocBytes encodes BaseRelocationTable, padding each block to a
+// multiple of 4 bytes and updating its SizeOfBlock.
+func (f *File) baseRelocBytes() []byte {
+	var buf bytes.Buffer
+	if f.BaseRelocationTable == nil {
+		return nil
+	}
+	for i := range *f.BaseRelocationTable {
+		b := &(*f.BaseRelocationTable)[i]
+		if len(b.BlockItems)%2 != 0 {
+			b.BlockItems = append(b.BlockItems, BlockItem{Type: IMAGE_REL_BASED_ABSOLUTE})
+		}
+		b.SizeOfBlock = uint32(8 + 2*len(b.BlockItems))
+		binary.Write(&buf, binary.LittleEndian, b.RelocationBlock)
+		for _, it := range b.BlockItems {
+			binary.Write(&buf, binary.LittleEndian, uint16(it.Type)<<12|it.Offset&0x0fff)
+		}
+	}
+	return buf.Bytes()
+}
+
+// writeBaseRelocs stores the encoded BaseRelocationTable where the base
+// relocation directory points, or in a new section if it no longer fits
+// there or would overwrite the dynamic value relocation table, and updates
+// the directory entry.
+func (f *File) writeBaseRelocs() error {
+	data := f.baseRelocBytes()
+	dd := f.dataDirectories()
+	if len(dd) <= IMAGE_DIRECTORY_ENTRY_BASERELOC {
+		return errors.New("image has no base relocation directory entry")
+	}
+	sectionAlignment, _, _, _, _ := f.imageLayout()
+
+	if va := dd[IMAGE_DIRECTORY_ENTRY_BASERELOC].VirtualAddress; va != 0 {
+		if s := f.sectionForRVA(va); s != nil {
+			start := va - s.VirtualAddress
+			end := start + uint32(len(data))
+			// Linkers put the dynamic value relocation table of
+			// hybrid images right after the base relocations.
+			dvrt, off, size, _ := f.dynamicRelocTable()
+			clobbers := dvrt == s && off < end && start < off+size
+			if end <= s.Size && end <= alignUp(s.virtualExtent(), sectionAlignment) && !clobbers {
+				sdata, err := s.Data()
+				if err != nil {
+					return err
+				}
+				copy(sdata[start:], data)
+				s.Replace(bytes.NewReader(sdata), int64(len(sdata)))
+				if s.VirtualSize != 0 && end > s.VirtualSize {
+					s.VirtualSize = end
+				}
+				dd[IMAGE_DIRECTORY_ENTRY_BASERELOC].Size = uint32(len(data))
+				return nil
+			}
+		}
+	}
+
+	name := ".reloc"
+	if f.Section(name) != nil {
+		name = ".reloc2"
+	}
+	s, err := f.AddSection(name, data, IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ|IMAGE_SCN_MEM_DISCARDABLE)
+	if err != nil {
+		return err
+	}
+	dd[IMAGE_DIRECTORY_ENTRY_BASERELOC] = DataDirectory{VirtualAddress: s.VirtualAddress, Size: uint32(len(data))}
+	return nil
+}
@@ -0,0 +1,98 @@
+package pe
+
+import (
+	"container/list"
+	"io"
+	"sync"
+
+	"github.com/Binject/debug/internal/readerat"
+)
+
+// A DataCache keeps the contents of sections read by Section.Data in
+// memory, so that reading the same section again does not read the
+// underlying file. The least recently used contents are dropped once the
+// cached bytes exceed the budget, which is shared by all files using the
+// cache. A DataCache is safe for concurrent use.
+type DataCache struct {
+	mu      sync.Mutex
+	budget  int64
+	used    int64
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[*io.SectionReader]*list.Element
+}
+
+type cacheEntry struct {
+	sr   *io.SectionReader
+	data []byte
+}
+
+// NewDataCache returns a cache that holds up to budget bytes of section
+// contents.
+func NewDataCache(budget int64) *DataCache {
+	return &DataCache{
+		budget:  budget,
+		lru:     list.New(),
+		entries: make(map[*io.SectionReader]*list.Element),
+	}
+}
+
+// SetDataCache makes Data of the sections of f use c, or read the file
+// every time if c is nil. Contents are cached per section reader, so a
+// section whose data is replaced is read afresh.
+//
+// Once set up, a File may be shared by goroutines that only read it, such
+// as through Section.Data, Exports or ImportedSymbols. Methods that modify
+// the File, including SetDataCache, must not run concurrently with others.
+func (f *File) SetDataCache(c *DataCache) {
+	for _, s := range f.Sections {
+		s.cache = c
+	}
+}
+
+// Len returns the number of bytes held by c.
+func (c *DataCache) Len() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.used
+}
+
+// data returns the contents of sr, shared with the cache.
+func (c *DataCache) data(sr *io.SectionReader) ([]byte, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[sr]; ok {
+		c.lru.MoveToFront(e)
+		b := e.Value.(*cacheEntry).data
+		c.mu.Unlock()
+		return b, nil
+	}
+	c.mu.Unlock()
+
+	// Read without holding the lock; concurrent misses for the same
+	// section both read it and the first one is kept.
+	b, err := readSection(sr)
+	if err != nil {
+		return b, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[sr]; ok {
+		return e.Value.(*cacheEntry).data, nil
+	}
+	if int64(len(b)) > c.budget {
+		return b, nil
+	}
+	for c.used+int64(len(b)) > c.budget {
+		e := c.lru.Back()
+		old := c.lru.Remove(e).(*cacheEntry)
+		delete(c.entries, old.sr)
+		c.used -= int64(len(old.data))
+	}
+	c.entries[sr] = c.lru.PushFront(&cacheEntry{sr, b})
+	c.used += int64(len(b))
+	return b, nil
+}
+
+// readSection reads all of sr, or as much of it as there is.
+func readSection(sr *io.SectionReader) ([]byte, error) {
+	return readerat.ReadData(io.NewSectionReader(sr, 0, sr.Size()), uint64(sr.Size()))
+}
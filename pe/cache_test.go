@@ -0,0 +1,81 @@
+package pe
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestDataCache(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want := make(map[string][]byte)
+	for _, s := range f.Sections {
+		if want[s.Name], err = s.Data(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	text, data := f.Section(".text"), f.Section(".data")
+	c := NewDataCache(int64(text.Size) + 0x100)
+	f.SetDataCache(c)
+	b, err := text.Data()
+	if err != nil || !bytes.Equal(b, want[".text"]) {
+		t.Fatalf("cached .text differs, %v", err)
+	}
+	if c.Len() != int64(text.Size) {
+		t.Errorf("cache holds %d bytes, want %d", c.Len(), text.Size)
+	}
+	b[0] ^= 0xff
+	if b, _ = text.Data(); !bytes.Equal(b, want[".text"]) {
+		t.Error("modifying the result of Data changed the cached contents")
+	}
+
+	// Reading .data evicts .text to keep within the budget.
+	if b, err = data.Data(); err != nil || !bytes.Equal(b, want[".data"]) {
+		t.Fatalf("cached .data differs, %v", err)
+	}
+	if c.Len() != int64(data.Size) {
+		t.Errorf("cache holds %d bytes after eviction, want %d", c.Len(), data.Size)
+	}
+
+	data.Replace(bytes.NewReader([]byte("replaced")), 8)
+	if b, _ = data.Data(); string(b) != "replaced" {
+		t.Errorf("Data() = %q after Replace", b)
+	}
+}
+
+func TestDataCacheConcurrent(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want := make([][]byte, len(f.Sections))
+	for i, s := range f.Sections {
+		if want[i], err = s.Data(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.SetDataCache(NewDataCache(64 << 10))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < 20; n++ {
+				i := (g + n) % len(f.Sections)
+				b, err := f.Sections[i].Data()
+				if err != nil || !bytes.Equal(b, want[i]) {
+					t.Errorf("section %s differs when read concurrently, %v", f.Sections[i].Name, err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -1,9 +1,10 @@
 package pe
 
 import (
-	"errors"
 	"fmt"
 	"io"
+
+	"github.com/Binject/debug/internal/readerat"
 )
 
 // CERTIFICATE_TABLE is the index of the Certificate Table info in the Data Directory structure
@@ -15,24 +16,23 @@ func readCertTable(f *File, r io.ReadSeeker) ([]byte, error) {
 		return nil, nil
 	}
 
-	var certTableOffset, certTableSize uint32
-
-	switch f.FileHeader.Machine {
-	case IMAGE_FILE_MACHINE_I386:
-		certTableOffset = f.OptionalHeader.(*OptionalHeader32).DataDirectory[CERTIFICATE_TABLE].VirtualAddress
-		certTableSize = f.OptionalHeader.(*OptionalHeader32).DataDirectory[CERTIFICATE_TABLE].Size
-	case IMAGE_FILE_MACHINE_AMD64:
-		certTableOffset = f.OptionalHeader.(*OptionalHeader64).DataDirectory[CERTIFICATE_TABLE].VirtualAddress
-		certTableSize = f.OptionalHeader.(*OptionalHeader64).DataDirectory[CERTIFICATE_TABLE].Size
-	default:
-		return nil, errors.New("architecture not supported")
+	// The certificate table is the only directory entry that holds a
+	// file offset rather than an RVA.
+	dd := f.dataDirectories()
+	if len(dd) <= CERTIFICATE_TABLE {
+		return nil, nil
 	}
+	certTableOffset, certTableSize := dd[CERTIFICATE_TABLE].VirtualAddress, dd[CERTIFICATE_TABLE].Size
 
 	// check if certificate table exists
 	if certTableOffset == 0 || certTableSize == 0 {
 		return nil, nil
 	}
 
+	if certTableSize > f.limits.MaxCertTableSize {
+		return nil, fmt.Errorf("certificate table of %d bytes is larger than the limit of %d", certTableSize, f.limits.MaxCertTableSize)
+	}
+
 	var err error
 	_, err = r.Seek(int64(certTableOffset), seekStart)
 	if err != nil {
@@ -40,8 +40,7 @@ func readCertTable(f *File, r io.ReadSeeker) ([]byte, error) {
 	}
 
 	// grab the cert
-	cert := make([]byte, certTableSize)
-	_, err = io.ReadFull(r, cert)
+	cert, err := readerat.ReadData(r, uint64(certTableSize))
 	if err != nil {
 		return nil, fmt.Errorf("fail to read certificate table: %v", err)
 	}
@@ -0,0 +1,297 @@
+package pe
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A Description is a summary of the metadata of a PE file, laid out for
+// encoding as JSON and loading into triage databases.
+type Description struct {
+	Header        HeaderDescription      `json:"header"`
+	Optional      *OptionalDescription   `json:"optional,omitempty"`
+	Directories   []DirectoryDescription `json:"directories"`
+	Sections      []SectionDescription   `json:"sections"`
+	Imports       []ImportDescription    `json:"imports"`
+	DelayImports  []string               `json:"delay_imports"`
+	Exports       []Export               `json:"exports"`
+	Resources     []ResourceDescription  `json:"resources"`
+	RichHeader    []RichEntry            `json:"rich_header"`
+	RichHeaderKey uint32                 `json:"rich_header_key,omitempty"`
+	Managed       bool                   `json:"managed"`
+}
+
+// A HeaderDescription describes the COFF file header.
+type HeaderDescription struct {
+	Machine              uint16 `json:"machine"`
+	NumberOfSections     uint16 `json:"number_of_sections"`
+	TimeDateStamp        uint32 `json:"time_date_stamp"`
+	PointerToSymbolTable uint32 `json:"pointer_to_symbol_table"`
+	NumberOfSymbols      uint32 `json:"number_of_symbols"`
+	Characteristics      uint16 `json:"characteristics"`
+}
+
+// An OptionalDescription describes the fields of the optional header
+// that are common to PE32 and PE32+.
+type OptionalDescription struct {
+	Magic               uint16 `json:"magic"`
+	LinkerVersion       string `json:"linker_version"`
+	OSVersion           string `json:"os_version"`
+	ImageVersion        string `json:"image_version"`
+	SubsystemVersion    string `json:"subsystem_version"`
+	AddressOfEntryPoint uint32 `json:"address_of_entry_point"`
+	ImageBase           uint64 `json:"image_base"`
+	SectionAlignment    uint32 `json:"section_alignment"`
+	FileAlignment       uint32 `json:"file_alignment"`
+	SizeOfImage         uint32 `json:"size_of_image"`
+	SizeOfHeaders       uint32 `json:"size_of_headers"`
+	CheckSum            uint32 `json:"checksum"`
+	Subsystem           uint16 `json:"subsystem"`
+	DllCharacteristics  uint16 `json:"dll_characteristics"`
+}
+
+// A DirectoryDescription describes a data directory entry in use.
+type DirectoryDescription struct {
+	Index          int    `json:"index"`
+	Name           string `json:"name"`
+	VirtualAddress uint32 `json:"virtual_address"`
+	Size           uint32 `json:"size"`
+}
+
+// A SectionDescription describes a section header and the SHA-256 of the
+// section contents.
+type SectionDescription struct {
+	Name                 string `json:"name"`
+	VirtualSize          uint32 `json:"virtual_size"`
+	VirtualAddress       uint32 `json:"virtual_address"`
+	Size                 uint32 `json:"size"`
+	Offset               uint32 `json:"offset"`
+	PointerToRelocations uint32 `json:"pointer_to_relocations"`
+	NumberOfRelocations  uint16 `json:"number_of_relocations"`
+	Characteristics      uint32 `json:"characteristics"`
+	SHA256               string `json:"sha256"`
+}
+
+// An ImportDescription lists the symbols imported by name from a DLL.
+type ImportDescription struct {
+	DLL     string   `json:"dll"`
+	Symbols []string `json:"symbols"`
+}
+
+// A ResourceDescription describes a resource by its type/name/language
+// path, as in Changeset.
+type ResourceDescription struct {
+	Path     string `json:"path"`
+	Size     int    `json:"size"`
+	CodePage uint32 `json:"code_page"`
+}
+
+// A RichEntry is a decoded entry of the Rich header: the count of objects
+// built by a tool, identified by product and build number.
+type RichEntry struct {
+	ProductID uint16 `json:"product_id"`
+	Build     uint16 `json:"build"`
+	Count     uint32 `json:"count"`
+}
+
+// Describe returns a Description of f. A Rich header that does not decode
+// is left out.
+func (f *File) Describe() (*Description, error) {
+	d := &Description{
+		Header: HeaderDescription{
+			Machine:              f.Machine,
+			NumberOfSections:     f.NumberOfSections,
+			TimeDateStamp:        f.TimeDateStamp,
+			PointerToSymbolTable: f.PointerToSymbolTable,
+			NumberOfSymbols:      f.NumberOfSymbols,
+			Characteristics:      f.Characteristics,
+		},
+		Optional:     f.describeOptional(),
+		Directories:  []DirectoryDescription{},
+		Sections:     []SectionDescription{},
+		Imports:      []ImportDescription{},
+		DelayImports: []string{},
+		Exports:      []Export{},
+		Resources:    []ResourceDescription{},
+		RichHeader:   []RichEntry{},
+		Managed:      f.IsManaged(),
+	}
+	for i, dd := range f.dataDirectories() {
+		if dd.VirtualAddress == 0 && dd.Size == 0 {
+			continue
+		}
+		name := fmt.Sprint(i)
+		if i < len(dataDirectoryNames) {
+			name = dataDirectoryNames[i]
+		}
+		d.Directories = append(d.Directories, DirectoryDescription{Index: i, Name: name, VirtualAddress: dd.VirtualAddress, Size: dd.Size})
+	}
+	for _, s := range f.Sections {
+		data, err := s.Data()
+		if err != nil {
+			return nil, fmt.Errorf("section %s: %v", s.Name, err)
+		}
+		sum := sha256.Sum256(data)
+		d.Sections = append(d.Sections, SectionDescription{
+			Name:                 s.Name,
+			VirtualSize:          s.VirtualSize,
+			VirtualAddress:       s.VirtualAddress,
+			Size:                 s.Size,
+			Offset:               s.Offset,
+			PointerToRelocations: s.PointerToRelocations,
+			NumberOfRelocations:  s.NumberOfRelocations,
+			Characteristics:      s.Characteristics,
+			SHA256:               hex.EncodeToString(sum[:]),
+		})
+	}
+
+	if f.OptionalHeader != nil {
+		syms, err := f.ImportedSymbols()
+		if err != nil {
+			return nil, err
+		}
+		d.Imports = groupImports(d.Imports, syms)
+		libs, err := f.ImportedDelayLibraries()
+		if err != nil {
+			return nil, err
+		}
+		d.DelayImports = append(d.DelayImports, libs...)
+		exports, err := f.Exports()
+		if err != nil {
+			return nil, err
+		}
+		d.Exports = append(d.Exports, exports...)
+		rsrc, err := f.resources()
+		if err != nil {
+			return nil, err
+		}
+		leaves := make(map[string]*resourceData)
+		rsrc.leaves("", leaves)
+		for path, r := range leaves {
+			d.Resources = append(d.Resources, ResourceDescription{Path: path, Size: len(r.data), CodePage: r.codePage})
+		}
+		sort.Slice(d.Resources, func(i, j int) bool { return d.Resources[i].Path < d.Resources[j].Path })
+	}
+
+	if entries, key, ok := decodeRichHeader(f.RichHeader); ok {
+		d.RichHeader, d.RichHeaderKey = append(d.RichHeader, entries...), key
+	}
+	return d, nil
+}
+
+// MarshalJSON encodes the Description of f.
+func (f *File) MarshalJSON() ([]byte, error) {
+	d, err := f.Describe()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(d)
+}
+
+func (f *File) describeOptional() *OptionalDescription {
+	version := func(major, minor interface{}) string { return fmt.Sprintf("%d.%d", major, minor) }
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		return &OptionalDescription{
+			Magic:               oh.Magic,
+			LinkerVersion:       version(oh.MajorLinkerVersion, oh.MinorLinkerVersion),
+			OSVersion:           version(oh.MajorOperatingSystemVersion, oh.MinorOperatingSystemVersion),
+			ImageVersion:        version(oh.MajorImageVersion, oh.MinorImageVersion),
+			SubsystemVersion:    version(oh.MajorSubsystemVersion, oh.MinorSubsystemVersion),
+			AddressOfEntryPoint: oh.AddressOfEntryPoint,
+			ImageBase:           uint64(oh.ImageBase),
+			SectionAlignment:    oh.SectionAlignment,
+			FileAlignment:       oh.FileAlignment,
+			SizeOfImage:         oh.SizeOfImage,
+			SizeOfHeaders:       oh.SizeOfHeaders,
+			CheckSum:            oh.CheckSum,
+			Subsystem:           oh.Subsystem,
+			DllCharacteristics:  oh.DllCharacteristics,
+		}
+	case *OptionalHeader64:
+		return &OptionalDescription{
+			Magic:               oh.Magic,
+			LinkerVersion:       version(oh.MajorLinkerVersion, oh.MinorLinkerVersion),
+			OSVersion:           version(oh.MajorOperatingSystemVersion, oh.MinorOperatingSystemVersion),
+			ImageVersion:        version(oh.MajorImageVersion, oh.MinorImageVersion),
+			SubsystemVersion:    version(oh.MajorSubsystemVersion, oh.MinorSubsystemVersion),
+			AddressOfEntryPoint: oh.AddressOfEntryPoint,
+			ImageBase:           oh.ImageBase,
+			SectionAlignment:    oh.SectionAlignment,
+			FileAlignment:       oh.FileAlignment,
+			SizeOfImage:         oh.SizeOfImage,
+			SizeOfHeaders:       oh.SizeOfHeaders,
+			CheckSum:            oh.CheckSum,
+			Subsystem:           oh.Subsystem,
+			DllCharacteristics:  oh.DllCharacteristics,
+		}
+	}
+	return nil
+}
+
+// groupImports appends the "symbol:dll" strings returned by
+// ImportedSymbols to d grouped by DLL, in order of first appearance.
+func groupImports(d []ImportDescription, syms []string) []ImportDescription {
+	index := make(map[string]int)
+	for _, s := range syms {
+		sym, dll := s, ""
+		if i := strings.LastIndex(s, ":"); i >= 0 {
+			sym, dll = s[:i], s[i+1:]
+		}
+		i, ok := index[dll]
+		if !ok {
+			i = len(d)
+			index[dll] = i
+			d = append(d, ImportDescription{DLL: dll})
+		}
+		d[i].Symbols = append(d[i].Symbols, sym)
+	}
+	return d
+}
+
+// decodeRichHeader decodes the entries of the Rich header rich.
+func decodeRichHeader(rich []byte) (entries []RichEntry, key uint32, ok bool) {
+	clear, key, ok := richClearData(rich)
+	if !ok {
+		return nil, 0, false
+	}
+	for i := 16; i+8 <= len(clear); i += 8 {
+		id := binary.LittleEndian.Uint32(clear[i:])
+		count := binary.LittleEndian.Uint32(clear[i+4:])
+		entries = append(entries, RichEntry{ProductID: uint16(id >> 16), Build: uint16(id), Count: count})
+	}
+	return entries, key, true
+}
+
+// richClearData returns the unmasked Rich header, from the "DanS" marker
+// up to "Rich", and the XOR key. The header ends with "Rich" and the key,
+// and the marker is followed by three padding words and the entries, all
+// masked with the key.
+func richClearData(rich []byte) (clear []byte, key uint32, ok bool) {
+	end := bytes.LastIndex(rich, []byte("Rich"))
+	if end < 0 || end+8 > len(rich) || end%4 != 0 {
+		return nil, 0, false
+	}
+	key = binary.LittleEndian.Uint32(rich[end+4:])
+	start := -1
+	for i := end - 4; i >= 0; i -= 4 {
+		if binary.LittleEndian.Uint32(rich[i:])^key == 0x536e6144 { // "DanS"
+			start = i
+			break
+		}
+	}
+	if start < 0 || start+16 > end {
+		return nil, 0, false
+	}
+	clear = make([]byte, end-start)
+	for i := 0; i < len(clear); i += 4 {
+		binary.LittleEndian.PutUint32(clear[i:], binary.LittleEndian.Uint32(rich[start+i:])^key)
+	}
+	return clear, key, true
+}
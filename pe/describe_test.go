@@ -0,0 +1,84 @@
+package pe
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	addExports(t, f, []string{"alpha"})
+	f = reparse(t, f)
+	f.RichHeader = richHeader(0x12345678, RichEntry{ProductID: 0x104, Build: 30729, Count: 3}, RichEntry{ProductID: 0x93, Build: 1, Count: 12})
+
+	d, err := f.Describe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Header.Machine != IMAGE_FILE_MACHINE_AMD64 || d.Optional == nil || d.Optional.Magic != 0x20b {
+		t.Errorf("headers are %+v and %+v", d.Header, d.Optional)
+	}
+	if len(d.Sections) != len(f.Sections) || d.Sections[0].Name != ".text" || len(d.Sections[0].SHA256) != 64 {
+		t.Errorf("sections are %+v", d.Sections)
+	}
+	var kernel32 []string
+	for _, imp := range d.Imports {
+		if imp.DLL == "KERNEL32.dll" {
+			kernel32 = imp.Symbols
+		}
+	}
+	if len(kernel32) == 0 || kernel32[0] != "DeleteCriticalSection" {
+		t.Errorf("KERNEL32.dll imports are %q", kernel32)
+	}
+	if len(d.Exports) == 0 || d.Exports[0].Name != "alpha" {
+		t.Errorf("exports are %+v", d.Exports)
+	}
+	if len(d.Directories) == 0 || d.Directories[0].Name != "export" {
+		t.Errorf("directories are %+v", d.Directories)
+	}
+	want := []RichEntry{{0x104, 30729, 3}, {0x93, 1, 12}}
+	if !reflect.DeepEqual(d.RichHeader, want) || d.RichHeaderKey != 0x12345678 {
+		t.Errorf("Rich header is %+v with key %#x, want %+v", d.RichHeader, d.RichHeaderKey, want)
+	}
+
+	b, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Description
+	if err := json.Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&back, d) {
+		t.Errorf("JSON does not round trip: %s", b)
+	}
+
+	obj, err := Open("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	if d, err := obj.Describe(); err != nil || d.Optional != nil || len(d.Sections) != len(obj.Sections) {
+		t.Errorf("Describe of an object file = %+v, %v", d, err)
+	}
+}
+
+// richHeader encodes a Rich header with the given key and entries.
+func richHeader(key uint32, entries ...RichEntry) []byte {
+	words := []uint32{0x536e6144 ^ key, key, key, key}
+	for _, e := range entries {
+		words = append(words, (uint32(e.ProductID)<<16|uint32(e.Build))^key, e.Count^key)
+	}
+	words = append(words, 0x68636952, key) // "Rich"
+	b := make([]byte, 4*len(words))
+	for i, w := range words {
+		binary.LittleEndian.PutUint32(b[4*i:], w)
+	}
+	return b
+}
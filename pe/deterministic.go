@@ -0,0 +1,171 @@
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+// WriteOptions controls how BytesWithOptions and WriteFileWithOptions
+// write a File.
+type WriteOptions struct {
+	// Deterministic makes the bytes written depend only on the contents
+	// of the File, not on when it was linked: the TimeDateStamp fields of
+	// the file header and of the export and debug directories are
+	// written as zero, or as Stamps gives them.
+	Deterministic bool
+
+	// Stamps, if not nil, are written to the TimeDateStamp fields
+	// instead of those of the File, such as the Stamps of a donor file.
+	Stamps *Stamps
+}
+
+// Stamps are the TimeDateStamp fields that record when a file was linked.
+type Stamps struct {
+	File   uint32   // of the file header
+	Export uint32   // of the export directory
+	Debug  []uint32 // of the debug directory entries, in order
+}
+
+// Stamps returns the TimeDateStamp fields of f.
+func (f *File) Stamps() (*Stamps, error) {
+	st := &Stamps{File: f.FileHeader.TimeDateStamp}
+	export, debug := f.stampRVAs()
+	read := func(rva uint32) (uint32, error) {
+		s := f.sectionForRVA(rva)
+		data, err := s.Data()
+		if err != nil {
+			return 0, err
+		}
+		off := rva - s.VirtualAddress
+		if uint64(off)+4 > uint64(len(data)) {
+			return 0, errors.New("TimeDateStamp is past the raw data of its section")
+		}
+		return binary.LittleEndian.Uint32(data[off:]), nil
+	}
+	var err error
+	if export != 0 {
+		if st.Export, err = read(export); err != nil {
+			return nil, err
+		}
+	}
+	for _, rva := range debug {
+		ts, err := read(rva)
+		if err != nil {
+			return nil, err
+		}
+		st.Debug = append(st.Debug, ts)
+	}
+	return st, nil
+}
+
+// stampRVAs returns the RVAs of the TimeDateStamp fields of the export
+// directory, or 0 if there is none, and of the debug directory entries.
+func (f *File) stampRVAs() (export uint32, debug []uint32) {
+	dd := f.dataDirectories()
+	// The TimeDateStamp is at offset 4 of the export directory and of
+	// each 28-byte IMAGE_DEBUG_DIRECTORY.
+	if len(dd) > IMAGE_DIRECTORY_ENTRY_EXPORT {
+		if d := dd[IMAGE_DIRECTORY_ENTRY_EXPORT]; d.Size >= 8 && f.sectionForRVA(d.VirtualAddress+4) != nil {
+			export = d.VirtualAddress + 4
+		}
+	}
+	if len(dd) > IMAGE_DIRECTORY_ENTRY_DEBUG {
+		d := dd[IMAGE_DIRECTORY_ENTRY_DEBUG]
+		for off := uint32(0); off+28 <= d.Size && d.VirtualAddress+off >= d.VirtualAddress; off += 28 {
+			if f.sectionForRVA(d.VirtualAddress+off+4) == nil {
+				break
+			}
+			debug = append(debug, d.VirtualAddress+off+4)
+		}
+	}
+	return export, debug
+}
+
+// BytesWithOptions returns the bytes of the PE file as Bytes does,
+// written as opts asks. The File itself is left as it was. A non-zero
+// CheckSum is recomputed when stamps are changed; a signature is not.
+func (f *File) BytesWithOptions(opts WriteOptions) ([]byte, error) {
+	out, err := f.Bytes()
+	if err != nil || !opts.Deterministic && opts.Stamps == nil {
+		return out, err
+	}
+	st := &Stamps{}
+	if opts.Stamps != nil {
+		st = opts.Stamps
+	}
+
+	// The headers of an image follow the DOS header, which gives their
+	// offset; object files start with the file header.
+	le := binary.LittleEndian
+	var fileHeader uint64
+	if len(out) >= 0x40 && le.Uint16(out) == 0x5a4d {
+		fileHeader = uint64(le.Uint32(out[0x3c:])) + 4
+	}
+	put := func(off uint64, v uint32) {
+		if off+4 <= uint64(len(out)) {
+			le.PutUint32(out[off:], v)
+		}
+	}
+	put(fileHeader+4, st.File)
+	export, debug := f.stampRVAs()
+	at := func(rva uint32) uint64 {
+		s := f.sectionForRVA(rva)
+		if s.Offset == 0 || rva-s.VirtualAddress+4 > s.Size {
+			return uint64(len(out)) // not in the raw data
+		}
+		return uint64(s.Offset) + uint64(rva-s.VirtualAddress)
+	}
+	if export != 0 {
+		put(at(export), st.Export)
+	}
+	for i, rva := range debug {
+		ts := uint32(0)
+		if i < len(st.Debug) {
+			ts = st.Debug[i]
+		}
+		put(at(rva), ts)
+	}
+
+	// The CheckSum comes 64 bytes into the optional header, in both
+	// PE32 and PE32+.
+	if sum := fileHeader + 20 + 64; f.OptionalHeader != nil && sum+4 <= uint64(len(out)) && le.Uint32(out[sum:]) != 0 {
+		le.PutUint32(out[sum:], imageCheckSum(out, sum))
+	}
+	return out, nil
+}
+
+// WriteFileWithOptions creates destFile and writes f to it as
+// BytesWithOptions does.
+func (f *File) WriteFileWithOptions(destFile string, opts WriteOptions) error {
+	w, err := os.Create(destFile)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	out, err := f.BytesWithOptions(opts)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// imageCheckSum returns the CheckSum of the image b, whose CheckSum field
+// is at off: the 16-bit one's complement sum of the image without that
+// field, plus its length.
+func imageCheckSum(b []byte, off uint64) uint32 {
+	var sum uint32
+	for i := uint64(0); i < uint64(len(b)); i += 2 {
+		if i == off || i == off+2 {
+			continue
+		}
+		w := uint32(b[i])
+		if i+1 < uint64(len(b)) {
+			w |= uint32(b[i+1]) << 8
+		}
+		sum += w
+		sum = sum&0xffff + sum>>16
+	}
+	return sum + uint32(len(b))
+}
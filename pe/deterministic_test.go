@@ -0,0 +1,115 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestDeterministic(t *testing.T) {
+	const file = "testdata/gcc-amd64-mingw-exec"
+	orig, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The CheckSum of the file, as written by the linker, is what
+	// imageCheckSum computes.
+	sum := uint64(binary.LittleEndian.Uint32(orig[0x3c:])) + 4 + 20 + 64
+	if want := binary.LittleEndian.Uint32(orig[sum:]); want == 0 || imageCheckSum(orig, sum) != want {
+		t.Fatalf("imageCheckSum = %#x, want %#x", imageCheckSum(orig, sum), want)
+	}
+
+	// open returns the file with the given link time and two debug
+	// directory entries stamped with it.
+	open := func(ts uint32) *File {
+		f, err := Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		debug := make([]byte, 2*28)
+		binary.LittleEndian.PutUint32(debug[4:], ts)
+		binary.LittleEndian.PutUint32(debug[28+4:], ts+1)
+		s, err := f.AddSection(".debug", debug, IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.dataDirectories()[IMAGE_DIRECTORY_ENTRY_DEBUG] = DataDirectory{VirtualAddress: s.VirtualAddress, Size: uint32(len(debug))}
+		f.FileHeader.TimeDateStamp = ts
+		return f
+	}
+	f1, f2 := open(0x5f000000), open(0x60000000)
+	defer f1.Close()
+	defer f2.Close()
+
+	st, err := f1.Stamps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&Stamps{File: 0x5f000000, Debug: []uint32{0x5f000000, 0x5f000001}}); !reflect.DeepEqual(st, want) {
+		t.Errorf("Stamps = %+v, want %+v", st, want)
+	}
+
+	b1, err := f1.BytesWithOptions(WriteOptions{Deterministic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := f2.BytesWithOptions(WriteOptions{Deterministic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b1, b2) {
+		t.Error("deterministic output depends on the link time")
+	}
+	g, err := NewFile(bytes.NewReader(b1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st, err := g.Stamps(); err != nil || !reflect.DeepEqual(st, &Stamps{Debug: []uint32{0, 0}}) {
+		t.Errorf("Stamps of the deterministic output = %+v, %v", st, err)
+	}
+	if f1.FileHeader.TimeDateStamp != 0x5f000000 {
+		t.Error("BytesWithOptions changed the File")
+	}
+	if got, want := g.checkSum(), imageCheckSum(b1, sum); got != want {
+		t.Errorf("CheckSum = %#x, want %#x", got, want)
+	}
+
+	// The stamps of a donor file are written as they are.
+	donor, err := f2.Stamps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := f1.BytesWithOptions(WriteOptions{Stamps: donor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err = NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st, err := g.Stamps(); err != nil || !reflect.DeepEqual(st, donor) {
+		t.Errorf("Stamps = %+v, %v; want those of the donor, %+v", st, err, donor)
+	}
+}
+
+func TestBaseRelocOrder(t *testing.T) {
+	relocs := func(rvas ...uint32) []BlockItem {
+		f, err := Open("testdata/gcc-amd64-mingw-exec")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		f.BaseRelocationTable = nil
+		for _, rva := range rvas {
+			if err := f.addBaseReloc(rva, IMAGE_REL_BASED_DIR64); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return (*f.BaseRelocationTable)[0].BlockItems
+	}
+	if a, b := relocs(0x1010, 0x1008, 0x1000), relocs(0x1000, 0x1010, 0x1008); !reflect.DeepEqual(a, b) {
+		t.Errorf("base relocations depend on the order they were added in: %v and %v", a, b)
+	}
+}
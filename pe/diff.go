@@ -0,0 +1,358 @@
+package pe
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Binject/debug/internal/diff"
+)
+
+// A FieldChange is a header field whose value differs between the two
+// files compared by Diff. Field is the name of the field in FileHeader
+// or, prefixed with "OptionalHeader.", in the optional header.
+type FieldChange = diff.FieldChange
+
+// A DirectoryChange is a data directory entry that differs. Entries that
+// one of the files does not have are zero.
+type DirectoryChange struct {
+	Index    int // IMAGE_DIRECTORY_ENTRY_*
+	Old, New DataDirectory
+}
+
+// A ByteRange is a run of bytes of a section that differs. Off is the
+// offset of the run in the raw data of both sections; a range that runs
+// past the end of one of them holds only the bytes it has.
+type ByteRange = diff.ByteRange
+
+// A SectionDiff describes a section that the two files both have, matched
+// by name, but with different headers or raw data. The hashes are the
+// SHA-256 of the raw data, in hex.
+type SectionDiff struct {
+	Name             string
+	OldHash, NewHash string
+	Header           []FieldChange
+	Ranges           []ByteRange
+}
+
+// An ExportChange is an export whose address or forwarder differs.
+type ExportChange struct {
+	Old, New Export
+}
+
+// A Changeset is the difference between two PE files computed by Diff.
+// Lists of names are sorted.
+type Changeset struct {
+	Header      []FieldChange
+	Directories []DirectoryChange
+
+	Sections        []SectionDiff
+	AddedSections   []string
+	RemovedSections []string
+
+	// Imports are named "symbol:dll", as returned by ImportedSymbols.
+	AddedImports   []string
+	RemovedImports []string
+
+	AddedExports   []Export
+	RemovedExports []Export
+	ChangedExports []ExportChange
+
+	// Resources are named by the path of their entry in the resource
+	// tree: type, name and language, each a name or a decimal id, as in
+	// "3/1/1033".
+	AddedResources   []string
+	RemovedResources []string
+	ChangedResources []string
+}
+
+// dataDirectoryNames names the IMAGE_DIRECTORY_ENTRY_* indices.
+var dataDirectoryNames = [...]string{
+	"export", "import", "resource", "exception", "security", "base relocation",
+	"debug", "architecture", "global pointer", "TLS", "load configuration",
+	"bound import", "IAT", "delay import", "COM descriptor", "reserved",
+}
+
+// String returns c as one line per change, for review.
+func (c *Changeset) String() string {
+	var b strings.Builder
+	for _, h := range c.Header {
+		fmt.Fprintf(&b, "header %v\n", h)
+	}
+	for _, d := range c.Directories {
+		name := fmt.Sprint(d.Index)
+		if d.Index < len(dataDirectoryNames) {
+			name = dataDirectoryNames[d.Index]
+		}
+		fmt.Fprintf(&b, "directory %s %#x+%#x -> %#x+%#x\n", name, d.Old.VirtualAddress, d.Old.Size, d.New.VirtualAddress, d.New.Size)
+	}
+	lines := func(prefix string, names []string) {
+		for _, n := range names {
+			fmt.Fprintf(&b, "%s %s\n", prefix, n)
+		}
+	}
+	lines("- section", c.RemovedSections)
+	lines("+ section", c.AddedSections)
+	for _, s := range c.Sections {
+		fmt.Fprintf(&b, "section %s %s -> %s\n", s.Name, s.OldHash, s.NewHash)
+		for _, h := range s.Header {
+			fmt.Fprintf(&b, "section %s %v\n", s.Name, h)
+		}
+		for _, r := range s.Ranges {
+			fmt.Fprintf(&b, "section %s bytes %#x: %d -> %d\n", s.Name, r.Off, len(r.Old), len(r.New))
+		}
+	}
+	lines("- import", c.RemovedImports)
+	lines("+ import", c.AddedImports)
+	for _, e := range c.RemovedExports {
+		fmt.Fprintf(&b, "- export %s\n", exportKey(e))
+	}
+	for _, e := range c.AddedExports {
+		fmt.Fprintf(&b, "+ export %s\n", exportKey(e))
+	}
+	for _, e := range c.ChangedExports {
+		fmt.Fprintf(&b, "export %s %#x%s -> %#x%s\n", exportKey(e.New), e.Old.VirtualAddress, forwardSuffix(e.Old), e.New.VirtualAddress, forwardSuffix(e.New))
+	}
+	lines("- resource", c.RemovedResources)
+	lines("+ resource", c.AddedResources)
+	lines("resource", c.ChangedResources)
+	return b.String()
+}
+
+func forwardSuffix(e Export) string {
+	if e.Forward == "" {
+		return ""
+	}
+	return " (" + e.Forward + ")"
+}
+
+// exportKey identifies e by name or, if it has none, by ordinal.
+func exportKey(e Export) string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return fmt.Sprintf("#%d", e.Ordinal)
+}
+
+// Diff compares the PE files a and b. Sections are matched by name, the
+// n-th section called a name in a with the n-th one in b.
+func Diff(a, b *File) (*Changeset, error) {
+	c := &Changeset{}
+	c.Header = diff.Fields("", &a.FileHeader, &b.FileHeader)
+	switch {
+	case a.OptionalHeader == nil || b.OptionalHeader == nil:
+	case reflect.TypeOf(a.OptionalHeader) != reflect.TypeOf(b.OptionalHeader):
+		c.Header = append(c.Header, FieldChange{Field: "OptionalHeader.Magic", Old: fieldValue(a.OptionalHeader, "Magic"), New: fieldValue(b.OptionalHeader, "Magic")})
+	default:
+		c.Header = append(c.Header, diff.Fields("OptionalHeader.", a.OptionalHeader, b.OptionalHeader)...)
+	}
+
+	ad, bd := a.dataDirectories(), b.dataDirectories()
+	for i := 0; i < len(ad) || i < len(bd); i++ {
+		var o, n DataDirectory
+		if i < len(ad) {
+			o = ad[i]
+		}
+		if i < len(bd) {
+			n = bd[i]
+		}
+		if o != n {
+			c.Directories = append(c.Directories, DirectoryChange{i, o, n})
+		}
+	}
+
+	if err := c.diffSections(a, b); err != nil {
+		return nil, err
+	}
+	if err := c.diffImports(a, b); err != nil {
+		return nil, err
+	}
+	if err := c.diffExports(a, b); err != nil {
+		return nil, err
+	}
+	if err := c.diffResources(a, b); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Changeset) diffSections(a, b *File) error {
+	byName := make(map[string][]*Section)
+	for _, s := range a.Sections {
+		byName[s.Name] = append(byName[s.Name], s)
+	}
+	seen := make(map[string]int)
+	for _, s := range b.Sections {
+		n := seen[s.Name]
+		seen[s.Name]++
+		if n >= len(byName[s.Name]) {
+			c.AddedSections = append(c.AddedSections, s.Name)
+			continue
+		}
+		t := byName[s.Name][n]
+		old, err := t.Data()
+		if err != nil {
+			return fmt.Errorf("section %s: %v", t.Name, err)
+		}
+		data, err := s.Data()
+		if err != nil {
+			return fmt.Errorf("section %s: %v", s.Name, err)
+		}
+		header := diff.Fields("", &t.SectionHeader, &s.SectionHeader)
+		if len(header) == 0 && bytes.Equal(old, data) {
+			continue
+		}
+		oh, nh := sha256.Sum256(old), sha256.Sum256(data)
+		c.Sections = append(c.Sections, SectionDiff{
+			Name:    s.Name,
+			OldHash: hex.EncodeToString(oh[:]),
+			NewHash: hex.EncodeToString(nh[:]),
+			Header:  header,
+			Ranges:  diff.Bytes(old, data),
+		})
+	}
+	for name, list := range byName {
+		for i := seen[name]; i < len(list); i++ {
+			c.RemovedSections = append(c.RemovedSections, name)
+		}
+	}
+	sort.Strings(c.AddedSections)
+	sort.Strings(c.RemovedSections)
+	return nil
+}
+
+func (c *Changeset) diffImports(a, b *File) error {
+	ai, err := a.ImportedSymbols()
+	if err != nil {
+		return fmt.Errorf("imports: %v", err)
+	}
+	bi, err := b.ImportedSymbols()
+	if err != nil {
+		return fmt.Errorf("imports: %v", err)
+	}
+	c.AddedImports, c.RemovedImports = diffStrings(ai, bi)
+	return nil
+}
+
+func (c *Changeset) diffExports(a, b *File) error {
+	ae, err := a.Exports()
+	if err != nil {
+		return fmt.Errorf("exports: %v", err)
+	}
+	be, err := b.Exports()
+	if err != nil {
+		return fmt.Errorf("exports: %v", err)
+	}
+	old := make(map[string]Export)
+	for _, e := range ae {
+		old[exportKey(e)] = e
+	}
+	for _, e := range be {
+		k := exportKey(e)
+		o, ok := old[k]
+		switch {
+		case !ok:
+			c.AddedExports = append(c.AddedExports, e)
+		case o.VirtualAddress != e.VirtualAddress || o.Forward != e.Forward:
+			c.ChangedExports = append(c.ChangedExports, ExportChange{o, e})
+		}
+		delete(old, k)
+	}
+	for _, e := range old {
+		c.RemovedExports = append(c.RemovedExports, e)
+	}
+	for _, list := range [][]Export{c.AddedExports, c.RemovedExports} {
+		sort.Slice(list, func(i, j int) bool { return exportKey(list[i]) < exportKey(list[j]) })
+	}
+	sort.Slice(c.ChangedExports, func(i, j int) bool {
+		return exportKey(c.ChangedExports[i].New) < exportKey(c.ChangedExports[j].New)
+	})
+	return nil
+}
+
+func (c *Changeset) diffResources(a, b *File) error {
+	ar, err := a.resources()
+	if err != nil {
+		return fmt.Errorf("resources: %v", err)
+	}
+	br, err := b.resources()
+	if err != nil {
+		return fmt.Errorf("resources: %v", err)
+	}
+	old, new := make(map[string]*resourceData), make(map[string]*resourceData)
+	ar.leaves("", old)
+	br.leaves("", new)
+	for path, d := range new {
+		switch o, ok := old[path]; {
+		case !ok:
+			c.AddedResources = append(c.AddedResources, path)
+		case o.codePage != d.codePage || !bytes.Equal(o.data, d.data):
+			c.ChangedResources = append(c.ChangedResources, path)
+		}
+	}
+	for path := range old {
+		if _, ok := new[path]; !ok {
+			c.RemovedResources = append(c.RemovedResources, path)
+		}
+	}
+	sort.Strings(c.AddedResources)
+	sort.Strings(c.RemovedResources)
+	sort.Strings(c.ChangedResources)
+	return nil
+}
+
+// leaves adds the resources under d to m, keyed by their path below
+// prefix.
+func (d *resourceDir) leaves(prefix string, m map[string]*resourceData) {
+	if d == nil {
+		return
+	}
+	for _, e := range d.entries {
+		name := e.name
+		if name == "" {
+			name = fmt.Sprint(e.id)
+		}
+		if prefix != "" {
+			name = prefix + "/" + name
+		}
+		if e.data != nil {
+			m[name] = e.data
+		}
+		e.dir.leaves(name, m)
+	}
+}
+
+// diffStrings returns the strings of b that a does not have and those
+// of a that b does not have, counting repeated strings, sorted.
+func diffStrings(a, b []string) (added, removed []string) {
+	count := make(map[string]int)
+	for _, s := range a {
+		count[s]++
+	}
+	for _, s := range b {
+		if count[s] > 0 {
+			count[s]--
+		} else {
+			added = append(added, s)
+		}
+	}
+	for _, s := range a {
+		if count[s] > 0 {
+			count[s]--
+			removed = append(removed, s)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// fieldValue returns the named unsigned field of the struct hdr points
+// to.
+func fieldValue(hdr interface{}, name string) uint64 {
+	return reflect.ValueOf(hdr).Elem().FieldByName(name).Uint()
+}
@@ -0,0 +1,86 @@
+package pe
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	text := b.Section(".text")
+	data, err := text.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[0x10], data[0x11] = 0xcc, 0xcc
+	text.Replace(bytes.NewReader(data), int64(len(data)))
+	addExports(t, b, []string{"alpha", "beta"})
+	icon := &resourceDir{entries: []*resourceEntry{
+		{id: RT_ICON, dir: &resourceDir{entries: []*resourceEntry{
+			{id: 1, dir: &resourceDir{entries: []*resourceEntry{
+				{id: 0x409, data: &resourceData{data: []byte("icon"), codePage: 1252}},
+			}}},
+		}}},
+	}}
+	if err := b.setResources(icon); err != nil {
+		t.Fatal(err)
+	}
+	b = reparse(t, b)
+
+	c, err := Diff(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Header) == 0 || c.Header[0].Field != "NumberOfSections" {
+		t.Errorf("header changes are %v, want NumberOfSections first", c.Header)
+	}
+	var dirs []int
+	for _, d := range c.Directories {
+		dirs = append(dirs, d.Index)
+	}
+	if len(dirs) < 2 || dirs[0] != IMAGE_DIRECTORY_ENTRY_EXPORT || dirs[1] != IMAGE_DIRECTORY_ENTRY_RESOURCE {
+		t.Errorf("changed directories are %v, want the export and resource directories first", dirs)
+	}
+	if len(c.AddedSections) == 0 || c.AddedSections[0] != ".edata" || len(c.RemovedSections) != 0 {
+		t.Errorf("sections added %q and removed %q", c.AddedSections, c.RemovedSections)
+	}
+	var textDiff *SectionDiff
+	for i := range c.Sections {
+		if c.Sections[i].Name == ".text" {
+			textDiff = &c.Sections[i]
+		}
+	}
+	if textDiff == nil || textDiff.OldHash == textDiff.NewHash || len(textDiff.Ranges) != 1 ||
+		textDiff.Ranges[0].Off != 0x10 || !bytes.Equal(textDiff.Ranges[0].New, []byte{0xcc, 0xcc}) {
+		t.Errorf(".text changes are %+v, want the 2 bytes at 0x10", textDiff)
+	}
+	var exports []string
+	for _, e := range c.AddedExports {
+		exports = append(exports, exportKey(e))
+	}
+	if want := []string{"#3", "alpha", "beta"}; !reflect.DeepEqual(exports, want) {
+		t.Errorf("added exports are %q, want %q", exports, want)
+	}
+	if want := []string{"3/1/1033"}; !reflect.DeepEqual(c.AddedResources, want) || len(c.AddedImports)+len(c.RemovedImports) != 0 {
+		t.Errorf("resources added %q; imports added %q and removed %q", c.AddedResources, c.AddedImports, c.RemovedImports)
+	}
+	if s := c.String(); !strings.Contains(s, "+ export alpha\n") || !strings.Contains(s, "section .text bytes 0x10: 2 -> 2\n") {
+		t.Errorf("changeset prints as\n%s", s)
+	}
+
+	if c, err := Diff(a, a); err != nil || c.String() != "" {
+		t.Errorf("Diff of a file with itself = %v, %v", c, err)
+	}
+}
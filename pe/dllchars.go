@@ -0,0 +1,133 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// DLL characteristics that depend on other parts of the image.
+const (
+	IMAGE_DLLCHARACTERISTICS_HIGH_ENTROPY_VA = 0x0020 // Image can use a 64-bit address space under ASLR
+	IMAGE_DLLCHARACTERISTICS_GUARD_CF        = 0x4000 // Image supports Control Flow Guard
+)
+
+// GuardFlags of the load configuration.
+const (
+	IMAGE_GUARD_CF_INSTRUMENTED           = 0x00000100 // Module performs control flow integrity checks
+	IMAGE_GUARD_CFW_INSTRUMENTED          = 0x00000200 // Module performs control flow and write integrity checks
+	IMAGE_GUARD_CF_FUNCTION_TABLE_PRESENT = 0x00000400 // Module has a valid call target table
+)
+
+// loadConfigGuardFlags returns the offset of GuardFlags in the load
+// configuration directory of f, which ends 4 bytes after it.
+func (f *File) loadConfigGuardFlags() uint32 {
+	if _, ok := f.OptionalHeader.(*OptionalHeader64); ok {
+		return 144
+	}
+	return 88
+}
+
+// setDllCharacteristics sets the bits of set and clears those of clear in
+// DllCharacteristics. A change invalidates the Authenticode signature,
+// which covers the field, so the certificate table is then removed.
+func (f *File) setDllCharacteristics(set, clear uint16) error {
+	chars := f.dllCharacteristics()
+	if chars == nil {
+		return errors.New("cannot set the DLL characteristics of a file without an optional header")
+	}
+	if flags := *chars&^clear | set; flags != *chars {
+		*chars = flags
+		f.CertificateTable = nil
+	}
+	return nil
+}
+
+// SetDynamicBase sets or clears IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE,
+// which lets the loader rebase the image at a random address. An image
+// can only be rebased with base relocations, so setting it fails for an
+// image without them or with IMAGE_FILE_RELOCS_STRIPPED. Clearing it also
+// clears HIGH_ENTROPY_VA and GUARD_CF, which need ASLR; the load
+// configuration is updated as by SetCFG(false).
+//
+// Like SetForceIntegrity, a change removes the signature of f.
+func (f *File) SetDynamicBase(on bool) error {
+	if !on {
+		if err := f.SetCFG(false); err != nil {
+			return err
+		}
+		return f.setDllCharacteristics(0, IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE|IMAGE_DLLCHARACTERISTICS_HIGH_ENTROPY_VA)
+	}
+	if !f.relocatable() {
+		return errors.New("image without base relocations cannot be rebased")
+	}
+	return f.setDllCharacteristics(IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE, 0)
+}
+
+// SetNXCompat sets or clears IMAGE_DLLCHARACTERISTICS_NX_COMPAT, which
+// makes the data of the process non-executable. Code injected into a
+// section without IMAGE_SCN_MEM_EXECUTE only runs with it cleared.
+//
+// Like SetForceIntegrity, a change removes the signature of f.
+func (f *File) SetNXCompat(on bool) error {
+	if on {
+		return f.setDllCharacteristics(IMAGE_DLLCHARACTERISTICS_NX_COMPAT, 0)
+	}
+	return f.setDllCharacteristics(0, IMAGE_DLLCHARACTERISTICS_NX_COMPAT)
+}
+
+// SetCFG sets or clears IMAGE_DLLCHARACTERISTICS_GUARD_CF, which enables
+// Control Flow Guard, so that indirect calls only reach the functions of
+// the GuardCFFunctionTable of the load configuration.
+//
+// Enabling it needs an image built for it: one with DYNAMIC_BASE and a
+// load configuration whose GuardFlags have IMAGE_GUARD_CF_INSTRUMENTED.
+// Disabling it also clears the CF instrumentation and function table
+// flags of GuardFlags, as a linker does without /guard:cf, so that tools
+// reading the load configuration agree with the header; this is what
+// injected code that is called indirectly but is missing from the table
+// needs. The instrumented checks then go through the default check
+// function, which accepts every target.
+//
+// Like SetForceIntegrity, a change of the header or of the load
+// configuration removes the signature of f.
+func (f *File) SetCFG(on bool) error {
+	if f.dllCharacteristics() == nil {
+		return errors.New("cannot set the DLL characteristics of a file without an optional header")
+	}
+	s, data, off, err := f.loadConfigSection()
+	if err != nil {
+		return err
+	}
+	flagsOff := f.loadConfigGuardFlags()
+	hasFlags := s != nil && binary.LittleEndian.Uint32(data[off:]) >= flagsOff+4
+	if on {
+		if *f.dllCharacteristics()&IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE == 0 {
+			return errors.New("CFG needs IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE")
+		}
+		if !hasFlags {
+			return errors.New("image has no load configuration with GuardFlags")
+		}
+		if flags := binary.LittleEndian.Uint32(data[off+flagsOff:]); flags&IMAGE_GUARD_CF_INSTRUMENTED == 0 {
+			return fmt.Errorf("GuardFlags %#x do not have IMAGE_GUARD_CF_INSTRUMENTED", flags)
+		}
+		return f.setDllCharacteristics(IMAGE_DLLCHARACTERISTICS_GUARD_CF, 0)
+	}
+
+	if err := f.setDllCharacteristics(0, IMAGE_DLLCHARACTERISTICS_GUARD_CF); err != nil {
+		return err
+	}
+	if !hasFlags {
+		return nil
+	}
+	const cfFlags = IMAGE_GUARD_CF_INSTRUMENTED | IMAGE_GUARD_CFW_INSTRUMENTED | IMAGE_GUARD_CF_FUNCTION_TABLE_PRESENT
+	flags := binary.LittleEndian.Uint32(data[off+flagsOff:])
+	if flags&cfFlags == 0 {
+		return nil
+	}
+	binary.LittleEndian.PutUint32(data[off+flagsOff:], flags&^cfFlags)
+	s.Replace(bytes.NewReader(data), int64(len(data)))
+	f.CertificateTable = nil
+	return nil
+}
@@ -0,0 +1,107 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// addGuardLoadConfig gives a 64-bit f a load configuration that ends
+// with GuardFlags set to flags.
+func addGuardLoadConfig(t *testing.T, f *File, flags uint32) *Section {
+	t.Helper()
+	off := f.loadConfigGuardFlags()
+	data := make([]byte, off+4)
+	binary.LittleEndian.PutUint32(data, off+4)
+	binary.LittleEndian.PutUint32(data[off:], flags)
+	s, err := f.AddSection(".lcfg", data, IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.dataDirectories()[IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG] = DataDirectory{VirtualAddress: s.VirtualAddress, Size: off + 4}
+	return s
+}
+
+func TestSetDllCharacteristics(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	oh := f.OptionalHeader.(*OptionalHeader64)
+	oh.DllCharacteristics = 0
+	f.BaseRelocationTable = nil
+
+	if err := f.SetDynamicBase(true); err == nil {
+		t.Error("SetDynamicBase set ASLR on an image without base relocations")
+	}
+	if err := f.AddBaseReloc(f.Sections[0].VirtualAddress, IMAGE_REL_BASED_DIR64); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetDynamicBase(true); err == nil {
+		t.Error("SetDynamicBase set ASLR with IMAGE_FILE_RELOCS_STRIPPED")
+	}
+	f.FileHeader.Characteristics &^= IMAGE_FILE_RELOCS_STRIPPED
+	if err := f.SetDynamicBase(true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.SetCFG(true); err == nil {
+		t.Error("SetCFG enabled CFG without a load configuration")
+	}
+	addGuardLoadConfig(t, f, 0)
+	if err := f.SetCFG(true); err == nil {
+		t.Error("SetCFG enabled CFG for an image that is not instrumented")
+	}
+	const guard = IMAGE_GUARD_CF_INSTRUMENTED | IMAGE_GUARD_CF_FUNCTION_TABLE_PRESENT | 0x10000000
+	s := addGuardLoadConfig(t, f, guard)
+	if err := f.SetCFG(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetNXCompat(true); err != nil {
+		t.Fatal(err)
+	}
+	oh.DllCharacteristics |= IMAGE_DLLCHARACTERISTICS_HIGH_ENTROPY_VA
+	want := uint16(IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE | IMAGE_DLLCHARACTERISTICS_HIGH_ENTROPY_VA |
+		IMAGE_DLLCHARACTERISTICS_GUARD_CF | IMAGE_DLLCHARACTERISTICS_NX_COMPAT)
+	if oh.DllCharacteristics != want {
+		t.Errorf("DllCharacteristics is %#x, want %#x", oh.DllCharacteristics, want)
+	}
+
+	// A signature survives flags set to their current values.
+	cert := []byte{8, 0, 0, 0, 0, 2, 2, 0}
+	f.CertificateTable = cert
+	if err := f.SetNXCompat(true); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.CertificateTable, cert) {
+		t.Error("signature removed although the flags did not change")
+	}
+
+	// Clearing ASLR clears what needs it, including the CF flags of the
+	// load configuration, and keeps the other guard flags.
+	if err := f.SetDynamicBase(false); err != nil {
+		t.Fatal(err)
+	}
+	if f.CertificateTable != nil {
+		t.Error("signature kept after the flags changed")
+	}
+	g := reparse(t, f)
+	if chars := g.OptionalHeader.(*OptionalHeader64).DllCharacteristics; chars != IMAGE_DLLCHARACTERISTICS_NX_COMPAT {
+		t.Errorf("DllCharacteristics is %#x after clearing DYNAMIC_BASE", chars)
+	}
+	data, err := g.sectionForRVA(s.VirtualAddress).Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags := binary.LittleEndian.Uint32(data[g.loadConfigGuardFlags():]); flags != 0x10000000 {
+		t.Errorf("GuardFlags are %#x after disabling CFG", flags)
+	}
+
+	if err := g.SetNXCompat(false); err != nil {
+		t.Fatal(err)
+	}
+	if chars := g.OptionalHeader.(*OptionalHeader64).DllCharacteristics; chars != 0 {
+		t.Errorf("DllCharacteristics is %#x after clearing NX_COMPAT", chars)
+	}
+}
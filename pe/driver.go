@@ -0,0 +1,174 @@
+package pe
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// kernelModules are the images that export the kernel and HAL APIs.
+var kernelModules = map[string]bool{
+	"ntoskrnl.exe": true,
+	"ntkrnlpa.exe": true,
+	"ntkrnlmp.exe": true,
+	"ntkrpamp.exe": true,
+	"hal.dll":      true,
+}
+
+// userModules are user-mode libraries that the kernel cannot load.
+var userModules = map[string]bool{
+	"ntdll.dll":      true,
+	"kernel32.dll":   true,
+	"kernelbase.dll": true,
+	"user32.dll":     true,
+	"gdi32.dll":      true,
+	"advapi32.dll":   true,
+	"msvcrt.dll":     true,
+	"ucrtbase.dll":   true,
+	"ws2_32.dll":     true,
+}
+
+// Subsystem returns the Subsystem field of the optional header, or
+// IMAGE_SUBSYSTEM_UNKNOWN if f has no optional header.
+func (f *File) Subsystem() uint16 {
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		return oh.Subsystem
+	case *OptionalHeader64:
+		return oh.Subsystem
+	}
+	return IMAGE_SUBSYSTEM_UNKNOWN
+}
+
+// dllCharacteristics returns a pointer to the DllCharacteristics field of
+// the optional header, or nil if f has no optional header.
+func (f *File) dllCharacteristics() *uint16 {
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		return &oh.DllCharacteristics
+	case *OptionalHeader64:
+		return &oh.DllCharacteristics
+	}
+	return nil
+}
+
+// checkSum returns the CheckSum field of the optional header.
+func (f *File) checkSum() uint32 {
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		return oh.CheckSum
+	case *OptionalHeader64:
+		return oh.CheckSum
+	}
+	return 0
+}
+
+// IsDriver reports whether f is a kernel-mode driver: a native image that
+// imports from ntoskrnl.exe or hal.dll.
+func (f *File) IsDriver() bool {
+	if f.Subsystem() != IMAGE_SUBSYSTEM_NATIVE {
+		return false
+	}
+	libs, err := f.ImportedLibraries()
+	if err != nil {
+		return false
+	}
+	for _, lib := range libs {
+		if kernelModules[strings.ToLower(lib)] {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateDriver checks f against the conventions of kernel-mode drivers:
+// the native subsystem, imports from the kernel rather than from user-mode
+// libraries, a discardable INIT section and non-discardable PAGE sections,
+// a non-zero checksum, and a signature when integrity checks are forced or
+// the image is 64-bit. It complements Validate, which checks the structure
+// common to all images.
+func (f *File) ValidateDriver() []Issue {
+	var issues []Issue
+	report := func(sev Severity, format string, args ...interface{}) {
+		issues = append(issues, Issue{sev, fmt.Sprintf(format, args...)})
+	}
+
+	chars := f.dllCharacteristics()
+	if chars == nil {
+		report(SeverityError, "driver has no optional header")
+		return issues
+	}
+	if s := f.Subsystem(); s != IMAGE_SUBSYSTEM_NATIVE {
+		report(SeverityError, "Subsystem is %d, not IMAGE_SUBSYSTEM_NATIVE", s)
+	}
+
+	libs, err := f.ImportedLibraries()
+	if err != nil {
+		report(SeverityError, "cannot read the imports: %v", err)
+	}
+	var kernel bool
+	for _, lib := range libs {
+		name := strings.ToLower(lib)
+		switch {
+		case kernelModules[name]:
+			kernel = true
+		case userModules[name]:
+			report(SeverityError, "driver imports the user-mode library %s", lib)
+		}
+	}
+	if err == nil && !kernel {
+		report(SeverityWarning, "driver imports neither ntoskrnl.exe nor hal.dll")
+	}
+
+	for _, s := range f.Sections {
+		switch {
+		case s.Name == "INIT":
+			if s.Characteristics&IMAGE_SCN_MEM_DISCARDABLE == 0 {
+				report(SeverityWarning, "section INIT is not discardable")
+			}
+		case strings.HasPrefix(s.Name, "PAGE"):
+			if s.Characteristics&IMAGE_SCN_MEM_DISCARDABLE != 0 {
+				report(SeverityError, "section %q is pageable but discardable", s.Name)
+			}
+			if s.Characteristics&IMAGE_SCN_MEM_NOT_PAGED != 0 {
+				report(SeverityWarning, "section %q is marked as not paged", s.Name)
+			}
+		}
+	}
+
+	if f.checkSum() == 0 {
+		report(SeverityWarning, "CheckSum is zero, but the kernel verifies the checksum of drivers")
+	}
+	signed := len(f.CertificateTable) > 0
+	switch {
+	case *chars&IMAGE_DLLCHARACTERISTICS_FORCE_INTEGRITY != 0 && !signed:
+		report(SeverityError, "IMAGE_DLLCHARACTERISTICS_FORCE_INTEGRITY is set, but the image is not signed")
+	case !signed && (f.Machine == IMAGE_FILE_MACHINE_AMD64 || f.Machine == IMAGE_FILE_MACHINE_ARM64):
+		report(SeverityWarning, "64-bit driver is not signed")
+	}
+	return issues
+}
+
+// SetForceIntegrity sets or clears IMAGE_DLLCHARACTERISTICS_FORCE_INTEGRITY,
+// which makes the loader refuse the image unless its signature verifies.
+//
+// DllCharacteristics is covered by the Authenticode hash, so changing the
+// flag invalidates any signature of f. SetForceIntegrity removes such a
+// signature, and the image has to be signed again, which also updates the
+// checksum. The signature is kept when the flag already has the requested
+// value.
+func (f *File) SetForceIntegrity(on bool) error {
+	chars := f.dllCharacteristics()
+	if chars == nil {
+		return errors.New("cannot set the integrity flag of a file without an optional header")
+	}
+	flags := *chars &^ IMAGE_DLLCHARACTERISTICS_FORCE_INTEGRITY
+	if on {
+		flags |= IMAGE_DLLCHARACTERISTICS_FORCE_INTEGRITY
+	}
+	if flags != *chars {
+		*chars = flags
+		f.CertificateTable = nil
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package pe
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// findIssue reports whether issues has one of severity sev whose message
+// contains substr.
+func findIssue(issues []Issue, sev Severity, substr string) bool {
+	for _, issue := range issues {
+		if issue.Severity == sev && strings.Contains(issue.Msg, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// makeDriver turns a MinGW executable into a native image that imports
+// from ntoskrnl.exe and hal.dll instead of KERNEL32.dll and msvcrt.dll.
+func makeDriver(t *testing.T, f *File) {
+	f.OptionalHeader.(*OptionalHeader64).Subsystem = IMAGE_SUBSYSTEM_NATIVE
+	f.OptionalHeader.(*OptionalHeader64).CheckSum = 0x1234
+	s := f.Section(".idata")
+	data, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte("KERNEL32.dll\x00"), []byte("ntoskrnl.exe\x00"), 1)
+	data = bytes.Replace(data, []byte("msvcrt.dll\x00"), []byte("hal.dll\x00\x00\x00\x00"), 1)
+	s.Replace(bytes.NewReader(data), int64(len(data)))
+}
+
+func TestValidateDriver(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if f.IsDriver() {
+		t.Error("IsDriver returned true for a console executable")
+	}
+	issues := f.ValidateDriver()
+	for _, want := range []struct {
+		sev    Severity
+		substr string
+	}{
+		{SeverityError, "IMAGE_SUBSYSTEM_NATIVE"},
+		{SeverityError, "KERNEL32.dll"},
+		{SeverityError, "msvcrt.dll"},
+		{SeverityWarning, "neither ntoskrnl.exe nor hal.dll"},
+	} {
+		if !findIssue(issues, want.sev, want.substr) {
+			t.Errorf("%v issue about %s not reported", want.sev, want.substr)
+		}
+	}
+
+	makeDriver(t, f)
+	if !f.IsDriver() {
+		t.Error("IsDriver returned false for a native image importing ntoskrnl.exe")
+	}
+	issues = f.ValidateDriver()
+	if len(issues) != 1 || !findIssue(issues, SeverityWarning, "not signed") {
+		t.Errorf("unsigned driver has issues %v, want one about the missing signature", issues)
+	}
+
+	if _, err := f.AddSection("INIT", []byte{0xc3}, IMAGE_SCN_CNT_CODE|IMAGE_SCN_MEM_EXECUTE|IMAGE_SCN_MEM_READ); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.AddSection("PAGE", []byte{0xc3}, IMAGE_SCN_CNT_CODE|IMAGE_SCN_MEM_EXECUTE|IMAGE_SCN_MEM_READ|IMAGE_SCN_MEM_DISCARDABLE); err != nil {
+		t.Fatal(err)
+	}
+	issues = f.ValidateDriver()
+	if !findIssue(issues, SeverityWarning, "INIT is not discardable") {
+		t.Error("non-discardable INIT section not reported")
+	}
+	if !findIssue(issues, SeverityError, `"PAGE" is pageable but discardable`) {
+		t.Error("discardable PAGE section not reported")
+	}
+}
+
+func TestSetForceIntegrity(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	makeDriver(t, f)
+
+	// A signature that matches the current flags survives setting them
+	// to the same value, and is dropped when they change.
+	cert := []byte{8, 0, 0, 0, 0, 2, 2, 0}
+	f.CertificateTable = cert
+	if err := f.SetForceIntegrity(false); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.CertificateTable, cert) {
+		t.Error("signature removed although the flag did not change")
+	}
+	if err := f.SetForceIntegrity(true); err != nil {
+		t.Fatal(err)
+	}
+	if f.CertificateTable != nil {
+		t.Error("signature kept after the flag changed")
+	}
+	if !findIssue(f.ValidateDriver(), SeverityError, "FORCE_INTEGRITY") {
+		t.Error("forced integrity checks without a signature not reported")
+	}
+
+	g := reparse(t, f)
+	oh := g.OptionalHeader.(*OptionalHeader64)
+	if oh.DllCharacteristics&IMAGE_DLLCHARACTERISTICS_FORCE_INTEGRITY == 0 {
+		t.Errorf("DllCharacteristics is %#x after writing", oh.DllCharacteristics)
+	}
+	if dd := oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_SECURITY]; dd.VirtualAddress != 0 || dd.Size != 0 {
+		t.Errorf("certificate table directory is %+v after removing the signature", dd)
+	}
+
+	if err := g.SetForceIntegrity(false); err != nil {
+		t.Fatal(err)
+	}
+	if oh.DllCharacteristics&IMAGE_DLLCHARACTERISTICS_FORCE_INTEGRITY != 0 {
+		t.Error("flag not cleared")
+	}
+}
@@ -2,6 +2,7 @@ package pe
 
 import (
 	"encoding/binary"
+	"fmt"
 )
 
 // ExportDirectory - data directory definition for exported functions
@@ -31,39 +32,9 @@ type Export struct {
 
 // Exports - gets exports
 func (f *File) Exports() ([]Export, error) {
-	pe64 := f.Machine == IMAGE_FILE_MACHINE_AMD64
-
-	// grab the number of data directory entries
-	var ddLength uint32
-	if pe64 {
-		ddLength = f.OptionalHeader.(*OptionalHeader64).NumberOfRvaAndSizes
-	} else {
-		ddLength = f.OptionalHeader.(*OptionalHeader32).NumberOfRvaAndSizes
-	}
-
-	// check that the length of data directory entries is large
-	// enough to include the exports directory.
-	if ddLength < IMAGE_DIRECTORY_ENTRY_EXPORT+1 {
-		return nil, nil
-	}
-
-	// grab the export data directory entry
-	var edd DataDirectory
-	if pe64 {
-		edd = f.OptionalHeader.(*OptionalHeader64).DataDirectory[IMAGE_DIRECTORY_ENTRY_EXPORT]
-	} else {
-		edd = f.OptionalHeader.(*OptionalHeader32).DataDirectory[IMAGE_DIRECTORY_ENTRY_EXPORT]
-	}
-
-	// figure out which section contains the export directory table
-	var ds *Section
-	ds = nil
-	for _, s := range f.Sections {
-		if s.VirtualAddress <= edd.VirtualAddress && edd.VirtualAddress < s.VirtualAddress+s.VirtualSize {
-			ds = s
-			break
-		}
-	}
+	// grab the export data directory entry, and the section that
+	// contains the export directory table
+	ds, edd := f.sectionFromDirectoryEntry(IMAGE_DIRECTORY_ENTRY_EXPORT)
 
 	// didn't find a section, so no exports were found
 	if ds == nil {
@@ -75,10 +46,21 @@ func (f *File) Exports() ([]Export, error) {
 		return nil, err
 	}
 
-	exportDirOffset := edd.VirtualAddress - ds.VirtualAddress
+	// table returns the n entries of size bytes at rva in d, or nil if
+	// they are not all in d.
+	table := func(rva, n, size uint32) []byte {
+		off := uint64(rva - ds.VirtualAddress)
+		if rva < ds.VirtualAddress || off+uint64(n)*uint64(size) > uint64(len(d)) {
+			return nil
+		}
+		return d[off:]
+	}
 
 	// seek to the virtual address specified in the export data directory
-	dxd := d[exportDirOffset:]
+	dxd := table(edd.VirtualAddress, 1, 40)
+	if dxd == nil {
+		return nil, fmt.Errorf("export directory at RVA %#x is past the raw data of section %q", edd.VirtualAddress, ds.Name)
+	}
 
 	// deserialize export directory
 	var dt ExportDirectory
@@ -99,9 +81,12 @@ func (f *File) Exports() ([]Export, error) {
 	ordinalTable := make(map[uint16]uint32)
 	if dt.OrdinalTableAddr > ds.VirtualAddress && dt.NameTableAddr > ds.VirtualAddress {
 		// seek to ordinal table
-		dno := d[dt.OrdinalTableAddr-ds.VirtualAddress:]
+		dno := table(dt.OrdinalTableAddr, dt.NumberOfNames, 2)
 		// seek to names table
-		dnn := d[dt.NameTableAddr-ds.VirtualAddress:]
+		dnn := table(dt.NameTableAddr, dt.NumberOfNames, 4)
+		if dno == nil || dnn == nil {
+			return nil, fmt.Errorf("export name tables of %d names are past the raw data of section %q", dt.NumberOfNames, ds.Name)
+		}
 
 		// build whole ordinal->name table
 		for n := uint32(0); n < dt.NumberOfNames; n++ {
@@ -114,8 +99,10 @@ func (f *File) Exports() ([]Export, error) {
 	}
 
 	// seek to ordinal table
-	dna := d[dt.AddressTableAddr-ds.VirtualAddress:]
-
+	dna := table(dt.AddressTableAddr, dt.NumberOfFunctions, 4)
+	if dna == nil {
+		return nil, fmt.Errorf("export address table of %d functions is past the raw data of section %q", dt.NumberOfFunctions, ds.Name)
+	}
 	var exports []Export
 	for i := uint32(0); i < dt.NumberOfFunctions; i++ {
 		var export Export
@@ -0,0 +1,209 @@
+package pe
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// A RuntimeFunction is an entry of the function table of an x64 image,
+// the contents of its exception directory, which gives the bounds and the
+// unwind information of a function. Addresses are RVAs.
+type RuntimeFunction struct {
+	BeginAddress      uint32
+	EndAddress        uint32
+	UnwindInfoAddress uint32
+}
+
+// UNW_FLAG_CHAININFO marks unwind information that continues that of
+// another function table entry, as for the separated parts of a function.
+const UNW_FLAG_CHAININFO = 0x4
+
+// RuntimeFunctions returns the function table of an x64 image, or nil if
+// it has none.
+func (f *File) RuntimeFunctions() ([]RuntimeFunction, error) {
+	if f.Machine != IMAGE_FILE_MACHINE_AMD64 {
+		return nil, fmt.Errorf("machine %#x has no x64 function table", f.Machine)
+	}
+	dd := f.dataDirectories()
+	if len(dd) <= IMAGE_DIRECTORY_ENTRY_EXCEPTION || dd[IMAGE_DIRECTORY_ENTRY_EXCEPTION].VirtualAddress == 0 {
+		return nil, nil
+	}
+	d := dd[IMAGE_DIRECTORY_ENTRY_EXCEPTION]
+	b, err := f.rvaData(d.VirtualAddress, d.Size/12*12)
+	if err != nil {
+		return nil, fmt.Errorf("exception directory: %v", err)
+	}
+	funcs := make([]RuntimeFunction, len(b)/12)
+	for i := range funcs {
+		funcs[i] = RuntimeFunction{
+			BeginAddress:      binary.LittleEndian.Uint32(b[12*i:]),
+			EndAddress:        binary.LittleEndian.Uint32(b[12*i+4:]),
+			UnwindInfoAddress: binary.LittleEndian.Uint32(b[12*i+8:]),
+		}
+	}
+	return funcs, nil
+}
+
+// An ExtractedFunction is a function copied out of a file by
+// ExtractFunction, along with what is needed to relocate it.
+type ExtractedFunction struct {
+	Name string
+	Code []byte
+
+	// Relocs are the COFF relocations of an object file that apply to
+	// Code. Their VirtualAddress is an offset in Code and their
+	// SymbolTableIndex selects from Symbols.
+	Relocs  []Reloc
+	Symbols []Symbol
+
+	// Fixups are the offsets in Code of the absolute addresses that the
+	// base relocations of an image apply to. Each address has been made
+	// relative to the start of Code, as InjectCodeWithRelocs expects;
+	// addresses outside of the function keep their distance from it.
+	Fixups []uint32
+}
+
+// ExtractFunction returns the code of the function name with what is
+// needed to relocate it, so that it can be copied into another file.
+//
+// The function is looked up in the COFF symbols, and in the exports of
+// images. COFF symbols have no size: in object files a function extends
+// to the next symbol of its section, and in x64 images to the end of its
+// function table entry, including the chained entries that follow it.
+func (f *File) ExtractFunction(name string) (*ExtractedFunction, error) {
+	var s *Section
+	var start, end, rva uint32
+	found := false
+	for _, sym := range f.Symbols {
+		if sym.Name == name && sym.Type == 0x20 && sym.SectionNumber > 0 && int(sym.SectionNumber) <= len(f.Sections) {
+			s, start = f.Sections[sym.SectionNumber-1], sym.Value
+			end = s.Size
+			if s.VirtualSize != 0 && s.VirtualSize < end {
+				end = s.VirtualSize
+			}
+			for _, t := range f.Symbols {
+				if t.SectionNumber == sym.SectionNumber && t.Value > start && t.Value < end {
+					end = t.Value
+				}
+			}
+			rva, found = s.VirtualAddress+start, true
+			break
+		}
+	}
+	if !found && f.OptionalHeader != nil {
+		exports, err := f.Exports()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range exports {
+			if e.Name == name && e.Forward == "" {
+				if s = f.sectionForRVA(e.VirtualAddress); s == nil {
+					return nil, fmt.Errorf("export %s at RVA %#x is not in a section", name, e.VirtualAddress)
+				}
+				rva, start, found = e.VirtualAddress, e.VirtualAddress-s.VirtualAddress, true
+				break
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no function %s", name)
+	}
+
+	if f.OptionalHeader != nil && f.Machine == IMAGE_FILE_MACHINE_AMD64 {
+		funcs, err := f.RuntimeFunctions()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(funcs); i++ {
+			if funcs[i].BeginAddress != rva {
+				continue
+			}
+			last := funcs[i].EndAddress
+			for i++; i < len(funcs) && funcs[i].BeginAddress == last; i++ {
+				flags, err := f.rvaData(funcs[i].UnwindInfoAddress, 1)
+				if err != nil || flags[0]>>3&UNW_FLAG_CHAININFO == 0 {
+					break
+				}
+				last = funcs[i].EndAddress
+			}
+			if last < rva || last-s.VirtualAddress > s.Size {
+				return nil, fmt.Errorf("function table entry of %s runs past section %s", name, s.Name)
+			}
+			end = last - s.VirtualAddress
+			break
+		}
+	}
+	if end == 0 {
+		return nil, fmt.Errorf("cannot tell where function %s ends", name)
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	if start > end || end > uint32(len(data)) {
+		return nil, fmt.Errorf("function %s lies outside of section %s", name, s.Name)
+	}
+	out := &ExtractedFunction{Name: name, Code: append([]byte(nil), data[start:end]...)}
+
+	if f.OptionalHeader == nil {
+		// Object files are relocated with COFF relocations, whose
+		// VirtualAddress is an offset in the section.
+		symIdx := make(map[uint32]uint32) // COFFSymbols index to Symbols index
+		for _, r := range s.Relocs {
+			if r.VirtualAddress < start || r.VirtualAddress >= end {
+				continue
+			}
+			if int(r.SymbolTableIndex) >= len(f.COFFSymbols) {
+				return nil, fmt.Errorf("relocation at %#x refers to symbol %d of %d", r.VirtualAddress, r.SymbolTableIndex, len(f.COFFSymbols))
+			}
+			idx, ok := symIdx[r.SymbolTableIndex]
+			if !ok {
+				sym := &f.COFFSymbols[r.SymbolTableIndex]
+				symName, err := sym.FullName(f.StringTable)
+				if err != nil {
+					return nil, err
+				}
+				idx = uint32(len(out.Symbols))
+				symIdx[r.SymbolTableIndex] = idx
+				out.Symbols = append(out.Symbols, Symbol{
+					Name:          symName,
+					Value:         sym.Value,
+					SectionNumber: sym.SectionNumber,
+					Type:          sym.Type,
+					StorageClass:  sym.StorageClass,
+				})
+			}
+			out.Relocs = append(out.Relocs, Reloc{VirtualAddress: r.VirtualAddress - start, SymbolTableIndex: idx, Type: r.Type})
+		}
+		return out, nil
+	}
+
+	// Images are relocated with base relocations of the size of a
+	// pointer.
+	ptrSize, typ := uint32(4), byte(IMAGE_REL_BASED_HIGHLOW)
+	if _, ok := f.OptionalHeader.(*OptionalHeader64); ok {
+		ptrSize, typ = 8, IMAGE_REL_BASED_DIR64
+	}
+	base := f.imageBase() + uint64(rva)
+	if f.BaseRelocationTable != nil {
+		for _, block := range *f.BaseRelocationTable {
+			for _, item := range block.BlockItems {
+				at := block.VirtualAddress + uint32(item.Offset)
+				if item.Type == IMAGE_REL_BASED_ABSOLUTE || at < rva || at >= rva+uint32(len(out.Code)) {
+					continue
+				}
+				off := at - rva
+				if item.Type != typ || off+ptrSize > uint32(len(out.Code)) {
+					return nil, fmt.Errorf("unsupported base relocation of type %d at RVA %#x", item.Type, at)
+				}
+				if ptrSize == 8 {
+					binary.LittleEndian.PutUint64(out.Code[off:], binary.LittleEndian.Uint64(out.Code[off:])-base)
+				} else {
+					binary.LittleEndian.PutUint32(out.Code[off:], binary.LittleEndian.Uint32(out.Code[off:])-uint32(base))
+				}
+				out.Fixups = append(out.Fixups, off)
+			}
+		}
+	}
+	return out, nil
+}
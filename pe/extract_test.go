@@ -0,0 +1,95 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestExtractFunctionObject(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fn, err := f.ExtractFunction("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Reloc{
+		{VirtualAddress: 0x9, SymbolTableIndex: 0, Type: IMAGE_REL_AMD64_REL32},
+		{VirtualAddress: 0x10, SymbolTableIndex: 1, Type: IMAGE_REL_AMD64_REL32},
+		{VirtualAddress: 0x15, SymbolTableIndex: 2, Type: IMAGE_REL_AMD64_REL32},
+	}
+	if !reflect.DeepEqual(fn.Relocs, want) {
+		t.Errorf("relocations are %+v, want %+v", fn.Relocs, want)
+	}
+	var names []string
+	for _, sym := range fn.Symbols {
+		names = append(names, sym.Name)
+	}
+	if want := []string{"__main", ".rdata", "puts"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("symbols are %q, want %q", names, want)
+	}
+	text, err := f.Section(".text").Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fn.Code, text[:len(fn.Code)]) || len(fn.Fixups) != 0 {
+		t.Errorf("code is %x with fixups %v, want the start of .text", fn.Code, fn.Fixups)
+	}
+	if _, err := f.ExtractFunction(".text"); err == nil {
+		t.Error("ExtractFunction accepted a section symbol")
+	}
+}
+
+func TestExtractFunctionImage(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	funcs, err := f.RuntimeFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(funcs) != 0x498/12 || funcs[1] != (RuntimeFunction{0x1010, 0x1058, 0xb004}) {
+		t.Fatalf("function table has %d entries starting with %+v", len(funcs), funcs[:2])
+	}
+
+	// __main is followed by padding up to the next symbol at 0x26b0,
+	// which only the function table leaves out.
+	const rva = 0x2690
+	if err := f.addBaseReloc(rva+4, IMAGE_REL_BASED_DIR64); err != nil {
+		t.Fatal(err)
+	}
+	text, err := f.Section(".text").Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := text[rva-0x1000 : rva-0x1000+0x1c]
+	fn, err := f.ExtractFunction("__main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fn.Code) != len(orig) || !reflect.DeepEqual(fn.Fixups, []uint32{4}) {
+		t.Fatalf("got %d bytes with fixups %v, want %d with [4]", len(fn.Code), fn.Fixups, len(orig))
+	}
+	got := binary.LittleEndian.Uint64(fn.Code[4:]) + f.imageBase() + rva
+	if got != binary.LittleEndian.Uint64(orig[4:]) || !bytes.Equal(fn.Code[12:], orig[12:]) {
+		t.Errorf("code is %x, want %x with the address at 4 made relative", fn.Code, orig)
+	}
+
+	f386, err := Open("testdata/gcc-386-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f386.Close()
+	if _, err := f386.RuntimeFunctions(); err == nil {
+		t.Error("RuntimeFunctions succeeded for an x86 image")
+	}
+	if fn, err := f386.ExtractFunction("_main"); err != nil || len(fn.Code) == 0 {
+		t.Errorf("ExtractFunction(_main) = %v, %v", fn, err)
+	}
+}
@@ -14,6 +14,8 @@ import (
 	"io"
 	"os"
 	"strings"
+
+	"github.com/Binject/debug/internal/readerat"
 )
 
 // Avoid use of post-Go 1.4 io features, to make safe for toolchain bootstrap.
@@ -43,6 +45,21 @@ type File struct {
 
 	Net Net //If a managed executable, Net provides an interface to some of the metadata
 
+	// PreserveRaw makes Bytes patch the headers, section data, symbols
+	// and certificate table into the bytes the file was read from, so that
+	// data the parser does not model, such as packer stubs and overlays,
+	// is kept. Set it before editing the file.
+	PreserveRaw bool
+
+	// Anomalies lists the malformations that NewFileTolerant worked
+	// around while reading the file.
+	Anomalies []Issue
+
+	raw      io.ReaderAt // the reader the file was parsed from
+	rawSize  int64       // size of raw, or -1 if not known yet
+	tolerant bool        // read by NewFileTolerant
+	limits   Limits      // what is read from the file
+
 	closer io.Closer
 }
 
@@ -66,6 +83,11 @@ func Open(name string) (*File, error) {
 // Close has no effect.
 func (f *File) Close() error {
 	var err error
+	// Sections stop being views of a mapping before it is unmapped, so
+	// that Data reads from the closed file and fails instead.
+	for _, s := range f.Sections {
+		s.view, s.viewSR = nil, nil
+	}
 	if f.closer != nil {
 		err = f.closer.Close()
 		f.closer = nil
@@ -82,40 +104,47 @@ var (
 
 // NewFile creates a new pe.File for accessing a PE binary file in an underlying reader.
 func NewFile(r io.ReaderAt) (*File, error) {
-	return newFileInternal(r, false)
+	return newFileInternal(r, false, false, DefaultLimits)
 }
 
 // NewFileFromMemory creates a new pe.File for accessing a PE binary in-memory image in an underlying reader.
 func NewFileFromMemory(r io.ReaderAt) (*File, error) {
-	return newFileInternal(r, true)
+	return newFileInternal(r, true, false, DefaultLimits)
 }
 
 // NewFile creates a new File for accessing a PE binary in an underlying reader.
-func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
+func newFileInternal(r io.ReaderAt, memoryMode, tolerant bool, l Limits) (*File, error) {
 
 	f := new(File)
+	f.raw = r
+	f.rawSize = -1
+	f.tolerant = tolerant
+	f.limits = l.withDefaults()
 	sr := io.NewSectionReader(r, 0, 1<<63-1)
 
 	binary.Read(sr, binary.LittleEndian, &f.DosHeader)
 	dosHeaderSize := binary.Size(f.DosHeader)
-	if dosHeaderSize < int(f.DosHeader.AddressOfNewExeHeader) {
-		binary.Read(sr, binary.LittleEndian, &f.DosStub)
-		f.DosExists = true
-	} else {
-		f.DosExists = false
-	}
+	// Object files have no DOS header; what was read is the COFF header.
+	if f.DosHeader.MZSignature == 0x5a4d {
+		if dosHeaderSize < int(f.DosHeader.AddressOfNewExeHeader) {
+			binary.Read(sr, binary.LittleEndian, &f.DosStub)
+			f.DosExists = true
+		} else {
+			f.DosExists = false
+		}
 
-	possibleRichHeaderStart := dosHeaderSize
-	if f.DosExists {
-		possibleRichHeaderStart += binary.Size(f.DosStub)
-	}
-	possibleRichHeaderEnd := int(f.DosHeader.AddressOfNewExeHeader)
-	if possibleRichHeaderEnd > possibleRichHeaderStart {
-		richHeader := make([]byte, possibleRichHeaderEnd-possibleRichHeaderStart)
-		binary.Read(sr, binary.LittleEndian, richHeader)
+		possibleRichHeaderStart := dosHeaderSize
+		if f.DosExists {
+			possibleRichHeaderStart += binary.Size(f.DosStub)
+		}
+		possibleRichHeaderEnd := int(f.DosHeader.AddressOfNewExeHeader)
+		if possibleRichHeaderEnd > possibleRichHeaderStart && f.fitsFile(int64(possibleRichHeaderEnd)) {
+			richHeader := make([]byte, possibleRichHeaderEnd-possibleRichHeaderStart)
+			binary.Read(sr, binary.LittleEndian, richHeader)
 
-		if richIndex := bytes.Index(richHeader, []byte("Rich")); richIndex != -1 {
-			f.RichHeader = richHeader[:richIndex+8]
+			if richIndex := bytes.Index(richHeader, []byte("Rich")); richIndex != -1 {
+				f.RichHeader = richHeader[:richIndex+8]
+			}
 		}
 	}
 
@@ -137,9 +166,13 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 		return nil, err
 	}
 	switch f.FileHeader.Machine {
-	case IMAGE_FILE_MACHINE_UNKNOWN, IMAGE_FILE_MACHINE_ARMNT, IMAGE_FILE_MACHINE_AMD64, IMAGE_FILE_MACHINE_I386:
+	case IMAGE_FILE_MACHINE_UNKNOWN, IMAGE_FILE_MACHINE_ARMNT, IMAGE_FILE_MACHINE_AMD64, IMAGE_FILE_MACHINE_I386,
+		IMAGE_FILE_MACHINE_ARM64, IMAGE_FILE_MACHINE_RISCV32, IMAGE_FILE_MACHINE_RISCV64, IMAGE_FILE_MACHINE_RISCV128,
+		IMAGE_FILE_MACHINE_LOONGARCH32, IMAGE_FILE_MACHINE_LOONGARCH64:
 	default:
-		return nil, fmt.Errorf("Unrecognised COFF file header machine value of 0x%x", f.FileHeader.Machine)
+		if err := f.tolerate(fmt.Errorf("Unrecognised COFF file header machine value of 0x%x", f.FileHeader.Machine)); err != nil {
+			return nil, err
+		}
 	}
 
 	var err error
@@ -157,7 +190,10 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 		for i := 0; i < int(f.FileHeader.NumberOfSections); i++ {
 			sh := new(SectionHeader32)
 			if err := binary.Read(sr, binary.LittleEndian, sh); err != nil {
-				return nil, err
+				if err := f.tolerate(err); err != nil {
+					return nil, err
+				}
+				break
 			}
 			//original offset matches the pointer to the symbol table, update the header so other things can reference it good again
 			if sh.PointerToRawData == f.FileHeader.PointerToSymbolTable {
@@ -168,20 +204,26 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 		sr.Seek(restore, seekStart)
 	}
 
-	// Read string table.
-	f.StringTable, err = readStringTable(&f.FileHeader, sr)
-	if err != nil {
-		return nil, err
-	}
+	if !f.symbolsInFile() {
+		if err := f.tolerate(fmt.Errorf("symbol table of %d symbols at %#x runs past the end of the file", f.FileHeader.NumberOfSymbols, f.FileHeader.PointerToSymbolTable)); err != nil {
+			return nil, err
+		}
+	} else {
+		// Read string table.
+		f.StringTable, err = readStringTable(&f.FileHeader, sr)
+		if err = f.tolerate(err); err != nil {
+			return nil, err
+		}
 
-	// Read symbol table.
-	f.COFFSymbols, err = readCOFFSymbols(&f.FileHeader, sr)
-	if err != nil {
-		return nil, err
-	}
-	f.Symbols, err = removeAuxSymbols(f.COFFSymbols, f.StringTable)
-	if err != nil {
-		return nil, err
+		// Read symbol table.
+		f.COFFSymbols, err = readCOFFSymbols(&f.FileHeader, sr)
+		if err = f.tolerate(err); err != nil {
+			return nil, err
+		}
+		f.Symbols, err = removeAuxSymbols(f.COFFSymbols, f.StringTable)
+		if err = f.tolerate(err); err != nil {
+			return nil, err
+		}
 	}
 
 	// Read optional header.
@@ -190,8 +232,10 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 
 	var oh32 OptionalHeader32
 	var oh64 OptionalHeader64
-	switch f.FileHeader.SizeOfOptionalHeader {
-	case sizeofOptionalHeader32:
+	switch {
+	case f.tolerant:
+		f.readOptionalHeaderTolerant(r)
+	case f.FileHeader.SizeOfOptionalHeader == sizeofOptionalHeader32:
 		if err := binary.Read(sr, binary.LittleEndian, &oh32); err != nil {
 			return nil, err
 		}
@@ -199,7 +243,7 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 			return nil, fmt.Errorf("pe32 optional header has unexpected Magic of 0x%x", oh32.Magic)
 		}
 		f.OptionalHeader = &oh32
-	case sizeofOptionalHeader64:
+	case f.FileHeader.SizeOfOptionalHeader == sizeofOptionalHeader64:
 		if err := binary.Read(sr, binary.LittleEndian, &oh64); err != nil {
 			return nil, err
 		}
@@ -209,16 +253,28 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 		f.OptionalHeader = &oh64
 	}
 
-	// Process sections.
-	f.Sections = make([]*Section, f.FileHeader.NumberOfSections)
-	for i := 0; i < int(f.FileHeader.NumberOfSections); i++ {
+	// Process sections. The section table follows the optional header,
+	// whatever its size.
+	sr.Seek(f.OptionalHeaderOffset+int64(f.FileHeader.SizeOfOptionalHeader), seekStart)
+	nsections, err := f.sectionsInFile()
+	if err != nil {
+		return nil, err
+	}
+	f.Sections = make([]*Section, 0, nsections)
+	for i := 0; i < cap(f.Sections); i++ {
 		sh := new(SectionHeader32)
 		if err := binary.Read(sr, binary.LittleEndian, sh); err != nil {
-			return nil, err
+			if err := f.tolerate(err); err != nil {
+				return nil, err
+			}
+			break
 		}
 		name, err := sh.fullName(f.StringTable)
 		if err != nil {
-			return nil, err
+			if err := f.tolerate(fmt.Errorf("section %d: %v", i, err)); err != nil {
+				return nil, err
+			}
+			name = cstring(sh.Name[:])
 		}
 		s := new(Section)
 		s.SectionHeader = SectionHeader{
@@ -237,33 +293,52 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 		r2 := r
 		if sh.PointerToRawData == 0 { // .bss must have all 0s
 			r2 = zeroReaderAt{}
+			if !f.fitsFile(int64(sh.SizeOfRawData)) {
+				if err := f.tolerate(fmt.Errorf("section %q of %#x bytes without raw data is larger than the file", name, sh.SizeOfRawData)); err != nil {
+					return nil, err
+				}
+				s.SectionHeader.Size = 0
+			}
 		}
 		if !memoryMode {
 			s.sr = io.NewSectionReader(r2, int64(s.SectionHeader.Offset), int64(s.SectionHeader.Size))
 		} else {
 			s.sr = io.NewSectionReader(r2, int64(s.SectionHeader.VirtualAddress), int64(s.SectionHeader.Size))
 		}
+		if f.tolerant && !memoryMode && sh.PointerToRawData != 0 {
+			f.clampRawData(s)
+		}
 		s.ReaderAt = s.sr
-		f.Sections[i] = s
+		f.Sections = append(f.Sections, s)
+	}
+	if f.tolerant && !memoryMode {
+		f.checkRawDataOverlaps()
 	}
 	for i := range f.Sections {
+		sh := &f.Sections[i].SectionHeader
+		if sh.NumberOfRelocations > 0 && !f.fitsFile(int64(sh.PointerToRelocations)+10*int64(sh.NumberOfRelocations)) {
+			if err := f.tolerate(fmt.Errorf("%d relocations of section %q run past the end of the file", sh.NumberOfRelocations, sh.Name)); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		var err error
-		f.Sections[i].Relocs, err = readRelocs(&f.Sections[i].SectionHeader, sr)
-		if err != nil {
+		f.Sections[i].Relocs, err = readRelocs(sh, sr)
+		if err = f.tolerate(err); err != nil {
 			return nil, err
 		}
 	}
 
 	// Read Base Relocation Block and Items
 	f.BaseRelocationTable, err = f.readBaseRelocationTable()
-	if err != nil {
+	if err = f.tolerate(err); err != nil {
 		return nil, err
 	}
 
 	// Read certificate table (only in disk mode)
 	if !memoryMode {
 		f.CertificateTable, err = readCertTable(f, sr)
-		if err != nil {
+		if err = f.tolerate(err); err != nil {
 			return nil, err
 		}
 	}
@@ -282,6 +357,13 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 			size = v.DataDirectory[IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR].Size
 		}
 
+		if !f.fitsFile(int64(size)) {
+			if err := f.tolerate(fmt.Errorf("COM descriptor directory of %#x bytes is larger than the file", size)); err != nil {
+				return nil, err
+			}
+			return f, nil
+		}
+
 		//I'm unsure how to get a reader (not a readerat) for a particular thing, so copying buffers around.. this could be more optimal
 		buff := make([]byte, size)
 
@@ -294,6 +376,12 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 		binary.Read(bytes.NewReader(buff), binary.LittleEndian, &f.Net.NetDirectory)
 
 		//Now that we have the COR20 header (COM descriptor directory header), we can get the metadata section header, which has the version
+		if !f.fitsFile(int64(f.Net.NetDirectory.MetaDataSize)) {
+			if err := f.tolerate(fmt.Errorf("CLR metadata of %#x bytes is larger than the file", f.Net.NetDirectory.MetaDataSize)); err != nil {
+				return nil, err
+			}
+			return f, nil
+		}
 		buff = make([]byte, f.Net.NetDirectory.MetaDataSize)
 		//again, none of the reads are error checked :shrug:
 		if !memoryMode {
@@ -370,12 +458,12 @@ func (f *File) DWARF() (*dwarf.Data, error) {
 
 		if len(b) >= 12 && string(b[:4]) == "ZLIB" {
 			dlen := binary.BigEndian.Uint64(b[4:12])
-			dbuf := make([]byte, dlen)
 			r, err := zlib.NewReader(bytes.NewBuffer(b[12:]))
 			if err != nil {
 				return nil, err
 			}
-			if _, err := io.ReadFull(r, dbuf); err != nil {
+			dbuf, err := readerat.ReadData(r, dlen)
+			if err != nil {
 				return nil, err
 			}
 			if err := r.Close(); err != nil {
@@ -442,6 +530,10 @@ func (e *FormatError) Error() string {
 }
 
 // RVAToFileOffset Converts a Relative offset to the actual offset in the file.
+//
+// Deprecated: RVAToFileOffset returns 0 for an RVA outside the sections,
+// and an offset past the raw data for one in the slack of a section. Use
+// RVAToOffset, which reports both.
 func (f *File) RVAToFileOffset(rva uint32) uint32 {
 	var offset uint32
 	for _, section := range f.Sections {
@@ -467,3 +559,64 @@ func (f *File) IsManaged() bool {
 
 	return false
 }
+
+// dataDirectories returns the data directory entries that are in use
+// according to NumberOfRvaAndSizes. The returned slice aliases the optional
+// header, so modifying an entry modifies f. It returns nil if f has no
+// optional header.
+func (f *File) dataDirectories() []DataDirectory {
+	var dd []DataDirectory
+	var n uint32
+	switch v := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		dd, n = v.DataDirectory[:], v.NumberOfRvaAndSizes
+	case *OptionalHeader64:
+		dd, n = v.DataDirectory[:], v.NumberOfRvaAndSizes
+	default:
+		return nil
+	}
+	if n < uint32(len(dd)) {
+		dd = dd[:n]
+	}
+	return dd
+}
+
+// imageLayout returns the alignment and size fields of the optional header.
+// ok is false if f has no optional header.
+func (f *File) imageLayout() (sectionAlignment, fileAlignment, sizeOfImage, sizeOfHeaders uint32, ok bool) {
+	switch v := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		return v.SectionAlignment, v.FileAlignment, v.SizeOfImage, v.SizeOfHeaders, true
+	case *OptionalHeader64:
+		return v.SectionAlignment, v.FileAlignment, v.SizeOfImage, v.SizeOfHeaders, true
+	}
+	return 0, 0, 0, 0, false
+}
+
+// is64 reports whether f has a PE32+ optional header, whatever its
+// machine.
+func (f *File) is64() bool {
+	_, ok := f.OptionalHeader.(*OptionalHeader64)
+	return ok
+}
+
+// imageBase returns the preferred load address from the optional header,
+// or 0 if f has no optional header.
+func (f *File) imageBase() uint64 {
+	switch v := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		return uint64(v.ImageBase)
+	case *OptionalHeader64:
+		return v.ImageBase
+	}
+	return 0
+}
+
+// alignUp rounds v up to the next multiple of align. An align of zero
+// leaves v unchanged.
+func alignUp(v, align uint32) uint32 {
+	if align == 0 {
+		return v
+	}
+	return (v + align - 1) / align * align
+}
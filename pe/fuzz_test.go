@@ -0,0 +1,69 @@
+//go:build go1.18
+// +build go1.18
+
+package pe
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func fuzzSeeds(f *testing.F) {
+	names, _ := filepath.Glob("testdata/*")
+	for _, name := range names {
+		if filepath.Ext(name) == ".c" {
+			continue
+		}
+		if data, err := ioutil.ReadFile(name); err == nil && len(data) < 1<<20 {
+			f.Add(data)
+		}
+	}
+}
+
+func FuzzNewFile(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pf, err := NewFile(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// None of these may panic, whatever the file holds.
+		for _, s := range pf.Sections {
+			s.Data()
+		}
+		pf.ImportedSymbols()
+		pf.ImportedLibraries()
+		pf.Exports()
+		pf.DWARF()
+		pf.resources()
+
+		out, err := pf.Bytes()
+		if err != nil {
+			return
+		}
+		g, err := NewFile(bytes.NewReader(out))
+		if err != nil {
+			t.Fatalf("reading the bytes written: %v", err)
+		}
+		if len(g.Sections) != len(pf.Sections) {
+			t.Fatalf("%d sections written, %d read back", len(pf.Sections), len(g.Sections))
+		}
+	})
+}
+
+func FuzzNewFileTolerant(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pf, err := NewFileTolerant(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		for _, s := range pf.Sections {
+			s.Data()
+		}
+		pf.Describe()
+		pf.Validate()
+	})
+}
@@ -0,0 +1,170 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/Binject/debug/gosym"
+)
+
+// ErrNoGoMetadata is returned by File.GoPclntab, File.GoBuildInfo and
+// File.GoBuildID when the requested Go metadata cannot be found.
+var ErrNoGoMetadata = gosym.ErrNoGoMetadata
+
+// GoPclntab returns the contents of the Go pclntab and its virtual
+// address. The data can be passed to gosym.NewLineTable.
+//
+// The Go linker puts the pclntab in .rdata and marks it with the
+// runtime.pclntab and runtime.epclntab symbols. If the COFF symbols have
+// been stripped, .rdata and then the remaining sections are searched for a
+// valid pclntab header instead, and the data runs to the end of the
+// section that holds it.
+func (f *File) GoPclntab() ([]byte, uint64, error) {
+	start, end := f.goSymbol("runtime.pclntab"), f.goSymbol("runtime.epclntab")
+	if start != nil && end != nil && start.SectionNumber == end.SectionNumber && start.Value <= end.Value {
+		if s := f.sectionByNumber(start.SectionNumber); s != nil {
+			data, err := s.Data()
+			if err != nil {
+				return nil, 0, err
+			}
+			if end.Value <= uint32(len(data)) {
+				return data[start.Value:end.Value], f.imageBase() + uint64(s.VirtualAddress+start.Value), nil
+			}
+		}
+	}
+
+	var (
+		found []byte
+		addr  uint64
+	)
+	err := f.goSearch(".rdata", func(data []byte, s *Section) bool {
+		if i := gosym.FindPclntab(data, binary.LittleEndian); i >= 0 {
+			found, addr = data[i:], f.imageBase()+uint64(s.VirtualAddress)+uint64(i)
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if found == nil {
+		return nil, 0, ErrNoGoMetadata
+	}
+	return found, addr, nil
+}
+
+// ApplyGoRenameMap renames the functions in the Go pclntab as described
+// by gosym.LineTable.ApplyRenameMap and stores the patched table in the
+// section that holds it, ready for Bytes or WriteFile.
+func (f *File) ApplyGoRenameMap(renames map[string]string) error {
+	pcln, addr, err := f.GoPclntab()
+	if err != nil {
+		return err
+	}
+	patched, err := gosym.NewLineTable(pcln, 0).ApplyRenameMap(renames)
+	if err != nil {
+		return err
+	}
+	rva := uint32(addr - f.imageBase())
+	s := f.sectionForRVA(rva)
+	if s == nil {
+		return errors.New("pclntab is not inside a section")
+	}
+	data, err := s.Data()
+	if err != nil {
+		return err
+	}
+	copy(data[rva-s.VirtualAddress:], patched)
+	s.Replace(bytes.NewReader(data), int64(len(data)))
+	return nil
+}
+
+// GoBuildInfo returns the Go build information blob, starting at its
+// "\xff Go buildinf:" header, and its virtual address. PE files have no
+// section of their own for it; the linker places it in .data, which is
+// searched first.
+func (f *File) GoBuildInfo() ([]byte, uint64, error) {
+	var (
+		found []byte
+		addr  uint64
+	)
+	err := f.goSearch(".data", func(data []byte, s *Section) bool {
+		if i := gosym.FindBuildInfo(data); i >= 0 {
+			found, addr = data[i:], f.imageBase()+uint64(s.VirtualAddress)+uint64(i)
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if found == nil {
+		return nil, 0, ErrNoGoMetadata
+	}
+	return found, addr, nil
+}
+
+// GoBuildID returns the Go build ID that the linker writes at the start
+// of the code section.
+func (f *File) GoBuildID() (string, error) {
+	for _, s := range f.Sections {
+		if s.Characteristics&IMAGE_SCN_CNT_CODE == 0 {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return "", err
+		}
+		if id, ok := gosym.FindBuildID(data); ok {
+			return id, nil
+		}
+	}
+	return "", ErrNoGoMetadata
+}
+
+// goSymbol returns the COFF symbol with the given name, or nil.
+func (f *File) goSymbol(name string) *Symbol {
+	for _, sym := range f.Symbols {
+		if sym.Name == name {
+			return sym
+		}
+	}
+	return nil
+}
+
+// sectionByNumber returns the section with the 1-based COFF section
+// number n, or nil.
+func (f *File) sectionByNumber(n int16) *Section {
+	if n < 1 || int(n) > len(f.Sections) {
+		return nil
+	}
+	return f.Sections[n-1]
+}
+
+// goSearch calls fn with the contents of the section named first and then
+// of every other section with raw data, until fn returns true.
+func (f *File) goSearch(first string, fn func(data []byte, s *Section) bool) error {
+	sections := make([]*Section, 0, len(f.Sections))
+	if s := f.Section(first); s != nil {
+		sections = append(sections, s)
+	}
+	for _, s := range f.Sections {
+		if s.Name != first {
+			sections = append(sections, s)
+		}
+	}
+	for _, s := range sections {
+		if s.Size == 0 {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return err
+		}
+		if fn(data, s) {
+			return nil
+		}
+	}
+	return nil
+}
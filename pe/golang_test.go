@@ -0,0 +1,90 @@
+package pe
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/Binject/debug/internal/gobuild"
+)
+
+func TestGoMetadata(t *testing.T) {
+	exe := gobuild.Binary(t, "windows", "amd64")
+	out, err := exec.Command("go", "tool", "buildid", exe).Output()
+	if err != nil {
+		t.Fatalf("go tool buildid: %v", err)
+	}
+	wantID := strings.TrimSpace(string(out))
+
+	f, err := Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	pcln, pclnAddr, err := f.GoPclntab()
+	if err != nil {
+		t.Fatalf("GoPclntab: %v", err)
+	}
+	if sym := f.goSymbol("runtime.pclntab"); sym == nil {
+		t.Fatal("no runtime.pclntab symbol")
+	} else if rdata := f.sectionByNumber(sym.SectionNumber); pclnAddr != f.imageBase()+uint64(rdata.VirtualAddress+sym.Value) {
+		t.Errorf("GoPclntab address %#x does not match runtime.pclntab", pclnAddr)
+	}
+	info, infoAddr, err := f.GoBuildInfo()
+	if err != nil {
+		t.Fatalf("GoBuildInfo: %v", err)
+	}
+	if !bytes.HasPrefix(info, []byte("\xff Go buildinf:")) {
+		t.Errorf("GoBuildInfo returned data without the build info header")
+	}
+	if id, err := f.GoBuildID(); err != nil || id != wantID {
+		t.Errorf("GoBuildID = %q, %v; want %q", id, err, wantID)
+	}
+
+	// Without symbols the pclntab is found by scanning.
+	f.Symbols = nil
+	data, addr, err := f.GoPclntab()
+	if err != nil || addr != pclnAddr || !bytes.HasPrefix(data, pcln) {
+		t.Errorf("GoPclntab without symbols = %#x, %v; want %#x", addr, err, pclnAddr)
+	}
+	if _, addr, err := f.GoBuildInfo(); err != nil || addr != infoAddr {
+		t.Errorf("GoBuildInfo = %#x, %v; want %#x", addr, err, infoAddr)
+	}
+}
+
+func TestGoMetadataNotGo(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, _, err := f.GoPclntab(); err != ErrNoGoMetadata {
+		t.Errorf("GoPclntab error = %v, want ErrNoGoMetadata", err)
+	}
+	if _, _, err := f.GoBuildInfo(); err != ErrNoGoMetadata {
+		t.Errorf("GoBuildInfo error = %v, want ErrNoGoMetadata", err)
+	}
+	if _, err := f.GoBuildID(); err != ErrNoGoMetadata {
+		t.Errorf("GoBuildID error = %v, want ErrNoGoMetadata", err)
+	}
+}
+
+func TestApplyGoRenameMap(t *testing.T) {
+	f, err := Open(gobuild.Binary(t, "windows", "amd64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.ApplyGoRenameMap(map[string]string{"main.main": "main.xx"}); err != nil {
+		t.Fatal(err)
+	}
+	pcln, _, err := reparse(t, f).GoPclntab()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(pcln, []byte("\x00main.xx\x00")) || bytes.Contains(pcln, []byte("\x00main.main\x00")) {
+		t.Error("main.main was not renamed")
+	}
+}
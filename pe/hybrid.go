@@ -0,0 +1,320 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Offsets of the hybrid image fields of IMAGE_LOAD_CONFIG_DIRECTORY64.
+const (
+	loadConfigCHPEMetadataPointer  = 200
+	loadConfigDynamicRelocOffset   = 224
+	loadConfigDynamicRelocSection  = 228
+	loadConfigDynamicRelocFieldEnd = 230
+)
+
+// Symbols of IMAGE_DYNAMIC_RELOCATION entries.
+const (
+	IMAGE_DYNAMIC_RELOCATION_ARM64X = 6
+)
+
+// Fixup types of ARM64X dynamic relocations.
+const (
+	IMAGE_DVRT_ARM64X_FIXUP_TYPE_ZEROFILL = 0
+	IMAGE_DVRT_ARM64X_FIXUP_TYPE_VALUE    = 1
+	IMAGE_DVRT_ARM64X_FIXUP_TYPE_DELTA    = 2
+)
+
+// Kinds of code in the code map of an ARM64EC image.
+const (
+	CodeRangeARM64   = 0
+	CodeRangeARM64EC = 1
+	CodeRangeAMD64   = 2
+)
+
+// Arm64ECMetadata is the version 1 layout of IMAGE_ARM64EC_METADATA, the
+// hybrid metadata that the load configuration of an ARM64EC or ARM64X
+// image points to. All addresses are RVAs.
+type Arm64ECMetadata struct {
+	Version                          uint32
+	CodeMap                          uint32
+	CodeMapCount                     uint32
+	CodeRangesToEntryPoints          uint32
+	RedirectionMetadata              uint32
+	DispatchCallNoRedirect           uint32
+	DispatchRet                      uint32
+	DispatchCall                     uint32
+	DispatchICall                    uint32
+	DispatchICallCFG                 uint32
+	AlternateEntryPoint              uint32
+	AuxiliaryIAT                     uint32
+	CodeRangesToEntryPointsCount     uint32
+	RedirectionMetadataCount         uint32
+	GetX64InformationFunctionPointer uint32
+	SetX64InformationFunctionPointer uint32
+	ExtraRFETable                    uint32
+	ExtraRFETableSize                uint32
+	DispatchFptr                     uint32
+	AuxiliaryIATCopy                 uint32
+}
+
+// A CodeRange is an entry of the code map of an ARM64EC image.
+type CodeRange struct {
+	RVA    uint32
+	Length uint32
+	Kind   uint8 // CodeRangeARM64, CodeRangeARM64EC or CodeRangeAMD64
+}
+
+// HybridMetadata describes the ARM64EC side of a hybrid image.
+type HybridMetadata struct {
+	Arm64ECMetadata
+	CodeRanges []CodeRange // the decoded code map
+}
+
+// An ARM64XReloc is a fixup of the ARM64X dynamic relocation table. The
+// loader applies these fixups to the native ARM64 view of an ARM64X image,
+// such as its headers, to produce the x64 compatible ARM64EC view.
+type ARM64XReloc struct {
+	RVA   uint32
+	Type  uint8  // IMAGE_DVRT_ARM64X_FIXUP_TYPE_*
+	Size  int    // number of bytes a ZEROFILL or VALUE fixup writes
+	Value []byte // new contents of a VALUE fixup
+	Delta int64  // amount a DELTA fixup adds to the value at RVA
+}
+
+// rvaData returns the n bytes of raw data at rva.
+func (f *File) rvaData(rva, n uint32) ([]byte, error) {
+	s := f.sectionForRVA(rva)
+	if s == nil {
+		return nil, fmt.Errorf("RVA %#x is not inside any section", rva)
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	off := uint64(rva - s.VirtualAddress)
+	if off+uint64(n) > uint64(len(data)) {
+		return nil, fmt.Errorf("%d bytes at RVA %#x extend past the raw data of section %q", n, rva, s.Name)
+	}
+	return data[off : off+uint64(n)], nil
+}
+
+// loadConfig returns the load configuration directory of a 64-bit image,
+// or nil if there is none.
+func (f *File) loadConfig() ([]byte, error) {
+	if _, ok := f.OptionalHeader.(*OptionalHeader64); !ok {
+		return nil, nil
+	}
+	dd := f.dataDirectories()
+	if len(dd) <= IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG || dd[IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG].VirtualAddress == 0 {
+		return nil, nil
+	}
+	rva := dd[IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG].VirtualAddress
+	b, err := f.rvaData(rva, 4)
+	if err != nil {
+		return nil, err
+	}
+	// The Size field of the directory is authoritative; the data
+	// directory size is often that of an older layout.
+	return f.rvaData(rva, binary.LittleEndian.Uint32(b))
+}
+
+// HybridMetadata returns the ARM64EC metadata of an ARM64EC or ARM64X
+// image, or nil if the load configuration has no CHPEMetadataPointer.
+func (f *File) HybridMetadata() (*HybridMetadata, error) {
+	lc, err := f.loadConfig()
+	if err != nil || len(lc) < loadConfigCHPEMetadataPointer+8 {
+		return nil, err
+	}
+	va := binary.LittleEndian.Uint64(lc[loadConfigCHPEMetadataPointer:])
+	if va == 0 {
+		return nil, nil
+	}
+	if va < f.imageBase() || va-f.imageBase() > 1<<32-1 {
+		return nil, fmt.Errorf("CHPEMetadataPointer %#x is outside the image", va)
+	}
+	md := new(HybridMetadata)
+	b, err := f.rvaData(uint32(va-f.imageBase()), uint32(binary.Size(md.Arm64ECMetadata)))
+	if err != nil {
+		return nil, err
+	}
+	binary.Read(bytes.NewReader(b), binary.LittleEndian, &md.Arm64ECMetadata)
+	if md.Version == 0 {
+		return nil, errors.New("ARM64EC metadata version 0")
+	}
+
+	if md.CodeMapCount > 1<<24 {
+		return nil, fmt.Errorf("ARM64EC code map has %d entries", md.CodeMapCount)
+	}
+	b, err = f.rvaData(md.Arm64ECMetadata.CodeMap, 8*md.CodeMapCount)
+	if err != nil {
+		return nil, fmt.Errorf("ARM64EC code map: %v", err)
+	}
+	md.CodeRanges = make([]CodeRange, md.CodeMapCount)
+	for i := range md.CodeRanges {
+		start := binary.LittleEndian.Uint32(b[8*i:])
+		md.CodeRanges[i] = CodeRange{
+			RVA:    start &^ 3,
+			Length: binary.LittleEndian.Uint32(b[8*i+4:]),
+			Kind:   uint8(start & 3),
+		}
+	}
+	return md, nil
+}
+
+// dynamicRelocTable returns the section holding the dynamic value
+// relocation table, the offset of the table in its raw data and the size
+// of the table including its header, or a nil section if there is none.
+func (f *File) dynamicRelocTable() (*Section, uint32, uint32, error) {
+	lc, err := f.loadConfig()
+	if err != nil || len(lc) < loadConfigDynamicRelocFieldEnd {
+		return nil, 0, 0, err
+	}
+	off := binary.LittleEndian.Uint32(lc[loadConfigDynamicRelocOffset:])
+	idx := int(binary.LittleEndian.Uint16(lc[loadConfigDynamicRelocSection:]))
+	if idx == 0 {
+		return nil, 0, 0, nil
+	}
+	if idx > len(f.Sections) {
+		return nil, 0, 0, fmt.Errorf("dynamic value relocation table is in section %d of %d", idx, len(f.Sections))
+	}
+	s := f.Sections[idx-1]
+	data, err := s.Data()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if uint64(off)+8 > uint64(len(data)) {
+		return nil, 0, 0, fmt.Errorf("dynamic value relocation table at %#x is outside of section %q", off, s.Name)
+	}
+	size := binary.LittleEndian.Uint32(data[off+4:])
+	if uint64(off)+8+uint64(size) > uint64(len(data)) {
+		return nil, 0, 0, fmt.Errorf("dynamic value relocation table of %#x bytes extends past section %q", size, s.Name)
+	}
+	return s, off, 8 + size, nil
+}
+
+// ARM64XRelocs returns the ARM64X fixups of the dynamic value relocation
+// table of an ARM64X image, or nil if it has none.
+func (f *File) ARM64XRelocs() ([]ARM64XReloc, error) {
+	s, off, size, err := f.dynamicRelocTable()
+	if s == nil {
+		return nil, err
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	table := data[off : off+size]
+	if v := binary.LittleEndian.Uint32(table); v != 1 {
+		return nil, fmt.Errorf("unsupported dynamic value relocation table version %d", v)
+	}
+
+	var relocs []ARM64XReloc
+	for b := table[8:]; len(b) > 0; {
+		if len(b) < 12 {
+			return nil, errors.New("dynamic value relocation table is truncated")
+		}
+		symbol, n := binary.LittleEndian.Uint64(b), binary.LittleEndian.Uint32(b[8:])
+		b = b[12:]
+		if uint64(n) > uint64(len(b)) {
+			return nil, fmt.Errorf("dynamic relocations of symbol %d extend past the table", symbol)
+		}
+		if symbol == IMAGE_DYNAMIC_RELOCATION_ARM64X {
+			r, err := parseARM64XBlocks(b[:n])
+			if err != nil {
+				return nil, err
+			}
+			relocs = append(relocs, r...)
+		}
+		b = b[n:]
+	}
+	return relocs, nil
+}
+
+// parseARM64XBlocks decodes the relocation blocks of the ARM64X entry of
+// the dynamic value relocation table.
+func parseARM64XBlocks(b []byte) ([]ARM64XReloc, error) {
+	var relocs []ARM64XReloc
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return nil, errors.New("ARM64X relocation block is truncated")
+		}
+		page, n := binary.LittleEndian.Uint32(b), binary.LittleEndian.Uint32(b[4:])
+		if n < 8 || uint64(n) > uint64(len(b)) {
+			return nil, fmt.Errorf("ARM64X relocation block for page %#x has size %d", page, n)
+		}
+		for items := b[8:n]; len(items) >= 2; {
+			h := binary.LittleEndian.Uint16(items)
+			if h == 0 && len(items) == 2 {
+				break // padding to a 32-bit boundary
+			}
+			items = items[2:]
+			r := ARM64XReloc{RVA: page + uint32(h&0xfff), Type: uint8(h >> 12 & 3)}
+			switch r.Type {
+			case IMAGE_DVRT_ARM64X_FIXUP_TYPE_ZEROFILL:
+				r.Size = 1 << (h >> 14)
+			case IMAGE_DVRT_ARM64X_FIXUP_TYPE_VALUE:
+				r.Size = 1 << (h >> 14)
+				if len(items) < r.Size {
+					return nil, fmt.Errorf("ARM64X value fixup at %#x is truncated", r.RVA)
+				}
+				r.Value = append([]byte(nil), items[:r.Size]...)
+				items = items[r.Size:]
+			case IMAGE_DVRT_ARM64X_FIXUP_TYPE_DELTA:
+				if len(items) < 2 {
+					return nil, fmt.Errorf("ARM64X delta fixup at %#x is truncated", r.RVA)
+				}
+				r.Delta = int64(binary.LittleEndian.Uint16(items)) * 4
+				if h&(1<<14) != 0 {
+					r.Delta *= 2
+				}
+				if h&(1<<15) != 0 {
+					r.Delta = -r.Delta
+				}
+				items = items[2:]
+			default:
+				return nil, fmt.Errorf("ARM64X fixup at %#x has unknown type %d", r.RVA, r.Type)
+			}
+			relocs = append(relocs, r)
+		}
+		b = b[n:]
+	}
+	return relocs, nil
+}
+
+// validateHybrid reports problems with the hybrid metadata and ARM64X
+// relocations of f that would break the x64 compatible view of the image.
+func (f *File) validateHybrid(report func(Severity, string, ...interface{})) {
+	md, err := f.HybridMetadata()
+	if err != nil {
+		report(SeverityError, "hybrid metadata: %v", err)
+	}
+	if md != nil {
+		for _, r := range md.CodeRanges {
+			if s := f.sectionForRVA(r.RVA); s == nil || r.RVA+r.Length > s.VirtualAddress+s.virtualExtent() {
+				report(SeverityWarning, "ARM64EC code range %#x-%#x is not inside a section", r.RVA, r.RVA+r.Length)
+			}
+		}
+	}
+
+	relocs, err := f.ARM64XRelocs()
+	if err != nil {
+		report(SeverityError, "ARM64X relocations: %v", err)
+	}
+	_, _, sizeOfImage, _, _ := f.imageLayout()
+	for _, r := range relocs {
+		if uint64(r.RVA)+uint64(r.Size) > uint64(sizeOfImage) {
+			report(SeverityError, "ARM64X relocation at %#x is past SizeOfImage %#x", r.RVA, sizeOfImage)
+		}
+	}
+
+	s, off, size, _ := f.dynamicRelocTable()
+	if dd := f.dataDirectories(); s != nil && len(dd) > IMAGE_DIRECTORY_ENTRY_BASERELOC {
+		br, rva := dd[IMAGE_DIRECTORY_ENTRY_BASERELOC], s.VirtualAddress+off
+		if br.Size != 0 && br.VirtualAddress < rva+size && rva < br.VirtualAddress+br.Size {
+			report(SeverityError, "base relocation table overlaps the dynamic value relocation table at %#x", rva)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// makeHybrid adds sections to f with a load configuration that points at
+// ARM64EC metadata, and with a base relocation table followed by an ARM64X
+// dynamic value relocation table, the way linkers lay out hybrid images.
+func makeHybrid(t *testing.T, f *File) {
+	t.Helper()
+	le := binary.LittleEndian
+	lc, err := f.AddSection(".a64xrm", make([]byte, 0x200), IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloc, err := f.AddSection(".reloc", make([]byte, 52), IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ|IMAGE_SCN_MEM_DISCARDABLE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 0x200)
+	rva := lc.VirtualAddress
+
+	// Load configuration.
+	le.PutUint32(data, 0x140)
+	le.PutUint64(data[loadConfigCHPEMetadataPointer:], f.imageBase()+uint64(rva)+0x140)
+	le.PutUint32(data[loadConfigDynamicRelocOffset:], 12)
+	le.PutUint16(data[loadConfigDynamicRelocSection:], uint16(len(f.Sections)))
+
+	// ARM64EC metadata and code map.
+	binary.Write(bytes.NewBuffer(data[0x140:0x140]), le, Arm64ECMetadata{
+		Version: 1, CodeMap: rva + 0x1a0, CodeMapCount: 2, AlternateEntryPoint: 0x1010,
+	})
+	binary.Write(bytes.NewBuffer(data[0x1a0:0x1a0]), le, []uint32{0x1000 | CodeRangeARM64EC, 0x3000, 0x4000 | CodeRangeAMD64, 0x2860})
+	lc.Replace(bytes.NewReader(data), int64(len(data)))
+
+	// One base relocation block for .text, then the dynamic value
+	// relocation table, which patches the machine type, the entry point
+	// and the exception directory of the headers.
+	machine := uint16(f.OptionalHeaderOffset - 20)
+	entry := uint16(f.OptionalHeaderOffset + 16)
+	exception := uint16(f.OptionalHeaderOffset + 112 + 8*IMAGE_DIRECTORY_ENTRY_EXCEPTION)
+	var b bytes.Buffer
+	for _, v := range []interface{}{
+		uint32(0x1000), uint32(12), uint32(IMAGE_REL_BASED_DIR64 << 12),
+		uint32(1), uint32(32), // version, size
+		uint64(IMAGE_DYNAMIC_RELOCATION_ARM64X), uint32(20),
+		uint32(0), uint32(20), // page 0, block size
+		IMAGE_DVRT_ARM64X_FIXUP_TYPE_VALUE<<12 | 1<<14 | machine, uint16(IMAGE_FILE_MACHINE_AMD64),
+		IMAGE_DVRT_ARM64X_FIXUP_TYPE_DELTA<<12 | 1<<15 | entry, uint16(0x10),
+		IMAGE_DVRT_ARM64X_FIXUP_TYPE_ZEROFILL<<12 | 3<<14 | exception,
+		uint16(0), // padding
+	} {
+		binary.Write(&b, le, v)
+	}
+	reloc.Replace(bytes.NewReader(b.Bytes()), int64(b.Len()))
+
+	dd := f.dataDirectories()
+	dd[IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG] = DataDirectory{VirtualAddress: rva, Size: 0x140}
+	dd[IMAGE_DIRECTORY_ENTRY_BASERELOC] = DataDirectory{VirtualAddress: reloc.VirtualAddress, Size: 12}
+}
+
+func TestHybridMetadata(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if md, err := f.HybridMetadata(); md != nil || err != nil {
+		t.Fatalf("HybridMetadata() = %+v, %v for an x64 image", md, err)
+	}
+	makeHybrid(t, f)
+	f = reparse(t, f)
+
+	md, err := f.HybridMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md == nil || md.Version != 1 || md.AlternateEntryPoint != 0x1010 {
+		t.Fatalf("HybridMetadata() = %+v", md)
+	}
+	wantRanges := []CodeRange{{0x1000, 0x3000, CodeRangeARM64EC}, {0x4000, 0x2860, CodeRangeAMD64}}
+	if !reflect.DeepEqual(md.CodeRanges, wantRanges) {
+		t.Errorf("CodeRanges = %+v, want %+v", md.CodeRanges, wantRanges)
+	}
+
+	machine := uint32(f.OptionalHeaderOffset - 20)
+	wantRelocs := []ARM64XReloc{
+		{RVA: machine, Type: IMAGE_DVRT_ARM64X_FIXUP_TYPE_VALUE, Size: 2, Value: []byte{0x64, 0x86}},
+		{RVA: uint32(f.OptionalHeaderOffset + 16), Type: IMAGE_DVRT_ARM64X_FIXUP_TYPE_DELTA, Delta: -0x40},
+		{RVA: uint32(f.OptionalHeaderOffset + 136), Type: IMAGE_DVRT_ARM64X_FIXUP_TYPE_ZEROFILL, Size: 8},
+	}
+	relocs, err := f.ARM64XRelocs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(relocs, wantRelocs) {
+		t.Errorf("ARM64XRelocs() = %+v, want %+v", relocs, wantRelocs)
+	}
+	for _, issue := range f.Validate() {
+		if issue.Severity == SeverityError {
+			t.Errorf("unexpected issue: %v", issue)
+		}
+	}
+
+	// Growing the base relocations in place would overwrite the dynamic
+	// value relocation table that follows them.
+	for _, rva := range []uint32{0x2000, 0x3000} {
+		if err := f.AddBaseReloc(rva, IMAGE_REL_BASED_DIR64); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f = reparse(t, f)
+	if s := f.sectionForRVA(f.dataDirectories()[IMAGE_DIRECTORY_ENTRY_BASERELOC].VirtualAddress); s == nil || s.Name == ".reloc" {
+		t.Errorf("base relocations were not moved out of .reloc")
+	}
+	if relocs, err := f.ARM64XRelocs(); err != nil || !reflect.DeepEqual(relocs, wantRelocs) {
+		t.Errorf("ARM64XRelocs() = %+v, %v after adding base relocations", relocs, err)
+	}
+	if n := len(baseRelocs(f)); n != 3 {
+		t.Errorf("%d base relocations, want 3", n)
+	}
+}
+
+func TestValidateHybridOverlap(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	makeHybrid(t, f)
+	f.dataDirectories()[IMAGE_DIRECTORY_ENTRY_BASERELOC].Size = 0x28
+	if !findIssue(f.Validate(), SeverityError, "overlaps the dynamic value relocation table") {
+		t.Error("overlap of base and dynamic value relocations not reported")
+	}
+}
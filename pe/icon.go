@@ -0,0 +1,289 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Resource types of icons.
+const (
+	RT_ICON       = 3
+	RT_GROUP_ICON = 14
+)
+
+// An IconGroupEntry describes one image of an icon group
+// (GRPICONDIRENTRY). A Width or Height of 0 means 256 pixels.
+type IconGroupEntry struct {
+	Width      uint8
+	Height     uint8
+	ColorCount uint8
+	Reserved   uint8
+	Planes     uint16
+	BitCount   uint16
+	BytesInRes uint32
+	ID         uint16 // of the RT_ICON resource holding the image
+}
+
+// An IconGroup is one language of an RT_GROUP_ICON resource.
+type IconGroup struct {
+	Name     string // name of the group, or "" if it has an ID
+	ID       uint32
+	Lang     uint32
+	CodePage uint32
+	Entries  []IconGroupEntry
+}
+
+// grpIconDir is the header of an RT_GROUP_ICON resource, and of an .ico
+// file (ICONDIR).
+type grpIconDir struct {
+	Reserved uint16
+	Type     uint16 // 1 for icons
+	Count    uint16
+}
+
+// icoDirEntry is an entry of the directory of an .ico file.
+type icoDirEntry struct {
+	Width       uint8
+	Height      uint8
+	ColorCount  uint8
+	Reserved    uint8
+	Planes      uint16
+	BitCount    uint16
+	BytesInRes  uint32
+	ImageOffset uint32
+}
+
+var errNoIconGroup = errors.New("no icon group resource")
+
+// IconGroups returns the icon groups of f, one per group and language, in
+// resource order. The first one is the application icon.
+func (f *File) IconGroups() ([]IconGroup, error) {
+	root, err := f.resources()
+	if root == nil || err != nil {
+		return nil, err
+	}
+	var groups []IconGroup
+	for _, g := range iconGroupEntries(root) {
+		for _, l := range g.dir.entries {
+			if l.data == nil {
+				continue
+			}
+			entries, err := parseIconGroup(l.data.data)
+			if err != nil {
+				return nil, err
+			}
+			groups = append(groups, IconGroup{Name: g.name, ID: g.id, Lang: l.id, CodePage: l.data.codePage, Entries: entries})
+		}
+	}
+	return groups, nil
+}
+
+// iconGroupEntries returns the entries of the RT_GROUP_ICON directory of
+// the tree root that are directories of languages, in order.
+func iconGroupEntries(root *resourceDir) []*resourceEntry {
+	t := root.find("", RT_GROUP_ICON)
+	if t == nil || t.dir == nil {
+		return nil
+	}
+	t.dir.sort()
+	var groups []*resourceEntry
+	for _, g := range t.dir.entries {
+		if g.dir != nil {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+func parseIconGroup(b []byte) ([]IconGroupEntry, error) {
+	r := bytes.NewReader(b)
+	var hdr grpIconDir
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("icon group: %v", err)
+	}
+	if hdr.Type != 1 {
+		return nil, fmt.Errorf("icon group has type %d", hdr.Type)
+	}
+	entries := make([]IconGroupEntry, hdr.Count)
+	if err := binary.Read(r, binary.LittleEndian, entries); err != nil {
+		return nil, fmt.Errorf("icon group of %d entries: %v", hdr.Count, err)
+	}
+	return entries, nil
+}
+
+// iconImage is an image of an .ico file.
+type iconImage struct {
+	icoDirEntry
+	data []byte
+}
+
+func parseIco(ico []byte) ([]iconImage, error) {
+	r := bytes.NewReader(ico)
+	var hdr grpIconDir
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("icon file: %v", err)
+	}
+	if hdr.Reserved != 0 || hdr.Type != 1 || hdr.Count == 0 {
+		return nil, errors.New("not an icon file")
+	}
+	images := make([]iconImage, hdr.Count)
+	for i := range images {
+		e := &images[i].icoDirEntry
+		if err := binary.Read(r, binary.LittleEndian, e); err != nil {
+			return nil, fmt.Errorf("icon file directory: %v", err)
+		}
+		if uint64(e.ImageOffset)+uint64(e.BytesInRes) > uint64(len(ico)) {
+			return nil, fmt.Errorf("image %d of the icon file is out of range", i)
+		}
+		images[i].data = ico[e.ImageOffset : e.ImageOffset+e.BytesInRes]
+	}
+	return images, nil
+}
+
+// bitCount returns the colour depth of an image, which .ico files may
+// leave out of their directory.
+func (img *iconImage) bitCount() uint16 {
+	if img.BitCount != 0 {
+		return img.BitCount
+	}
+	if bytes.HasPrefix(img.data, []byte("\x89PNG")) {
+		return 32
+	}
+	if len(img.data) >= 16 {
+		return binary.LittleEndian.Uint16(img.data[14:]) // of the BITMAPINFOHEADER
+	}
+	return 0
+}
+
+// SetIcon replaces the application icon, the first icon group, with the
+// images of the .ico file ico. Every language of the group is rebuilt.
+// An image replaces the RT_ICON resource of a group entry of the same
+// dimensions and colour depth, keeping its ID; other images are added
+// as new RT_ICON resources with the language and code page of the group.
+// An image has the same ID in every language, and no ID holds two of
+// them. Icons only the old group used are removed.
+//
+// The resource tree is rewritten in place if it still fits, and is
+// otherwise moved to a new section.
+func (f *File) SetIcon(ico []byte) error {
+	images, err := parseIco(ico)
+	if err != nil {
+		return err
+	}
+	root, err := f.resources()
+	if err != nil {
+		return err
+	}
+	if root == nil {
+		return errNoIconGroup
+	}
+	groups := iconGroupEntries(root)
+	if len(groups) == 0 {
+		return errNoIconGroup
+	}
+	icons := root.subdir(RT_ICON)
+
+	nextID := uint32(1)
+	for _, e := range icons.entries {
+		if e.name == "" && e.id >= nextID {
+			nextID = e.id + 1
+		}
+	}
+
+	// An RT_ICON ID holds the same image in every language: imageIDs
+	// are the IDs the images got in the languages done so far, and
+	// idImage the image each of those IDs holds.
+	imageIDs := make([]uint32, len(images))
+	idImage := make(map[uint32]int)
+	set := make(map[*resourceEntry]bool)
+	unused := make(map[uint16]bool)
+	for _, l := range groups[0].dir.entries {
+		if l.data == nil {
+			continue
+		}
+		old, err := parseIconGroup(l.data.data)
+		if err != nil {
+			return err
+		}
+		var b bytes.Buffer
+		binary.Write(&b, binary.LittleEndian, grpIconDir{Type: 1, Count: uint16(len(images))})
+		taken := make([]bool, len(old))
+		for k, img := range images {
+			id := imageIDs[k]
+			for i, o := range old {
+				if id != 0 {
+					taken[i] = taken[i] || uint32(o.ID) == id
+					continue
+				}
+				if _, held := idImage[uint32(o.ID)]; !held && !taken[i] && o.Width == img.Width && o.Height == img.Height && o.BitCount == img.bitCount() {
+					taken[i], id = true, uint32(o.ID)
+				}
+			}
+			if id == 0 {
+				if nextID > 0xffff {
+					return errors.New("no free RT_ICON IDs")
+				}
+				id = nextID
+				nextID++
+			}
+			imageIDs[k], idImage[id] = id, k
+			setIconImage(icons.subdir(id), l.id, l.data.codePage, img.data, set)
+			binary.Write(&b, binary.LittleEndian, IconGroupEntry{
+				Width:      img.Width,
+				Height:     img.Height,
+				ColorCount: img.ColorCount,
+				Planes:     img.Planes,
+				BitCount:   img.bitCount(),
+				BytesInRes: uint32(len(img.data)),
+				ID:         uint16(id),
+			})
+		}
+		for i, o := range old {
+			if !taken[i] {
+				unused[o.ID] = true
+			}
+		}
+		l.data.data = b.Bytes()
+	}
+
+	// Keep icons another group still refers to.
+	for _, g := range groups {
+		for _, l := range g.dir.entries {
+			if l.data == nil {
+				continue
+			}
+			entries, err := parseIconGroup(l.data.data)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				delete(unused, e.ID)
+			}
+		}
+	}
+	for id := range unused {
+		if e := icons.find("", uint32(id)); e != nil {
+			icons.remove(e)
+		}
+	}
+	return f.setResources(root)
+}
+
+// setIconImage sets the image in the language lang of the directory of
+// an RT_ICON resource. An icon in a single other language is replaced
+// instead, as the loader falls back to it, unless it is in set, the
+// entries already set for other languages. The entry is added to set.
+func setIconImage(dir *resourceDir, lang, codePage uint32, data []byte, set map[*resourceEntry]bool) {
+	e := dir.find("", lang)
+	if e == nil && len(dir.entries) == 1 && dir.entries[0].data != nil && !set[dir.entries[0]] {
+		e = dir.entries[0]
+	}
+	if e == nil {
+		e = &resourceEntry{id: lang}
+		dir.entries = append(dir.entries, e)
+	}
+	e.data = &resourceData{data: data, codePage: codePage}
+	set[e] = true
+}
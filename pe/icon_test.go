@@ -0,0 +1,206 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// makeIco returns an .ico file with 32-bit images of the given sizes,
+// each filled with its size.
+func makeIco(sizes ...uint8) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, grpIconDir{Type: 1, Count: uint16(len(sizes))})
+	off := uint32(6 + 16*len(sizes))
+	for _, s := range sizes {
+		binary.Write(&b, binary.LittleEndian, icoDirEntry{Width: s, Height: s, Planes: 1, BitCount: 32, BytesInRes: uint32(s), ImageOffset: off})
+		off += uint32(s)
+	}
+	for _, s := range sizes {
+		b.Write(bytes.Repeat([]byte{s}, int(s)))
+	}
+	return b.Bytes()
+}
+
+// iconLeaf returns the resource type/id/lang of the tree root, or nil.
+func iconLeaf(root *resourceDir, typ, id, lang uint32) *resourceData {
+	for _, k := range []uint32{typ, id} {
+		e := root.find("", k)
+		if e == nil || e.dir == nil {
+			return nil
+		}
+		root = e.dir
+	}
+	if e := root.find("", lang); e != nil {
+		return e.data
+	}
+	return nil
+}
+
+func TestSetIcon(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Group 1 has 16x16 and 32x32 images in icons 1 and 2, and group 2
+	// shares icon 1.
+	group := func(ids ...uint16) []byte {
+		var b bytes.Buffer
+		binary.Write(&b, binary.LittleEndian, grpIconDir{Type: 1, Count: uint16(len(ids))})
+		for _, id := range ids {
+			s := uint8(16 * id)
+			binary.Write(&b, binary.LittleEndian, IconGroupEntry{Width: s, Height: s, Planes: 1, BitCount: 32, BytesInRes: uint32(s), ID: id})
+		}
+		return b.Bytes()
+	}
+	leaf := func(id, lang uint32, data []byte) *resourceEntry {
+		return &resourceEntry{id: id, dir: &resourceDir{entries: []*resourceEntry{
+			{id: lang, data: &resourceData{data: data, codePage: 1252}},
+		}}}
+	}
+	root := &resourceDir{entries: []*resourceEntry{
+		{id: RT_GROUP_ICON, dir: &resourceDir{entries: []*resourceEntry{
+			leaf(2, 0x409, group(1)),
+			leaf(1, 0x409, group(1, 2)),
+		}}},
+		{id: RT_ICON, dir: &resourceDir{entries: []*resourceEntry{
+			leaf(1, 0x409, bytes.Repeat([]byte{16}, 16)),
+			leaf(2, 0x409, bytes.Repeat([]byte{32}, 32)),
+		}}},
+	}}
+	if err := f.setResources(root); err != nil {
+		t.Fatal(err)
+	}
+	f = reparse(t, f)
+	groups, err := f.IconGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || groups[0].ID != 1 || groups[0].Lang != 0x409 || groups[0].CodePage != 1252 || len(groups[0].Entries) != 2 {
+		t.Fatalf("IconGroups() = %+v", groups)
+	}
+
+	// The 32x32 image replaces icon 2, the 48x48 one is added as icon 3
+	// and icon 1 stays for group 2.
+	if err := f.SetIcon(makeIco(32, 48)); err != nil {
+		t.Fatal(err)
+	}
+	n := len(f.Sections)
+	f = reparse(t, f)
+	if groups, err = f.IconGroups(); err != nil {
+		t.Fatal(err)
+	}
+	want := []IconGroupEntry{
+		{Width: 32, Height: 32, Planes: 1, BitCount: 32, BytesInRes: 32, ID: 2},
+		{Width: 48, Height: 48, Planes: 1, BitCount: 32, BytesInRes: 48, ID: 3},
+	}
+	if !reflect.DeepEqual(groups[0].Entries, want) {
+		t.Errorf("icon group is %+v, want %+v", groups[0].Entries, want)
+	}
+	if root, err = f.resources(); err != nil {
+		t.Fatal(err)
+	}
+	for id, size := range map[uint32]byte{1: 16, 2: 32, 3: 48} {
+		d := iconLeaf(root, RT_ICON, id, 0x409)
+		if d == nil || !bytes.Equal(d.data, bytes.Repeat([]byte{size}, int(size))) || d.codePage != 1252 {
+			t.Errorf("icon %d is %+v", id, d)
+		}
+	}
+
+	// Icons 2 and 3 are replaced by icon 4; the smaller tree is
+	// rewritten in place.
+	if err := f.SetIcon(makeIco(16)); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Sections) != n {
+		t.Errorf("SetIcon added a section for a smaller icon")
+	}
+	f = reparse(t, f)
+	if root, err = f.resources(); err != nil {
+		t.Fatal(err)
+	}
+	icons := root.find("", RT_ICON).dir
+	if len(icons.entries) != 2 || icons.entries[0].id != 1 || icons.entries[1].id != 4 {
+		t.Errorf("icons after replacing the group with a 16x16 icon: %+v", icons.entries)
+	}
+
+	if err := f.SetIcon([]byte("not an icon")); err == nil {
+		t.Error("SetIcon accepted a file that is not an icon")
+	}
+}
+
+func TestSetIconLanguages(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// In English icon 2 is 32x32, but the German group lists it as 48x48.
+	group := func(entries ...IconGroupEntry) *resourceData {
+		var b bytes.Buffer
+		binary.Write(&b, binary.LittleEndian, grpIconDir{Type: 1, Count: uint16(len(entries))})
+		for _, e := range entries {
+			binary.Write(&b, binary.LittleEndian, e)
+		}
+		return &resourceData{data: b.Bytes(), codePage: 1252}
+	}
+	entry := func(id uint16, size uint8) IconGroupEntry {
+		return IconGroupEntry{Width: size, Height: size, Planes: 1, BitCount: 32, BytesInRes: uint32(size), ID: id}
+	}
+	image := func(size uint8) *resourceData {
+		return &resourceData{data: bytes.Repeat([]byte{size}, int(size))}
+	}
+	root := &resourceDir{entries: []*resourceEntry{
+		{id: RT_GROUP_ICON, dir: &resourceDir{entries: []*resourceEntry{
+			{id: 1, dir: &resourceDir{entries: []*resourceEntry{
+				{id: 0x407, data: group(entry(1, 16), entry(2, 48))},
+				{id: 0x409, data: group(entry(1, 16), entry(2, 32))},
+			}}},
+		}}},
+		{id: RT_ICON, dir: &resourceDir{entries: []*resourceEntry{
+			{id: 1, dir: &resourceDir{entries: []*resourceEntry{{id: 0x409, data: image(16)}}}},
+			{id: 2, dir: &resourceDir{entries: []*resourceEntry{
+				{id: 0x407, data: image(48)},
+				{id: 0x409, data: image(32)},
+			}}},
+		}}},
+	}}
+	if err := f.setResources(root); err != nil {
+		t.Fatal(err)
+	}
+	f = reparse(t, f)
+
+	// The images get their IDs in German, the first language, and keep
+	// them in English, where icon 2 no longer holds the 32x32 image.
+	if err := f.SetIcon(makeIco(32, 48)); err != nil {
+		t.Fatal(err)
+	}
+	f = reparse(t, f)
+	groups, err := f.IconGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []IconGroupEntry{entry(3, 32), entry(2, 48)}
+	for _, g := range groups {
+		if !reflect.DeepEqual(g.Entries, want) {
+			t.Errorf("icon group in language %#x is %+v, want %+v", g.Lang, g.Entries, want)
+		}
+	}
+	if root, err = f.resources(); err != nil {
+		t.Fatal(err)
+	}
+	for _, lang := range []uint32{0x407, 0x409} {
+		for id, size := range map[uint32]uint8{2: 48, 3: 32} {
+			if d := iconLeaf(root, RT_ICON, id, lang); d == nil || !bytes.Equal(d.data, image(size).data) {
+				t.Errorf("icon %d in language %#x is %+v", id, lang, d)
+			}
+		}
+	}
+	if iconLeaf(root, RT_ICON, 1, 0x409) != nil {
+		t.Error("unused icon 1 was kept")
+	}
+}
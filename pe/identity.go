@@ -0,0 +1,268 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// RT_VERSION is the resource type of the VS_VERSIONINFO resource.
+const RT_VERSION = 16
+
+// CloneIdentity copies the metadata that identifies a build from src onto
+// f: the link timestamp, the linker, OS, image and subsystem versions of
+// the optional header, the Rich header and the version resource.
+//
+// Debug and export directory timestamps that matched the old link
+// timestamp are updated with it. The version resource of f is replaced in
+// place when the one of src fits, and otherwise moved to a new section; a
+// file without a version resource does not get one. The checksum and any
+// signature of f are not updated.
+func (f *File) CloneIdentity(src *File) error {
+	if f.OptionalHeader == nil || src.OptionalHeader == nil {
+		return errors.New("cannot clone the identity of a file without an optional header")
+	}
+
+	if err := f.setRichHeader(src.RichHeader); err != nil {
+		return err
+	}
+	if err := f.setTimeDateStamp(src.FileHeader.TimeDateStamp); err != nil {
+		return err
+	}
+	f.setVersions(src.versions())
+
+	version, err := src.VersionResource()
+	if err != nil {
+		return err
+	}
+	if version != nil {
+		if err := f.SetVersionResource(version); err != nil && err != errNoVersionResource {
+			return err
+		}
+	}
+	return nil
+}
+
+// imageVersions holds the version fields of an optional header.
+type imageVersions struct {
+	linker           [2]uint8
+	os, image, subsy [2]uint16
+}
+
+func (f *File) versions() imageVersions {
+	var v imageVersions
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		v.linker = [2]uint8{oh.MajorLinkerVersion, oh.MinorLinkerVersion}
+		v.os = [2]uint16{oh.MajorOperatingSystemVersion, oh.MinorOperatingSystemVersion}
+		v.image = [2]uint16{oh.MajorImageVersion, oh.MinorImageVersion}
+		v.subsy = [2]uint16{oh.MajorSubsystemVersion, oh.MinorSubsystemVersion}
+	case *OptionalHeader64:
+		v.linker = [2]uint8{oh.MajorLinkerVersion, oh.MinorLinkerVersion}
+		v.os = [2]uint16{oh.MajorOperatingSystemVersion, oh.MinorOperatingSystemVersion}
+		v.image = [2]uint16{oh.MajorImageVersion, oh.MinorImageVersion}
+		v.subsy = [2]uint16{oh.MajorSubsystemVersion, oh.MinorSubsystemVersion}
+	}
+	return v
+}
+
+func (f *File) setVersions(v imageVersions) {
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		oh.MajorLinkerVersion, oh.MinorLinkerVersion = v.linker[0], v.linker[1]
+		oh.MajorOperatingSystemVersion, oh.MinorOperatingSystemVersion = v.os[0], v.os[1]
+		oh.MajorImageVersion, oh.MinorImageVersion = v.image[0], v.image[1]
+		oh.MajorSubsystemVersion, oh.MinorSubsystemVersion = v.subsy[0], v.subsy[1]
+	case *OptionalHeader64:
+		oh.MajorLinkerVersion, oh.MinorLinkerVersion = v.linker[0], v.linker[1]
+		oh.MajorOperatingSystemVersion, oh.MinorOperatingSystemVersion = v.os[0], v.os[1]
+		oh.MajorImageVersion, oh.MinorImageVersion = v.image[0], v.image[1]
+		oh.MajorSubsystemVersion, oh.MinorSubsystemVersion = v.subsy[0], v.subsy[1]
+	}
+}
+
+// setRichHeader replaces the Rich header, which has to fit between the
+// DOS stub and the PE header. A nil rich removes it.
+func (f *File) setRichHeader(rich []byte) error {
+	start := binary.Size(f.DosHeader)
+	if f.DosExists {
+		start += binary.Size(f.DosStub)
+	}
+	if start+len(rich) > int(f.DosHeader.AddressOfNewExeHeader) {
+		return fmt.Errorf("Rich header of %d bytes does not fit before the PE header at %#x", len(rich), f.DosHeader.AddressOfNewExeHeader)
+	}
+	f.RichHeader = append([]byte(nil), rich...)
+	return nil
+}
+
+// setTimeDateStamp sets the link timestamp of the file header, and of the
+// debug and export directories where they had the same value.
+func (f *File) setTimeDateStamp(ts uint32) error {
+	old := f.FileHeader.TimeDateStamp
+	f.FileHeader.TimeDateStamp = ts
+
+	// IMAGE_DEBUG_DIRECTORY entries are 28 bytes, with TimeDateStamp at
+	// offset 4, as is the one of the export directory.
+	for _, dir := range []struct {
+		entry, entrySize uint32
+	}{
+		{IMAGE_DIRECTORY_ENTRY_DEBUG, 28},
+		{IMAGE_DIRECTORY_ENTRY_EXPORT, 0},
+	} {
+		ds, dd := f.sectionFromDirectoryEntry(dir.entry)
+		if ds == nil || dd.Size == 0 {
+			continue
+		}
+		data, err := ds.Data()
+		if err != nil {
+			return err
+		}
+		size := dir.entrySize
+		if size == 0 {
+			size = dd.Size
+		}
+		changed := false
+		start := dd.VirtualAddress - ds.VirtualAddress
+		for off := start; off+size <= start+dd.Size && int(off+size) <= len(data); off += size {
+			if binary.LittleEndian.Uint32(data[off+4:]) == old {
+				binary.LittleEndian.PutUint32(data[off+4:], ts)
+				changed = true
+			}
+		}
+		if changed {
+			ds.Replace(bytes.NewReader(data), int64(len(data)))
+		}
+	}
+	return nil
+}
+
+var errNoVersionResource = errors.New("no version resource")
+
+// versionResourceEntry locates the IMAGE_RESOURCE_DATA_ENTRY of the
+// first version resource. It returns the section holding the entry and
+// the offset of the entry in the section's data, or a nil section if
+// there is no version resource.
+func (f *File) versionResourceEntry() (*Section, []byte, uint32, error) {
+	ds, dd := f.sectionFromDirectoryEntry(IMAGE_DIRECTORY_ENTRY_RESOURCE)
+	if ds == nil || dd.Size == 0 {
+		return nil, nil, 0, nil
+	}
+	data, err := ds.Data()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	base := dd.VirtualAddress - ds.VirtualAddress
+
+	// The resource tree has three levels: type, name and language. Take
+	// the RT_VERSION type, then the first name and language.
+	off := base
+	for level := 0; level < 3; level++ {
+		if int(off)+16 > len(data) {
+			return nil, nil, 0, fmt.Errorf("resource directory at %#x is out of range", off)
+		}
+		n := uint32(binary.LittleEndian.Uint16(data[off+12:])) + uint32(binary.LittleEndian.Uint16(data[off+14:]))
+		next := uint32(0)
+		found := false
+		for i := uint32(0); i < n; i++ {
+			e := off + 16 + 8*i
+			if int(e)+8 > len(data) {
+				return nil, nil, 0, fmt.Errorf("resource directory entry at %#x is out of range", e)
+			}
+			id := binary.LittleEndian.Uint32(data[e:])
+			if level == 0 && id != RT_VERSION {
+				continue
+			}
+			next, found = binary.LittleEndian.Uint32(data[e+4:]), true
+			break
+		}
+		if !found {
+			return nil, nil, 0, nil
+		}
+		// Subdirectories have the high bit set; leaves are data entries.
+		if (level < 2) != (next&0x80000000 != 0) {
+			return nil, nil, 0, fmt.Errorf("unexpected resource tree layout at level %d", level)
+		}
+		off = base + next&0x7fffffff
+	}
+	if int(off)+16 > len(data) {
+		return nil, nil, 0, fmt.Errorf("resource data entry at %#x is out of range", off)
+	}
+	return ds, data, off, nil
+}
+
+// VersionResource returns the contents of the first version resource
+// (VS_VERSIONINFO), or nil if the file has none.
+func (f *File) VersionResource() ([]byte, error) {
+	_, data, off, err := f.versionResourceEntry()
+	if data == nil || err != nil {
+		return nil, err
+	}
+	rva := binary.LittleEndian.Uint32(data[off:])
+	size := binary.LittleEndian.Uint32(data[off+4:])
+	s := f.sectionForRVA(rva)
+	if s == nil {
+		return nil, fmt.Errorf("version resource at RVA %#x is not in a section", rva)
+	}
+	sdata, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	start := rva - s.VirtualAddress
+	if uint64(start)+uint64(size) > uint64(len(sdata)) {
+		return nil, fmt.Errorf("version resource at RVA %#x is truncated", rva)
+	}
+	return append([]byte(nil), sdata[start:start+size]...), nil
+}
+
+// SetVersionResource replaces the contents of the first version resource
+// with version. If it is larger than the resource it replaces, it is put
+// in a new section instead. The file must already have a version
+// resource.
+func (f *File) SetVersionResource(version []byte) error {
+	ds, data, off, err := f.versionResourceEntry()
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return errNoVersionResource
+	}
+	rva := binary.LittleEndian.Uint32(data[off:])
+	size := binary.LittleEndian.Uint32(data[off+4:])
+
+	if uint32(len(version)) > size {
+		s, err := f.AddSection(".rsrcv", version, IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ)
+		if err != nil {
+			return err
+		}
+		// AddSection may have moved the raw data of the resource section.
+		if data, err = ds.Data(); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint32(data[off:], s.VirtualAddress)
+	} else {
+		s := f.sectionForRVA(rva)
+		if s == nil {
+			return fmt.Errorf("version resource at RVA %#x is not in a section", rva)
+		}
+		sdata, err := s.Data()
+		if err != nil {
+			return err
+		}
+		start := rva - s.VirtualAddress
+		if uint64(start)+uint64(size) > uint64(len(sdata)) {
+			return fmt.Errorf("version resource at RVA %#x is truncated", rva)
+		}
+		copy(sdata[start:start+size], version)
+		for i := start + uint32(len(version)); i < start+size; i++ {
+			sdata[i] = 0
+		}
+		s.Replace(bytes.NewReader(sdata), int64(len(sdata)))
+		if s == ds {
+			data = sdata
+		}
+	}
+	binary.LittleEndian.PutUint32(data[off+4:], uint32(len(version)))
+	ds.Replace(bytes.NewReader(data), int64(len(data)))
+	return nil
+}
@@ -0,0 +1,115 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// addVersionResource gives f a resource section holding a single version
+// resource with the given contents.
+func addVersionResource(t *testing.T, f *File, version []byte) {
+	const dataOff = 0x58
+	rsrc := make([]byte, dataOff+len(version))
+	s, err := f.AddSection(".rsrc", rsrc, IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One directory per level, each with a single ID entry.
+	for i, e := range [][2]uint32{
+		{RT_VERSION, 0x80000000 | 0x18},
+		{1, 0x80000000 | 0x30},
+		{0x409, 0x48},
+	} {
+		dir := rsrc[0x18*i:]
+		binary.LittleEndian.PutUint16(dir[14:], 1)
+		binary.LittleEndian.PutUint32(dir[16:], e[0])
+		binary.LittleEndian.PutUint32(dir[20:], e[1])
+	}
+	binary.LittleEndian.PutUint32(rsrc[0x48:], s.VirtualAddress+dataOff)
+	binary.LittleEndian.PutUint32(rsrc[0x4c:], uint32(len(version)))
+	copy(rsrc[dataOff:], version)
+	data, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(data, rsrc)
+	s.Replace(bytes.NewReader(data), int64(len(data)))
+	f.dataDirectories()[IMAGE_DIRECTORY_ENTRY_RESOURCE] = DataDirectory{VirtualAddress: s.VirtualAddress, Size: uint32(len(rsrc))}
+}
+
+func TestVersionResource(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if v, err := f.VersionResource(); v != nil || err != nil {
+		t.Fatalf("VersionResource = %q, %v; want none", v, err)
+	}
+	if err := f.SetVersionResource([]byte("x")); err == nil {
+		t.Error("SetVersionResource succeeded without a version resource")
+	}
+
+	addVersionResource(t, f, bytes.Repeat([]byte{'a'}, 32))
+	g := reparse(t, f)
+	if v, err := g.VersionResource(); err != nil || !bytes.Equal(v, bytes.Repeat([]byte{'a'}, 32)) {
+		t.Fatalf("VersionResource = %q, %v", v, err)
+	}
+
+	// A smaller resource is replaced in place, a larger one moved.
+	n := len(g.Sections)
+	for _, want := range [][]byte{
+		bytes.Repeat([]byte{'b'}, 16),
+		bytes.Repeat([]byte{'c'}, 100),
+	} {
+		if err := g.SetVersionResource(want); err != nil {
+			t.Fatal(err)
+		}
+		g = reparse(t, g)
+		if v, err := g.VersionResource(); err != nil || !bytes.Equal(v, want) {
+			t.Errorf("VersionResource = %q, %v; want %q", v, err, want)
+		}
+	}
+	if len(g.Sections) != n+1 {
+		t.Errorf("got %d sections, want %d", len(g.Sections), n+1)
+	}
+}
+
+func TestCloneIdentity(t *testing.T) {
+	dst, err := Open("testdata/gcc-386-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	src, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	version := []byte("VS_VERSION_INFO of the donor")
+	addVersionResource(t, dst, make([]byte, 64))
+	addVersionResource(t, src, version)
+	src.OptionalHeader.(*OptionalHeader64).MajorImageVersion = 7
+
+	if err := dst.CloneIdentity(src); err != nil {
+		t.Fatal(err)
+	}
+	g := reparse(t, dst)
+	if g.TimeDateStamp != src.TimeDateStamp {
+		t.Errorf("TimeDateStamp = %#x, want %#x", g.TimeDateStamp, src.TimeDateStamp)
+	}
+	if oh := g.OptionalHeader.(*OptionalHeader32); oh.MajorImageVersion != 7 || oh.MajorLinkerVersion != src.OptionalHeader.(*OptionalHeader64).MajorLinkerVersion {
+		t.Errorf("versions were not copied: %+v", oh)
+	}
+	if v, err := g.VersionResource(); err != nil || !bytes.Equal(v, version) {
+		t.Errorf("VersionResource = %q, %v; want %q", v, err, version)
+	}
+
+	// There is no room for a Rich header in these files.
+	src.RichHeader = make([]byte, 32)
+	if err := dst.CloneIdentity(src); err == nil {
+		t.Error("CloneIdentity added a Rich header that does not fit")
+	}
+}
@@ -0,0 +1,130 @@
+package pe
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ImpHash returns the import hash of f in the scheme used by most triage
+// tools: the MD5, in hex, of the comma-separated list of "dll.function"
+// strings of the import lookup tables in order, lower-cased, with the
+// ".dll", ".ocx" or ".sys" extension of the DLL removed. Symbols imported
+// by ordinal are named "ordN", except for the Windows Sockets 1.1 ordinals
+// of ws2_32.dll and wsock32.dll, which are resolved to their function
+// names.
+//
+// pefile resolves more ordinals, those of oleaut32.dll and the rest of
+// ws2_32.dll, so the hashes of files that import those by ordinal differ
+// from the ones it computes.
+//
+// It returns "" if f imports nothing.
+func (f *File) ImpHash() (string, error) {
+	entries, err := f.importEntries()
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", nil
+	}
+	parts := make([]string, len(entries))
+	for i, e := range entries {
+		dll := strings.ToLower(e.dll)
+		lib := dll
+		if j := strings.LastIndex(lib, "."); j >= 0 {
+			switch lib[j+1:] {
+			case "dll", "ocx", "sys":
+				lib = lib[:j]
+			}
+		}
+		name := e.name
+		if e.byOrdinal {
+			name = ordinalName(dll, e.ordinal)
+		}
+		parts[i] = lib + "." + strings.ToLower(name)
+	}
+	sum := md5.Sum([]byte(strings.Join(parts, ",")))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// RichHash returns the MD5, in hex, of the unmasked Rich header of f, from
+// its "DanS" marker up to "Rich". It is the hash YARA computes over
+// pe.rich_signature.clear_data.
+func (f *File) RichHash() (string, error) {
+	if f.RichHeader == nil {
+		return "", errors.New("no Rich header")
+	}
+	clear, _, ok := richClearData(f.RichHeader)
+	if !ok {
+		return "", errors.New("malformed Rich header")
+	}
+	sum := md5.Sum(clear)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ordinalName returns the name of the symbol that the lower-cased dll
+// exports with ordinal ord, or "ordN" if it is not known.
+func ordinalName(dll string, ord uint16) string {
+	switch dll {
+	case "ws2_32.dll", "wsock32.dll":
+		if name, ok := winsockOrdinals[ord]; ok {
+			return name
+		}
+	}
+	return fmt.Sprintf("ord%d", ord)
+}
+
+// winsockOrdinals are the Windows Sockets 1.1 functions by the ordinals
+// that ws2_32.dll and wsock32.dll both keep.
+var winsockOrdinals = map[uint16]string{
+	1:   "accept",
+	2:   "bind",
+	3:   "closesocket",
+	4:   "connect",
+	5:   "getpeername",
+	6:   "getsockname",
+	7:   "getsockopt",
+	8:   "htonl",
+	9:   "htons",
+	10:  "ioctlsocket",
+	11:  "inet_addr",
+	12:  "inet_ntoa",
+	13:  "listen",
+	14:  "ntohl",
+	15:  "ntohs",
+	16:  "recv",
+	17:  "recvfrom",
+	18:  "select",
+	19:  "send",
+	20:  "sendto",
+	21:  "setsockopt",
+	22:  "shutdown",
+	23:  "socket",
+	51:  "gethostbyaddr",
+	52:  "gethostbyname",
+	53:  "getprotobyname",
+	54:  "getprotobynumber",
+	55:  "getservbyname",
+	56:  "getservbyport",
+	57:  "gethostname",
+	101: "WSAAsyncSelect",
+	102: "WSAAsyncGetHostByAddr",
+	103: "WSAAsyncGetHostByName",
+	104: "WSAAsyncGetProtoByNumber",
+	105: "WSAAsyncGetProtoByName",
+	106: "WSAAsyncGetServByPort",
+	107: "WSAAsyncGetServByName",
+	108: "WSACancelAsyncRequest",
+	109: "WSASetBlockingHook",
+	110: "WSAUnhookBlockingHook",
+	111: "WSAGetLastError",
+	112: "WSASetLastError",
+	113: "WSACancelBlockingCall",
+	114: "WSAIsBlocking",
+	115: "WSAStartup",
+	116: "WSACleanup",
+	151: "__WSAFDIsSet",
+	500: "WEP",
+}
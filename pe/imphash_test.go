@@ -0,0 +1,77 @@
+package pe
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestImpHash(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	syms, err := f.ImportedSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parts []string
+	for _, s := range syms {
+		i := strings.LastIndex(s, ":")
+		parts = append(parts, strings.ToLower(strings.TrimSuffix(s[i+1:], ".dll")+"."+s[:i]))
+	}
+	if parts[0] != "kernel32.deletecriticalsection" {
+		t.Fatalf("first import is %q", parts[0])
+	}
+	sum := md5.Sum([]byte(strings.Join(parts, ",")))
+	if h, err := f.ImpHash(); err != nil || h != hex.EncodeToString(sum[:]) {
+		t.Errorf("ImpHash = %q, %v; want %x", h, err, sum)
+	}
+
+	obj, err := Open("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	if h, err := obj.ImpHash(); err != nil || h != "" {
+		t.Errorf("ImpHash of an object file = %q, %v", h, err)
+	}
+
+	for _, tt := range []struct {
+		dll  string
+		ord  uint16
+		want string
+	}{
+		{"ws2_32.dll", 115, "WSAStartup"},
+		{"wsock32.dll", 3, "closesocket"},
+		{"ws2_32.dll", 400, "ord400"},
+		{"kernel32.dll", 1, "ord1"},
+	} {
+		if got := ordinalName(tt.dll, tt.ord); got != tt.want {
+			t.Errorf("ordinalName(%q, %d) = %q, want %q", tt.dll, tt.ord, got, tt.want)
+		}
+	}
+}
+
+func TestRichHash(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.RichHash(); err == nil {
+		t.Error("RichHash succeeded without a Rich header")
+	}
+	f.RichHeader = richHeader(0xdeadbeef, RichEntry{ProductID: 0x104, Build: 30729, Count: 3})
+	clear := make([]byte, 24)
+	copy(clear, "DanS")
+	binary.LittleEndian.PutUint32(clear[16:], 0x104<<16|30729)
+	binary.LittleEndian.PutUint32(clear[20:], 3)
+	sum := md5.Sum(clear)
+	if h, err := f.RichHash(); err != nil || h != hex.EncodeToString(sum[:]) {
+		t.Errorf("RichHash = %q, %v; want %x", h, err, sum)
+	}
+}
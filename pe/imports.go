@@ -37,6 +37,10 @@ func (f *File) IAT() *DataDirectory {
 }
 
 // ImportDirectoryTable - returns the Import Directory Table, a pointer to the section, and the section raw data
+//
+// The directory is found through the import data directory, whichever
+// section holds it; linkers often merge it into .rdata or .text rather
+// than an .idata section. The names it refers to may be in other sections.
 func (f *File) ImportDirectoryTable() ([]ImportDirectory, *Section, *[]byte, error) {
 
 	ds, idd := f.sectionFromDirectoryEntry(IMAGE_DIRECTORY_ENTRY_IMPORT)
@@ -46,24 +50,28 @@ func (f *File) ImportDirectoryTable() ([]ImportDirectory, *Section, *[]byte, err
 		return nil, nil, nil, nil
 	}
 
-	sectionData, err := ds.Data()
+	r := newRVAReader(f)
+	sectionData, err := r.section(ds)
 	if err != nil {
 		return nil, nil, nil, err
 	}
+	if idd.VirtualAddress-ds.VirtualAddress > uint32(len(sectionData)) {
+		return nil, nil, nil, fmt.Errorf("import directory at %#x is past the raw data of section %s", idd.VirtualAddress, ds.Name)
+	}
 
 	// seek to the virtual address specified in the import data directory
 	d := sectionData[idd.VirtualAddress-ds.VirtualAddress:]
 
 	// start decoding the import directory
 	var ida []ImportDirectory
-	for len(d) > 0 {
+	for len(d) >= 20 {
 		var dt ImportDirectory
 		dt.OriginalFirstThunk = binary.LittleEndian.Uint32(d[0:4])
 		dt.TimeDateStamp = binary.LittleEndian.Uint32(d[4:8])
 		dt.ForwarderChain = binary.LittleEndian.Uint32(d[8:12])
 		dt.NameRVA = binary.LittleEndian.Uint32(d[12:16])
 		dt.FirstThunk = binary.LittleEndian.Uint32(d[16:20])
-		dt.DllName, _ = getString(sectionData, int(dt.NameRVA-ds.VirtualAddress))
+		dt.DllName, _ = r.str(dt.NameRVA)
 		d = d[20:]
 		if dt.OriginalFirstThunk == 0 {
 			break
@@ -78,54 +86,131 @@ func (f *File) ImportDirectoryTable() ([]ImportDirectory, *Section, *[]byte, err
 // satisfied by other libraries at dynamic load time.
 // It does not return weak symbols.
 func (f *File) ImportedSymbols() ([]string, error) {
-	pe64 := f.Machine == IMAGE_FILE_MACHINE_AMD64
+	entries, err := f.importEntries()
+	var all []string
+	for _, e := range entries {
+		// TODO add dynimport ordinal support.
+		if !e.byOrdinal {
+			all = append(all, e.name+":"+e.dll)
+		}
+	}
+	return all, err
+}
 
-	ida, ds, sectionData, err := f.ImportDirectoryTable()
+// An importEntry is an entry of the import lookup table of a DLL, which
+// imports a symbol by name or by ordinal.
+type importEntry struct {
+	dll       string
+	name      string
+	ordinal   uint16
+	byOrdinal bool
+}
+
+// importEntries returns the entries of the import lookup tables of f, in
+// order. On error, it returns the entries decoded so far.
+func (f *File) importEntries() ([]importEntry, error) {
+	if f.OptionalHeader == nil {
+		// An object file has no import directory.
+		return nil, nil
+	}
+	pe64 := f.is64()
+
+	ida, _, _, err := f.ImportDirectoryTable()
 	if err != nil {
 		return nil, err
 	}
 
-	var all []string
+	r := newRVAReader(f)
+	var all []importEntry
 	for _, dt := range ida {
-		d := (*sectionData)[:]
 		// seek to OriginalFirstThunk
-		if dt.OriginalFirstThunk-ds.VirtualAddress > uint32(len(d)) {
-			return all, fmt.Errorf("bad object ref start, got %d maxlen %d", dt.OriginalFirstThunk-ds.VirtualAddress, len(d))
+		d, err := r.at(dt.OriginalFirstThunk)
+		if err != nil {
+			return all, fmt.Errorf("bad object ref start: %v", err)
 		}
-		d = d[dt.OriginalFirstThunk-ds.VirtualAddress:]
 		for len(d) > 0 {
+			var va uint64
+			var ordinal bool
 			if pe64 { // 64bit
-				va := binary.LittleEndian.Uint64(d[0:8])
-				d = d[8:]
-				if va == 0 {
+				if len(d) < 8 {
 					break
 				}
-				if va&0x8000000000000000 > 0 { // is Ordinal
-					// TODO add dynimport ordinal support.
-				} else {
-					fn, _ := getString(*sectionData, int(uint32(va)-ds.VirtualAddress+2))
-					all = append(all, fn+":"+dt.DllName)
-				}
+				va = binary.LittleEndian.Uint64(d[0:8])
+				d = d[8:]
+				ordinal = va&0x8000000000000000 > 0
 			} else { // 32bit
-				va := binary.LittleEndian.Uint32(d[0:4])
-				d = d[4:]
-				if va == 0 {
+				if len(d) < 4 {
 					break
 				}
-				if va&0x80000000 > 0 { // is Ordinal
-					// TODO add dynimport ordinal support.
-					//ord := va&0x0000FFFF
-				} else {
-					fn, _ := getString(*sectionData, int(va-ds.VirtualAddress+2))
-					all = append(all, fn+":"+dt.DllName)
-				}
+				va = uint64(binary.LittleEndian.Uint32(d[0:4]))
+				d = d[4:]
+				ordinal = va&0x80000000 > 0
 			}
+			if va == 0 {
+				break
+			}
+			e := importEntry{dll: dt.DllName, byOrdinal: ordinal}
+			if ordinal {
+				e.ordinal = uint16(va)
+			} else {
+				e.name, _ = r.str(uint32(va) + 2)
+			}
+			all = append(all, e)
 		}
 	}
 
 	return all, nil
 }
 
+// An rvaReader reads the raw data of the sections of a file by RVA,
+// reading each section once.
+type rvaReader struct {
+	f    *File
+	data map[*Section][]byte
+}
+
+func newRVAReader(f *File) *rvaReader {
+	return &rvaReader{f: f, data: make(map[*Section][]byte)}
+}
+
+// section returns the raw data of s.
+func (r *rvaReader) section(s *Section) ([]byte, error) {
+	if d, ok := r.data[s]; ok {
+		return d, nil
+	}
+	d, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	r.data[s] = d
+	return d, nil
+}
+
+// at returns the raw data from rva to the end of the section holding it.
+func (r *rvaReader) at(rva uint32) ([]byte, error) {
+	s := r.f.sectionForRVA(rva)
+	if s == nil {
+		return nil, fmt.Errorf("RVA %#x is not inside any section", rva)
+	}
+	d, err := r.section(s)
+	if err != nil {
+		return nil, err
+	}
+	if off := rva - s.VirtualAddress; off < uint32(len(d)) {
+		return d[off:], nil
+	}
+	return nil, fmt.Errorf("RVA %#x is past the raw data of section %s", rva, s.Name)
+}
+
+// str returns the NUL-terminated string at rva.
+func (r *rvaReader) str(rva uint32) (string, bool) {
+	d, err := r.at(rva)
+	if err != nil {
+		return "", false
+	}
+	return getString(d, 0)
+}
+
 // ImportedLibraries returns the names of all libraries
 // referred to by the binary f that are expected to be
 // linked with the binary at dynamic link time.
@@ -142,29 +227,13 @@ func (f *File) ImportedLibraries() ([]string, error) {
 }
 
 func (f File) sectionFromDirectoryEntry(directory uint32) (*Section, DataDirectory) {
-	pe64 := f.Machine == IMAGE_FILE_MACHINE_AMD64
-
-	// grab the number of data directory entries
-	var ddLength uint32
-	if pe64 {
-		ddLength = f.OptionalHeader.(*OptionalHeader64).NumberOfRvaAndSizes
-	} else {
-		ddLength = f.OptionalHeader.(*OptionalHeader32).NumberOfRvaAndSizes
-	}
-
-	// check that the length of data directory entries is large
-	// enough to include the directory.
-	if ddLength < directory+1 {
+	// check that the data directory, if there is one, is large enough to
+	// include the directory.
+	dd := f.dataDirectories()
+	if uint32(len(dd)) < directory+1 {
 		return nil, DataDirectory{}
 	}
-
-	// grab the directory entry
-	var idd DataDirectory
-	if pe64 {
-		idd = f.OptionalHeader.(*OptionalHeader64).DataDirectory[directory]
-	} else {
-		idd = f.OptionalHeader.(*OptionalHeader32).DataDirectory[directory]
-	}
+	idd := dd[directory]
 
 	// figure out which section contains the directory table
 	var ds *Section
@@ -191,11 +260,15 @@ func (f *File) ImportDelayDirectoryTable() ([]ImgDelayDescr, *Section, *[]byte,
 	if err != nil {
 		return nil, nil, nil, err
 	}
+	if idd.VirtualAddress-ds.VirtualAddress > uint32(len(sectionData)) {
+		return nil, nil, nil, fmt.Errorf("delay import directory at %#x is past the raw data of section %s", idd.VirtualAddress, ds.Name)
+	}
 
 	// seek to the virtual address specified in the import data directory
 	d := sectionData[idd.VirtualAddress-ds.VirtualAddress:]
+	r := newRVAReader(f)
 	var dida []ImgDelayDescr
-	for len(d) > 0 {
+	for len(d) >= 32 {
 		var dt ImgDelayDescr
 		idx := 0
 		dt.GrAttrs = binary.LittleEndian.Uint32(d[idx*4 : (idx*4)+4])
@@ -219,7 +292,7 @@ func (f *File) ImportDelayDirectoryTable() ([]ImgDelayDescr, *Section, *[]byte,
 		if dt.DwTimeStamp|dt.GrAttrs|dt.RVADLLName|dt.RVAHmod|dt.RVAIAT|dt.RVAINT|dt.RVABoundIAT|dt.RVAUnloadIAT|dt.DwTimeStamp == 0 {
 			break
 		}
-		if s, ok := getString(sectionData, int(dt.RVADLLName-ds.VirtualAddress)); ok {
+		if s, ok := r.str(dt.RVADLLName); ok {
 			dt.DllName = s
 		}
 		d = d[32:]
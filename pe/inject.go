@@ -0,0 +1,180 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// InjectCodeWithRelocs places code in the image and returns its RVA.
+//
+// fixups are the offsets in code of pointer sized absolute addresses,
+// 32-bit for PE32 and 64-bit for PE32+ images. Each holds an address
+// relative to the start of code; the image base and the final RVA of the
+// code are added to it, and a base relocation is registered for it so
+// that the loader fixes it up when the image is rebased.
+//
+// The code goes into the slack at the end of an executable section if
+// there is enough, and into a new section otherwise.
+func (f *File) InjectCodeWithRelocs(code []byte, fixups []uint32) (uint32, error) {
+	return f.injectCode(code, fixups, true)
+}
+
+// injectCode implements InjectCodeWithRelocs. The fixups are offsets in
+// code either way; if relative is false, the addresses stored at them are
+// RVAs, to which only the image base is added.
+func (f *File) injectCode(code []byte, fixups []uint32, relative bool) (uint32, error) {
+	ptrSize, typ := uint32(4), byte(IMAGE_REL_BASED_HIGHLOW)
+	switch f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+	case *OptionalHeader64:
+		ptrSize, typ = 8, IMAGE_REL_BASED_DIR64
+	default:
+		return 0, errors.New("cannot inject code into a file without an optional header")
+	}
+	if len(fixups) > 0 && len(f.dataDirectories()) <= IMAGE_DIRECTORY_ENTRY_BASERELOC {
+		return 0, errors.New("image has no base relocation directory entry")
+	}
+	for _, off := range fixups {
+		if uint64(off)+uint64(ptrSize) > uint64(len(code)) {
+			return 0, fmt.Errorf("fixup at offset %#x is outside of the code", off)
+		}
+	}
+
+	s, start, err := f.codeCave(uint32(len(code)))
+	if err != nil {
+		return 0, err
+	}
+	rva := s.VirtualAddress + start
+
+	patched := append([]byte(nil), code...)
+	base := f.imageBase()
+	if relative {
+		base += uint64(rva)
+	}
+	for _, off := range fixups {
+		if ptrSize == 8 {
+			binary.LittleEndian.PutUint64(patched[off:], binary.LittleEndian.Uint64(patched[off:])+base)
+		} else {
+			binary.LittleEndian.PutUint32(patched[off:], binary.LittleEndian.Uint32(patched[off:])+uint32(base))
+		}
+	}
+	data, err := s.Data()
+	if err != nil {
+		return 0, err
+	}
+	copy(data[start:], patched)
+	s.Replace(bytes.NewReader(data), int64(len(data)))
+
+	if len(fixups) == 0 {
+		return rva, nil
+	}
+	for _, off := range fixups {
+		if err := f.addBaseReloc(rva+off, typ); err != nil {
+			return 0, err
+		}
+	}
+	if err := f.writeBaseRelocs(); err != nil {
+		return 0, err
+	}
+	return rva, nil
+}
+
+// codeCave finds room for size bytes of code: the raw data past the
+// VirtualSize of an executable section, or a new section. It returns the
+// section and the offset of the room in it, after growing VirtualSize to
+// cover it.
+func (f *File) codeCave(size uint32) (*Section, uint32, error) {
+	sectionAlignment, _, _, _, _ := f.imageLayout()
+	for _, s := range f.Sections {
+		if s.Characteristics&IMAGE_SCN_MEM_EXECUTE == 0 || s.VirtualSize == 0 || s.Offset == 0 {
+			continue
+		}
+		start := alignUp(s.VirtualSize, 16)
+		end := start + size
+		if end <= s.Size && end <= alignUp(s.VirtualSize, sectionAlignment) {
+			s.VirtualSize = end
+			return s, start, nil
+		}
+	}
+	s, err := f.AddSection(".inject", make([]byte, size), IMAGE_SCN_CNT_CODE|IMAGE_SCN_MEM_EXECUTE|IMAGE_SCN_MEM_READ)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s, 0, nil
+}
+
+// HijackEntryPoint injects stub as with InjectCodeWithRelocs, makes it the
+// entry point of the image, and returns the RVA of the original entry
+// point.
+//
+// The stub hands control back to the original entry point through the
+// slot at offset tailJumpPlaceholder in stub, which EntryPointSlotSize
+// tells the size of. If the image can be rebased, the slot is pointer
+// sized and receives the absolute address of the original entry point,
+// with a base relocation for it. Otherwise the slot is 32 bits wide and
+// receives the RVA of the original entry point, to which the stub has to
+// add the image base.
+func (f *File) HijackEntryPoint(stub []byte, tailJumpPlaceholder uint32) (uint32, error) {
+	oep, ok := f.entryPoint()
+	if !ok {
+		return 0, errors.New("cannot hijack the entry point of a file without an optional header")
+	}
+	size := f.EntryPointSlotSize()
+	if uint64(tailJumpPlaceholder)+uint64(size) > uint64(len(stub)) {
+		return 0, fmt.Errorf("entry point slot at offset %#x is outside of the stub", tailJumpPlaceholder)
+	}
+
+	code := append([]byte(nil), stub...)
+	var fixups []uint32
+	if size == 8 {
+		binary.LittleEndian.PutUint64(code[tailJumpPlaceholder:], uint64(oep))
+	} else {
+		binary.LittleEndian.PutUint32(code[tailJumpPlaceholder:], oep)
+	}
+	if f.relocatable() {
+		fixups = []uint32{tailJumpPlaceholder}
+	}
+	rva, err := f.injectCode(code, fixups, false)
+	if err != nil {
+		return 0, err
+	}
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		oh.AddressOfEntryPoint = rva
+	case *OptionalHeader64:
+		oh.AddressOfEntryPoint = rva
+	}
+	return oep, nil
+}
+
+// EntryPointSlotSize returns the size of the slot HijackEntryPoint fills
+// with the original entry point: the pointer size if the image can be
+// rebased, as it then stores an absolute address, and 4 otherwise.
+func (f *File) EntryPointSlotSize() int {
+	if _, ok := f.OptionalHeader.(*OptionalHeader64); ok && f.relocatable() {
+		return 8
+	}
+	return 4
+}
+
+// relocatable reports whether the loader may rebase f, which requires
+// base relocations.
+func (f *File) relocatable() bool {
+	return f.FileHeader.Characteristics&IMAGE_FILE_RELOCS_STRIPPED == 0 &&
+		len(f.dataDirectories()) > IMAGE_DIRECTORY_ENTRY_BASERELOC &&
+		f.BaseRelocationTable != nil && len(*f.BaseRelocationTable) > 0
+}
+
+// entryPoint returns AddressOfEntryPoint. ok is false if f has no optional
+// header.
+func (f *File) entryPoint() (rva uint32, ok bool) {
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		return oh.AddressOfEntryPoint, true
+	case *OptionalHeader64:
+		return oh.AddressOfEntryPoint, true
+	}
+	return 0, false
+}
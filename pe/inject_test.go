@@ -0,0 +1,207 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/Binject/debug/internal/gobuild"
+)
+
+// baseRelocs returns the RVAs and types of all base relocations of f.
+func baseRelocs(f *File) map[uint32]byte {
+	relocs := make(map[uint32]byte)
+	if f.BaseRelocationTable == nil {
+		return relocs
+	}
+	for _, b := range *f.BaseRelocationTable {
+		for _, it := range b.BlockItems {
+			if it.Type != IMAGE_REL_BASED_ABSOLUTE {
+				relocs[b.VirtualAddress+uint32(it.Offset)] = it.Type
+			}
+		}
+	}
+	return relocs
+}
+
+func TestInjectCodeWithRelocs(t *testing.T) {
+	for _, goarch := range []string{"amd64", "386"} {
+		f, err := Open(gobuild.Binary(t, "windows", goarch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ptrSize, typ := 4, byte(IMAGE_REL_BASED_HIGHLOW)
+		if goarch == "amd64" {
+			ptrSize, typ = 8, IMAGE_REL_BASED_DIR64
+		}
+		before := baseRelocs(f)
+		if len(before) == 0 {
+			t.Fatalf("%s: no base relocations", goarch)
+		}
+		nsect := len(f.Sections)
+
+		// A small piece of code fits in the slack of .text; the large
+		// one, with a fixup every 16 bytes, needs a new section and
+		// outgrows .reloc.
+		small := make([]byte, 32)
+		binary.LittleEndian.PutUint32(small[8:], 24)
+		large := make([]byte, 0x10000)
+		var largeFixups []uint32
+		for off := 0; off < len(large); off += 16 {
+			binary.LittleEndian.PutUint32(large[off:], uint32(off))
+			largeFixups = append(largeFixups, uint32(off))
+		}
+		smallRVA, err := f.InjectCodeWithRelocs(small, []uint32{8})
+		if err != nil {
+			t.Fatalf("%s: %v", goarch, err)
+		}
+		if s := f.sectionForRVA(smallRVA); s == nil || s.Name != ".text" {
+			t.Errorf("%s: small code was put in %v, want .text", goarch, s)
+		}
+		largeRVA, err := f.InjectCodeWithRelocs(large, largeFixups)
+		if err != nil {
+			t.Fatalf("%s: %v", goarch, err)
+		}
+		if _, err := f.InjectCodeWithRelocs(small, []uint32{30}); err == nil {
+			t.Errorf("%s: accepted a fixup past the end of the code", goarch)
+		}
+
+		g := reparse(t, f)
+		if len(g.Sections) != nsect+2 || g.Section(".inject") == nil || g.Section(".reloc2") == nil {
+			t.Errorf("%s: got sections %v, want .inject and .reloc2 added", goarch, sectionNames(g))
+		}
+		for _, issue := range g.Validate() {
+			if issue.Severity >= SeverityWarning {
+				t.Errorf("%s: unexpected issue: %v", goarch, issue)
+			}
+		}
+		relocs := baseRelocs(g)
+		for rva, ty := range before {
+			if relocs[rva] != ty {
+				t.Errorf("%s: base relocation at %#x was lost", goarch, rva)
+				break
+			}
+		}
+		imageBase := g.imageBase()
+		check := func(rva, want uint32) {
+			s := g.sectionForRVA(rva)
+			data, err := s.Data()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got uint64
+			if ptrSize == 8 {
+				got = binary.LittleEndian.Uint64(data[rva-s.VirtualAddress:])
+			} else {
+				got = uint64(binary.LittleEndian.Uint32(data[rva-s.VirtualAddress:]))
+			}
+			if got != imageBase+uint64(want) {
+				t.Errorf("%s: address at %#x is %#x, want %#x", goarch, rva, got, imageBase+uint64(want))
+			}
+			if relocs[rva] != typ {
+				t.Errorf("%s: no base relocation at %#x", goarch, rva)
+			}
+		}
+		check(smallRVA+8, smallRVA+24)
+		for _, off := range largeFixups {
+			check(largeRVA+off, largeRVA+off)
+		}
+		f.Close()
+	}
+}
+
+func TestAddBaseRelocNoTable(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	text := f.Section(".text")
+	if err := f.AddBaseReloc(text.VirtualAddress+0x10, IMAGE_REL_BASED_DIR64); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.AddBaseReloc(text.VirtualAddress+0x10, 16); err == nil {
+		t.Error("AddBaseReloc accepted an invalid type")
+	}
+	g := reparse(t, f)
+	if g.Section(".reloc") == nil {
+		t.Fatal("no .reloc section was added")
+	}
+	if relocs := baseRelocs(g); len(relocs) != 1 || relocs[text.VirtualAddress+0x10] != IMAGE_REL_BASED_DIR64 {
+		t.Errorf("got base relocations %v", relocs)
+	}
+	if !bytes.Equal(g.baseRelocBytes(), f.baseRelocBytes()) {
+		t.Error("base relocation table changed when written")
+	}
+}
+
+func sectionNames(f *File) []string {
+	var names []string
+	for _, s := range f.Sections {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestHijackEntryPoint(t *testing.T) {
+	for _, tt := range []struct {
+		file     string
+		slotSize int
+	}{
+		{gobuild.Binary(t, "windows", "amd64"), 8},
+		{gobuild.Binary(t, "windows", "386"), 4},
+		{"testdata/gcc-amd64-mingw-exec", 4}, // no base relocations
+	} {
+		f, err := Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.EntryPointSlotSize(); got != tt.slotSize {
+			t.Errorf("%s: EntryPointSlotSize() = %d, want %d", tt.file, got, tt.slotSize)
+		}
+		oep, _ := f.entryPoint()
+		stub := bytes.Repeat([]byte{0xcc}, 24)
+		if _, err := f.HijackEntryPoint(stub, uint32(len(stub)-tt.slotSize+1)); err == nil {
+			t.Errorf("%s: accepted a slot past the end of the stub", tt.file)
+		}
+		got, err := f.HijackEntryPoint(stub, 8)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		if got != oep {
+			t.Errorf("%s: HijackEntryPoint returned %#x, want the original entry point %#x", tt.file, got, oep)
+		}
+
+		g := reparse(t, f)
+		rva, _ := g.entryPoint()
+		s := g.sectionForRVA(rva)
+		if s == nil || s.Characteristics&IMAGE_SCN_MEM_EXECUTE == 0 {
+			t.Fatalf("%s: new entry point %#x is not in an executable section", tt.file, rva)
+		}
+		data, err := s.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := data[rva-s.VirtualAddress:]
+		var slot uint64
+		if tt.slotSize == 8 {
+			slot = binary.LittleEndian.Uint64(code[8:])
+		} else {
+			slot = uint64(binary.LittleEndian.Uint32(code[8:]))
+		}
+		if !bytes.Equal(code[:8], stub[:8]) || !bytes.Equal(code[8+tt.slotSize:24], stub[8+tt.slotSize:]) {
+			t.Errorf("%s: stub was not copied around the slot: %x", tt.file, code[:24])
+		}
+		want := uint64(oep)
+		if g.relocatable() {
+			want += g.imageBase()
+			if _, ok := baseRelocs(g)[rva+8]; !ok {
+				t.Errorf("%s: no base relocation for the entry point slot", tt.file)
+			}
+		}
+		if slot != want {
+			t.Errorf("%s: entry point slot holds %#x, want %#x", tt.file, slot, want)
+		}
+		f.Close()
+	}
+}
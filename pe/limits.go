@@ -0,0 +1,68 @@
+package pe
+
+import (
+	"io"
+	"os"
+)
+
+// Limits bounds what is read from a PE file whose headers cannot be
+// trusted. Whatever the limits, tables are only read when they fit in the
+// file, and raw data is allocated as it is read, so that no header field
+// makes the parser allocate more memory than the file holds.
+type Limits struct {
+	// MaxSections is the largest NumberOfSections accepted.
+	MaxSections int
+
+	// MaxResourceDepth is the deepest nesting of resource directories
+	// that is read.
+	MaxResourceDepth int
+
+	// MaxCertTableSize is the size of the largest certificate table that
+	// is read, in bytes.
+	MaxCertTableSize uint32
+}
+
+// DefaultLimits are the limits of NewFile, NewFileFromMemory and
+// NewFileTolerant, and those of NewFileWithLimits for the fields it is
+// given as zero.
+var DefaultLimits = Limits{
+	MaxSections:      0xfeff, // IMAGE_SYM_SECTION_MAX, the highest section number of a symbol
+	MaxResourceDepth: 8,      // three levels in practice: type, name and language
+	MaxCertTableSize: 64 << 20,
+}
+
+// withDefaults returns l with its zero fields set from DefaultLimits.
+func (l Limits) withDefaults() Limits {
+	if l.MaxSections <= 0 {
+		l.MaxSections = DefaultLimits.MaxSections
+	}
+	if l.MaxResourceDepth <= 0 {
+		l.MaxResourceDepth = DefaultLimits.MaxResourceDepth
+	}
+	if l.MaxCertTableSize == 0 {
+		l.MaxCertTableSize = DefaultLimits.MaxCertTableSize
+	}
+	return l
+}
+
+// OpenWithLimits opens the named file as NewFileWithLimits does.
+func OpenWithLimits(name string, l Limits) (*File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	ff, err := NewFileWithLimits(f, l)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ff.closer = f
+	return ff, nil
+}
+
+// NewFileWithLimits creates a File for the PE binary in r as NewFile
+// does, failing for a file that exceeds l. The limits also apply to what
+// the File reads later, such as its resources.
+func NewFileWithLimits(r io.ReaderAt, l Limits) (*File, error) {
+	return newFileInternal(r, false, false, l)
+}
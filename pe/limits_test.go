@@ -0,0 +1,99 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	const file = "testdata/gcc-amd64-mingw-exec"
+	want, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer want.Close()
+	orig, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileHeader := want.OptionalHeaderOffset - int64(binary.Size(FileHeader{}))
+	sectionTable := want.OptionalHeaderOffset + int64(sizeofOptionalHeader64)
+	sectionHeader := func(b []byte, i int) []byte {
+		return b[sectionTable+int64(i)*40:]
+	}
+	// Offset of the certificate table entry of the data directory.
+	certEntry := want.OptionalHeaderOffset + int64(binary.Size(OptionalHeader64{})) - 16*8 + 8*CERTIFICATE_TABLE
+
+	n := len(want.Sections)
+	if _, err := NewFileWithLimits(bytes.NewReader(orig), Limits{MaxSections: n}); err != nil {
+		t.Errorf("NewFileWithLimits with %d sections allowed: %v", n, err)
+	}
+	if _, err := NewFileWithLimits(bytes.NewReader(orig), Limits{MaxSections: n - 1}); err == nil || !strings.Contains(err.Error(), "more than the limit") {
+		t.Errorf("NewFileWithLimits with %d sections allowed: %v", n-1, err)
+	}
+
+	// The certificate table is checked against the limit before it is read.
+	b := append([]byte(nil), orig...)
+	binary.LittleEndian.PutUint32(b[certEntry:], 0x200)
+	binary.LittleEndian.PutUint32(b[certEntry+4:], 0x100)
+	f, err := NewFileWithLimits(bytes.NewReader(b), Limits{MaxCertTableSize: 0x100})
+	if err != nil || len(f.CertificateTable) != 0x100 {
+		t.Errorf("reading a certificate table at the limit: %v", err)
+	}
+	if _, err := NewFileWithLimits(bytes.NewReader(b), Limits{MaxCertTableSize: 0xff}); err == nil {
+		t.Error("NewFileWithLimits read a certificate table over the limit")
+	}
+	binary.LittleEndian.PutUint32(b[certEntry+4:], 0xffffffff)
+	if _, err := NewFile(bytes.NewReader(b)); err == nil {
+		t.Error("NewFile read a 4GB certificate table")
+	}
+
+	// Sizes past the end of the file are errors, not allocations.
+	b = append([]byte(nil), orig...)
+	binary.LittleEndian.PutUint32(sectionHeader(b, 0)[16:], 0xffffffff) // SizeOfRawData
+	f, err = NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := f.Sections[0].Data(); err == nil || len(data) >= len(b) {
+		t.Errorf("Data of a 4GB section returned %d bytes, %v", len(data), err)
+	}
+	b = append([]byte(nil), orig...)
+	binary.LittleEndian.PutUint32(sectionHeader(b, 0)[24:], 0x100) // PointerToRelocations
+	binary.LittleEndian.PutUint16(sectionHeader(b, 0)[32:], 0xffff)
+	if _, err := NewFile(bytes.NewReader(b)); err == nil {
+		t.Error("NewFile read relocations past the end of the file")
+	}
+	b = append([]byte(nil), orig...)
+	binary.LittleEndian.PutUint32(b[fileHeader+8:], 0x100) // PointerToSymbolTable
+	binary.LittleEndian.PutUint32(b[fileHeader+12:], 0x7fffffff)
+	if _, err := NewFile(bytes.NewReader(b)); err == nil {
+		t.Error("NewFile read a symbol table past the end of the file")
+	}
+
+	// Resource directories nested deeper than the limit are not read.
+	f, err = NewFile(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := &resourceDir{entries: []*resourceEntry{
+		{id: RT_VERSION, dir: &resourceDir{entries: []*resourceEntry{
+			{id: 1, dir: &resourceDir{entries: []*resourceEntry{
+				{id: 0x409, data: &resourceData{data: []byte("version")}},
+			}}},
+		}}},
+	}}
+	if err := f.setResources(root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.resources(); err != nil {
+		t.Errorf("reading three levels of resources: %v", err)
+	}
+	f.limits.MaxResourceDepth = 2
+	if _, err := f.resources(); err == nil || !strings.Contains(err.Error(), "deeper than 2") {
+		t.Errorf("reading three levels of resources with a limit of 2: %v", err)
+	}
+}
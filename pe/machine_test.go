@@ -0,0 +1,37 @@
+package pe
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOpenNewMachines(t *testing.T) {
+	for _, c := range []struct {
+		file     string
+		machines []uint16
+	}{
+		{"testdata/gcc-amd64-mingw-exec", []uint16{IMAGE_FILE_MACHINE_ARM64, IMAGE_FILE_MACHINE_RISCV64, IMAGE_FILE_MACHINE_LOONGARCH64}},
+		{"testdata/gcc-386-mingw-exec", []uint16{IMAGE_FILE_MACHINE_RISCV32, IMAGE_FILE_MACHINE_LOONGARCH32}},
+	} {
+		f, err := Open(c.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		want, err := f.ImportedSymbols()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range c.machines {
+			f.Machine = m
+			g := reparse(t, f)
+			if g.Machine != m {
+				t.Errorf("%s: machine is %#x, want %#x", c.file, g.Machine, m)
+			}
+			got, err := g.ImportedSymbols()
+			if err != nil || !reflect.DeepEqual(got, want) {
+				t.Errorf("%s as %#x: ImportedSymbols() = %d symbols, %v; want %d", c.file, m, len(got), err, len(want))
+			}
+		}
+	}
+}
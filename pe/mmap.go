@@ -0,0 +1,33 @@
+package pe
+
+import "github.com/Binject/debug/internal/mmap"
+
+// OpenMapped opens the named file as Open does, but maps it into memory,
+// so that Data of a section returns a slice of the mapping instead of
+// reading the section into a new buffer, until the section is replaced.
+// The mapping is private: modifying such a slice changes what later reads
+// of the File see, but not the file on disk. The slices are only valid
+// until Close. Where files cannot be mapped, the file is read into memory
+// once instead.
+func OpenMapped(name string) (*File, error) {
+	m, err := mmap.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := NewFile(m)
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+	f.closer = m
+	for _, s := range f.Sections {
+		if s.Offset == 0 || s.sr == nil {
+			continue
+		}
+		if end := int64(s.Offset) + s.sr.Size(); end <= int64(len(m.Data())) {
+			s.view = m.Data()[s.Offset:end:end]
+			s.viewSR = s.sr
+		}
+	}
+	return f, nil
+}
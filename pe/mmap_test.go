@@ -0,0 +1,73 @@
+package pe
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestOpenMapped(t *testing.T) {
+	const name = "testdata/gcc-386-mingw-exec"
+	want, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer want.Close()
+	f, err := OpenMapped(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Sections) != len(want.Sections) {
+		t.Fatalf("%d sections, want %d", len(f.Sections), len(want.Sections))
+	}
+	for i, s := range f.Sections {
+		a, err := s.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := want.Sections[i].Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(a, w) {
+			t.Errorf("section %s differs", s.Name)
+		}
+		if len(a) == 0 {
+			continue
+		}
+		if b, _ := s.Data(); &b[0] != &a[0] {
+			t.Errorf("section %s was copied", s.Name)
+		}
+	}
+
+	// Modifying the mapping does not change the file, and replaced
+	// sections are no longer views.
+	text := f.Section(".text")
+	d, _ := text.Data()
+	d[0] ^= 0xff
+	text.Replace(bytes.NewReader([]byte{1, 2, 3}), 3)
+	if d, err := text.Data(); err != nil || !bytes.Equal(d, []byte{1, 2, 3}) {
+		t.Errorf("Data() = %v, %v after Replace", d, err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Section(".data").Data(); err == nil {
+		t.Error("Data of a section after Close returned no error")
+	}
+	raw, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, _ := want.Section(".text").Data()
+	if raw[want.Section(".text").Offset] != w[0] {
+		t.Error("modifying the mapping changed the file")
+	}
+
+	if _, err := OpenMapped("testdata/no-such-file"); err == nil {
+		t.Error("OpenMapped opened a missing file")
+	}
+	if _, err := OpenMapped("testdata/hello.c"); err == nil {
+		t.Error("OpenMapped accepted a file that is not PE")
+	}
+}
@@ -3,6 +3,8 @@ package pe
 import (
 	"encoding/binary"
 	"io"
+
+	"github.com/Binject/debug/internal/readerat"
 )
 
 type IMAGE_COR20_HEADER struct {
@@ -48,8 +50,7 @@ func newMetadataHeader(i io.Reader) (NetMetaData, error) {
 
 	// it appears that this value is terminated by two nulls.. that might be important at some point
 	binary.Read(i, binary.LittleEndian, &r.VersionLength)
-	r.VersionString = make([]byte, r.VersionLength)
-	i.Read(r.VersionString)
+	r.VersionString, _ = readerat.ReadData(i, uint64(r.VersionLength))
 
 	binary.Read(i, binary.LittleEndian, r.Flags)
 
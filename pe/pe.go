@@ -109,28 +109,35 @@ type OptionalHeader64 struct {
 }
 
 const (
-	IMAGE_FILE_MACHINE_UNKNOWN   = 0x0
-	IMAGE_FILE_MACHINE_AM33      = 0x1d3
-	IMAGE_FILE_MACHINE_AMD64     = 0x8664
-	IMAGE_FILE_MACHINE_ARM       = 0x1c0
-	IMAGE_FILE_MACHINE_ARMNT     = 0x1c4
-	IMAGE_FILE_MACHINE_ARM64     = 0xaa64
-	IMAGE_FILE_MACHINE_EBC       = 0xebc
-	IMAGE_FILE_MACHINE_I386      = 0x14c
-	IMAGE_FILE_MACHINE_IA64      = 0x200
-	IMAGE_FILE_MACHINE_M32R      = 0x9041
-	IMAGE_FILE_MACHINE_MIPS16    = 0x266
-	IMAGE_FILE_MACHINE_MIPSFPU   = 0x366
-	IMAGE_FILE_MACHINE_MIPSFPU16 = 0x466
-	IMAGE_FILE_MACHINE_POWERPC   = 0x1f0
-	IMAGE_FILE_MACHINE_POWERPCFP = 0x1f1
-	IMAGE_FILE_MACHINE_R4000     = 0x166
-	IMAGE_FILE_MACHINE_SH3       = 0x1a2
-	IMAGE_FILE_MACHINE_SH3DSP    = 0x1a3
-	IMAGE_FILE_MACHINE_SH4       = 0x1a6
-	IMAGE_FILE_MACHINE_SH5       = 0x1a8
-	IMAGE_FILE_MACHINE_THUMB     = 0x1c2
-	IMAGE_FILE_MACHINE_WCEMIPSV2 = 0x169
+	IMAGE_FILE_MACHINE_UNKNOWN     = 0x0
+	IMAGE_FILE_MACHINE_AM33        = 0x1d3
+	IMAGE_FILE_MACHINE_AMD64       = 0x8664
+	IMAGE_FILE_MACHINE_ARM         = 0x1c0
+	IMAGE_FILE_MACHINE_ARMNT       = 0x1c4
+	IMAGE_FILE_MACHINE_ARM64       = 0xaa64
+	IMAGE_FILE_MACHINE_ARM64EC     = 0xa641
+	IMAGE_FILE_MACHINE_ARM64X      = 0xa64e
+	IMAGE_FILE_MACHINE_EBC         = 0xebc
+	IMAGE_FILE_MACHINE_I386        = 0x14c
+	IMAGE_FILE_MACHINE_IA64        = 0x200
+	IMAGE_FILE_MACHINE_LOONGARCH32 = 0x6232
+	IMAGE_FILE_MACHINE_LOONGARCH64 = 0x6264
+	IMAGE_FILE_MACHINE_M32R        = 0x9041
+	IMAGE_FILE_MACHINE_MIPS16      = 0x266
+	IMAGE_FILE_MACHINE_MIPSFPU     = 0x366
+	IMAGE_FILE_MACHINE_MIPSFPU16   = 0x466
+	IMAGE_FILE_MACHINE_POWERPC     = 0x1f0
+	IMAGE_FILE_MACHINE_POWERPCFP   = 0x1f1
+	IMAGE_FILE_MACHINE_R4000       = 0x166
+	IMAGE_FILE_MACHINE_RISCV32     = 0x5032
+	IMAGE_FILE_MACHINE_RISCV64     = 0x5064
+	IMAGE_FILE_MACHINE_RISCV128    = 0x5128
+	IMAGE_FILE_MACHINE_SH3         = 0x1a2
+	IMAGE_FILE_MACHINE_SH3DSP      = 0x1a3
+	IMAGE_FILE_MACHINE_SH4         = 0x1a6
+	IMAGE_FILE_MACHINE_SH5         = 0x1a8
+	IMAGE_FILE_MACHINE_THUMB       = 0x1c2
+	IMAGE_FILE_MACHINE_WCEMIPSV2   = 0x169
 )
 
 // IMAGE_DIRECTORY_ENTRY constants
@@ -151,3 +158,69 @@ const (
 	IMAGE_DIRECTORY_ENTRY_DELAY_IMPORT   = 13
 	IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR = 14
 )
+
+// Values of Reloc.Type for IMAGE_FILE_MACHINE_AMD64.
+const (
+	IMAGE_REL_AMD64_ABSOLUTE = 0x0000
+	IMAGE_REL_AMD64_ADDR64   = 0x0001
+	IMAGE_REL_AMD64_ADDR32   = 0x0002
+	IMAGE_REL_AMD64_ADDR32NB = 0x0003
+	IMAGE_REL_AMD64_REL32    = 0x0004
+	IMAGE_REL_AMD64_REL32_1  = 0x0005
+	IMAGE_REL_AMD64_REL32_2  = 0x0006
+	IMAGE_REL_AMD64_REL32_3  = 0x0007
+	IMAGE_REL_AMD64_REL32_4  = 0x0008
+	IMAGE_REL_AMD64_REL32_5  = 0x0009
+	IMAGE_REL_AMD64_SECTION  = 0x000A
+	IMAGE_REL_AMD64_SECREL   = 0x000B
+)
+
+// Values of Reloc.Type for IMAGE_FILE_MACHINE_I386.
+const (
+	IMAGE_REL_I386_ABSOLUTE = 0x0000
+	IMAGE_REL_I386_DIR32    = 0x0006
+	IMAGE_REL_I386_DIR32NB  = 0x0007
+	IMAGE_REL_I386_SECTION  = 0x000A
+	IMAGE_REL_I386_SECREL   = 0x000B
+	IMAGE_REL_I386_REL32    = 0x0014
+)
+
+// Values of IMAGE_DEBUG_DIRECTORY.Type.
+const (
+	IMAGE_DEBUG_TYPE_UNKNOWN               = 0
+	IMAGE_DEBUG_TYPE_COFF                  = 1
+	IMAGE_DEBUG_TYPE_CODEVIEW              = 2
+	IMAGE_DEBUG_TYPE_FPO                   = 3
+	IMAGE_DEBUG_TYPE_MISC                  = 4
+	IMAGE_DEBUG_TYPE_EXCEPTION             = 5
+	IMAGE_DEBUG_TYPE_FIXUP                 = 6
+	IMAGE_DEBUG_TYPE_OMAP_TO_SRC           = 7
+	IMAGE_DEBUG_TYPE_OMAP_FROM_SRC         = 8
+	IMAGE_DEBUG_TYPE_BORLAND               = 9
+	IMAGE_DEBUG_TYPE_RESERVED10            = 10
+	IMAGE_DEBUG_TYPE_CLSID                 = 11
+	IMAGE_DEBUG_TYPE_VC_FEATURE            = 12
+	IMAGE_DEBUG_TYPE_POGO                  = 13
+	IMAGE_DEBUG_TYPE_ILTCG                 = 14
+	IMAGE_DEBUG_TYPE_MPX                   = 15
+	IMAGE_DEBUG_TYPE_REPRO                 = 16
+	IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS = 20
+)
+
+// Values of IMAGE_OPTIONAL_HEADER.Subsystem.
+const (
+	IMAGE_SUBSYSTEM_UNKNOWN                  = 0
+	IMAGE_SUBSYSTEM_NATIVE                   = 1
+	IMAGE_SUBSYSTEM_WINDOWS_GUI              = 2
+	IMAGE_SUBSYSTEM_WINDOWS_CUI              = 3
+	IMAGE_SUBSYSTEM_OS2_CUI                  = 5
+	IMAGE_SUBSYSTEM_POSIX_CUI                = 7
+	IMAGE_SUBSYSTEM_NATIVE_WINDOWS           = 8
+	IMAGE_SUBSYSTEM_WINDOWS_CE_GUI           = 9
+	IMAGE_SUBSYSTEM_EFI_APPLICATION          = 10
+	IMAGE_SUBSYSTEM_EFI_BOOT_SERVICE_DRIVER  = 11
+	IMAGE_SUBSYSTEM_EFI_RUNTIME_DRIVER       = 12
+	IMAGE_SUBSYSTEM_EFI_ROM                  = 13
+	IMAGE_SUBSYSTEM_XBOX                     = 14
+	IMAGE_SUBSYSTEM_WINDOWS_BOOT_APPLICATION = 16
+)
@@ -0,0 +1,141 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/Binject/debug/internal/readerat"
+)
+
+// rawLen returns the size of the file f was read from.
+func (f *File) rawLen() (int64, error) {
+	return readerat.CachedSize(f.raw, &f.rawSize)
+}
+
+// preservedBytes returns the bytes the file was read from with the
+// structures the File describes written over them. The symbol and
+// certificate tables are moved to the end of the file if they outgrow
+// their original space.
+func (f *File) preservedBytes() ([]byte, error) {
+	n, err := f.rawLen()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, n)
+	if _, err := f.raw.ReadAt(out, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	put := func(off uint32, b []byte) {
+		if end := uint64(off) + uint64(len(b)); end > uint64(len(out)) {
+			out = append(out, make([]byte, end-uint64(len(out)))...)
+		}
+		copy(out[off:], b)
+	}
+	encode := func(v interface{}) []byte {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, v)
+		return buf.Bytes()
+	}
+	u32At := func(off uint64) uint32 {
+		if off+4 > uint64(len(out)) {
+			return 0
+		}
+		return binary.LittleEndian.Uint32(out[off:])
+	}
+
+	isImage := f.DosHeader.MZSignature == 0x5a4d
+	fileHeaderOffset := uint64(f.OptionalHeaderOffset) - uint64(binary.Size(f.FileHeader))
+	sectionHeadersOffset := uint64(f.OptionalHeaderOffset) + uint64(f.FileHeader.SizeOfOptionalHeader)
+	if sectionHeadersOffset > uint64(len(out)) {
+		return nil, errors.New("original file is shorter than its headers")
+	}
+
+	for _, s := range f.Sections {
+		if s.Offset == 0 || s.Size == 0 {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return nil, err
+		}
+		put(s.Offset, data)
+		if len(s.Relocs) > 0 {
+			put(s.PointerToRelocations, encode(s.Relocs))
+		}
+	}
+	if len(f.InsertionBytes) > 0 {
+		put(f.InsertionAddr, f.InsertionBytes)
+	}
+
+	// The symbol table stays where it was as long as it, and the string
+	// table behind it, still fit there.
+	fh := f.FileHeader
+	names, strtab := f.sectionNames()
+	if len(f.COFFSymbols) > 0 || len(strtab) > 0 {
+		symtab := append(encode(f.COFFSymbols), strtab.bytes()...)
+
+		origPtr := uint64(u32At(fileHeaderOffset + 8))
+		origStrtab := origPtr + uint64(u32At(fileHeaderOffset+12))*COFFSymbolSize
+		origEnd := origStrtab + uint64(u32At(origStrtab))
+		if fh.PointerToSymbolTable == 0 || (uint64(fh.PointerToSymbolTable) == origPtr && origPtr+uint64(len(symtab)) > origEnd && origEnd < uint64(len(out))) {
+			fh.PointerToSymbolTable = uint32(len(out))
+		}
+		put(fh.PointerToSymbolTable, symtab)
+	}
+
+	dd := f.dataDirectories()
+	if len(dd) > CERTIFICATE_TABLE {
+		cert := dd[CERTIFICATE_TABLE]
+		switch {
+		case f.CertificateTable == nil:
+			dd[CERTIFICATE_TABLE] = DataDirectory{}
+		case cert.VirtualAddress != 0 && uint32(len(f.CertificateTable)) <= cert.Size:
+			put(cert.VirtualAddress, f.CertificateTable)
+			dd[CERTIFICATE_TABLE].Size = uint32(len(f.CertificateTable))
+		default:
+			off := alignUp(uint32(len(out)), 8)
+			put(off, f.CertificateTable)
+			dd[CERTIFICATE_TABLE] = DataDirectory{VirtualAddress: off, Size: uint32(len(f.CertificateTable))}
+		}
+	}
+
+	if isImage {
+		put(0, encode(f.DosHeader))
+		if f.DosExists {
+			put(uint32(binary.Size(f.DosHeader)), f.DosStub[:])
+		}
+		if f.RichHeader != nil {
+			start := binary.Size(f.DosHeader)
+			if f.DosExists {
+				start += binary.Size(f.DosStub)
+			}
+			put(uint32(start), f.RichHeader)
+		}
+		put(f.DosHeader.AddressOfNewExeHeader, []byte{'P', 'E', 0, 0})
+	}
+	put(uint32(fileHeaderOffset), encode(fh))
+	if f.OptionalHeader != nil {
+		oh := encode(f.OptionalHeader)
+		if len(oh) > int(f.FileHeader.SizeOfOptionalHeader) {
+			oh = oh[:f.FileHeader.SizeOfOptionalHeader]
+		}
+		put(uint32(f.OptionalHeaderOffset), oh)
+	}
+	for i, s := range f.Sections {
+		put(uint32(sectionHeadersOffset)+uint32(i*binary.Size(SectionHeader32{})), encode(SectionHeader32{
+			Name:                 names[i],
+			VirtualSize:          s.VirtualSize,
+			VirtualAddress:       s.VirtualAddress,
+			SizeOfRawData:        s.Size,
+			PointerToRawData:     s.Offset,
+			PointerToRelocations: s.PointerToRelocations,
+			PointerToLineNumbers: s.PointerToLineNumbers,
+			NumberOfRelocations:  s.NumberOfRelocations,
+			NumberOfLineNumbers:  s.NumberOfLineNumbers,
+			Characteristics:      s.Characteristics,
+		}))
+	}
+	return out, nil
+}
@@ -0,0 +1,111 @@
+package pe
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestPreserveRaw(t *testing.T) {
+	for _, name := range []string{
+		"testdata/gcc-386-mingw-exec",
+		"testdata/gcc-amd64-mingw-exec",
+	} {
+		orig, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		overlay := []byte("overlay data that no header describes")
+		orig = append(orig, overlay...)
+		f, err := NewFile(bytes.NewReader(orig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Unmodelled bytes at the end of the header slack, past the
+		// header of the section added below.
+		_, _, _, sizeOfHeaders, _ := f.imageLayout()
+		slack := int(sizeOfHeaders) - 4
+		if slack < int(f.OptionalHeaderOffset)+int(f.FileHeader.SizeOfOptionalHeader)+(len(f.Sections)+1)*40 {
+			t.Fatalf("%s: no header slack", name)
+		}
+		copy(orig[slack:], "stub")
+		if f, err = NewFile(bytes.NewReader(orig)); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(b, overlay) {
+			t.Fatalf("%s: Bytes kept the overlay without PreserveRaw", name)
+		}
+
+		f.PreserveRaw = true
+		b, err = f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, orig) {
+			t.Fatalf("%s: unedited file changed", name)
+		}
+
+		// Edit a section in place, grow the symbol table past the
+		// overlay, and add a section.
+		text := f.Section(".text")
+		data, err := text.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[0] ^= 0xff
+		text.Replace(bytes.NewReader(data), int64(len(data)))
+		if err := f.AddSymbol(Symbol{Name: "a_long_symbol_name", SectionNumber: 1, StorageClass: IMAGE_SYM_CLASS_EXTERNAL}, nil); err != nil {
+			t.Fatal(err)
+		}
+		g := reparse(t, f)
+		if g.FileHeader.PointerToSymbolTable < uint32(len(orig)) {
+			t.Errorf("%s: grown symbol table at %#x overwrote the overlay", name, g.FileHeader.PointerToSymbolTable)
+		}
+		if findSymbol(g, "a_long_symbol_name") == nil {
+			t.Errorf("%s: added symbol is missing", name)
+		}
+
+		added := bytes.Repeat([]byte{0xcc}, 100)
+		if _, err := f.AddSection(".added", added, IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ); err != nil {
+			t.Fatal(err)
+		}
+		b, err = f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err = NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := g.Section(".text").Data(); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: edited .text was not written", name)
+		}
+		s := g.Section(".added")
+		if s == nil || s.Offset < uint32(len(orig)) {
+			t.Fatalf("%s: added section is %+v, want it past the original bytes", name, s)
+		}
+		if got, err := s.Data(); err != nil || !bytes.Equal(got[:len(added)], added) {
+			t.Errorf("%s: contents of the added section are wrong", name)
+		}
+		if findSymbol(g, "a_long_symbol_name") == nil {
+			t.Errorf("%s: added symbol is missing after adding a section", name)
+		}
+		end := len(orig) - len(overlay)
+		if !bytes.Equal(b[end:len(orig)], overlay) {
+			t.Errorf("%s: overlay was not kept", name)
+		}
+		if !bytes.Equal(b[slack:slack+4], []byte("stub")) {
+			t.Errorf("%s: header slack was not kept", name)
+		}
+		for _, issue := range g.Validate() {
+			if issue.Severity >= SeverityWarning {
+				t.Errorf("%s: unexpected issue: %v", name, issue)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package pe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Rebase changes the preferred load address of the image to newBase, as
+// the loader does when it cannot map the image at ImageBase: every base
+// relocation is applied to the section contents and ImageBase is set to
+// newBase, so that the file holds the addresses it would have once
+// loaded there. Unlike RelocateImage, which patches the contents of the
+// file in a byte slice, Rebase edits f. The HIGH, LOW, HIGHLOW, HIGHADJ
+// and DIR64 types are applied, and so are the ARM and Thumb MOVW/MOVT
+// pairs; other machine specific types are an error.
+//
+// newBase must be a multiple of 64 KB, and fit in 32 bits for a PE32
+// image. The base relocation table is kept, so the image can be rebased
+// again, and the signature is removed, as it no longer matches.
+func (f *File) Rebase(newBase uint64) error {
+	old := f.imageBase()
+	switch {
+	case f.OptionalHeader == nil:
+		return errors.New("file has no optional header")
+	case newBase%0x10000 != 0:
+		return fmt.Errorf("image base %#x is not a multiple of 64 KB", newBase)
+	case !f.is64() && newBase > 1<<32-1:
+		return fmt.Errorf("image base %#x does not fit a PE32 image", newBase)
+	case newBase == old:
+		return nil
+	case f.BaseRelocationTable == nil || len(*f.BaseRelocationTable) == 0:
+		return errors.New("image has no base relocations")
+	}
+	delta := newBase - old
+
+	patched := make(map[*Section][]byte)
+	// field returns the size bytes at rva in the contents of its section.
+	field := func(rva uint32, size uint32) ([]byte, error) {
+		s := f.sectionForRVA(rva)
+		if s == nil {
+			return nil, fmt.Errorf("base relocation at %#x is outside the sections", rva)
+		}
+		data, ok := patched[s]
+		if !ok {
+			var err error
+			if data, err = s.Data(); err != nil {
+				return nil, err
+			}
+			patched[s] = data
+		}
+		off := rva - s.VirtualAddress
+		if uint64(off)+uint64(size) > uint64(len(data)) {
+			return nil, fmt.Errorf("base relocation at %#x is outside the raw data of section %s", rva, s.Name)
+		}
+		return data[off : off+size], nil
+	}
+
+	for _, block := range *f.BaseRelocationTable {
+		items := block.BlockItems
+		for i := 0; i < len(items); i++ {
+			if items[i].Type == IMAGE_REL_BASED_ABSOLUTE {
+				continue
+			}
+			rva := block.VirtualAddress + uint32(items[i].Offset)
+			size, err := f.baseRelocSize(items[i].Type, rva)
+			if err != nil {
+				return err
+			}
+			b, err := field(rva, size)
+			if err != nil {
+				return err
+			}
+			if i, err = f.applyBaseReloc(b, items, i, delta, rva); err != nil {
+				return err
+			}
+		}
+	}
+
+	for s, data := range patched {
+		s.Replace(bytes.NewReader(data), int64(len(data)))
+	}
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		oh.ImageBase = uint32(newBase)
+	case *OptionalHeader64:
+		oh.ImageBase = newBase
+	}
+	f.CertificateTable = nil
+	return nil
+}
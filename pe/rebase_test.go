@@ -0,0 +1,79 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestRebase(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Rebase(0x10400000); err == nil {
+		t.Error("Rebase accepted an image without base relocations")
+	}
+
+	s := f.Section(".data")
+	data, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	le := binary.LittleEndian
+	le.PutUint64(data, 0x400010)
+	le.PutUint32(data[8:], 0x401000)
+	le.PutUint16(data[12:], 0x0040) // with the low half 0x8123, 0x3f8123
+	s.Replace(bytes.NewReader(data), int64(len(data)))
+	rva := s.VirtualAddress
+	for _, r := range []struct {
+		rva uint32
+		typ byte
+	}{
+		{rva, IMAGE_REL_BASED_DIR64},
+		{rva + 8, IMAGE_REL_BASED_HIGHLOW},
+		{rva + 12, IMAGE_REL_BASED_HIGHADJ},
+		{rva&^0xfff | 0x123, 8}, // the low half of the HIGHADJ address
+	} {
+		if err := f.AddBaseReloc(r.rva, r.typ); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := f.Rebase(0x10401000); err == nil {
+		t.Error("Rebase accepted a base that is not a multiple of 64 KB")
+	}
+	if err := f.Rebase(0x10400000); err != nil {
+		t.Fatal(err)
+	}
+	g := reparse(t, f)
+	if base := g.imageBase(); base != 0x10400000 {
+		t.Errorf("ImageBase is %#x", base)
+	}
+	data, err = g.Section(".data").Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := le.Uint64(data); v != 0x10400010 {
+		t.Errorf("DIR64 field is %#x", v)
+	}
+	if v := le.Uint32(data[8:]); v != 0x10401000 {
+		t.Errorf("HIGHLOW field is %#x", v)
+	}
+	if v := le.Uint16(data[12:]); v != 0x1040 {
+		t.Errorf("HIGHADJ field is %#x", v)
+	}
+
+	// Rebasing back restores the contents.
+	if err := g.Rebase(0x400000); err != nil {
+		t.Fatal(err)
+	}
+	data, err = g.Section(".data").Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := le.Uint64(data); v != 0x400010 {
+		t.Errorf("DIR64 field is %#x after rebasing back", v)
+	}
+}
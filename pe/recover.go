@@ -0,0 +1,178 @@
+package pe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// A RecoveredFunction is a function found from the function table of an
+// image, for images whose symbols were stripped. Addresses are RVAs.
+type RecoveredFunction struct {
+	// Name is the name of the export at Start, or sub_<address> with
+	// the virtual address of Start, as disassemblers name functions.
+	Name  string
+	Start uint32
+	End   uint32 // end of the primary part of the function
+
+	// Parts are the function table entries of the separated parts of
+	// the function, such as cold code, whose unwind information is
+	// chained to that of the function.
+	Parts []RuntimeFunction
+}
+
+// maxUnwindChain bounds the chains of x64 unwind information followed
+// to find the primary entry of a function.
+const maxUnwindChain = 32
+
+// RecoverFunctions returns the functions of an x64 or ARM64 image
+// described by its exception directory, sorted by Start. The table keeps
+// the bounds of every function that is not a leaf, so it recovers
+// function starts and ends where there are no symbols.
+func (f *File) RecoverFunctions() ([]RecoveredFunction, error) {
+	var funcs []RecoveredFunction
+	var err error
+	switch f.Machine {
+	case IMAGE_FILE_MACHINE_AMD64:
+		funcs, err = f.recoverAMD64Functions()
+	case IMAGE_FILE_MACHINE_ARM64:
+		funcs, err = f.recoverARM64Functions()
+	default:
+		return nil, fmt.Errorf("machine %#x has no 64-bit function table", f.Machine)
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint32]string)
+	if f.OptionalHeader != nil {
+		exports, err := f.Exports()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range exports {
+			if e.Name != "" && e.Forward == "" {
+				names[e.VirtualAddress] = e.Name
+			}
+		}
+	}
+	base := f.imageBase()
+	for i := range funcs {
+		fn := &funcs[i]
+		if fn.Name = names[fn.Start]; fn.Name == "" {
+			fn.Name = fmt.Sprintf("sub_%x", base+uint64(fn.Start))
+		}
+	}
+	sort.Slice(funcs, func(i, j int) bool { return funcs[i].Start < funcs[j].Start })
+	return funcs, nil
+}
+
+func (f *File) recoverAMD64Functions() ([]RecoveredFunction, error) {
+	table, err := f.RuntimeFunctions()
+	if err != nil {
+		return nil, err
+	}
+	var funcs []RecoveredFunction
+	primary := make(map[uint32]int) // BeginAddress to index in funcs
+	var chained []RuntimeFunction
+	for _, rf := range table {
+		if rf.BeginAddress == 0 && rf.EndAddress == 0 {
+			continue // padding
+		}
+		if _, ok, err := f.chainedParent(rf); err != nil {
+			return nil, err
+		} else if ok {
+			chained = append(chained, rf)
+			continue
+		}
+		primary[rf.BeginAddress] = len(funcs)
+		funcs = append(funcs, RecoveredFunction{Start: rf.BeginAddress, End: rf.EndAddress})
+	}
+	for _, rf := range chained {
+		parent := rf
+		for n := 0; ; n++ {
+			p, ok, err := f.chainedParent(parent)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+			if n == maxUnwindChain {
+				return nil, fmt.Errorf("unwind information of %#x is chained too deep", rf.BeginAddress)
+			}
+			parent = p
+		}
+		i, ok := primary[parent.BeginAddress]
+		if !ok {
+			return nil, fmt.Errorf("unwind information of %#x is chained to %#x, which has no function table entry", rf.BeginAddress, parent.BeginAddress)
+		}
+		funcs[i].Parts = append(funcs[i].Parts, rf)
+	}
+	return funcs, nil
+}
+
+// chainedParent returns the function table entry that the unwind
+// information of rf is chained to, if it has UNW_FLAG_CHAININFO, or that
+// rf refers to directly, if the low bit of its UnwindInfoAddress is set.
+func (f *File) chainedParent(rf RuntimeFunction) (RuntimeFunction, bool, error) {
+	at := rf.UnwindInfoAddress &^ 1
+	if rf.UnwindInfoAddress&1 == 0 {
+		hdr, err := f.rvaData(at, 4)
+		if err != nil {
+			return RuntimeFunction{}, false, fmt.Errorf("unwind information of %#x: %v", rf.BeginAddress, err)
+		}
+		if hdr[0]>>3&UNW_FLAG_CHAININFO == 0 {
+			return RuntimeFunction{}, false, nil
+		}
+		// The parent entry follows the unwind codes, whose count is
+		// rounded up to an even number.
+		at += 4 + 2*((uint32(hdr[2])+1)&^1)
+	}
+	b, err := f.rvaData(at, 12)
+	if err != nil {
+		return RuntimeFunction{}, false, fmt.Errorf("chained unwind information of %#x: %v", rf.BeginAddress, err)
+	}
+	return RuntimeFunction{
+		BeginAddress:      binary.LittleEndian.Uint32(b),
+		EndAddress:        binary.LittleEndian.Uint32(b[4:]),
+		UnwindInfoAddress: binary.LittleEndian.Uint32(b[8:]),
+	}, true, nil
+}
+
+// recoverARM64Functions decodes the ARM64 function table, whose entries
+// hold the start of a function and either packed unwind data, which
+// gives its length, or the RVA of its .xdata record, whose header does.
+func (f *File) recoverARM64Functions() ([]RecoveredFunction, error) {
+	dd := f.dataDirectories()
+	if len(dd) <= IMAGE_DIRECTORY_ENTRY_EXCEPTION || dd[IMAGE_DIRECTORY_ENTRY_EXCEPTION].VirtualAddress == 0 {
+		return nil, nil
+	}
+	d := dd[IMAGE_DIRECTORY_ENTRY_EXCEPTION]
+	b, err := f.rvaData(d.VirtualAddress, d.Size/8*8)
+	if err != nil {
+		return nil, fmt.Errorf("exception directory: %v", err)
+	}
+	var funcs []RecoveredFunction
+	for ; len(b) >= 8; b = b[8:] {
+		begin := binary.LittleEndian.Uint32(b)
+		unwind := binary.LittleEndian.Uint32(b[4:])
+		if begin == 0 && unwind == 0 {
+			continue // padding
+		}
+		var length uint32
+		switch unwind & 3 {
+		case 0: // .xdata record
+			x, err := f.rvaData(unwind, 4)
+			if err != nil {
+				return nil, fmt.Errorf("unwind information of %#x: %v", begin, err)
+			}
+			length = binary.LittleEndian.Uint32(x) & 0x3ffff * 4
+		case 3: // reserved
+			continue
+		default: // packed unwind data
+			length = unwind >> 2 & 0x7ff * 4
+		}
+		funcs = append(funcs, RecoveredFunction{Start: begin, End: begin + length})
+	}
+	return funcs, nil
+}
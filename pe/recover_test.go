@@ -0,0 +1,98 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestRecoverFunctions(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	table, err := f.RuntimeFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcs, err := f.RecoverFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(funcs) != len(table) {
+		t.Fatalf("recovered %d functions from %d function table entries", len(funcs), len(table))
+	}
+	text := f.Section(".text")
+	starts := make(map[uint32]string)
+	for _, s := range f.Symbols {
+		if s.Type == 0x20 && s.SectionNumber == 1 {
+			starts[text.VirtualAddress+s.Value] = s.Name
+		}
+	}
+	for i, fn := range funcs {
+		if _, ok := starts[fn.Start]; !ok || fn.End <= fn.Start || len(fn.Parts) != 0 {
+			t.Errorf("function %+v is not at a function symbol", fn)
+		}
+		if i > 0 && funcs[i-1].Start >= fn.Start {
+			t.Errorf("functions are not sorted: %+v before %+v", funcs[i-1], fn)
+		}
+	}
+	if funcs[0].Name != "sub_401000" {
+		t.Errorf("first function is named %q", funcs[0].Name)
+	}
+
+	// Chain entry 3 to entry 2, directly through the low bit of its
+	// unwind information address, and entry 5 to entry 4 through its
+	// unwind information.
+	pdata := f.Section(".pdata")
+	data, err := pdata.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint32(data[12*3+8:], pdata.VirtualAddress+12*2|1)
+	pdata.Replace(bytes.NewReader(data), int64(len(data)))
+	xdata := f.Section(".xdata")
+	x, err := xdata.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := table[5].UnwindInfoAddress - xdata.VirtualAddress
+	x[at] |= UNW_FLAG_CHAININFO << 3
+	parent := at + 4 + 2*((uint32(x[at+2])+1)&^1)
+	copy(x[parent:], data[12*4:12*5])
+	xdata.Replace(bytes.NewReader(x), int64(len(x)))
+
+	funcs, err = f.RecoverFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(funcs) != len(table)-2 {
+		t.Fatalf("recovered %d functions from %d function table entries with 2 chained", len(funcs), len(table))
+	}
+	if p := funcs[2].Parts; len(p) != 1 || p[0].BeginAddress != table[3].BeginAddress {
+		t.Errorf("parts of %+v, want entry 3", funcs[2])
+	}
+	if p := funcs[3].Parts; len(p) != 1 || p[0] != table[5] {
+		t.Errorf("parts of %+v, want entry 5", funcs[3])
+	}
+
+	// The same table as ARM64 entries: a packed entry of 16 instructions
+	// and one with an .xdata record of 8.
+	arm := make([]byte, len(data))
+	binary.LittleEndian.PutUint32(arm[0:], 0x1000)
+	binary.LittleEndian.PutUint32(arm[4:], 16<<2|1)
+	binary.LittleEndian.PutUint32(arm[8:], 0x2000)
+	binary.LittleEndian.PutUint32(arm[12:], xdata.VirtualAddress)
+	binary.LittleEndian.PutUint32(x, 8)
+	pdata.Replace(bytes.NewReader(arm), int64(len(arm)))
+	xdata.Replace(bytes.NewReader(x), int64(len(x)))
+	f.Machine = IMAGE_FILE_MACHINE_ARM64
+	funcs, err = f.RecoverFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(funcs) != 2 || funcs[0].End != 0x1040 || funcs[1].End != 0x2020 {
+		t.Errorf("ARM64 functions are %+v", funcs)
+	}
+}
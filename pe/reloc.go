@@ -3,6 +3,7 @@ package pe
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 )
@@ -37,20 +38,24 @@ const (
 	//IMAGE_REL_BASED_ABSOLUTE - The base relocation is skipped. This type can be used to pad a block.
 	IMAGE_REL_BASED_ABSOLUTE = 0
 
-	//IMAGE_REL_BASED_HIGH           = 1
-	//IMAGE_REL_BASED_LOW            = 2
+	IMAGE_REL_BASED_HIGH = 1 // high 16 bits of the difference, applied to a 16-bit field
+	IMAGE_REL_BASED_LOW  = 2 // low 16 bits of the difference, applied to a 16-bit field
 
 	//IMAGE_REL_BASED_HIGHLOW - The base relocation applies all 32 bits of the difference to the 32-bit field at offset.
 	IMAGE_REL_BASED_HIGHLOW = 3
 
-	//IMAGE_REL_BASED_HIGHADJ        = 4
-	//IMAGE_REL_BASED_MIPS_JMPADDR   = 5
-	//IMAGE_REL_BASED_ARM_MOV32      = 5
-	//IMAGE_REL_BASED_RISCV_HIGH20   = 5
-	//IMAGE_REL_BASED_THUMB_MOV32    = 7
-	//IMAGE_REL_BASED_RISCV_LOW12I   = 7
-	//IMAGE_REL_BASED_RISCV_LOW12S   = 8
-	//IMAGE_REL_BASED_MIPS_JMPADDR16 = 9
+	IMAGE_REL_BASED_HIGHADJ             = 4 // high 16 bits, with the low 16 bits in the next entry
+	IMAGE_REL_BASED_MIPS_JMPADDR        = 5 // MIPS jump instruction
+	IMAGE_REL_BASED_ARM_MOV32           = 5 // ARM MOVW/MOVT pair
+	IMAGE_REL_BASED_RISCV_HIGH20        = 5 // high 20 bits of a RISC-V absolute address
+	IMAGE_REL_BASED_THUMB_MOV32         = 7 // Thumb MOVW/MOVT pair
+	IMAGE_REL_BASED_RISCV_LOW12I        = 7 // low 12 bits of a RISC-V absolute address, in an I-type instruction
+	IMAGE_REL_BASED_RISCV_LOW12S        = 8 // low 12 bits of a RISC-V absolute address, in an S-type instruction
+	IMAGE_REL_BASED_LOONGARCH32_MARK_LA = 8 // LoongArch32 address loading instruction sequence
+	IMAGE_REL_BASED_LOONGARCH64_MARK_LA = 8 // LoongArch64 address loading instruction sequence
+	IMAGE_REL_BASED_MIPS_JMPADDR16      = 9 // MIPS16 jump instruction
+
+	//IMAGE_REL_BASED_DIR64 - The base relocation applies the difference to the 64-bit field at offset.
 	IMAGE_REL_BASED_DIR64 = 10
 )
 
@@ -62,7 +67,7 @@ func (f *File) readBaseRelocationTable() (*[]RelocationTableEntry, error) {
 	}
 
 	var dd DataDirectory
-	if f.Machine == IMAGE_FILE_MACHINE_AMD64 {
+	if f.is64() {
 		dd = f.OptionalHeader.(*OptionalHeader64).DataDirectory[IMAGE_DIRECTORY_ENTRY_BASERELOC]
 	} else {
 		dd = f.OptionalHeader.(*OptionalHeader32).DataDirectory[IMAGE_DIRECTORY_ENTRY_BASERELOC]
@@ -88,6 +93,9 @@ func (f *File) readBaseRelocationTable() (*[]RelocationTableEntry, error) {
 		if err != nil {
 			return nil, fmt.Errorf("fail to read relocation block: %v", err)
 		}
+		if reloBlock.SizeOfBlock < 8 || int64(reloBlock.SizeOfBlock-8) > int64(r.Len()) {
+			return nil, fmt.Errorf("relocation block of %d bytes is out of range", reloBlock.SizeOfBlock)
+		}
 		numBlocks := (reloBlock.SizeOfBlock - 8) / 2
 		blocks := make([]BlockItem, numBlocks)
 		for i := uint32(0); i < numBlocks; i++ {
@@ -108,50 +116,179 @@ func (f *File) readBaseRelocationTable() (*[]RelocationTableEntry, error) {
 	return &reloBlocks, nil
 }
 
-// Relocate - performs base relocations on this image to the given offset
+// Relocate - performs base relocations on this image to the given offset.
+// Unlike RelocateImage, it applies every base relocation it can and drops
+// the errors of the others.
+//
+// Deprecated: use RelocateImage, which reports the relocations that
+// cannot be applied.
 func (f *File) Relocate(baseAddr uint64, image *[]byte) {
-	var imageBase uint64
-	pe64 := f.Machine == IMAGE_FILE_MACHINE_AMD64
-	if pe64 {
-		imageBase = f.OptionalHeader.(*OptionalHeader64).ImageBase
-	} else {
-		imageBase = uint64(f.OptionalHeader.(*OptionalHeader32).ImageBase)
+	f.relocate(baseAddr, *image, true)
+}
+
+// RelocateImage applies the base relocations of the image to image, the
+// contents of the file f was read from, for loading at baseAddr, and
+// sets the ImageBase field of its optional header. f itself is not
+// changed; see Rebase for that. The relocation types Rebase supports are
+// applied with the full 64-bit difference between the bases. An
+// unsupported type, or a field outside image, is an error, and leaves
+// image unchanged.
+func (f *File) RelocateImage(baseAddr uint64, image []byte) error {
+	out := append([]byte(nil), image...)
+	if err := f.relocate(baseAddr, out, false); err != nil {
+		return err
+	}
+	copy(image, out)
+	return nil
+}
+
+// relocate implements RelocateImage on out in place. If bestEffort is
+// set, relocations that cannot be applied are skipped instead of being
+// an error.
+func (f *File) relocate(baseAddr uint64, out []byte, bestEffort bool) error {
+	if f.OptionalHeader == nil {
+		return errors.New("file has no optional header")
+	}
+	imageBase := f.imageBase()
+	if baseAddr == imageBase {
+		return nil
+	}
+	if f.BaseRelocationTable == nil {
+		return errors.New("image has no base relocations")
+	}
+	delta := baseAddr - imageBase
+	// apply applies items[i] and returns the index of the last item it
+	// used.
+	apply := func(items []BlockItem, i int, rva uint32) (int, error) {
+		size, err := f.baseRelocSize(items[i].Type, rva)
+		if err != nil {
+			return i, err
+		}
+		s := f.sectionForRVA(rva)
+		if s == nil || rva-s.VirtualAddress+size > s.Size {
+			return i, fmt.Errorf("base relocation at %#x is outside the raw data of the sections", rva)
+		}
+		idx := uint64(s.Offset) + uint64(rva-s.VirtualAddress)
+		if idx+uint64(size) > uint64(len(out)) {
+			return i, fmt.Errorf("base relocation at %#x is past the end of the image", rva)
+		}
+		return f.applyBaseReloc(out[idx:idx+uint64(size)], items, i, delta, rva)
 	}
 	for _, block := range *f.BaseRelocationTable {
-		pageRVA := block.VirtualAddress
-		for _, item := range block.BlockItems {
-			if item.Type == IMAGE_REL_BASED_HIGHLOW { // 32 bit
-				delta := uint32(baseAddr - imageBase)
-				fileOffset := f.RVAToFileOffset(pageRVA)
-				idx := fileOffset + uint32(item.Offset)
-				originalAddress := binary.LittleEndian.Uint32((*image)[idx : idx+4])
-				b := make([]byte, 4)
-				binary.LittleEndian.PutUint32(b, originalAddress+delta)
-				copy((*image)[idx:idx+4], b)
-			} else if item.Type == IMAGE_REL_BASED_DIR64 { // 64 bit
-				delta := baseAddr - imageBase
-				fileOffset := f.RVAToFileOffset(pageRVA)
-				idx := fileOffset + uint32(item.Offset)
-				originalAddress := binary.LittleEndian.Uint64((*image)[idx : idx+8])
-				b := make([]byte, 8)
-				binary.LittleEndian.PutUint64(b, originalAddress+delta)
-				copy((*image)[idx:idx+8], b)
+		items := block.BlockItems
+		for i := 0; i < len(items); i++ {
+			if items[i].Type == IMAGE_REL_BASED_ABSOLUTE {
+				continue
 			}
+			j, err := apply(items, i, block.VirtualAddress+uint32(items[i].Offset))
+			if err != nil && !bestEffort {
+				return err
+			}
+			i = j
 		}
 	}
 
 	// update imageBase in the optional header
-	if pe64 {
-		b := make([]byte, 8)
-		binary.LittleEndian.PutUint64(b, baseAddr)
+	if f.is64() {
 		idx := f.OptionalHeaderOffset + 24
-		copy((*image)[idx:idx+8], b)
+		if idx+8 > int64(len(out)) {
+			return errors.New("optional header is past the end of the image")
+		}
+		binary.LittleEndian.PutUint64(out[idx:], baseAddr)
 	} else {
-		b := make([]byte, 4)
-		binary.LittleEndian.PutUint32(b, uint32(baseAddr))
 		idx := f.OptionalHeaderOffset + 28
-		copy((*image)[idx:idx+4], b)
+		if idx+4 > int64(len(out)) {
+			return errors.New("optional header is past the end of the image")
+		}
+		binary.LittleEndian.PutUint32(out[idx:], uint32(baseAddr))
+	}
+	return nil
+}
+
+// baseRelocSize returns the size of the field that a base relocation of
+// type typ at rva patches. The machine specific types are only supported
+// for the ARM MOVW/MOVT pairs.
+func (f *File) baseRelocSize(typ byte, rva uint32) (uint32, error) {
+	switch typ {
+	case IMAGE_REL_BASED_HIGH, IMAGE_REL_BASED_LOW, IMAGE_REL_BASED_HIGHADJ:
+		return 2, nil
+	case IMAGE_REL_BASED_HIGHLOW:
+		return 4, nil
+	case IMAGE_REL_BASED_DIR64:
+		return 8, nil
+	case IMAGE_REL_BASED_ARM_MOV32:
+		if f.Machine == IMAGE_FILE_MACHINE_ARM {
+			return 8, nil
+		}
+	case IMAGE_REL_BASED_THUMB_MOV32:
+		if f.Machine == IMAGE_FILE_MACHINE_ARMNT || f.Machine == IMAGE_FILE_MACHINE_THUMB {
+			return 8, nil
+		}
+	}
+	return 0, fmt.Errorf("base relocation of type %d at %#x is not supported for machine %#x", typ, rva, f.Machine)
+}
+
+// applyBaseReloc adds delta to the address in b, the field of the base
+// relocation items[i] at rva, and returns the index of the last item it
+// used: the low half of a HIGHADJ address is in the next item.
+func (f *File) applyBaseReloc(b []byte, items []BlockItem, i int, delta uint64, rva uint32) (int, error) {
+	le := binary.LittleEndian
+	switch items[i].Type {
+	case IMAGE_REL_BASED_HIGH:
+		le.PutUint16(b, le.Uint16(b)+uint16(uint32(delta)>>16))
+	case IMAGE_REL_BASED_LOW:
+		le.PutUint16(b, le.Uint16(b)+uint16(delta))
+	case IMAGE_REL_BASED_HIGHADJ:
+		// The next entry holds the low half of the address, which
+		// rounds the high half.
+		if i+1 == len(items) {
+			return i, fmt.Errorf("HIGHADJ base relocation at %#x has no low half", rva)
+		}
+		i++
+		low := uint32(items[i].Offset) | uint32(items[i].Type)<<12
+		addr := uint32(le.Uint16(b))<<16 + uint32(int32(int16(low))) + uint32(delta)
+		le.PutUint16(b, uint16((addr+0x8000)>>16))
+	case IMAGE_REL_BASED_HIGHLOW:
+		le.PutUint32(b, le.Uint32(b)+uint32(delta))
+	case IMAGE_REL_BASED_DIR64:
+		le.PutUint64(b, le.Uint64(b)+delta)
+	case IMAGE_REL_BASED_ARM_MOV32, IMAGE_REL_BASED_THUMB_MOV32:
+		thumb := items[i].Type == IMAGE_REL_BASED_THUMB_MOV32
+		addr := uint32(movImm16(b[4:], thumb))<<16 | uint32(movImm16(b, thumb))
+		addr += uint32(delta)
+		putMovImm16(b, uint16(addr), thumb)
+		putMovImm16(b[4:], uint16(addr>>16), thumb)
+	}
+	return i, nil
+}
+
+// movImm16 returns the 16-bit immediate of the ARM or Thumb-2 MOVW or
+// MOVT instruction in b.
+func movImm16(b []byte, thumb bool) uint16 {
+	le := binary.LittleEndian
+	if !thumb {
+		ins := le.Uint32(b)
+		return uint16(ins>>16&0xf<<12 | ins&0xfff)
+	}
+	// imm4:i:imm3:imm8, split over the two halfwords.
+	hi, lo := le.Uint16(b), le.Uint16(b[2:])
+	return hi&0xf<<12 | hi>>10&1<<11 | lo>>12&7<<8 | lo&0xff
+}
+
+// putMovImm16 sets the 16-bit immediate of the ARM or Thumb-2 MOVW or
+// MOVT instruction in b to imm.
+func putMovImm16(b []byte, imm uint16, thumb bool) {
+	le := binary.LittleEndian
+	if !thumb {
+		ins := le.Uint32(b)&^0xf0fff | uint32(imm)>>12<<16 | uint32(imm)&0xfff
+		le.PutUint32(b, ins)
+		return
 	}
+	hi, lo := le.Uint16(b), le.Uint16(b[2:])
+	hi = hi&^0x040f | imm>>12 | imm>>11&1<<10
+	lo = lo&^0x70ff | imm>>8&7<<12 | imm&0xff
+	le.PutUint16(b, hi)
+	le.PutUint16(b[2:], lo)
 }
 
 func readRelocs(sh *SectionHeader, r io.ReadSeeker) ([]Reloc, error) {
@@ -0,0 +1,105 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestRelocate(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s := f.Section(".data")
+	data, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	le := binary.LittleEndian
+	le.PutUint64(data, 0x400010)
+	le.PutUint32(data[8:], 0x401000)
+	s.Replace(bytes.NewReader(data), int64(len(data)))
+	for _, r := range []struct {
+		rva uint32
+		typ byte
+	}{
+		{s.VirtualAddress, IMAGE_REL_BASED_DIR64},
+		{s.VirtualAddress + 8, IMAGE_REL_BASED_HIGHLOW},
+	} {
+		if err := f.AddBaseReloc(r.rva, r.typ); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g := reparse(t, f)
+	image, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The difference does not fit in 32 bits.
+	const base = 0x140000000
+	relocated := append([]byte(nil), image...)
+	g.Relocate(base, &relocated)
+	if err := g.RelocateImage(base, image); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(relocated, image) {
+		t.Error("Relocate and RelocateImage differ")
+	}
+	h, err := NewFile(bytes.NewReader(image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := h.imageBase(); b != base {
+		t.Errorf("ImageBase is %#x", b)
+	}
+	data, err = h.Section(".data").Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := le.Uint64(data); v != 0x140000010 {
+		t.Errorf("DIR64 field is %#x", v)
+	}
+	if v := le.Uint32(data[8:]); v != 0x40001000 {
+		t.Errorf("HIGHLOW field is %#x", v)
+	}
+
+	// A field outside the image leaves it unchanged, but Relocate still
+	// applies the DIR64 relocation, which fits.
+	short := append([]byte(nil), image[:s.Offset+8]...)
+	if err := g.RelocateImage(0x10000000, short); err == nil {
+		t.Error("RelocateImage accepted a field past the end of the image")
+	}
+	if !bytes.Equal(short, image[:s.Offset+8]) {
+		t.Error("failed RelocateImage changed the image")
+	}
+	g.Relocate(0x10000000, &short)
+	if v, want := le.Uint64(short[s.Offset:]), le.Uint64(image[s.Offset:])+0x10000000-g.imageBase(); v != want {
+		t.Errorf("Relocate set the DIR64 field of a short image to %#x, want %#x", v, want)
+	}
+}
+
+func TestMovImm16(t *testing.T) {
+	for _, tt := range []struct {
+		ins   []byte
+		thumb bool
+		imm   uint16
+	}{
+		{[]byte{0x34, 0x02, 0x01, 0xe3}, false, 0x1234}, // movw r0, #0x1234
+		{[]byte{0xcd, 0x1b, 0x4a, 0xe3}, false, 0xabcd}, // movt r1, #0xabcd
+		{[]byte{0x41, 0xf2, 0x34, 0x20}, true, 0x1234},  // movw r0, #0x1234
+		{[]byte{0xca, 0xf6, 0xcd, 0x31}, true, 0xabcd},  // movt r1, #0xabcd
+	} {
+		if imm := movImm16(tt.ins, tt.thumb); imm != tt.imm {
+			t.Errorf("movImm16(% x, %v) = %#x, want %#x", tt.ins, tt.thumb, imm, tt.imm)
+		}
+		b := append([]byte(nil), tt.ins...)
+		putMovImm16(b, 0, tt.thumb)
+		putMovImm16(b, tt.imm, tt.thumb)
+		if !bytes.Equal(b, tt.ins) {
+			t.Errorf("putMovImm16(%#x, %v) = % x, want % x", tt.imm, tt.thumb, b, tt.ins)
+		}
+	}
+}
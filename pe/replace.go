@@ -0,0 +1,109 @@
+package pe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ReplaceSectionData replaces the contents of the named section with
+// data, growing its SizeOfRawData and VirtualSize as needed. The raw data
+// that follows the section in the file moves down by the growth, along
+// with the COFF symbol table and the file offsets of debug directory
+// entries; the certificate table is placed by Bytes.
+//
+// In memory, the section may only grow up to the next section, as the
+// code refers to the sections by RVA, unless the sections after it hold
+// nothing but the base relocations. Those are moved up and the data
+// directory entry follows them. Contents smaller than the section keep
+// its raw size, zero padded.
+func (f *File) ReplaceSectionData(name string, data []byte) error {
+	s := f.Section(name)
+	if s == nil {
+		return fmt.Errorf("no section %s", name)
+	}
+	if s.Offset == 0 {
+		return fmt.Errorf("section %s has no raw data", name)
+	}
+	sectionAlignment, fileAlignment, _, _, isImage := f.imageLayout()
+	if !isImage {
+		fileAlignment = 1
+	}
+	rawSize := alignUp(uint32(len(data)), fileAlignment)
+	if rawSize < s.Size {
+		rawSize = s.Size
+	}
+	grow := rawSize - s.Size
+
+	// Sections that the new virtual size would run into.
+	var moved []*Section
+	var shift uint32
+	if isImage {
+		end := alignUp(s.VirtualAddress+uint32(len(data)), sectionAlignment)
+		next := ^uint32(0)
+		for _, t := range f.Sections {
+			if t != s && t.VirtualAddress > s.VirtualAddress {
+				moved = append(moved, t)
+				if t.VirtualAddress < next {
+					next = t.VirtualAddress
+				}
+			}
+		}
+		if end <= next {
+			moved = nil
+		} else {
+			shift = end - next
+		}
+		dd := f.dataDirectories()
+		for _, t := range moved {
+			if len(dd) <= IMAGE_DIRECTORY_ENTRY_BASERELOC || dd[IMAGE_DIRECTORY_ENTRY_BASERELOC].VirtualAddress != t.VirtualAddress {
+				return fmt.Errorf("%d bytes of %s would overlap %s at RVA %#x", len(data), name, t.Name, t.VirtualAddress)
+			}
+		}
+	}
+
+	if grow != 0 {
+		if f.PreserveRaw {
+			return errors.New("cannot move raw data of a file whose original bytes are preserved")
+		}
+		if isImage && sectionAlignment == fileAlignment && sectionAlignment < 0x1000 {
+			return errors.New("cannot grow raw data of an image whose file and section alignment are equal")
+		}
+		if err := f.shiftRawData(s.Offset+s.Size, grow); err != nil {
+			return err
+		}
+	}
+	raw := make([]byte, rawSize)
+	copy(raw, data)
+	s.Replace(bytes.NewReader(raw), int64(rawSize))
+	s.Size = rawSize
+	if !isImage {
+		return nil
+	}
+	// Smaller contents keep the virtual size, which may cover
+	// uninitialized data past the raw data.
+	if uint32(len(data)) > s.VirtualSize {
+		s.VirtualSize = uint32(len(data))
+	}
+
+	dd := f.dataDirectories()
+	for _, t := range moved {
+		t.VirtualAddress += shift
+		dd[IMAGE_DIRECTORY_ENTRY_BASERELOC].VirtualAddress = t.VirtualAddress
+	}
+	var sizeOfImage uint32
+	for _, t := range f.Sections {
+		if end := alignUp(t.VirtualAddress+t.virtualExtent(), sectionAlignment); end > sizeOfImage {
+			sizeOfImage = end
+		}
+	}
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		oh.SizeOfImage = sizeOfImage
+		addSectionSizes(s.Characteristics, grow, &oh.SizeOfCode, &oh.SizeOfInitializedData, &oh.SizeOfUninitializedData)
+	case *OptionalHeader64:
+		oh.SizeOfImage = sizeOfImage
+		addSectionSizes(s.Characteristics, grow, &oh.SizeOfCode, &oh.SizeOfInitializedData, &oh.SizeOfUninitializedData)
+	}
+	return nil
+}
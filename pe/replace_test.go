@@ -0,0 +1,94 @@
+package pe
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReplaceSectionData(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rdata, err := f.Section(".rdata").Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdataOff := f.Section(".rdata").Offset
+	symtab := f.FileHeader.PointerToSymbolTable
+
+	// .data grows by one file alignment unit, moving the raw data after
+	// it but no RVA.
+	data := bytes.Repeat([]byte{0xaa}, 0x300)
+	if err := f.ReplaceSectionData(".data", data); err != nil {
+		t.Fatal(err)
+	}
+	if s := f.Section(".data"); s.Size != 0x400 || s.VirtualSize != 0x300 {
+		t.Errorf(".data has raw size %#x and virtual size %#x", s.Size, s.VirtualSize)
+	}
+	if off := f.Section(".rdata").Offset; off != rdataOff+0x200 {
+		t.Errorf(".rdata moved from %#x to %#x, want %#x", rdataOff, off, rdataOff+0x200)
+	}
+	if p := f.FileHeader.PointerToSymbolTable; p != symtab+0x200 {
+		t.Errorf("PointerToSymbolTable is %#x, want %#x", p, symtab+0x200)
+	}
+	// Smaller contents keep the virtual size, which may cover .bss like
+	// data the code uses.
+	if err := f.ReplaceSectionData(".data", data[:0x10]); err != nil {
+		t.Fatal(err)
+	}
+	if s := f.Section(".data"); s.Size != 0x400 || s.VirtualSize != 0x300 {
+		t.Errorf(".data has raw size %#x and virtual size %#x after shrinking", s.Size, s.VirtualSize)
+	}
+	if err := f.ReplaceSectionData(".data", data); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.ReplaceSectionData(".data", make([]byte, 0x1800)); err == nil {
+		t.Error("ReplaceSectionData let .data grow over .rdata")
+	}
+
+	// Base relocations after the last section move up with their data
+	// directory entry. The block of .text has two padding entries.
+	block := []byte{0x00, 0x10, 0, 0, 12, 0, 0, 0, 0, 0, 0, 0}
+	reloc, err := f.AddSection(".reloc", block, IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ|IMAGE_SCN_MEM_DISCARDABLE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dd := f.dataDirectories()
+	dd[IMAGE_DIRECTORY_ENTRY_BASERELOC] = DataDirectory{VirtualAddress: reloc.VirtualAddress, Size: uint32(len(block))}
+	relocRVA := reloc.VirtualAddress
+	ranges := bytes.Repeat([]byte{0xbb}, 0x1800)
+	if err := f.ReplaceSectionData(".debug_ranges", ranges); err != nil {
+		t.Fatal(err)
+	}
+	if reloc.VirtualAddress != relocRVA+0x1000 || dd[IMAGE_DIRECTORY_ENTRY_BASERELOC].VirtualAddress != reloc.VirtualAddress {
+		t.Errorf(".reloc at RVA %#x and its directory at %#x, want %#x", reloc.VirtualAddress, dd[IMAGE_DIRECTORY_ENTRY_BASERELOC].VirtualAddress, relocRVA+0x1000)
+	}
+	for _, issue := range f.Validate() {
+		if issue.Severity >= SeverityWarning {
+			t.Errorf("unexpected issue: %v", issue)
+		}
+	}
+
+	f = reparse(t, f)
+	for _, c := range []struct {
+		name string
+		want []byte
+	}{
+		{".data", data},
+		{".rdata", rdata},
+		{".debug_ranges", ranges},
+	} {
+		got, err := f.Section(c.name).Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) < len(c.want) || !bytes.Equal(got[:len(c.want)], c.want) {
+			t.Errorf("%s does not hold its data after writing", c.name)
+		}
+	}
+	if len(f.COFFSymbols) == 0 {
+		t.Error("COFF symbols lost")
+	}
+}
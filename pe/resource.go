@@ -0,0 +1,332 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"unicode/utf16"
+)
+
+// A resourceDir is a directory table of the resource tree
+// (IMAGE_RESOURCE_DIRECTORY) with its entries.
+type resourceDir struct {
+	characteristics uint32
+	timeDateStamp   uint32
+	majorVersion    uint16
+	minorVersion    uint16
+	entries         []*resourceEntry
+}
+
+// A resourceEntry is an entry of a resourceDir, identified by name or,
+// if name is empty, by id. It leads either to a subdirectory or, in the
+// language level, to a resource.
+type resourceEntry struct {
+	name string
+	id   uint32
+	dir  *resourceDir
+	data *resourceData
+}
+
+// A resourceData is the contents of a resource and the code page of its
+// IMAGE_RESOURCE_DATA_ENTRY.
+type resourceData struct {
+	data     []byte
+	codePage uint32
+}
+
+// find returns the entry of d with the given name, or id if name is
+// empty, or nil.
+func (d *resourceDir) find(name string, id uint32) *resourceEntry {
+	for _, e := range d.entries {
+		if e.name == name && (name != "" || e.id == id) {
+			return e
+		}
+	}
+	return nil
+}
+
+// subdir returns the subdirectory of d with the given id, adding it if
+// there is none.
+func (d *resourceDir) subdir(id uint32) *resourceDir {
+	if e := d.find("", id); e != nil && e.dir != nil {
+		return e.dir
+	}
+	e := &resourceEntry{id: id, dir: &resourceDir{}}
+	d.entries = append(d.entries, e)
+	return e.dir
+}
+
+// remove deletes the entry e from d.
+func (d *resourceDir) remove(e *resourceEntry) {
+	for i, x := range d.entries {
+		if x == e {
+			d.entries = append(d.entries[:i], d.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// sort orders the entries of d as loaders expect: named entries by name
+// before numbered entries by id.
+func (d *resourceDir) sort() {
+	sort.SliceStable(d.entries, func(i, j int) bool {
+		a, b := d.entries[i], d.entries[j]
+		if (a.name != "") != (b.name != "") {
+			return a.name != ""
+		}
+		if a.name != "" {
+			return a.name < b.name
+		}
+		return a.id < b.id
+	})
+}
+
+// resources parses the resource tree of f. It returns nil if f has no
+// resource directory.
+func (f *File) resources() (*resourceDir, error) {
+	ds, dd := f.sectionFromDirectoryEntry(IMAGE_DIRECTORY_ENTRY_RESOURCE)
+	if ds == nil || dd.Size == 0 {
+		return nil, nil
+	}
+	data, err := ds.Data()
+	if err != nil {
+		return nil, err
+	}
+	base := dd.VirtualAddress - ds.VirtualAddress
+	if uint64(base) > uint64(len(data)) {
+		return nil, fmt.Errorf("resource directory at RVA %#x is past the raw data of section %q", dd.VirtualAddress, ds.Name)
+	}
+	r := resourceReader{f: f, data: data[base:], seen: make(map[uint32]bool)}
+	return r.dir(0, 0)
+}
+
+// A resourceReader reads the resource tree from the resource directory
+// data, in which all offsets are relative.
+type resourceReader struct {
+	f    *File
+	data []byte
+	seen map[uint32]bool // offsets of directories read, to stop loops
+}
+
+func (r *resourceReader) dir(off uint32, depth int) (*resourceDir, error) {
+	if limit := r.f.limits.withDefaults().MaxResourceDepth; depth >= limit {
+		return nil, fmt.Errorf("resource tree is nested deeper than %d levels", limit)
+	}
+	if r.seen[off] {
+		return nil, fmt.Errorf("resource directory at %#x is referenced twice", off)
+	}
+	r.seen[off] = true
+	if uint64(off)+16 > uint64(len(r.data)) {
+		return nil, fmt.Errorf("resource directory at %#x is out of range", off)
+	}
+	b := r.data[off:]
+	d := &resourceDir{
+		characteristics: binary.LittleEndian.Uint32(b),
+		timeDateStamp:   binary.LittleEndian.Uint32(b[4:]),
+		majorVersion:    binary.LittleEndian.Uint16(b[8:]),
+		minorVersion:    binary.LittleEndian.Uint16(b[10:]),
+	}
+	n := uint32(binary.LittleEndian.Uint16(b[12:])) + uint32(binary.LittleEndian.Uint16(b[14:]))
+	if uint64(off)+16+8*uint64(n) > uint64(len(r.data)) {
+		return nil, fmt.Errorf("entries of resource directory at %#x are out of range", off)
+	}
+	for i := uint32(0); i < n; i++ {
+		id := binary.LittleEndian.Uint32(b[16+8*i:])
+		next := binary.LittleEndian.Uint32(b[20+8*i:])
+		e := &resourceEntry{id: id}
+		if id&0x80000000 != 0 {
+			name, err := r.name(id & 0x7fffffff)
+			if err != nil {
+				return nil, err
+			}
+			e.name, e.id = name, 0
+		}
+		var err error
+		if next&0x80000000 != 0 {
+			e.dir, err = r.dir(next&0x7fffffff, depth+1)
+		} else {
+			e.data, err = r.leaf(next)
+		}
+		if err != nil {
+			return nil, err
+		}
+		d.entries = append(d.entries, e)
+	}
+	return d, nil
+}
+
+// name reads an IMAGE_RESOURCE_DIR_STRING_U.
+func (r *resourceReader) name(off uint32) (string, error) {
+	if uint64(off)+2 > uint64(len(r.data)) {
+		return "", fmt.Errorf("resource name at %#x is out of range", off)
+	}
+	n := uint64(binary.LittleEndian.Uint16(r.data[off:]))
+	if uint64(off)+2+2*n > uint64(len(r.data)) {
+		return "", fmt.Errorf("resource name at %#x is truncated", off)
+	}
+	u := make([]uint16, n)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(r.data[off+2+2*uint32(i):])
+	}
+	return string(utf16.Decode(u)), nil
+}
+
+// leaf reads an IMAGE_RESOURCE_DATA_ENTRY and the data it points to.
+func (r *resourceReader) leaf(off uint32) (*resourceData, error) {
+	if uint64(off)+16 > uint64(len(r.data)) {
+		return nil, fmt.Errorf("resource data entry at %#x is out of range", off)
+	}
+	rva := binary.LittleEndian.Uint32(r.data[off:])
+	size := binary.LittleEndian.Uint32(r.data[off+4:])
+	data, err := r.f.rvaData(rva, size)
+	if err != nil {
+		return nil, fmt.Errorf("resource data: %v", err)
+	}
+	return &resourceData{
+		data:     append([]byte(nil), data...),
+		codePage: binary.LittleEndian.Uint32(r.data[off+8:]),
+	}, nil
+}
+
+// bytes lays out the resource tree rooted at d for loading at rva: the
+// directory tables, then the data entries, the names and the resource
+// data, each resource aligned to 8 bytes. The entries of every directory
+// are sorted first.
+func (d *resourceDir) bytes(rva uint32) []byte {
+	var dirs []*resourceDir
+	var leaves []*resourceData
+	var names []string
+	for queue := []*resourceDir{d}; len(queue) > 0; queue = queue[1:] {
+		dir := queue[0]
+		dir.sort()
+		dirs = append(dirs, dir)
+		for _, e := range dir.entries {
+			if e.name != "" {
+				names = append(names, e.name)
+			}
+			if e.dir != nil {
+				queue = append(queue, e.dir)
+			} else {
+				leaves = append(leaves, e.data)
+			}
+		}
+	}
+
+	// Offsets of everything, relative to the start of the tree.
+	dirOff := make(map[*resourceDir]uint32)
+	off := uint32(0)
+	for _, dir := range dirs {
+		dirOff[dir] = off
+		off += 16 + 8*uint32(len(dir.entries))
+	}
+	leafOff := make(map[*resourceData]uint32)
+	for _, l := range leaves {
+		leafOff[l] = off
+		off += 16
+	}
+	nameOff := make(map[string]uint32)
+	for _, n := range names {
+		if _, ok := nameOff[n]; !ok {
+			nameOff[n] = off
+			off += 2 + 2*uint32(len(utf16.Encode([]rune(n))))
+		}
+	}
+	dataOff := make(map[*resourceData]uint32)
+	for _, l := range leaves {
+		off = alignUp(off, 8)
+		dataOff[l] = off
+		off += uint32(len(l.data))
+	}
+
+	b := make([]byte, off)
+	le := binary.LittleEndian
+	for _, dir := range dirs {
+		t := b[dirOff[dir]:]
+		le.PutUint32(t, dir.characteristics)
+		le.PutUint32(t[4:], dir.timeDateStamp)
+		le.PutUint16(t[8:], dir.majorVersion)
+		le.PutUint16(t[10:], dir.minorVersion)
+		var named uint16
+		for i, e := range dir.entries {
+			if e.name != "" {
+				named++
+				le.PutUint32(t[16+8*i:], 0x80000000|nameOff[e.name])
+			} else {
+				le.PutUint32(t[16+8*i:], e.id)
+			}
+			if e.dir != nil {
+				le.PutUint32(t[20+8*i:], 0x80000000|dirOff[e.dir])
+			} else {
+				le.PutUint32(t[20+8*i:], leafOff[e.data])
+			}
+		}
+		le.PutUint16(t[12:], named)
+		le.PutUint16(t[14:], uint16(len(dir.entries))-named)
+	}
+	for _, l := range leaves {
+		t := b[leafOff[l]:]
+		le.PutUint32(t, rva+dataOff[l])
+		le.PutUint32(t[4:], uint32(len(l.data)))
+		le.PutUint32(t[8:], l.codePage)
+		copy(b[dataOff[l]:], l.data)
+	}
+	for n, o := range nameOff {
+		u := utf16.Encode([]rune(n))
+		le.PutUint16(b[o:], uint16(len(u)))
+		for i, c := range u {
+			le.PutUint16(b[o+2+2*uint32(i):], c)
+		}
+	}
+	return b
+}
+
+// setResources replaces the resource tree of f with the one rooted at d.
+// The tree is rewritten in place if it fits in the space of the old one,
+// or of the whole section if that is a resource section of its own, and
+// is otherwise put in a new section.
+func (f *File) setResources(d *resourceDir) error {
+	if len(f.dataDirectories()) <= IMAGE_DIRECTORY_ENTRY_RESOURCE {
+		return fmt.Errorf("file has no resource data directory entry")
+	}
+	size := uint32(len(d.bytes(0)))
+
+	ds, dd := f.sectionFromDirectoryEntry(IMAGE_DIRECTORY_ENTRY_RESOURCE)
+	if ds != nil && dd.Size != 0 {
+		data, err := ds.Data()
+		if err != nil {
+			return err
+		}
+		base := dd.VirtualAddress - ds.VirtualAddress
+		room := uint64(dd.Size)
+		if base == 0 && ds.Name == ".rsrc" {
+			room = uint64(len(data))
+			if vs := uint64(ds.virtualExtent()); vs < room {
+				room = vs
+			}
+		}
+		if uint64(size) <= room && uint64(base)+room <= uint64(len(data)) {
+			b := d.bytes(dd.VirtualAddress)
+			copy(data[base:], b)
+			for i := uint64(base) + uint64(len(b)); i < uint64(base)+uint64(dd.Size) && i < uint64(len(data)); i++ {
+				data[i] = 0
+			}
+			ds.Replace(bytes.NewReader(data), int64(len(data)))
+			f.dataDirectories()[IMAGE_DIRECTORY_ENTRY_RESOURCE].Size = size
+			return nil
+		}
+	}
+
+	s, err := f.AddSection(".rsrc2", make([]byte, size), IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ)
+	if err != nil {
+		return err
+	}
+	data, err := s.Data()
+	if err != nil {
+		return err
+	}
+	copy(data, d.bytes(s.VirtualAddress))
+	s.Replace(bytes.NewReader(data), int64(len(data)))
+	f.dataDirectories()[IMAGE_DIRECTORY_ENTRY_RESOURCE] = DataDirectory{VirtualAddress: s.VirtualAddress, Size: size}
+	return nil
+}
@@ -0,0 +1,104 @@
+package pe
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// RVAToOffset returns the file offset of the byte that is loaded at rva.
+// RVAs below SizeOfHeaders that no section claims are in the headers, at
+// the same offset. It is an error for rva to be outside the sections, or
+// in the slack between the end of the raw data of a section and the end
+// of its virtual size, which the loader fills with zeros and the file does
+// not hold.
+func (f *File) RVAToOffset(rva uint32) (uint32, error) {
+	s := f.sectionForRVA(rva)
+	if s == nil {
+		if _, _, _, sizeOfHeaders, ok := f.imageLayout(); ok && rva < sizeOfHeaders {
+			return rva, nil
+		}
+		return 0, fmt.Errorf("RVA %#x is not inside any section", rva)
+	}
+	off := rva - s.VirtualAddress
+	if s.Offset == 0 || off >= s.Size {
+		return 0, fmt.Errorf("RVA %#x is past the raw data of section %s, in memory only", rva, s.Name)
+	}
+	return s.Offset + off, nil
+}
+
+// OffsetToRVA returns the RVA at which the byte at file offset off is
+// loaded. Offsets in the headers map to the same RVA. It is an error for
+// off to be outside the raw data of the sections, as in an overlay, or in
+// raw data past the virtual size of its section, which is not loaded.
+func (f *File) OffsetToRVA(off uint32) (uint32, error) {
+	for _, s := range f.Sections {
+		if s.Offset == 0 || off < s.Offset || off-s.Offset >= s.Size {
+			continue
+		}
+		if off-s.Offset >= s.virtualExtent() {
+			return 0, fmt.Errorf("file offset %#x is past the virtual size of section %s, and not loaded", off, s.Name)
+		}
+		return s.VirtualAddress + off - s.Offset, nil
+	}
+	if _, _, _, sizeOfHeaders, ok := f.imageLayout(); ok && off < sizeOfHeaders {
+		return off, nil
+	}
+	return 0, fmt.Errorf("file offset %#x is not in the raw data of any section", off)
+}
+
+// VAToOffset returns the file offset of the byte that is loaded at the
+// virtual address va, for the image loaded at ImageBase, as RVAToOffset
+// does.
+func (f *File) VAToOffset(va uint64) (uint32, error) {
+	base := f.imageBase()
+	if va < base || va-base > 1<<32-1 {
+		return 0, fmt.Errorf("address %#x is outside the image at %#x", va, base)
+	}
+	return f.RVAToOffset(uint32(va - base))
+}
+
+// WriteAtRVA writes data over the section contents loaded at rva, which
+// Bytes writes. data may straddle sections whose raw data follow each
+// other, but each byte must be in the raw data of a section: the headers,
+// which Bytes rebuilds, and the slack past the raw data are an error.
+// Nothing is written on error.
+func (f *File) WriteAtRVA(rva uint32, data []byte) error {
+	type part struct {
+		s       *Section
+		off     uint32
+		n       uint32
+		content []byte
+	}
+	var parts []part
+	for done := uint32(0); done < uint32(len(data)); {
+		at := rva + done
+		if at < rva {
+			return fmt.Errorf("%d bytes at RVA %#x wrap around the address space", len(data), rva)
+		}
+		s := f.sectionForRVA(at)
+		if s == nil || s.Offset == 0 || at-s.VirtualAddress >= s.Size {
+			return fmt.Errorf("RVA %#x is not in the raw data of a section", at)
+		}
+		off := at - s.VirtualAddress
+		n := s.Size - off
+		if rest := uint32(len(data)) - done; n > rest {
+			n = rest
+		}
+		content, err := s.Data()
+		if err != nil {
+			return err
+		}
+		if uint64(off)+uint64(n) > uint64(len(content)) {
+			return fmt.Errorf("RVA %#x is past the end of the contents of section %s", at, s.Name)
+		}
+		parts = append(parts, part{s, off, n, content})
+		done += n
+	}
+	written := uint32(0)
+	for _, p := range parts {
+		copy(p.content[p.off:], data[written:written+p.n])
+		p.s.Replace(bytes.NewReader(p.content), int64(len(p.content)))
+		written += p.n
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package pe
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRVAToOffset(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// .text is at RVA 0x1000 with 0x6860 bytes in memory and 0x6a00 in
+	// the file; .bss has no raw data.
+	for _, tt := range []struct {
+		rva uint32
+		off uint32
+		ok  bool
+	}{
+		{0x40, 0x40, true}, // in the headers
+		{0x1000, 0x600, true},
+		{0x1000 + 0x685f, 0x600 + 0x685f, true},
+		{0x1000 + 0x6860, 0, false}, // past the virtual size of .text
+		{0xc000, 0, false},          // .bss
+		{0x8000 + 0x100, 0, false},  // past the virtual size of .data, 0xe0
+		{0x60000, 0, false},
+	} {
+		off, err := f.RVAToOffset(tt.rva)
+		if (err == nil) != tt.ok || off != tt.off {
+			t.Errorf("RVAToOffset(%#x) = %#x, %v", tt.rva, off, err)
+		}
+		if !tt.ok {
+			continue
+		}
+		if rva, err := f.OffsetToRVA(off); err != nil || rva != tt.rva {
+			t.Errorf("OffsetToRVA(%#x) = %#x, %v; want %#x", off, rva, err, tt.rva)
+		}
+		if voff, err := f.VAToOffset(f.imageBase() + uint64(tt.rva)); err != nil || voff != off {
+			t.Errorf("VAToOffset(%#x) = %#x, %v", f.imageBase()+uint64(tt.rva), voff, err)
+		}
+	}
+	// Raw data past the virtual size of .text is not loaded.
+	if rva, err := f.OffsetToRVA(0x600 + 0x6900); err == nil {
+		t.Errorf("OffsetToRVA of unloaded raw data = %#x", rva)
+	}
+	if _, err := f.VAToOffset(0x1000); err == nil {
+		t.Error("VAToOffset accepted an address below ImageBase")
+	}
+}
+
+func TestWriteAtRVA(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	patch := []byte{0xde, 0xad, 0xbe, 0xef}
+	if err := f.WriteAtRVA(0x8010, patch); err != nil {
+		t.Fatal(err)
+	}
+	// The write runs past the end of .data.
+	if err := f.WriteAtRVA(0x8000+0x1fe, patch); err == nil {
+		t.Error("WriteAtRVA wrote past the raw data of .data")
+	}
+	if err := f.WriteAtRVA(0x40, patch); err == nil {
+		t.Error("WriteAtRVA wrote to the headers")
+	}
+	g := reparse(t, f)
+	data, err := g.Section(".data").Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data[0x10:0x14], patch) {
+		t.Errorf(".data holds % x, want % x", data[0x10:0x14], patch)
+	}
+	if data[0x1fe] != 0 || data[0x1ff] != 0 {
+		t.Errorf("failed write changed the end of .data to % x", data[0x1fe:])
+	}
+}
@@ -5,8 +5,11 @@
 package pe
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"strconv"
+	"strings"
 )
 
 // SectionHeader32 represents real PE COFF section header.
@@ -25,11 +28,27 @@ type SectionHeader32 struct {
 
 // fullName finds real name of section sh. Normally name is stored
 // in sh.Name, but if it is longer then 8 characters, it is stored
-// in COFF string table st instead.
+// in COFF string table st instead, and sh.Name holds "/" and its offset
+// in decimal, or "//" and its offset in base64 for offsets too large for
+// seven decimal digits.
 func (sh *SectionHeader32) fullName(st StringTable) (string, error) {
 	if sh.Name[0] != '/' {
 		return cstring(sh.Name[:]), nil
 	}
+	if sh.Name[1] == '/' {
+		var off uint64
+		for _, c := range sh.Name[2:] {
+			i := strings.IndexByte(base64Digits, c)
+			if i < 0 {
+				return "", fmt.Errorf("bad base64 section name offset %q", sh.Name[:])
+			}
+			off = off<<6 | uint64(i)
+		}
+		if off > uint64(^uint32(0)) {
+			return "", fmt.Errorf("section name offset %d is too large", off)
+		}
+		return st.String(uint32(off))
+	}
 	i, err := strconv.Atoi(cstring(sh.Name[1:]))
 	if err != nil {
 		return "", err
@@ -37,6 +56,56 @@ func (sh *SectionHeader32) fullName(st StringTable) (string, error) {
 	return st.String(uint32(i))
 }
 
+// base64Digits are the digits of the "//" form of long section names.
+const base64Digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// nameField returns the Name field of a section header for name: name
+// itself if it fits in the 8 bytes, or else a reference to name in the
+// COFF string table st, where name is added unless st already holds it.
+func nameField(name string, st *StringTable) [8]uint8 {
+	var field [8]uint8
+	if len(name) <= len(field) {
+		copy(field[:], name)
+		return field
+	}
+	var off uint32
+	if len(*st) > 4 {
+		if i := bytes.Index((*st)[4:], append([]byte(name), 0)); i >= 0 {
+			off = uint32(i) + 4
+		}
+	}
+	if off == 0 {
+		off = st.add(name)
+	}
+	if off <= 9999999 {
+		copy(field[:], "/"+strconv.Itoa(int(off)))
+		return field
+	}
+	field[0], field[1] = '/', '/'
+	for i := len(field) - 1; i >= 2; i-- {
+		field[i] = base64Digits[off&63]
+		off >>= 6
+	}
+	return field
+}
+
+// sectionNames returns the Name fields of the section headers of f, and
+// the string table to write with them: a copy of f.StringTable, with the
+// names longer than 8 bytes of sections that were added or renamed.
+func (f *File) sectionNames() ([][8]uint8, StringTable) {
+	st := append(StringTable(nil), f.StringTable...)
+	names := make([][8]uint8, len(f.Sections))
+	for i, s := range f.Sections {
+		hdr := SectionHeader32{Name: s.OriginalName}
+		if name, err := hdr.fullName(st); err == nil && name == s.Name {
+			names[i] = s.OriginalName
+			continue
+		}
+		names[i] = nameField(s.Name, &st)
+	}
+	return names, st
+}
+
 // SectionHeader is similar to SectionHeader32 with Name
 // field replaced by Go string. OriginalName is the
 // original name of the section on disk.
@@ -67,21 +136,34 @@ type Section struct {
 	// with other clients.
 	io.ReaderAt
 	sr *io.SectionReader
+
+	cache *DataCache // set by File.SetDataCache
+
+	// view is the contents of the section in the mapping made by
+	// OpenMapped, while sr is still viewSR.
+	view   []byte
+	viewSR *io.SectionReader
 }
 
-// Data reads and returns the contents of the PE section s.
+// Data reads and returns the contents of the PE section s. The caller owns
+// the returned slice; with a DataCache set, it is a copy of the cached
+// contents. For a File opened by OpenMapped, it is a slice of the mapping
+// instead.
 func (s *Section) Data() ([]byte, error) {
 
 	if s.sr == nil { // This section was added from code, the internal SectionReader is nil
 		return nil, nil
 	}
 
-	dat := make([]byte, s.sr.Size())
-	n, err := s.sr.ReadAt(dat, 0)
-	if n == len(dat) {
-		err = nil
+	if s.viewSR != nil && s.sr == s.viewSR {
+		return s.view, nil
+	}
+
+	if s.cache != nil {
+		dat, err := s.cache.data(s.sr)
+		return append([]byte(nil), dat...), err
 	}
-	return dat[0:n], err
+	return readSection(s.sr)
 }
 
 // Open returns a new ReadSeeker reading the PE section s.
@@ -97,13 +179,30 @@ func (s *Section) Replace(reader io.ReaderAt, length int64) {
 
 // Section Flags (Characteristics field)
 const (
-	IMAGE_SCN_CNT_CODE    = 0x00000020 // Section contains code
-	IMAGE_SCN_MEM_EXECUTE = 0x20000000 // Section is executable
-	IMAGE_SCN_MEM_READ    = 0x40000000 // Section is readable
-
-	IMAGE_FILE_RELOCS_STRIPPED = 0x0001 // Relocation info stripped from file
+	IMAGE_SCN_TYPE_NO_PAD            = 0x00000008 // Section is not padded to the next boundary (obsolete)
+	IMAGE_SCN_CNT_CODE               = 0x00000020 // Section contains code
+	IMAGE_SCN_CNT_INITIALIZED_DATA   = 0x00000040 // Section contains initialized data
+	IMAGE_SCN_CNT_UNINITIALIZED_DATA = 0x00000080 // Section contains uninitialized data
+	IMAGE_SCN_LNK_OTHER              = 0x00000100 // Reserved
+	IMAGE_SCN_LNK_INFO               = 0x00000200 // Section contains comments or other information (objects only)
+	IMAGE_SCN_LNK_REMOVE             = 0x00000800 // Section is left out of the image (objects only)
+	IMAGE_SCN_LNK_COMDAT             = 0x00001000 // Section contains COMDAT data (objects only)
+	IMAGE_SCN_GPREL                  = 0x00008000 // Section contains data referenced through the global pointer
+	IMAGE_SCN_ALIGN_MASK             = 0x00F00000 // Alignment of the section data (objects only)
+	IMAGE_SCN_LNK_NRELOC_OVFL        = 0x01000000 // Section has more than 0xffff relocations; the first holds their count
+	IMAGE_SCN_MEM_DISCARDABLE        = 0x02000000 // Section can be discarded as needed
+	IMAGE_SCN_MEM_NOT_CACHED         = 0x04000000 // Section cannot be cached
+	IMAGE_SCN_MEM_NOT_PAGED          = 0x08000000 // Section is not pageable
+	IMAGE_SCN_MEM_SHARED             = 0x10000000 // Section can be shared in memory
+	IMAGE_SCN_MEM_EXECUTE            = 0x20000000 // Section is executable
+	IMAGE_SCN_MEM_READ               = 0x40000000 // Section is readable
+	IMAGE_SCN_MEM_WRITE              = 0x80000000 // Section is writeable
+
+	IMAGE_FILE_RELOCS_STRIPPED  = 0x0001 // Relocation info stripped from file
+	IMAGE_FILE_EXECUTABLE_IMAGE = 0x0002 // File is executable
 
 	IMAGE_DLLCHARACTERISTICS_NX_COMPAT = 0x0100 // Image is NX compatable
 
-	IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE = 0x0040 // DLL can move
+	IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE    = 0x0040 // DLL can move
+	IMAGE_DLLCHARACTERISTICS_FORCE_INTEGRITY = 0x0080 // Code integrity checks are enforced
 )
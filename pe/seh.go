@@ -0,0 +1,173 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Offsets of the SafeSEH fields of IMAGE_LOAD_CONFIG_DIRECTORY32.
+const (
+	loadConfigSEHandlerTable = 64
+	loadConfigSEHandlerCount = 68
+	loadConfigSEHandlerEnd   = 72
+)
+
+// IMAGE_DLLCHARACTERISTICS_NO_SEH marks an image that uses no structured
+// exception handlers at all.
+const IMAGE_DLLCHARACTERISTICS_NO_SEH = 0x0400
+
+// loadConfig32 returns the section holding the load configuration
+// directory of a 32-bit image, the section's data and the offset of the
+// directory in it, or a nil section if there is none. The directory is
+// at least as long as its Size field says.
+func (f *File) loadConfig32() (*Section, []byte, uint32, error) {
+	if _, ok := f.OptionalHeader.(*OptionalHeader32); !ok {
+		return nil, nil, 0, nil
+	}
+	return f.loadConfigSection()
+}
+
+// loadConfigSection is loadConfig32 for images of either bitness.
+func (f *File) loadConfigSection() (*Section, []byte, uint32, error) {
+	dd := f.dataDirectories()
+	if len(dd) <= IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG || dd[IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG].VirtualAddress == 0 {
+		return nil, nil, 0, nil
+	}
+	rva := dd[IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG].VirtualAddress
+	s := f.sectionForRVA(rva)
+	if s == nil {
+		return nil, nil, 0, fmt.Errorf("load configuration at RVA %#x is not in a section", rva)
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	off := rva - s.VirtualAddress
+	if uint64(off)+4 > uint64(len(data)) || uint64(off)+uint64(binary.LittleEndian.Uint32(data[off:])) > uint64(len(data)) {
+		return nil, nil, 0, fmt.Errorf("load configuration at RVA %#x is truncated", rva)
+	}
+	return s, data, off, nil
+}
+
+// SEHandlers returns the RVAs of the safe exception handlers registered
+// in the SEHandlerTable of the load configuration of an x86 image, or nil
+// if there is no table.
+func (f *File) SEHandlers() ([]uint32, error) {
+	if f.Machine != IMAGE_FILE_MACHINE_I386 {
+		return nil, fmt.Errorf("machine %#x has no SEHandlerTable", f.Machine)
+	}
+	_, data, off, err := f.loadConfig32()
+	if data == nil || err != nil || binary.LittleEndian.Uint32(data[off:]) < loadConfigSEHandlerEnd {
+		return nil, err
+	}
+	va := binary.LittleEndian.Uint32(data[off+loadConfigSEHandlerTable:])
+	n := binary.LittleEndian.Uint32(data[off+loadConfigSEHandlerCount:])
+	if va == 0 || n == 0 {
+		return nil, nil
+	}
+	if uint64(va) < f.imageBase() {
+		return nil, fmt.Errorf("SEHandlerTable %#x is below the image base", va)
+	}
+	if n > 1<<28 {
+		return nil, fmt.Errorf("SEHandlerCount %d is too large", n)
+	}
+	b, err := f.rvaData(uint32(uint64(va)-f.imageBase()), 4*n)
+	if err != nil {
+		return nil, fmt.Errorf("SEHandlerTable: %v", err)
+	}
+	handlers := make([]uint32, n)
+	for i := range handlers {
+		handlers[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return handlers, nil
+}
+
+// AddSEHandlers registers the handlers at the given RVAs in the
+// SEHandlerTable of an x86 image, so that SafeSEH enforcement lets them
+// run. The table is kept sorted and without duplicates, as the loader
+// searches it, and SEHandlerCount is updated. A table that grows is moved
+// to a new section; the old one is left in place. The NO_SEH DLL
+// characteristic is cleared. If the load configuration had no table, a
+// base relocation is added for the address of the new one, so that the
+// loader still finds it when it rebases the image.
+//
+// The load configuration must be large enough to hold the SafeSEH
+// fields.
+func (f *File) AddSEHandlers(rvas ...uint32) error {
+	handlers, err := f.SEHandlers()
+	if err != nil {
+		return err
+	}
+	ls, data, off, err := f.loadConfig32()
+	if err != nil {
+		return err
+	}
+	if ls == nil {
+		return errors.New("image has no load configuration")
+	}
+	if binary.LittleEndian.Uint32(data[off:]) < loadConfigSEHandlerEnd {
+		return fmt.Errorf("load configuration of %d bytes has no SEHandlerTable", binary.LittleEndian.Uint32(data[off:]))
+	}
+	for _, rva := range rvas {
+		if s := f.sectionForRVA(rva); s == nil || s.Characteristics&IMAGE_SCN_MEM_EXECUTE == 0 {
+			return fmt.Errorf("handler RVA %#x is not in an executable section", rva)
+		}
+	}
+
+	hadTable := binary.LittleEndian.Uint32(data[off+loadConfigSEHandlerTable:]) != 0
+	n := len(handlers)
+	merged := append(append([]uint32(nil), handlers...), rvas...)
+	sort.Slice(merged, func(i, j int) bool { return merged[i] < merged[j] })
+	uniq := merged[:0]
+	for i, h := range merged {
+		if i == 0 || h != merged[i-1] {
+			uniq = append(uniq, h)
+		}
+	}
+	oh := f.OptionalHeader.(*OptionalHeader32)
+	oh.DllCharacteristics &^= IMAGE_DLLCHARACTERISTICS_NO_SEH
+	if len(uniq) == n {
+		return nil
+	}
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uniq)
+	s, err := f.AddSection(".sxdata", b.Bytes(), IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ)
+	if err != nil {
+		return err
+	}
+	// AddSection may have moved the raw data of the load configuration.
+	if data, err = ls.Data(); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(data[off+loadConfigSEHandlerTable:], uint32(f.imageBase())+s.VirtualAddress)
+	binary.LittleEndian.PutUint32(data[off+loadConfigSEHandlerCount:], uint32(len(uniq)))
+	ls.Replace(bytes.NewReader(data), int64(len(data)))
+	if !hadTable && f.relocatable() {
+		return f.AddBaseReloc(ls.VirtualAddress+off+loadConfigSEHandlerTable, IMAGE_REL_BASED_HIGHLOW)
+	}
+	return nil
+}
+
+// validateSEH checks that the SafeSEH handler table of an x86 image is
+// sorted, as the loader searches it, and that the handlers are code.
+func (f *File) validateSEH(report func(Severity, string, ...interface{})) {
+	if f.Machine != IMAGE_FILE_MACHINE_I386 {
+		return
+	}
+	handlers, err := f.SEHandlers()
+	if err != nil {
+		report(SeverityError, "SEHandlerTable: %v", err)
+	}
+	for i, h := range handlers {
+		if i > 0 && h <= handlers[i-1] {
+			report(SeverityError, "SEHandlerTable is not sorted at entry %d (%#x)", i, h)
+		}
+		if s := f.sectionForRVA(h); s == nil || s.Characteristics&IMAGE_SCN_MEM_EXECUTE == 0 {
+			report(SeverityWarning, "safe exception handler %#x is not in an executable section", h)
+		}
+	}
+}
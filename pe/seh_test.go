@@ -0,0 +1,121 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/Binject/debug/internal/gobuild"
+)
+
+// addLoadConfig32 gives a 32-bit f a load configuration whose
+// SEHandlerTable lists handlers.
+func addLoadConfig32(t *testing.T, f *File, handlers ...uint32) {
+	t.Helper()
+	data := make([]byte, loadConfigSEHandlerEnd+4*len(handlers))
+	s, err := f.AddSection(".lcfg", data, IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	le := binary.LittleEndian
+	le.PutUint32(data, loadConfigSEHandlerEnd)
+	le.PutUint32(data[loadConfigSEHandlerTable:], uint32(f.imageBase())+s.VirtualAddress+loadConfigSEHandlerEnd)
+	le.PutUint32(data[loadConfigSEHandlerCount:], uint32(len(handlers)))
+	for i, h := range handlers {
+		le.PutUint32(data[loadConfigSEHandlerEnd+4*i:], h)
+	}
+	s.Replace(bytes.NewReader(data), int64(len(data)))
+	f.dataDirectories()[IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG] = DataDirectory{VirtualAddress: s.VirtualAddress, Size: loadConfigSEHandlerEnd}
+}
+
+func TestSEHandlers(t *testing.T) {
+	f, err := Open("testdata/gcc-386-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if h, err := f.SEHandlers(); h != nil || err != nil {
+		t.Errorf("SEHandlers() = %#x, %v without a load configuration", h, err)
+	}
+	if err := f.AddSEHandlers(0x1000); err == nil {
+		t.Error("AddSEHandlers succeeded without a load configuration")
+	}
+
+	addLoadConfig32(t, f, 0x1010, 0x1020)
+	f.OptionalHeader.(*OptionalHeader32).DllCharacteristics |= IMAGE_DLLCHARACTERISTICS_NO_SEH
+	if h, err := f.SEHandlers(); err != nil || !reflect.DeepEqual(h, []uint32{0x1010, 0x1020}) {
+		t.Errorf("SEHandlers() = %#x, %v", h, err)
+	}
+	if err := f.AddSEHandlers(0x2000); err == nil {
+		t.Error("AddSEHandlers registered a handler in .data")
+	}
+	if err := f.AddSEHandlers(0x1018, 0x1010); err != nil {
+		t.Fatal(err)
+	}
+	g := reparse(t, f)
+	if h, err := g.SEHandlers(); err != nil || !reflect.DeepEqual(h, []uint32{0x1010, 0x1018, 0x1020}) {
+		t.Errorf("SEHandlers() = %#x, %v after AddSEHandlers", h, err)
+	}
+	if g.OptionalHeader.(*OptionalHeader32).DllCharacteristics&IMAGE_DLLCHARACTERISTICS_NO_SEH != 0 {
+		t.Error("AddSEHandlers left NO_SEH set")
+	}
+	for _, is := range g.Validate() {
+		if is.Severity > SeverityInfo {
+			t.Errorf("Validate() after AddSEHandlers: %v", is)
+		}
+	}
+
+	x64, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x64.Close()
+	if _, err := x64.SEHandlers(); err == nil {
+		t.Error("SEHandlers succeeded for an x64 image")
+	}
+}
+
+// TestAddSEHandlersBaseReloc checks that a table added to a load
+// configuration without one gets a base relocation for its address.
+func TestAddSEHandlersBaseReloc(t *testing.T) {
+	f, err := Open(gobuild.Binary(t, "windows", "386"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if !f.relocatable() {
+		t.Fatal("the Go binary has no base relocations")
+	}
+	addLoadConfig32(t, f)
+	ls := f.Sections[len(f.Sections)-1]
+	data, err := ls.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint32(data[loadConfigSEHandlerTable:], 0)
+	ls.Replace(bytes.NewReader(data), int64(len(data)))
+	if err := f.AddSEHandlers(0x1010); err != nil {
+		t.Fatal(err)
+	}
+	g := reparse(t, f)
+	ls = g.Section(".lcfg")
+	if typ, ok := baseRelocs(g)[ls.VirtualAddress+loadConfigSEHandlerTable]; !ok || typ != IMAGE_REL_BASED_HIGHLOW {
+		t.Errorf("no HIGHLOW base relocation for SEHandlerTable: %v, %v", typ, ok)
+	}
+	if h, err := g.SEHandlers(); err != nil || !reflect.DeepEqual(h, []uint32{0x1010}) {
+		t.Errorf("SEHandlers() = %#x, %v after AddSEHandlers", h, err)
+	}
+}
+
+func TestValidateSEHUnsorted(t *testing.T) {
+	f, err := Open("testdata/gcc-386-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	addLoadConfig32(t, f, 0x1020, 0x1010)
+	if !findIssue(f.Validate(), SeverityError, "not sorted") {
+		t.Error("Validate() did not report an unsorted SEHandlerTable")
+	}
+}
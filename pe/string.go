@@ -9,6 +9,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+
+	"github.com/Binject/debug/internal/readerat"
 )
 
 // cstring converts ASCII byte sequence b to string.
@@ -43,9 +45,7 @@ func readStringTable(fh *FileHeader, r io.ReadSeeker) (StringTable, error) {
 	if l <= 4 {
 		return nil, nil
 	}
-	l -= 4
-	buf := make([]byte, l)
-	_, err = io.ReadFull(r, buf)
+	buf, err := readerat.ReadData(r, uint64(l-4))
 	if err != nil {
 		return nil, fmt.Errorf("fail to read string table: %v", err)
 	}
@@ -68,3 +68,28 @@ func (st StringTable) String(start uint32) (string, error) {
 	}
 	return cstring(st[start:]), nil
 }
+
+// add appends s to the string table and returns its offset, which
+// includes the 4 bytes of the length prefix. The prefix is created if
+// the table is empty and kept up to date.
+func (st *StringTable) add(s string) uint32 {
+	if len(*st) < 4 {
+		*st = StringTable{4, 0, 0, 0}
+	}
+	off := uint32(len(*st))
+	*st = append(*st, s...)
+	*st = append(*st, 0)
+	binary.LittleEndian.PutUint32((*st)[:4], uint32(len(*st)))
+	return off
+}
+
+// bytes returns the string table as it is written: a copy of st with its
+// length prefix set, which is 4 for an empty table.
+func (st StringTable) bytes() []byte {
+	b := append([]byte{0, 0, 0, 0}, st...)
+	if len(st) >= 4 {
+		b = b[4:]
+	}
+	binary.LittleEndian.PutUint32(b, uint32(len(b)))
+	return b
+}
@@ -0,0 +1,204 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// StripDebug removes the debug information of an image: the .debug_*
+// sections that MinGW links in, with the COFF symbol table, and the
+// debug directory entries pointing to CodeView, FPO, MISC, OMAP and other
+// debugger data, which MSVC links in. The data of the removed entries is
+// zeroed; entries used by the loader or describing the build, such as
+// POGO or extended DLL characteristics, are kept. Data that is not in a
+// section, such as debug data in the overlay past the last one, is left
+// alone: Bytes does not write it, so it is dropped with the overlay.
+//
+// The removed sections must follow all others in memory. NumberOfSections,
+// SizeOfImage and the SizeOf*Data totals are updated, and the raw data
+// after the removed sections moves up. The COFF string table is kept when
+// other sections still have long names. The checksum is not updated.
+func (f *File) StripDebug() error {
+	sectionAlignment, _, _, _, ok := f.imageLayout()
+	if !ok {
+		return errors.New("cannot strip debug information of a file without an optional header")
+	}
+	if f.PreserveRaw {
+		return errors.New("cannot strip debug information of a file whose original bytes are preserved")
+	}
+
+	var removed, kept []*Section
+	for _, s := range f.Sections {
+		if strings.HasPrefix(s.Name, ".debug_") || strings.HasPrefix(s.Name, ".zdebug_") {
+			removed = append(removed, s)
+		} else {
+			kept = append(kept, s)
+		}
+	}
+	for _, s := range removed {
+		for _, t := range kept {
+			if t.VirtualAddress > s.VirtualAddress {
+				return fmt.Errorf("section %s follows the debug section %s in memory", t.Name, s.Name)
+			}
+		}
+	}
+	if err := f.stripDebugDirectory(); err != nil {
+		return err
+	}
+
+	// Move the raw data that follows the removed sections up, starting
+	// with the last one.
+	sort.Slice(removed, func(i, j int) bool { return removed[i].Offset > removed[j].Offset })
+	f.Sections = kept
+	f.FileHeader.NumberOfSections = uint16(len(kept))
+	var shrink uint32
+	for _, s := range removed {
+		shrink += s.Size
+		if s.Offset != 0 && s.Size != 0 {
+			if err := f.shiftRawData(s.Offset+s.Size, -s.Size); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Without the debug sections, the symbols are of no use. The string
+	// table also holds long section names.
+	longNames := false
+	for _, s := range kept {
+		longNames = longNames || s.OriginalName[0] == '/'
+	}
+	f.COFFSymbols = nil
+	f.Symbols = nil
+	f.FileHeader.NumberOfSymbols = 0
+	f.FileHeader.PointerToSymbolTable = 0
+	if longNames {
+		// Bytes writes the string table directly after the last section.
+		for _, s := range kept {
+			if s.Offset != 0 && s.Offset+s.Size > f.FileHeader.PointerToSymbolTable {
+				f.FileHeader.PointerToSymbolTable = s.Offset + s.Size
+			}
+		}
+	} else {
+		f.StringTable = nil
+	}
+
+	var sizeOfImage uint32
+	for _, s := range kept {
+		if end := alignUp(s.VirtualAddress+s.virtualExtent(), sectionAlignment); end > sizeOfImage {
+			sizeOfImage = end
+		}
+	}
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		oh.SizeOfImage = sizeOfImage
+		addSectionSizes(IMAGE_SCN_CNT_INITIALIZED_DATA, -shrink, &oh.SizeOfCode, &oh.SizeOfInitializedData, &oh.SizeOfUninitializedData)
+	case *OptionalHeader64:
+		oh.SizeOfImage = sizeOfImage
+		addSectionSizes(IMAGE_SCN_CNT_INITIALIZED_DATA, -shrink, &oh.SizeOfCode, &oh.SizeOfInitializedData, &oh.SizeOfUninitializedData)
+	}
+	return nil
+}
+
+// strippedDebugTypes are the debug directory entry types that StripDebug
+// removes.
+var strippedDebugTypes = map[uint32]bool{
+	IMAGE_DEBUG_TYPE_COFF:          true,
+	IMAGE_DEBUG_TYPE_CODEVIEW:      true,
+	IMAGE_DEBUG_TYPE_FPO:           true,
+	IMAGE_DEBUG_TYPE_MISC:          true,
+	IMAGE_DEBUG_TYPE_EXCEPTION:     true,
+	IMAGE_DEBUG_TYPE_FIXUP:         true,
+	IMAGE_DEBUG_TYPE_OMAP_TO_SRC:   true,
+	IMAGE_DEBUG_TYPE_OMAP_FROM_SRC: true,
+	IMAGE_DEBUG_TYPE_BORLAND:       true,
+}
+
+// stripDebugDirectory removes the entries of the debug directory whose
+// type is in strippedDebugTypes and zeroes the part of their data that is
+// in a section. The remaining entries move to the start of the directory,
+// whose size shrinks; a directory left empty is cleared.
+func (f *File) stripDebugDirectory() error {
+	dd := f.dataDirectories()
+	if len(dd) <= IMAGE_DIRECTORY_ENTRY_DEBUG || dd[IMAGE_DIRECTORY_ENTRY_DEBUG].Size == 0 {
+		return nil
+	}
+	dir := dd[IMAGE_DIRECTORY_ENTRY_DEBUG]
+	ds := f.sectionForRVA(dir.VirtualAddress)
+	if ds == nil {
+		return fmt.Errorf("debug directory at RVA %#x is not in a section", dir.VirtualAddress)
+	}
+	data, err := ds.Data()
+	if err != nil {
+		return err
+	}
+	start := dir.VirtualAddress - ds.VirtualAddress
+	if uint64(start)+uint64(dir.Size) > uint64(len(data)) {
+		return fmt.Errorf("debug directory at RVA %#x runs past section %s", dir.VirtualAddress, ds.Name)
+	}
+
+	// IMAGE_DEBUG_DIRECTORY entries are 28 bytes: Characteristics,
+	// TimeDateStamp, MajorVersion, MinorVersion, Type, SizeOfData,
+	// AddressOfRawData and PointerToRawData.
+	const entrySize = 28
+	var keep [][]byte
+	updates := map[*Section][]byte{ds: data}
+	for off := start; off+entrySize <= start+dir.Size; off += entrySize {
+		e := data[off : off+entrySize]
+		if !strippedDebugTypes[binary.LittleEndian.Uint32(e[12:])] {
+			keep = append(keep, append([]byte(nil), e...))
+			continue
+		}
+		size := binary.LittleEndian.Uint32(e[16:])
+		rva := binary.LittleEndian.Uint32(e[20:])
+		ptr := binary.LittleEndian.Uint32(e[24:])
+		for _, s := range f.Sections {
+			var off uint32
+			switch {
+			case rva != 0 && s.VirtualAddress <= rva && rva < s.VirtualAddress+s.Size:
+				off = rva - s.VirtualAddress
+			case rva == 0 && ptr != 0 && s.Offset <= ptr && ptr < s.Offset+s.Size:
+				off = ptr - s.Offset
+			default:
+				continue
+			}
+			if _, ok := updates[s]; !ok {
+				b, err := s.Data()
+				if err != nil {
+					return err
+				}
+				updates[s] = b
+			}
+			b := updates[s]
+			end := uint64(off) + uint64(size)
+			if end > uint64(len(b)) {
+				end = uint64(len(b))
+			}
+			for i := uint64(off); i < end; i++ {
+				b[i] = 0
+			}
+			break
+		}
+	}
+
+	n := start
+	for _, e := range keep {
+		copy(data[n:], e)
+		n += entrySize
+	}
+	for i := n; i < start+dir.Size; i++ {
+		data[i] = 0
+	}
+	if len(keep) == 0 {
+		dd[IMAGE_DIRECTORY_ENTRY_DEBUG] = DataDirectory{}
+	} else {
+		dd[IMAGE_DIRECTORY_ENTRY_DEBUG].Size = uint32(len(keep)) * entrySize
+	}
+	for s, b := range updates {
+		s.Replace(bytes.NewReader(b), int64(len(b)))
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestStripDebug(t *testing.T) {
+	for _, name := range []string{
+		"testdata/gcc-386-mingw-exec",
+		"testdata/gcc-amd64-mingw-exec",
+	} {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		text, err := f.Section(".text").Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.StripDebug(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		g := reparse(t, f)
+		for _, s := range g.Sections {
+			if strings.HasPrefix(s.Name, ".debug_") {
+				t.Errorf("%s: section %s is left", name, s.Name)
+			}
+		}
+		if len(g.COFFSymbols) != 0 || g.FileHeader.PointerToSymbolTable != 0 || len(g.StringTable) != 0 {
+			t.Errorf("%s: %d COFF symbols at %#x and a %d byte string table are left", name,
+				len(g.COFFSymbols), g.FileHeader.PointerToSymbolTable, len(g.StringTable))
+		}
+		for _, issue := range g.Validate() {
+			if issue.Severity >= SeverityWarning {
+				t.Errorf("%s: unexpected issue: %v", name, issue)
+			}
+		}
+		if data, err := g.Section(".text").Data(); err != nil || !bytes.Equal(data, text) {
+			t.Errorf("%s: .text changed: %v", name, err)
+		}
+		sectionAlignment, _, sizeOfImage, _, _ := g.imageLayout()
+		last := g.Sections[len(g.Sections)-1]
+		if want := alignUp(last.VirtualAddress+last.virtualExtent(), sectionAlignment); sizeOfImage != want {
+			t.Errorf("%s: SizeOfImage is %#x, want %#x", name, sizeOfImage, want)
+		}
+
+		// A debug directory with a CodeView entry, which is removed, and
+		// a POGO entry, which stays.
+		data := make([]byte, 2*28+24)
+		binary.LittleEndian.PutUint32(data[12:], IMAGE_DEBUG_TYPE_CODEVIEW)
+		binary.LittleEndian.PutUint32(data[16:], 24)
+		binary.LittleEndian.PutUint32(data[28+12:], IMAGE_DEBUG_TYPE_POGO)
+		copy(data[56:], "RSDS")
+		s, err := g.AddSection(".rdata2", data, IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := s.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		binary.LittleEndian.PutUint32(raw[20:], s.VirtualAddress+56)
+		binary.LittleEndian.PutUint32(raw[24:], s.Offset+56)
+		s.Replace(bytes.NewReader(raw), int64(len(raw)))
+		g.dataDirectories()[IMAGE_DIRECTORY_ENTRY_DEBUG] = DataDirectory{VirtualAddress: s.VirtualAddress, Size: 2 * 28}
+		if err := g.StripDebug(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		h := reparse(t, g)
+		if dd := h.dataDirectories()[IMAGE_DIRECTORY_ENTRY_DEBUG]; dd.Size != 28 {
+			t.Errorf("%s: debug directory is %d bytes, want 28", name, dd.Size)
+		}
+		out, err := h.Section(".rdata2").Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ := binary.LittleEndian.Uint32(out[12:]); typ != IMAGE_DEBUG_TYPE_POGO {
+			t.Errorf("%s: debug directory starts with type %d, want POGO", name, typ)
+		}
+		if !bytes.Equal(out[28:len(data)], make([]byte, len(data)-28)) {
+			t.Errorf("%s: CodeView entry or data is left: %x", name, out[28:len(data)])
+		}
+	}
+}
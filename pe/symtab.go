@@ -0,0 +1,226 @@
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// COFF symbol storage classes and types whose auxiliary records refer to
+// other symbols by their symbol table index.
+const (
+	IMAGE_SYM_CLASS_EXTERNAL      = 2
+	IMAGE_SYM_CLASS_FUNCTION      = 101
+	IMAGE_SYM_CLASS_WEAK_EXTERNAL = 105
+
+	IMAGE_SYM_DTYPE_FUNCTION = 2
+)
+
+// AddSymbol appends sym to the COFF symbol table, followed by aux, the raw
+// auxiliary symbol records, which must be a multiple of COFFSymbolSize
+// bytes long. Names longer than 8 bytes are added to the string table.
+func (f *File) AddSymbol(sym Symbol, aux []byte) error {
+	if sym.Name == "" {
+		return errors.New("symbol has no name")
+	}
+	if len(aux)%COFFSymbolSize != 0 || len(aux)/COFFSymbolSize > 0xff {
+		return fmt.Errorf("auxiliary records of symbol %s are %d bytes long", sym.Name, len(aux))
+	}
+	if int(sym.SectionNumber) > len(f.Sections) {
+		return fmt.Errorf("section number %d of symbol %s is out of range", sym.SectionNumber, sym.Name)
+	}
+	cs := COFFSymbol{
+		Name:               f.symbolName(sym.Name),
+		Value:              sym.Value,
+		SectionNumber:      sym.SectionNumber,
+		Type:               sym.Type,
+		StorageClass:       sym.StorageClass,
+		NumberOfAuxSymbols: uint8(len(aux) / COFFSymbolSize),
+	}
+	f.COFFSymbols = append(f.COFFSymbols, cs)
+	for off := 0; off < len(aux); off += COFFSymbolSize {
+		f.COFFSymbols = append(f.COFFSymbols, auxRecord(aux[off:off+COFFSymbolSize]))
+	}
+	return f.symbolsChanged()
+}
+
+// RenameSymbol renames the first COFF symbol called oldName. A new name
+// longer than 8 bytes is appended to the string table, which keeps the old
+// name, as a section header may still refer to it.
+func (f *File) RenameSymbol(oldName, newName string) error {
+	if newName == "" {
+		return errors.New("symbol has no name")
+	}
+	i, err := f.lookupCOFFSymbol(oldName)
+	if err != nil {
+		return err
+	}
+	f.COFFSymbols[i].Name = f.symbolName(newName)
+	return f.symbolsChanged()
+}
+
+// RemoveSymbol removes the first COFF symbol called name, together with
+// its auxiliary records. The symbol indices of the relocations and
+// auxiliary records that refer to the symbols that follow are updated. A
+// symbol that is still the target of a relocation, or that another
+// symbol's auxiliary record refers to, cannot be removed.
+func (f *File) RemoveSymbol(name string) error {
+	i, err := f.lookupCOFFSymbol(name)
+	if err != nil {
+		return err
+	}
+	n := 1 + int(f.COFFSymbols[i].NumberOfAuxSymbols)
+	if i+n > len(f.COFFSymbols) {
+		return fmt.Errorf("auxiliary records of symbol %s are truncated", name)
+	}
+	start, end := uint32(i), uint32(i+n)
+	remap := func(old uint32) (uint32, bool) {
+		switch {
+		case old >= end:
+			return old - uint32(n), true
+		case old >= start:
+			return 0, false
+		}
+		return old, true
+	}
+
+	// Check everything before modifying anything.
+	for _, s := range f.Sections {
+		for _, r := range s.Relocs {
+			if _, ok := remap(r.SymbolTableIndex); !ok {
+				return fmt.Errorf("symbol %s is used by a relocation in section %s", name, s.Name)
+			}
+		}
+	}
+	refs := f.auxSymbolRefs()
+	for _, ref := range refs {
+		if ref.sym >= i && ref.sym < i+n {
+			continue
+		}
+		if _, ok := remap(ref.get(f.COFFSymbols)); !ok {
+			return fmt.Errorf("symbol %s is referred to by symbol %d", name, ref.sym)
+		}
+	}
+
+	for _, s := range f.Sections {
+		for j := range s.Relocs {
+			s.Relocs[j].SymbolTableIndex, _ = remap(s.Relocs[j].SymbolTableIndex)
+		}
+	}
+	for _, ref := range refs {
+		if ref.sym >= i && ref.sym < i+n {
+			continue
+		}
+		idx, _ := remap(ref.get(f.COFFSymbols))
+		ref.set(f.COFFSymbols, idx)
+	}
+	f.COFFSymbols = append(f.COFFSymbols[:i], f.COFFSymbols[i+n:]...)
+	return f.symbolsChanged()
+}
+
+// lookupCOFFSymbol returns the index in COFFSymbols of the first symbol
+// called name, skipping auxiliary records.
+func (f *File) lookupCOFFSymbol(name string) (int, error) {
+	for i := 0; i < len(f.COFFSymbols); i += 1 + int(f.COFFSymbols[i].NumberOfAuxSymbols) {
+		n, err := f.COFFSymbols[i].FullName(f.StringTable)
+		if err != nil {
+			return 0, err
+		}
+		if n == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("symbol %s not found", name)
+}
+
+// symbolName encodes name as the Name field of a COFF symbol, adding it
+// to the string table if it does not fit.
+func (f *File) symbolName(name string) [8]uint8 {
+	var b [8]uint8
+	if len(name) <= len(b) {
+		copy(b[:], name)
+		return b
+	}
+	binary.LittleEndian.PutUint32(b[4:], f.StringTable.add(name))
+	return b
+}
+
+// symbolsChanged regenerates Symbols and the symbol count of the file
+// header from COFFSymbols.
+func (f *File) symbolsChanged() error {
+	syms, err := removeAuxSymbols(f.COFFSymbols, f.StringTable)
+	if err != nil {
+		return err
+	}
+	f.Symbols = syms
+	f.FileHeader.NumberOfSymbols = uint32(len(f.COFFSymbols))
+	return nil
+}
+
+// auxRecord reinterprets an 18 byte auxiliary symbol record as a
+// COFFSymbol, the type COFFSymbols holds all records as.
+func auxRecord(b []byte) COFFSymbol {
+	var cs COFFSymbol
+	copy(cs.Name[:], b[0:8])
+	cs.Value = binary.LittleEndian.Uint32(b[8:])
+	cs.SectionNumber = int16(binary.LittleEndian.Uint16(b[12:]))
+	cs.Type = binary.LittleEndian.Uint16(b[14:])
+	cs.StorageClass = b[16]
+	cs.NumberOfAuxSymbols = b[17]
+	return cs
+}
+
+// An auxSymbolRef is a symbol table index stored in an auxiliary record.
+// sym is the index of the symbol owning the record, aux the index of the
+// record and off the offset of the index in it, either 0 or 12.
+type auxSymbolRef struct {
+	sym, aux, off int
+}
+
+func (r auxSymbolRef) get(syms []COFFSymbol) uint32 {
+	if r.off == 0 {
+		return binary.LittleEndian.Uint32(syms[r.aux].Name[:4])
+	}
+	// bytes 12-15 of the record: SectionNumber and Type
+	return uint32(uint16(syms[r.aux].SectionNumber)) | uint32(syms[r.aux].Type)<<16
+}
+
+func (r auxSymbolRef) set(syms []COFFSymbol, idx uint32) {
+	if r.off == 0 {
+		binary.LittleEndian.PutUint32(syms[r.aux].Name[:4], idx)
+		return
+	}
+	syms[r.aux].SectionNumber = int16(uint16(idx))
+	syms[r.aux].Type = uint16(idx >> 16)
+}
+
+// auxSymbolRefs returns the symbol table indices held by auxiliary
+// records: the tag index of weak externals, and the tag index and next
+// function index of function definitions and their .bf symbols. Zero
+// indices, which terminate the function list, are left out.
+func (f *File) auxSymbolRefs() []auxSymbolRef {
+	var refs []auxSymbolRef
+	syms := f.COFFSymbols
+	for i := 0; i < len(syms); i += 1 + int(syms[i].NumberOfAuxSymbols) {
+		s := syms[i]
+		if s.NumberOfAuxSymbols == 0 || i+1 >= len(syms) {
+			continue
+		}
+		var offs []int
+		switch {
+		case s.StorageClass == IMAGE_SYM_CLASS_WEAK_EXTERNAL:
+			offs = []int{0}
+		case s.StorageClass == IMAGE_SYM_CLASS_EXTERNAL && s.SectionNumber > 0 && s.Type>>4 == IMAGE_SYM_DTYPE_FUNCTION:
+			offs = []int{0, 12}
+		case s.StorageClass == IMAGE_SYM_CLASS_FUNCTION && cstring(s.Name[:]) == ".bf":
+			offs = []int{12}
+		}
+		for _, off := range offs {
+			ref := auxSymbolRef{sym: i, aux: i + 1, off: off}
+			if ref.get(syms) != 0 {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	return refs
+}
@@ -0,0 +1,173 @@
+package pe
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+// relocTargets returns the names of the symbols referenced by the
+// relocations of all sections.
+func relocTargets(t *testing.T, f *File) []string {
+	var names []string
+	for _, s := range f.Sections {
+		for _, r := range s.Relocs {
+			if int(r.SymbolTableIndex) >= len(f.COFFSymbols) {
+				t.Fatalf("relocation in %s refers to symbol %d of %d", s.Name, r.SymbolTableIndex, len(f.COFFSymbols))
+			}
+			name, err := f.COFFSymbols[r.SymbolTableIndex].FullName(f.StringTable)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func reparse(t *testing.T, f *File) *File {
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func findSymbol(f *File, name string) *Symbol {
+	for _, s := range f.Symbols {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestObjectRoundTrip(t *testing.T) {
+	for _, name := range []string{
+		"testdata/gcc-386-mingw-obj",
+		"testdata/gcc-amd64-mingw-obj",
+	} {
+		want, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFile(bytes.NewReader(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := f.Bytes()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: written object differs from the original", name)
+		}
+	}
+}
+
+func TestEditCOFFSymbols(t *testing.T) {
+	for _, name := range []string{
+		"testdata/gcc-386-mingw-obj",
+		"testdata/gcc-amd64-mingw-obj",
+	} {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		targets := relocTargets(t, f)
+		if len(targets) == 0 {
+			t.Fatalf("%s: no relocations", name)
+		}
+		main := "main"
+		if f.Machine == IMAGE_FILE_MACHINE_I386 {
+			main = "_main"
+		}
+
+		aux := make([]byte, COFFSymbolSize)
+		if err := f.AddSymbol(Symbol{Name: "a_long_injected_name", SectionNumber: 1, Value: 4, StorageClass: IMAGE_SYM_CLASS_EXTERNAL}, aux); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.AddSymbol(Symbol{Name: "short", SectionNumber: 1, StorageClass: IMAGE_SYM_CLASS_EXTERNAL}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.AddSymbol(Symbol{Name: "bad"}, make([]byte, 5)); err == nil {
+			t.Errorf("%s: AddSymbol accepted a truncated auxiliary record", name)
+		}
+		if err := f.RenameSymbol(main, "renamed_main_function"); err != nil {
+			t.Fatal(err)
+		}
+		// The .file symbol has an auxiliary record, so removing it moves
+		// every other symbol down by two.
+		if err := f.RemoveSymbol(".file"); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.RemoveSymbol(".text"); err == nil {
+			t.Errorf("%s: removed .text, which is used by a relocation", name)
+		}
+
+		g := reparse(t, f)
+		if s := findSymbol(g, "a_long_injected_name"); s == nil || s.Value != 4 || s.SectionNumber != 1 {
+			t.Errorf("%s: a_long_injected_name = %+v", name, s)
+		}
+		if findSymbol(g, "short") == nil {
+			t.Errorf("%s: short is missing", name)
+		}
+		if findSymbol(g, main) != nil || findSymbol(g, "renamed_main_function") == nil {
+			t.Errorf("%s: %s was not renamed", name, main)
+		}
+		if findSymbol(g, ".file") != nil {
+			t.Errorf("%s: .file was not removed", name)
+		}
+		if len(g.Symbols) != len(f.Symbols) || len(g.COFFSymbols) != len(f.COFFSymbols) {
+			t.Errorf("%s: got %d symbols and %d records, want %d and %d", name, len(g.Symbols), len(g.COFFSymbols), len(f.Symbols), len(f.COFFSymbols))
+		}
+		for i := range targets {
+			if targets[i] == main {
+				targets[i] = "renamed_main_function"
+			}
+		}
+		if got := relocTargets(t, g); fmt.Sprint(got) != fmt.Sprint(targets) {
+			t.Errorf("%s: relocations refer to %q, want %q", name, got, targets)
+		}
+		f.Close()
+	}
+}
+
+func TestImageSymbolsRoundTrip(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.RenameSymbol("pre_c_init", "a_longer_pre_c_init"); err != nil {
+		t.Fatal(err)
+	}
+	g := reparse(t, f)
+	if findSymbol(g, "pre_c_init") != nil || findSymbol(g, "a_longer_pre_c_init") == nil {
+		t.Error("pre_c_init was not renamed")
+	}
+	if len(g.StringTable) != len(f.StringTable) {
+		t.Errorf("string table is %d bytes, want %d", len(g.StringTable), len(f.StringTable))
+	}
+	for _, s := range f.Sections {
+		if gs := g.Section(s.Name); gs == nil {
+			t.Errorf("section %s is missing", s.Name)
+		}
+	}
+}
+
+func TestStringTableBytes(t *testing.T) {
+	if b := StringTable(nil).bytes(); !bytes.Equal(b, []byte{4, 0, 0, 0}) {
+		t.Errorf("empty string table is % x", b)
+	}
+	// The length prefix of the table itself is left alone.
+	st := StringTable{0, 0, 0, 0, 'a', 0}
+	if b := st.bytes(); !bytes.Equal(b, []byte{6, 0, 0, 0, 'a', 0}) || st[0] != 0 {
+		t.Errorf("bytes() = % x, table % x", b, []byte(st))
+	}
+}
@@ -0,0 +1,207 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// maxLoaderSections is the most sections the Windows loader accepts.
+const maxLoaderSections = 96
+
+// OpenTolerant opens the named file as NewFileTolerant does.
+func OpenTolerant(name string) (*File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	ff, err := NewFileTolerant(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ff.closer = f
+	return ff, nil
+}
+
+// NewFileTolerant creates a File for the PE binary in r as NewFile does,
+// but reads as much of a malformed file as it can, as the Windows loader
+// and malware analysis tools do, instead of failing. Truncated optional
+// headers and optional headers of an unexpected size or Magic are read
+// with the missing fields as zero, section headers that do not fit in the
+// file are dropped, and the raw data of sections that runs past the end
+// of the file reads as what is there. Symbols, relocations and the
+// certificate table are dropped when they cannot be read.
+//
+// Each problem is recorded in the Anomalies of the File; only a file
+// without a COFF file header, or with a DOS header but no PE signature, is
+// an error.
+func NewFileTolerant(r io.ReaderAt) (*File, error) {
+	return newFileInternal(r, false, true, DefaultLimits)
+}
+
+// tolerate records err in the Anomalies of f and returns nil if f is read
+// by NewFileTolerant, and returns err otherwise.
+func (f *File) tolerate(err error) error {
+	if err == nil || !f.tolerant {
+		return err
+	}
+	f.Anomalies = append(f.Anomalies, Issue{SeverityError, err.Error()})
+	return nil
+}
+
+// anomaly records a problem in the Anomalies of f, if f is read by
+// NewFileTolerant.
+func (f *File) anomaly(sev Severity, format string, args ...interface{}) {
+	if f.tolerant {
+		f.Anomalies = append(f.Anomalies, Issue{sev, fmt.Sprintf(format, args...)})
+	}
+}
+
+// fitsFile reports whether size bytes can be in the file, which is
+// assumed when its size is not known.
+func (f *File) fitsFile(size int64) bool {
+	n, err := f.rawLen()
+	return err != nil || size <= n
+}
+
+// symbolsInFile reports whether the COFF symbol table and the length of
+// the string table that follows it are in the file.
+func (f *File) symbolsInFile() bool {
+	fh := &f.FileHeader
+	if fh.PointerToSymbolTable == 0 {
+		return true
+	}
+	return f.fitsFile(int64(fh.PointerToSymbolTable) + COFFSymbolSize*int64(fh.NumberOfSymbols) + 4)
+}
+
+// readOptionalHeaderTolerant reads the optional header as the Windows
+// loader does: Magic selects the format, whatever SizeOfOptionalHeader
+// says, and the fields past SizeOfOptionalHeader or the end of the file
+// are zero. An unknown Magic is taken as PE32+ if the header has the size
+// of one, and PE32 otherwise. Files without an optional header keep none.
+func (f *File) readOptionalHeaderTolerant(r io.ReaderAt) {
+	size := int(f.FileHeader.SizeOfOptionalHeader)
+	if size == 0 {
+		return
+	}
+	buf := make([]byte, sizeofOptionalHeader64)
+	want := size
+	if want > len(buf) {
+		want = len(buf)
+	}
+	if n, _ := r.ReadAt(buf[:want], f.OptionalHeaderOffset); n < want {
+		f.anomaly(SeverityError, "optional header is truncated to %d bytes by the end of the file", n)
+		for i := n; i < want; i++ {
+			buf[i] = 0
+		}
+	}
+
+	magic := binary.LittleEndian.Uint16(buf)
+	pe32plus := magic == 0x20b
+	if magic != 0x10b && magic != 0x20b {
+		pe32plus = f.FileHeader.SizeOfOptionalHeader == sizeofOptionalHeader64
+		f.anomaly(SeverityError, "optional header has unexpected Magic of %#x", magic)
+	}
+	var oh interface{} = new(OptionalHeader32)
+	ohSize := sizeofOptionalHeader32
+	if pe32plus {
+		oh, ohSize = new(OptionalHeader64), sizeofOptionalHeader64
+	}
+	switch {
+	case f.FileHeader.SizeOfOptionalHeader < ohSize:
+		f.anomaly(SeverityError, "SizeOfOptionalHeader is %d, too small for a %d-byte optional header", size, ohSize)
+	case f.FileHeader.SizeOfOptionalHeader > ohSize:
+		f.anomaly(SeverityWarning, "SizeOfOptionalHeader is %d, larger than a %d-byte optional header", size, ohSize)
+	}
+	binary.Read(bytes.NewReader(buf[:ohSize]), binary.LittleEndian, oh)
+	f.OptionalHeader = oh
+}
+
+// sectionsInFile returns the number of section headers to read, or an
+// error if there are more than the limits of f allow. For a file read by
+// NewFileTolerant, that is only the headers that fit in the file, up to
+// the limit.
+func (f *File) sectionsInFile() (int, error) {
+	n := int(f.FileHeader.NumberOfSections)
+	if f.tolerant {
+		n = f.sectionsThatFit(n)
+	}
+	if n > f.limits.MaxSections {
+		if err := f.tolerate(fmt.Errorf("NumberOfSections is %d, more than the limit of %d", n, f.limits.MaxSections)); err != nil {
+			return 0, err
+		}
+		n = f.limits.MaxSections
+	}
+	return n, nil
+}
+
+// sectionsThatFit returns how many of n section headers are in the file.
+func (f *File) sectionsThatFit(n int) int {
+	if n > maxLoaderSections {
+		f.anomaly(SeverityWarning, "NumberOfSections is %d, more than the %d the Windows loader accepts", n, maxLoaderSections)
+	}
+	size, err := f.rawLen()
+	if err != nil {
+		return n
+	}
+	start := f.OptionalHeaderOffset + int64(f.FileHeader.SizeOfOptionalHeader)
+	fit := (size - start) / int64(binary.Size(SectionHeader32{}))
+	if fit < 0 {
+		fit = 0
+	}
+	if int64(n) > fit {
+		f.anomaly(SeverityError, "section table of %d headers runs past the end of the file, which holds %d", n, fit)
+		n = int(fit)
+	}
+	return n
+}
+
+// clampRawData limits the reader of s to the part of its raw data that
+// is in the file.
+func (f *File) clampRawData(s *Section) {
+	size, err := f.rawLen()
+	if err != nil {
+		return
+	}
+	if int64(s.Offset)+int64(s.Size) <= size {
+		return
+	}
+	avail := size - int64(s.Offset)
+	if avail < 0 {
+		avail = 0
+	}
+	f.anomaly(SeverityError, "section %q raw data at %#x of %#x bytes runs past the end of the file at %#x", s.Name, s.Offset, s.Size, size)
+	s.sr = io.NewSectionReader(f.raw, int64(s.Offset), avail)
+}
+
+// checkRawDataOverlaps records the sections whose raw data overlaps the
+// headers or the raw data of another section.
+func (f *File) checkRawDataOverlaps() {
+	headersEnd := uint32(f.OptionalHeaderOffset) + uint32(f.FileHeader.SizeOfOptionalHeader) +
+		uint32(len(f.Sections))*uint32(binary.Size(SectionHeader32{}))
+	var sects []*Section
+	for _, s := range f.Sections {
+		if s.Offset == 0 || s.Size == 0 {
+			continue
+		}
+		if s.Offset < headersEnd {
+			f.anomaly(SeverityWarning, "section %q raw data at %#x overlaps the headers, which end at %#x", s.Name, s.Offset, headersEnd)
+		}
+		sects = append(sects, s)
+	}
+	sort.SliceStable(sects, func(i, j int) bool { return sects[i].Offset < sects[j].Offset })
+	var last *Section // the section whose raw data reaches furthest so far
+	for _, s := range sects {
+		end := uint64(s.Offset) + uint64(s.Size)
+		if last != nil && uint64(s.Offset) < uint64(last.Offset)+uint64(last.Size) {
+			f.anomaly(SeverityWarning, "section %q raw data at %#x overlaps section %q", s.Name, s.Offset, last.Name)
+		}
+		if last == nil || end > uint64(last.Offset)+uint64(last.Size) {
+			last = s
+		}
+	}
+}
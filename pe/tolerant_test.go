@@ -0,0 +1,117 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func hasAnomaly(f *File, substr string) bool {
+	for _, a := range f.Anomalies {
+		if strings.Contains(a.Msg, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNewFileTolerant(t *testing.T) {
+	const file = "testdata/gcc-amd64-mingw-exec"
+	want, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer want.Close()
+	orig, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileHeader := want.OptionalHeaderOffset - int64(binary.Size(FileHeader{}))
+	sectionTable := want.OptionalHeaderOffset + int64(sizeofOptionalHeader64)
+	sectionHeader := func(b []byte, i int) []byte {
+		return b[sectionTable+int64(i)*40:]
+	}
+
+	f, err := NewFileTolerant(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Anomalies) != 0 {
+		t.Errorf("anomalies in a well-formed file: %v", f.Anomalies)
+	}
+
+	// An absurd NumberOfSections keeps the sections that fit in the file.
+	b := append([]byte(nil), orig...)
+	binary.LittleEndian.PutUint16(b[fileHeader+2:], 0xffff)
+	if _, err := NewFile(bytes.NewReader(b)); err == nil {
+		t.Error("NewFile accepted 65535 sections")
+	}
+	f, err = NewFileTolerant(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Sections) <= len(want.Sections) || len(f.Sections) >= 0xffff {
+		t.Errorf("read %d sections", len(f.Sections))
+	}
+	for i, s := range want.Sections {
+		if f.Sections[i].Name != s.Name {
+			t.Errorf("section %d is %q, want %q", i, f.Sections[i].Name, s.Name)
+		}
+	}
+	if !hasAnomaly(f, "more than the 96") || !hasAnomaly(f, "section table of 65535 headers") {
+		t.Errorf("anomalies are %v", f.Anomalies)
+	}
+
+	// A truncated optional header is read with the missing fields as zero,
+	// and the section table is found after it.
+	const truncated = 112 // up to the data directories
+	b = append([]byte(nil), orig...)
+	binary.LittleEndian.PutUint16(b[fileHeader+16:], truncated)
+	copy(b[want.OptionalHeaderOffset+truncated:], b[sectionTable:sectionTable+int64(40*len(want.Sections))])
+	f, err = NewFileTolerant(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oh, ok := f.OptionalHeader.(*OptionalHeader64)
+	if !ok || oh.ImageBase != want.imageBase() || oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_IMPORT].VirtualAddress != 0 {
+		t.Errorf("optional header is %+v", f.OptionalHeader)
+	}
+	if len(f.Sections) != len(want.Sections) || f.Sections[0].Name != want.Sections[0].Name {
+		t.Errorf("sections are %v", f.Sections)
+	}
+	if !hasAnomaly(f, "too small") {
+		t.Errorf("anomalies are %v", f.Anomalies)
+	}
+
+	// Raw data past the end of the file reads as what is there, and raw
+	// data in the headers is reported.
+	b = append([]byte(nil), orig...)
+	binary.LittleEndian.PutUint32(sectionHeader(b, 1)[20:], uint32(len(b)-0x10))
+	binary.LittleEndian.PutUint32(sectionHeader(b, 2)[20:], 0x10)
+	binary.LittleEndian.PutUint16(b[fileHeader:], 0x1234)
+	if _, err := NewFile(bytes.NewReader(b)); err == nil {
+		t.Error("NewFile accepted an unknown machine")
+	}
+	f, err = NewFileTolerant(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := f.Sections[1].Data()
+	if err != nil || len(data) != 0x10 {
+		t.Errorf("read %d bytes of section %q: %v", len(data), f.Sections[1].Name, err)
+	}
+	for _, substr := range []string{"machine value of 0x1234", "runs past the end of the file", "overlaps the headers"} {
+		if !hasAnomaly(f, substr) {
+			t.Errorf("no anomaly %q in %v", substr, f.Anomalies)
+		}
+	}
+
+	// Without a PE signature, there is nothing to read.
+	b = append([]byte(nil), orig...)
+	copy(b[fileHeader-4:], "XX")
+	if _, err := NewFileTolerant(bytes.NewReader(b)); err == nil {
+		t.Error("NewFileTolerant accepted a file without a PE signature")
+	}
+}
@@ -0,0 +1,207 @@
+package pe
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Severity describes how serious a problem reported by Validate is.
+type Severity int
+
+const (
+	// SeverityInfo marks an unusual but harmless construct.
+	SeverityInfo Severity = iota
+	// SeverityWarning marks a construct that the Windows loader tolerates
+	// but that other tools (or future loaders) may reject.
+	SeverityWarning
+	// SeverityError marks a construct that prevents the image from loading.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// An Issue is a single structural problem found in a File.
+type Issue struct {
+	Severity Severity
+	Msg      string
+}
+
+func (i Issue) String() string {
+	return i.Severity.String() + ": " + i.Msg
+}
+
+// Validate checks the headers and section table of f for structural
+// problems: headers overlapping section data, SizeOfImage and SizeOfHeaders
+// mismatches, misaligned raw data, data directories pointing outside of the
+// image, sections whose raw size exceeds their virtual size, hybrid
+// ARM64EC metadata and ARM64X relocations that do not fit the image, and
+// unsorted SafeSEH handler tables.
+//
+// Validate inspects the parsed structures only, so it can be run on a File
+// that has been modified in memory before calling Bytes.
+func (f *File) Validate() []Issue {
+	var issues []Issue
+	report := func(sev Severity, format string, args ...interface{}) {
+		issues = append(issues, Issue{sev, fmt.Sprintf(format, args...)})
+	}
+
+	// End of the section table, relative to the start of the file.
+	headersEnd := uint32(f.OptionalHeaderOffset) + uint32(f.FileHeader.SizeOfOptionalHeader) +
+		uint32(len(f.Sections))*uint32(binary.Size(SectionHeader32{}))
+
+	if int(f.FileHeader.NumberOfSections) != len(f.Sections) {
+		report(SeverityError, "NumberOfSections is %d, but there are %d sections", f.FileHeader.NumberOfSections, len(f.Sections))
+	}
+
+	// Raw data must not overlap the headers or other sections.
+	for i, s := range f.Sections {
+		if s.Size == 0 || s.Offset == 0 {
+			continue
+		}
+		if s.Offset < headersEnd {
+			report(SeverityError, "section %q raw data at %#x overlaps the headers ending at %#x", s.Name, s.Offset, headersEnd)
+		}
+		for _, t := range f.Sections[i+1:] {
+			if t.Size == 0 || t.Offset == 0 {
+				continue
+			}
+			if s.Offset < t.Offset+t.Size && t.Offset < s.Offset+s.Size {
+				report(SeverityWarning, "raw data of sections %q and %q overlap", s.Name, t.Name)
+			}
+		}
+	}
+
+	sectionAlignment, fileAlignment, sizeOfImage, sizeOfHeaders, ok := f.imageLayout()
+	if !ok {
+		if f.FileHeader.Characteristics&IMAGE_FILE_EXECUTABLE_IMAGE != 0 {
+			report(SeverityError, "executable image has no optional header")
+		}
+		return issues
+	}
+
+	if fileAlignment == 0 || fileAlignment&(fileAlignment-1) != 0 {
+		report(SeverityError, "FileAlignment %#x is not a power of 2", fileAlignment)
+		fileAlignment = 0
+	} else if fileAlignment < 0x200 || fileAlignment > 0x10000 {
+		report(SeverityWarning, "FileAlignment %#x is outside the range 0x200-0x10000", fileAlignment)
+	}
+	if sectionAlignment == 0 || sectionAlignment&(sectionAlignment-1) != 0 {
+		report(SeverityError, "SectionAlignment %#x is not a power of 2", sectionAlignment)
+		sectionAlignment = 0
+	} else if sectionAlignment < fileAlignment {
+		report(SeverityError, "SectionAlignment %#x is smaller than FileAlignment %#x", sectionAlignment, fileAlignment)
+	}
+
+	if sizeOfHeaders < headersEnd {
+		report(SeverityError, "SizeOfHeaders %#x does not cover the section table ending at %#x", sizeOfHeaders, headersEnd)
+	}
+	if fileAlignment != 0 && sizeOfHeaders%fileAlignment != 0 {
+		report(SeverityWarning, "SizeOfHeaders %#x is not a multiple of FileAlignment %#x", sizeOfHeaders, fileAlignment)
+	}
+
+	// Sections must be laid out in ascending, non-overlapping order
+	// after the headers.
+	imageEnd := alignUp(sizeOfHeaders, sectionAlignment)
+	for i, s := range f.Sections {
+		if s.Offset != 0 && s.Size != 0 && s.Offset < sizeOfHeaders && s.Offset >= headersEnd {
+			report(SeverityWarning, "section %q raw data at %#x lies inside SizeOfHeaders %#x", s.Name, s.Offset, sizeOfHeaders)
+		}
+		if fileAlignment != 0 && s.Offset%fileAlignment != 0 {
+			report(SeverityWarning, "section %q PointerToRawData %#x is not a multiple of FileAlignment %#x", s.Name, s.Offset, fileAlignment)
+		}
+		if sectionAlignment != 0 && s.VirtualAddress%sectionAlignment != 0 {
+			report(SeverityError, "section %q VirtualAddress %#x is not a multiple of SectionAlignment %#x", s.Name, s.VirtualAddress, sectionAlignment)
+		}
+		if s.VirtualSize != 0 && s.Size > alignUp(s.VirtualSize, fileAlignment) {
+			report(SeverityInfo, "section %q SizeOfRawData %#x exceeds VirtualSize %#x", s.Name, s.Size, s.VirtualSize)
+		}
+
+		switch {
+		case s.VirtualAddress < imageEnd && i == 0:
+			report(SeverityError, "section %q at %#x overlaps the headers mapped up to %#x", s.Name, s.VirtualAddress, imageEnd)
+		case s.VirtualAddress < imageEnd:
+			report(SeverityError, "section %q at %#x overlaps the previous section ending at %#x", s.Name, s.VirtualAddress, imageEnd)
+		case s.VirtualAddress > imageEnd:
+			report(SeverityWarning, "gap between %#x and section %q at %#x", imageEnd, s.Name, s.VirtualAddress)
+		}
+		imageEnd = alignUp(s.VirtualAddress+s.virtualExtent(), sectionAlignment)
+	}
+
+	if sizeOfImage < imageEnd {
+		report(SeverityError, "SizeOfImage %#x is smaller than the mapped image size %#x", sizeOfImage, imageEnd)
+	} else if sizeOfImage != imageEnd {
+		report(SeverityWarning, "SizeOfImage %#x does not match the mapped image size %#x", sizeOfImage, imageEnd)
+	}
+
+	for i, dd := range f.dataDirectories() {
+		if dd.VirtualAddress == 0 && dd.Size == 0 {
+			continue
+		}
+		if i == IMAGE_DIRECTORY_ENTRY_SECURITY {
+			// The certificate table is addressed by file offset and
+			// is never mapped.
+			if dd.VirtualAddress < sizeOfHeaders {
+				report(SeverityError, "certificate table at file offset %#x overlaps the headers", dd.VirtualAddress)
+			}
+			continue
+		}
+		if uint64(dd.VirtualAddress)+uint64(dd.Size) > uint64(sizeOfImage) {
+			report(SeverityError, "data directory %d (%#x-%#x) extends past SizeOfImage %#x", i, dd.VirtualAddress, dd.VirtualAddress+dd.Size, sizeOfImage)
+			continue
+		}
+		if dd.VirtualAddress < sizeOfHeaders {
+			continue // e.g. bound imports, which live in the headers
+		}
+		s := f.sectionForRVA(dd.VirtualAddress)
+		switch {
+		case s == nil:
+			report(SeverityWarning, "data directory %d at %#x is not inside any section", i, dd.VirtualAddress)
+		case dd.VirtualAddress+dd.Size > s.VirtualAddress+s.virtualExtent():
+			report(SeverityWarning, "data directory %d (%#x-%#x) extends past the end of section %q", i, dd.VirtualAddress, dd.VirtualAddress+dd.Size, s.Name)
+		}
+	}
+
+	f.validateHybrid(report)
+	f.validateSEH(report)
+	return issues
+}
+
+// LoaderCompatible reports whether Validate finds no problems that would
+// prevent the Windows loader from mapping f.
+func (f *File) LoaderCompatible() bool {
+	for _, issue := range f.Validate() {
+		if issue.Severity == SeverityError {
+			return false
+		}
+	}
+	return true
+}
+
+// virtualExtent returns the number of bytes s occupies in memory. A
+// VirtualSize of zero means the raw size is used instead.
+func (s *Section) virtualExtent() uint32 {
+	if s.VirtualSize == 0 {
+		return s.Size
+	}
+	return s.VirtualSize
+}
+
+// sectionForRVA returns the section whose virtual extent contains rva, or nil.
+func (f *File) sectionForRVA(rva uint32) *Section {
+	for _, s := range f.Sections {
+		if s.VirtualAddress <= rva && rva < s.VirtualAddress+s.virtualExtent() {
+			return s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package pe
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for _, name := range []string{
+		"testdata/gcc-386-mingw-exec",
+		"testdata/gcc-386-mingw-no-symbols-exec",
+		"testdata/gcc-amd64-mingw-exec",
+		"testdata/gcc-386-mingw-obj",
+		"testdata/gcc-amd64-mingw-obj",
+	} {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, issue := range f.Validate() {
+			if issue.Severity >= SeverityWarning {
+				t.Errorf("%s: unexpected issue: %v", name, issue)
+			}
+		}
+		if !f.LoaderCompatible() {
+			t.Errorf("%s: LoaderCompatible returned false", name)
+		}
+		f.Close()
+	}
+}
+
+func TestValidateSizeOfImage(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.OptionalHeader.(*OptionalHeader64).SizeOfImage = 0x1000
+	var found bool
+	for _, issue := range f.Validate() {
+		if issue.Severity == SeverityError && strings.Contains(issue.Msg, "SizeOfImage") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("SizeOfImage mismatch not reported")
+	}
+	if f.LoaderCompatible() {
+		t.Error("LoaderCompatible returned true for a truncated SizeOfImage")
+	}
+}
+
+func TestValidateMisalignedRawData(t *testing.T) {
+	f, err := Open("testdata/gcc-386-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Sections[1].Offset += 0x10
+	var found bool
+	for _, issue := range f.Validate() {
+		if issue.Severity == SeverityWarning && strings.Contains(issue.Msg, "PointerToRawData") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("misaligned PointerToRawData not reported")
+	}
+}
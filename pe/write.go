@@ -5,71 +5,90 @@ import (
 	"encoding/binary"
 	"errors"
 	"os"
+	"sort"
 )
 
+// Bytes returns the bytes of the PE file. With PreserveRaw set, the
+// edits are applied over the bytes the file was read from.
 func (peFile *File) Bytes() ([]byte, error) {
+	if peFile.PreserveRaw {
+		return peFile.preservedBytes()
+	}
 	var bytesWritten uint64
 	peBuf := bytes.NewBuffer(nil)
 
-	// write DOS header and stub
-	binary.Write(peBuf, binary.LittleEndian, peFile.DosHeader)
-	bytesWritten += uint64(binary.Size(peFile.DosHeader))
-	if peFile.DosExists {
-		binary.Write(peBuf, binary.LittleEndian, peFile.DosStub)
-		bytesWritten += uint64(binary.Size(peFile.DosStub))
-	}
+	// Object files start directly with the COFF file header; only images
+	// have the DOS header, stub and PE signature.
+	isImage := peFile.DosHeader.MZSignature == 0x5a4d
+	if isImage {
+		// write DOS header and stub
+		binary.Write(peBuf, binary.LittleEndian, peFile.DosHeader)
+		bytesWritten += uint64(binary.Size(peFile.DosHeader))
+		if peFile.DosExists {
+			binary.Write(peBuf, binary.LittleEndian, peFile.DosStub)
+			bytesWritten += uint64(binary.Size(peFile.DosStub))
+		}
 
-	// write Rich header
-	if peFile.RichHeader != nil {
-		binary.Write(peBuf, binary.LittleEndian, peFile.RichHeader)
-		bytesWritten += uint64(len(peFile.RichHeader))
-	}
+		// write Rich header
+		if peFile.RichHeader != nil {
+			binary.Write(peBuf, binary.LittleEndian, peFile.RichHeader)
+			bytesWritten += uint64(len(peFile.RichHeader))
+		}
+
+		// apply padding before PE header if necessary
+		if uint32(bytesWritten) != peFile.DosHeader.AddressOfNewExeHeader {
+			padding := make([]byte, peFile.DosHeader.AddressOfNewExeHeader-uint32(bytesWritten))
+			binary.Write(peBuf, binary.LittleEndian, padding)
+			bytesWritten += uint64(len(padding))
+		}
 
-	// apply padding before PE header if necessary
-	if uint32(bytesWritten) != peFile.DosHeader.AddressOfNewExeHeader {
-		padding := make([]byte, peFile.DosHeader.AddressOfNewExeHeader-uint32(bytesWritten))
-		binary.Write(peBuf, binary.LittleEndian, padding)
-		bytesWritten += uint64(len(padding))
+		// write PE signature
+		peMagic := []byte{'P', 'E', 0x00, 0x00}
+		binary.Write(peBuf, binary.LittleEndian, peMagic)
+		bytesWritten += uint64(len(peMagic))
 	}
 
-	// write PE header
-	peMagic := []byte{'P', 'E', 0x00, 0x00}
-	binary.Write(peBuf, binary.LittleEndian, peMagic)
+	// write COFF file header
+	fileHeaderOffset := bytesWritten
 	binary.Write(peBuf, binary.LittleEndian, peFile.FileHeader)
-	bytesWritten += uint64(binary.Size(peFile.FileHeader) + len(peMagic))
+	bytesWritten += uint64(binary.Size(peFile.FileHeader))
 
 	var (
 		is32bit                              bool
 		oldCertTableOffset, oldCertTableSize uint32
 	)
 
-	switch peFile.FileHeader.Machine {
-	case IMAGE_FILE_MACHINE_I386:
+	switch optionalHeader := peFile.OptionalHeader.(type) {
+	case *OptionalHeader32:
 		is32bit = true
-		optionalHeader := peFile.OptionalHeader.(*OptionalHeader32)
-		binary.Write(peBuf, binary.LittleEndian, peFile.OptionalHeader.(*OptionalHeader32))
+		binary.Write(peBuf, binary.LittleEndian, optionalHeader)
 		bytesWritten += uint64(binary.Size(optionalHeader))
 
 		oldCertTableOffset = optionalHeader.DataDirectory[CERTIFICATE_TABLE].VirtualAddress
 		oldCertTableSize = optionalHeader.DataDirectory[CERTIFICATE_TABLE].Size
-	case IMAGE_FILE_MACHINE_AMD64:
+	case *OptionalHeader64:
 		is32bit = false
-		optionalHeader := peFile.OptionalHeader.(*OptionalHeader64)
 		binary.Write(peBuf, binary.LittleEndian, optionalHeader)
 		bytesWritten += uint64(binary.Size(optionalHeader))
 
 		oldCertTableOffset = optionalHeader.DataDirectory[CERTIFICATE_TABLE].VirtualAddress
 		oldCertTableSize = optionalHeader.DataDirectory[CERTIFICATE_TABLE].Size
+	case nil:
+		if isImage {
+			return nil, errors.New("image has no optional header")
+		}
 	default:
 		return nil, errors.New("architecture not supported")
 	}
 
 	// write section headers
+	sectionHeadersOffset := bytesWritten
 	sectionHeaders := make([]SectionHeader32, len(peFile.Sections))
+	sectionNames, strtab := peFile.sectionNames()
 	for idx, section := range peFile.Sections {
 		// write section header
 		sectionHeader := SectionHeader32{
-			Name:                 section.OriginalName,
+			Name:                 sectionNames[idx],
 			VirtualSize:          section.VirtualSize,
 			VirtualAddress:       section.VirtualAddress,
 			SizeOfRawData:        section.Size,
@@ -95,6 +114,38 @@ func (peFile *File) Bytes() ([]byte, error) {
 		bytesWritten += uint64(binary.Size(sectionHeader))
 	}
 
+	// Relocations of object files are written where the section headers
+	// point to, which may be between the sections' data or after all of
+	// it. relocPointers records where each table actually ended up.
+	var relocSections []int
+	for idx, section := range peFile.Sections {
+		if len(section.Relocs) > 0 {
+			relocSections = append(relocSections, idx)
+		}
+	}
+	sort.SliceStable(relocSections, func(i, j int) bool {
+		return peFile.Sections[relocSections[i]].PointerToRelocations < peFile.Sections[relocSections[j]].PointerToRelocations
+	})
+	relocPointers := make(map[int]uint32)
+	writeRelocs := func(before uint64) {
+		for len(relocSections) > 0 {
+			idx := relocSections[0]
+			section := peFile.Sections[idx]
+			if uint64(section.PointerToRelocations) >= before {
+				return
+			}
+			if bytesWritten < uint64(section.PointerToRelocations) {
+				pad := make([]byte, uint64(section.PointerToRelocations)-bytesWritten)
+				peBuf.Write(pad)
+				bytesWritten += uint64(len(pad))
+			}
+			relocPointers[idx] = uint32(bytesWritten)
+			binary.Write(peBuf, binary.LittleEndian, section.Relocs)
+			bytesWritten += uint64(binary.Size(section.Relocs))
+			relocSections = relocSections[1:]
+		}
+	}
+
 	// write sections' data
 	for idx, sectionHeader := range sectionHeaders {
 		section := peFile.Sections[idx]
@@ -105,6 +156,9 @@ func (peFile *File) Bytes() ([]byte, error) {
 		if sectionData == nil { // for sections that weren't in the original file
 			sectionData = []byte{}
 		}
+		if section.Offset != 0 {
+			writeRelocs(uint64(section.Offset))
+		}
 		if section.Offset != 0 && bytesWritten < uint64(section.Offset) {
 			pad := make([]byte, uint64(section.Offset)-bytesWritten)
 			peBuf.Write(pad)
@@ -127,13 +181,32 @@ func (peFile *File) Bytes() ([]byte, error) {
 		bytesWritten += uint64(len(sectionData))
 	}
 
+	writeRelocs(^uint64(0))
+
 	// write symbols
-	binary.Write(peBuf, binary.LittleEndian, peFile.COFFSymbols)
-	bytesWritten += uint64(binary.Size(peFile.COFFSymbols))
+	var symbolTableOffset uint32
+	if len(peFile.COFFSymbols) > 0 {
+		if bytesWritten < uint64(peFile.FileHeader.PointerToSymbolTable) {
+			pad := make([]byte, uint64(peFile.FileHeader.PointerToSymbolTable)-bytesWritten)
+			peBuf.Write(pad)
+			bytesWritten += uint64(len(pad))
+		}
+		symbolTableOffset = uint32(bytesWritten)
+		binary.Write(peBuf, binary.LittleEndian, peFile.COFFSymbols)
+		bytesWritten += uint64(binary.Size(peFile.COFFSymbols))
+	}
 
-	// write the string table
-	binary.Write(peBuf, binary.LittleEndian, peFile.StringTable)
-	bytesWritten += uint64(binary.Size(peFile.StringTable))
+	// write the string table, which directly follows the symbols and
+	// starts with its own length
+	if len(peFile.COFFSymbols) > 0 || len(strtab) > 0 {
+		if len(peFile.COFFSymbols) == 0 {
+			// The string table is found by the symbol table pointer.
+			symbolTableOffset = uint32(bytesWritten)
+		}
+		b := strtab.bytes()
+		peBuf.Write(b)
+		bytesWritten += uint64(len(b))
+	}
 
 	var newCertTableOffset, newCertTableSize uint32
 
@@ -151,6 +224,13 @@ func (peFile *File) Bytes() ([]byte, error) {
 
 	peData := peBuf.Bytes()
 
+	// point the headers at where the relocations and symbols were written
+	for idx, ptr := range relocPointers {
+		loc := sectionHeadersOffset + uint64(idx*binary.Size(SectionHeader32{})) + 24
+		binary.LittleEndian.PutUint32(peData[loc:], ptr)
+	}
+	binary.LittleEndian.PutUint32(peData[fileHeaderOffset+8:], symbolTableOffset)
+
 	// write the offset and size of the new Certificate Table if it changed
 	if newCertTableOffset != oldCertTableOffset || newCertTableSize != oldCertTableSize {
 		certTableInfo := &DataDirectory{
@@ -0,0 +1,176 @@
+package shellcode
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/Binject/debug/elf"
+)
+
+// elfRelocKind returns the size of the field a relocation of type typ
+// sets and whether it holds an absolute address, or a size of 0 for the
+// types that are not supported.
+func elfRelocKind(m elf.Machine, typ uint32) (size int, abs bool) {
+	switch m {
+	case elf.EM_X86_64:
+		switch elf.R_X86_64(typ) {
+		case elf.R_X86_64_PC32, elf.R_X86_64_PLT32:
+			return 4, false
+		case elf.R_X86_64_64, elf.R_X86_64_RELATIVE:
+			return 8, true
+		}
+	case elf.EM_386:
+		switch elf.R_386(typ) {
+		case elf.R_386_PC32, elf.R_386_PLT32:
+			return 4, false
+		case elf.R_386_32, elf.R_386_RELATIVE:
+			return 4, true
+		}
+	}
+	return 0, false
+}
+
+// extractELF implements Extract for ELF files.
+func extractELF(f *elf.File, name string) (*Blob, error) {
+	var arch string
+	switch f.Machine {
+	case elf.EM_X86_64:
+		arch = "amd64"
+	case elf.EM_386:
+		arch = "386"
+	default:
+		return nil, fmt.Errorf("unsupported machine %v", f.Machine)
+	}
+	syms, err := f.Symbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, err
+	}
+
+	// Find the code. The relocations of object files use offsets in
+	// sections, and those of linked images virtual addresses.
+	var s *elf.Section
+	var idx int
+	var start, size uint64
+	for _, sym := range syms {
+		if sym.Name == name && elf.ST_TYPE(sym.Info) == elf.STT_FUNC && sym.Section > 0 && sym.Section < elf.SHN_LORESERVE && int(sym.Section) < len(f.Sections) {
+			idx = int(sym.Section)
+			s, start, size = f.Sections[idx], sym.Value, sym.Size
+			if f.Type != elf.ET_REL {
+				start -= s.Addr
+			}
+			break
+		}
+	}
+	if s == nil {
+		for i, t := range f.Sections {
+			if t.Name == name {
+				idx, s, size = i, t, t.Size
+				break
+			}
+		}
+	}
+	if s == nil {
+		return nil, fmt.Errorf("no function or section %s", name)
+	}
+	if s.Type == elf.SHT_NOBITS {
+		return nil, fmt.Errorf("section %s has no contents", s.Name)
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	if start+size > uint64(len(data)) || start+size < start {
+		return nil, fmt.Errorf("%s lies outside of section %s", name, s.Name)
+	}
+	code := data[start : start+size]
+	lo := start
+	if f.Type != elf.ET_REL {
+		lo += s.Addr
+	}
+	hi := lo + size
+
+	var relocs []reloc
+	for _, r := range f.Sections {
+		if r.Type != elf.SHT_REL && r.Type != elf.SHT_RELA {
+			continue
+		}
+		if f.Type == elf.ET_REL && int(r.Info) != idx || f.Type != elf.ET_REL && r.Flags&elf.SHF_ALLOC == 0 {
+			continue
+		}
+		symtab := syms
+		if int(r.Link) < len(f.Sections) && f.Sections[r.Link].Type == elf.SHT_DYNSYM {
+			if symtab, err = f.DynamicSymbols(); err != nil {
+				return nil, err
+			}
+		}
+		entries, err := f.Relocs(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.Off < lo || e.Off >= hi {
+				continue
+			}
+			if e.Sym > uint32(len(symtab)) {
+				return nil, fmt.Errorf("relocation at %#x refers to symbol %d of %d", e.Off, e.Sym, len(symtab))
+			}
+			fieldSize, abs := elfRelocKind(f.Machine, e.Type)
+			rel := reloc{off: e.Off - lo, size: fieldSize, abs: abs}
+			addend := e.Addend
+			if !e.Rela && fieldSize == 4 && rel.off+4 <= size {
+				addend = int64(int32(binary.LittleEndian.Uint32(code[rel.off:])))
+			} else if !e.Rela && fieldSize == 8 && rel.off+8 <= size {
+				addend = int64(binary.LittleEndian.Uint64(code[rel.off:]))
+			}
+
+			// Where the relocation points. References to sections point
+			// at their addend, which for PC-relative fields is biased by
+			// the size of the field.
+			var sval, target uint64
+			var ref string
+			if e.Sym == 0 {
+				sval, target = uint64(addend), uint64(addend)
+				ref = fmt.Sprintf("%#x", target)
+				addend = 0
+			} else {
+				sym := symtab[e.Sym-1]
+				sval, target, ref = sym.Value, sym.Value, sym.Name
+				if elf.ST_TYPE(sym.Info) == elf.STT_SECTION {
+					target += uint64(addend)
+					if !abs {
+						target += uint64(fieldSize)
+					}
+				}
+				if ref == "" && int(sym.Section) < len(f.Sections) {
+					ref = fmt.Sprintf("%s+%#x", f.Sections[sym.Section].Name, target)
+				}
+				if f.Type == elf.ET_REL && int(sym.Section) != idx || sym.Section == elf.SHN_UNDEF {
+					target = ^uint64(0)
+				}
+			}
+			if target < lo || target > hi {
+				rel.ref = ref
+				relocs = append(relocs, rel)
+				continue
+			}
+			if fieldSize == 0 {
+				return nil, fmt.Errorf("unsupported relocation %v at %#x", elfRelocName(f.Machine, e.Type), e.Off)
+			}
+			if abs {
+				rel.value = int64(sval-lo) + addend
+			} else {
+				rel.value = int64(sval) + addend - int64(e.Off)
+			}
+			relocs = append(relocs, rel)
+		}
+	}
+	return link(arch, code, relocs)
+}
+
+// elfRelocName returns the name of the relocation type typ.
+func elfRelocName(m elf.Machine, typ uint32) string {
+	if m == elf.EM_X86_64 {
+		return elf.R_X86_64(typ).String()
+	}
+	return elf.R_386(typ).String()
+}
@@ -0,0 +1,197 @@
+package shellcode
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/Binject/debug/macho"
+)
+
+// extractMachO implements Extract for Mach-O files. Symbols have no
+// size, so a function extends to the next symbol of its section.
+func extractMachO(f *macho.File, name string) (*Blob, error) {
+	var arch string
+	switch f.Cpu {
+	case macho.CpuAmd64:
+		arch = "amd64"
+	case macho.Cpu386:
+		arch = "386"
+	default:
+		return nil, fmt.Errorf("unsupported cpu %v", f.Cpu)
+	}
+	var syms []macho.Symbol
+	if f.Symtab != nil {
+		syms = f.Symtab.Syms
+	}
+
+	// Find the code. Relocations of object files and fixups of
+	// images both refer to virtual addresses.
+	var s *macho.Section
+	var idx int
+	var lo, hi uint64
+	for _, sym := range syms {
+		if sym.Name == name && sym.Type&macho.N_STAB == 0 && sym.Type&macho.N_TYPE == macho.N_SECT && sym.Sect > 0 && int(sym.Sect) <= len(f.Sections) {
+			idx = int(sym.Sect) - 1
+			s, lo = f.Sections[idx], sym.Value
+			hi = s.Addr + s.Size
+			for _, t := range syms {
+				if t.Type&macho.N_STAB == 0 && t.Sect == sym.Sect && t.Value > lo && t.Value < hi {
+					hi = t.Value
+				}
+			}
+			break
+		}
+	}
+	if s == nil {
+		for i, t := range f.Sections {
+			if t.Name == name {
+				idx, s, lo, hi = i, t, t.Addr, t.Addr+t.Size
+				break
+			}
+		}
+	}
+	if s == nil {
+		return nil, fmt.Errorf("no function or section %s", name)
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	if lo < s.Addr || hi < lo || hi-s.Addr > uint64(len(data)) {
+		return nil, fmt.Errorf("%s lies outside of section %s", name, s.Name)
+	}
+	code := data[lo-s.Addr : hi-s.Addr]
+	inside := func(addr uint64) bool { return lo <= addr && addr <= hi }
+
+	var relocs []reloc
+	for _, r := range s.Relocs {
+		p := s.Addr + uint64(r.Addr)
+		if p < lo || p >= hi {
+			continue
+		}
+		if r.Scattered {
+			return nil, fmt.Errorf("unsupported scattered relocation at %#x", p)
+		}
+		rel := reloc{off: p - lo, size: 1 << r.Len, abs: !r.Pcrel}
+		bias := uint64(0) // bytes of the instruction after the field
+		supported := false
+		switch {
+		case arch == "amd64" && r.Type == uint8(macho.X86_64_RELOC_UNSIGNED):
+			supported = !r.Pcrel
+		case arch == "amd64" && (r.Type == uint8(macho.X86_64_RELOC_SIGNED) || r.Type == uint8(macho.X86_64_RELOC_BRANCH)):
+			supported = r.Pcrel && r.Len == 2
+		case arch == "amd64" && r.Type >= uint8(macho.X86_64_RELOC_SIGNED_1) && r.Type <= uint8(macho.X86_64_RELOC_SIGNED_4):
+			supported = r.Pcrel && r.Len == 2
+			bias = 1 << (r.Type - uint8(macho.X86_64_RELOC_SIGNED_1))
+		case arch == "386" && r.Type == uint8(macho.GENERIC_RELOC_VANILLA):
+			supported = r.Len == 2
+		}
+		if rel.off+uint64(rel.size) > uint64(len(code)) {
+			return nil, fmt.Errorf("relocation at %#x runs past the end of the code", p)
+		}
+		var addend int64
+		switch rel.size {
+		case 4:
+			addend = int64(int32(binary.LittleEndian.Uint32(code[rel.off:])))
+		case 8:
+			addend = int64(binary.LittleEndian.Uint64(code[rel.off:]))
+		}
+
+		// Non-external relocations refer to a section, and the field
+		// holds the address it points to.
+		var target uint64
+		if r.Extern {
+			if int(r.Value) >= len(syms) {
+				return nil, fmt.Errorf("relocation at %#x refers to symbol %d of %d", p, r.Value, len(syms))
+			}
+			sym := syms[r.Value]
+			rel.ref = sym.Name
+			if sym.Type&macho.N_TYPE == macho.N_SECT && int(sym.Sect) == idx+1 && inside(sym.Value) {
+				target = sym.Value
+				rel.ref = ""
+			}
+		} else {
+			target = uint64(addend)
+			if r.Pcrel {
+				target = p + 4 + bias + uint64(addend)
+			}
+			if int(r.Value) != idx+1 || !inside(target) {
+				rel.ref = fmt.Sprintf("section %d+%#x", r.Value, target)
+				if r.Value > 0 && int(r.Value) <= len(f.Sections) {
+					t := f.Sections[r.Value-1]
+					rel.ref = fmt.Sprintf("%s,%s+%#x", t.Seg, t.Name, target-t.Addr)
+				}
+			}
+		}
+		if rel.ref != "" {
+			relocs = append(relocs, rel)
+			continue
+		}
+		if !supported {
+			return nil, fmt.Errorf("unsupported relocation type %d at %#x", r.Type, p)
+		}
+		switch {
+		case !r.Extern && r.Pcrel:
+			rel.value = addend
+		case !r.Extern:
+			rel.value = int64(target - lo)
+		case r.Pcrel && arch == "386":
+			// i386 fields already hold the addend less the address
+			// of the next instruction.
+			rel.value = int64(target) + addend
+		case r.Pcrel:
+			rel.value = int64(target) + addend - int64(p+4)
+		default:
+			rel.value = int64(target-lo) + addend
+		}
+		relocs = append(relocs, rel)
+	}
+
+	// Linked images are fixed up by dyld, which slides rebases and
+	// binds pointers to symbols.
+	rebases, err := f.Rebases()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rebases {
+		addr, err := f.RebaseAddr(r)
+		if err != nil {
+			return nil, err
+		}
+		if addr < lo || addr >= hi {
+			continue
+		}
+		rel := reloc{off: addr - lo, size: 8, abs: true}
+		if arch == "386" {
+			rel.size = 4
+		}
+		if r.Type == macho.RebaseTypeTextPCRel32 || rel.off+uint64(rel.size) > uint64(len(code)) {
+			return nil, fmt.Errorf("unsupported rebase at %#x", addr)
+		}
+		target := uint64(binary.LittleEndian.Uint32(code[rel.off:]))
+		if rel.size == 8 {
+			target = binary.LittleEndian.Uint64(code[rel.off:])
+		}
+		if !inside(target) {
+			rel.ref = fmt.Sprintf("%#x", target)
+		}
+		rel.value = int64(target - lo)
+		relocs = append(relocs, rel)
+	}
+	for _, list := range []func() ([]macho.Bind, error){f.Binds, f.LazyBinds, f.WeakBinds} {
+		binds, err := list()
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range binds {
+			addr, err := f.BindAddr(b)
+			if err != nil {
+				return nil, err
+			}
+			if lo <= addr && addr < hi {
+				relocs = append(relocs, reloc{off: addr - lo, ref: b.Symbol})
+			}
+		}
+	}
+	return link(arch, code, relocs)
+}
@@ -0,0 +1,164 @@
+package shellcode
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/Binject/debug/pe"
+)
+
+// extractPE implements Extract for PE and COFF files. COFF symbols have
+// no size, so a function extends to the next symbol of its section.
+// Functions are the symbols of type 0x20, a function returning nothing
+// in the COFF type encoding that compilers use for all functions.
+func extractPE(f *pe.File, name string) (*Blob, error) {
+	var arch string
+	switch f.Machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		arch = "amd64"
+	case pe.IMAGE_FILE_MACHINE_I386:
+		arch = "386"
+	default:
+		return nil, fmt.Errorf("unsupported machine %#x", f.Machine)
+	}
+	extent := func(s *pe.Section) uint32 {
+		if s.VirtualSize != 0 && s.VirtualSize < s.Size {
+			return s.VirtualSize
+		}
+		return s.Size
+	}
+
+	// Find the code.
+	var s *pe.Section
+	var idx int
+	var start, end uint32
+	for _, sym := range f.Symbols {
+		if sym.Name == name && sym.Type == 0x20 && sym.SectionNumber > 0 && int(sym.SectionNumber) <= len(f.Sections) {
+			idx = int(sym.SectionNumber) - 1
+			s, start = f.Sections[idx], sym.Value
+			end = extent(s)
+			for _, t := range f.Symbols {
+				if t.SectionNumber == sym.SectionNumber && t.Value > start && t.Value < end {
+					end = t.Value
+				}
+			}
+			break
+		}
+	}
+	if s == nil {
+		for i, t := range f.Sections {
+			if t.Name == name {
+				idx, s, end = i, t, extent(t)
+				break
+			}
+		}
+	}
+	if s == nil {
+		return nil, fmt.Errorf("no function or section %s", name)
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	if start > end || end > uint32(len(data)) {
+		return nil, fmt.Errorf("%s lies outside of section %s", name, s.Name)
+	}
+	code := data[start:end]
+	size := uint64(end - start)
+
+	var relocs []reloc
+	if f.OptionalHeader == nil {
+		// Object files are relocated with COFF relocations, whose
+		// VirtualAddress is an offset in the section.
+		for _, r := range s.Relocs {
+			if r.VirtualAddress < start || r.VirtualAddress >= end {
+				continue
+			}
+			if int(r.SymbolTableIndex) >= len(f.COFFSymbols) {
+				return nil, fmt.Errorf("relocation at %#x refers to symbol %d of %d", r.VirtualAddress, r.SymbolTableIndex, len(f.COFFSymbols))
+			}
+			sym := &f.COFFSymbols[r.SymbolTableIndex]
+			rel := reloc{off: uint64(r.VirtualAddress - start), size: 4}
+			bias := int64(-1) // displacement from the end of the field, or -1 for absolute addresses
+			switch {
+			case arch == "amd64" && r.Type == pe.IMAGE_REL_AMD64_ADDR64:
+				rel.size = 8
+			case arch == "amd64" && r.Type >= pe.IMAGE_REL_AMD64_REL32 && r.Type <= pe.IMAGE_REL_AMD64_REL32_5:
+				bias = int64(r.Type - pe.IMAGE_REL_AMD64_REL32)
+			case arch == "386" && r.Type == pe.IMAGE_REL_I386_DIR32:
+			case arch == "386" && r.Type == pe.IMAGE_REL_I386_REL32:
+				bias = 0
+			default:
+				rel.size = 0
+			}
+			rel.abs = bias < 0
+			if int(sym.SectionNumber) != idx+1 || sym.Value < start || sym.Value > end {
+				name, err := sym.FullName(f.StringTable)
+				if err != nil {
+					return nil, err
+				}
+				rel.ref = name
+				relocs = append(relocs, rel)
+				continue
+			}
+			if rel.size == 0 || rel.off+uint64(rel.size) > size {
+				return nil, fmt.Errorf("unsupported relocation %#x at %#x", r.Type, r.VirtualAddress)
+			}
+			addend := int64(int32(binary.LittleEndian.Uint32(code[rel.off:])))
+			if rel.size == 8 {
+				addend = int64(binary.LittleEndian.Uint64(code[rel.off:]))
+			}
+			if rel.abs {
+				rel.value = int64(sym.Value-start) + addend
+			} else {
+				rel.value = int64(sym.Value) + addend - int64(r.VirtualAddress+4) - bias
+			}
+			relocs = append(relocs, rel)
+		}
+		return link(arch, code, relocs)
+	}
+
+	// Images are relocated with base relocations, which hold virtual
+	// addresses.
+	var imageBase uint64
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		imageBase = uint64(oh.ImageBase)
+	case *pe.OptionalHeader64:
+		imageBase = oh.ImageBase
+	}
+	lo := uint64(s.VirtualAddress + start)
+	hi := lo + size
+	if f.BaseRelocationTable != nil {
+		for _, block := range *f.BaseRelocationTable {
+			for _, item := range block.BlockItems {
+				rva := uint64(block.VirtualAddress) + uint64(item.Offset)
+				if item.Type == pe.IMAGE_REL_BASED_ABSOLUTE || rva < lo || rva >= hi {
+					continue
+				}
+				rel := reloc{off: rva - lo, abs: true}
+				switch item.Type {
+				case pe.IMAGE_REL_BASED_HIGHLOW:
+					rel.size = 4
+				case pe.IMAGE_REL_BASED_DIR64:
+					rel.size = 8
+				default:
+					return nil, fmt.Errorf("unsupported base relocation type %d at %#x", item.Type, rva)
+				}
+				if rel.off+uint64(rel.size) > size {
+					return nil, fmt.Errorf("base relocation at %#x runs past the end of the code", rva)
+				}
+				va := uint64(binary.LittleEndian.Uint32(code[rel.off:]))
+				if rel.size == 8 {
+					va = binary.LittleEndian.Uint64(code[rel.off:])
+				}
+				if va-imageBase < lo || va-imageBase > hi {
+					rel.ref = fmt.Sprintf("%#x", va)
+				}
+				rel.value = int64(va - imageBase - lo)
+				relocs = append(relocs, rel)
+			}
+		}
+	}
+	return link(arch, code, relocs)
+}
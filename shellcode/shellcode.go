@@ -0,0 +1,155 @@
+// Package shellcode extracts a function or section of an ELF, Mach-O or
+// PE file as a self-contained blob of position-independent code, the
+// opposite of injecting code into a binary.
+//
+// The relocations that apply to the extracted range are resolved when
+// they refer to the range itself. PC-relative references then need no
+// further work, and absolute addresses are listed as fixups, which a
+// loader, the stub PIC prepends or pe.File.InjectCodeWithRelocs applies.
+// References out of the range cannot be made position independent and
+// are reported in an *UnresolvedError.
+//
+// Relocations of the 386 and amd64 architectures are supported. In
+// object files these are the relocations of the section; in linked
+// images they are the relocations left for the loader: ELF dynamic
+// relocations, PE base relocations and Mach-O rebases and binds. The
+// linker has already resolved the other references of a linked image,
+// such as PC-relative calls to other functions, without leaving a trace,
+// so these are not detected.
+package shellcode
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Binject/debug/elf"
+	"github.com/Binject/debug/macho"
+	"github.com/Binject/debug/pe"
+)
+
+// A Blob is code extracted from a binary.
+type Blob struct {
+	Arch string // "386" or "amd64"
+	Code []byte
+
+	// Fixups are the offsets in Code of pointer sized absolute
+	// addresses. Each holds an address relative to the start of Code, to
+	// which the address Code is loaded at must be added, as with
+	// pe.File.InjectCodeWithRelocs.
+	Fixups []uint32
+}
+
+// An UnresolvedError lists the references out of the extracted code.
+type UnresolvedError struct {
+	Refs []string // symbol names, or section names and addresses
+}
+
+func (e *UnresolvedError) Error() string {
+	return "unresolved references: " + strings.Join(e.Refs, ", ")
+}
+
+// Extract returns the code of the function or, if there is no function
+// of that name, the section called name in file, which is an *elf.File,
+// *macho.File or *pe.File. An *UnresolvedError is returned if the code
+// refers to anything outside of itself.
+func Extract(file interface{}, name string) (*Blob, error) {
+	switch f := file.(type) {
+	case *elf.File:
+		return extractELF(f, name)
+	case *macho.File:
+		return extractMachO(f, name)
+	case *pe.File:
+		return extractPE(f, name)
+	}
+	return nil, fmt.Errorf("unsupported file type %T", file)
+}
+
+// A reloc is a relocation that applies to the extracted code, as found
+// by the extractor of a file format.
+type reloc struct {
+	off   uint64 // offset of the field in the code
+	size  int    // size of the field, 4 or 8
+	value int64  // displacement, or address relative to the start of the code
+	abs   bool   // value is an absolute address, which needs a fixup
+	ref   string // what the relocation refers to out of the code, or ""
+}
+
+// link applies relocs to a copy of code.
+func link(arch string, code []byte, relocs []reloc) (*Blob, error) {
+	b := &Blob{Arch: arch, Code: append([]byte(nil), code...)}
+	ptrSize := 8
+	if arch == "386" {
+		ptrSize = 4
+	}
+	var unresolved []string
+	seen := make(map[string]bool)
+	for _, r := range relocs {
+		if r.off+uint64(r.size) > uint64(len(code)) {
+			return nil, fmt.Errorf("relocation at %#x runs past the end of the code", r.off)
+		}
+		switch {
+		case r.ref != "":
+			if !seen[r.ref] {
+				seen[r.ref] = true
+				unresolved = append(unresolved, r.ref)
+			}
+			continue
+		case r.abs && r.size != ptrSize:
+			return nil, fmt.Errorf("%d-byte absolute address at %#x is not position independent", r.size, r.off)
+		case r.abs:
+			b.Fixups = append(b.Fixups, uint32(r.off))
+		}
+		if r.size == 8 {
+			binary.LittleEndian.PutUint64(b.Code[r.off:], uint64(r.value))
+		} else {
+			binary.LittleEndian.PutUint32(b.Code[r.off:], uint32(r.value))
+		}
+	}
+	if len(unresolved) > 0 {
+		return nil, &UnresolvedError{unresolved}
+	}
+	return b, nil
+}
+
+// PIC returns code that can run at any address. Without fixups, this is
+// Code itself. Otherwise a stub is prepended that adds the address of
+// Code to each fixup and jumps to it, so the code must be loaded
+// writable. The stub clobbers ECX or RCX and runs once: the fixups must
+// not be applied again.
+func (b *Blob) PIC() ([]byte, error) {
+	if len(b.Fixups) == 0 {
+		return b.Code, nil
+	}
+	var stub []byte
+	put32 := func(v uint32) {
+		var w [4]byte
+		binary.LittleEndian.PutUint32(w[:], v)
+		stub = append(stub, w[:]...)
+	}
+	switch b.Arch {
+	case "amd64":
+		// lea rcx, [rip+disp32]; add [rcx+disp32], rcx...; jmp rel32
+		size := 7 + 7*len(b.Fixups) + 5
+		stub = append(stub, 0x48, 0x8d, 0x0d)
+		put32(uint32(size - 7))
+		for _, off := range b.Fixups {
+			stub = append(stub, 0x48, 0x01, 0x89)
+			put32(off)
+		}
+	case "386":
+		// call $+5; pop ecx; add ecx, imm32; add [ecx+disp32], ecx...; jmp rel32
+		size := 5 + 1 + 6 + 6*len(b.Fixups) + 5
+		stub = append(stub, 0xe8, 0, 0, 0, 0, 0x59, 0x81, 0xc1)
+		put32(uint32(size - 5))
+		for _, off := range b.Fixups {
+			stub = append(stub, 0x01, 0x89)
+			put32(off)
+		}
+	default:
+		return nil, errors.New("no relocation stub for architecture " + b.Arch)
+	}
+	stub = append(stub, 0xe9, 0, 0, 0, 0) // the code follows directly
+	return append(stub, b.Code...), nil
+}
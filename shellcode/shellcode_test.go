@@ -0,0 +1,140 @@
+package shellcode
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/Binject/debug/elf"
+	"github.com/Binject/debug/macho"
+	"github.com/Binject/debug/pe"
+)
+
+func TestExtractELF(t *testing.T) {
+	f, err := elf.Open("../elf/testdata/go-relocation-test-gcc441-x86-64.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want := []byte{0x55, 0x48, 0x89, 0xe5, 0xc9, 0xc3}
+	for _, name := range []string{"f", ".text"} {
+		b, err := Extract(f, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Arch != "amd64" || !bytes.Equal(b.Code, want) || len(b.Fixups) != 0 {
+			t.Errorf("%s: got %+v, want the code of f", name, b)
+		}
+		if pic, err := b.PIC(); err != nil || !bytes.Equal(pic, want) {
+			t.Errorf("%s: PIC returned %x, %v", name, pic, err)
+		}
+	}
+	if _, err := Extract(f, "nope"); err == nil {
+		t.Error("Extract accepted a missing function")
+	}
+}
+
+func TestExtractUnresolved(t *testing.T) {
+	p, err := pe.Open("../pe/testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	m, err := macho.Open("../macho/testdata/clang-amd64-darwin.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	for _, c := range []struct {
+		file interface{}
+		name string
+		refs []string
+	}{
+		{p, "main", []string{"__main", ".rdata", "puts"}},
+		{m, "_main", []string{"_printf", "__TEXT,__cstring+0x0"}},
+	} {
+		_, err := Extract(c.file, c.name)
+		u, ok := err.(*UnresolvedError)
+		if !ok || !reflect.DeepEqual(u.Refs, c.refs) {
+			t.Errorf("%T %s: got %v, want references to %q", c.file, c.name, err, c.refs)
+		}
+	}
+}
+
+func TestExtractPEResolved(t *testing.T) {
+	f, err := pe.Open("../pe/testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	mainSym := -1
+	for i := range f.COFFSymbols {
+		if name, _ := f.COFFSymbols[i].FullName(f.StringTable); name == "main" {
+			mainSym = i
+		}
+	}
+	if mainSym < 0 {
+		t.Fatal("no symbol main")
+	}
+
+	// Make main call itself instead of __main, and store its address
+	// over the padding after it.
+	text := f.Section(".text")
+	data, err := text.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(data[0x24:], make([]byte, 8))
+	text.Replace(bytes.NewReader(data), int64(len(data)))
+	text.Relocs = []pe.Reloc{
+		{VirtualAddress: 0x9, SymbolTableIndex: uint32(mainSym), Type: pe.IMAGE_REL_AMD64_REL32},
+		{VirtualAddress: 0x24, SymbolTableIndex: uint32(mainSym), Type: pe.IMAGE_REL_AMD64_ADDR64},
+	}
+	b, err := Extract(f, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Code[0x8:0xd]; !bytes.Equal(got, []byte{0xe8, 0xf3, 0xff, 0xff, 0xff}) {
+		t.Errorf("call is %x, want a call to offset 0", got)
+	}
+	if !reflect.DeepEqual(b.Fixups, []uint32{0x24}) || !bytes.Equal(b.Code[0x24:0x2c], make([]byte, 8)) {
+		t.Errorf("fixups are %v at %x, want [36] holding 0", b.Fixups, b.Code[0x24:0x2c])
+	}
+}
+
+func TestPIC(t *testing.T) {
+	code := []byte{0xc3, 0, 0, 0, 0, 0, 0, 0, 0}
+	b := &Blob{Arch: "amd64", Code: code, Fixups: []uint32{1}}
+	pic, err := b.PIC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := []byte{
+		0x48, 0x8d, 0x0d, 0x0c, 0, 0, 0, // lea rcx, [rip+12]
+		0x48, 0x01, 0x89, 0x01, 0, 0, 0, // add [rcx+1], rcx
+		0xe9, 0, 0, 0, 0, // jmp code
+	}
+	if want := append(stub, code...); !bytes.Equal(pic, want) {
+		t.Errorf("amd64 stub is %x, want %x", pic, want)
+	}
+
+	b = &Blob{Arch: "386", Code: code[:5], Fixups: []uint32{1}}
+	if pic, err = b.PIC(); err != nil {
+		t.Fatal(err)
+	}
+	stub = []byte{
+		0xe8, 0, 0, 0, 0, // call $+5
+		0x59,                      // pop ecx
+		0x81, 0xc1, 0x12, 0, 0, 0, // add ecx, 18
+		0x01, 0x89, 0x01, 0, 0, 0, // add [ecx+1], ecx
+		0xe9, 0, 0, 0, 0, // jmp code
+	}
+	if want := append(stub, code[:5]...); !bytes.Equal(pic, want) {
+		t.Errorf("386 stub is %x, want %x", pic, want)
+	}
+
+	b.Arch = "arm64"
+	if _, err := b.PIC(); err == nil {
+		t.Error("PIC made a stub for arm64")
+	}
+}